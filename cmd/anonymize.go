@@ -0,0 +1,325 @@
+// =============================================================================
+// CSV to XML Converter - Anonymize Command
+// =============================================================================
+//
+// This file defines the 'anonymize' command, which writes an anonymized copy
+// of a CSV file (see masking.Anonymizer): fake names, scrambled account
+// numbers that keep their format and check digits, and jittered amounts.
+// The copy can be attached to a vendor ticket to reproduce a problem
+// without exposing personal data.
+//
+// COMMAND USAGE:
+//   converter anonymize <file.csv> [--output FILE] [--name COL]... [--account COL]... [--amount COL]...
+//
+// FLAGS:
+//   --output     : The anonymized copy (default: ./<name>_anonymized.csv)
+//   --department : Read the file with this department's csv_settings, and
+//                  anonymize its sensitive_fields as accounts
+//   --name, --account, --amount, --text : Anonymize a column as this kind
+//   --keep       : Leave a column unchanged, even if its header suggests a kind
+//   --jitter     : The largest change of an amount, as a share (default: 0.1)
+//   --key        : The key of the fake values (default: a random key)
+//   --delimiter, --header-rows, --encoding : CSV settings, without --department
+//
+// Columns not named by a flag are anonymized by the kind their header
+// suggests (e.g., "account" for BANK_ACCT_NO). The columns left unchanged
+// are listed, to be reviewed before the copy is shared.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/csvparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/masking"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+var (
+	// anonymizeOutput is the anonymized copy.
+	anonymizeOutput string
+
+	// anonymizeDepartment is the department whose CSV settings and
+	// sensitive fields are used.
+	anonymizeDepartment string
+
+	// anonymizeColumns are the columns named for each anonymization kind.
+	anonymizeColumns = make(map[string]*[]string)
+
+	// anonymizeKeep are the columns left unchanged.
+	anonymizeKeep []string
+
+	// anonymizeJitter is the largest change of an amount.
+	anonymizeJitter float64
+
+	// anonymizeKey is the key of the fake values.
+	anonymizeKey string
+
+	// anonymizeDelimiter, anonymizeHeaderRows, and anonymizeEncoding are the
+	// CSV settings used without a department.
+	anonymizeDelimiter  string
+	anonymizeHeaderRows int
+	anonymizeEncoding   string
+)
+
+// =============================================================================
+// ANONYMIZE COMMAND DEFINITION
+// =============================================================================
+
+// anonymizeCmd represents the 'anonymize' command.
+var anonymizeCmd = &cobra.Command{
+	Use:   "anonymize <file.csv>",
+	Short: "Write an anonymized copy of a CSV file for sharing",
+	Long: `Writes an anonymized copy of a CSV file, to attach to a vendor ticket as a
+reproduction without exposing personal data:
+
+  name     fake names, keeping "Last, First" order and case
+  account  letters and digits scrambled, separators kept; Luhn and ABA
+           routing number check digits stay valid
+  amount   jittered by up to --jitter of the amount, same decimals
+  text     letters and digits scrambled (addresses, memo lines)
+
+The same value always becomes the same fake value, so rows still group into
+the same transactions. The fake values are derived with a key: a random one,
+unless --key is given to anonymize related files consistently.
+
+Columns not named by a flag are anonymized by the kind their header suggests
+(e.g., "account" for BANK_ACCT_NO, "name" for PAYEE_NAME), and with
+--department its sensitive_fields as accounts. Check the columns listed as
+unchanged before sharing the copy.
+
+Examples:
+  converter anonymize input/claims_payments_20240131.csv
+  converter anonymize claims.csv --department CLAIMS --name ADJUSTER --keep STATE --output ticket-1234.csv`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runAnonymize(args[0])
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the anonymize command with the root command and sets up flags.
+func init() {
+	rootCmd.AddCommand(anonymizeCmd)
+
+	anonymizeCmd.Flags().StringVarP(
+		&anonymizeOutput,
+		"output", "o",
+		"",
+		"The anonymized copy (default: ./<name>_anonymized.csv)",
+	)
+
+	anonymizeCmd.Flags().StringVar(
+		&anonymizeDepartment,
+		"department",
+		"",
+		"Use this department's csv_settings, and anonymize its sensitive_fields",
+	)
+
+	for _, kind := range masking.AnonymizationKinds {
+		columns := new([]string)
+		anonymizeColumns[kind] = columns
+		anonymizeCmd.Flags().StringArrayVar(
+			columns,
+			kind,
+			nil,
+			fmt.Sprintf("Anonymize this column as %s (repeatable)", kind),
+		)
+	}
+
+	anonymizeCmd.Flags().StringArrayVar(
+		&anonymizeKeep,
+		"keep",
+		nil,
+		"Leave this column unchanged (repeatable)",
+	)
+
+	anonymizeCmd.Flags().Float64Var(
+		&anonymizeJitter,
+		"jitter",
+		0.1,
+		"Largest change of an amount, as a share of it",
+	)
+
+	anonymizeCmd.Flags().StringVar(
+		&anonymizeKey,
+		"key",
+		"",
+		"Key of the fake values, to anonymize related files consistently (default: random)",
+	)
+
+	anonymizeCmd.Flags().StringVar(
+		&anonymizeDelimiter,
+		"delimiter",
+		",",
+		"Field delimiter, without --department",
+	)
+
+	anonymizeCmd.Flags().IntVar(
+		&anonymizeHeaderRows,
+		"header-rows",
+		1,
+		"Number of header rows, without --department",
+	)
+
+	anonymizeCmd.Flags().StringVar(
+		&anonymizeEncoding,
+		"encoding",
+		"UTF-8",
+		"Character encoding, without --department",
+	)
+}
+
+// =============================================================================
+// ANONYMIZE FUNCTION
+// =============================================================================
+
+// runAnonymize writes the anonymized copy of a CSV file.
+//
+// PARAMETERS:
+//   - file: The CSV file.
+//
+// RETURNS:
+//   - An error if a flag names an unknown column, or the file cannot be
+//     read or the copy written.
+func runAnonymize(file string) error {
+	settings := config.CSVSettings{
+		Delimiter:    anonymizeDelimiter,
+		HeaderRows:   anonymizeHeaderRows,
+		DataStartRow: anonymizeHeaderRows + 1,
+		Encoding:     anonymizeEncoding,
+		QuoteChar:    "\"",
+		EscapeChar:   "\"",
+	}
+	if settings.Delimiter == `\t` {
+		settings.Delimiter = "\t"
+	}
+
+	var sensitive []config.SensitiveField
+	if anonymizeDepartment != "" {
+		_, deptConfigs, err := loadListConfig()
+		if err != nil {
+			return err
+		}
+		deptConfig := deptConfigs[anonymizeDepartment]
+		if deptConfig == nil {
+			return &exitError{exitConfigError, fmt.Errorf("unknown department: %s", anonymizeDepartment)}
+		}
+		settings = deptConfig.CSVSettings
+		sensitive = deptConfig.SensitiveFields
+	}
+
+	data, err := csvparser.Parse(file, settings)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	columns, err := anonymizationColumns(data.Headers, sensitive)
+	if err != nil {
+		return err
+	}
+
+	key := []byte(anonymizeKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+	}
+	if anonymizeJitter < 0 || anonymizeJitter >= 1 {
+		return fmt.Errorf("--jitter must be at least 0 and less than 1")
+	}
+	anonymizer := masking.NewAnonymizer(key, columns, anonymizeJitter)
+
+	output := anonymizeOutput
+	if output == "" {
+		base := filepath.Base(file)
+		output = strings.TrimSuffix(base, filepath.Ext(base)) + "_anonymized" + filepath.Ext(base)
+	}
+	if absInput, err := filepath.Abs(file); err == nil {
+		if absOutput, err := filepath.Abs(output); err == nil && absInput == absOutput {
+			return fmt.Errorf("the copy must not replace %s", file)
+		}
+	}
+
+	if err := csvparser.RewriteFile(file, output, settings, anonymizer.Value); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("failed to anonymize %s: %w", file, err)
+	}
+
+	fmt.Printf("Anonymized %d row(s) of %s to %s\n\n", len(data.Rows), file, output)
+	var unchanged []string
+	for _, header := range data.Headers {
+		if kind := columns[header]; kind != "" {
+			fmt.Printf("  %-24s %s\n", header, kind)
+		} else {
+			unchanged = append(unchanged, header)
+		}
+	}
+	if len(unchanged) > 0 {
+		fmt.Printf("\nUnchanged (review before sharing): %s\n", strings.Join(unchanged, ", "))
+	}
+	return nil
+}
+
+// anonymizationColumns returns the anonymization kind of each column: the
+// kind named by a flag, "account" for a sensitive field, or the kind the
+// header suggests, unless the column is kept.
+//
+// RETURNS:
+//   - The kinds, by column.
+//   - An error if a flag names a column the file does not have.
+func anonymizationColumns(headers []string, sensitive []config.SensitiveField) (map[string]string, error) {
+	known := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		known[header] = true
+	}
+
+	columns := make(map[string]string)
+	for _, header := range headers {
+		columns[header] = masking.GuessAnonymization(header)
+	}
+	for _, field := range sensitive {
+		if known[field.Field] {
+			columns[field.Field] = masking.AnonymizeAccount
+		}
+	}
+
+	for _, kind := range masking.AnonymizationKinds {
+		for _, column := range *anonymizeColumns[kind] {
+			if !known[column] {
+				return nil, fmt.Errorf("--%s: the file has no column %q", kind, column)
+			}
+			columns[column] = kind
+		}
+	}
+	for _, column := range anonymizeKeep {
+		if !known[column] {
+			return nil, fmt.Errorf("--keep: the file has no column %q", column)
+		}
+		delete(columns, column)
+	}
+
+	for column, kind := range columns {
+		if kind == "" {
+			delete(columns, column)
+		}
+	}
+	return columns, nil
+}
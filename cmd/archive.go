@@ -0,0 +1,121 @@
+// =============================================================================
+// CSV to XML Converter - Archive Command
+// =============================================================================
+//
+// This file defines the 'archive' command and its 'decrypt' subcommand,
+// which decrypts input files archived with archive encryption (see
+// internal/archivecrypt).
+//
+// COMMAND USAGE:
+//   converter archive decrypt <file.enc>... [--output-dir DIR]
+//
+// FLAGS:
+//   --output-dir : Directory to write the decrypted files to (default: .)
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/archivecrypt"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// decryptOutputDir is the directory the decrypted files are written to.
+var decryptOutputDir string
+
+// =============================================================================
+// ARCHIVE COMMAND DEFINITION
+// =============================================================================
+
+// archiveCmd represents the 'archive' command.
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Work with archived files",
+}
+
+// archiveDecryptCmd represents the 'archive decrypt' command.
+var archiveDecryptCmd = &cobra.Command{
+	Use:   "decrypt <file.enc>...",
+	Short: "Decrypt encrypted archived input files",
+	Long: `Decrypts input files that were archived with archive_encryption, writing
+each "<name>.enc" as "<name>" to the output directory.
+
+The key comes from the main configuration's archive_encryption settings: a
+file encrypted with key_env needs the key in that environment variable, and a
+file encrypted with KMS needs AWS credentials allowed to decrypt with the key.
+
+Example:
+  converter archive decrypt archive/input/claims_0412.csv.enc --output-dir /tmp`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runArchiveDecrypt(args)
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the archive command and sets up flags.
+func init() {
+	rootCmd.AddCommand(archiveCmd)
+	archiveCmd.AddCommand(archiveDecryptCmd)
+
+	archiveDecryptCmd.Flags().StringVar(
+		&decryptOutputDir,
+		"output-dir",
+		".",
+		"Directory to write the decrypted files to",
+	)
+}
+
+// =============================================================================
+// COMMAND EXECUTION
+// =============================================================================
+
+// runArchiveDecrypt decrypts the files.
+//
+// PARAMETERS:
+//   - files: The encrypted files.
+//
+// RETURNS:
+//   - An error if the configuration cannot be loaded or a file cannot be
+//     decrypted. Files are decrypted until the first failure.
+func runArchiveDecrypt(files []string) error {
+	mainConfig, err := config.LoadMainConfig(cfgFile)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to load main config: %w", err)}
+	}
+
+	if err := os.MkdirAll(decryptOutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	for _, file := range files {
+		name := filepath.Base(file)
+		if !strings.HasSuffix(name, archivecrypt.Suffix) {
+			return fmt.Errorf("%s: not an encrypted archive file (no %s suffix)", file, archivecrypt.Suffix)
+		}
+
+		output := filepath.Join(decryptOutputDir, strings.TrimSuffix(name, archivecrypt.Suffix))
+		if err := archivecrypt.DecryptFile(context.Background(), mainConfig.ArchiveEncryption, file, output); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		fmt.Printf("%s -> %s\n", file, output)
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+// =============================================================================
+// CSV to XML Converter - Bundle Command
+// =============================================================================
+//
+// This file defines the 'bundle' command, which packs the configuration and
+// templates into a single versioned, signed file for deployment (see
+// internal/bundle), and the global --bundle flag, which runs any command
+// from such a file instead of --config.
+//
+// COMMAND USAGE:
+//   converter bundle pack --version 2024.05.1 --output rules.bundle \
+//     --signing-key keys/release.asc --passphrase-env RELEASE_PASSPHRASE
+//   converter bundle verify rules.bundle --keyring keys/release_public.asc
+//   converter bundle unpack rules.bundle --dir /opt/converter/rules
+//   converter process --bundle rules.bundle --bundle-keyring keys/release_public.asc
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/bundle"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+var (
+	// bundleVersion is the version of the packed rule set.
+	bundleVersion string
+
+	// bundleOutput is the bundle file to write.
+	bundleOutput string
+
+	// bundleSigningKey is the private key that signs the bundle.
+	bundleSigningKey string
+
+	// bundlePassphraseEnv names the environment variable with the
+	// passphrase of the signing key.
+	bundlePassphraseEnv string
+
+	// bundleKeyring is the keyring that verifies a bundle's signature.
+	bundleKeyring string
+
+	// bundleDir is the directory a bundle is unpacked to.
+	bundleDir string
+)
+
+// runBundle and runBundleKeyring are the global --bundle and
+// --bundle-keyring flags; runBundleDir is the temporary directory the
+// bundle was extracted to.
+var (
+	runBundle        string
+	runBundleKeyring string
+	runBundleDir     string
+)
+
+// =============================================================================
+// BUNDLE COMMAND DEFINITION
+// =============================================================================
+
+// bundleCmd represents the 'bundle' command.
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Pack the configuration and templates into a deployable bundle",
+}
+
+// bundlePackCmd represents the 'bundle pack' command.
+var bundlePackCmd = &cobra.Command{
+	Use:   "pack",
+	Short: "Pack the configuration and templates into a bundle",
+	Long: `Packs the main configuration, the department configurations (configs_dir),
+and the templates (templates_dir) into one file, with a manifest of their
+checksums and the version of the rule set. With --signing-key, the manifest
+is signed, so the deployed rule set can be verified.
+
+The configuration is loaded first; a configuration that does not load is
+not packed. Files the configurations refer to by path (lookup files, holiday
+calendars, keys) are not bundled.
+
+Example:
+  converter bundle pack --version 2024.05.1 --output rules-2024.05.1.bundle \
+    --signing-key keys/release.asc --passphrase-env RELEASE_PASSPHRASE`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runBundlePack()
+	},
+}
+
+// bundleVerifyCmd represents the 'bundle verify' command.
+var bundleVerifyCmd = &cobra.Command{
+	Use:   "verify <file.bundle>",
+	Short: "Verify a bundle and list its contents",
+	Long: `Verifies every file of a bundle against its manifest and, with --keyring,
+the manifest's signature, then prints the version and the files.
+
+Example:
+  converter bundle verify rules.bundle --keyring keys/release_public.asc`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runBundleVerify(args[0])
+	},
+}
+
+// bundleUnpackCmd represents the 'bundle unpack' command.
+var bundleUnpackCmd = &cobra.Command{
+	Use:   "unpack <file.bundle>",
+	Short: "Verify a bundle and extract it to a directory",
+	Long: `Verifies a bundle like 'bundle verify' and extracts it: config.yaml, the
+department configurations to configs/, and the templates to templates/,
+with the manifest and its signature. Nothing is extracted from a bundle that
+does not verify.
+
+To run from the bundle without extracting it, pass --bundle to any command
+instead of --config.
+
+Example:
+  converter bundle unpack rules.bundle --dir /opt/converter/rules --keyring keys/release_public.asc`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runBundleUnpack(args[0])
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the bundle command and sets up flags.
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundlePackCmd, bundleVerifyCmd, bundleUnpackCmd)
+
+	bundlePackCmd.Flags().StringVar(&bundleVersion, "version", "", "Version of the rule set (required)")
+	bundlePackCmd.Flags().StringVar(&bundleOutput, "output", "", "Bundle file to write (default: rules-<version>.bundle)")
+	bundlePackCmd.Flags().StringVar(&bundleSigningKey, "signing-key", "", "Private PGP key to sign the bundle with")
+	bundlePackCmd.Flags().StringVar(&bundlePassphraseEnv, "passphrase-env", "", "Environment variable with the passphrase of the signing key")
+	bundlePackCmd.MarkFlagRequired("version")
+
+	for _, command := range []*cobra.Command{bundleVerifyCmd, bundleUnpackCmd} {
+		command.Flags().StringVar(&bundleKeyring, "keyring", "", "Public PGP keys of the trusted signers; the bundle must be signed by one")
+	}
+	bundleUnpackCmd.Flags().StringVar(&bundleDir, "dir", ".", "Directory to extract the bundle to")
+
+	rootCmd.PersistentFlags().StringVar(
+		&runBundle,
+		"bundle",
+		"",
+		"Run from a configuration bundle instead of --config",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&runBundleKeyring,
+		"bundle-keyring",
+		"",
+		"Public PGP keys that must have signed the --bundle",
+	)
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return useBundle(cmd)
+	}
+}
+
+// =============================================================================
+// COMMAND EXECUTION
+// =============================================================================
+
+// runBundlePack packs the configuration into a bundle.
+//
+// RETURNS:
+//   - An error if the configuration does not load or the bundle cannot be
+//     written. A partial bundle is removed.
+func runBundlePack() error {
+	mainConfig, err := config.LoadMainConfig(cfgFile)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to load main config: %w", err)}
+	}
+	if _, err := config.LoadDepartmentConfigs(mainConfig.ConfigsDir); err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to load department configs: %w", err)}
+	}
+
+	passphrase := ""
+	if bundlePassphraseEnv != "" {
+		passphrase = os.Getenv(bundlePassphraseEnv)
+	}
+	output := bundleOutput
+	if output == "" {
+		output = fmt.Sprintf("rules-%s.bundle", bundleVersion)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	manifest, err := bundle.Pack(file, bundle.PackOptions{
+		Version:          bundleVersion,
+		ConverterVersion: Version,
+		ConfigFile:       cfgFile,
+		ConfigsDir:       mainConfig.ConfigsDir,
+		TemplatesDir:     mainConfig.TemplatesDir,
+		SigningKey:       bundleSigningKey,
+		Passphrase:       passphrase,
+	})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		return fmt.Errorf("failed to pack bundle: %w", err)
+	}
+
+	signed := "unsigned"
+	if bundleSigningKey != "" {
+		signed = "signed"
+	}
+	fmt.Printf("%s: version %s, %d file(s), %s\n", output, manifest.Version, len(manifest.Files), signed)
+	return nil
+}
+
+// runBundleVerify verifies a bundle and prints its manifest.
+func runBundleVerify(path string) error {
+	opened, err := bundle.Open(path, bundleKeyring)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	printBundle(path, opened)
+	return nil
+}
+
+// runBundleUnpack verifies a bundle and extracts it.
+func runBundleUnpack(path string) error {
+	opened, err := bundle.Open(path, bundleKeyring)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := opened.Extract(bundleDir); err != nil {
+		return fmt.Errorf("failed to unpack %s: %w", path, err)
+	}
+	printBundle(path, opened)
+	fmt.Printf("Unpacked to %s\n", bundleDir)
+	return nil
+}
+
+// printBundle prints the version, signature, and files of a bundle.
+func printBundle(path string, opened *bundle.Bundle) {
+	manifest := opened.Manifest
+	fmt.Printf("Bundle:    %s\n", path)
+	fmt.Printf("Version:   %s\n", manifest.Version)
+	fmt.Printf("Created:   %s", manifest.Created.Format("2006-01-02 15:04:05 MST"))
+	if manifest.ConverterVersion != "" {
+		fmt.Printf(" (converter %s)", manifest.ConverterVersion)
+	}
+	fmt.Println()
+	switch {
+	case opened.Signer != "":
+		fmt.Printf("Signature: verified, signed by %s\n", opened.Signer)
+	case opened.Signed:
+		fmt.Println("Signature: present, not verified (no --keyring)")
+	default:
+		fmt.Println("Signature: none")
+	}
+	fmt.Printf("Files:     %d, checksums verified\n", len(manifest.Files))
+	for _, file := range manifest.Files {
+		fmt.Printf("  %-40s %8d  %s\n", file.Path, file.Size, file.SHA256[:12])
+	}
+}
+
+// =============================================================================
+// RUNNING FROM A BUNDLE
+// =============================================================================
+
+// useBundle runs a command from the --bundle: the bundle is verified and
+// extracted to a temporary directory, and its main configuration replaces
+// --config. The directory is removed by cleanupBundle when the command
+// ends.
+//
+// RETURNS:
+//   - An error if both --bundle and --config are set, or the bundle does
+//     not verify.
+func useBundle(cmd *cobra.Command) error {
+	if runBundle == "" {
+		if runBundleKeyring != "" {
+			return fmt.Errorf("--bundle-keyring requires --bundle")
+		}
+		return nil
+	}
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	if cmd.Flags().Changed("config") {
+		return fmt.Errorf("--bundle and --config cannot be used together")
+	}
+
+	opened, err := bundle.Open(runBundle, runBundleKeyring)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("bundle %s: %w", runBundle, err)}
+	}
+	if runBundleDir, err = os.MkdirTemp("", "converter-bundle-"); err != nil {
+		return fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+	configPath, err := opened.ExtractForRun(runBundleDir)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("bundle %s: %w", runBundle, err)}
+	}
+	cfgFile = configPath
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Using bundle %s, version %s (%s)\n", filepath.Base(runBundle),
+			opened.Manifest.Version, bundleTrust(opened))
+	}
+	return nil
+}
+
+// bundleTrust describes whether a bundle's signature was verified.
+func bundleTrust(opened *bundle.Bundle) string {
+	if opened.Signer != "" {
+		return "signed by " + opened.Signer
+	}
+	return "signature not verified"
+}
+
+// cleanupBundle removes the directory the --bundle was extracted to.
+func cleanupBundle() {
+	if runBundleDir != "" {
+		os.RemoveAll(runBundleDir)
+	}
+}
@@ -0,0 +1,263 @@
+// =============================================================================
+// CSV to XML Converter - Check Command
+// =============================================================================
+//
+// This file defines the 'check' command, which validates CSV files without
+// converting them. Business users can run it on a file before the nightly
+// run to find out whether it will pass, and fix it first if not.
+//
+// COMMAND USAGE:
+//   converter check <file|dir>... [flags]
+//
+// FLAGS:
+//   --department : Check the files against this department instead of the
+//                  one their file name matches
+//   --max-errors : Maximum number of errors printed per file (0 = all);
+//                  identical errors are printed once, with a count
+//   --report     : Directory to write the detailed error log to
+//
+// Each file is parsed, grouped, transformed, and validated exactly as the
+// process command would. No XML is written and nothing is locked, merged,
+// archived, audited, or delivered.
+//
+// EXIT CODES:
+//   As for the process command: 0 if every file passed, 2 if files failed
+//   validation, 3 on configuration errors, 4 if files could not be checked.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// checkDepartment is the department code to check files against.
+var checkDepartment string
+
+// checkMaxErrors is the maximum number of errors printed per file.
+var checkMaxErrors int
+
+// checkReportDir is the directory the error log is written to.
+var checkReportDir string
+
+// =============================================================================
+// CHECK COMMAND DEFINITION
+// =============================================================================
+
+// checkCmd represents the 'check' command.
+var checkCmd = &cobra.Command{
+	Use:   "check <file|dir>...",
+	Short: "Validate CSV files without converting them",
+	Long: `The check command parses, transforms, and validates CSV files exactly as the
+process command would, and prints every validation error with its row and
+field. It never writes XML and never moves, archives, or delivers anything,
+so it is safe to run on files before the nightly run.
+
+Directories are checked for *.csv files. Each file is matched to a department
+by its name, or checked against --department.
+
+Examples:
+  converter check input/claims_payments_20240131.csv
+  converter check ./drafts --department CLAIMS --report ./reports`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runCheck(args)
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the check command with the root command and sets up flags.
+func init() {
+	rootCmd.AddCommand(checkCmd)
+
+	checkCmd.Flags().StringVar(
+		&checkDepartment,
+		"department",
+		"",
+		"Check the files against this department code instead of matching by file name",
+	)
+
+	checkCmd.Flags().IntVar(
+		&checkMaxErrors,
+		"max-errors",
+		50,
+		"Maximum number of errors printed per file, identical errors counting once (0 prints all)",
+	)
+
+	checkCmd.Flags().StringVar(
+		&checkReportDir,
+		"report",
+		"",
+		"Directory to write the detailed error log to",
+	)
+}
+
+// =============================================================================
+// CHECK FUNCTION
+// =============================================================================
+
+// runCheck checks the files and directories given on the command line.
+//
+// PARAMETERS:
+//   - paths: The files and directories to check.
+//
+// RETURNS:
+//   - nil if every file passed, or an error carrying the exit code.
+func runCheck(paths []string) error {
+	mainConfig, err := config.LoadMainConfig(cfgFile)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to load main config: %w", err)}
+	}
+
+	deptConfigs, err := config.LoadDepartmentConfigs(mainConfig.ConfigsDir)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to load department configs: %w", err)}
+	}
+
+	var forced *config.DepartmentConfig
+	if checkDepartment != "" {
+		forced = deptConfigs[checkDepartment]
+		if forced == nil {
+			return &exitError{exitConfigError, fmt.Errorf("unknown department: %s", checkDepartment)}
+		}
+	}
+
+	files, err := checkFiles(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Println("No CSV files found.")
+		return nil
+	}
+
+	// Only errors are logged, unless --verbose: the findings are printed below.
+	level := "error"
+	if verbose {
+		level = "debug"
+	}
+	logger, err := logging.New(logging.Options{Level: level, Format: logFormat})
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to set up logging: %w", err)}
+	}
+	defer logger.Close()
+
+	var failedValidation, failedOther int
+	var errorEntries []utils.ErrorLogEntry
+
+	for _, file := range files {
+		deptConfig := forced
+		if deptConfig == nil {
+			var warning string
+			deptConfig, warning, err = converter.ResolveDepartment(file, deptConfigs, mainConfig)
+			if err != nil {
+				failedOther++
+				fmt.Printf("✗ %s: %v\n", file, err)
+				continue
+			}
+			if warning != "" {
+				fmt.Printf("! %s\n", warning)
+			}
+		}
+
+		conv := converter.New(file, deptConfig, mainConfig)
+		conv.SetLogger(logger)
+		result := conv.Check()
+
+		if result.Success {
+			fmt.Printf("✓ %s: %d rows, %d transactions, no errors\n",
+				file, result.Stats.RowsProcessed, result.Stats.TransactionsCreated)
+			continue
+		}
+
+		errorEntries = append(errorEntries, errorLogEntries(result)...)
+		if result.Validation == nil || len(result.Validation.Errors) == 0 {
+			failedOther++
+			fmt.Printf("✗ %s: %v\n", file, result.Error)
+			continue
+		}
+
+		failedValidation++
+		fmt.Printf("✗ %s: %d error(s) in %d rows\n", file, len(result.Validation.Errors), result.Stats.RowsProcessed)
+		groups := validation.GroupErrors(result.Validation.Errors, converter.ErrorSampleRows)
+		for i, group := range groups {
+			if checkMaxErrors > 0 && i == checkMaxErrors {
+				fmt.Printf("    ... and %d more\n", len(groups)-i)
+				break
+			}
+			fmt.Printf("    %s\n", describeErrorGroup(group))
+		}
+	}
+
+	if checkReportDir != "" && len(errorEntries) > 0 {
+		if err := os.MkdirAll(checkReportDir, 0755); err != nil {
+			return fmt.Errorf("failed to create report directory: %w", err)
+		}
+		reportPath, err := utils.WriteErrorLog(errorEntries, checkReportDir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\nDetailed error log: %s\n", reportPath)
+	}
+
+	fmt.Printf("\n%d file(s) checked: %d passed, %d failed validation, %d could not be checked\n",
+		len(files), len(files)-failedValidation-failedOther, failedValidation, failedOther)
+
+	switch {
+	case failedOther > 0:
+		return &exitError{exitPartialFailure, fmt.Errorf("%d file(s) could not be checked", failedOther)}
+	case failedValidation > 0:
+		return &exitError{exitValidationFailed, fmt.Errorf("%d file(s) failed validation", failedValidation)}
+	}
+	return nil
+}
+
+// checkFiles expands the command line paths into CSV files.
+func checkFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		found, err := converter.DiscoverInputFiles(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", path, err)
+		}
+		for _, file := range found {
+			if !converter.IsFixupFile(file) {
+				files = append(files, file)
+			}
+		}
+	}
+
+	for i, file := range files {
+		files[i] = filepath.Clean(file)
+	}
+	return files, nil
+}
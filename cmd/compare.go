@@ -0,0 +1,334 @@
+// =============================================================================
+// CSV to XML Converter - Compare Command
+// =============================================================================
+//
+// This file defines the 'compare' command, which converts the same input
+// files with the current configuration and with a candidate one (e.g., a
+// copy of the config directory with changed department configs and
+// templates), and reports how the XML differs for each file. A template or
+// rule change can be rolled out once its differences are the expected ones.
+//
+// COMMAND USAGE:
+//   converter compare --candidate <config.yaml> [--report DIR] [--ignore NAME]... <file|dir>...
+//
+// FLAGS:
+//   --candidate : The main config file of the candidate configuration
+//   --report    : Write a report of every difference per file to this directory
+//   --ignore    : An element or attribute name to leave out of the comparison
+//   --max-diffs : The number of differences to print per file (default: 10)
+//
+// The current configuration is the one given by --config, as for the other
+// commands. Both conversions are done like a preview (see converter.Preview):
+// nothing is locked, delivered, archived, or recorded, and no sequence
+// number is allocated.
+//
+// EXIT CODES:
+//   0 if the XML of every file is the same, 2 if any file differs (or
+//   converts under only one of the configurations), 3 on configuration
+//   errors, 4 if files could not be compared.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+var (
+	// compareCandidate is the main config file of the candidate configuration.
+	compareCandidate string
+
+	// compareReportDir is the directory for the per-file reports.
+	compareReportDir string
+
+	// compareIgnore are the element and attribute names left out.
+	compareIgnore []string
+
+	// compareMaxDiffs is the number of differences printed per file.
+	compareMaxDiffs int
+)
+
+// =============================================================================
+// COMPARE COMMAND DEFINITION
+// =============================================================================
+
+// compareCmd represents the 'compare' command.
+var compareCmd = &cobra.Command{
+	Use:   "compare --candidate <config.yaml> <file|dir>...",
+	Short: "Compare the XML of the current and a candidate configuration",
+	Long: `Converts each CSV file with the current configuration and with a candidate
+configuration, and compares the two XML documents by their content: values,
+attributes, and elements added, removed, or reordered. Whitespace, comments,
+and attribute order are ignored.
+
+The candidate is a main config file, usually a copy of the current one whose
+configs_dir points to the changed department configs (and so templates).
+Each file is matched to a department under each configuration. Nothing is
+delivered, archived, or recorded by either conversion.
+
+For each file that differs, the differences are summarized by path (e.g.
+"changed /cashbook/transaction/lineItem/PolicyNumber  x42") with an example,
+and with --report every difference is written to "<DIR>/<name>.diff.txt".
+Values that differ on every run, such as a creation timestamp in the header,
+can be left out with --ignore.
+
+Examples:
+  converter compare --candidate candidate/config.yaml input/
+  converter compare --candidate candidate/config.yaml --ignore CreatedAt --report diffs input/claims.csv`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runCompare(args)
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the compare command with the root command and sets up flags.
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().StringVar(
+		&compareCandidate,
+		"candidate",
+		"",
+		"Main config file of the candidate configuration",
+	)
+	compareCmd.MarkFlagRequired("candidate")
+
+	compareCmd.Flags().StringVar(
+		&compareReportDir,
+		"report",
+		"",
+		"Write every difference of each file to <DIR>/<name>.diff.txt",
+	)
+
+	compareCmd.Flags().StringArrayVar(
+		&compareIgnore,
+		"ignore",
+		nil,
+		"Element or attribute name to leave out of the comparison (repeatable)",
+	)
+
+	compareCmd.Flags().IntVar(
+		&compareMaxDiffs,
+		"max-diffs",
+		10,
+		"Number of difference patterns to print per file (0 for all)",
+	)
+}
+
+// =============================================================================
+// COMPARE FUNCTION
+// =============================================================================
+
+// compareSide is one of the two configurations compared.
+type compareSide struct {
+	// name is "current" or "candidate".
+	name string
+
+	mainConfig  *config.MainConfig
+	deptConfigs map[string]*config.DepartmentConfig
+}
+
+// runCompare compares the XML of each file.
+//
+// PARAMETERS:
+//   - paths: The files and directories given on the command line.
+//
+// RETURNS:
+//   - nil if every file is the same, or an error carrying the exit code.
+func runCompare(paths []string) error {
+	mainConfig, deptConfigs, err := loadListConfig()
+	if err != nil {
+		return err
+	}
+	candidateConfig, err := config.LoadMainConfig(compareCandidate)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to load candidate config: %w", err)}
+	}
+	candidateDepts, err := config.LoadDepartmentConfigs(candidateConfig.ConfigsDir)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to load candidate department configs: %w", err)}
+	}
+	current := compareSide{name: "current", mainConfig: mainConfig, deptConfigs: deptConfigs}
+	candidate := compareSide{name: "candidate", mainConfig: candidateConfig, deptConfigs: candidateDepts}
+
+	files, err := checkFiles(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Println("No CSV files found.")
+		return nil
+	}
+	if compareReportDir != "" {
+		if err := os.MkdirAll(compareReportDir, 0755); err != nil {
+			return fmt.Errorf("failed to create report directory: %w", err)
+		}
+	}
+
+	// Only errors are logged, unless --verbose: the results are printed below.
+	level := "error"
+	if verbose {
+		level = "debug"
+	}
+	logger, err := logging.New(logging.Options{Level: level, Format: logFormat})
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to set up logging: %w", err)}
+	}
+	defer logger.Close()
+
+	var same, different, failed int
+	for _, file := range files {
+		before, beforeErr := compareConvert(file, current, logger)
+		after, afterErr := compareConvert(file, candidate, logger)
+
+		switch {
+		case beforeErr != nil && afterErr != nil:
+			failed++
+			fmt.Printf("✗ %s: fails under both configurations\n", file)
+			fmt.Printf("    current:   %v\n", beforeErr)
+			fmt.Printf("    candidate: %v\n", afterErr)
+			continue
+		case beforeErr != nil || afterErr != nil:
+			different++
+			if afterErr != nil {
+				fmt.Printf("≠ %s: fails under the candidate configuration: %v\n", file, afterErr)
+			} else {
+				fmt.Printf("≠ %s: fails under the current configuration: %v\n", file, beforeErr)
+			}
+			continue
+		}
+
+		differences, err := xmlwriter.Compare(bytes.NewReader(before), bytes.NewReader(after), compareIgnore)
+		if err != nil {
+			failed++
+			fmt.Printf("✗ %s: %v\n", file, err)
+			continue
+		}
+		if len(differences) == 0 {
+			same++
+			fmt.Printf("= %s\n", file)
+			continue
+		}
+
+		different++
+		fmt.Printf("≠ %s: %d difference(s)\n", file, len(differences))
+		printDifferencePatterns(differences)
+		if compareReportDir != "" {
+			reportPath, err := writeCompareReport(file, differences)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("    Report: %s\n", reportPath)
+		}
+	}
+
+	fmt.Printf("\n%d file(s) compared: %d same, %d different, %d could not be compared\n",
+		same+different+failed, same, different, failed)
+
+	switch {
+	case failed > 0:
+		return &exitError{exitPartialFailure, fmt.Errorf("%d file(s) could not be compared", failed)}
+	case different > 0:
+		return &exitError{exitValidationFailed, fmt.Errorf("%d file(s) differ", different)}
+	}
+	return nil
+}
+
+// compareConvert converts a file under one configuration.
+//
+// PARAMETERS:
+//   - file: The CSV file.
+//   - side: The configuration to convert it with.
+//   - logger: The logger of the converter.
+//
+// RETURNS:
+//   - The XML document.
+//   - An error if no department matches the file or the conversion fails.
+func compareConvert(file string, side compareSide, logger converter.Logger) ([]byte, error) {
+	deptConfig, _, err := converter.ResolveDepartment(file, side.deptConfigs, side.mainConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	conv := converter.New(file, deptConfig, side.mainConfig)
+	conv.SetLogger(logger)
+	result := conv.Preview(&output)
+	if !result.Success {
+		return nil, fmt.Errorf("%s: %w", deptConfig.DepartmentCode, result.Error)
+	}
+	return output.Bytes(), nil
+}
+
+// printDifferencePatterns prints the differences of a file grouped by their
+// path without positions, most frequent first, with an example of each.
+func printDifferencePatterns(differences []xmlwriter.Difference) {
+	counts := make(map[string]int)
+	examples := make(map[string]xmlwriter.Difference)
+	var patterns []string
+	for _, difference := range differences {
+		pattern := difference.Pattern()
+		if counts[pattern] == 0 {
+			patterns = append(patterns, pattern)
+			examples[pattern] = difference
+		}
+		counts[pattern]++
+	}
+	sort.SliceStable(patterns, func(i, j int) bool { return counts[patterns[i]] > counts[patterns[j]] })
+
+	for i, pattern := range patterns {
+		if compareMaxDiffs > 0 && i == compareMaxDiffs {
+			fmt.Printf("    ...and %d more\n", len(patterns)-i)
+			break
+		}
+		fmt.Printf("    %s  x%d\n", pattern, counts[pattern])
+		fmt.Printf("        e.g. %s\n", examples[pattern])
+	}
+}
+
+// writeCompareReport writes every difference of a file to the report
+// directory.
+//
+// RETURNS:
+//   - The path of the report.
+//   - An error if it cannot be written.
+func writeCompareReport(file string, differences []xmlwriter.Difference) (string, error) {
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	reportPath := filepath.Join(compareReportDir, base+".diff.txt")
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "File: %s\n", file)
+	fmt.Fprintf(&report, "Current: %s\n", cfgFile)
+	fmt.Fprintf(&report, "Candidate: %s\n", compareCandidate)
+	fmt.Fprintf(&report, "Differences: %d\n\n", len(differences))
+	for _, difference := range differences {
+		fmt.Fprintln(&report, difference)
+	}
+
+	if err := os.WriteFile(reportPath, []byte(report.String()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+	return reportPath, nil
+}
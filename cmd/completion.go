@@ -0,0 +1,76 @@
+// =============================================================================
+// CSV to XML Converter - Completion Command
+// =============================================================================
+//
+// This file defines the 'completion' command, which prints a shell script
+// that completes the converter's commands, flags, and file arguments.
+//
+// COMMAND USAGE:
+//   converter completion bash|zsh|fish|powershell
+//
+// The installation steps for each shell are in the command's help text.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMPLETION COMMAND DEFINITION
+// =============================================================================
+
+// completionCmd represents the 'completion' command. It replaces the
+// completion command Cobra adds by default, to give installation steps
+// operators can follow.
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Print the shell completion script",
+	Long: `Prints a script that lets the shell complete converter commands and flags
+when you press Tab.
+
+Bash (needs the bash-completion package):
+  Current shell:  source <(converter completion bash)
+  Permanently:    converter completion bash > /etc/bash_completion.d/converter
+
+Zsh:
+  Permanently:    converter completion zsh > "${fpath[1]}/_converter"
+                  (then start a new shell)
+
+Fish:
+  Permanently:    converter completion fish > ~/.config/fish/completions/converter.fish
+
+PowerShell:
+  Current shell:  converter completion powershell | Out-String | Invoke-Expression
+  Permanently:    add the line above to your profile (notepad $PROFILE)`,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			return rootCmd.GenFishCompletion(os.Stdout, true)
+		case "powershell":
+			return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+		}
+		return fmt.Errorf("unsupported shell: %s", args[0])
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the completion command with the root command.
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
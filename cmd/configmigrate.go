@@ -0,0 +1,227 @@
+// =============================================================================
+// CSV to XML Converter - Config Migrate Command
+// =============================================================================
+//
+// This file defines the 'config migrate' command, which rewrites
+// configurations in the old nested format to the current keys (see
+// config.MigrateMainConfig and config.MigrateDepartmentConfig), so existing
+// deployments can upgrade. Every rewritten file is backed up first, and the
+// changes are shown as a diff.
+//
+// COMMAND USAGE:
+//   converter config migrate [--dry-run] [FILE...]
+//
+// Without files, the main configuration (--config) and the department
+// configurations in its configs_dir are migrated. Files given as arguments
+// are migrated as department configurations.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// migrateDryRun shows the changes without writing them.
+var migrateDryRun bool
+
+// =============================================================================
+// COMMAND DEFINITION
+// =============================================================================
+
+// configCmd represents the 'config' command.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Maintain the configuration files",
+}
+
+// configMigrateCmd represents the 'config migrate' command.
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate [FILE...]",
+	Short: "Rewrite old-format configurations to the current format",
+	Long: `Rewrites configurations written for earlier releases to the current keys:
+renamed keys (department.code becomes department_code, grouping becomes
+transaction_grouping, ...) and moved sections (directories, logging, and
+processing in the main configuration; named lookup tables). Comments and
+the order of the keys are kept.
+
+Without files, the main configuration (--config) and the department
+configurations in its configs_dir are migrated. Files given as arguments
+are migrated as department configurations.
+
+Each changed file is copied to <file>.<timestamp>.bak before it is
+rewritten, and the changes are shown as a diff. Settings that have no
+equivalent are removed and listed; check them before deploying. Files that
+are current are left alone, so the command can be run again safely. With
+--dry-run, nothing is written.
+
+Examples:
+  converter config migrate --dry-run
+  converter config migrate --config config/app_config.yaml
+  converter config migrate department_mappings/claims/department_config.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if runBundle != "" {
+			return fmt.Errorf("a bundle cannot be migrated; migrate its source files and pack them again")
+		}
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runConfigMigrate(args)
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the config command and sets up flags.
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configMigrateCmd)
+
+	configMigrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Show the changes without writing them")
+}
+
+// =============================================================================
+// COMMAND EXECUTION
+// =============================================================================
+
+// runConfigMigrate migrates the main configuration and the department
+// configurations, or the given department configuration files.
+//
+// RETURNS:
+//   - An error if a file cannot be read, parsed, backed up, or written.
+func runConfigMigrate(files []string) error {
+	// The templates of the old transaction types, for template_mapping.
+	var templates map[string]string
+	mainData, mainErr := os.ReadFile(cfgFile)
+	if mainErr == nil {
+		templates = config.TransactionTemplates(mainData)
+	}
+
+	changed := 0
+	if len(files) == 0 {
+		if mainErr != nil {
+			return &exitError{exitConfigError, fmt.Errorf("failed to read main config: %w", mainErr)}
+		}
+		migration, err := config.MigrateMainConfig(mainData)
+		if err != nil {
+			return &exitError{exitConfigError, fmt.Errorf("%s: %w", cfgFile, err)}
+		}
+		if err := applyMigration(cfgFile, mainData, migration); err != nil {
+			return err
+		}
+		if migration.Changed() {
+			changed++
+		}
+
+		// The department configurations are found with the migrated keys.
+		var mainConfig config.MainConfig
+		if err := yaml.Unmarshal(migration.Data, &mainConfig); err != nil {
+			return &exitError{exitConfigError, fmt.Errorf("%s: %w", cfgFile, err)}
+		}
+		configsDir := mainConfig.ConfigsDir
+		if configsDir == "" {
+			configsDir = config.DefaultMainConfig().ConfigsDir
+		}
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(configsDir, pattern))
+			if err != nil {
+				return fmt.Errorf("failed to list department configs: %w", err)
+			}
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+		if len(files) == 0 {
+			fmt.Printf("No department configurations in %s\n", configsDir)
+		}
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		migration, err := config.MigrateDepartmentConfig(data, templates)
+		if err != nil {
+			return &exitError{exitConfigError, fmt.Errorf("%s: %w", file, err)}
+		}
+		if err := applyMigration(file, data, migration); err != nil {
+			return err
+		}
+		if migration.Changed() {
+			changed++
+		}
+	}
+
+	switch {
+	case changed == 0:
+		fmt.Println("\nAll configurations are current.")
+	case migrateDryRun:
+		fmt.Printf("\n%d file(s) would be migrated; run without --dry-run to write them.\n", changed)
+	default:
+		fmt.Printf("\n%d file(s) migrated.\n", changed)
+	}
+	return nil
+}
+
+// applyMigration prints the changes and diff of one file and, unless
+// --dry-run is set, backs the file up and writes the migrated document.
+//
+// PARAMETERS:
+//   - file: The configuration file.
+//   - data: Its current content.
+//   - migration: The migrated document.
+//
+// RETURNS:
+//   - An error if the backup or the file cannot be written.
+func applyMigration(file string, data []byte, migration *config.Migration) error {
+	if !migration.Changed() {
+		fmt.Printf("%s: current\n", file)
+		return nil
+	}
+
+	fmt.Printf("%s: %d change(s)\n", file, len(migration.Changes))
+	for _, change := range migration.Changes {
+		fmt.Printf("  - %s\n", change)
+	}
+	if len(migration.Notes) > 0 {
+		fmt.Println("  Check:")
+		for _, note := range migration.Notes {
+			fmt.Printf("  ! %s\n", note)
+		}
+	}
+	fmt.Println()
+	fmt.Print(migration.Diff(file))
+	fmt.Println()
+
+	if migrateDryRun {
+		return nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	backup := fmt.Sprintf("%s.%s.bak", file, time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(backup, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", file, err)
+	}
+	if err := os.WriteFile(file, migration.Data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write %s (the original is in %s): %w", file, backup, err)
+	}
+	fmt.Printf("Backup: %s\n", backup)
+	return nil
+}
@@ -0,0 +1,246 @@
+// =============================================================================
+// CSV to XML Converter - Demo Command
+// =============================================================================
+//
+// This file defines the 'demo' command, which shows a full conversion
+// without any setup: it writes the configuration and template embedded in
+// the binary (see internal/demo) to a workspace, generates sample input for
+// the template, and converts it like 'process'. It is meant for training new
+// operators, who can then change the workspace and run 'process' again.
+//
+// COMMAND USAGE:
+//   converter demo [--dir DIR] [--rows N] [--invalid PERCENT] [--seed N]
+//
+// FLAGS:
+//   --dir     : The workspace; it must not contain a demo already
+//               (default: ./converter-demo)
+//   --rows    : The number of sample rows (default: 12)
+//   --invalid : The share of rows, in percent, made invalid (default: 0)
+//   --seed    : Generate the same rows again (default: random)
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/demo"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+var (
+	// demoDir is the workspace the demo is written to.
+	demoDir string
+
+	// demoRows is the number of sample rows.
+	demoRows int
+
+	// demoInvalid is the share of invalid sample rows, in percent.
+	demoInvalid float64
+
+	// demoSeed makes the sample repeatable.
+	demoSeed int64
+)
+
+// demoPreviewLines is the number of lines of the input and output shown.
+const demoPreviewLines = 30
+
+// =============================================================================
+// DEMO COMMAND DEFINITION
+// =============================================================================
+
+// demoCmd represents the 'demo' command.
+var demoCmd = &cobra.Command{
+	Use:   "demo",
+	Short: "Run a full conversion with the built-in demo configuration",
+	Long: `Writes a demo workspace with the configuration and example template built
+into the converter, generates a sample CSV file for the template, and
+converts it, showing the input and the XML.
+
+The workspace is left in place: change the department configuration
+(configs/demo.yaml) or the template, put the archived input back into
+input/, and run 'converter process' from the workspace to see the effect.
+With --invalid, some rows are made invalid to show the error log.
+
+Examples:
+  converter demo
+  converter demo --dir /tmp/training --rows 50 --invalid 10`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("config") || runBundle != "" {
+			return fmt.Errorf("demo writes its own configuration and cannot be combined with --config or --bundle")
+		}
+		if demoInvalid < 0 || demoInvalid > 100 {
+			return fmt.Errorf("--invalid must be between 0 and 100")
+		}
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runDemo()
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the demo command and sets up flags.
+func init() {
+	rootCmd.AddCommand(demoCmd)
+
+	demoCmd.Flags().StringVar(&demoDir, "dir", "converter-demo", "Workspace to write the demo to")
+	demoCmd.Flags().IntVar(&demoRows, "rows", 12, "Number of sample rows")
+	demoCmd.Flags().Float64Var(&demoInvalid, "invalid", 0, "Share of rows, in percent, made invalid")
+	demoCmd.Flags().Int64Var(&demoSeed, "seed", 0, "Generate the same rows again (default: random)")
+}
+
+// =============================================================================
+// COMMAND EXECUTION
+// =============================================================================
+
+// runDemo writes the workspace, generates the sample, and converts it.
+//
+// RETURNS:
+//   - An error if the workspace cannot be written, or an error carrying the
+//     exit code of the conversion (see finishProcess).
+func runDemo() error {
+	fmt.Printf("=== Step 1: Workspace ===\n\n")
+	if err := demo.Install(demoDir); err != nil {
+		return err
+	}
+	for _, file := range demo.Files() {
+		fmt.Printf("  %s\n", filepath.Join(demoDir, file))
+	}
+
+	// The configuration's directories are relative to the workspace.
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(demoDir); err != nil {
+		return fmt.Errorf("failed to enter %s: %w", demoDir, err)
+	}
+	defer os.Chdir(workingDir)
+	cfgFile = demo.ConfigFile
+
+	fmt.Printf("\n=== Step 2: Sample input ===\n\n")
+	input, err := writeDemoInput()
+	if err != nil {
+		return err
+	}
+	printHead(input)
+
+	fmt.Printf("\n=== Step 3: Conversion ===\n\n")
+	summary := utils.ProcessingSummary{StartTime: time.Now()}
+	err = finishProcess(&summary, runProcess(&summary))
+
+	for _, processed := range summary.ProcessedFiles {
+		fmt.Printf("\n=== Output: %s ===\n\n", filepath.Join(demoDir, processed.OutputFile))
+		printHead(processed.OutputFile)
+	}
+	fmt.Printf("\nThe workspace is in %s. Change configs/demo.yaml", demoDir)
+	if len(summary.FailedFilesList) > 0 {
+		// A file that fails stays in the input directory.
+		fmt.Printf(" and run\n'converter process' there to try it. The sample has invalid rows; see\n")
+		fmt.Printf("the error log in %s.\n", filepath.Join(demoDir, "output"))
+	} else {
+		fmt.Printf(", move the\nfile from input_archive/ back to input/, and run 'converter process'\n")
+		fmt.Printf("there to try it.\n")
+	}
+	return err
+}
+
+// writeDemoInput generates a sample file for the demo template in the input
+// directory, with the demo department's rules.
+//
+// RETURNS:
+//   - The path of the file.
+//   - An error if the configuration cannot be loaded or the file cannot be
+//     written.
+func writeDemoInput() (string, error) {
+	mainConfig, err := config.LoadMainConfig(cfgFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to load demo config: %w", err)
+	}
+	deptConfigs, err := config.LoadDepartmentConfigs(mainConfig.ConfigsDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to load demo department: %w", err)
+	}
+	schema, err := xlsxparser.Parse(filepath.Join(mainConfig.TemplatesDir, demo.Template))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse demo template: %w", err)
+	}
+
+	if err := os.MkdirAll(mainConfig.InputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create input directory: %w", err)
+	}
+	path := filepath.Join(mainConfig.InputDir, "demo_payments_"+time.Now().Format("20060102")+".csv")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	result, err := converter.GenerateSample(file, schema, converter.SampleOptions{
+		Rows:           demoRows,
+		InvalidPercent: demoInvalid,
+		Seed:           demoSeed,
+		Department:     deptConfigs[demo.Department],
+	})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	// The file is complete; date it back past the readiness stability
+	// period, so the conversion does not skip it as still being copied.
+	past := time.Now().Add(-mainConfig.FileReadiness.StabilityPeriod())
+	if err := os.Chtimes(path, past, past); err != nil {
+		return "", fmt.Errorf("failed to date %s: %w", path, err)
+	}
+
+	fmt.Printf("%d row(s) in %d transaction(s)", result.Rows, result.Transactions)
+	if len(result.InvalidRows) > 0 {
+		fmt.Printf(", %d made invalid:\n", len(result.InvalidRows))
+		for _, row := range result.InvalidRows {
+			fmt.Printf("  line %d: %s (%s)\n", row.Line, row.Field, row.Code)
+		}
+	} else {
+		fmt.Println()
+	}
+	fmt.Printf("\n%s:\n", filepath.Join(demoDir, path))
+	return path, nil
+}
+
+// printHead prints the first lines of a file, indented.
+func printHead(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("  (cannot show %s: %v)\n", path, err)
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lines := 0
+	for scanner.Scan() {
+		if lines == demoPreviewLines {
+			fmt.Println("  ...")
+			break
+		}
+		fmt.Printf("  %s\n", scanner.Text())
+		lines++
+	}
+}
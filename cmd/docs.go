@@ -0,0 +1,120 @@
+// =============================================================================
+// CSV to XML Converter - Docs Command
+// =============================================================================
+//
+// This file defines the 'docs' command, which generates reference pages for
+// every command from the same help text the CLI prints, so the installed
+// documentation always matches the binary.
+//
+// COMMAND USAGE:
+//   converter docs [flags]
+//
+// FLAGS:
+//   --format : "man" (one page per command, section 1) or "markdown"
+//   --dir    : Directory to write the pages to (default "./docs/cli")
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// docsFormat is the format of the generated pages.
+var docsFormat string
+
+// docsDir is the directory the pages are written to.
+var docsDir string
+
+// =============================================================================
+// DOCS COMMAND DEFINITION
+// =============================================================================
+
+// docsCmd represents the 'docs' command.
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate man pages or Markdown reference pages",
+	Long: `Generates one reference page per command, from the command help.
+
+Examples:
+  converter docs --format man --dir /usr/local/share/man/man1
+  converter docs --format markdown --dir ./docs/cli`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runDocs()
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the docs command with the root command and sets up flags.
+func init() {
+	rootCmd.AddCommand(docsCmd)
+
+	docsCmd.Flags().StringVar(
+		&docsFormat,
+		"format",
+		"man",
+		"Page format: man or markdown",
+	)
+
+	docsCmd.Flags().StringVar(
+		&docsDir,
+		"dir",
+		"./docs/cli",
+		"Directory to write the pages to",
+	)
+}
+
+// =============================================================================
+// DOCS FUNCTION
+// =============================================================================
+
+// runDocs writes the reference pages for all commands.
+//
+// RETURNS:
+//   - An error if the format is unknown or the pages cannot be written.
+func runDocs() error {
+	if docsFormat != "man" && docsFormat != "markdown" {
+		return fmt.Errorf("invalid --format %q: must be man or markdown", docsFormat)
+	}
+
+	if err := os.MkdirAll(docsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create docs directory: %w", err)
+	}
+
+	// Leave out the "Auto generated by spf13/cobra on <date>" footer, so
+	// regenerating unchanged help does not change the pages.
+	rootCmd.DisableAutoGenTag = true
+
+	var err error
+	switch docsFormat {
+	case "man":
+		err = doc.GenManTree(rootCmd, &doc.GenManHeader{
+			Title:   "CONVERTER",
+			Section: "1",
+			Source:  "CSV to XML Converter " + Version,
+			Manual:  "CSV to XML Converter Manual",
+		}, docsDir)
+	case "markdown":
+		err = doc.GenMarkdownTree(rootCmd, docsDir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to generate docs: %w", err)
+	}
+
+	fmt.Printf("Wrote %s pages to %s\n", docsFormat, docsDir)
+	return nil
+}
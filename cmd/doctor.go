@@ -0,0 +1,447 @@
+// =============================================================================
+// CSV to XML Converter - Doctor Command
+// =============================================================================
+//
+// This file defines the 'doctor' command, which checks that the converter
+// can run in its environment and prints pass/fail per check:
+//
+//   - the main and department configurations load and validate
+//   - the archive encryption key is available
+//   - every template a department uses can be read, and every output
+//     format profile loads
+//   - every directory is writable (or can be created) and has free space;
+//     object-store locations can be listed
+//   - the delivery endpoints, OAuth2 token endpoints, and event brokers
+//     accept connections, and the SQL sink databases accept a login
+//
+// COMMAND USAGE:
+//   converter doctor [--min-free-mb N] [--timeout DURATION]
+//
+// FLAGS:
+//   --min-free-mb : Minimum free disk space per directory in MB (default 500)
+//   --timeout     : Timeout of each connectivity check (default 10s)
+//
+// EXIT CODES:
+//   0 if every check passed, 3 if the main configuration cannot be loaded,
+//   1 if any other check failed.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/archivecrypt"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/outputformat"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/sqlsink"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/storage"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// doctorMinFreeMB is the minimum free disk space per directory, in MB.
+var doctorMinFreeMB uint64
+
+// doctorTimeout is the timeout of each connectivity check.
+var doctorTimeout time.Duration
+
+// =============================================================================
+// DOCTOR COMMAND DEFINITION
+// =============================================================================
+
+// doctorCmd represents the 'doctor' command.
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configuration, directories, templates, and connections",
+	Long: `Checks that the converter can run here: the configuration is valid, the
+archive encryption key is set, the templates can be read, the directories are
+writable and have free disk space, object-store locations can be listed, and
+the delivery endpoints, event brokers, and SQL sink databases accept
+connections.
+
+Each check is printed with ✓ or ✗. The command exits with code 1 if any
+check failed, so it can run after a deployment or from monitoring.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runDoctor()
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the doctor command and sets up flags.
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().Uint64Var(
+		&doctorMinFreeMB,
+		"min-free-mb",
+		500,
+		"Minimum free disk space per directory, in MB",
+	)
+
+	doctorCmd.Flags().DurationVar(
+		&doctorTimeout,
+		"timeout",
+		10*time.Second,
+		"Timeout of each connectivity check",
+	)
+}
+
+// =============================================================================
+// DOCTOR FUNCTION
+// =============================================================================
+
+// doctorReport prints check results and counts the failures.
+type doctorReport struct {
+	failed int
+}
+
+// pass prints a passed check.
+func (r *doctorReport) pass(name, detail string) {
+	fmt.Printf("✓ %s: %s\n", name, detail)
+}
+
+// fail prints a failed check.
+func (r *doctorReport) fail(name string, err error) {
+	r.failed++
+	fmt.Printf("✗ %s: %v\n", name, err)
+}
+
+// check prints the result of a check.
+func (r *doctorReport) check(name, detail string, err error) {
+	if err != nil {
+		r.fail(name, err)
+		return
+	}
+	r.pass(name, detail)
+}
+
+// runDoctor runs every check.
+//
+// RETURNS:
+//   - nil if every check passed, or an error carrying the exit code.
+func runDoctor() error {
+	report := &doctorReport{}
+
+	mainConfig, err := config.LoadMainConfig(cfgFile)
+	if err != nil {
+		report.fail("Main configuration", err)
+		return &exitError{exitConfigError, fmt.Errorf("failed to load main config: %w", err)}
+	}
+	report.pass("Main configuration", "valid")
+
+	if mainConfig.ArchiveEncryption.KeyEnv != "" {
+		report.check("Archive encryption", "key set in "+mainConfig.ArchiveEncryption.KeyEnv,
+			archivecrypt.CheckKey(mainConfig.ArchiveEncryption))
+	}
+
+	deptConfigs, err := config.LoadDepartmentConfigs(mainConfig.ConfigsDir)
+	if err != nil {
+		report.fail("Department configurations", err)
+	} else {
+		report.pass("Department configurations", fmt.Sprintf("%d valid", len(deptConfigs)))
+		doctorTemplates(report, mainConfig, deptConfigs)
+	}
+
+	doctorDirectories(report, mainConfig, deptConfigs)
+	doctorConnections(report, mainConfig, deptConfigs)
+
+	if report.failed > 0 {
+		fmt.Printf("\n%d check(s) failed\n", report.failed)
+		return &exitError{exitFailure, fmt.Errorf("%d check(s) failed", report.failed)}
+	}
+	fmt.Println("\nAll checks passed")
+	return nil
+}
+
+// doctorTemplates checks that every template a department uses can be read,
+// and has the fields its template rules select, and that the output format
+// profiles load.
+func doctorTemplates(report *doctorReport, mainConfig *config.MainConfig, deptConfigs map[string]*config.DepartmentConfig) {
+	checked := make(map[string]bool)
+	for _, code := range converter.DepartmentCodes(deptConfigs) {
+		for _, template := range deptConfigs[code].Templates() {
+			if checked[template] {
+				continue
+			}
+			checked[template] = true
+
+			schema, err := xlsxparser.Parse(filepath.Join(mainConfig.TemplatesDir, template))
+			if err != nil {
+				report.fail("Template "+template, err)
+				continue
+			}
+			report.pass("Template "+template, fmt.Sprintf("sheet %s, %d fields", schema.SheetName, len(schema.FieldMappings)))
+		}
+
+		// The mapping profile of an output format must load.
+		if format := deptConfigs[code].OutputFormat; !format.IsXML() {
+			_, err := outputformat.New(format)
+			report.check("Output profile "+code, outputFormatDetail(format), err)
+		}
+		for _, target := range deptConfigs[code].Outputs {
+			if !target.OutputFormat.IsXML() {
+				_, err := outputformat.New(target.OutputFormat)
+				report.check("Output profile "+code+"/"+target.Name, outputFormatDetail(target.OutputFormat), err)
+			}
+		}
+
+		// The fields of a template rule must be in its template.
+		for _, rule := range deptConfigs[code].TemplateMapping {
+			if len(rule.Fields) == 0 && len(rule.ExcludeFields) == 0 {
+				continue
+			}
+			name := fmt.Sprintf("Template rule %s %q", code, rule.IfFilenameContains)
+			schema, err := xlsxparser.Parse(filepath.Join(mainConfig.TemplatesDir, rule.UseTemplate))
+			if err != nil {
+				continue // Reported above.
+			}
+			if subset, err := schema.Subset(rule.Fields, rule.ExcludeFields); err != nil {
+				report.fail(name, err)
+			} else {
+				report.pass(name, fmt.Sprintf("%d of %d fields", len(subset.FieldMappings), len(schema.FieldMappings)))
+			}
+		}
+	}
+}
+
+// =============================================================================
+// DIRECTORY CHECKS
+// =============================================================================
+
+// doctorDirectories checks every directory the converter writes to.
+func doctorDirectories(report *doctorReport, mainConfig *config.MainConfig, deptConfigs map[string]*config.DepartmentConfig) {
+	type directory struct {
+		name string
+		path string
+	}
+
+	dirs := []directory{
+		{"input_dir", mainConfig.InputDir},
+		{"output_dir", mainConfig.OutputDir},
+		{"input_archive_dir", mainConfig.InputArchiveDir},
+		{"output_archive_dir", mainConfig.OutputArchiveDir},
+		{"state_dir", mainConfig.StateDir},
+		{"log_file", filepath.Dir(mainConfig.LogFile)},
+		{"audit_log", filepath.Dir(mainConfig.AuditLog)},
+	}
+	if mainConfig.DeliverySchedule.Enabled() {
+		dirs = append(dirs, directory{"delivery_schedule.hold_dir", mainConfig.DeliverySchedule.HoldDir})
+	}
+	if mainConfig.DataLake.Enabled() {
+		dirs = append(dirs, directory{"data_lake.dir", mainConfig.DataLake.Dir})
+	}
+	for _, code := range converter.DepartmentCodes(deptConfigs) {
+		deptConfig := deptConfigs[code]
+		dirs = append(dirs,
+			directory{code + " output_dir", deptConfig.OutputDir},
+			directory{code + " input_archive_dir", deptConfig.InputArchiveDir},
+			directory{code + " output_archive_dir", deptConfig.OutputArchiveDir},
+		)
+		for _, target := range deptConfig.Outputs {
+			dirs = append(dirs, directory{code + "/" + target.Name + " output_dir", target.OutputDir})
+		}
+	}
+
+	// Remote locations are staged in the staging directory.
+	for _, dir := range dirs {
+		if storage.IsRemote(dir.path) {
+			dirs = append(dirs, directory{"staging_dir", mainConfig.StagingDir})
+			break
+		}
+	}
+
+	checked := make(map[string]bool)
+	for _, dir := range dirs {
+		if dir.path == "" || checked[dir.path] {
+			continue
+		}
+		checked[dir.path] = true
+
+		name := fmt.Sprintf("Directory %s (%s)", dir.name, dir.path)
+		if storage.IsRemote(dir.path) {
+			detail, err := checkRemoteDirectory(dir.path)
+			report.check(name, detail, err)
+			continue
+		}
+		detail, err := checkLocalDirectory(dir.path)
+		report.check(name, detail, err)
+	}
+}
+
+// checkLocalDirectory checks that a directory is writable, or can be
+// created, and has enough free disk space.
+func checkLocalDirectory(dir string) (string, error) {
+	// A missing directory is created when it is first used, so its nearest
+	// existing parent must be writable.
+	existing, err := utils.ExistingDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	probe, err := os.CreateTemp(existing, ".csv2xml-doctor-*")
+	if err != nil {
+		return "", fmt.Errorf("not writable: %w", err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	detail := "writable"
+	if existing != dir {
+		detail = "missing, can be created"
+	}
+
+	free, err := utils.FreeSpace(existing)
+	if err != nil {
+		return "", fmt.Errorf("failed to get free disk space: %w", err)
+	}
+	if free < doctorMinFreeMB<<20 {
+		return "", fmt.Errorf("only %s free (minimum %d MB)", utils.FormatSize(free), doctorMinFreeMB)
+	}
+	return fmt.Sprintf("%s, %s free", detail, utils.FormatSize(free)), nil
+}
+
+// checkRemoteDirectory checks that an object-store location can be listed.
+func checkRemoteDirectory(location string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	store, err := storage.Open(ctx, location)
+	if err != nil {
+		return "", err
+	}
+	objects, err := store.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("reachable, %d object(s)", len(objects)), nil
+}
+
+// =============================================================================
+// CONNECTIVITY CHECKS
+// =============================================================================
+
+// doctorConnections checks that the delivery endpoints, OAuth2 token
+// endpoints, and event brokers accept connections. Only a TCP connection is
+// made; credentials are not checked. The SQL sink databases are pinged,
+// which logs in.
+func doctorConnections(report *doctorReport, mainConfig *config.MainConfig, deptConfigs map[string]*config.DepartmentConfig) {
+	checked := make(map[string]bool)
+	dial := func(name, address string) {
+		if checked[address] {
+			return
+		}
+		checked[address] = true
+		report.check(name+" ("+address+")", "reachable", dialAddress(address))
+	}
+
+	for _, code := range converter.DepartmentCodes(deptConfigs) {
+		deliveries := map[string]config.DeliverySettings{code: deptConfigs[code].Delivery}
+		names := []string{code}
+		for _, target := range deptConfigs[code].Outputs {
+			name := code + "/" + target.Name
+			deliveries[name] = target.Delivery
+			names = append(names, name)
+		}
+
+		for _, name := range names {
+			delivery := deliveries[name]
+			if delivery.Type == "" {
+				continue
+			}
+			if address, err := urlAddress(delivery.URL); err != nil {
+				report.fail(name+" delivery endpoint", err)
+			} else {
+				dial(name+" delivery endpoint", address)
+			}
+			if delivery.OAuth2.TokenURL != "" {
+				if address, err := urlAddress(delivery.OAuth2.TokenURL); err != nil {
+					report.fail(name+" OAuth2 token endpoint", err)
+				} else {
+					dial(name+" OAuth2 token endpoint", address)
+				}
+			}
+		}
+
+		if sink := deptConfigs[code].SQLSink; sink.Enabled() {
+			ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+			report.check(code+" SQL sink", sink.Driver+" database reachable", sqlsink.Ping(ctx, sink))
+			cancel()
+		}
+	}
+
+	events := mainConfig.Events
+	switch events.Type {
+	case "kafka":
+		for _, broker := range events.Brokers {
+			dial("Kafka broker", broker)
+		}
+	case "rabbitmq":
+		amqpURL := events.URL
+		if amqpURL == "" {
+			amqpURL = os.Getenv(events.URLEnv)
+		}
+		if amqpURL == "" {
+			report.fail("RabbitMQ server", fmt.Errorf("environment variable %s is not set", events.URLEnv))
+		} else if address, err := urlAddress(amqpURL); err != nil {
+			report.fail("RabbitMQ server", err)
+		} else {
+			dial("RabbitMQ server", address)
+		}
+	}
+}
+
+// dialAddress opens and closes a TCP connection to an address.
+func dialAddress(address string) error {
+	conn, err := net.DialTimeout("tcp", address, doctorTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// urlAddress returns the host and port of a URL, with the scheme's default
+// port if it has none. Errors do not quote the URL, which may hold a
+// password.
+func urlAddress(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid URL")
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+
+	ports := map[string]string{"http": "80", "https": "443", "amqp": "5672", "amqps": "5671"}
+	port, ok := ports[u.Scheme]
+	if !ok {
+		return "", fmt.Errorf("URL has no port and no known scheme")
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// outputFormatDetail describes an output format and its profile, if any.
+func outputFormatDetail(format config.OutputFormatSettings) string {
+	if format.Profile == "" {
+		return format.Type
+	}
+	return format.Type + ", " + format.Profile
+}
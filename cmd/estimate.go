@@ -0,0 +1,88 @@
+// =============================================================================
+// CSV to XML Converter - Completion Estimates
+// =============================================================================
+//
+// With --estimate, the process command prints when each file waiting in the
+// input directory is estimated to start and finish, from the throughput of
+// its department in the audit trail (see converter.Processor.Estimate), and
+// exits without converting anything. Operators can check before a batch
+// window whether the files will be done in time.
+//
+// Like a pre-check, an estimate does not take the run lock and does not
+// wait for files that are still being copied.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/audit"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+)
+
+// printEstimate prints the estimated start and finish of each file of the
+// run.
+//
+// PARAMETERS:
+//   - processor: The processor of the run.
+//   - options: The run options; Files, if set, are estimated instead of
+//     the files of the input directory.
+//   - mainConfig: The main application configuration.
+//
+// RETURNS:
+//   - An error if the input directory or the audit trail cannot be read.
+func printEstimate(processor *converter.Processor, options converter.ProcessOptions, mainConfig *config.MainConfig) error {
+	files := options.Files
+	if files == nil {
+		discovered, err := processor.Discover()
+		if err != nil {
+			return fmt.Errorf("failed to discover input files: %w", err)
+		}
+		files = discovered
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(console, "No CSV files found in the input directory.")
+		return nil
+	}
+
+	throughput, err := audit.ReadThroughput(mainConfig.AuditLog)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	estimates := processor.Estimate(files, throughput, now)
+	fmt.Fprintf(console, "\n%-32s %-12s %10s %10s %8s %9s %9s\n", "FILE", "DEPARTMENT", "SIZE", "ROWS", "ROWS/S", "START", "FINISH")
+	finish := now
+	unknown := 0
+	for _, estimate := range estimates {
+		department := estimate.Department
+		if department == "" {
+			department = "(none)"
+		}
+		if !estimate.Known {
+			unknown++
+			fmt.Fprintf(console, "%-32s %-12s %10d %10s %8s %9s %9s\n", filepath.Base(estimate.File), department,
+				estimate.Size, "?", "?", estimate.Start.Format("15:04:05"), "?")
+			continue
+		}
+		if estimate.Finish.After(finish) {
+			finish = estimate.Finish
+		}
+		fmt.Fprintf(console, "%-32s %-12s %10d %10d %8.0f %9s %9s\n", filepath.Base(estimate.File), department,
+			estimate.Size, estimate.Rows, estimate.RowsPerSecond, estimate.Start.Format("15:04:05"), estimate.Finish.Format("15:04:05"))
+	}
+
+	fmt.Fprintf(console, "\nEstimated completion: %d file(s) in ~%s, by %s\n",
+		len(estimates), finish.Sub(now).Round(time.Second), finish.Format("15:04:05"))
+	if unknown > 0 {
+		fmt.Fprintf(console, "%d file(s) have no history in %s and are not included; the run takes longer.\n",
+			unknown, mainConfig.AuditLog)
+	}
+	return nil
+}
@@ -0,0 +1,411 @@
+// =============================================================================
+// CSV to XML Converter - Explain Command
+// =============================================================================
+//
+// This file defines the 'explain' command, which shows how a file would be
+// processed: which department and template it matches and why, how its rows
+// are grouped, and which transformations apply to each field. It is the
+// first stop when a file is not converted the way someone expected.
+//
+// COMMAND USAGE:
+//   converter explain --file <path>
+//
+// FLAGS:
+//   --file : The CSV file to explain (required)
+//
+// Nothing is written, moved, or archived. If the template can be resolved,
+// the file is also checked as the check command would, and the numbers of
+// rows, transactions, and errors are shown.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// explainFile is the CSV file to explain.
+var explainFile string
+
+// =============================================================================
+// EXPLAIN COMMAND DEFINITION
+// =============================================================================
+
+// explainCmd represents the 'explain' command.
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Show how a file would be processed",
+	Long: `The explain command shows how the process command would handle a file:
+
+  - which department configuration matched, and by which pattern
+  - which template mapping rule fired, and the template path and sheet
+  - how rows are grouped into transactions (and batches)
+  - every template field in output order, with its transformations in the
+    order they are applied
+
+Nothing is written, moved, or archived.
+
+Example:
+  converter explain --file input/claims_payments_20240131.csv`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runExplain(explainFile)
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the explain command with the root command and sets up flags.
+func init() {
+	rootCmd.AddCommand(explainCmd)
+
+	explainCmd.Flags().StringVar(
+		&explainFile,
+		"file",
+		"",
+		"The CSV file to explain",
+	)
+	explainCmd.MarkFlagRequired("file")
+}
+
+// =============================================================================
+// EXPLAIN FUNCTION
+// =============================================================================
+
+// runExplain prints how the given file would be processed.
+//
+// PARAMETERS:
+//   - file: The path to the CSV file.
+//
+// RETURNS:
+//   - An error if the configuration cannot be loaded, or the file matches no
+//     department or template.
+func runExplain(file string) error {
+	mainConfig, err := config.LoadMainConfig(cfgFile)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to load main config: %w", err)}
+	}
+
+	deptConfigs, err := config.LoadDepartmentConfigs(mainConfig.ConfigsDir)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to load department configs: %w", err)}
+	}
+
+	fmt.Printf("File: %s\n", file)
+	if _, err := os.Stat(file); err != nil {
+		fmt.Println("      (file not found: only the name is explained)")
+	}
+
+	// Department.
+	fmt.Println("\nDepartment")
+	matches := converter.MatchDepartments(file, mainConfig.InputDir, deptConfigs)
+	if len(matches) == 0 {
+		fmt.Printf("  No department matched %q. Patterns checked:\n", filepath.Base(file))
+		for _, code := range converter.DepartmentCodes(deptConfigs) {
+			fmt.Printf("    %-12s %s\n", code, strings.Join(deptConfigs[code].FileMatchingPatterns, ", "))
+		}
+		if subdir := converter.InputSubdirectory(file, mainConfig.InputDir); subdir != "" {
+			fmt.Printf("  No department lists input subdirectory %q in input_subdirectories.\n", subdir)
+		}
+		return fmt.Errorf("no matching department configuration found for %s", file)
+	}
+
+	deptConfig := matches[0].Config
+	fmt.Printf("  %s (%s)\n", deptConfig.DepartmentCode, deptConfig.DepartmentName)
+	fmt.Printf("  Matched %s\n", describeMatch(matches[0]))
+	tied := len(converter.AmbiguousMatches(matches))
+	for i, other := range matches[1:] {
+		if i+1 < tied {
+			fmt.Printf("  Warning: also matches %s by %s with the same priority (%d); the first department code in sort order is used\n",
+				other.Config.DepartmentCode, describeMatch(other), other.Config.MatchPriority)
+		} else {
+			fmt.Printf("  Also matches %s by %s, with a lower priority (%d)\n",
+				other.Config.DepartmentCode, describeMatch(other), other.Config.MatchPriority)
+		}
+	}
+	if tied > 1 && mainConfig.StrictDepartmentMatching {
+		return fmt.Errorf("%s matches several departments with the same priority and strict_department_matching is enabled", file)
+	}
+	if priority, rule := deptConfig.ProcessingPriority.For(filepath.Base(file), time.Now()); priority != 0 || rule != "" {
+		if rule == "" {
+			rule = "processing_priority default"
+		}
+		fmt.Printf("  Processing priority %d now, by %s\n", priority, rule)
+	}
+
+	// Template.
+	fmt.Println("\nTemplate")
+	conv := converter.New(file, deptConfig, mainConfig)
+	rule, ok := conv.MatchTemplateRule()
+	if !ok {
+		fmt.Println("  No template_mapping rule matched. Rules checked:")
+		for _, r := range deptConfig.TemplateMapping {
+			fmt.Printf("    if_filename_contains %q -> %s\n", r.IfFilenameContains, r.UseTemplate)
+		}
+		return fmt.Errorf("no matching template found for %s", file)
+	}
+
+	templatePath := filepath.Join(mainConfig.TemplatesDir, rule.UseTemplate)
+	fmt.Printf("  Rule:  if_filename_contains %q -> %s\n", rule.IfFilenameContains, rule.UseTemplate)
+	fmt.Printf("  Path:  %s\n", templatePath)
+
+	schema, err := xlsxparser.Parse(templatePath)
+	if err != nil {
+		fmt.Printf("  Error: %v\n", err)
+	} else {
+		fmt.Printf("  Sheet: %s (%d fields)\n", schema.SheetName, len(schema.FieldMappings))
+		version := schema.Version
+		if version == "" {
+			version = rule.Version
+		}
+		if version != "" {
+			fmt.Printf("  Version: %s\n", version)
+		}
+		if schema, err = schema.Subset(rule.Fields, rule.ExcludeFields); err != nil {
+			fmt.Printf("  Error: %v\n", err)
+		} else if len(schema.InactiveFields) > 0 {
+			fmt.Printf("  Off:   %s (turned off by the rule)\n", strings.Join(schema.InactiveFields, ", "))
+		}
+	}
+	if selector := deptConfig.TemplateSelector; selector.Enabled() {
+		fmt.Printf("  Rows select their template by %s (%s output):\n", selector.Field, selector.Output)
+		for _, value := range selector.Values() {
+			fmt.Printf("    %q -> %s\n", value, selector.Map[value])
+		}
+	}
+
+	// Grouping.
+	fmt.Println("\nGrouping")
+	explainGrouping(deptConfig)
+
+	if schema == nil {
+		return fmt.Errorf("failed to parse template %s", templatePath)
+	}
+
+	// Fields and transformations.
+	fmt.Println("\nFields (in output order)")
+	explainFields(schema, deptConfig)
+
+	// Data.
+	if _, err := os.Stat(file); err != nil {
+		return nil
+	}
+	logger, err := logging.New(logging.Options{Level: "error", Format: logFormat})
+	if err != nil {
+		return err
+	}
+	defer logger.Close()
+	conv.SetLogger(logger)
+
+	result := conv.Check()
+	fmt.Println("\nData")
+	fmt.Printf("  %d rows -> %d transactions\n", result.Stats.RowsProcessed, result.Stats.TransactionsCreated)
+	switch {
+	case result.Success:
+		fmt.Println("  No validation errors")
+	case result.Validation != nil && len(result.Validation.Errors) > 0:
+		fmt.Printf("  %d validation error(s); run 'converter check %s' to list them\n",
+			len(result.Validation.Errors), file)
+	default:
+		fmt.Printf("  Error: %v\n", result.Error)
+	}
+
+	return nil
+}
+
+// describeMatch describes why a department matched a file.
+func describeMatch(match converter.DepartmentMatch) string {
+	if match.Subdirectory != "" {
+		return fmt.Sprintf("input_subdirectories entry %q", match.Subdirectory)
+	}
+	return fmt.Sprintf("file_matching_patterns entry %q", match.Pattern)
+}
+
+// explainGrouping prints how rows are sorted and grouped.
+func explainGrouping(deptConfig *config.DepartmentConfig) {
+	grouping := deptConfig.TransactionGrouping
+
+	for i, key := range grouping.PreSort {
+		fmt.Printf("  Pre-sort %d:   %s\n", i+1, describeSortKey(key))
+	}
+
+	if grouping.GroupByField == "" {
+		fmt.Println("  Transactions: one per row (no group_by_field)")
+	} else {
+		fmt.Printf("  Transactions: grouped by %s\n", grouping.GroupByField)
+	}
+	if grouping.SortByField != "" {
+		order := grouping.SortOrder
+		if order == "" {
+			order = "asc"
+		}
+		fmt.Printf("  Line items:   sorted by %s %s\n", grouping.SortByField, order)
+	}
+	if grouping.MaxLineItems > 0 {
+		fmt.Printf("  Line items:   at most %d per transaction (the rest continue in a new transaction)\n",
+			grouping.MaxLineItems)
+	}
+
+	if deptConfig.BatchGrouping.GroupByField != "" {
+		fmt.Printf("  Batches:      <%s> grouped by %s\n",
+			deptConfig.BatchGrouping.Element, deptConfig.BatchGrouping.GroupByField)
+	}
+}
+
+// describeSortKey formats a pre-sort key, e.g. "CHECK_DATE (date 01/02/2006, desc)".
+func describeSortKey(key config.SortKey) string {
+	details := []string{}
+	if key.Type != "" {
+		details = append(details, strings.TrimSpace(key.Type+" "+key.Format))
+	}
+	if key.Order != "" {
+		details = append(details, key.Order)
+	}
+	if len(details) == 0 {
+		return key.Field
+	}
+	return fmt.Sprintf("%s (%s)", key.Field, strings.Join(details, ", "))
+}
+
+// explainFields prints the template fields in output order, each with the
+// transformation actions applied to it, then any transformation rules for
+// columns the template does not use.
+func explainFields(schema *xlsxparser.Schema, deptConfig *config.DepartmentConfig) {
+	used := make(map[string]bool)
+
+	sections := []struct {
+		title  string
+		fields []string
+	}{
+		{schema.XMLRootElement, schema.CashbookFields},
+		{schema.XMLTransactionElement, schema.TransactionFields},
+		{schema.XMLLineItemElement, schema.LineItemFields},
+	}
+
+	for _, section := range sections {
+		if len(section.fields) == 0 {
+			continue
+		}
+		fmt.Printf("  <%s>\n", section.title)
+
+		for _, field := range section.fields {
+			mapping := schema.FieldMappings[field]
+			used[field] = true
+
+			fmt.Printf("    %s -> <%s>  %s\n", field, mapping.XMLTag, describeMapping(mapping))
+			for _, sensitive := range deptConfig.SensitiveFields {
+				if sensitive.Field == field {
+					fmt.Printf("      sensitive: masked (%s) outside the output\n", sensitive.Mask)
+				}
+			}
+			explainActions(field, deptConfig.TransformationRules, "      ")
+		}
+	}
+
+	var unused []string
+	for _, rule := range deptConfig.TransformationRules {
+		if !used[rule.Field] {
+			used[rule.Field] = true
+			unused = append(unused, rule.Field)
+		}
+	}
+	if len(unused) > 0 {
+		fmt.Println("  Transformation rules for columns not in the template:")
+		for _, field := range unused {
+			fmt.Printf("    %s\n", field)
+			explainActions(field, deptConfig.TransformationRules, "      ")
+		}
+	}
+}
+
+// describeMapping formats a field's validation rules, e.g. "string, max 10, required".
+func describeMapping(mapping *xlsxparser.FieldMapping) string {
+	parts := []string{mapping.DataType}
+	if mapping.MaxLength > 0 {
+		parts = append(parts, fmt.Sprintf("max %d", mapping.MaxLength))
+	}
+	parts = append(parts, mapping.RequiredType)
+	if mapping.ConditionalRule != "" {
+		parts = append(parts, mapping.ConditionalRule)
+	}
+	for _, tag := range mapping.ConditionalTags {
+		parts = append(parts, fmt.Sprintf("<%s> if %s", tag.XMLTag, tag.Condition))
+	}
+	if mapping.DefaultValue != "" {
+		parts = append(parts, fmt.Sprintf("default %q", mapping.DefaultValue))
+	}
+	if mapping.FixedValue != "" {
+		parts = append(parts, fmt.Sprintf("fixed %q", mapping.FixedValue))
+	}
+	if mapping.Nillable {
+		parts = append(parts, "nillable")
+	}
+	if mapping.Pattern != "" {
+		parts = append(parts, fmt.Sprintf("pattern %q", mapping.Pattern))
+	}
+	if mapping.Repeatable() {
+		parts = append(parts, fmt.Sprintf("repeated, split at %q", mapping.RepeatDelimiter))
+	}
+	if mapping.Severity != "" {
+		parts = append(parts, mapping.SeverityCell())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// explainActions prints the transformation actions for a field in the order
+// they are applied: rule by rule, action by action.
+func explainActions(field string, rules []config.TransformationRule, indent string) {
+	step := 0
+	for _, rule := range rules {
+		if rule.Field != field {
+			continue
+		}
+		for _, action := range rule.Actions {
+			step++
+			fmt.Printf("%s%d. %s\n", indent, step, describeAction(action))
+		}
+	}
+	if step == 0 {
+		fmt.Printf("%s(no transformations)\n", indent)
+	}
+}
+
+// describeAction formats a transformation action with its parameters.
+func describeAction(action config.TransformationAction) string {
+	var params []string
+	if action.Find != "" {
+		params = append(params, fmt.Sprintf("find %q", action.Find))
+	}
+	if action.Value != "" || action.Find != "" {
+		params = append(params, fmt.Sprintf("value %q", action.Value))
+	}
+	if action.Condition != "" {
+		params = append(params, fmt.Sprintf("condition %q", action.Condition))
+	}
+	if len(action.LookupTable) > 0 {
+		params = append(params, fmt.Sprintf("lookup table of %d entries", len(action.LookupTable)))
+	}
+	if len(params) == 0 {
+		return action.Type
+	}
+	return fmt.Sprintf("%s (%s)", action.Type, strings.Join(params, ", "))
+}
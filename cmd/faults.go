@@ -0,0 +1,51 @@
+// =============================================================================
+// CSV to XML Converter - Failure Injection Flags
+// =============================================================================
+//
+// Hidden flags of the process and watch commands that inject failures into
+// every conversion, so integration tests can check the failure policies,
+// the retry of failed files, and the cleanup of partial output (see
+// internal/converter/faults.go). They are not listed in the help.
+//
+// FLAGS:
+//   --fail-after-n-rows N   Fail the parse stage after N rows
+//   --inject-write-error    Fail each output file write half way
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/spf13/cobra"
+)
+
+// failAfterRows fails the parse stage of each file after this many rows,
+// or never if 0.
+var failAfterRows int
+
+// injectWriteError fails each output file write half way.
+var injectWriteError bool
+
+// addFaultFlags registers the hidden failure injection flags of a command.
+func addFaultFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(
+		&failAfterRows,
+		"fail-after-n-rows",
+		0,
+		"Fail the parse stage of each file after N rows (testing only)",
+	)
+	cmd.Flags().BoolVar(
+		&injectWriteError,
+		"inject-write-error",
+		false,
+		"Fail each output file write half way (testing only)",
+	)
+	cmd.Flags().MarkHidden("fail-after-n-rows")
+	cmd.Flags().MarkHidden("inject-write-error")
+}
+
+// injectedFaults returns the failures the flags inject.
+func injectedFaults() converter.Faults {
+	return converter.Faults{FailAfterRows: failAfterRows, WriteError: injectWriteError}
+}
@@ -0,0 +1,231 @@
+// =============================================================================
+// CSV to XML Converter - Generate Sample Command
+// =============================================================================
+//
+// This file defines the 'generate-sample' command, which writes a CSV file
+// of synthetic rows for a template (see converter.GenerateSample): valid
+// rows by default, and optionally a share of deliberately invalid ones. It
+// is used for load testing and for training.
+//
+// COMMAND USAGE:
+//   converter generate-sample --template <template.xlsx> [--rows N] [--invalid PERCENT] [--department CODE] [--output FILE]
+//
+// FLAGS:
+//   --template   : The template, by path or name in the templates directory (required)
+//   --rows       : The number of rows (default: 100)
+//   --invalid    : The share of rows, in percent, made invalid (default: 0)
+//   --department : Use this department's lookups, transformation rules,
+//                  grouping, and delimiter
+//   --seed       : Generate the same rows again (default: random)
+//   --output     : The CSV file, or "-" for stdout (default: ./<template>_sample.csv)
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+var (
+	// sampleTemplate is the template to generate rows for.
+	sampleTemplate string
+
+	// sampleRows is the number of rows.
+	sampleRows int
+
+	// sampleInvalid is the share of invalid rows, in percent.
+	sampleInvalid float64
+
+	// sampleDepartment is the department whose rules are used.
+	sampleDepartment string
+
+	// sampleSeed makes the generation repeatable.
+	sampleSeed int64
+
+	// sampleOutput is the CSV file.
+	sampleOutput string
+)
+
+// =============================================================================
+// GENERATE SAMPLE COMMAND DEFINITION
+// =============================================================================
+
+// generateSampleCmd represents the 'generate-sample' command.
+var generateSampleCmd = &cobra.Command{
+	Use:   "generate-sample --template <template.xlsx>",
+	Short: "Write a CSV file of synthetic rows for a template",
+	Long: `Writes a CSV file of synthetic rows for a template, for load testing and
+training. The columns are the template's Old Headers. Each value follows its
+field's data type, max length, requiredness, pattern, and fixed value, and
+passes the template's validation after the department's transformation rules.
+
+With --department, fields with a lookup take the lookup table's keys, the
+rows are grouped into transactions of 1 to 5 rows by the department's
+group_by_field (sharing the transaction fields), and the department's
+delimiter is used.
+
+With --invalid, that share of rows has one field made invalid on purpose
+(empty, too long, of the wrong type, or not matching the pattern); the line
+and rule code of each are printed.
+
+Examples:
+  converter generate-sample --template payments.xlsx --rows 1000
+  converter generate-sample --template payments.xlsx --department CLAIMS --rows 50000 --invalid 2 --output load.csv`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runGenerateSample()
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the generate-sample command with the root command and sets
+// up flags.
+func init() {
+	rootCmd.AddCommand(generateSampleCmd)
+
+	generateSampleCmd.Flags().StringVar(
+		&sampleTemplate,
+		"template",
+		"",
+		"Template, by path or name in the templates directory",
+	)
+	generateSampleCmd.MarkFlagRequired("template")
+
+	generateSampleCmd.Flags().IntVar(
+		&sampleRows,
+		"rows",
+		100,
+		"Number of rows",
+	)
+
+	generateSampleCmd.Flags().Float64Var(
+		&sampleInvalid,
+		"invalid",
+		0,
+		"Share of rows, in percent, made invalid on purpose",
+	)
+
+	generateSampleCmd.Flags().StringVar(
+		&sampleDepartment,
+		"department",
+		"",
+		"Use this department's lookups, transformation rules, grouping, and delimiter",
+	)
+
+	generateSampleCmd.Flags().Int64Var(
+		&sampleSeed,
+		"seed",
+		0,
+		"Seed to generate the same rows again (default: random)",
+	)
+
+	generateSampleCmd.Flags().StringVarP(
+		&sampleOutput,
+		"output", "o",
+		"",
+		`CSV file, or "-" for stdout (default: ./<template>_sample.csv)`,
+	)
+}
+
+// =============================================================================
+// GENERATE SAMPLE FUNCTION
+// =============================================================================
+
+// runGenerateSample writes the sample CSV file.
+//
+// RETURNS:
+//   - An error if the configuration or template cannot be read, or the file
+//     cannot be written.
+func runGenerateSample() error {
+	if sampleInvalid < 0 || sampleInvalid > 100 {
+		return fmt.Errorf("--invalid must be between 0 and 100")
+	}
+
+	var deptConfig *config.DepartmentConfig
+	if sampleDepartment != "" {
+		_, deptConfigs, err := loadListConfig()
+		if err != nil {
+			return err
+		}
+		deptConfig = deptConfigs[sampleDepartment]
+		if deptConfig == nil {
+			return &exitError{exitConfigError, fmt.Errorf("unknown department: %s", sampleDepartment)}
+		}
+	}
+
+	templatePath, err := resolveTemplatePath(sampleTemplate)
+	if err != nil {
+		return err
+	}
+	schema, err := xlsxparser.Parse(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", templatePath, err)
+	}
+
+	output := sampleOutput
+	if output == "" {
+		name := filepath.Base(templatePath)
+		output = strings.TrimSuffix(name, filepath.Ext(name)) + "_sample.csv"
+	}
+
+	// Progress goes to stderr when the CSV goes to stdout.
+	var w io.Writer = os.Stdout
+	console := os.Stdout
+	if output == "-" {
+		console = os.Stderr
+	} else {
+		file, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", output, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	result, err := converter.GenerateSample(w, schema, converter.SampleOptions{
+		Rows:           sampleRows,
+		InvalidPercent: sampleInvalid,
+		Seed:           sampleSeed,
+		Department:     deptConfig,
+	})
+	if err != nil {
+		return err
+	}
+	if file, ok := w.(*os.File); ok && file != os.Stdout {
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", output, err)
+		}
+		fmt.Fprintf(console, "Wrote %d row(s) in %d transaction(s) to %s\n", result.Rows, result.Transactions, output)
+	}
+
+	if len(result.InvalidRows) > 0 {
+		fmt.Fprintf(console, "\n%d invalid row(s):\n", len(result.InvalidRows))
+		for _, row := range result.InvalidRows {
+			fmt.Fprintf(console, "  line %d: %s (%s)\n", row.Line, row.Field, row.Code)
+		}
+	}
+	if len(result.Unsatisfied) > 0 {
+		fmt.Fprintf(console, "\nWarning: no valid value was found for %s; rows may fail validation on these fields\n",
+			strings.Join(result.Unsatisfied, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// =============================================================================
+// CSV to XML Converter - Health Endpoints
+// =============================================================================
+//
+// With health_addr set, the watch command serves two endpoints for load
+// balancers, orchestrators, and monitoring:
+//
+//   GET /healthz : 200 while the watcher runs (liveness)
+//   GET /readyz  : 200 once a scan has finished and the last scan could
+//                  load the configuration and read the input directory;
+//                  503 with the reason otherwise, and while stopping
+//
+// A scan that only had files fail is still ready: failed files are reported
+// through the audit trail and logs, not by taking the watcher out of
+// service.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
+)
+
+// watchHealth is the state reported by the health endpoints.
+type watchHealth struct {
+	mu sync.Mutex
+
+	// scanned is set once a scan has finished.
+	scanned bool
+
+	// lastErr is the error of the last scan, or nil.
+	lastErr error
+
+	// stopping is set when the watcher is stopping.
+	stopping bool
+}
+
+// scanFinished records the outcome of a scan.
+func (h *watchHealth) scanFinished(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.scanned = true
+	h.lastErr = err
+}
+
+// stop marks the watcher as stopping.
+func (h *watchHealth) stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopping = true
+}
+
+// ready reports whether the watcher is ready, and why not.
+func (h *watchHealth) ready() (bool, string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case h.stopping:
+		return false, "stopping"
+	case !h.scanned:
+		return false, "first scan has not finished"
+	case h.lastErr != nil:
+		return false, h.lastErr.Error()
+	}
+	return true, ""
+}
+
+// startHealthServer serves the health endpoints.
+//
+// PARAMETERS:
+//   - addr: The address to listen on (health_addr).
+//   - health: The state to report.
+//   - logger: Logs a server that stops unexpectedly.
+//
+// RETURNS:
+//   - The server, to be stopped with stopHealthServer.
+//   - An error if the address cannot be listened on.
+func startHealthServer(addr string, health *watchHealth, logger *logging.Logger) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if ok, reason := health.ready(); !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "not ready: %s\n", reason)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on health_addr: %w", err)
+	}
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Health endpoints stopped: %v", err)
+		}
+	}()
+	logger.Info("Serving health endpoints on %s", listener.Addr())
+	return server, nil
+}
+
+// stopHealthServer stops the health endpoints, waiting briefly for
+// requests in progress.
+func stopHealthServer(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+}
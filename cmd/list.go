@@ -0,0 +1,370 @@
+// =============================================================================
+// CSV to XML Converter - List Commands
+// =============================================================================
+//
+// This file defines the 'departments list' and 'templates list' commands,
+// which show the configuration the converter loads, so operators can verify
+// a deployment without reading YAML files and spreadsheets.
+//
+// COMMAND USAGE:
+//   converter departments list [--json]
+//   converter templates list [--json]
+//
+// FLAGS:
+//   --json : Print the list as a JSON array instead of text
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// listJSON prints the lists as JSON.
+var listJSON bool
+
+// =============================================================================
+// LIST COMMAND DEFINITIONS
+// =============================================================================
+
+// departmentsCmd is the parent of the department commands.
+var departmentsCmd = &cobra.Command{
+	Use:   "departments",
+	Short: "Show department configurations",
+}
+
+// departmentsListCmd represents the 'departments list' command.
+var departmentsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the loaded department configurations",
+	Long: `Lists every department configuration in the configs directory with its file
+matching patterns and input subdirectories, template mapping rules, transaction grouping field, and
+output directory and file name format.
+Templates that do not exist in the templates directory are marked MISSING.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runDepartmentsList()
+	},
+}
+
+// templatesCmd is the parent of the template commands.
+var templatesCmd = &cobra.Command{
+	Use:     "templates",
+	Aliases: []string{"template"},
+	Short:   "Show and compare XLSX templates",
+}
+
+// templatesListCmd represents the 'templates list' command.
+var templatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the templates and their field counts",
+	Long: `Lists every XLSX template in the templates directory, and every template a
+department refers to, with its sheet, field counts, and the departments that
+use it. Templates that are missing or cannot be parsed are listed with the
+error.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return runTemplatesList()
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the list commands and sets up flags.
+func init() {
+	rootCmd.AddCommand(departmentsCmd)
+	departmentsCmd.AddCommand(departmentsListCmd)
+	rootCmd.AddCommand(templatesCmd)
+	templatesCmd.AddCommand(templatesListCmd)
+
+	for _, cmd := range []*cobra.Command{departmentsListCmd, templatesListCmd} {
+		cmd.Flags().BoolVar(
+			&listJSON,
+			"json",
+			false,
+			"Print the list as JSON",
+		)
+	}
+}
+
+// =============================================================================
+// LIST ENTRIES
+// =============================================================================
+
+// departmentInfo is one entry of 'departments list'.
+type departmentInfo struct {
+	Code                string         `json:"code"`
+	Name                string         `json:"name"`
+	Patterns            []string       `json:"file_matching_patterns"`
+	Subdirectories      []string       `json:"input_subdirectories"`
+	MatchPriority       int            `json:"match_priority"`
+	Templates           []templateRule `json:"template_mapping"`
+	Selector            *selectorInfo  `json:"template_selector,omitempty"`
+	GroupByField        string         `json:"group_by_field"`
+	TransformationRules int            `json:"transformation_rules"`
+	OutputDir           string         `json:"output_dir"`
+	UUIDFormat          string         `json:"uuid_format"`
+}
+
+// templateRule is a department's template mapping rule.
+type templateRule struct {
+	IfFilenameContains string `json:"if_filename_contains"`
+	Template           string `json:"use_template"`
+	Exists             bool   `json:"exists"`
+}
+
+// selectorInfo is a department's template selector.
+type selectorInfo struct {
+	Field     string         `json:"field"`
+	Templates []templateRule `json:"map"`
+	Output    string         `json:"output"`
+}
+
+// templateInfo is one entry of 'templates list'.
+type templateInfo struct {
+	File              string   `json:"file"`
+	Path              string   `json:"path"`
+	Sheet             string   `json:"sheet,omitempty"`
+	Version           string   `json:"version,omitempty"`
+	Fields            int      `json:"fields"`
+	CashbookFields    int      `json:"cashbook_fields"`
+	TransactionFields int      `json:"transaction_fields"`
+	LineItemFields    int      `json:"line_item_fields"`
+	Departments       []string `json:"departments"`
+	Error             string   `json:"error,omitempty"`
+}
+
+// =============================================================================
+// LIST FUNCTIONS
+// =============================================================================
+
+// runDepartmentsList prints the loaded department configurations.
+func runDepartmentsList() error {
+	mainConfig, deptConfigs, err := loadListConfig()
+	if err != nil {
+		return err
+	}
+
+	departments := []departmentInfo{}
+	for _, code := range converter.DepartmentCodes(deptConfigs) {
+		deptConfig := deptConfigs[code]
+
+		info := departmentInfo{
+			Code:                code,
+			Name:                deptConfig.DepartmentName,
+			Patterns:            append([]string{}, deptConfig.FileMatchingPatterns...),
+			Subdirectories:      append([]string{}, deptConfig.InputSubdirectories...),
+			MatchPriority:       deptConfig.MatchPriority,
+			Templates:           []templateRule{},
+			GroupByField:        deptConfig.TransactionGrouping.GroupByField,
+			TransformationRules: len(deptConfig.TransformationRules),
+			OutputDir:           mainConfig.ForDepartment(deptConfig).OutputDir,
+			UUIDFormat:          mainConfig.ForDepartment(deptConfig).UUIDFormat,
+		}
+		for _, rule := range deptConfig.TemplateMapping {
+			_, err := os.Stat(filepath.Join(mainConfig.TemplatesDir, rule.UseTemplate))
+			info.Templates = append(info.Templates, templateRule{
+				IfFilenameContains: rule.IfFilenameContains,
+				Template:           rule.UseTemplate,
+				Exists:             err == nil,
+			})
+		}
+		if selector := deptConfig.TemplateSelector; selector.Enabled() {
+			info.Selector = &selectorInfo{Field: selector.Field, Output: selector.Output}
+			for _, value := range selector.Values() {
+				_, err := os.Stat(filepath.Join(mainConfig.TemplatesDir, selector.Map[value]))
+				info.Selector.Templates = append(info.Selector.Templates, templateRule{
+					IfFilenameContains: value,
+					Template:           selector.Map[value],
+					Exists:             err == nil,
+				})
+			}
+		}
+		departments = append(departments, info)
+	}
+
+	if listJSON {
+		return printListJSON(departments)
+	}
+
+	if len(departments) == 0 {
+		fmt.Printf("No department configurations in %s\n", mainConfig.ConfigsDir)
+		return nil
+	}
+	for i, dept := range departments {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s (%s)\n", dept.Code, dept.Name)
+		fmt.Printf("  Patterns:        %s\n", strings.Join(dept.Patterns, ", "))
+		if len(dept.Subdirectories) > 0 {
+			fmt.Printf("  Subdirectories:  %s\n", strings.Join(dept.Subdirectories, ", "))
+		}
+		if dept.MatchPriority != 0 {
+			fmt.Printf("  Match priority:  %d\n", dept.MatchPriority)
+		}
+		for _, rule := range dept.Templates {
+			missing := ""
+			if !rule.Exists {
+				missing = "  MISSING"
+			}
+			fmt.Printf("  Template:        %q -> %s%s\n", rule.IfFilenameContains, rule.Template, missing)
+		}
+		if dept.Selector != nil {
+			fmt.Printf("  Selected by:     %s (%s output)\n", dept.Selector.Field, dept.Selector.Output)
+			for _, rule := range dept.Selector.Templates {
+				missing := ""
+				if !rule.Exists {
+					missing = "  MISSING"
+				}
+				fmt.Printf("    %s = %q -> %s%s\n", dept.Selector.Field, rule.IfFilenameContains, rule.Template, missing)
+			}
+		}
+		if dept.GroupByField != "" {
+			fmt.Printf("  Grouped by:      %s\n", dept.GroupByField)
+		}
+		fmt.Printf("  Transformations: %d rule(s)\n", dept.TransformationRules)
+		fmt.Printf("  Output:          %s/%s\n", dept.OutputDir, dept.UUIDFormat)
+	}
+	return nil
+}
+
+// runTemplatesList prints the templates in the templates directory and the
+// templates the departments refer to.
+func runTemplatesList() error {
+	mainConfig, deptConfigs, err := loadListConfig()
+	if err != nil {
+		return err
+	}
+
+	// Collect the template files and the departments using each.
+	users := make(map[string][]string)
+	files, err := filepath.Glob(filepath.Join(mainConfig.TemplatesDir, "*.xlsx"))
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %w", err)
+	}
+	for _, file := range files {
+		// Skip the lock files Excel creates next to open workbooks.
+		if !strings.HasPrefix(filepath.Base(file), "~$") {
+			users[filepath.Base(file)] = nil
+		}
+	}
+	for _, code := range converter.DepartmentCodes(deptConfigs) {
+		for _, template := range deptConfigs[code].Templates() {
+			if !containsString(users[template], code) {
+				users[template] = append(users[template], code)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(users))
+	for name := range users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	templates := []templateInfo{}
+	for _, name := range names {
+		info := templateInfo{
+			File:        name,
+			Path:        filepath.Join(mainConfig.TemplatesDir, name),
+			Departments: append([]string{}, users[name]...),
+		}
+
+		schema, err := xlsxparser.Parse(info.Path)
+		if err != nil {
+			info.Error = err.Error()
+		} else {
+			info.Sheet = schema.SheetName
+			info.Version = schema.Version
+			info.Fields = len(schema.FieldMappings)
+			info.CashbookFields = len(schema.CashbookFields)
+			info.TransactionFields = len(schema.TransactionFields)
+			info.LineItemFields = len(schema.LineItemFields)
+		}
+		templates = append(templates, info)
+	}
+
+	if listJSON {
+		return printListJSON(templates)
+	}
+
+	if len(templates) == 0 {
+		fmt.Printf("No templates in %s\n", mainConfig.TemplatesDir)
+		return nil
+	}
+	for i, tmpl := range templates {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(tmpl.File)
+		if tmpl.Error != "" {
+			fmt.Printf("  Error:       %s\n", tmpl.Error)
+		} else {
+			fmt.Printf("  Sheet:       %s\n", tmpl.Sheet)
+			if tmpl.Version != "" {
+				fmt.Printf("  Version:     %s\n", tmpl.Version)
+			}
+			fmt.Printf("  Fields:      %d (cashbook %d, transaction %d, line item %d)\n",
+				tmpl.Fields, tmpl.CashbookFields, tmpl.TransactionFields, tmpl.LineItemFields)
+		}
+		departments := strings.Join(tmpl.Departments, ", ")
+		if departments == "" {
+			departments = "(none)"
+		}
+		fmt.Printf("  Departments: %s\n", departments)
+	}
+	return nil
+}
+
+// loadListConfig loads the main and department configurations.
+func loadListConfig() (*config.MainConfig, map[string]*config.DepartmentConfig, error) {
+	mainConfig, err := config.LoadMainConfig(cfgFile)
+	if err != nil {
+		return nil, nil, &exitError{exitConfigError, fmt.Errorf("failed to load main config: %w", err)}
+	}
+
+	deptConfigs, err := config.LoadDepartmentConfigs(mainConfig.ConfigsDir)
+	if err != nil {
+		return nil, nil, &exitError{exitConfigError, fmt.Errorf("failed to load department configs: %w", err)}
+	}
+
+	return mainConfig, deptConfigs, nil
+}
+
+// printListJSON prints a list as indented JSON.
+func printListJSON(list interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(list)
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+// =============================================================================
+// CSV to XML Converter - Preview Mode
+// =============================================================================
+//
+// With --preview, the process command converts each file as usual but
+// writes the XML to the preview directory (--preview-dir, ./preview by
+// default) as "<name>.xml" (or the extension of the department's
+// output_format), or to stdout with --single. Business users can
+// eyeball the structure before real processing is enabled for a new
+// department. See converter.Preview.
+//
+// Like a pre-check, a preview does not take the run lock, and nothing is
+// delivered, published, held, archived, audited, or logged to the output
+// directory. The input files stay where they are.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+)
+
+// readOnlyRun reports whether the run only reads its input files: a
+// pre-check, a preview, or an estimate.
+func readOnlyRun() bool {
+	return precheck || preview || estimateOnly
+}
+
+// previewFile converts a file for preview.
+//
+// PARAMETERS:
+//   - conv: The converter of the file.
+//   - path: The input file.
+//
+// RETURNS:
+//   - The result. OutputFile is the preview file, or empty for stdout.
+func previewFile(conv *converter.Converter, path string) converter.Result {
+	if singleFile {
+		return conv.Preview(os.Stdout)
+	}
+
+	if err := os.MkdirAll(previewDir, 0755); err != nil {
+		return converter.Result{FilePath: path, Error: fmt.Errorf("failed to create preview directory: %w", err)}
+	}
+
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	previewPath := filepath.Join(previewDir, base+conv.OutputExtension())
+	file, err := os.Create(previewPath)
+	if err != nil {
+		return converter.Result{FilePath: path, Error: fmt.Errorf("failed to create preview file: %w", err)}
+	}
+
+	result := conv.Preview(file)
+	if err := file.Close(); err != nil && result.Success {
+		result.Success = false
+		result.Error = fmt.Errorf("failed to write preview file: %w", err)
+	}
+	if !result.Success {
+		os.Remove(previewPath)
+		return result
+	}
+
+	result.OutputFile = previewPath
+	return result
+}
+
+// previewTarget describes where a preview was written.
+func previewTarget(result converter.Result) string {
+	if result.OutputFile == "" {
+		return "stdout"
+	}
+	return result.OutputFile
+}
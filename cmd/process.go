@@ -13,10 +13,24 @@
 //   --single      : Process only a single file (specify with --file)
 //   --file        : Path to a specific file to process (used with --single)
 //   --department  : Process only files for a specific department
+//   --precheck    : Validate the first and a random sample of rows only (no XML)
+//   --preview     : Write the XML to the preview directory (stdout with
+//                   --single) without delivering or archiving anything
+//   --preview-dir : Directory for --preview (default: ./preview)
+//   --output      : "text" (default) or "json" (ProcessingSummary on stdout)
+//   --estimate    : Print when each file is estimated to finish, from the
+//                   audit history, without converting anything
+//
+// EXIT CODES:
+//   0: success, 1: other error, 2: validation failures, 3: configuration
+//   error, 4: partial failure, 5: run aborted by a failure policy (see
+//   root.go)
 //
 // PROCESSING PIPELINE:
 //   1. Load configuration files
-//   2. Discover CSV files in the input directory
+//   2. Discover CSV files in the input directory (skipping files that are
+//      still being copied, see file_readiness). Object-store directories are
+//      staged locally first, see cmd/staging.go.
 //   3. Match each file to a department configuration
 //   4. For each file (concurrently):
 //      a. Parse the XLSX template to get the schema
@@ -25,7 +39,8 @@
 //      d. Validate the data
 //      e. Generate the XML
 //      f. Write the output file
-//   5. Archive processed files
+//      g. Deliver the output file (if configured)
+//   5. Archive processed files (and upload staged results)
 //   6. Generate summary report
 //
 // =============================================================================
@@ -33,14 +48,25 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"sync"
+	"strings"
 	"time"
 
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/archivecrypt"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/audit"
 	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
 	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/events"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/schedule"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -48,6 +74,9 @@ import (
 // COMMAND FLAGS
 // =============================================================================
 
+// runLockFile is the name of the run-level lock file in the input directory.
+const runLockFile = ".csv2xml-run.lock"
+
 // dryRun simulates processing without writing output files.
 var dryRun bool
 
@@ -60,6 +89,33 @@ var filePath string
 // department filters processing to a specific department.
 var department string
 
+// precheck validates a sample of each file without generating XML.
+var precheck bool
+
+// precheckRows is the number of leading rows checked in pre-check mode.
+var precheckRows int
+
+// precheckSample is the number of randomly sampled rows checked in pre-check mode.
+var precheckSample int
+
+// preview writes the generated XML to previewDir (or stdout with --single)
+// instead of processing the files.
+var preview bool
+
+// previewDir is the directory previews are written to.
+var previewDir string
+
+// outputFormat is the format of the run summary: "text" or "json".
+var outputFormat string
+
+// estimateOnly prints the estimated completion of the run instead of
+// converting the files.
+var estimateOnly bool
+
+// console receives the human-readable progress output. With --output json,
+// stdout is reserved for the summary document and progress goes to stderr.
+var console io.Writer = os.Stdout
+
 // =============================================================================
 // PROCESS COMMAND DEFINITION
 // =============================================================================
@@ -83,12 +139,49 @@ On successful processing:
 On error:
   - An error log is created in the output directory
   - The original CSV remains in the input directory
-  - Processing continues for other files`,
+  - Processing continues for other files, unless the department's
+    failure_policy aborts the run
+
+With --output json, a summary document is printed on stdout. The exit code
+is 0 on success, 2 if files failed validation, 3 if the configuration is
+invalid, 4 if files failed for other reasons, and 5 if a failure policy
+aborted the run.`,
 
 	// RunE is like Run but returns an error. This is preferred for commands
 	// that can fail, as it allows Cobra to handle the error gracefully.
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runProcess()
+		switch outputFormat {
+		case "text":
+		case "json":
+			console = os.Stderr
+		default:
+			return fmt.Errorf("invalid output format %q (use text or json)", outputFormat)
+		}
+		if singleFile && filePath == "" {
+			return fmt.Errorf("--single requires --file")
+		}
+		if preview && precheck {
+			return fmt.Errorf("--preview and --precheck cannot be combined")
+		}
+		if estimateOnly && (preview || precheck || outputFormat == "json") {
+			return fmt.Errorf("--estimate cannot be combined with --preview, --precheck, or --output json")
+		}
+		if preview && singleFile {
+			// The XML is written to stdout.
+			if outputFormat == "json" {
+				return fmt.Errorf("--preview --single writes the XML to stdout and cannot be combined with --output json")
+			}
+			console = os.Stderr
+		}
+
+		// The flags are valid; errors from here on are not usage errors, and
+		// Execute prints them.
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+
+		summary := utils.ProcessingSummary{StartTime: time.Now()}
+		err := runProcess(&summary)
+		return finishProcess(&summary, err)
 	},
 }
 
@@ -137,6 +230,64 @@ func init() {
 		"",
 		"Process only files for a specific department",
 	)
+
+	// --precheck flag: Validate a sample of each file without generating XML.
+	processCmd.Flags().BoolVar(
+		&precheck,
+		"precheck",
+		false,
+		"Parse and validate only a sample of each file; no XML is written and nothing is archived",
+	)
+
+	// --precheck-rows flag: Number of leading rows to check.
+	processCmd.Flags().IntVar(
+		&precheckRows,
+		"precheck-rows",
+		converter.DefaultPrecheckOptions().HeadRows,
+		"Number of leading rows to check in pre-check mode",
+	)
+
+	// --precheck-sample flag: Number of random rows to check.
+	processCmd.Flags().IntVar(
+		&precheckSample,
+		"precheck-sample",
+		converter.DefaultPrecheckOptions().SampleRows,
+		"Number of randomly sampled rows to check in pre-check mode",
+	)
+
+	// --preview flag: Write the XML for review instead of processing.
+	processCmd.Flags().BoolVar(
+		&preview,
+		"preview",
+		false,
+		"Write the generated XML to the preview directory (stdout with --single); nothing is delivered or archived",
+	)
+
+	// --preview-dir flag: Directory for previews.
+	processCmd.Flags().StringVar(
+		&previewDir,
+		"preview-dir",
+		"./preview",
+		"Directory the --preview XML is written to",
+	)
+
+	// --output flag: Format of the run summary.
+	processCmd.Flags().StringVar(
+		&outputFormat,
+		"output",
+		"text",
+		"Format of the run summary: text, or json (summary document on stdout)",
+	)
+
+	// --estimate flag: Print the estimated completion instead of processing.
+	processCmd.Flags().BoolVar(
+		&estimateOnly,
+		"estimate",
+		false,
+		"Print when each file is estimated to start and finish, from the audit history; nothing is converted",
+	)
+	// Hidden flags that inject failures for integration tests.
+	addFaultFlags(processCmd)
 }
 
 // =============================================================================
@@ -144,16 +295,24 @@ func init() {
 // =============================================================================
 
 // runProcess is the main function that orchestrates the conversion pipeline.
-func runProcess() error {
-	startTime := time.Now()
+//
+// PARAMETERS:
+//   - summary: The run summary, filled in as files are processed.
+//
+// RETURNS:
+//   - An error if the run could not be completed. Configuration errors and
+//     failed transfers carry their exit code (see exitError); failed files
+//     are only recorded in the summary.
+func runProcess(summary *utils.ProcessingSummary) error {
+	startTime := summary.StartTime
 
 	// =========================================================================
 	// STEP 1: LOAD CONFIGURATION
 	// =========================================================================
 	// Load the main configuration file and all department-specific configurations.
 
-	fmt.Println("=== CSV to XML Converter ===")
-	fmt.Println("Loading configuration...")
+	fmt.Fprintln(console, "=== CSV to XML Converter ===")
+	fmt.Fprintln(console, "Loading configuration...")
 
 	// Load the main configuration from the config file.
 	// PSEUDOCODE:
@@ -163,7 +322,14 @@ func runProcess() error {
 	// }
 	mainConfig, err := config.LoadMainConfig(cfgFile)
 	if err != nil {
-		return fmt.Errorf("failed to load main config: %w", err)
+		return &exitError{exitConfigError, fmt.Errorf("failed to load main config: %w", err)}
+	}
+
+	// Report a missing archive key before any file is converted.
+	if !readOnlyRun() {
+		if err := archivecrypt.CheckKey(mainConfig.ArchiveEncryption); err != nil {
+			return &exitError{exitConfigError, err}
+		}
 	}
 
 	// Load all department configurations from the configs directory.
@@ -174,116 +340,278 @@ func runProcess() error {
 	// }
 	deptConfigs, err := config.LoadDepartmentConfigs(mainConfig.ConfigsDir)
 	if err != nil {
-		return fmt.Errorf("failed to load department configs: %w", err)
+		return &exitError{exitConfigError, fmt.Errorf("failed to load department configs: %w", err)}
+	}
+
+	fmt.Fprintf(console, "Loaded %d department configuration(s)\n", len(deptConfigs))
+
+	// Object-store directories (s3://, az://) are staged locally; from here
+	// on, mainConfig refers to the staging directories.
+	run, err := newStagedRun(context.Background(), mainConfig)
+	if err != nil {
+		return err
+	}
+	mainConfig = run.local
+	deptConfigs, err = run.stageDepartments(deptConfigs)
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("Loaded %d department configuration(s)\n", len(deptConfigs))
+	// Every converted, failed, or skipped file is recorded in the audit trail.
+	trail, err := audit.Open(mainConfig.AuditLog)
+	if err != nil {
+		return err
+	}
+
+	// Only one run may process the input directory at a time. Pre-checks and
+	// previews do not modify anything and may overlap with other runs.
+	if !readOnlyRun() {
+		runLock, err := acquireRunLock(mainConfig)
+		if errors.Is(err, utils.ErrLocked) {
+			fmt.Fprintf(console, "Another run is processing %s; exiting.\n  (%v)\n", mainConfig.InputDir, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if runLock != nil {
+			defer runLock.Release()
+		}
+	}
+
+	// Output files are held and released on the delivery schedule, if one
+	// is configured. Pre-checks and previews write no output.
+	var sched *schedule.Schedule
+	if !readOnlyRun() {
+		sched, err = newSchedule(mainConfig)
+		if err != nil {
+			return &exitError{exitConfigError, err}
+		}
+	}
+
+	// A full output or archive volume must not produce truncated files. See
+	// internal/converter/diskspace.go.
+	if !readOnlyRun() {
+		if err := converter.CheckDiskSpace(converter.DiskSpaceDirs(mainConfig, deptConfigs), mainConfig.DiskSpace); err != nil {
+			return err
+		}
+	}
 
 	// =========================================================================
 	// STEP 2: DISCOVER INPUT FILES
 	// =========================================================================
 	// Scan the input directory for CSV files to process.
 
-	fmt.Println("Discovering input files...")
+	fmt.Fprintln(console, "Discovering input files...")
 
-	// Get list of CSV files in the input directory.
-	// PSEUDOCODE:
-	// inputFiles, err := discoverInputFiles(mainConfig.InputDir)
-	// if err != nil {
-	//     return fmt.Errorf("failed to discover input files: %w", err)
-	// }
-	inputFiles, err := discoverInputFiles(mainConfig.InputDir)
+	downloaded, deferred, err := run.stageInputs()
 	if err != nil {
-		return fmt.Errorf("failed to discover input files: %w", err)
+		return fmt.Errorf("failed to stage input files: %w", err)
+	}
+	if downloaded > 0 {
+		fmt.Fprintf(console, "Downloaded %d file(s) from %s\n", downloaded, run.input.URI())
+	}
+	if deferred > 0 {
+		fmt.Fprintf(console, "Warning: %d file(s) in %s left for a later run: not enough free space in %s\n",
+			deferred, run.input.URI(), mainConfig.InputDir)
 	}
 
-	if len(inputFiles) == 0 {
-		fmt.Println("No CSV files found in the input directory.")
-		return nil
+	// Conversion events are published to Kafka or RabbitMQ, if configured.
+	var publisher events.Publisher
+	if !readOnlyRun() {
+		publisher, err = events.New(mainConfig.Events)
+		if err != nil {
+			return &exitError{exitConfigError, fmt.Errorf("failed to set up event publishing: %w", err)}
+		}
+		if publisher != nil {
+			defer publisher.Close()
+		}
 	}
 
-	fmt.Printf("Found %d file(s) to process\n", len(inputFiles))
+	// The converters log at the configured level (debug with --verbose),
+	// to the console so they never mix with the JSON summary.
+	logger, err := newLogger(mainConfig, logging.Options{Output: console})
+	if err != nil {
+		return &exitError{exitConfigError, err}
+	}
+	defer logger.Close()
+
+	// Discovery, department matching, and concurrency are shared with the
+	// watch command (see converter.Processor).
+	processor := converter.NewProcessor(deptConfigs, mainConfig)
+	processor.SetLogger(logger)
+	processor.SetAuditTrail(trail)
+	processor.SetFaults(injectedFaults())
+	if publisher != nil {
+		processor.SetPublisher(publisher)
+	}
 
-	// =========================================================================
-	// STEP 3: PROCESS FILES CONCURRENTLY
-	// =========================================================================
-	// Process each file in a separate goroutine for maximum performance.
-	// Use a WaitGroup to wait for all goroutines to complete.
-	// Use a channel to collect results and errors.
-
-	fmt.Println("Processing files...")
-
-	// Create a WaitGroup to wait for all goroutines to complete.
-	var wg sync.WaitGroup
-
-	// Create a channel to collect processing results.
-	// The channel is buffered to prevent blocking.
-	results := make(chan converter.Result, len(inputFiles))
-
-	// Process each file concurrently.
-	for _, file := range inputFiles {
-		wg.Add(1)
-
-		// Launch a goroutine for each file.
-		go func(filePath string) {
-			defer wg.Done()
-
-			// Find the matching department configuration for this file.
-			// PSEUDOCODE:
-			// deptConfig := findMatchingDepartment(filePath, deptConfigs)
-			// if deptConfig == nil {
-			//     results <- converter.Result{
-			//         FilePath: filePath,
-			//         Success:  false,
-			//         Error:    fmt.Errorf("no matching department configuration found"),
-			//     }
-			//     return
-			// }
-			deptConfig := findMatchingDepartment(filePath, deptConfigs)
-			if deptConfig == nil {
-				results <- converter.Result{
-					FilePath: filePath,
-					Success:  false,
-					Error:    fmt.Errorf("no matching department configuration found"),
-				}
-				return
-			}
+	announce := func(files []string) []string {
+		if len(files) == 0 {
+			fmt.Fprintln(console, "No files are ready for processing.")
+			return files
+		}
+		fmt.Fprintf(console, "Found %d file(s) to process\n", len(files))
+		fmt.Fprintln(console, "Processing files...")
+		return files
+	}
 
-			// Create a new converter instance for this file.
-			// PSEUDOCODE:
-			// conv := converter.New(filePath, deptConfig, mainConfig)
-			// result := conv.Run()
-			// results <- result
-			conv := converter.New(filePath, deptConfig, mainConfig)
-			result := conv.Run()
-			results <- result
+	options := converter.ProcessOptions{
+		ReadOnly: readOnlyRun(),
+		Summary:  summary,
+		Ready: func(files []string) []string {
+			if len(files) == 0 {
+				fmt.Fprintln(console, "No CSV files found in the input directory.")
+				return files
+			}
+			// Skip files that are still being copied into the input directory.
+			return announce(readyFiles(files, mainConfig))
+		},
+	}
+	if singleFile {
+		// The file was named on the command line: it is processed as is.
+		if _, err := os.Stat(filePath); err != nil {
+			return fmt.Errorf("failed to read --file: %w", err)
+		}
+		options.Files = announce([]string{filepath.Clean(filePath)})
+	}
 
-		}(file)
+	if estimateOnly {
+		return printEstimate(processor, options, mainConfig)
 	}
 
-	// Close the results channel when all goroutines are done.
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
+	switch {
+	case precheck:
+		// In pre-check mode, only validate a sample of each file.
+		options.Convert = func(conv *converter.Converter, _ string) converter.Result {
+			precheckOptions := converter.DefaultPrecheckOptions()
+			precheckOptions.HeadRows = precheckRows
+			precheckOptions.SampleRows = precheckSample
+			return conv.Precheck(precheckOptions)
+		}
+	case preview:
+		// In preview mode, write the XML for review only.
+		options.Convert = previewFile
+	}
 
+	// =========================================================================
+	// STEP 3: PROCESS FILES CONCURRENTLY
+	// =========================================================================
+	// Each file is converted in a separate goroutine, at most
+	// max_concurrency at a time, and reported as it finishes.
+	//
 	// =========================================================================
 	// STEP 4: COLLECT RESULTS AND GENERATE SUMMARY
 	// =========================================================================
-	// Collect results from all goroutines and generate a summary report.
+	// Report each result and collect the error log entries.
 
-	var successCount, errorCount int
-	var errors []string
+	var successCount, errorCount, skippedCount int
+	var errorEntries []utils.ErrorLogEntry
+	var abortedBy string
+
+	err = processor.ProcessDirectory(context.Background(), options, func(result converter.Result) {
+		// Pre-checks and previews do not change anything and are not audited.
+		if !readOnlyRun() {
+			if err := recordAudit(trail, result); err != nil {
+				fmt.Fprintf(console, "  ! %v\n", err)
+			}
+		}
+
+		if result.SchemaDrift != nil {
+			fmt.Fprintf(console, "  ! %s: input headers changed since the last successful %s run: %s\n",
+				filepath.Base(result.FilePath), result.Department, strings.Join(result.SchemaDrift.Changes(), "; "))
+		}
 
-	for result := range results {
-		if result.Success {
+		if result.Skipped {
+			skippedCount++
+			fmt.Fprintf(console, "  - %s: skipped (%v)\n", filepath.Base(result.FilePath), result.Error)
+		} else if result.Success && precheck {
 			successCount++
-			fmt.Printf("  ✓ %s -> %s\n", filepath.Base(result.FilePath), result.OutputFile)
+			fmt.Fprintf(console, "  ✓ %s: pre-check passed (%d rows checked)\n", filepath.Base(result.FilePath), result.Stats.RowsProcessed)
+			if verbose {
+				printStages(result.Stats)
+			}
+		} else if result.Success && preview {
+			successCount++
+			fmt.Fprintf(console, "  ✓ %s: preview written to %s\n", filepath.Base(result.FilePath), previewTarget(result))
+		} else if result.Success {
+			successCount++
+			fmt.Fprintf(console, "  ✓ %s -> %s\n", filepath.Base(result.FilePath), strings.Join(result.OutputFiles, ", "))
+			if result.Delivery != nil {
+				fmt.Fprintf(console, "    Delivered to %s (batch ID: %s)\n", result.Delivery.Target, result.Delivery.BatchID)
+			}
+			if result.Stats.SuppressedErrors > 0 {
+				fmt.Fprintf(console, "    (%d validation error(s) suppressed by department configuration)\n", result.Stats.SuppressedErrors)
+				if result.Stats.TransactionsRejected == 0 {
+					errorEntries = append(errorEntries, suppressedLogEntries(result)...)
+				}
+			}
+			if result.Stats.DuplicatesDropped > 0 {
+				fmt.Fprintf(console, "    (%d duplicate row(s) dropped)\n", result.Stats.DuplicatesDropped)
+			}
+			if result.Stats.TransactionsRejected > 0 {
+				errorEntries = append(errorEntries, validationLogEntries(result)...)
+				fmt.Fprintf(console, "    %d transaction(s) accepted, %d rejected (%d rows)\n",
+					result.Stats.TransactionsCreated, result.Stats.TransactionsRejected, result.Stats.RowsRejected)
+				for _, file := range result.RejectedFiles {
+					fmt.Fprintf(console, "    Rejected transactions written to: %s\n", file)
+				}
+			}
+			if result.ReviewFile != "" {
+				fmt.Fprintf(console, "    Annotated review file: %s\n", result.ReviewFile)
+			}
+			if verbose {
+				printStages(result.Stats)
+			}
 		} else {
 			errorCount++
-			errors = append(errors, fmt.Sprintf("%s: %v", filepath.Base(result.FilePath), result.Error))
-			fmt.Printf("  ✗ %s: %v\n", filepath.Base(result.FilePath), result.Error)
+			errorEntries = append(errorEntries, errorLogEntries(result)...)
+			fmt.Fprintf(console, "  ✗ %s: %v\n", filepath.Base(result.FilePath), result.Error)
+			if result.AbortRun {
+				abortedBy = filepath.Base(result.FilePath)
+				fmt.Fprintln(console, "    Aborting the run (failure_policy: abort-run)")
+			}
+			if result.FixupFile != "" {
+				fmt.Fprintf(console, "    Failing rows exported for correction: %s\n", result.FixupFile)
+			}
+			if result.ReviewFile != "" {
+				fmt.Fprintf(console, "    Annotated review file: %s\n", result.ReviewFile)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if summary.TotalFiles == 0 {
+		return releaseWithoutInput(run, sched, deptConfigs)
+	}
+
+	// Release held output files, including the ones just converted.
+	if sched != nil {
+		fmt.Fprintln(console, "Releasing held output files...")
+		printRelease(console, releaseHeldOutputs(sched, mainConfig, deptConfigs, true))
+	}
+
+	// Write the summary and error logs to the output directory. Pre-checks
+	// and previews do not write anything.
+	var summaryPath, errorLogPath string
+	if !readOnlyRun() {
+		summary.EndTime = time.Now()
+		summaryPath, err = utils.WriteSummaryLog(*summary, mainConfig.OutputDir)
+		if err != nil {
+			fmt.Fprintf(console, "  ! %v\n", err)
 		}
+		errorLogPath, err = utils.WriteErrorLog(errorEntries, mainConfig.OutputDir)
+		if err != nil {
+			fmt.Fprintf(console, "  ! %v\n", err)
+		}
+	}
+
+	// Upload results to object storage and remove archived remote inputs.
+	finishErr := run.finish()
+	if finishErr != nil {
+		errorCount++
+		fmt.Fprintf(console, "  ✗ Failed to transfer files to object storage: %v\n", finishErr)
 	}
 
 	// =========================================================================
@@ -291,19 +619,214 @@ func runProcess() error {
 	// =========================================================================
 
 	elapsed := time.Since(startTime)
-	fmt.Println("\n=== Processing Complete ===")
-	fmt.Printf("Total files:     %d\n", len(inputFiles))
-	fmt.Printf("Successful:      %d\n", successCount)
-	fmt.Printf("Errors:          %d\n", errorCount)
-	fmt.Printf("Time elapsed:    %s\n", elapsed)
+	fmt.Fprintln(console, "\n=== Processing Complete ===")
+	fmt.Fprintf(console, "Total files:     %d\n", summary.TotalFiles)
+	fmt.Fprintf(console, "Successful:      %d\n", successCount)
+	if skippedCount > 0 {
+		fmt.Fprintf(console, "Skipped:         %d\n", skippedCount)
+	}
+	fmt.Fprintf(console, "Errors:          %d\n", errorCount)
+	if summary.RejectedTransactions > 0 {
+		fmt.Fprintf(console, "Transactions:    %d accepted, %d rejected\n", summary.TotalTransactions, summary.RejectedTransactions)
+	}
+	if len(summary.SchemaDrifts) > 0 {
+		fmt.Fprintf(console, "Schema drift:    %d file(s) with changed headers (see the summary)\n", len(summary.SchemaDrifts))
+	}
+	fmt.Fprintf(console, "Time elapsed:    %s\n", elapsed)
 
-	// If there were errors, write them to an error log.
-	if errorCount > 0 {
-		// PSEUDOCODE:
-		// writeErrorLog(mainConfig.OutputDir, errors)
-		fmt.Println("\nErrors have been logged to the output directory.")
+	if summaryPath != "" {
+		fmt.Fprintf(console, "Summary:         %s\n", summaryPath)
+	}
+	if errorLogPath != "" {
+		fmt.Fprintf(console, "\nErrors have been logged to: %s\n", errorLogPath)
 	}
 
+	if abortedBy != "" {
+		return &exitError{exitAborted, fmt.Errorf("run aborted after %s failed; files that were not started are left in the input directory", abortedBy)}
+	}
+	if finishErr != nil {
+		return &exitError{exitPartialFailure, fmt.Errorf("failed to transfer files to object storage: %w", finishErr)}
+	}
+	return nil
+}
+
+// describeErrorGroup describes a group of identical validation errors on
+// one line: the error itself if it occurred once.
+func describeErrorGroup(group *validation.ErrorGroup) string {
+	ve := group.First
+	if group.Count == 1 {
+		return ve.Error()
+	}
+	return fmt.Sprintf("[%s] %s Field '%s': %s (%d times, e.g. rows %s)",
+		strings.ToUpper(ve.Severity), ve.Code, ve.Field, ve.Message, group.Count, utils.JoinInts(group.SampleRows))
+}
+
+// errorLogEntries returns the error log entries of a failed file: the
+// error that failed it, followed by its validation errors.
+func errorLogEntries(result converter.Result) []utils.ErrorLogEntry {
+	now := time.Now()
+	fileName := filepath.Base(result.FilePath)
+
+	errorType := "processing"
+	if errors.Is(result.Error, converter.ErrValidationFailed) {
+		errorType = "validation"
+	}
+	entries := []utils.ErrorLogEntry{{
+		Timestamp:    now,
+		FileName:     fileName,
+		ErrorType:    errorType,
+		ErrorMessage: result.Error.Error(),
+	}}
+
+	return append(entries, validationLogEntries(result)...)
+}
+
+// validationLogEntries returns the error log entries of a file's validation
+// errors: those that failed it, or those of its rejected transactions,
+// followed by its suppressed errors.
+func validationLogEntries(result converter.Result) []utils.ErrorLogEntry {
+	now := time.Now()
+	fileName := filepath.Base(result.FilePath)
+
+	var entries []utils.ErrorLogEntry
+	if result.Validation != nil {
+		// Identical errors are written once, with a count and sample rows.
+		for _, group := range validation.GroupErrors(result.Validation.Errors, converter.ErrorSampleRows) {
+			ve := group.First
+			if group.Count > 1 {
+				entries = append(entries, utils.ErrorLogEntry{
+					Timestamp:    now,
+					FileName:     fileName,
+					ErrorType:    ve.Code,
+					ErrorMessage: ve.Message,
+					FieldName:    ve.Field,
+					Count:        group.Count,
+					SampleRows:   group.SampleRows,
+				})
+				continue
+			}
+			entries = append(entries, utils.ErrorLogEntry{
+				Timestamp:     now,
+				FileName:      fileName,
+				ErrorType:     ve.Code,
+				ErrorMessage:  ve.Message,
+				RowNumber:     ve.RowNumber,
+				FieldName:     ve.Field,
+				FieldValue:    ve.Value,
+				TransactionID: ve.TransactionID,
+				LineItemID:    ve.LineItemID,
+			})
+		}
+
+		// Errors over the department's error_limits are only counted.
+		for _, coalesced := range result.Validation.Coalesced {
+			entries = append(entries, utils.ErrorLogEntry{
+				Timestamp:    now,
+				FileName:     fileName,
+				ErrorType:    coalesced.Code,
+				ErrorMessage: fmt.Sprintf("...and %d more like this", coalesced.Count),
+				FieldName:    coalesced.Field,
+			})
+		}
+		if result.Validation.Truncated {
+			entries = append(entries, utils.ErrorLogEntry{
+				Timestamp:    now,
+				FileName:     fileName,
+				ErrorType:    "validation",
+				ErrorMessage: "Validation stopped early (error_limits: max_errors); later rows were not validated",
+			})
+		}
+	}
+
+	return append(entries, suppressedLogEntries(result)...)
+}
+
+// suppressedLogEntries returns the error log entries of a file's validation
+// errors that were suppressed by the department configuration, each with
+// its justification.
+func suppressedLogEntries(result converter.Result) []utils.ErrorLogEntry {
+	if result.Validation == nil {
+		return nil
+	}
+
+	now := time.Now()
+	fileName := filepath.Base(result.FilePath)
+
+	var entries []utils.ErrorLogEntry
+	for _, ve := range result.Validation.Suppressed {
+		entries = append(entries, utils.ErrorLogEntry{
+			Timestamp:     now,
+			FileName:      fileName,
+			ErrorType:     ve.Code,
+			ErrorMessage:  ve.Message,
+			RowNumber:     ve.RowNumber,
+			FieldName:     ve.Field,
+			FieldValue:    ve.Value,
+			TransactionID: ve.TransactionID,
+			LineItemID:    ve.LineItemID,
+			Justification: ve.Justification,
+		})
+	}
+	return entries
+}
+
+// finishProcess completes the run summary, prints it with --output json,
+// and returns the error that sets the exit code.
+//
+// PARAMETERS:
+//   - summary: The run summary.
+//   - err: The error returned by runProcess, or nil.
+//
+// RETURNS:
+//   - nil if the run succeeded, or an error carrying the exit code.
+func finishProcess(summary *utils.ProcessingSummary, err error) error {
+	summary.EndTime = time.Now()
+
+	code := 0
+	var exit *exitError
+	switch {
+	case errors.As(err, &exit):
+		code = exit.code
+	case err != nil:
+		code = exitFailure
+	default:
+		for _, failed := range summary.FailedFilesList {
+			if failed.ErrorType != "validation" {
+				code = exitPartialFailure
+				break
+			}
+			code = exitValidationFailed
+		}
+	}
+
+	summary.ExitCode = code
+	if summary.ProcessedFiles == nil {
+		summary.ProcessedFiles = []utils.ProcessedFileInfo{}
+	}
+	if summary.FailedFilesList == nil {
+		summary.FailedFilesList = []utils.FailedFileInfo{}
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+
+	if outputFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(summary); encodeErr != nil && err == nil {
+			err = fmt.Errorf("failed to write summary: %w", encodeErr)
+		}
+	}
+
+	switch {
+	case err != nil:
+		if exit == nil {
+			return &exitError{code, err}
+		}
+		return err
+	case code != 0:
+		return &exitError{code, fmt.Errorf("%d of %d file(s) failed", summary.FailedFiles, summary.TotalFiles)}
+	}
 	return nil
 }
 
@@ -311,80 +834,141 @@ func runProcess() error {
 // HELPER FUNCTIONS
 // =============================================================================
 
-// discoverInputFiles scans the input directory for CSV files.
+// readyFiles returns the files that are completely written.
 //
 // PARAMETERS:
-//   - inputDir: The path to the input directory.
+//   - files: The discovered input files.
+//   - mainConfig: The main application configuration.
 //
 // RETURNS:
-//   - A slice of file paths to CSV files.
-//   - An error if the directory cannot be read.
+//   - The files that are ready for processing.
 //
-// CUSTOMIZATION:
-//   - Modify the file extension filter if your input files have a different extension.
-//   - Add additional filtering logic if needed (e.g., by date, by size).
-func discoverInputFiles(inputDir string) ([]string, error) {
-	var files []string
-
-	// Walk the input directory and find all CSV files.
-	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip directories.
-		if info.IsDir() {
-			return nil
+// BEHAVIOR:
+//   A batch run checks each file once and waits only for the settle time
+//   (the shorter of batchSettleTime and the stability period): files
+//   modified less than the stability period ago, changed within the settle
+//   time, or still locked, are skipped and picked up by the next run.
+func readyFiles(files []string, mainConfig *config.MainConfig) []string {
+	options := readinessOptions(mainConfig)
+	options.SingleScan = true
+	options.SettleTime = min(batchSettleTime, options.StableFor)
+	ready, waiting := utils.NewReadinessChecker(options).Check(files)
+
+	for _, file := range files {
+		if reason, ok := waiting[file]; ok {
+			fmt.Fprintf(console, "  - Skipping %s: %s\n", filepath.Base(file), reason)
 		}
+	}
 
-		// Check if the file has a .csv extension.
-		// CUSTOMIZATION: Modify this if your files have a different extension.
-		if filepath.Ext(path) == ".csv" {
-			files = append(files, path)
-		}
+	return ready
+}
 
-		return nil
-	})
+// batchSettleTime is how long a batch run watches the input files for
+// changes (see utils.ReadinessOptions.SettleTime). Tests shorten it.
+var batchSettleTime = 2 * time.Second
 
-	return files, err
+// readinessOptions converts the file readiness configuration.
+func readinessOptions(mainConfig *config.MainConfig) utils.ReadinessOptions {
+	options := utils.ReadinessOptions{
+		StableFor:  mainConfig.FileReadiness.StabilityPeriod(),
+		ProbeLocks: mainConfig.FileReadiness.LockProbing(),
+	}
+	if mainConfig.FileReadiness.DoneMarker {
+		options.DoneMarkerSuffix = mainConfig.FileReadiness.DoneMarkerSuffix
+	}
+	return options
 }
 
-// findMatchingDepartment finds the department configuration that matches the given file.
+// recordAudit appends the outcome of a file to the audit trail, and the
+// transaction keys of a converted file to the trail's key index.
 //
 // PARAMETERS:
-//   - filePath: The path to the input file.
-//   - deptConfigs: A map of department configurations.
+//   - trail: The audit trail.
+//   - result: The conversion result.
 //
 // RETURNS:
-//   - The matching department configuration, or nil if no match is found.
-//
-// MATCHING LOGIC:
-//   This function iterates through all department configurations and checks
-//   if the file name matches any of the file matching patterns defined in
-//   the department configuration.
-//
-// CUSTOMIZATION:
-//   - Modify the matching logic if your file naming conventions are different.
-//   - Add additional matching criteria (e.g., by file content, by header row).
-func findMatchingDepartment(filePath string, deptConfigs map[string]*config.DepartmentConfig) *config.DepartmentConfig {
-	fileName := filepath.Base(filePath)
-
-	// Iterate through all department configurations.
-	for _, deptConfig := range deptConfigs {
-		// Check if the file name matches any of the file matching patterns.
-		for _, pattern := range deptConfig.FileMatchingPatterns {
-			// Use filepath.Match for glob-style pattern matching.
-			matched, err := filepath.Match(pattern, fileName)
-			if err != nil {
-				// Invalid pattern, skip it.
-				continue
-			}
-			if matched {
-				return deptConfig
-			}
+//   - An error if the entry cannot be written.
+func recordAudit(trail *audit.Trail, result converter.Result) error {
+	entry := audit.Entry{
+		Event:           audit.EventConverted,
+		File:            result.FilePath,
+		Department:      result.Department,
+		OutputFile:      result.OutputFile,
+		Rows:            result.Stats.RowsProcessed,
+		Transactions:    result.Stats.TransactionsCreated,
+		Template:        result.Template,
+		TemplateVersion: result.TemplateVersion,
+		BytesIn:         result.Stats.BytesIn,
+		BytesOut:        result.Stats.BytesOut,
+		DurationMS:      result.Stats.ProcessingTime.Milliseconds(),
+
+		RejectedTransactions: result.Stats.TransactionsRejected,
+		RejectedFiles:        result.RejectedFiles,
+		ReviewFile:           result.ReviewFile,
+	}
+	if len(result.OutputFiles) > 1 {
+		entry.OutputFiles = result.OutputFiles
+	}
+
+	for _, stage := range result.Stats.Stages.List() {
+		if entry.StagesMS == nil {
+			entry.StagesMS = make(map[string]float64)
 		}
+		entry.StagesMS[stage.Name] = float64(stage.Duration.Microseconds()) / 1000
 	}
 
-	// No matching department found.
+	switch {
+	case result.Skipped:
+		entry.Event = audit.EventSkipped
+	case !result.Success:
+		entry.Event = audit.EventFailed
+	}
+	if result.Error != nil {
+		entry.Error = result.Error.Error()
+	}
+	if result.Delivery != nil {
+		entry.DeliveryTarget = result.Delivery.Target
+		entry.BatchID = result.Delivery.BatchID
+	}
+
+	if err := trail.Record(entry); err != nil {
+		return err
+	}
+
+	// Index the transaction keys for the duplicate_history_days check.
+	if result.Success {
+		return trail.RecordKeys(result.Department, result.FilePath, result.OutputFile, result.TransactionKeys)
+	}
 	return nil
 }
+
+// printStages prints the time taken by each pipeline stage and the input
+// and output sizes (verbose mode).
+func printStages(stats converter.ProcessingStats) {
+	fmt.Fprintf(console, "    %d bytes in, %d bytes out, %v total\n", stats.BytesIn, stats.BytesOut, stats.ProcessingTime.Round(time.Millisecond))
+	for _, stage := range stats.Stages.List() {
+		share := 0.0
+		if stats.ProcessingTime > 0 {
+			share = 100 * float64(stage.Duration) / float64(stats.ProcessingTime)
+		}
+		fmt.Fprintf(console, "      %-15s %10v %5.1f%%\n", stage.Name, stage.Duration.Round(time.Microsecond), share)
+	}
+}
+
+// acquireRunLock takes the run-level lock on the input directory.
+//
+// PARAMETERS:
+//   - mainConfig: The main application configuration.
+//
+// RETURNS:
+//   - The held lock, or nil if locking is disabled.
+//   - An error wrapping utils.ErrLocked if another run holds the lock.
+func acquireRunLock(mainConfig *config.MainConfig) (*utils.FileLock, error) {
+	if mainConfig.DisableLocking {
+		return nil, nil
+	}
+
+	lockPath := filepath.Join(mainConfig.InputDir, runLockFile)
+	return utils.AcquireLock(lockPath, mainConfig.LockStaleAfter)
+}
+
@@ -0,0 +1,403 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+)
+
+// update rewrites the golden files in testdata/golden with the current
+// output: go test ./cmd -run TestProcess -update
+var update = flag.Bool("update", false, "update the golden files")
+
+// testMainConfig is the main configuration of a test tree. The paths are
+// relative to the tree, the test's working directory. The output file is
+// named after the input, so it can be compared with a golden file.
+const testMainConfig = `input_dir: ./input
+output_dir: ./output
+input_archive_dir: ./input_archive
+output_archive_dir: ./output_archive
+templates_dir: ./templates
+configs_dir: ./configs
+state_dir: ./state
+uuid_format: "{dept}_{original}.xml"
+`
+
+// testDepartmentConfig is the claims department of a test tree.
+const testDepartmentConfig = `department_name: Claims
+department_code: CLAIMS
+file_matching_patterns: ["claims_*.csv"]
+template_mapping:
+  - if_filename_contains: payments
+    use_template: payments.xlsx
+transaction_grouping:
+  group_by_field: CHECK_NUM
+static_fields:
+  - xml_tag: SourceSystem
+    value: LEGACY
+`
+
+// testPaymentsCSV converts to testdata/golden/CLAIMS_claims_payments.xml.
+const testPaymentsCSV = `CHECK_NUM,CHECK_AMT,POLICY_NO,INVOICE_NO,PAYEE_NAME
+1001,100.00,P1,INV1,Alice
+1001,100.00,P2,INV2,Alice
+1002,50.50,P3,,Bob
+`
+
+// testPaymentsSchema is the payments.xlsx template of a test tree.
+func testPaymentsSchema() *xlsxparser.Schema {
+	fields := []*xlsxparser.FieldMapping{
+		{OldHeader: "CHECK_NUM", XMLTag: "CheckNumber", ParentTag: "transaction", DataType: "numeric", MaxLength: 10, RequiredType: "required", Order: 1},
+		{OldHeader: "CHECK_AMT", XMLTag: "CheckAmount", ParentTag: "transaction", DataType: "decimal(2)", MaxLength: 15, RequiredType: "required", Order: 2},
+		{OldHeader: "POLICY_NO", XMLTag: "PolicyNumber", ParentTag: "lineItem", DataType: "alphanumeric", MaxLength: 12, RequiredType: "required", Order: 3},
+		{OldHeader: "INVOICE_NO", XMLTag: "InvoiceNumber", ParentTag: "lineItem", DataType: "string", MaxLength: 20, RequiredType: "optional", Order: 4},
+		{OldHeader: "PAYEE_NAME", XMLTag: "PayeeName", ParentTag: "lineItem", DataType: "string", MaxLength: 10, RequiredType: "optional", Order: 5},
+	}
+	schema := &xlsxparser.Schema{FieldMappings: make(map[string]*xlsxparser.FieldMapping)}
+	for _, field := range fields {
+		schema.FieldMappings[field.OldHeader] = field
+		if field.ParentTag == "transaction" {
+			schema.TransactionFields = append(schema.TransactionFields, field.OldHeader)
+		} else {
+			schema.LineItemFields = append(schema.LineItemFields, field.OldHeader)
+		}
+	}
+	return schema
+}
+
+// testTree is a temporary installation: configuration, template, and the
+// input, output, and archive directories.
+type testTree struct {
+	t   *testing.T
+	dir string
+}
+
+// newTestTree creates a test tree, makes it the working directory, and
+// points --config at it. The process flags are reset afterwards.
+func newTestTree(t *testing.T) *testTree {
+	t.Helper()
+	tree := &testTree{t: t, dir: t.TempDir()}
+
+	for _, dir := range []string{"input", "output", "input_archive", "output_archive", "templates", "configs"} {
+		if err := os.MkdirAll(filepath.Join(tree.dir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree.write("config.yaml", testMainConfig)
+	tree.write("configs/claims.yaml", testDepartmentConfig)
+
+	var template bytes.Buffer
+	if err := xlsxparser.Write(&template, testPaymentsSchema()); err != nil {
+		t.Fatal(err)
+	}
+	tree.write("templates/payments.xlsx", template.String())
+
+	t.Chdir(tree.dir)
+	savedConfig, savedConsole, savedSettle := cfgFile, console, batchSettleTime
+	cfgFile, console, batchSettleTime = "config.yaml", &bytes.Buffer{}, 10*time.Millisecond
+	t.Cleanup(func() { cfgFile, console, batchSettleTime = savedConfig, savedConsole, savedSettle })
+
+	return tree
+}
+
+// write writes a file of the tree. Input files are dated an hour back, like
+// files that finished copying a while ago, so they pass the readiness check.
+func (tree *testTree) write(name, content string) {
+	tree.t.Helper()
+	path := filepath.Join(tree.dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		tree.t.Fatal(err)
+	}
+	if strings.HasPrefix(name, "input/") {
+		past := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(path, past, past); err != nil {
+			tree.t.Fatal(err)
+		}
+	}
+}
+
+// files lists the files of a directory of the tree.
+func (tree *testTree) files(dir string) []string {
+	tree.t.Helper()
+	entries, err := os.ReadDir(filepath.Join(tree.dir, dir))
+	if err != nil {
+		tree.t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// find returns the file of a directory of the tree whose name starts with
+// prefix, or fails the test.
+func (tree *testTree) find(dir, prefix string) string {
+	tree.t.Helper()
+	for _, name := range tree.files(dir) {
+		if strings.HasPrefix(name, prefix) {
+			return filepath.Join(tree.dir, dir, name)
+		}
+	}
+	tree.t.Fatalf("no %s* in %s: %v", prefix, dir, tree.files(dir))
+	return ""
+}
+
+// process runs the process command in the tree.
+//
+// RETURNS:
+//   - The run summary.
+//   - The exit code of the run.
+//   - The error of the run, or nil.
+func (tree *testTree) process() (utils.ProcessingSummary, int, error) {
+	summary := utils.ProcessingSummary{StartTime: time.Now()}
+	err := finishProcess(&summary, runProcess(&summary))
+
+	var exit *exitError
+	if errors.As(err, &exit) && exit.code != summary.ExitCode {
+		tree.t.Errorf("exit code %d, summary exit code %d", exit.code, summary.ExitCode)
+	}
+	return summary, summary.ExitCode, err
+}
+
+// assertGolden compares a file with its golden file in testdata/golden.
+func assertGolden(t *testing.T, path string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test runs in the tree: testdata is next to the test source.
+	golden := filepath.Join(sourceDir, "testdata", "golden", filepath.Base(path))
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from %s:\n--- got:\n%s\n--- want:\n%s", filepath.Base(path), golden, got, want)
+	}
+}
+
+// sourceDir is the directory of the test source, the working directory
+// before a test tree is entered.
+var sourceDir, _ = os.Getwd()
+
+func TestProcessConvertsFile(t *testing.T) {
+	tree := newTestTree(t)
+	tree.write("input/claims_payments.csv", testPaymentsCSV)
+
+	summary, code, err := tree.process()
+	if err != nil || code != 0 {
+		t.Fatalf("process = exit code %d, %v; want success", code, err)
+	}
+
+	// The XML matches the golden file, and a copy is archived.
+	output := tree.find("output", "CLAIMS_claims_payments.xml")
+	assertGolden(t, output)
+	tree.find("output_archive", "CLAIMS_claims_payments.xml")
+
+	// The input is archived.
+	if files := tree.files("input"); len(files) != 0 {
+		t.Errorf("input not archived: %v", files)
+	}
+	tree.find("input_archive", "claims_payments")
+
+	// The summary counts the file, and is written to the output directory.
+	if summary.TotalFiles != 1 || summary.SuccessfulFiles != 1 || summary.FailedFiles != 0 {
+		t.Errorf("summary files = %d total, %d successful, %d failed; want 1, 1, 0",
+			summary.TotalFiles, summary.SuccessfulFiles, summary.FailedFiles)
+	}
+	if summary.TotalRows != 3 || summary.TotalTransactions != 2 || summary.TotalLineItems != 3 {
+		t.Errorf("summary = %d rows, %d transactions, %d line items; want 3, 2, 3",
+			summary.TotalRows, summary.TotalTransactions, summary.TotalLineItems)
+	}
+	if len(summary.ProcessedFiles) != 1 || filepath.Base(summary.ProcessedFiles[0].OutputFile) != "CLAIMS_claims_payments.xml" {
+		t.Errorf("summary processed files = %+v", summary.ProcessedFiles)
+	}
+	text, err := os.ReadFile(tree.find("output", "processing_summary_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Successful:         1", "CLAIMS_claims_payments.xml"} {
+		if !strings.Contains(string(text), want) {
+			t.Errorf("summary file does not contain %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestProcessValidationFailure(t *testing.T) {
+	tree := newTestTree(t)
+	tree.write("input/claims_payments.csv", strings.Replace(testPaymentsCSV, "Bob", "Bob Bobberson Jr", 1))
+
+	summary, code, err := tree.process()
+	if code != exitValidationFailed || err == nil {
+		t.Fatalf("process = exit code %d, %v; want %d", code, err, exitValidationFailed)
+	}
+
+	// No XML is written, and the input stays for a corrected run.
+	for _, name := range tree.files("output") {
+		if strings.HasSuffix(name, ".xml") {
+			t.Errorf("output written for a failed file: %s", name)
+		}
+	}
+	if files := tree.files("input"); len(files) != 1 || files[0] != "claims_payments.csv" {
+		t.Errorf("input files = %v, want the failed file", files)
+	}
+	if files := tree.files("input_archive"); len(files) != 0 {
+		t.Errorf("failed file archived: %v", files)
+	}
+
+	// The failure is in the summary and the error log.
+	if summary.FailedFiles != 1 || len(summary.FailedFilesList) != 1 || summary.FailedFilesList[0].ErrorType != "validation" {
+		t.Fatalf("summary failed files = %+v, want one validation failure", summary.FailedFilesList)
+	}
+	if summary.ValidationErrors != 1 {
+		t.Errorf("summary validation errors = %d, want 1", summary.ValidationErrors)
+	}
+	errorLog, err := os.ReadFile(tree.find("output", "error_log_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(errorLog), "PAYEE_NAME") {
+		t.Errorf("error log does not name the field:\n%s", errorLog)
+	}
+}
+
+func TestProcessSuppressedErrors(t *testing.T) {
+	tree := newTestTree(t)
+	tree.write("configs/claims.yaml", testDepartmentConfig+`validation_suppressions:
+  - code: VAL-LEN-001
+    field: PAYEE_NAME
+    justification: Payee names are truncated by the bank (ticket 4711)
+`)
+	tree.write("input/claims_payments.csv", strings.Replace(testPaymentsCSV, "Bob", "Bob Bobberson Jr", 1))
+
+	summary, code, err := tree.process()
+	if err != nil || code != 0 {
+		t.Fatalf("process = exit code %d, %v; want success", code, err)
+	}
+
+	// The suppressed error and its justification are in the summary and
+	// the error log, which does not count it as an error.
+	const justification = "Payee names are truncated by the bank (ticket 4711)"
+	if len(summary.ProcessedFiles) != 1 || !strings.Contains(summary.ProcessedFiles[0].SuppressedErrors, justification) {
+		t.Errorf("summary processed files = %+v, want the suppressed error", summary.ProcessedFiles)
+	}
+	text, err := os.ReadFile(tree.find("output", "processing_summary_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "Justification: "+justification) {
+		t.Errorf("summary file does not contain the justification:\n%s", text)
+	}
+	errorLog, err := os.ReadFile(tree.find("output", "error_log_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Total Errors: 0", "Suppressed Errors: 1", "PAYEE_NAME", "Suppressed:     " + justification} {
+		if !strings.Contains(string(errorLog), want) {
+			t.Errorf("error log does not contain %q:\n%s", want, errorLog)
+		}
+	}
+}
+
+func TestProcessSkipsGrowingFile(t *testing.T) {
+	tree := newTestTree(t)
+	tree.write("input/claims_payments.csv", testPaymentsCSV)
+	batchSettleTime = 200 * time.Millisecond
+
+	// The copy keeps the original, hour-old modification time while the
+	// file grows.
+	path := filepath.Join(tree.dir, "input", "claims_payments.csv")
+	past := time.Now().Add(-time.Hour)
+	done := make(chan struct{})
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			file.WriteString("1003,10.00,P4,INV4,Carol\n")
+			file.Close()
+			os.Chtimes(path, past, past)
+		}
+	}()
+
+	summary, code, err := tree.process()
+	close(done)
+	<-copied
+	if err != nil || code != 0 {
+		t.Fatalf("process = exit code %d, %v; want success", code, err)
+	}
+	if summary.TotalFiles != 0 {
+		t.Errorf("processed %d files, want the growing file skipped", summary.TotalFiles)
+	}
+	if files := tree.files("input"); len(files) != 1 {
+		t.Errorf("input files = %v, want the file left for the next run", files)
+	}
+	if output := console.(*bytes.Buffer).String(); !strings.Contains(output, "still changing") {
+		t.Errorf("console does not report the skipped file:\n%s", output)
+	}
+}
+
+func TestProcessConfigError(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(tree *testTree)
+	}{
+		{
+			name:  "invalid main config",
+			setup: func(tree *testTree) { tree.write("config.yaml", "input_dir: [\n") },
+		},
+		{
+			name:  "missing main config",
+			setup: func(tree *testTree) { os.Remove(filepath.Join(tree.dir, "config.yaml")) },
+		},
+		{
+			name:  "invalid department config",
+			setup: func(tree *testTree) { tree.write("configs/claims.yaml", "department_code: [\n") },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t)
+			tree.write("input/claims_payments.csv", testPaymentsCSV)
+			tt.setup(tree)
+
+			summary, code, err := tree.process()
+			if code != exitConfigError || err == nil {
+				t.Fatalf("process = exit code %d, %v; want %d", code, err, exitConfigError)
+			}
+			if summary.Error == "" || summary.TotalFiles != 0 {
+				t.Errorf("summary = %q error, %d files; want the error and no files", summary.Error, summary.TotalFiles)
+			}
+			if files := tree.files("input"); len(files) != 1 {
+				t.Errorf("input files = %v, want the file untouched", files)
+			}
+		})
+	}
+}
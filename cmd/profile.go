@@ -0,0 +1,225 @@
+// =============================================================================
+// CSV to XML Converter - Profile Command
+// =============================================================================
+//
+// This file defines the 'profile' command, which prints statistics of each
+// column of a CSV file: empty rates, distinct counts, value lengths, the
+// most frequent values and value shapes, and date format guesses. It is
+// used when onboarding a new department, to build its template from the
+// data.
+//
+// COMMAND USAGE:
+//   converter profile <file.csv> [--department CODE] [--delimiter D] [--header-rows N] [--top N] [--json]
+//
+// FLAGS:
+//   --department  : Read the file with this department's csv_settings
+//   --delimiter   : The field delimiter (default: ",")
+//   --header-rows : The number of header rows (default: 1)
+//   --encoding    : The character encoding (default: UTF-8)
+//   --top         : The number of values and patterns listed per column (default: 5)
+//   --json        : Print the profile as JSON
+//
+// No configuration is needed unless --department is given: the department
+// usually does not exist yet. Nothing is written.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/csvparser"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+var (
+	// profileDepartment is the department whose CSV settings are used.
+	profileDepartment string
+
+	// profileDelimiter, profileHeaderRows, and profileEncoding are the CSV
+	// settings used without a department.
+	profileDelimiter  string
+	profileHeaderRows int
+	profileEncoding   string
+
+	// profileTop is the number of values and patterns listed per column.
+	profileTop int
+
+	// profileJSON prints the profile as JSON.
+	profileJSON bool
+)
+
+// =============================================================================
+// PROFILE COMMAND DEFINITION
+// =============================================================================
+
+// profileCmd represents the 'profile' command.
+var profileCmd = &cobra.Command{
+	Use:   "profile <file.csv>",
+	Short: "Print per-column statistics of a CSV file",
+	Long: `Prints statistics of each column of a CSV file, to build the template of a new
+department from its data:
+
+  - the number of values, empty values, and the null rate
+  - the number of distinct values
+  - the shortest and longest value (a starting point for Char Limit)
+  - the most frequent values, and value patterns ("A" for a letter, "9" for
+    a digit: "POL-00123" is "AAA-99999")
+  - the date formats every value parses with, as template date layouts
+  - a suggested template Data Type
+
+Without --department the file is read as comma-separated with one header
+row, unless --delimiter, --header-rows, or --encoding say otherwise.
+
+Examples:
+  converter profile samples/payables_export.csv
+  converter profile --delimiter "|" --top 10 samples/payables_export.txt
+  converter profile --department CLAIMS --json input/claims_payments.csv`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runProfile(args[0])
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the profile command with the root command and sets up flags.
+func init() {
+	rootCmd.AddCommand(profileCmd)
+
+	profileCmd.Flags().StringVar(
+		&profileDepartment,
+		"department",
+		"",
+		"Read the file with this department's csv_settings",
+	)
+
+	profileCmd.Flags().StringVar(
+		&profileDelimiter,
+		"delimiter",
+		",",
+		"Field delimiter, without --department",
+	)
+
+	profileCmd.Flags().IntVar(
+		&profileHeaderRows,
+		"header-rows",
+		1,
+		"Number of header rows, without --department",
+	)
+
+	profileCmd.Flags().StringVar(
+		&profileEncoding,
+		"encoding",
+		"UTF-8",
+		"Character encoding, without --department",
+	)
+
+	profileCmd.Flags().IntVar(
+		&profileTop,
+		"top",
+		5,
+		"Number of values and patterns listed per column",
+	)
+
+	profileCmd.Flags().BoolVar(
+		&profileJSON,
+		"json",
+		false,
+		"Print the profile as JSON",
+	)
+}
+
+// =============================================================================
+// PROFILE FUNCTION
+// =============================================================================
+
+// runProfile prints the profile of a CSV file.
+//
+// PARAMETERS:
+//   - file: The CSV file.
+//
+// RETURNS:
+//   - An error if the configuration or the file cannot be read.
+func runProfile(file string) error {
+	settings := config.CSVSettings{
+		Delimiter:    profileDelimiter,
+		HeaderRows:   profileHeaderRows,
+		DataStartRow: profileHeaderRows + 1,
+		Encoding:     profileEncoding,
+		QuoteChar:    "\"",
+		EscapeChar:   "\"",
+	}
+	if settings.Delimiter == `\t` {
+		settings.Delimiter = "\t"
+	}
+
+	if profileDepartment != "" {
+		_, deptConfigs, err := loadListConfig()
+		if err != nil {
+			return err
+		}
+		deptConfig := deptConfigs[profileDepartment]
+		if deptConfig == nil {
+			return &exitError{exitConfigError, fmt.Errorf("unknown department: %s", profileDepartment)}
+		}
+		settings = deptConfig.CSVSettings
+	}
+
+	data, err := csvparser.Parse(file, settings)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	profile := csvparser.ProfileData(data, csvparser.ProfileOptions{TopValues: profileTop})
+	if profileJSON {
+		return printListJSON(profile)
+	}
+
+	fmt.Printf("File: %s\n", file)
+	fmt.Printf("Rows: %d, columns: %d\n", profile.Rows, len(profile.Columns))
+
+	for _, column := range profile.Columns {
+		fmt.Printf("\n%s\n", column.Name)
+
+		distinct := fmt.Sprintf("%d", column.Distinct)
+		if column.DistinctCapped {
+			distinct = "at least " + distinct
+		}
+		fmt.Printf("  Values:      %d (%d empty, %.1f%% null), %s distinct\n",
+			column.Values, column.Empty, 100*column.NullRate, distinct)
+		if column.Values == 0 {
+			continue
+		}
+
+		fmt.Printf("  Length:      %d-%d\n", column.MinLength, column.MaxLength)
+		fmt.Printf("  Top values:  %s\n", formatValueCounts(column.TopValues, column.Values))
+		fmt.Printf("  Patterns:    %s\n", formatValueCounts(column.Patterns, column.Values))
+		if len(column.DateFormats) > 0 {
+			fmt.Printf("  Date format: %s\n", strings.Join(column.DateFormats, " or "))
+		}
+		fmt.Printf("  Suggested:   Data Type %s, Char Limit %d\n", column.SuggestedType, column.MaxLength)
+	}
+	return nil
+}
+
+// formatValueCounts formats the most frequent values of a column on one
+// line, with their share of the column's values.
+func formatValueCounts(counts []csvparser.ValueCount, values int) string {
+	parts := make([]string, len(counts))
+	for i, count := range counts {
+		parts[i] = fmt.Sprintf("%q %d (%.0f%%)", count.Value, count.Count, 100*float64(count.Count)/float64(values))
+	}
+	return strings.Join(parts, ", ")
+}
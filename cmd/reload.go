@@ -0,0 +1,256 @@
+// =============================================================================
+// CSV to XML Converter - Configuration Reload
+// =============================================================================
+//
+// The watch command runs for weeks at a time, and department configurations
+// and templates change in that time. The changes are picked up without a
+// restart:
+//
+//   1. Every scan compares the size and modification time of the YAML files
+//      in configs_dir and the XLSX files in templates_dir with those of the
+//      version in use.
+//   2. When a file changed, the department configurations are loaded and
+//      validated, and every template they use is parsed.
+//   3. If everything loads, the new version replaces the old one between two
+//      scans, so a scan never mixes old and new. Otherwise the error is
+//      logged and the previous version stays in use until the files change
+//      again.
+//
+// Both outcomes are recorded in the audit trail (config_changed and
+// config_rejected). The main configuration file is not reloaded: changes to
+// it take effect after a restart.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/audit"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+)
+
+// configSet is one loaded version of the department configurations and
+// templates.
+type configSet struct {
+	// departments are the department configurations by code.
+	departments map[string]*config.DepartmentConfig
+
+	// templates are the parsed templates the departments use, by path
+	// (see converter.SetTemplates).
+	templates map[string]*xlsxparser.Schema
+
+	// files are the configuration and template files this version was
+	// loaded from.
+	files map[string]fileStamp
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// configReloader keeps the configuration of a long-running watcher current.
+type configReloader struct {
+	mainConfig *config.MainConfig
+
+	// current is the version in use, or nil before the first load.
+	current *configSet
+
+	// rejected holds the files of the last rejected version, so a rejection
+	// is logged and audited once rather than on every scan.
+	rejected map[string]fileStamp
+}
+
+// newConfigReloader creates a reloader. The configuration is loaded by the
+// first call to load.
+func newConfigReloader(mainConfig *config.MainConfig) *configReloader {
+	return &configReloader{mainConfig: mainConfig}
+}
+
+// load returns the configuration for the next scan, reloading it first if
+// configuration or template files changed.
+//
+// PARAMETERS:
+//   - trail: The audit trail that records applied and rejected changes.
+//   - logger: The logger for reload messages.
+//
+// RETURNS:
+//   - The configuration to use.
+//   - An error if no configuration could be loaded yet. Once one is loaded,
+//     invalid changes are rejected and the previous version is returned.
+func (r *configReloader) load(trail *audit.Trail, logger *logging.Logger) (*configSet, error) {
+	// The files are listed before loading: a file that changes while it is
+	// being loaded is then seen as changed again by the next scan.
+	files, err := configFiles(r.mainConfig)
+	if err != nil {
+		if r.current == nil {
+			return nil, err
+		}
+		logger.Error("Failed to check the configuration for changes: %v", err)
+		return r.current, nil
+	}
+
+	// The first load accepts templates that cannot be parsed: only the
+	// files of the departments using them fail, as they would in a single
+	// run.
+	if r.current == nil {
+		set, problems, err := loadConfigSet(r.mainConfig, files)
+		if err != nil {
+			return nil, err
+		}
+		for _, problem := range problems {
+			logger.Error("%v", problem)
+		}
+		r.current = set
+		return set, nil
+	}
+
+	if sameFiles(files, r.current.files) || (r.rejected != nil && sameFiles(files, r.rejected)) {
+		return r.current, nil
+	}
+
+	changes := describeChanges(r.current.files, files)
+	set, problems, err := loadConfigSet(r.mainConfig, files)
+	if err == nil && len(problems) > 0 {
+		err = errors.Join(problems...)
+	}
+	if err != nil {
+		r.rejected = files
+		logger.Error("Configuration change rejected, still using the previous configuration (%s): %v",
+			strings.Join(changes, ", "), err)
+		if auditErr := trail.Record(audit.Entry{Event: audit.EventConfigRejected, Changes: changes, Error: err.Error()}); auditErr != nil {
+			logger.Error("%v", auditErr)
+		}
+		return r.current, nil
+	}
+
+	r.current = set
+	r.rejected = nil
+	logger.Info("Configuration reloaded: %s", strings.Join(changes, ", "))
+	if auditErr := trail.Record(audit.Entry{Event: audit.EventConfigChanged, Changes: changes}); auditErr != nil {
+		logger.Error("%v", auditErr)
+	}
+	return set, nil
+}
+
+// loadConfigSet loads the department configurations and parses the
+// templates they use.
+//
+// RETURNS:
+//   - The loaded configuration.
+//   - The templates that are missing or cannot be parsed.
+//   - An error if the department configurations cannot be loaded.
+func loadConfigSet(mainConfig *config.MainConfig, files map[string]fileStamp) (*configSet, []error, error) {
+	departments, err := config.LoadDepartmentConfigs(mainConfig.ConfigsDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load department configs: %w", err)
+	}
+
+	set := &configSet{
+		departments: departments,
+		templates:   make(map[string]*xlsxparser.Schema),
+		files:       files,
+	}
+
+	var problems []error
+	for _, code := range converter.DepartmentCodes(departments) {
+		for _, template := range departments[code].Templates() {
+			path := filepath.Join(mainConfig.TemplatesDir, template)
+			if _, ok := set.templates[path]; ok {
+				continue
+			}
+
+			schema, err := xlsxparser.Parse(path)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("template %s of department %s: %w", template, code, err))
+				continue
+			}
+			set.templates[path] = schema
+		}
+	}
+
+	return set, problems, nil
+}
+
+// configFiles returns the department configuration and template files.
+func configFiles(mainConfig *config.MainConfig) (map[string]fileStamp, error) {
+	var paths []string
+	for _, pattern := range []string{
+		filepath.Join(mainConfig.ConfigsDir, "*.yaml"),
+		filepath.Join(mainConfig.ConfigsDir, "*.yml"),
+		filepath.Join(mainConfig.TemplatesDir, "*.xlsx"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", pattern, err)
+		}
+		paths = append(paths, matches...)
+	}
+
+	files := make(map[string]fileStamp, len(paths))
+	for _, path := range paths {
+		// Skip the lock files Excel creates next to open workbooks.
+		if strings.HasPrefix(filepath.Base(path), "~$") {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			// Removed since it was listed.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[path] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+	}
+	return files, nil
+}
+
+// sameFiles reports whether two sets of files are identical.
+func sameFiles(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		other, ok := b[path]
+		if !ok || other.size != stamp.size || !other.modTime.Equal(stamp.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeChanges lists the files added, removed, or modified between two
+// sets of files, e.g. "modified configs/claims.yaml".
+func describeChanges(before, after map[string]fileStamp) []string {
+	var changes []string
+	for path, stamp := range after {
+		old, ok := before[path]
+		switch {
+		case !ok:
+			changes = append(changes, "added "+path)
+		case old.size != stamp.size || !old.modTime.Equal(stamp.modTime):
+			changes = append(changes, "modified "+path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, "removed "+path)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
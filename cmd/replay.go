@@ -0,0 +1,382 @@
+// =============================================================================
+// CSV to XML Converter - Replay Command
+// =============================================================================
+//
+// This file defines the 'replay' command, which converts archived input
+// files again with the current department configurations and templates,
+// writing the XML to a sandbox directory. Analysts can try a rule or
+// template change against real historical data before it goes live.
+//
+// COMMAND USAGE:
+//   converter replay --from-archive [--date YYYY-MM-DD] [--department CODE] [--output-dir DIR]
+//
+// FLAGS:
+//   --from-archive : Replay the files of the input archive directories
+//   --date         : Only replay files archived on this day (default: all)
+//   --department   : Only replay this department's files
+//   --output-dir   : The sandbox directory (default: ./replay/<date>)
+//
+// Each file is converted like a preview (see converter.Preview): nothing is
+// locked, delivered, published, archived, audited, or recorded, and the
+// archive is left as it is. Encrypted archive files are decrypted to a
+// temporary directory first.
+//
+// EXIT CODES:
+//   As for the check command: 0 if every file converted, 2 if files failed
+//   validation, 3 on configuration errors, 4 if files could not be replayed.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/archivecrypt"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+var (
+	// replayFromArchive replays the files of the input archive.
+	replayFromArchive bool
+
+	// replayDate is the day the replayed files were archived.
+	replayDate string
+
+	// replayDepartment limits the replay to a department.
+	replayDepartment string
+
+	// replayOutputDir is the sandbox directory.
+	replayOutputDir string
+)
+
+// =============================================================================
+// REPLAY COMMAND DEFINITION
+// =============================================================================
+
+// replayCmd represents the 'replay' command.
+var replayCmd = &cobra.Command{
+	Use:   "replay --from-archive",
+	Short: "Convert archived inputs again with the current configuration",
+	Long: `Converts archived input files again with the current department
+configurations and templates, and writes the XML to a sandbox directory, so
+a rule or template change can be tried against real historical data.
+
+The files are those of the main and department input archive directories,
+or with --date only those archived that day (by modification time). Files in
+a department's own archive directory are converted with that department;
+the others are matched by file name as the process command would (input
+subdirectories are not kept in the archive). Encrypted archive files are
+decrypted to a temporary directory; masked archive files are converted with
+their masked values.
+
+Each file is written to the sandbox as "<name>.xml" (or the extension of its
+department's output_format), and the errors of files that fail to the
+sandbox's error log. Nothing is delivered, published, archived, audited, or
+recorded, and the archive is left as it is.
+
+Examples:
+  converter replay --from-archive --date 2024-05-01
+  converter replay --from-archive --department CLAIMS --output-dir /tmp/whatif`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runReplay()
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the replay command with the root command and sets up flags.
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().BoolVar(
+		&replayFromArchive,
+		"from-archive",
+		false,
+		"Replay the files of the input archive directories",
+	)
+	replayCmd.MarkFlagRequired("from-archive")
+
+	replayCmd.Flags().StringVar(
+		&replayDate,
+		"date",
+		"",
+		"Only replay files archived on this day, as YYYY-MM-DD (default: all)",
+	)
+
+	replayCmd.Flags().StringVar(
+		&replayDepartment,
+		"department",
+		"",
+		"Only replay this department's files",
+	)
+
+	replayCmd.Flags().StringVar(
+		&replayOutputDir,
+		"output-dir",
+		"",
+		"Sandbox directory for the XML and error log (default: ./replay/<date>)",
+	)
+}
+
+// =============================================================================
+// REPLAY FUNCTION
+// =============================================================================
+
+// archivedFile is an input file found in an archive directory.
+type archivedFile struct {
+	// path is the archived file.
+	path string
+
+	// department is the department whose own archive directory holds the
+	// file, or nil for the main input archive.
+	department *config.DepartmentConfig
+}
+
+// runReplay converts the archived files into the sandbox.
+//
+// RETURNS:
+//   - nil if every file converted, or an error carrying the exit code.
+func runReplay() error {
+	mainConfig, deptConfigs, err := loadListConfig()
+	if err != nil {
+		return err
+	}
+
+	if replayDepartment != "" && deptConfigs[replayDepartment] == nil {
+		return &exitError{exitConfigError, fmt.Errorf("unknown department: %s", replayDepartment)}
+	}
+
+	var day time.Time
+	if replayDate != "" {
+		day, err = time.ParseInLocation("2006-01-02", replayDate, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid --date %q (use YYYY-MM-DD)", replayDate)
+		}
+	}
+
+	outputDir := replayOutputDir
+	if outputDir == "" {
+		name := replayDate
+		if name == "" {
+			name = "all"
+		}
+		outputDir = filepath.Join("replay", name)
+	}
+	if filepath.Clean(outputDir) == filepath.Clean(mainConfig.OutputDir) {
+		return fmt.Errorf("the sandbox must not be the output directory %s", mainConfig.OutputDir)
+	}
+
+	files, err := findArchivedFiles(mainConfig, deptConfigs, day)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Println("No archived files found.")
+		return nil
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+
+	tempDir, err := os.MkdirTemp("", "csv2xml-replay-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Only errors are logged, unless --verbose: the results are printed below.
+	level := "error"
+	if verbose {
+		level = "debug"
+	}
+	logger, err := logging.New(logging.Options{Level: level, Format: logFormat})
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to set up logging: %w", err)}
+	}
+	defer logger.Close()
+
+	fmt.Printf("Replaying archived files into %s\n\n", outputDir)
+
+	var replayed, failedValidation, failedOther int
+	var errorEntries []utils.ErrorLogEntry
+
+	for _, file := range files {
+		deptConfig := file.department
+		if deptConfig == nil {
+			deptConfig, _, err = converter.ResolveDepartment(file.path, deptConfigs, mainConfig)
+			if err != nil {
+				if replayDepartment == "" {
+					failedOther++
+					fmt.Printf("✗ %s: %v\n", file.path, err)
+				}
+				continue
+			}
+		}
+		if replayDepartment != "" && deptConfig.DepartmentCode != replayDepartment {
+			continue
+		}
+
+		input := file.path
+		if strings.HasSuffix(input, archivecrypt.Suffix) {
+			input = filepath.Join(tempDir, strings.TrimSuffix(filepath.Base(file.path), archivecrypt.Suffix))
+			if err := archivecrypt.DecryptFile(context.Background(), mainConfig.ArchiveEncryption, file.path, input); err != nil {
+				failedOther++
+				fmt.Printf("✗ %s: %v\n", file.path, err)
+				continue
+			}
+		}
+
+		result := replayFile(input, outputDir, deptConfig, mainConfig, logger)
+		result.FilePath = file.path
+		switch {
+		case result.Success:
+			replayed++
+			fmt.Printf("✓ %s -> %s (%d transactions)\n", file.path, result.OutputFile, result.Stats.TransactionsCreated)
+		case errors.Is(result.Error, converter.ErrValidationFailed):
+			failedValidation++
+			fmt.Printf("✗ %s: %v\n", file.path, result.Error)
+			errorEntries = append(errorEntries, errorLogEntries(result)...)
+		default:
+			failedOther++
+			fmt.Printf("✗ %s: %v\n", file.path, result.Error)
+			errorEntries = append(errorEntries, errorLogEntries(result)...)
+		}
+	}
+
+	if len(errorEntries) > 0 {
+		logPath, err := utils.WriteErrorLog(errorEntries, outputDir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\nErrors have been logged to: %s\n", logPath)
+	}
+
+	fmt.Printf("\n%d file(s) replayed: %d converted, %d failed validation, %d could not be replayed\n",
+		replayed+failedValidation+failedOther, replayed, failedValidation, failedOther)
+
+	switch {
+	case failedOther > 0:
+		return &exitError{exitPartialFailure, fmt.Errorf("%d file(s) could not be replayed", failedOther)}
+	case failedValidation > 0:
+		return &exitError{exitValidationFailed, fmt.Errorf("%d file(s) failed validation", failedValidation)}
+	}
+	return nil
+}
+
+// replayFile converts a file into the sandbox.
+//
+// PARAMETERS:
+//   - input: The (decrypted) archived file.
+//   - outputDir: The sandbox directory.
+//   - deptConfig: The department to convert the file with.
+//   - mainConfig: The main configuration.
+//   - logger: The logger of the converter.
+//
+// RETURNS:
+//   - The result. OutputFile is the sandbox file.
+func replayFile(input, outputDir string, deptConfig *config.DepartmentConfig, mainConfig *config.MainConfig, logger converter.Logger) converter.Result {
+	conv := converter.New(input, deptConfig, mainConfig)
+	conv.SetLogger(logger)
+
+	base := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	outputPath := filepath.Join(outputDir, base+conv.OutputExtension())
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return converter.Result{Error: fmt.Errorf("failed to create %s: %w", outputPath, err)}
+	}
+	result := conv.Preview(output)
+	if err := output.Close(); err != nil && result.Success {
+		result.Success = false
+		result.Error = fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	if !result.Success {
+		os.Remove(outputPath)
+		return result
+	}
+	result.OutputFile = outputPath
+	return result
+}
+
+// findArchivedFiles lists the files of the main and department input
+// archive directories, and their subdirectories.
+//
+// PARAMETERS:
+//   - mainConfig: The main configuration.
+//   - deptConfigs: The department configurations.
+//   - day: Only files last modified that day are listed, unless zero.
+//
+// RETURNS:
+//   - The files, sorted by path. Fix-up files are left out.
+//   - An error if an archive directory cannot be read.
+func findArchivedFiles(mainConfig *config.MainConfig, deptConfigs map[string]*config.DepartmentConfig, day time.Time) ([]archivedFile, error) {
+	dirs := []string{mainConfig.InputArchiveDir}
+	owners := map[string]*config.DepartmentConfig{filepath.Clean(mainConfig.InputArchiveDir): nil}
+	for _, code := range converter.DepartmentCodes(deptConfigs) {
+		dir := deptConfigs[code].InputArchiveDir
+		if dir == "" {
+			continue
+		}
+		if _, seen := owners[filepath.Clean(dir)]; !seen {
+			owners[filepath.Clean(dir)] = deptConfigs[code]
+			dirs = append(dirs, dir)
+		}
+	}
+
+	var files []archivedFile
+	for _, dir := range dirs {
+		owner := owners[filepath.Clean(dir)]
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) && path == dir {
+					return nil
+				}
+				return err
+			}
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || converter.IsFixupFile(path) {
+				return nil
+			}
+
+			if !day.IsZero() {
+				info, err := entry.Info()
+				if err != nil {
+					return err
+				}
+				modified := info.ModTime()
+				if modified.Before(day) || !modified.Before(day.AddDate(0, 0, 1)) {
+					return nil
+				}
+			}
+
+			files = append(files, archivedFile{path: path, department: owner})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
@@ -0,0 +1,194 @@
+// =============================================================================
+// CSV to XML Converter - Reverse Command
+// =============================================================================
+//
+// This file defines the 'reverse' command, which flattens a generated (or
+// vendor-provided) XML file back into CSV with its template (see
+// xmlwriter.Flatten), so finance can reconcile an uploaded file against the
+// original export in Excel.
+//
+// COMMAND USAGE:
+//   converter reverse <file.xml> [--template NAME] [--output FILE]
+//
+// FLAGS:
+//   --template : The template the file was generated with, by name in the
+//                templates directory or by path (default: the template
+//                recorded in the file's template comment)
+//   --output   : The CSV file to write, or - for stdout (default: the XML
+//                file's name with .csv)
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+var (
+	// reverseTemplate is the template the XML was generated with.
+	reverseTemplate string
+
+	// reverseOutput is the CSV file to write.
+	reverseOutput string
+)
+
+// =============================================================================
+// REVERSE COMMAND DEFINITION
+// =============================================================================
+
+// reverseCmd represents the 'reverse' command.
+var reverseCmd = &cobra.Command{
+	Use:   "reverse <file.xml>",
+	Short: "Flatten an XML file back into CSV for reconciliation",
+	Long: `Flattens an XML file back into CSV with the template it was generated with,
+so it can be reconciled against the original export in Excel.
+
+Every line item becomes a row, with the fields of its transaction and of the
+root element repeated on each row; the columns are the template's Old
+Headers. Elements that are not template fields (document header, static
+fields, batch elements) are listed and skipped. The values are those of the
+XML, after transformations.
+
+The template is taken from the file's template comment, which is written
+when the template has a version; otherwise name it with --template.
+
+Examples:
+  converter reverse output/CLM_20240131.xml
+  converter reverse vendor.xml --template payments.xlsx --output - > vendor.csv`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runReverse(args[0])
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the reverse command with the root command and sets up flags.
+func init() {
+	rootCmd.AddCommand(reverseCmd)
+
+	reverseCmd.Flags().StringVar(
+		&reverseTemplate,
+		"template",
+		"",
+		"Template the file was generated with (default: from the file's template comment)",
+	)
+
+	reverseCmd.Flags().StringVar(
+		&reverseOutput,
+		"output",
+		"",
+		"CSV file to write, or - for stdout (default: the XML file's name with .csv)",
+	)
+}
+
+// =============================================================================
+// REVERSE FUNCTION
+// =============================================================================
+
+// templateCommentPattern matches the template comment written before the
+// root element (see converter.templateComment).
+var templateCommentPattern = regexp.MustCompile(`<!--\s*Template:\s*(.+?), version `)
+
+// runReverse writes the CSV of an XML file.
+//
+// PARAMETERS:
+//   - file: The XML file.
+//
+// RETURNS:
+//   - An error if the template cannot be determined or parsed, or the XML
+//     cannot be read or the CSV written.
+func runReverse(file string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer in.Close()
+	reader := bufio.NewReaderSize(in, 64*1024)
+
+	template := reverseTemplate
+	if template == "" {
+		head, _ := reader.Peek(64 * 1024)
+		match := templateCommentPattern.FindSubmatch(head)
+		if match == nil {
+			return fmt.Errorf("%s does not record its template; name it with --template", file)
+		}
+		template = string(match[1])
+	}
+
+	templatePath, err := resolveTemplatePath(template)
+	if err != nil {
+		return err
+	}
+	schema, err := xlsxparser.Parse(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", templatePath, err)
+	}
+
+	output := reverseOutput
+	if output == "" {
+		output = strings.TrimSuffix(file, filepath.Ext(file)) + ".csv"
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	result, err := xmlwriter.Flatten(reader, schema, out)
+	if err != nil {
+		return fmt.Errorf("failed to flatten %s: %w", file, err)
+	}
+
+	// Progress goes to stderr, so the CSV can be piped.
+	fmt.Fprintf(os.Stderr, "%s -> %s: %d transaction(s), %d row(s) with template %s\n",
+		file, output, result.Transactions, result.Rows, filepath.Base(templatePath))
+	if len(result.Skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped elements not in the template: %s\n", strings.Join(result.Skipped, ", "))
+	}
+	return nil
+}
+
+// resolveTemplatePath returns the path of a template given by path or by
+// name in the templates directory.
+//
+// RETURNS:
+//   - The path.
+//   - An error if the template is not a file and the main configuration,
+//     for the templates directory, cannot be loaded.
+func resolveTemplatePath(template string) (string, error) {
+	if _, err := os.Stat(template); err == nil {
+		return template, nil
+	}
+
+	mainConfig, err := config.LoadMainConfig(cfgFile)
+	if err != nil {
+		return "", &exitError{exitConfigError, fmt.Errorf("failed to load main config: %w", err)}
+	}
+	return filepath.Join(mainConfig.TemplatesDir, template), nil
+}
@@ -9,6 +9,17 @@
 // COBRA CLI STRUCTURE:
 //   rootCmd (converter)
 //   ├── processCmd (converter process)
+//   ├── watchCmd (converter watch)
+//   ├── checkCmd (converter check)
+//   ├── explainCmd (converter explain)
+//   ├── departmentsCmd (converter departments list)
+//   ├── templatesCmd (converter templates list|diff)
+//   ├── bundleCmd (converter bundle pack|verify|unpack)
+//   ├── configCmd (converter config migrate)
+//   ├── demoCmd (converter demo)
+//   ├── completionCmd (converter completion bash|zsh|fish|powershell)
+//   ├── docsCmd (converter docs)
+//   ├── serviceCmd (converter service install|uninstall)
 //   ├── validateCmd (converter validate)
 //   └── versionCmd (converter version)
 //
@@ -23,9 +34,12 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
 	"github.com/spf13/cobra"
 )
 
@@ -40,6 +54,9 @@ var cfgFile string
 // verbose enables verbose logging when set to true.
 var verbose bool
 
+// logFormat is the log message format: "text" or "json".
+var logFormat string
+
 // =============================================================================
 // ROOT COMMAND DEFINITION
 // =============================================================================
@@ -69,6 +86,8 @@ Key Features:
 Example Usage:
   converter process                    # Process all files in the input directory
   converter process --config ./my.yaml # Use a custom configuration file
+  converter watch                      # Keep converting new files as they arrive
+  converter check input/claims.csv     # Check a file without converting it
   converter validate                   # Validate configuration without processing`,
 
 	// Run is the function that will be executed when the root command is called
@@ -87,12 +106,80 @@ Example Usage:
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	// Execute the root command. If there's an error, print it and exit.
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	cleanupBundle()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+
+		var exit *exitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
+		os.Exit(exitFailure)
+	}
+}
+
+// newLogger creates the logger for a command. The level is the configured
+// log_level, or "debug" with --verbose; the format is --log-format.
+//
+// PARAMETERS:
+//   - mainConfig: The main configuration.
+//   - options: Further logger options (output, system log). Level and
+//     Format are set here.
+//
+// RETURNS:
+//   - The logger. The caller must close it.
+//   - An error if the level or format is invalid or the system log cannot
+//     be opened.
+func newLogger(mainConfig *config.MainConfig, options logging.Options) (*logging.Logger, error) {
+	options.Level = mainConfig.LogLevel
+	if verbose {
+		options.Level = "debug"
+	}
+	options.Format = logFormat
+
+	logger, err := logging.New(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up logging: %w", err)
 	}
+	return logger, nil
+}
+
+// =============================================================================
+// EXIT CODES
+// =============================================================================
+// Schedulers branch on the exit code of a run, so every outcome has its own.
+
+const (
+	// exitFailure is any error without a more specific code.
+	exitFailure = 1
+
+	// exitValidationFailed: at least one file failed validation, and no file
+	// failed for another reason.
+	exitValidationFailed = 2
+
+	// exitConfigError: the configuration could not be loaded; nothing was
+	// processed.
+	exitConfigError = 3
+
+	// exitPartialFailure: at least one file (or the transfer of results)
+	// failed for a reason other than validation.
+	exitPartialFailure = 4
+
+	// exitAborted: a file failed at a stage whose failure policy is
+	// abort-run, and the remaining files were not started.
+	exitAborted = 5
+)
+
+// exitError is an error that ends the program with a specific exit code.
+type exitError struct {
+	code int
+	err  error
 }
 
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
 // =============================================================================
 // INITIALIZATION
 // =============================================================================
@@ -123,6 +210,14 @@ func init() {
 		"Enable verbose output for debugging",
 	)
 
+	// --log-format flag: Format of log messages.
+	rootCmd.PersistentFlags().StringVar(
+		&logFormat,
+		"log-format",
+		"text",
+		"Format of log messages: text or json",
+	)
+
 	// ==========================================================================
 	// CONFIGURATION INITIALIZATION
 	// ==========================================================================
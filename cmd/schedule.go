@@ -0,0 +1,122 @@
+// =============================================================================
+// CSV to XML Converter - Held Output Release
+// =============================================================================
+//
+// With a delivery schedule (delivery_schedule in the main configuration),
+// the converters write output files to the hold directory. Every process
+// run and every watch scan then releases held files to the output directory
+// of their department, as far as the hold windows and the rate limit allow.
+// See internal/schedule.
+//
+// A run in a hold window converts its files and leaves them held; the first
+// run or scan after the window releases them, even if it has no input files.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/schedule"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+)
+
+// newSchedule creates the delivery schedule of the configuration.
+//
+// RETURNS:
+//   - The schedule, or nil if output files are written directly.
+//   - An error if the schedule is invalid.
+func newSchedule(mainConfig *config.MainConfig) (*schedule.Schedule, error) {
+	settings := mainConfig.DeliverySchedule
+	sched, err := schedule.New(settings.HoldWindows, settings.MaxFilesPerMinute)
+	if err != nil {
+		return nil, fmt.Errorf("delivery_schedule: %w", err)
+	}
+	return sched, nil
+}
+
+// releaseHeldOutputs releases held output files to the output directories
+// of their departments.
+//
+// PARAMETERS:
+//   - sched: The delivery schedule.
+//   - mainConfig: The main application configuration.
+//   - deptConfigs: A map of department configurations.
+//   - wait: Wait for the rate limit to allow every file (process runs),
+//     instead of leaving the rest for the next scan (watch).
+//
+// RETURNS:
+//   - What was released and what is still held.
+func releaseHeldOutputs(sched *schedule.Schedule, mainConfig *config.MainConfig, deptConfigs map[string]*config.DepartmentConfig, wait bool) schedule.Report {
+	destination := func(department string) (string, error) {
+		for _, deptConfig := range deptConfigs {
+			if deptConfig.DepartmentCode == department {
+				return mainConfig.ForDepartment(deptConfig).OutputDir, nil
+			}
+		}
+		return "", fmt.Errorf("no department configuration with code %s", department)
+	}
+
+	fm := utils.NewFileManager(mainConfig.InputDir, mainConfig.OutputDir, mainConfig.InputArchiveDir, mainConfig.OutputArchiveDir)
+	fm.RetryAttempts = mainConfig.FileRetryAttempts
+	fm.RetryDelay = mainConfig.FileRetryDelay
+
+	return sched.Release(mainConfig.DeliverySchedule.HoldDir, destination, fm.MoveFile, wait)
+}
+
+// printRelease prints the outcome of a release.
+func printRelease(w io.Writer, report schedule.Report) {
+	for _, released := range report.Released {
+		fmt.Fprintf(w, "  ↑ Released %s\n", released.To)
+	}
+	for _, err := range report.Errors {
+		fmt.Fprintf(w, "  ✗ %v\n", err)
+	}
+	if report.Remaining > 0 {
+		fmt.Fprintf(w, "  %d output file(s) held%s\n", report.Remaining, heldUntil(report))
+	}
+}
+
+// logRelease logs the outcome of a release.
+func logRelease(logger *logging.Logger, report schedule.Report) {
+	for _, released := range report.Released {
+		logger.Info("Released %s", released.To)
+	}
+	for _, err := range report.Errors {
+		logger.Error("%v", err)
+	}
+	if report.Remaining > 0 {
+		logger.Debug("%d output file(s) held%s", report.Remaining, heldUntil(report))
+	}
+}
+
+// heldUntil describes until when files are held, e.g. " until 01:00".
+func heldUntil(report schedule.Report) string {
+	if report.HeldUntil.IsZero() {
+		return " (delivery rate limit)"
+	}
+	return " until " + report.HeldUntil.Format("15:04")
+}
+
+// releaseWithoutInput releases held output files in a process run that has
+// no files to convert, and uploads them if the output directory is remote.
+func releaseWithoutInput(run *stagedRun, sched *schedule.Schedule, deptConfigs map[string]*config.DepartmentConfig) error {
+	if sched == nil {
+		return nil
+	}
+
+	report := releaseHeldOutputs(sched, run.local, deptConfigs, true)
+	printRelease(console, report)
+	if len(report.Released) == 0 {
+		return nil
+	}
+
+	if err := run.finish(); err != nil {
+		return &exitError{exitPartialFailure, fmt.Errorf("failed to transfer files to object storage: %w", err)}
+	}
+	return nil
+}
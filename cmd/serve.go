@@ -0,0 +1,657 @@
+// =============================================================================
+// CSV to XML Converter - Serve Command
+// =============================================================================
+//
+// This file defines the 'serve' command, which runs the converter as an HTTP
+// service for systems that want to send a CSV and get the XML back, instead
+// of dropping files into the input directory:
+//
+//   GET  /v1/departments                          : the caller's departments
+//   POST /v1/departments/{code}/convert?filename= : CSV in, document out
+//
+// The file name selects the template (template_mapping) and fills the
+// {filename} and {original} placeholders, as for a file in the input
+// directory. Nothing is written to the output directory, delivered, or
+// archived; the document is the response.
+//
+// ACCESS CONTROL (see config.ServeSettings):
+//   Callers authenticate with an API key, a client certificate (mutual TLS),
+//   or both, and may only convert files for the departments of their key or
+//   certificate:
+//
+//   401 : no or an unknown API key
+//   403 : the department is not one of the caller's
+//   429 : the caller's rate limit is exceeded (Retry-After: 1)
+//
+//   Without api_keys and client_ca, the service only listens on a loopback
+//   address, and every local caller may use every department.
+//
+// Every request is logged with its caller, and every conversion is recorded
+// in the audit trail with its caller.
+//
+// COMMAND USAGE:
+//   converter serve [flags]
+//
+// FLAGS:
+//   --addr : Address to listen on (default: serve.addr)
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/audit"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/service"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// serveAddr overrides the address of the service (serve.addr).
+var serveAddr string
+
+// =============================================================================
+// SERVE COMMAND DEFINITION
+// =============================================================================
+
+// serveCmd represents the 'serve' command.
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Convert CSV files sent over HTTP",
+	Long: `The serve command runs the converter as an HTTP service. A caller posts a
+CSV to /v1/departments/<code>/convert?filename=<name> and gets the converted
+document back; GET /v1/departments lists the departments it may use. The
+file name selects the template, as for a file in the input directory.
+
+The serve section of the main configuration sets the address and who may
+call: API keys (X-API-Key or a bearer token) and client certificates
+(mutual TLS), each limited to its departments, a rate limit per caller, and
+a request log. Every conversion is recorded in the audit trail with its
+caller. Without API keys or client certificates, the service only listens
+on a loopback address.
+
+Stop the service with Ctrl+C.`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runServe()
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the serve command with the root command and sets up flags.
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	// --addr flag: Address to listen on.
+	serveCmd.Flags().StringVar(
+		&serveAddr,
+		"addr",
+		"",
+		"Address to listen on (default: serve.addr from the configuration)",
+	)
+}
+
+// =============================================================================
+// MAIN SERVE FUNCTION
+// =============================================================================
+
+// runServe loads the configuration and serves conversions until stopped.
+func runServe() error {
+	mainConfig, err := config.LoadMainConfig(cfgFile)
+	if err != nil {
+		return fmt.Errorf("failed to load main config: %w", err)
+	}
+	settings := mainConfig.Serve
+	if serveAddr != "" {
+		settings.Addr = serveAddr
+	}
+
+	deptConfigs, err := config.LoadDepartmentConfigs(mainConfig.ConfigsDir)
+	if err != nil {
+		return fmt.Errorf("failed to load department configs: %w", err)
+	}
+
+	logger, err := newLogger(mainConfig, logging.Options{})
+	if err != nil {
+		return err
+	}
+	defer logger.Close()
+
+	trail, err := audit.Open(mainConfig.AuditLog)
+	if err != nil {
+		return err
+	}
+
+	if err := checkServeAddr(settings); err != nil {
+		return err
+	}
+	guard, err := newServeGuard(settings, deptConfigs, logger)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := serveTLSConfig(settings)
+	if err != nil {
+		return err
+	}
+
+	conversions := &conversionService{
+		mainConfig:  mainConfig,
+		deptConfigs: deptConfigs,
+		maxBytes:    settings.MaxRequestMB << 20,
+		trail:       trail,
+		logger:      logger,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/departments", conversions.departments)
+	mux.HandleFunc("POST /v1/departments/{code}/convert", conversions.convert)
+
+	listener, err := net.Listen("tcp", settings.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", settings.Addr, err)
+	}
+	server := &http.Server{Handler: guard.wrap(mux), ReadHeaderTimeout: 10 * time.Second, TLSConfig: tlsConfig,
+		ErrorLog: log.New(serveErrorLog{logger}, "", 0)}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
+	return service.Run(service.DefaultName, func(stop <-chan struct{}) error {
+		served := make(chan error, 1)
+		go func() {
+			if tlsConfig != nil {
+				served <- server.ServeTLS(listener, "", "")
+			} else {
+				served <- server.Serve(listener)
+			}
+		}()
+		logger.Info("Serving conversions on %s://%s", scheme, listener.Addr())
+
+		select {
+		case err := <-served:
+			return fmt.Errorf("serve stopped: %w", err)
+		case <-stop:
+		}
+
+		// Conversions in progress may finish.
+		ctx, cancel := context.WithTimeout(context.Background(), mainConfig.ShutdownDrainTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+		logger.Info("Service stopped")
+		return nil
+	})
+}
+
+// checkServeAddr refuses to serve beyond localhost without authentication.
+func checkServeAddr(settings config.ServeSettings) error {
+	if settings.Authenticated() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(settings.Addr)
+	if err != nil {
+		return fmt.Errorf("serve.addr: %w", err)
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return nil
+	}
+	return fmt.Errorf("serve: %s is not a loopback address; configure api_keys or client_ca to serve beyond localhost", settings.Addr)
+}
+
+// serveTLSConfig returns the TLS configuration of the service, or nil to
+// serve plain HTTP.
+func serveTLSConfig(settings config.ServeSettings) (*tls.Config, error) {
+	if settings.TLSCert == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(settings.TLSCert, settings.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("serve: failed to load tls_cert and tls_key: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	if settings.ClientCA != "" {
+		pem, err := os.ReadFile(settings.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("serve: failed to read client_ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("serve: client_ca has no PEM certificates")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// =============================================================================
+// CONVERSION ENDPOINTS
+// =============================================================================
+
+// conversionService serves the conversion endpoints.
+type conversionService struct {
+	mainConfig  *config.MainConfig
+	deptConfigs map[string]*config.DepartmentConfig
+	maxBytes    int64
+	trail       *audit.Trail
+	logger      *logging.Logger
+}
+
+// servedDepartment is a department in the response of GET /v1/departments.
+type servedDepartment struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// conversionError is the response of a failed conversion.
+type conversionError struct {
+	Error  string            `json:"error"`
+	Errors []validationIssue `json:"errors,omitempty"`
+}
+
+// validationIssue is a validation error in a conversionError.
+type validationIssue struct {
+	Code     string `json:"code"`
+	Field    string `json:"field,omitempty"`
+	Row      int    `json:"row,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// departments lists the departments the caller may use.
+func (s *conversionService) departments(w http.ResponseWriter, r *http.Request) {
+	caller := callerOf(r)
+	list := []servedDepartment{}
+	for code, deptConfig := range s.deptConfigs {
+		if caller.mayUse(code) {
+			list = append(list, servedDepartment{Code: code, Name: deptConfig.DepartmentName})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	writeJSON(w, http.StatusOK, list)
+}
+
+// convert converts the CSV in the request body for a department. The
+// document is buffered, so a conversion that fails part way gets an error
+// status instead of a partial document. Validation errors fail the
+// conversion unless the department's failure_policy continues.
+func (s *conversionService) convert(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	caller := callerOf(r)
+	code := r.PathValue("code")
+	deptConfig := s.deptConfigs[code]
+	switch {
+	case deptConfig == nil:
+		writeJSON(w, http.StatusNotFound, conversionError{Error: fmt.Sprintf("unknown department: %s", code)})
+		return
+	case !caller.mayUse(code):
+		writeJSON(w, http.StatusForbidden, conversionError{Error: fmt.Sprintf("%s may not convert files for %s", caller.name, code)})
+		return
+	}
+
+	fileName := filepath.Base(r.URL.Query().Get("filename"))
+	if fileName == "." || fileName == string(filepath.Separator) {
+		writeJSON(w, http.StatusBadRequest, conversionError{Error: "the filename query parameter is required (it selects the template)"})
+		return
+	}
+
+	input, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, conversionError{Error: fmt.Sprintf("the CSV is larger than %d MB (serve.max_request_mb)", s.maxBytes>>20)})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, conversionError{Error: fmt.Sprintf("failed to read the CSV: %v", err)})
+		return
+	}
+
+	conv := converter.New(fileName, deptConfig, s.mainConfig)
+	conv.SetLogger(s.logger)
+	schema, err := conv.Template()
+	if err != nil {
+		s.record(caller, fileName, code, converter.Result{}, start, err)
+		writeJSON(w, http.StatusUnprocessableEntity, conversionError{Error: err.Error()})
+		return
+	}
+
+	var output bytes.Buffer
+	result := conv.ConvertStream(bytes.NewReader(input), &output, schema)
+	s.record(caller, fileName, code, result, start, result.Error)
+	if result.Error != nil {
+		response := conversionError{Error: result.Error.Error()}
+		if result.Validation != nil {
+			for _, ve := range result.Validation.Errors {
+				response.Errors = append(response.Errors, validationIssue{Code: ve.Code, Field: ve.Field,
+					Row: ve.RowNumber, Severity: ve.Severity, Message: ve.Message})
+			}
+		}
+		writeJSON(w, http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	w.Header().Set("Content-Type", deptConfig.OutputFormat.ContentType())
+	w.Header().Set("X-Transactions", fmt.Sprint(result.Stats.TransactionsCreated))
+	w.Write(output.Bytes())
+}
+
+// record records a conversion in the audit trail, with its caller.
+func (s *conversionService) record(caller serveCaller, fileName, department string, result converter.Result, start time.Time, err error) {
+	entry := audit.Entry{
+		Event:           audit.EventServed,
+		File:            fileName,
+		Department:      department,
+		Rows:            result.Stats.RowsProcessed,
+		Transactions:    result.Stats.TransactionsCreated,
+		Template:        result.Template,
+		TemplateVersion: result.TemplateVersion,
+		DurationMS:      time.Since(start).Milliseconds(),
+		Caller:          caller.name,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if err := s.trail.Record(entry); err != nil {
+		s.logger.Error("%v", err)
+	}
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// =============================================================================
+// ACCESS CONTROL
+// =============================================================================
+
+// serveCaller is the caller of a request and the departments it may use.
+type serveCaller struct {
+	// name is "key:<name>", "cert:<common name>", or "ip:<address>".
+	name string
+
+	// authenticated is false for a caller that failed to authenticate.
+	authenticated bool
+
+	// all allows every department; departments lists them otherwise.
+	all         bool
+	departments map[string]bool
+}
+
+// mayUse reports whether the caller may convert files for a department.
+func (c serveCaller) mayUse(code string) bool {
+	return c.all || c.departments[code]
+}
+
+// serveCallerKey is the context key of the request's serveCaller.
+type serveCallerKey struct{}
+
+// callerOf returns the caller of a request that passed the guard.
+func callerOf(r *http.Request) serveCaller {
+	caller, _ := r.Context().Value(serveCallerKey{}).(serveCaller)
+	return caller
+}
+
+// serveKey is a resolved API key with its departments.
+type serveKey struct {
+	name   string
+	key    []byte
+	access serveCaller
+}
+
+// serveGuard authenticates, rate limits, and logs the requests.
+type serveGuard struct {
+	keys          []serveKey
+	clients       map[string]serveCaller
+	authenticated bool
+	limiter       *callerLimiter
+	logRequests   bool
+	logger        *logging.Logger
+}
+
+// newServeGuard resolves the API keys and the departments of the keys and
+// clients.
+//
+// RETURNS:
+//   - The guard.
+//   - An error if the environment variable of a key is not set, or a key
+//     or client names an unknown department.
+func newServeGuard(settings config.ServeSettings, deptConfigs map[string]*config.DepartmentConfig, logger *logging.Logger) (*serveGuard, error) {
+	guard := &serveGuard{
+		clients:       make(map[string]serveCaller),
+		authenticated: settings.Authenticated(),
+		limiter:       newCallerLimiter(settings.RateLimit),
+		logRequests:   settings.LogRequests,
+		logger:        logger,
+	}
+
+	for _, apiKey := range settings.APIKeys {
+		key := apiKey.Key
+		if key == "" {
+			key = os.Getenv(apiKey.KeyEnv)
+		}
+		if key == "" {
+			return nil, fmt.Errorf("serve: API key %s is not set (environment variable %s is empty)", apiKey.Name, apiKey.KeyEnv)
+		}
+		access, err := departmentAccess("key:"+apiKey.Name, apiKey.Departments, deptConfigs)
+		if err != nil {
+			return nil, fmt.Errorf("serve.api_keys[%s]: %w", apiKey.Name, err)
+		}
+		guard.keys = append(guard.keys, serveKey{name: apiKey.Name, key: []byte(key), access: access})
+	}
+
+	for _, client := range settings.Clients {
+		access, err := departmentAccess("cert:"+client.CommonName, client.Departments, deptConfigs)
+		if err != nil {
+			return nil, fmt.Errorf("serve.clients[%s]: %w", client.CommonName, err)
+		}
+		guard.clients[client.CommonName] = access
+	}
+	return guard, nil
+}
+
+// departmentAccess returns an authenticated caller with departments.
+func departmentAccess(name string, departments []string, deptConfigs map[string]*config.DepartmentConfig) (serveCaller, error) {
+	caller := serveCaller{name: name, authenticated: true, departments: make(map[string]bool)}
+	for _, code := range departments {
+		switch {
+		case code == config.ServeAllDepartments:
+			caller.all = true
+		case deptConfigs[code] == nil:
+			return serveCaller{}, fmt.Errorf("unknown department %s", code)
+		default:
+			caller.departments[code] = true
+		}
+	}
+	return caller, nil
+}
+
+// wrap returns a handler that serves authenticated requests within their
+// caller's rate limit with next, and logs every request.
+func (g *serveGuard) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		caller := g.caller(r)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		switch {
+		// Callers that fail to authenticate are limited by address, so keys
+		// cannot be guessed at full speed.
+		case !g.limiter.allow(caller.name, start):
+			recorder.Header().Set("Retry-After", "1")
+			http.Error(recorder, "rate limit exceeded", http.StatusTooManyRequests)
+		case !caller.authenticated:
+			recorder.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(recorder, "unauthorized", http.StatusUnauthorized)
+		default:
+			next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), serveCallerKey{}, caller)))
+		}
+
+		logRequest := g.logger.Debug
+		switch {
+		case recorder.status == http.StatusUnauthorized || recorder.status == http.StatusForbidden ||
+			recorder.status == http.StatusTooManyRequests:
+			logRequest = g.logger.Warn
+		case g.logRequests:
+			logRequest = g.logger.Info
+		}
+		logRequest("Request %s %s from %s (%s): %d in %s",
+			r.Method, r.URL.RequestURI(), caller.name, r.RemoteAddr, recorder.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// caller identifies the caller of a request and its departments. A client
+// certificate was verified in the TLS handshake; with API keys, a key is
+// required as well, and its departments apply.
+func (g *serveGuard) caller(r *http.Request) serveCaller {
+	anonymous := serveCaller{name: "ip:" + remoteIP(r)}
+	if !g.authenticated {
+		anonymous.authenticated = true
+		anonymous.all = true
+		return anonymous
+	}
+
+	if len(g.keys) > 0 {
+		presented := r.Header.Get("X-API-Key")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && presented == "" {
+			presented = bearer
+		}
+		if presented == "" {
+			return anonymous
+		}
+		for _, key := range g.keys {
+			if subtle.ConstantTimeCompare([]byte(presented), key.key) == 1 {
+				return key.access
+			}
+		}
+		return anonymous
+	}
+
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return anonymous
+	}
+	commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+	if client, ok := g.clients[commonName]; ok {
+		return client
+	}
+	// A trusted certificate without departments may list none.
+	return serveCaller{name: "cert:" + commonName, authenticated: true}
+}
+
+// remoteIP returns the IP address of a request's client.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// serveErrorLog logs the errors of the HTTP server, such as refused client
+// certificates, as warnings.
+type serveErrorLog struct {
+	logger *logging.Logger
+}
+
+// Write logs one message.
+func (l serveErrorLog) Write(p []byte) (int, error) {
+	l.logger.Warn("Serve: %s", strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+// statusRecorder records the status code of a response, for the request
+// log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// callerLimiter is a token bucket per caller: each holds up to twice the
+// rate, and refills at the rate per second.
+type callerLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket is the tokens a caller has left, as of last.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxLimitedCallers bounds the buckets kept; full buckets are dropped
+// beyond it, as they allow the same as a new one.
+const maxLimitedCallers = 1000
+
+// newCallerLimiter returns a limiter of rate requests per second per
+// caller.
+func newCallerLimiter(rate float64) *callerLimiter {
+	return &callerLimiter{rate: rate, burst: max(2*rate, 1), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from the caller's bucket, and reports whether there
+// was one.
+func (l *callerLimiter) allow(caller string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buckets) >= maxLimitedCallers {
+		for name, bucket := range l.buckets {
+			if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, name)
+			}
+		}
+	}
+
+	bucket, ok := l.buckets[caller]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[caller] = bucket
+	}
+	bucket.tokens = min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
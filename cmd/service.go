@@ -0,0 +1,181 @@
+// =============================================================================
+// CSV to XML Converter - Service Command
+// =============================================================================
+//
+// This file defines the 'service' command, which installs and removes the
+// watch mode as an operating system service.
+//
+// COMMAND USAGE:
+//   converter service install   [flags]   # Windows service or systemd unit
+//   converter service uninstall [flags]
+//
+// FLAGS:
+//   --name     : Service name (default "csv2xml")
+//   --interval : Scan interval passed to 'converter watch' (install only)
+//   --user     : Account the systemd unit runs as (install only, Linux)
+//
+// NOTES:
+//   - Run from the installation directory: the current directory and the
+//     --config file are recorded as absolute paths in the service definition.
+//   - Requires Administrator (Windows) or root (Linux).
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/service"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// serviceName is the name of the service to install or uninstall.
+var serviceName string
+
+// serviceInterval is the scan interval of the installed watcher.
+var serviceInterval time.Duration
+
+// serviceUser is the account the systemd unit runs as.
+var serviceUser string
+
+// =============================================================================
+// SERVICE COMMAND DEFINITIONS
+// =============================================================================
+
+// serviceCmd is the parent of the install and uninstall commands.
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Install or uninstall the watcher as a Windows service or systemd unit",
+}
+
+// serviceInstallCmd represents the 'service install' command.
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install and start the watcher as a service",
+	Long: `Installs 'converter watch' as a Windows service (started automatically and
+restarted on failure, logging to the Windows Event Log) or as a systemd unit
+(enabled at boot, restarted on failure, logging to syslog/journald).
+
+Run this from the installation directory as Administrator or root.`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runServiceInstall()
+	},
+}
+
+// serviceUninstallCmd represents the 'service uninstall' command.
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop and remove the watcher service",
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := service.Uninstall(serviceName); err != nil {
+			return err
+		}
+		fmt.Printf("Service %s uninstalled\n", serviceName)
+		return nil
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the service commands and sets up flags.
+func init() {
+	rootCmd.AddCommand(serviceCmd)
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceUninstallCmd)
+
+	// --name flag: Shared by install and uninstall.
+	serviceCmd.PersistentFlags().StringVar(
+		&serviceName,
+		"name",
+		service.DefaultName,
+		"Service name",
+	)
+
+	// --interval flag: Scan interval of the installed watcher.
+	serviceInstallCmd.Flags().DurationVar(
+		&serviceInterval,
+		"interval",
+		30*time.Second,
+		"How often the service scans the input directory",
+	)
+
+	// --user flag: Account the systemd unit runs as.
+	serviceInstallCmd.Flags().StringVar(
+		&serviceUser,
+		"user",
+		"",
+		"Account the systemd unit runs as (Linux only; default root)",
+	)
+}
+
+// =============================================================================
+// INSTALL FUNCTION
+// =============================================================================
+
+// runServiceInstall installs 'converter watch' as a service.
+func runServiceInstall() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to determine working directory: %w", err)
+	}
+
+	configPath, err := filepath.Abs(cfgFile)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		return fmt.Errorf("config file not found: %s", configPath)
+	}
+
+	// The service manager must give the watcher time to drain on stop.
+	mainConfig, err := config.LoadMainConfig(configPath)
+	if err != nil {
+		return &exitError{exitConfigError, fmt.Errorf("failed to load main config: %w", err)}
+	}
+
+	cfg := service.Config{
+		Name:        serviceName,
+		DisplayName: "CSV to XML Converter (" + serviceName + ")",
+		Description: "Watches the input directory and converts CSV files to XML",
+		Executable:  executable,
+		Args: []string{
+			"watch",
+			"--config", configPath,
+			"--workdir", workDir,
+			"--interval", serviceInterval.String(),
+			"--service-name", serviceName,
+			"--system-log",
+		},
+		User:        serviceUser,
+		StopTimeout: mainConfig.ShutdownDrainTimeout + time.Minute,
+	}
+
+	if err := service.Install(cfg); err != nil {
+		return err
+	}
+
+	fmt.Printf("Service %s installed and started\n", serviceName)
+	fmt.Printf("  Executable: %s\n", executable)
+	fmt.Printf("  Directory:  %s\n", workDir)
+	fmt.Printf("  Config:     %s\n", configPath)
+
+	return nil
+}
@@ -0,0 +1,173 @@
+// =============================================================================
+// CSV to XML Converter - Graceful Shutdown
+// =============================================================================
+//
+// When the watch command is stopped (Ctrl+C, SIGTERM, or a service stop),
+// it drains instead of dying mid-write:
+//
+//   1. /readyz reports "stopping", and no new file is started. Files that
+//      were found but not started stay in the input directory for the next
+//      start.
+//   2. The files in progress finish, including delivery, archiving, and the
+//      upload to object storage, for up to shutdown_drain_timeout.
+//   3. Files still converting after that are interrupted. They have not
+//      been archived, so they are converted again on the next start.
+//   4. The shutdown summary, covering every file since the watcher started,
+//      is logged and written to the log directory. The event publisher and
+//      the log are flushed and closed on the way out.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+)
+
+// watchSession tracks the files of a watcher from its start: the files in
+// progress, for the drain, and the results, for the shutdown summary. It is
+// safe for concurrent use.
+type watchSession struct {
+	mu sync.Mutex
+
+	// summary accumulates the results of the session.
+	summary utils.ProcessingSummary
+
+	// pending are the files of the current scan without a result.
+	pending map[string]bool
+
+	// interrupted is set when the pending files were interrupted.
+	interrupted bool
+}
+
+// newWatchSession starts a session.
+func newWatchSession() *watchSession {
+	return &watchSession{
+		summary: utils.ProcessingSummary{StartTime: time.Now()},
+		pending: make(map[string]bool),
+	}
+}
+
+// scanning records the files a scan is about to convert.
+func (s *watchSession) scanning(files []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, file := range files {
+		s.pending[file] = true
+	}
+}
+
+// record adds a file's result to the session. A file that was not started
+// is only removed from the pending files.
+func (s *watchSession) record(result converter.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, result.FilePath)
+	if s.interrupted || errors.Is(result.Error, converter.ErrStopping) || errors.Is(result.Error, converter.ErrAborted) {
+		return
+	}
+	s.summary.TotalFiles++
+	converter.RecordSummary(&s.summary, result)
+}
+
+// inProgress returns the pending files, sorted.
+func (s *watchSession) inProgress() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make([]string, 0, len(s.pending))
+	for file := range s.pending {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// interrupt records the pending files as interrupted by the drain timeout.
+// Their results, if they still arrive, are no longer recorded.
+//
+// RETURNS:
+//   - The interrupted files.
+func (s *watchSession) interrupt() []string {
+	files := s.inProgress()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, file := range files {
+		s.summary.TotalFiles++
+		s.summary.FailedFiles++
+		s.summary.FailedFilesList = append(s.summary.FailedFilesList, utils.FailedFileInfo{
+			InputFile:    file,
+			ErrorMessage: "interrupted by shutdown after the drain timeout",
+			ErrorType:    "interrupted",
+		})
+	}
+	s.pending = make(map[string]bool)
+	s.interrupted = true
+	return files
+}
+
+// drainWatch waits for the scan in progress when the watcher is stopped,
+// and writes the shutdown summary.
+//
+// PARAMETERS:
+//   - done: Receives the result of the scan in progress, or nil if no scan
+//     is in progress.
+//   - session: The watcher's session.
+//   - mainConfig: The main application configuration.
+//   - logger: The logger for progress and the summary.
+func drainWatch(done <-chan error, session *watchSession, mainConfig *config.MainConfig, logger *logging.Logger) {
+	if done != nil {
+		logger.Info("Stopping: finishing the files in progress (waiting up to %s)", mainConfig.ShutdownDrainTimeout)
+
+		timer := time.NewTimer(mainConfig.ShutdownDrainTimeout)
+		defer timer.Stop()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				logger.Error("%v", err)
+			}
+		case <-timer.C:
+			interrupted := session.interrupt()
+			names := make([]string, len(interrupted))
+			for i, file := range interrupted {
+				names[i] = filepath.Base(file)
+			}
+			logger.Error("Drain timeout of %s expired; interrupted %d file(s), to be converted again on the next start: %s",
+				mainConfig.ShutdownDrainTimeout, len(interrupted), strings.Join(names, ", "))
+		}
+	}
+
+	writeShutdownSummary(session, mainConfig, logger)
+}
+
+// writeShutdownSummary logs the session summary and writes it to the log
+// directory.
+func writeShutdownSummary(session *watchSession, mainConfig *config.MainConfig, logger *logging.Logger) {
+	session.mu.Lock()
+	summary := session.summary
+	session.mu.Unlock()
+	summary.EndTime = time.Now()
+
+	logger.Info("Shutdown summary: %d file(s) since %s: %d converted, %d failed, %d skipped; %d rows, %d transactions",
+		summary.TotalFiles, summary.StartTime.Format("2006-01-02 15:04:05"),
+		summary.SuccessfulFiles, summary.FailedFiles, summary.SkippedFiles,
+		summary.TotalRows, summary.TotalTransactions)
+
+	summaryPath, err := utils.WriteSummaryLog(summary, filepath.Dir(mainConfig.LogFile))
+	if err != nil {
+		logger.Error("Failed to write shutdown summary: %v", err)
+		return
+	}
+	logger.Info("Shutdown summary written to %s", summaryPath)
+}
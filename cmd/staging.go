@@ -0,0 +1,345 @@
+// =============================================================================
+// CSV to XML Converter - Object Store Staging
+// =============================================================================
+//
+// The converter works on local files. When the input, output, archive, or
+// data lake directories are object-store URIs (s3://, az://), each run
+// stages them in the local staging directory:
+//
+//   1. Input CSV files (and done markers) are downloaded to <staging>/input.
+//      Files that are already staged and unchanged are not downloaded again.
+//      The converter needs them on local disk (readiness checks, locks, and
+//      archiving work on files), so a file is only downloaded if the staging
+//      volume has room for it plus disk_space.min_free_mb; the others stay
+//      in the input location for a later run.
+//   2. The converter runs against the staging directories exactly as it does
+//      for local directories.
+//   3. Archived input files, output files, archived output files, and data
+//      lake files are uploaded to their remote locations and removed from
+//      staging.
+//   4. Remote input files that were archived are deleted from the input
+//      location. Failed files stay there (and staged), like local failures.
+//
+// Local directories are used directly and are not staged. Departments that
+// override a directory with an object-store URI are staged the same way, in
+// <staging>/departments/<code>/<directory>, and so are the directories of
+// their additional outputs, in <staging>/departments/<code>/outputs/<name>.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/storage"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+)
+
+// stagedRun maps object-store locations to local staging directories.
+type stagedRun struct {
+	ctx context.Context
+
+	// local is the configuration used by the converter, with every remote
+	// directory replaced by its staging directory.
+	local *config.MainConfig
+
+	// Remote stores, or nil for local directories.
+	input         storage.Store
+	output        storage.Store
+	inputArchive  storage.Store
+	outputArchive storage.Store
+	dataLake      storage.Store
+
+	// staged holds the names of the input files staged by the last stageInputs.
+	staged []string
+
+	// departmentStores are the remote directories of departments, by their
+	// staging directory (see stageDepartments).
+	departmentStores map[string]departmentStore
+}
+
+// departmentStore is a department's remote directory.
+type departmentStore struct {
+	// uri is the directory as configured.
+	uri   string
+	store storage.Store
+}
+
+// newStagedRun opens the remote locations of a configuration.
+//
+// PARAMETERS:
+//   - ctx: The context for storage operations.
+//   - mainConfig: The main application configuration.
+//
+// RETURNS:
+//   - The staged run. Its local configuration equals mainConfig when no
+//     directory is remote.
+//   - An error if a remote location cannot be opened.
+func newStagedRun(ctx context.Context, mainConfig *config.MainConfig) (*stagedRun, error) {
+	local := *mainConfig
+	run := &stagedRun{ctx: ctx, local: &local}
+
+	locations := []struct {
+		dir   *string
+		store *storage.Store
+		name  string
+	}{
+		{&local.InputDir, &run.input, "input"},
+		{&local.OutputDir, &run.output, "output"},
+		{&local.InputArchiveDir, &run.inputArchive, "input_archive"},
+		{&local.OutputArchiveDir, &run.outputArchive, "output_archive"},
+		{&local.DataLake.Dir, &run.dataLake, "datalake"},
+	}
+
+	for _, location := range locations {
+		if !storage.IsRemote(*location.dir) {
+			continue
+		}
+
+		store, err := storage.Open(ctx, *location.dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", *location.dir, err)
+		}
+		*location.store = store
+
+		// The converter uses the staging directory instead.
+		*location.dir = filepath.Join(mainConfig.StagingDir, location.name)
+		if err := os.MkdirAll(*location.dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create staging directory: %w", err)
+		}
+	}
+
+	return run, nil
+}
+
+// stageInputs downloads the remote input files into the staging input directory.
+//
+// RETURNS:
+//   - The number of files downloaded.
+//   - The number of files deferred because the staging volume has no room
+//     for them (see stagingRoom). They stay in the input location.
+//   - An error if the input location cannot be listed, a download fails,
+//     or the free space of the staging volume cannot be determined.
+func (r *stagedRun) stageInputs() (int, int, error) {
+	if r.input == nil {
+		return 0, 0, nil
+	}
+
+	objects, err := r.input.List(r.ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	r.staged = nil
+	wanted := make(map[string]bool)
+	downloaded, deferred := 0, 0
+
+	for _, object := range objects {
+		if !r.isInputFile(object.Name) {
+			continue
+		}
+		localPath := filepath.Join(r.local.InputDir, filepath.FromSlash(object.Name))
+
+		// Keep staged copies that are unchanged, so watch mode does not
+		// download failed files again on every scan.
+		if info, err := os.Stat(localPath); err == nil && info.Size() == object.Size && info.ModTime().Equal(object.ModTime) {
+			r.staged = append(r.staged, object.Name)
+			wanted[localPath] = true
+			continue
+		}
+
+		// A file without room is not staged; an outdated staged copy of it
+		// is removed below.
+		room, err := r.stagingRoom(object.Size)
+		if err != nil {
+			return downloaded, deferred, err
+		}
+		if !room {
+			deferred++
+			continue
+		}
+
+		r.staged = append(r.staged, object.Name)
+		wanted[localPath] = true
+		if err := r.input.Download(r.ctx, object.Name, localPath); err != nil {
+			return downloaded, deferred, err
+		}
+		// The staged copy carries the remote modification time, so the file
+		// readiness checks see remote changes.
+		os.Chtimes(localPath, object.ModTime, object.ModTime)
+		downloaded++
+	}
+
+	// Remove staged copies of files that are gone from the input location.
+	err = filepath.Walk(r.local.InputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if r.isInputFile(path) && !wanted[path] {
+			os.Remove(path)
+		}
+		return nil
+	})
+
+	return downloaded, deferred, err
+}
+
+// stagingRoom reports whether the staging input directory has room for a
+// file of the given size and still disk_space.min_free_mb (0 if the check
+// is disabled) free after it.
+func (r *stagedRun) stagingRoom(size int64) (bool, error) {
+	free, err := utils.FreeSpace(r.local.InputDir)
+	if err != nil {
+		return false, fmt.Errorf("failed to get free disk space of %s: %w", r.local.InputDir, err)
+	}
+	need := uint64(max(size, 0)) + r.local.DiskSpace.MinFreeMB<<20
+	return free >= need, nil
+}
+
+// finish uploads the staged results and removes archived files from the
+// remote input location.
+//
+// RETURNS:
+//   - An error describing every transfer that failed. Files that could not
+//     be uploaded stay staged and are uploaded by the next run.
+func (r *stagedRun) finish() error {
+	var errs []error
+
+	// Upload before deleting remote input files, so that a failure never
+	// loses an input file.
+	uploads := []struct {
+		store storage.Store
+		dir   string
+	}{
+		{r.inputArchive, r.local.InputArchiveDir},
+		{r.output, r.local.OutputDir},
+		{r.outputArchive, r.local.OutputArchiveDir},
+		{r.dataLake, r.local.DataLake.Dir},
+	}
+	for dir, remote := range r.departmentStores {
+		uploads = append(uploads, struct {
+			store storage.Store
+			dir   string
+		}{remote.store, dir})
+	}
+	for _, upload := range uploads {
+		if upload.store == nil {
+			continue
+		}
+		if err := r.uploadDir(upload.dir, upload.store); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 || r.input == nil {
+		return errors.Join(errs...)
+	}
+
+	// Staged input files that are gone were archived by the converter.
+	for _, name := range r.staged {
+		if utils.FileExists(filepath.Join(r.local.InputDir, filepath.FromSlash(name))) {
+			continue
+		}
+		if err := r.input.Delete(r.ctx, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	r.staged = nil
+
+	return errors.Join(errs...)
+}
+
+// stageDepartments replaces the object-store directories of departments
+// with staging directories, which finish uploads.
+//
+// PARAMETERS:
+//   - deptConfigs: The department configurations.
+//
+// RETURNS:
+//   - Copies of the department configurations, with staging directories
+//     in place of remote directories.
+//   - An error if a remote location cannot be opened.
+func (r *stagedRun) stageDepartments(deptConfigs map[string]*config.DepartmentConfig) (map[string]*config.DepartmentConfig, error) {
+	staged := make(map[string]*config.DepartmentConfig, len(deptConfigs))
+
+	for code, deptConfig := range deptConfigs {
+		local := *deptConfig
+
+		locations := []struct {
+			dir  *string
+			name string
+		}{
+			{&local.OutputDir, "output"},
+			{&local.InputArchiveDir, "input_archive"},
+			{&local.OutputArchiveDir, "output_archive"},
+		}
+		local.Outputs = append([]config.OutputTarget(nil), deptConfig.Outputs...)
+		for i := range local.Outputs {
+			locations = append(locations, struct {
+				dir  *string
+				name string
+			}{&local.Outputs[i].OutputDir, filepath.Join("outputs", local.Outputs[i].Name)})
+		}
+
+		for _, location := range locations {
+			if !storage.IsRemote(*location.dir) {
+				continue
+			}
+
+			dir := filepath.Join(r.local.StagingDir, "departments", code, location.name)
+			// Reopen the store if the configuration was reloaded with another URI.
+			if remote, ok := r.departmentStores[dir]; !ok || remote.uri != *location.dir {
+				store, err := storage.Open(r.ctx, *location.dir)
+				if err != nil {
+					return nil, fmt.Errorf("failed to open %s: %w", *location.dir, err)
+				}
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					return nil, fmt.Errorf("failed to create staging directory: %w", err)
+				}
+				if r.departmentStores == nil {
+					r.departmentStores = make(map[string]departmentStore)
+				}
+				r.departmentStores[dir] = departmentStore{uri: *location.dir, store: store}
+			}
+			*location.dir = dir
+		}
+
+		staged[code] = &local
+	}
+
+	return staged, nil
+}
+
+// uploadDir uploads every file in a staging directory and removes the
+// uploaded files.
+func (r *stagedRun) uploadDir(dir string, store storage.Store) error {
+	objects, err := storage.NewLocalStore(dir).List(r.ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		localPath := filepath.Join(dir, filepath.FromSlash(object.Name))
+		if err := store.Upload(r.ctx, localPath, object.Name); err != nil {
+			return fmt.Errorf("failed to upload to %s: %w", store.URI(), err)
+		}
+		os.Remove(localPath)
+	}
+	return nil
+}
+
+// isInputFile reports whether a file is staged from the input location:
+// CSV files and, when enabled, their done markers.
+func (r *stagedRun) isInputFile(name string) bool {
+	if filepath.Ext(name) == ".csv" {
+		return true
+	}
+	readiness := r.local.FileReadiness
+	return readiness.DoneMarker && strings.HasSuffix(name, readiness.DoneMarkerSuffix)
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/storage"
+)
+
+// oversizedStore is a store whose listing reports one file as larger than
+// any disk.
+type oversizedStore struct {
+	storage.Store
+	name string
+}
+
+func (s oversizedStore) List(ctx context.Context) ([]storage.Object, error) {
+	objects, err := s.Store.List(ctx)
+	for i := range objects {
+		if objects[i].Name == s.name {
+			objects[i].Size = 1 << 62
+		}
+	}
+	return objects, err
+}
+
+func TestStageInputsDefersFilesWithoutRoom(t *testing.T) {
+	remote, staging := t.TempDir(), t.TempDir()
+	for _, name := range []string{"small.csv", "huge.csv"} {
+		if err := os.WriteFile(filepath.Join(remote, name), []byte("A,B\n1,2\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An outdated copy of the file without room, from an earlier run.
+	if err := os.WriteFile(filepath.Join(staging, "huge.csv"), []byte("A\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := &stagedRun{
+		ctx:   context.Background(),
+		local: &config.MainConfig{InputDir: staging},
+		input: oversizedStore{Store: storage.NewLocalStore(remote), name: "huge.csv"},
+	}
+	downloaded, deferred, err := run.stageInputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if downloaded != 1 || deferred != 1 {
+		t.Errorf("stageInputs = %d downloaded, %d deferred; want 1, 1", downloaded, deferred)
+	}
+
+	entries, err := os.ReadDir(staging)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var staged []string
+	for _, entry := range entries {
+		staged = append(staged, entry.Name())
+	}
+	if !slices.Equal(staged, []string{"small.csv"}) || !slices.Equal(run.staged, []string{"small.csv"}) {
+		t.Errorf("staged %v (recorded %v), want only small.csv", staged, run.staged)
+	}
+}
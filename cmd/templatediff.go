@@ -0,0 +1,152 @@
+// =============================================================================
+// CSV to XML Converter - Template Diff Command
+// =============================================================================
+//
+// This file defines the 'template diff' command, which compares two versions
+// of a template and flags the changes that can make files fail, so a new
+// template is reviewed before it goes live.
+//
+// COMMAND USAGE:
+//   converter template diff <old.xlsx> <new.xlsx> [--json]
+//
+// FLAGS:
+//   --json : Print the changes as a JSON array instead of text
+//
+// EXIT CODES:
+//   0 if the new template is compatible, 2 if it has breaking changes.
+//   See xlsxparser.Diff for what counts as breaking.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// templateDiffJSON prints the changes as JSON.
+var templateDiffJSON bool
+
+// =============================================================================
+// TEMPLATE DIFF COMMAND DEFINITION
+// =============================================================================
+
+// templateDiffCmd represents the 'template diff' command.
+var templateDiffCmd = &cobra.Command{
+	Use:   "diff <old.xlsx> <new.xlsx>",
+	Short: "Compare two templates and flag breaking changes",
+	Long: `Compares two versions of a template field by field: added and removed fields,
+and changes to max length, requiredness, data type, XML tag, parent, default,
+and order.
+
+A change is BREAKING if a CSV file that passes the old template can fail the
+new one: a required field without a default was added, a max length was
+tightened, a field became required (or conditional), or a data type changed.
+The command exits with code 2 if there are breaking changes.
+
+Example:
+  converter template diff templates/payments.xlsx new/payments.xlsx`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runTemplateDiff(args[0], args[1])
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the template diff command and sets up flags.
+func init() {
+	templatesCmd.AddCommand(templateDiffCmd)
+
+	templateDiffCmd.Flags().BoolVar(
+		&templateDiffJSON,
+		"json",
+		false,
+		"Print the changes as JSON",
+	)
+}
+
+// =============================================================================
+// TEMPLATE DIFF FUNCTION
+// =============================================================================
+
+// runTemplateDiff prints the differences between two templates.
+//
+// PARAMETERS:
+//   - oldPath: The current template.
+//   - newPath: The new template.
+//
+// RETURNS:
+//   - An error carrying exit code 2 if there are breaking changes, or an
+//     error if a template cannot be parsed.
+func runTemplateDiff(oldPath, newPath string) error {
+	before, err := xlsxparser.Parse(oldPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", oldPath, err)
+	}
+
+	after, err := xlsxparser.Parse(newPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", newPath, err)
+	}
+
+	changes := xlsxparser.Diff(before, after)
+
+	breaking := 0
+	for _, change := range changes {
+		if change.Breaking {
+			breaking++
+		}
+	}
+
+	if templateDiffJSON {
+		if changes == nil {
+			changes = []xlsxparser.Change{}
+		}
+		if err := printListJSON(changes); err != nil {
+			return err
+		}
+	} else {
+		if before.Version != "" || after.Version != "" {
+			fmt.Printf("Version: %s -> %s\n\n", versionOrNone(before.Version), versionOrNone(after.Version))
+		}
+
+		if len(changes) == 0 {
+			fmt.Println("No differences.")
+		}
+		for _, change := range changes {
+			marker := " "
+			if change.Breaking {
+				marker = "!"
+			}
+			fmt.Printf("%s %-20s %s\n", marker, change.Field, change.Description)
+		}
+		if len(changes) > 0 {
+			fmt.Printf("\n%d change(s), %d breaking (marked !)\n", len(changes), breaking)
+		}
+	}
+
+	if breaking > 0 {
+		return &exitError{exitValidationFailed, fmt.Errorf("%d breaking change(s)", breaking)}
+	}
+	return nil
+}
+
+// versionOrNone returns the version, or "(none)" if it is empty.
+func versionOrNone(version string) string {
+	if version == "" {
+		return "(none)"
+	}
+	return version
+}
@@ -0,0 +1,165 @@
+// =============================================================================
+// CSV to XML Converter - Template From-XSD Command
+// =============================================================================
+//
+// This file defines the 'template from-xsd' command, which builds a starter
+// XLSX template from the XML Schema of a target system (see
+// xlsxparser.FromXSD). Analysts then replace the placeholder Old Headers
+// with the CSV headers and review the rest.
+//
+// COMMAND USAGE:
+//   converter template from-xsd <schema.xsd> [--output FILE] [--root NAME] [--force]
+//
+// FLAGS:
+//   --output : The template to write (default: the XSD's name with .xlsx)
+//   --root   : The root element (default: the first top-level element no
+//              other element refers to)
+//   --force  : Overwrite an existing template
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+var (
+	// fromXSDOutput is the template to write.
+	fromXSDOutput string
+
+	// fromXSDRoot is the root element of the XSD.
+	fromXSDRoot string
+
+	// fromXSDForce overwrites an existing template.
+	fromXSDForce bool
+)
+
+// =============================================================================
+// TEMPLATE FROM-XSD COMMAND DEFINITION
+// =============================================================================
+
+// templateFromXSDCmd represents the 'template from-xsd' command.
+var templateFromXSDCmd = &cobra.Command{
+	Use:   "from-xsd <schema.xsd>",
+	Short: "Build a starter template from a vendor XSD",
+	Long: `Builds a starter XLSX template from the XML Schema of a target system.
+
+The root element's simple children become cashbook fields, its first
+element with children the transaction, and the transaction's first element
+with children the line item. Each field gets its XML tag, data type, max length, requiredness
+(from minOccurs), and order, plus the template's optional columns where the
+XSD uses them: Default, Fixed, Nillable, Pattern (also for enumerations),
+and Repeat. Element documentation becomes the Notes.
+
+The Old Header of every field is its XML tag, as a placeholder: replace it
+with the CSV header before using the template. Parts of the XSD a template
+cannot express, such as attributes and deeper nesting, are listed as
+warnings.
+
+Example:
+  converter template from-xsd vendor/payments.xsd --output templates/payments.xlsx`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runTemplateFromXSD(args[0])
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the template from-xsd command and sets up flags.
+func init() {
+	templatesCmd.AddCommand(templateFromXSDCmd)
+
+	templateFromXSDCmd.Flags().StringVar(
+		&fromXSDOutput,
+		"output",
+		"",
+		"Template to write (default: the XSD's name with .xlsx)",
+	)
+
+	templateFromXSDCmd.Flags().StringVar(
+		&fromXSDRoot,
+		"root",
+		"",
+		"Root element of the XSD (default: detected)",
+	)
+
+	templateFromXSDCmd.Flags().BoolVar(
+		&fromXSDForce,
+		"force",
+		false,
+		"Overwrite an existing template",
+	)
+}
+
+// =============================================================================
+// TEMPLATE FROM-XSD FUNCTION
+// =============================================================================
+
+// runTemplateFromXSD writes the starter template of an XSD.
+//
+// PARAMETERS:
+//   - xsdPath: The XSD.
+//
+// RETURNS:
+//   - An error if the XSD cannot be read or imported, or the template
+//     exists (without --force) or cannot be written.
+func runTemplateFromXSD(xsdPath string) error {
+	output := fromXSDOutput
+	if output == "" {
+		output = strings.TrimSuffix(xsdPath, filepath.Ext(xsdPath)) + ".xlsx"
+	}
+	if _, err := os.Stat(output); err == nil && !fromXSDForce {
+		return fmt.Errorf("%s already exists (use --force to overwrite)", output)
+	}
+
+	in, err := os.Open(xsdPath)
+	if err != nil {
+		return fmt.Errorf("failed to open XSD: %w", err)
+	}
+	defer in.Close()
+
+	schema, warnings, err := xlsxparser.FromXSD(in, fromXSDRoot)
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", xsdPath, err)
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+	if err := xlsxparser.Write(out, schema); err != nil {
+		out.Close()
+		os.Remove(output)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write template: %w", err)
+	}
+
+	fmt.Printf("%s -> %s: %d cashbook, %d transaction, %d line item field(s)\n",
+		xsdPath, output, len(schema.CashbookFields), len(schema.TransactionFields), len(schema.LineItemFields))
+	if len(warnings) > 0 {
+		fmt.Printf("\n%d warning(s):\n", len(warnings))
+		for _, warning := range warnings {
+			fmt.Printf("  - %s\n", warning)
+		}
+	}
+	fmt.Println("\nReplace the Old Header of each field (column A) with its CSV header before using the template.")
+	return nil
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"runtime"
 
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
 	"github.com/spf13/cobra"
 )
 
@@ -64,4 +65,7 @@ var versionCmd = &cobra.Command{
 // init registers the version command with the root command.
 func init() {
 	rootCmd.AddCommand(versionCmd)
+
+	// Make the version available to the {version} placeholder.
+	converter.Version = Version
 }
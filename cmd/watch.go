@@ -0,0 +1,410 @@
+// =============================================================================
+// CSV to XML Converter - Watch Command
+// =============================================================================
+//
+// This file defines the 'watch' command, which runs the converter as a
+// long-running daemon. It polls the input directory at a fixed interval and
+// converts any files found, exactly like 'converter process'.
+//
+// COMMAND USAGE:
+//   converter watch [flags]
+//
+// FLAGS:
+//   --interval     : How often to scan the input directory (default 30s)
+//   --workdir      : Directory to change to before loading the configuration
+//   --system-log   : Also log to syslog (Linux) or the Windows Event Log
+//   --service-name : Service name / log source (default "csv2xml")
+//
+// RUNNING AS A SERVICE:
+//   Use 'converter service install' to register this command as a Windows
+//   service or systemd unit. See cmd/service.go.
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/archivecrypt"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/audit"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/events"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/logging"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/schedule"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/service"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// watchInterval is how often the input directory is scanned.
+var watchInterval time.Duration
+
+// watchWorkDir is the directory to change to before loading the configuration.
+var watchWorkDir string
+
+// watchSystemLog forwards log messages to syslog or the Windows Event Log.
+var watchSystemLog bool
+
+// watchServiceName is the service name and system log source.
+var watchServiceName string
+
+// =============================================================================
+// WATCH COMMAND DEFINITION
+// =============================================================================
+
+// watchCmd represents the 'watch' command.
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Continuously watch the input directory and convert new files",
+	Long: `The watch command runs the converter as a daemon. It scans the input
+directory at a fixed interval and processes every file found, exactly like the
+process command. Changed department configurations and templates are
+validated and swapped in between scans, without a restart; invalid changes
+are rejected and the previous version stays in use. Both are recorded in the
+audit trail. Changes to the main configuration file need a restart.
+
+With health_addr set in the main configuration, /healthz and /readyz are
+served for load balancers and orchestrators.
+
+Stop the watcher with Ctrl+C. To run it in the background at boot, install it
+as a Windows service or systemd unit with 'converter service install'.`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runWatch()
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the watch command with the root command and sets up flags.
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	// --interval flag: How often to scan the input directory.
+	watchCmd.Flags().DurationVar(
+		&watchInterval,
+		"interval",
+		30*time.Second,
+		"How often to scan the input directory",
+	)
+
+	// --workdir flag: Directory to run in (services do not start in the install directory).
+	watchCmd.Flags().StringVar(
+		&watchWorkDir,
+		"workdir",
+		"",
+		"Directory to change to before loading the configuration",
+	)
+
+	// --system-log flag: Forward log messages to the operating system log.
+	watchCmd.Flags().BoolVar(
+		&watchSystemLog,
+		"system-log",
+		false,
+		"Also log to syslog (Linux) or the Windows Event Log (always on when running as a Windows service)",
+	)
+
+	// --service-name flag: Service name and system log source.
+	watchCmd.Flags().StringVar(
+		&watchServiceName,
+		"service-name",
+		service.DefaultName,
+		"Service name, also used as the syslog tag / Event Log source",
+	)
+	// Hidden flags that inject failures for integration tests.
+	addFaultFlags(watchCmd)
+}
+
+// =============================================================================
+// MAIN WATCH FUNCTION
+// =============================================================================
+
+// runWatch loads the configuration and scans the input directory until stopped.
+func runWatch() error {
+	if watchWorkDir != "" {
+		if err := os.Chdir(watchWorkDir); err != nil {
+			return fmt.Errorf("failed to change to working directory: %w", err)
+		}
+	}
+
+	if watchInterval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	mainConfig, err := config.LoadMainConfig(cfgFile)
+	if err != nil {
+		return fmt.Errorf("failed to load main config: %w", err)
+	}
+
+	// Report a missing archive key before any file is converted.
+	if err := archivecrypt.CheckKey(mainConfig.ArchiveEncryption); err != nil {
+		return err
+	}
+
+	// Set up logging.
+	logger, err := newLogger(mainConfig, logging.Options{
+		SystemLog: watchSystemLog || service.IsService(),
+		Source:    watchServiceName,
+	})
+	if err != nil {
+		return err
+	}
+	defer logger.Close()
+
+	// Object-store directories (s3://, az://) are staged locally.
+	run, err := newStagedRun(context.Background(), mainConfig)
+	if err != nil {
+		return err
+	}
+
+	trail, err := audit.Open(mainConfig.AuditLog)
+	if err != nil {
+		return err
+	}
+
+	publisher, err := events.New(mainConfig.Events)
+	if err != nil {
+		return fmt.Errorf("failed to set up event publishing: %w", err)
+	}
+	if publisher != nil {
+		defer publisher.Close()
+	}
+
+	// The schedule remembers recent releases between scans.
+	sched, err := newSchedule(mainConfig)
+	if err != nil {
+		return err
+	}
+
+	// Readiness follows the scans. See cmd/health.go.
+	health := &watchHealth{}
+	if mainConfig.HealthAddr != "" {
+		server, err := startHealthServer(mainConfig.HealthAddr, health, logger)
+		if err != nil {
+			return err
+		}
+		defer stopHealthServer(server)
+	}
+
+	return service.Run(watchServiceName, func(stop <-chan struct{}) error {
+		logger.Info("Watching %s every %s", mainConfig.InputDir, watchInterval)
+
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		// The readiness checker remembers file sizes between scans.
+		checker := utils.NewReadinessChecker(readinessOptions(mainConfig))
+
+		// The reloader keeps the department configurations and templates
+		// current. See cmd/reload.go.
+		reloader := newConfigReloader(mainConfig)
+
+		// The session tracks the files for a graceful shutdown. See
+		// cmd/shutdown.go.
+		session := newWatchSession()
+
+		for {
+			// The scan runs in the background, so a stop can drain it.
+			done := make(chan error, 1)
+			go func() {
+				done <- watchScan(run, reloader, sched, checker, trail, publisher, session, stop, logger)
+			}()
+
+			select {
+			case err := <-done:
+				if err != nil {
+					logger.Error("%v", err)
+				}
+				health.scanFinished(err)
+			case <-stop:
+				health.stop()
+				drainWatch(done, session, mainConfig, logger)
+				logger.Info("Watcher stopped")
+				return nil
+			}
+
+			select {
+			case <-stop:
+				health.stop()
+				drainWatch(nil, session, mainConfig, logger)
+				logger.Info("Watcher stopped")
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// =============================================================================
+// HELPER FUNCTIONS
+// =============================================================================
+
+// watchScan runs a single scan of the input directory and waits for all
+// files to be converted.
+//
+// PARAMETERS:
+//   - run: The main application configuration and its staged object-store
+//     directories.
+//   - reloader: Provides the current department configurations and templates.
+//   - sched: The delivery schedule of held output files, or nil.
+//   - checker: Skips files that are still being copied.
+//   - trail: The audit trail.
+//   - publisher: The publisher for conversion events, or nil.
+//   - session: Tracks the files for a graceful shutdown.
+//   - stop: Closed when the watcher is stopping; no new file is started.
+//   - logger: The logger for progress and results.
+//
+// RETURNS:
+//   - An error if the scan could not look for files: the configuration
+//     could not be loaded, or the input directory could not be locked,
+//     staged, or read. Files that fail are logged and audited instead.
+func watchScan(run *stagedRun, reloader *configReloader, sched *schedule.Schedule, checker *utils.ReadinessChecker, trail *audit.Trail, publisher events.Publisher, session *watchSession, stop <-chan struct{}, logger *logging.Logger) error {
+	mainConfig := run.local
+
+	// Pick up changed department configurations and templates.
+	configs, err := reloader.load(trail, logger)
+	if err != nil {
+		return err
+	}
+	deptConfigs, err := run.stageDepartments(configs.departments)
+	if err != nil {
+		return fmt.Errorf("failed to open department directories: %w", err)
+	}
+
+	// Skip this scan while another run is processing the input directory.
+	runLock, err := acquireRunLock(mainConfig)
+	if errors.Is(err, utils.ErrLocked) {
+		logger.Info("Another run is processing %s; skipping this scan", mainConfig.InputDir)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock input directory: %w", err)
+	}
+	if runLock != nil {
+		defer runLock.Release()
+	}
+
+	// Pause while the output or archive volumes are low on space. See
+	// internal/converter/diskspace.go.
+	if err := converter.CheckDiskSpace(converter.DiskSpaceDirs(mainConfig, deptConfigs), mainConfig.DiskSpace); err != nil {
+		return err
+	}
+
+	downloaded, deferred, err := run.stageInputs()
+	if err != nil {
+		return fmt.Errorf("failed to stage input files: %w", err)
+	}
+	if downloaded > 0 {
+		logger.Debug("Downloaded %d file(s) from %s", downloaded, run.input.URI())
+	}
+	if deferred > 0 {
+		logger.Warn("%d file(s) in %s left for a later scan: not enough free space in %s",
+			deferred, run.input.URI(), mainConfig.InputDir)
+	}
+
+	// Upload results to object storage and remove archived remote inputs.
+	defer func() {
+		if err := run.finish(); err != nil {
+			logger.Error("Failed to transfer files to object storage: %v", err)
+		}
+	}()
+
+	// Release held output files, including the ones converted by this scan,
+	// before the upload. Files the rate limit holds back wait for the next
+	// scan.
+	if sched != nil {
+		defer func() {
+			logRelease(logger, releaseHeldOutputs(sched, mainConfig, deptConfigs, false))
+		}()
+	}
+
+	// A stop cancels the scan: files not started by then are left for the
+	// next start.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	processor := converter.NewProcessor(deptConfigs, mainConfig)
+	processor.SetTemplates(configs.templates)
+	processor.SetLogger(logger)
+	processor.SetAuditTrail(trail)
+	processor.SetFaults(injectedFaults())
+	if publisher != nil {
+		processor.SetPublisher(publisher)
+	}
+
+	options := converter.ProcessOptions{
+		Ready: func(files []string) []string {
+			// Files that are not ready are checked again on the next scan.
+			files, waiting := checker.Check(files)
+			for file, reason := range waiting {
+				logger.Debug("Not ready: %s (%s)", filepath.Base(file), reason)
+			}
+			if len(files) > 0 {
+				logger.Info("Found %d file(s) to process", len(files))
+				session.scanning(files)
+			}
+			return files
+		},
+	}
+
+	notStarted, aborted := 0, 0
+	err = processor.ProcessDirectory(ctx, options, func(result converter.Result) {
+		session.record(result)
+		if errors.Is(result.Error, converter.ErrStopping) {
+			notStarted++
+			return
+		}
+		if errors.Is(result.Error, converter.ErrAborted) {
+			aborted++
+			return
+		}
+
+		if err := recordAudit(trail, result); err != nil {
+			logger.Error("%v", err)
+		}
+
+		if result.Skipped {
+			logger.Info("Skipped %s: %v", filepath.Base(result.FilePath), result.Error)
+		} else if result.Success {
+			logger.Info("Converted %s -> %s (%d rows)", filepath.Base(result.FilePath), strings.Join(result.OutputFiles, ", "), result.Stats.RowsProcessed)
+			if result.Delivery != nil {
+				logger.Info("Delivered %s to %s (batch ID: %s)", filepath.Base(result.OutputFile), result.Delivery.Target, result.Delivery.BatchID)
+			}
+		} else {
+			logger.Error("Failed to convert %s: %v", filepath.Base(result.FilePath), result.Error)
+			// Retry once the file or its fix-up file changes.
+			checker.MarkFailed(result.FilePath, converter.FixupPathFor(result.FilePath))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if notStarted > 0 {
+		logger.Info("Stopping: %d file(s) left in the input directory for the next start", notStarted)
+	}
+	if aborted > 0 {
+		logger.Error("Scan aborted by a failure policy: %d file(s) left in the input directory for the next scan", aborted)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// =============================================================================
+// CSV to XML Converter - XSD Command
+// =============================================================================
+//
+// This file defines the 'xsd' command and its 'generate' subcommand, which
+// writes an XML Schema for each template, describing the documents the
+// converter produces with it (see xmlwriter.GenerateXSD).
+//
+// COMMAND USAGE:
+//   converter xsd generate [template.xlsx...] [--dir DIR]
+//
+// FLAGS:
+//   --dir : Directory to write the schemas to (default: ./xsd)
+//
+// =============================================================================
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// COMMAND FLAGS
+// =============================================================================
+
+// xsdDir is the directory the schemas are written to.
+var xsdDir string
+
+// =============================================================================
+// XSD COMMAND DEFINITION
+// =============================================================================
+
+// xsdCmd represents the 'xsd' command.
+var xsdCmd = &cobra.Command{
+	Use:   "xsd",
+	Short: "Work with XML Schemas",
+}
+
+// xsdGenerateCmd represents the 'xsd generate' command.
+var xsdGenerateCmd = &cobra.Command{
+	Use:   "generate [template.xlsx...]",
+	Short: "Write an XSD for each template",
+	Long: `Writes an XML Schema for each template the departments use, or for the
+given templates (names in the templates directory, or paths), as
+"<template>.xsd" in the --dir directory (default ./xsd).
+
+The schema has the template's structure as the first department using it
+(in department code order) lays it out: with its static fields, document
+header, batch elements, and root attributes. A warning names the other
+departments whose layout differs. For each field, the schema has its
+requiredness, max length, total and fraction digits, date format, pattern,
+and default, fixed, and nillable values. A field whose last transformation
+is a lookup_with_default, in every department using the template, is
+restricted to the lookup's values.
+
+Examples:
+  converter xsd generate
+  converter xsd generate payments.xlsx --dir /tmp/xsd`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runXSDGenerate(args)
+	},
+}
+
+// =============================================================================
+// INITIALIZATION
+// =============================================================================
+
+// init registers the xsd command and sets up flags.
+func init() {
+	rootCmd.AddCommand(xsdCmd)
+	xsdCmd.AddCommand(xsdGenerateCmd)
+
+	xsdGenerateCmd.Flags().StringVar(
+		&xsdDir,
+		"dir",
+		"./xsd",
+		"Directory to write the schemas to",
+	)
+}
+
+// =============================================================================
+// COMMAND EXECUTION
+// =============================================================================
+
+// runXSDGenerate writes the schemas.
+//
+// PARAMETERS:
+//   - templates: The templates to write schemas for; all templates used by
+//     the departments if empty.
+//
+// RETURNS:
+//   - An error if the configuration cannot be loaded, or a template cannot
+//     be parsed or its schema written. Schemas are written until the first
+//     failure.
+func runXSDGenerate(templates []string) error {
+	mainConfig, deptConfigs, err := loadListConfig()
+	if err != nil {
+		return err
+	}
+
+	// The departments using each template, for enumerations.
+	users := make(map[string][]*config.DepartmentConfig)
+	var used []string
+	for _, code := range converter.DepartmentCodes(deptConfigs) {
+		for _, template := range deptConfigs[code].Templates() {
+			if users[template] == nil {
+				used = append(used, template)
+			}
+			users[template] = append(users[template], deptConfigs[code])
+		}
+	}
+
+	if len(templates) == 0 {
+		templates = used
+		if len(templates) == 0 {
+			fmt.Printf("No templates are used by the department configurations in %s\n", mainConfig.ConfigsDir)
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(xsdDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	for _, template := range templates {
+		path := template
+		if _, err := os.Stat(path); err != nil {
+			path = filepath.Join(mainConfig.TemplatesDir, template)
+		}
+		name := filepath.Base(path)
+
+		schema, err := xlsxparser.Parse(path)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+
+		xsd, err := xmlwriter.GenerateXSD(schema, users[name]...)
+		if err != nil {
+			return fmt.Errorf("failed to generate XSD for %s: %w", name, err)
+		}
+
+		output := filepath.Join(xsdDir, strings.TrimSuffix(name, filepath.Ext(name))+".xsd")
+		if err := os.WriteFile(output, xsd, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", output, err)
+		}
+		fmt.Printf("%s -> %s\n", path, output)
+
+		// The schema has the first department's layout.
+		for i, deptConfig := range users[name] {
+			if i > 0 && !sameXSDLayout(users[name][0], deptConfig) {
+				fmt.Printf("  Warning: laid out as department %s's output; %s's output differs and may not validate\n",
+					users[name][0].DepartmentCode, deptConfig.DepartmentCode)
+			}
+		}
+	}
+	return nil
+}
+
+// sameXSDLayout reports whether two departments lay out a template's
+// documents the same way: with the same static fields, document header,
+// batches, and xml_output settings (see xmlwriter.GenerateXSD).
+func sameXSDLayout(a, b *config.DepartmentConfig) bool {
+	return reflect.DeepEqual(a.StaticFields, b.StaticFields) &&
+		a.DocumentHeader.Enabled == b.DocumentHeader.Enabled &&
+		a.DocumentHeader.RenderAs == b.DocumentHeader.RenderAs &&
+		a.DocumentHeader.Element == b.DocumentHeader.Element &&
+		reflect.DeepEqual(a.DocumentHeader.Fields, b.DocumentHeader.Fields) &&
+		reflect.DeepEqual(a.BatchGrouping, b.BatchGrouping) &&
+		reflect.DeepEqual(a.XMLOutput, b.XMLOutput)
+}
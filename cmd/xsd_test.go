@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestXSDValidatesOutput converts a file with static fields, a document
+// header, and batches, and validates the output against the generated XSD
+// with xmllint.
+func TestXSDValidatesOutput(t *testing.T) {
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint is not installed")
+	}
+
+	tree := newTestTree(t)
+	tree.write("configs/claims.yaml", testDepartmentConfig+`  - xml_tag: Invoice
+    value: "{field:INVOICE_NO}"
+    parent_tag: lineItem
+    order: 3
+  - xml_tag: Created
+    value: "{today}"
+    parent_tag: cashbook
+document_header:
+  enabled: true
+  element: Header
+  fields:
+    - name: FileName
+      value: "{filename}"
+batch_grouping:
+  group_by_field: PAYEE_NAME
+  key_element: Payee
+  count_element: Checks
+  line_item_count_element: Items
+  totals:
+    - xml_tag: Total
+      field: CHECK_AMT
+      scope: transactions
+xml_output:
+  root_attributes:
+    xmlns: http://example.com/cashbook
+    version: "2"
+`)
+	tree.write("input/claims_payments.csv", testPaymentsCSV)
+
+	if _, code, err := tree.process(); err != nil || code != 0 {
+		t.Fatalf("process: exit code %d, error %v", code, err)
+	}
+
+	savedDir := xsdDir
+	xsdDir = "xsd"
+	t.Cleanup(func() { xsdDir = savedDir })
+	if err := runXSDGenerate(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	output := tree.find("output", "CLAIMS_claims_payments")
+	xsd := filepath.Join(tree.dir, "xsd", "payments.xsd")
+	if result, err := exec.Command(xmllint, "--noout", "--schema", xsd, output).CombinedOutput(); err != nil {
+		t.Errorf("output does not validate against the XSD: %v\n%s", err, result)
+	}
+}
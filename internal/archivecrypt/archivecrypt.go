@@ -0,0 +1,336 @@
+// =============================================================================
+// CSV to XML Converter - Archive Encryption
+// =============================================================================
+//
+// Archived input files contain personal data, and archive shares often have
+// broad read access. With archive encryption, input files are encrypted with
+// AES-256-GCM before they are archived, as "<name>.enc":
+//
+//   archive_encryption:
+//     key_env: CSV2XML_ARCHIVE_KEY     # base64-encoded 32-byte key
+//     # or
+//     kms_key_id: alias/csv2xml-archive
+//
+// With kms_key_id, AWS KMS generates a data key for every file, and the
+// encrypted data key is stored in the file header. Decrypting the file
+// ('converter archive decrypt') asks KMS to decrypt the data key, so access
+// is controlled by the KMS key policy.
+//
+// FILE FORMAT:
+//   magic "C2XENC" | version (1) | key source (1: key_env, 2: KMS)
+//   [KMS only: data key length (2, big endian) | encrypted data key]
+//   nonce prefix (7)
+//   chunks: up to 64 KiB of plaintext each, sealed with the nonce
+//           prefix | chunk counter (4, big endian) | last-chunk flag (1),
+//           and the header as additional data
+//
+// Chunks keep memory use flat for large files. The counter and the
+// last-chunk flag detect reordered, dropped, or truncated chunks.
+//
+// =============================================================================
+
+package archivecrypt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+)
+
+// Suffix is appended to the name of an encrypted file.
+const Suffix = ".enc"
+
+const (
+	magic        = "C2XENC"
+	version      = 1
+	sourceEnv    = 1
+	sourceKMS    = 2
+	chunkSize    = 64 * 1024
+	prefixLength = 7
+)
+
+// ErrNotEncrypted is returned for a file that is not an encrypted archive.
+var ErrNotEncrypted = errors.New("not an encrypted archive file")
+
+// CheckKey verifies that the configured key can be used, so a missing key
+// is reported before files are converted rather than when they are
+// archived. A KMS key is only checked when it is used.
+func CheckKey(settings config.ArchiveEncryptionSettings) error {
+	if settings.KeyEnv == "" {
+		return nil
+	}
+	_, err := envKey(settings.KeyEnv)
+	return err
+}
+
+// EncryptFile encrypts a file.
+//
+// PARAMETERS:
+//   - ctx: Cancels a KMS request.
+//   - settings: The archive encryption settings.
+//   - src: The file to encrypt.
+//   - dst: The encrypted file to write.
+//
+// RETURNS:
+//   - An error if the key is not available or a file cannot be read or
+//     written. dst is removed on failure.
+func EncryptFile(ctx context.Context, settings config.ArchiveEncryptionSettings, src, dst string) error {
+	var key []byte
+	header := []byte(magic)
+	header = append(header, version)
+
+	if settings.KMSKeyID != "" {
+		client, err := kmsClient(ctx)
+		if err != nil {
+			return err
+		}
+		output, err := client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+			KeyId:   aws.String(settings.KMSKeyID),
+			KeySpec: kmstypes.DataKeySpecAes256,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to generate data key: %w", err)
+		}
+		key = output.Plaintext
+		header = append(header, sourceKMS)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(output.CiphertextBlob)))
+		header = append(header, output.CiphertextBlob...)
+	} else {
+		var err error
+		if key, err = envKey(settings.KeyEnv); err != nil {
+			return err
+		}
+		header = append(header, sourceEnv)
+	}
+
+	prefix := make([]byte, prefixLength)
+	if _, err := rand.Read(prefix); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	header = append(header, prefix...)
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer in.Close()
+
+	return writeFile(dst, func(out io.Writer) error {
+		if _, err := out.Write(header); err != nil {
+			return err
+		}
+
+		reader := bufio.NewReaderSize(in, chunkSize)
+		plaintext := make([]byte, chunkSize)
+		for counter := uint32(0); ; counter++ {
+			n, err := io.ReadFull(reader, plaintext)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+			last := n < chunkSize
+			if !last {
+				if _, err := reader.Peek(1); err == io.EOF {
+					last = true
+				}
+			}
+
+			sealed := aead.Seal(nil, nonce(prefix, counter, last), plaintext[:n], header)
+			if _, err := out.Write(sealed); err != nil {
+				return err
+			}
+			if last {
+				return nil
+			}
+		}
+	})
+}
+
+// DecryptFile decrypts a file written by EncryptFile.
+//
+// PARAMETERS:
+//   - ctx: Cancels a KMS request.
+//   - settings: The archive encryption settings. A file encrypted with
+//     key_env needs the key in the environment variable; a file encrypted
+//     with KMS needs only AWS credentials.
+//   - src: The encrypted file.
+//   - dst: The decrypted file to write.
+//
+// RETURNS:
+//   - ErrNotEncrypted if src is not an encrypted archive file, or another
+//     error if it cannot be decrypted. dst is removed on failure.
+func DecryptFile(ctx context.Context, settings config.ArchiveEncryptionSettings, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer in.Close()
+	reader := bufio.NewReaderSize(in, chunkSize+16)
+
+	header := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(reader, header); err != nil || !bytes.HasPrefix(header, []byte(magic)) {
+		return ErrNotEncrypted
+	}
+	if header[len(magic)] != version {
+		return fmt.Errorf("unsupported archive encryption version %d", header[len(magic)])
+	}
+
+	var key []byte
+	switch header[len(magic)+1] {
+	case sourceEnv:
+		if settings.KeyEnv == "" {
+			return fmt.Errorf("file is encrypted with a key from the environment, but archive_encryption.key_env is not set")
+		}
+		if key, err = envKey(settings.KeyEnv); err != nil {
+			return err
+		}
+
+	case sourceKMS:
+		var length [2]byte
+		if _, err := io.ReadFull(reader, length[:]); err != nil {
+			return fmt.Errorf("failed to read header: %w", err)
+		}
+		blob := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(reader, blob); err != nil {
+			return fmt.Errorf("failed to read header: %w", err)
+		}
+		header = append(append(header, length[:]...), blob...)
+
+		client, err := kmsClient(ctx)
+		if err != nil {
+			return err
+		}
+		output, err := client.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: blob})
+		if err != nil {
+			return fmt.Errorf("failed to decrypt data key: %w", err)
+		}
+		key = output.Plaintext
+
+	default:
+		return fmt.Errorf("unknown key source %d", header[len(magic)+1])
+	}
+
+	prefix := make([]byte, prefixLength)
+	if _, err := io.ReadFull(reader, prefix); err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	header = append(header, prefix...)
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(dst, func(out io.Writer) error {
+		sealed := make([]byte, chunkSize+aead.Overhead())
+		for counter := uint32(0); ; counter++ {
+			n, err := io.ReadFull(reader, sealed)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+			last := n < len(sealed)
+			if !last {
+				if _, err := reader.Peek(1); err == io.EOF {
+					last = true
+				}
+			}
+
+			plaintext, err := aead.Open(nil, nonce(prefix, counter, last), sealed[:n], header)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt file (wrong key, or the file is damaged): %w", err)
+			}
+			if _, err := out.Write(plaintext); err != nil {
+				return err
+			}
+			if last {
+				return nil
+			}
+		}
+	})
+}
+
+// envKey reads the base64-encoded AES-256 key from an environment variable.
+func envKey(name string) ([]byte, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, fmt.Errorf("archive encryption key: environment variable %s is not set", name)
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("archive encryption key in %s is not base64: %w", name, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("archive encryption key in %s must be 32 bytes, not %d", name, len(key))
+	}
+	return key, nil
+}
+
+// kmsClient creates an AWS KMS client from the environment.
+func kmsClient(ctx context.Context) (*kms.Client, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	return kms.NewFromConfig(cfg), nil
+}
+
+// newAEAD creates the AES-GCM cipher for a key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce returns the nonce of a chunk.
+func nonce(prefix []byte, counter uint32, last bool) []byte {
+	n := make([]byte, 0, prefixLength+5)
+	n = append(n, prefix...)
+	n = binary.BigEndian.AppendUint32(n, counter)
+	if last {
+		return append(n, 1)
+	}
+	return append(n, 0)
+}
+
+// writeFile creates path and writes it with write, removing it on failure.
+func writeFile(path string, write func(out io.Writer) error) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	buffered := bufio.NewWriter(out)
+	err = write(buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
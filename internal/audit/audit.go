@@ -0,0 +1,150 @@
+// =============================================================================
+// CSV to XML Converter - Audit Trail
+// =============================================================================
+//
+// The audit trail records what happened to every input file: when it was
+// converted, which output it produced, and where it was delivered (including
+// the batch ID assigned by the target system). Failed and skipped files are
+// recorded as well, and so are the configuration changes the watch command
+// applies or rejects, and the conversions the serve command performs for
+// its callers.
+//
+// The trail is a JSON Lines file (one JSON object per line) that is only
+// ever appended to, so it can be read with standard tools:
+//
+//   {"time":"2024-01-15T10:30:00Z","event":"converted","file":"claims_payments.csv",...}
+//
+// The transaction keys of the output files are indexed next to the trail
+// (see keys.go).
+//
+// =============================================================================
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	EventConverted = "converted"
+	EventFailed    = "failed"
+	EventSkipped   = "skipped"
+
+	// EventConfigChanged and EventConfigRejected record department
+	// configurations and templates that were changed while the watch
+	// command was running, and were applied or rejected as invalid.
+	EventConfigChanged  = "config_changed"
+	EventConfigRejected = "config_rejected"
+
+	// EventServed records a conversion requested from the serve command,
+	// with its caller.
+	EventServed = "served"
+)
+
+// Entry is a single audit record.
+type Entry struct {
+	Time         time.Time `json:"time"`
+	Event        string    `json:"event"`
+	File         string    `json:"file,omitempty"`
+	Department   string    `json:"department,omitempty"`
+	OutputFile   string    `json:"output_file,omitempty"`
+	Rows         int       `json:"rows,omitempty"`
+	Transactions int       `json:"transactions,omitempty"`
+
+	// OutputFiles lists the output files of a file converted to several
+	// documents (see the department's template_selector). OutputFile is
+	// the first.
+	OutputFiles []string `json:"output_files,omitempty"`
+
+	// RejectedTransactions is the number of transactions that failed
+	// validation and were written to RejectedFiles instead of the output.
+	RejectedTransactions int      `json:"rejected_transactions,omitempty"`
+	RejectedFiles        []string `json:"rejected_files,omitempty"`
+
+	// ReviewFile is the annotated review XML of a file with validation errors.
+	ReviewFile string `json:"review_file,omitempty"`
+
+	// Template and TemplateVersion identify the template used.
+	Template        string `json:"template,omitempty"`
+	TemplateVersion string `json:"template_version,omitempty"`
+
+	// BytesIn and BytesOut are the sizes of the input and output files.
+	BytesIn  int64 `json:"bytes_in,omitempty"`
+	BytesOut int64 `json:"bytes_out,omitempty"`
+
+	// DurationMS is the total processing time, and StagesMS the time taken
+	// by each pipeline stage, in milliseconds.
+	DurationMS int64              `json:"duration_ms,omitempty"`
+	StagesMS   map[string]float64 `json:"stages_ms,omitempty"`
+
+	// DeliveryTarget and BatchID describe the delivery of the output file.
+	DeliveryTarget string `json:"delivery_target,omitempty"`
+	BatchID        string `json:"batch_id,omitempty"`
+
+	// Changes lists the changed configuration and template files of a
+	// config_changed or config_rejected entry.
+	Changes []string `json:"changes,omitempty"`
+
+	// Caller identifies who requested a served conversion: the API key's
+	// name, the client certificate's common name, or the IP address.
+	Caller string `json:"caller,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Trail appends entries to the audit file. It is safe for concurrent use.
+type Trail struct {
+	mu   sync.Mutex
+	path string
+}
+
+// Open prepares the audit trail at path, creating its directory.
+//
+// PARAMETERS:
+//   - path: The audit file path (e.g., "./logs/audit.jsonl").
+//
+// RETURNS:
+//   - The audit trail.
+//   - An error if the directory cannot be created.
+func Open(path string) (*Trail, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	return &Trail{path: path}, nil
+}
+
+// Record appends an entry. The file is opened for each entry, so several
+// processes can share the trail and it can be rotated at any time.
+func (t *Trail) Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	file, err := os.OpenFile(t.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit trail: %w", err)
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write audit trail: %w", err)
+	}
+	return nil
+}
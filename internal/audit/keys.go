@@ -0,0 +1,143 @@
+// =============================================================================
+// CSV to XML Converter - Transaction Key Index
+// =============================================================================
+//
+// Next to the audit trail, the key index records the transaction keys
+// (group_by_field values) of every output file of the departments that
+// check for keys uploaded before (transaction_grouping.duplicate_history_days).
+// There is one JSON Lines file per department and day, so a check only
+// reads the days it covers, and old days can simply be deleted:
+//
+//   logs/transaction_keys/CLAIMS/20240115.jsonl
+//   {"time":"2024-01-15T10:30:00Z","key":"1001","file":"claims_payments.csv","output_file":"CLM_0001.xml"}
+//
+// =============================================================================
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// KeyRecord is the upload of a transaction key.
+type KeyRecord struct {
+	Time       time.Time `json:"time"`
+	Key        string    `json:"key"`
+	File       string    `json:"file"`
+	OutputFile string    `json:"output_file,omitempty"`
+}
+
+// keysDir returns the directory of a department's key index.
+func (t *Trail) keysDir(dept string) string {
+	return filepath.Join(filepath.Dir(t.path), "transaction_keys", dept)
+}
+
+// RecordKeys appends the transaction keys of an output file to the
+// department's key index of the day.
+//
+// PARAMETERS:
+//   - dept: The department code.
+//   - file: The input file.
+//   - outputFile: The output file the keys were written to.
+//   - keys: The transaction keys.
+//
+// RETURNS:
+//   - An error if the index cannot be written.
+func (t *Trail) RecordKeys(dept, file, outputFile string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	now := time.Now().Local()
+	var lines []byte
+	for _, key := range keys {
+		line, err := json.Marshal(KeyRecord{Time: now, Key: key, File: filepath.Base(file), OutputFile: filepath.Base(outputFile)})
+		if err != nil {
+			return fmt.Errorf("failed to encode key record: %w", err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	dir := t.keysDir(dept)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create key index directory: %w", err)
+	}
+	path := filepath.Join(dir, now.Format("20060102")+".jsonl")
+	indexFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open key index: %w", err)
+	}
+
+	_, err = indexFile.Write(lines)
+	if closeErr := indexFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write key index: %w", err)
+	}
+	return nil
+}
+
+// KeysSince returns the transaction keys a department uploaded since a
+// time, with the latest upload of each.
+//
+// PARAMETERS:
+//   - dept: The department code.
+//   - since: The earliest upload to include.
+//
+// RETURNS:
+//   - The uploads by key.
+//   - An error if the index cannot be read.
+func (t *Trail) KeysSince(dept string, since time.Time) (map[string]KeyRecord, error) {
+	records := make(map[string]KeyRecord)
+	dir := t.keysDir(dept)
+
+	// The files are named after the local date of their records.
+	since = since.Local()
+	first := time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.Local)
+	for day := first; !day.After(time.Now()); day = day.AddDate(0, 0, 1) {
+		path := filepath.Join(dir, day.Format("20060102")+".jsonl")
+		if err := readKeys(path, since, records); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// readKeys adds the records of a key index file since a time to records.
+// A missing file has no records. Lines that cannot be decoded (e.g., a
+// line cut short by a crash) are skipped.
+func readKeys(path string, since time.Time, records map[string]KeyRecord) error {
+	indexFile, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open key index: %w", err)
+	}
+	defer indexFile.Close()
+
+	scanner := bufio.NewScanner(indexFile)
+	for scanner.Scan() {
+		var record KeyRecord
+		if json.Unmarshal(scanner.Bytes(), &record) != nil || record.Time.Before(since) {
+			continue
+		}
+		if previous, ok := records[record.Key]; !ok || record.Time.After(previous.Time) {
+			records[record.Key] = record
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read key index %s: %w", path, err)
+	}
+	return nil
+}
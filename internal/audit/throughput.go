@@ -0,0 +1,137 @@
+// =============================================================================
+// CSV to XML Converter - Conversion Throughput
+// =============================================================================
+//
+// The converted entries of the trail record each file's size, rows, and
+// processing time. Their totals per department give the department's
+// throughput (rows and bytes per second), from which the duration of a file
+// waiting to be converted is estimated by its size:
+//
+//   rows     = size * rows / bytes     (the department's rows per byte)
+//   duration = rows / rows per second
+//
+// Only the most recent entries of each department count, so the estimate
+// follows changes in the files and the hardware.
+//
+// =============================================================================
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ThroughputFiles is the number of recent converted files per department
+// the throughput is computed from.
+const ThroughputFiles = 50
+
+// Throughput is the total size, rows, and processing time of a
+// department's recent converted files.
+type Throughput struct {
+	Files    int
+	Rows     int64
+	Bytes    int64
+	Duration time.Duration
+}
+
+// RowsPerSecond returns the rows converted per second.
+func (t Throughput) RowsPerSecond() float64 {
+	if t.Duration <= 0 {
+		return 0
+	}
+	return float64(t.Rows) / t.Duration.Seconds()
+}
+
+// Estimate returns the rows and processing time of a file of a size.
+//
+// PARAMETERS:
+//   - size: The file size in bytes.
+//
+// RETURNS:
+//   - The estimated rows and duration, or false if there is no history.
+func (t Throughput) Estimate(size int64) (int64, time.Duration, bool) {
+	if t.Files == 0 || t.Bytes <= 0 || t.Rows <= 0 || t.Duration <= 0 {
+		return 0, 0, false
+	}
+	rows := int64(float64(size) * float64(t.Rows) / float64(t.Bytes))
+	duration := time.Duration(float64(t.Duration) * float64(size) / float64(t.Bytes))
+	return rows, duration, true
+}
+
+// ReadThroughput computes the throughput of each department from the
+// trail's converted entries.
+//
+// PARAMETERS:
+//   - path: The audit file path.
+//
+// RETURNS:
+//   - The throughput by department code, of its last ThroughputFiles
+//     converted files with a size, rows, and duration. The key "" holds
+//     the throughput of all departments together. A missing trail has no
+//     entries.
+//   - An error if the trail cannot be read.
+func ReadThroughput(path string) (map[string]Throughput, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return map[string]Throughput{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit trail: %w", err)
+	}
+	defer file.Close()
+
+	// The recent entries of each department, oldest first.
+	recent := make(map[string][]Entry)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if entry.Event != EventConverted || entry.Rows <= 0 || entry.BytesIn <= 0 || entry.DurationMS <= 0 {
+			continue
+		}
+		entries := append(recent[entry.Department], entry)
+		if len(entries) > ThroughputFiles {
+			entries = entries[1:]
+		}
+		recent[entry.Department] = entries
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit trail: %w", err)
+	}
+
+	throughput := make(map[string]Throughput)
+	var all Throughput
+	for department, entries := range recent {
+		var total Throughput
+		for _, entry := range entries {
+			total.Files++
+			total.Rows += int64(entry.Rows)
+			total.Bytes += entry.BytesIn
+			total.Duration += time.Duration(entry.DurationMS) * time.Millisecond
+		}
+		throughput[department] = total
+		all.Files += total.Files
+		all.Rows += total.Rows
+		all.Bytes += total.Bytes
+		all.Duration += total.Duration
+	}
+	if all.Files > 0 {
+		throughput[""] = all
+	}
+	return throughput, nil
+}
+
+// Throughput computes the throughput of each department from the trail's
+// converted entries (see ReadThroughput).
+func (t *Trail) Throughput() (map[string]Throughput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return ReadThroughput(t.path)
+}
@@ -0,0 +1,463 @@
+// =============================================================================
+// CSV to XML Converter - Configuration Bundles
+// =============================================================================
+//
+// A bundle packs the rule set of a deployment into one file: the main
+// configuration, the department configurations, and the templates, with a
+// manifest of their checksums and the version of the rule set. Signing the
+// manifest with a PGP key makes the bundle verifiable: whoever deploys it
+// can check that production runs exactly the rule set that was approved.
+//
+// A bundle is a gzipped tar archive:
+//
+//   manifest.json        version, creation time, and checksums of the files
+//   manifest.json.sig    armored detached PGP signature of the manifest
+//   config.yaml          the main configuration
+//   configs/claims.yaml  the department configurations
+//   templates/...        the templates
+//
+// Opening a bundle verifies every file against the manifest, and the
+// manifest against the signature when a keyring is given. Files the
+// configurations refer to by path (lookup files, holiday calendars, keys)
+// are not bundled.
+//
+// =============================================================================
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/pgp"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ManifestName is the name of the manifest in a bundle.
+	ManifestName = "manifest.json"
+
+	// SignatureName is the name of the manifest's signature in a bundle.
+	SignatureName = ManifestName + pgp.SignatureSuffix
+
+	// ConfigName is the name of the main configuration in a bundle.
+	ConfigName = "config.yaml"
+
+	// ConfigsDir and TemplatesDir are the directories of the department
+	// configurations and the templates in a bundle.
+	ConfigsDir   = "configs"
+	TemplatesDir = "templates"
+)
+
+// Manifest describes the contents of a bundle.
+type Manifest struct {
+	// Version is the version of the rule set, e.g. "2024.05.1".
+	Version string `json:"version"`
+
+	// Created is when the bundle was packed.
+	Created time.Time `json:"created"`
+
+	// ConverterVersion is the version of the converter that packed it.
+	ConverterVersion string `json:"converter_version,omitempty"`
+
+	// Files are the bundled files, by path.
+	Files []File `json:"files"`
+}
+
+// File is a bundled file.
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Bundle is an opened bundle, verified against its manifest.
+type Bundle struct {
+	Manifest Manifest
+
+	// Signer is the key that signed the manifest, or "" if the signature
+	// was not verified (no keyring) or the bundle is unsigned.
+	Signer string
+
+	// Signed reports whether the bundle has a signature.
+	Signed bool
+
+	// files are the contents of the bundled files, by path.
+	files map[string][]byte
+
+	// manifest and signature are the manifest as signed, and its
+	// signature (nil if unsigned).
+	manifest  []byte
+	signature []byte
+}
+
+// PackOptions defines what is packed into a bundle.
+type PackOptions struct {
+	// Version is the version of the rule set. Required.
+	Version string
+
+	// ConverterVersion is the version of the converter.
+	ConverterVersion string
+
+	// ConfigFile is the main configuration file.
+	ConfigFile string
+
+	// ConfigsDir is the directory of the department configurations; its
+	// .yaml and .yml files are packed.
+	ConfigsDir string
+
+	// TemplatesDir is the directory of the templates; its files and
+	// subdirectories are packed, except hidden files and Excel lock files
+	// ("~$...").
+	TemplatesDir string
+
+	// SigningKey is a file with the private PGP key that signs the
+	// manifest, or "" for an unsigned bundle.
+	SigningKey string
+
+	// Passphrase is the passphrase of the signing key, or "" if it has none.
+	Passphrase string
+}
+
+// =============================================================================
+// PACKING
+// =============================================================================
+
+// Pack writes a bundle.
+//
+// PARAMETERS:
+//   - w: Receives the bundle.
+//   - options: What is packed, and the signing key.
+//
+// RETURNS:
+//   - The manifest of the bundle.
+//   - An error if the version is missing, a file cannot be read, or the
+//     manifest cannot be signed.
+func Pack(w io.Writer, options PackOptions) (*Manifest, error) {
+	if strings.TrimSpace(options.Version) == "" {
+		return nil, fmt.Errorf("a version is required")
+	}
+
+	files := make(map[string][]byte)
+	data, err := os.ReadFile(options.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read main configuration: %w", err)
+	}
+	files[ConfigName] = data
+
+	if err := collect(files, options.ConfigsDir, ConfigsDir, false, func(name string) bool {
+		ext := strings.ToLower(filepath.Ext(name))
+		return ext == ".yaml" || ext == ".yml"
+	}); err != nil {
+		return nil, err
+	}
+	if err := collect(files, options.TemplatesDir, TemplatesDir, true, func(name string) bool {
+		return !strings.HasPrefix(name, ".") && !strings.HasPrefix(name, "~$")
+	}); err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Version:          strings.TrimSpace(options.Version),
+		Created:          time.Now().UTC().Truncate(time.Second),
+		ConverterVersion: options.ConverterVersion,
+	}
+	for name, content := range files {
+		sum := sha256.Sum256(content)
+		manifest.Files = append(manifest.Files, File{Path: name, Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	manifestData = append(manifestData, '\n')
+
+	// The manifest and its signature come first, so a reader can check
+	// them before the files.
+	entries := []File{{Path: ManifestName}}
+	files[ManifestName] = manifestData
+	if options.SigningKey != "" {
+		signature, err := pgp.SignData(manifestData, options.SigningKey, options.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		files[SignatureName] = signature
+		entries = append(entries, File{Path: SignatureName})
+	}
+	entries = append(entries, manifest.Files...)
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	for _, entry := range entries {
+		content := files[entry.Path]
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     entry.Path,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  manifest.Created,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write bundle: %w", err)
+		}
+		if _, err := archive.Write(content); err != nil {
+			return nil, fmt.Errorf("failed to write bundle: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return manifest, nil
+}
+
+// collect adds the files of a directory that pass a filter to files, under
+// a directory of the bundle.
+//
+// PARAMETERS:
+//   - files: Receives the contents, by bundle path.
+//   - dir: The directory.
+//   - prefix: The bundle directory.
+//   - recursive: Whether to include subdirectories.
+//   - include: Reports whether to include a file, by name.
+func collect(files map[string][]byte, dir, prefix string, recursive bool, include func(name string) bool) error {
+	return filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		if entry.IsDir() {
+			if filePath != dir && (!recursive || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || !include(entry.Name()) {
+			return nil
+		}
+
+		relative, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+		files[path.Join(prefix, filepath.ToSlash(relative))] = data
+		return nil
+	})
+}
+
+// =============================================================================
+// OPENING
+// =============================================================================
+
+// Open reads a bundle and verifies it.
+//
+// PARAMETERS:
+//   - bundlePath: The bundle.
+//   - keyring: A file with the public keys of the trusted signers, or ""
+//     to verify only the checksums. With a keyring, an unsigned bundle
+//     fails.
+//
+// RETURNS:
+//   - The bundle.
+//   - An error if the bundle cannot be read, a file does not match the
+//     manifest or is missing from it, or the signature does not verify.
+func Open(bundlePath, keyring string) (*Bundle, error) {
+	file, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	archive := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("bundle entry %s is not a file", header.Name)
+		}
+		if !isBundlePath(header.Name) {
+			return nil, fmt.Errorf("bundle entry %s has an invalid path", header.Name)
+		}
+		var content bytes.Buffer
+		if _, err := io.Copy(&content, archive); err != nil {
+			return nil, fmt.Errorf("failed to read %s from bundle: %w", header.Name, err)
+		}
+		files[header.Name] = content.Bytes()
+	}
+
+	manifestData, ok := files[ManifestName]
+	if !ok {
+		return nil, fmt.Errorf("bundle has no %s", ManifestName)
+	}
+	bundle := &Bundle{files: make(map[string][]byte), manifest: manifestData}
+	if err := json.Unmarshal(manifestData, &bundle.Manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ManifestName, err)
+	}
+
+	// The signature covers the manifest, the manifest the files.
+	signature, signed := files[SignatureName]
+	bundle.Signed, bundle.signature = signed, signature
+	if keyring != "" {
+		if !signed {
+			return nil, fmt.Errorf("bundle is not signed")
+		}
+		if bundle.Signer, err = pgp.VerifyData(manifestData, signature, keyring); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range bundle.Manifest.Files {
+		content, ok := files[entry.Path]
+		if !ok {
+			return nil, fmt.Errorf("%s is in the manifest but not in the bundle", entry.Path)
+		}
+		sum := sha256.Sum256(content)
+		if int64(len(content)) != entry.Size || hex.EncodeToString(sum[:]) != entry.SHA256 {
+			return nil, fmt.Errorf("%s does not match its checksum in the manifest", entry.Path)
+		}
+		bundle.files[entry.Path] = content
+	}
+	for name := range files {
+		if _, ok := bundle.files[name]; !ok && name != ManifestName && name != SignatureName {
+			return nil, fmt.Errorf("%s is in the bundle but not in the manifest", name)
+		}
+	}
+	if _, ok := bundle.files[ConfigName]; !ok {
+		return nil, fmt.Errorf("bundle has no %s", ConfigName)
+	}
+	return bundle, nil
+}
+
+// isBundlePath reports whether a bundle entry's path stays inside the
+// directory the bundle is extracted to.
+func isBundlePath(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") {
+		return false
+	}
+	return path.Clean(name) == name && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+// Extract writes the bundled files to a directory, with the manifest and
+// its signature, so the directory can be verified again.
+//
+// PARAMETERS:
+//   - dir: The directory. It is created if necessary.
+//
+// RETURNS:
+//   - An error if a file cannot be written.
+func (b *Bundle) Extract(dir string) error {
+	files := map[string][]byte{ManifestName: b.manifest}
+	if b.Signed {
+		files[SignatureName] = b.signature
+	}
+	for name, content := range b.files {
+		files[name] = content
+	}
+
+	for name, content := range files {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", name, err)
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// =============================================================================
+// RUNNING FROM A BUNDLE
+// =============================================================================
+
+// ExtractForRun extracts the bundle to a directory to run the converter
+// from it: the main configuration is rewritten so that its configs_dir and
+// templates_dir are the bundled ones. Its other paths (input, output, logs)
+// are used as they are.
+//
+// PARAMETERS:
+//   - dir: The directory, e.g. a temporary one.
+//
+// RETURNS:
+//   - The path of the main configuration to load.
+//   - An error if a file cannot be written or the main configuration is
+//     not a YAML mapping.
+func (b *Bundle) ExtractForRun(dir string) (string, error) {
+	if err := b.Extract(dir); err != nil {
+		return "", err
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(b.files[ConfigName], &document); err != nil {
+		return "", fmt.Errorf("failed to parse bundled %s: %w", ConfigName, err)
+	}
+	if len(document.Content) == 0 {
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("bundled %s is not a YAML mapping", ConfigName)
+	}
+
+	absolute, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	setYAMLValue(root, "configs_dir", filepath.Join(absolute, ConfigsDir))
+	setYAMLValue(root, "templates_dir", filepath.Join(absolute, TemplatesDir))
+
+	data, err := yaml.Marshal(&document)
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", ConfigName, err)
+	}
+	configPath := filepath.Join(dir, ConfigName)
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", ConfigName, err)
+	}
+	return configPath, nil
+}
+
+// setYAMLValue sets a key of a YAML mapping to a string, adding the key if
+// the mapping has none.
+func setYAMLValue(mapping *yaml.Node, key, value string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+}
@@ -0,0 +1,842 @@
+// =============================================================================
+// CSV to XML Converter - Configuration Migration
+// =============================================================================
+//
+// The first releases of the converter read a nested configuration format
+// (config/app_config.yaml and department_mappings/<dept>/department_config.yaml):
+// directories, logging, and processing sections in the main configuration,
+// and a department section, a grouping section, and named lookup tables in
+// the department configurations. The loader no longer reads those keys; it
+// ignores them, or fails where a value changed its type.
+//
+// The migration rewrites such a configuration to the current keys. It works
+// on the YAML node tree, so comments and the order of the keys are kept:
+//
+//   directories.input             -> input_dir (and the other directories)
+//   logging.level, file_path      -> log_level, log_file
+//   processing.max_workers        -> max_concurrency
+//   output.file_name_format       -> uuid_format
+//   department.code, name         -> department_code, department_name
+//   transaction_type              -> template_mapping
+//   grouping                      -> transaction_grouping (sort_order)
+//   field_mappings (static_value) -> static_fields
+//   lookup_table: <name>          -> the named lookup_tables entry, inlined
+//
+// Settings without an equivalent are removed and reported, so the operator
+// can check them; the backup written by 'converter config migrate' keeps
+// them. A configuration that is current is left unchanged.
+//
+// =============================================================================
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Migration is the result of migrating one configuration document.
+type Migration struct {
+	// Data is the migrated document. It equals the input if nothing changed.
+	Data []byte
+
+	// Changes describes each rewritten key, e.g. "directories.input -> input_dir".
+	Changes []string
+
+	// Notes lists settings that were removed without an equivalent, or
+	// that must be completed by hand.
+	Notes []string
+
+	// original is the document before the migration.
+	original []byte
+}
+
+// Changed reports whether the document was rewritten.
+func (m *Migration) Changed() bool {
+	return len(m.Changes) > 0
+}
+
+// change records a rewritten key.
+func (m *Migration) change(format string, args ...interface{}) {
+	m.Changes = append(m.Changes, fmt.Sprintf(format, args...))
+}
+
+// note records a setting that needs the operator's attention.
+func (m *Migration) note(format string, args ...interface{}) {
+	m.Notes = append(m.Notes, fmt.Sprintf(format, args...))
+}
+
+// mainDirectoryKeys maps the keys of the old directories section to the
+// current main configuration keys.
+var mainDirectoryKeys = []struct{ old, current string }{
+	{"input", "input_dir"},
+	{"output", "output_dir"},
+	{"input_archive", "input_archive_dir"},
+	{"output_archive", "output_archive_dir"},
+	{"templates", "templates_dir"},
+	{"department_mappings", "configs_dir"},
+}
+
+// obsoleteMainSections are the old main configuration sections whose
+// remaining settings have no equivalent.
+var obsoleteMainSections = []string{"directories", "logging", "processing", "validation", "output", "templates", "error_handling"}
+
+// =============================================================================
+// MAIN CONFIGURATION
+// =============================================================================
+
+// MigrateMainConfig rewrites a main configuration in the old nested format
+// to the current keys.
+//
+// PARAMETERS:
+//   - data: The YAML document.
+//
+// RETURNS:
+//   - The migration. Its Data is the input if the document is current.
+//   - An error if the document is not a YAML mapping.
+func MigrateMainConfig(data []byte) (*Migration, error) {
+	document, root, err := parseMigrationDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	migration := &Migration{Data: data, original: data}
+
+	// directories.* -> *_dir
+	if directories := mappingSection(root, "directories"); directories != nil {
+		for _, key := range mainDirectoryKeys {
+			moveScalar(migration, root, directories, "directories", key.old, key.current)
+		}
+	}
+
+	// logging.level and logging.file_path -> log_level and log_file
+	if logging := mappingSection(root, "logging"); logging != nil {
+		moveScalar(migration, root, logging, "logging", "level", "log_level")
+		if enabled := lookupKey(logging, "file_enabled"); enabled != nil && enabled.Value == "false" {
+			migration.note("logging.file_enabled: false: the converter always writes log_file")
+		}
+		removeKey(logging, "file_enabled")
+		moveScalar(migration, root, logging, "logging", "file_path", "log_file")
+	}
+
+	// processing.concurrent and max_workers -> max_concurrency
+	if processing := mappingSection(root, "processing"); processing != nil && lookupKey(root, "max_concurrency") == nil {
+		concurrent := lookupKey(processing, "concurrent")
+		workers := lookupKey(processing, "max_workers")
+		switch {
+		case concurrent != nil && concurrent.Value == "false":
+			insertBefore(root, "processing", "max_concurrency", scalarNode("1", concurrent))
+			migration.change("processing.concurrent: false -> max_concurrency: 1")
+		case workers != nil:
+			insertBefore(root, "processing", "max_concurrency", scalarNode(workers.Value, workers))
+			migration.change("processing.max_workers -> max_concurrency")
+		}
+		removeKey(processing, "concurrent")
+		removeKey(processing, "max_workers")
+	}
+
+	// output.file_name_format -> uuid_format
+	if output := mappingSection(root, "output"); output != nil {
+		moveScalar(migration, root, output, "output", "file_name_format", "uuid_format")
+	}
+
+	// The transaction types are read by the department migration.
+	if types := lookupKey(root, "transaction_types"); types != nil {
+		removeKey(root, "transaction_types")
+		migration.change("removed transaction_types (department template_mapping now selects the templates)")
+	}
+
+	for _, section := range obsoleteMainSections {
+		removeObsoleteSection(migration, root, section)
+	}
+
+	if !migration.Changed() {
+		return migration, nil
+	}
+	if migration.Data, err = encodeMigrationDocument(document, data); err != nil {
+		return nil, err
+	}
+	var check MainConfig
+	if err := yaml.Unmarshal(migration.Data, &check); err != nil {
+		migration.note("the migrated configuration does not load yet: %v", err)
+	}
+	return migration, nil
+}
+
+// TransactionTemplates returns the template of each transaction type of a
+// main configuration in the old format (transaction_types), which the
+// department migration turns into template_mapping.
+//
+// PARAMETERS:
+//   - data: The YAML document of the old main configuration.
+//
+// RETURNS:
+//   - The template file of each transaction type name; empty for a current
+//     configuration.
+func TransactionTemplates(data []byte) map[string]string {
+	var old struct {
+		TransactionTypes []struct {
+			Name         string `yaml:"name"`
+			TemplateFile string `yaml:"template_file"`
+		} `yaml:"transaction_types"`
+	}
+	templates := make(map[string]string)
+	if yaml.Unmarshal(data, &old) != nil {
+		return templates
+	}
+	for _, transactionType := range old.TransactionTypes {
+		if transactionType.Name != "" && transactionType.TemplateFile != "" {
+			templates[transactionType.Name] = transactionType.TemplateFile
+		}
+	}
+	return templates
+}
+
+// =============================================================================
+// DEPARTMENT CONFIGURATION
+// =============================================================================
+
+// MigrateDepartmentConfig rewrites a department configuration in the old
+// nested format to the current keys.
+//
+// PARAMETERS:
+//   - data: The YAML document.
+//   - templates: The template of each transaction type (see
+//     TransactionTemplates), used to turn transaction_type into
+//     template_mapping. May be nil.
+//
+// RETURNS:
+//   - The migration. Its Data is the input if the document is current.
+//   - An error if the document is not a YAML mapping.
+func MigrateDepartmentConfig(data []byte, templates map[string]string) (*Migration, error) {
+	document, root, err := parseMigrationDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	migration := &Migration{Data: data, original: data}
+
+	migrateDepartmentSection(migration, root)
+	migrateTransactionType(migration, root, templates)
+
+	// grouping -> transaction_grouping, sort_direction -> sort_order
+	if grouping := mappingSection(root, "grouping"); grouping != nil && lookupKey(root, "transaction_grouping") == nil {
+		renameKey(root, "grouping", "transaction_grouping")
+		migration.change("grouping -> transaction_grouping")
+		if renameKey(grouping, "sort_direction", "sort_order") {
+			migration.change("grouping.sort_direction -> transaction_grouping.sort_order")
+		}
+	}
+
+	// csv_settings.skip_empty_rows has no equivalent.
+	if csvSettings := mappingSection(root, "csv_settings"); csvSettings != nil && lookupKey(csvSettings, "skip_empty_rows") != nil {
+		removeKey(csvSettings, "skip_empty_rows")
+		migration.change("removed csv_settings.skip_empty_rows")
+		migration.note("csv_settings.skip_empty_rows: removed; see blank_line_items in transaction_grouping")
+	}
+
+	migrateFieldMappings(migration, root)
+	migrateLookupTables(migration, root)
+
+	// Empty sections of the old format are dropped; filled ones are kept
+	// for the operator to convert.
+	for _, section := range []string{"conditional_transformations", "validation_overrides"} {
+		value := lookupKey(root, section)
+		if value == nil {
+			continue
+		}
+		if isEmptyNode(value) {
+			removeKey(root, section)
+			migration.change("removed empty %s", section)
+		} else {
+			migration.note("%s: has no equivalent and was kept; convert it to transformation_rules, validation_suppressions, or custom_validations", section)
+		}
+	}
+
+	if !migration.Changed() {
+		return migration, nil
+	}
+	// The old format matched files by the department's folder.
+	if lookupKey(root, "file_matching_patterns") == nil && lookupKey(root, "input_subdirectories") == nil {
+		migration.note("file_matching_patterns: not set; add the department's file name patterns or input_subdirectories")
+	}
+	if migration.Data, err = encodeMigrationDocument(document, data); err != nil {
+		return nil, err
+	}
+	if _, err := ParseDepartmentConfig(migration.Data); err != nil {
+		migration.note("the migrated configuration does not load yet: %v", err)
+	}
+	return migration, nil
+}
+
+// migrateDepartmentSection moves department.code and department.name to
+// department_code and department_name. The description and contact, which
+// have no equivalent, are kept as a comment.
+func migrateDepartmentSection(migration *Migration, root *yaml.Node) {
+	department := mappingSection(root, "department")
+	if department == nil {
+		return
+	}
+	moveScalar(migration, root, department, "department", "code", "department_code")
+	moveScalar(migration, root, department, "department", "name", "department_name")
+
+	var kept []string
+	for i := 0; i+1 < len(department.Content); i += 2 {
+		key, value := department.Content[i], department.Content[i+1]
+		if value.Kind != yaml.ScalarNode {
+			migration.note("department.%s: no longer supported; the department section was kept", key.Value)
+			return
+		}
+		if value.Value != "" {
+			kept = append(kept, fmt.Sprintf("%s: %s", key.Value, value.Value))
+		}
+	}
+	removeKey(root, "department")
+	if len(kept) == 0 {
+		return
+	}
+	target := keyNode(root, "department_name")
+	if target == nil {
+		target = keyNode(root, "department_code")
+	}
+	if target != nil {
+		target.HeadComment = joinComments(target.HeadComment, "# "+strings.Join(kept, "\n# "))
+		migration.change("department.%s -> comment", keyList(kept))
+	}
+}
+
+// migrateTransactionType turns transaction_type into a template_mapping
+// rule for the type's template.
+func migrateTransactionType(migration *Migration, root *yaml.Node, templates map[string]string) {
+	transactionType := lookupKey(root, "transaction_type")
+	if transactionType == nil {
+		return
+	}
+	if lookupKey(root, "template_mapping") == nil {
+		template, known := templates[transactionType.Value]
+		if !known {
+			migration.note("transaction_type %q: add a template_mapping rule for its template (the main configuration's transaction_types was not available)", transactionType.Value)
+			return
+		}
+		rule := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		rule.Content = append(rule.Content,
+			scalarNode("if_filename_contains", nil), scalarNode(transactionType.Value, transactionType),
+			scalarNode("use_template", nil), scalarNode(template, transactionType))
+		mapping := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{rule}}
+		insertBefore(root, "transaction_type", "template_mapping", mapping)
+		migration.change("transaction_type %q -> template_mapping (%s)", transactionType.Value, template)
+	} else {
+		migration.change("removed transaction_type (template_mapping is set)")
+	}
+	removeKey(root, "transaction_type")
+}
+
+// migrateFieldMappings removes field_mappings: the template maps the CSV
+// columns now. Fixed values (is_dynamic: false) become static_fields.
+func migrateFieldMappings(migration *Migration, root *yaml.Node) {
+	mappings := lookupKey(root, "field_mappings")
+	if mappings == nil {
+		return
+	}
+	var statics []*yaml.Node
+	if mappings.Kind == yaml.SequenceNode {
+		for _, mapping := range mappings.Content {
+			dynamic := lookupKey(mapping, "is_dynamic")
+			header := lookupKey(mapping, "csv_header")
+			value := lookupKey(mapping, "static_value")
+			if dynamic == nil || dynamic.Value != "false" || header == nil || value == nil {
+				continue
+			}
+			field := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			field.Content = append(field.Content,
+				scalarNode("xml_tag", nil), scalarNode(header.Value, header),
+				scalarNode("value", nil), scalarNode(value.Value, value))
+			statics = append(statics, field)
+			migration.note("static_fields %s: moved from field_mappings with the CSV header as xml_tag; set the template's XML tag", header.Value)
+		}
+	}
+
+	if len(statics) > 0 {
+		if existing := lookupKey(root, "static_fields"); existing != nil && existing.Kind == yaml.SequenceNode {
+			// A comment after the last field stays after the list.
+			if count := len(existing.Content); count > 0 {
+				moveFootComment(existing.Content[count-1], statics[len(statics)-1])
+			}
+			existing.Content = append(existing.Content, statics...)
+		} else {
+			insertBefore(root, "field_mappings", "static_fields", &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: statics})
+		}
+	}
+	removeKey(root, "field_mappings")
+	migration.change("removed field_mappings (the template maps the columns; %d fixed value(s) -> static_fields)", len(statics))
+}
+
+// migrateLookupTables inlines the named lookup_tables into the actions that
+// refer to them by name (lookup_table: <name>) and removes the section.
+func migrateLookupTables(migration *Migration, root *yaml.Node) {
+	tables := lookupKey(root, "lookup_tables")
+	if tables == nil {
+		return
+	}
+	used := make(map[string]bool)
+	if rules := lookupKey(root, "transformation_rules"); rules != nil && rules.Kind == yaml.SequenceNode {
+		for _, rule := range rules.Content {
+			actions := lookupKey(rule, "actions")
+			if actions == nil || actions.Kind != yaml.SequenceNode {
+				continue
+			}
+			for _, action := range actions.Content {
+				table := lookupKey(action, "lookup_table")
+				if table == nil || table.Kind != yaml.ScalarNode {
+					continue
+				}
+				named := lookupKey(tables, table.Value)
+				if named == nil {
+					migration.note("lookup_table %q: no such table in lookup_tables", table.Value)
+					continue
+				}
+				name := table.Value
+				*table = *copyNode(named)
+				used[name] = true
+				if field := lookupKey(rule, "field"); field != nil {
+					migration.change("lookup_tables.%s -> inlined into the %s rule", name, field.Value)
+				}
+			}
+		}
+	}
+
+	var unused []string
+	for i := 0; i+1 < len(tables.Content); i += 2 {
+		if name := tables.Content[i].Value; !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	removeKey(root, "lookup_tables")
+	migration.change("removed lookup_tables")
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		migration.note("lookup_tables %s: not used by any action and removed; use them as lookup_table of a lookup action", strings.Join(unused, ", "))
+	}
+}
+
+// =============================================================================
+// YAML NODE HELPERS
+// =============================================================================
+
+// parseMigrationDocument parses a YAML document and returns it with its
+// top-level mapping.
+func parseMigrationDocument(data []byte) (*yaml.Node, *yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse file: %w", err)
+	}
+	if document.Kind != yaml.DocumentNode || len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("not a configuration: the document is not a YAML mapping")
+	}
+	return &document, document.Content[0], nil
+}
+
+// encodeMigrationDocument writes a document with the two-space indentation
+// of the configuration files. The YAML encoder drops blank lines, so those
+// of the original document are put back (see restoreBlankLines).
+func encodeMigrationDocument(document *yaml.Node, original []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return nil, fmt.Errorf("failed to write migrated configuration: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write migrated configuration: %w", err)
+	}
+	return restoreBlankLines(original, buffer.Bytes()), nil
+}
+
+// keyIndex returns the index of a key in a mapping's Content, or -1.
+func keyIndex(mapping *yaml.Node, key string) int {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// lookupKey returns the value of a key in a mapping, or nil.
+func lookupKey(mapping *yaml.Node, key string) *yaml.Node {
+	if i := keyIndex(mapping, key); i >= 0 {
+		return mapping.Content[i+1]
+	}
+	return nil
+}
+
+// keyNode returns the key node of a key in a mapping, or nil.
+func keyNode(mapping *yaml.Node, key string) *yaml.Node {
+	if i := keyIndex(mapping, key); i >= 0 {
+		return mapping.Content[i]
+	}
+	return nil
+}
+
+// nextKey returns the key node after a key in a mapping, or nil.
+func nextKey(mapping *yaml.Node, key string) *yaml.Node {
+	if i := keyIndex(mapping, key); i >= 0 && i+2 < len(mapping.Content) {
+		return mapping.Content[i+2]
+	}
+	return nil
+}
+
+// mappingSection returns the value of a key if it is a mapping, or nil.
+func mappingSection(mapping *yaml.Node, key string) *yaml.Node {
+	if value := lookupKey(mapping, key); value != nil && value.Kind == yaml.MappingNode {
+		return value
+	}
+	return nil
+}
+
+// removeKey removes a key from a mapping, with its comments.
+func removeKey(mapping *yaml.Node, key string) {
+	if i := keyIndex(mapping, key); i >= 0 {
+		mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+	}
+}
+
+// renameKey renames a key of a mapping in place.
+func renameKey(mapping *yaml.Node, key, name string) bool {
+	node := keyNode(mapping, key)
+	if node == nil {
+		return false
+	}
+	node.Value = name
+	return true
+}
+
+// insertBefore inserts a key before another key of a mapping, or at the end
+// if that key is missing. The comment of the key it is inserted before
+// moves to the new key.
+func insertBefore(mapping *yaml.Node, before, key string, value *yaml.Node) {
+	keyNode := scalarNode(key, nil)
+	i := keyIndex(mapping, before)
+	if i < 0 {
+		mapping.Content = append(mapping.Content, keyNode, value)
+		return
+	}
+	keyNode.HeadComment = mapping.Content[i].HeadComment
+	mapping.Content[i].HeadComment = ""
+	mapping.Content = append(mapping.Content[:i], append([]*yaml.Node{keyNode, value}, mapping.Content[i:]...)...)
+}
+
+// moveScalar moves a key of a section to a top-level key, before the
+// section. The key's comment moves with it. A top-level key that is set
+// already wins, and the old key is dropped.
+func moveScalar(migration *Migration, root, section *yaml.Node, sectionName, key, current string) {
+	i := keyIndex(section, key)
+	if i < 0 {
+		return
+	}
+	oldKey, value := section.Content[i], section.Content[i+1]
+	section.Content = append(section.Content[:i], section.Content[i+2:]...)
+	if lookupKey(root, current) != nil {
+		migration.change("removed %s.%s (%s is set)", sectionName, key, current)
+		return
+	}
+	insertBefore(root, sectionName, current, value)
+	newKey := keyNode(root, current)
+	newKey.HeadComment = joinComments(newKey.HeadComment, oldKey.HeadComment)
+	newKey.LineComment = oldKey.LineComment
+	migration.change("%s.%s -> %s", sectionName, key, current)
+}
+
+// removeObsoleteSection removes an old section. Its remaining settings are
+// reported; an empty section, whose settings all moved, is removed quietly.
+func removeObsoleteSection(migration *Migration, root *yaml.Node, section string) {
+	value := mappingSection(root, section)
+	if value == nil {
+		return
+	}
+	var keys []string
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		keys = append(keys, value.Content[i].Value)
+	}
+	removeKey(root, section)
+	if len(keys) > 0 {
+		migration.change("removed %s", section)
+		migration.note("%s.%s: no longer supported and removed", section, keyList(keys))
+	}
+}
+
+// scalarNode returns a scalar whose type follows from its value. The
+// quoting style is taken from like, if given.
+func scalarNode(value string, like *yaml.Node) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if like != nil && like.Kind == yaml.ScalarNode {
+		node.Style = like.Style
+	}
+	return node
+}
+
+// copyNode returns a deep copy of a node without its comments.
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.HeadComment, copied.LineComment, copied.FootComment = "", "", ""
+	copied.Content = nil
+	for _, child := range node.Content {
+		copied.Content = append(copied.Content, copyNode(child))
+	}
+	return &copied
+}
+
+// isEmptyNode reports whether a value is null, an empty collection, or a
+// mapping of empty values.
+func isEmptyNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Tag == "!!null" || node.Value == ""
+	case yaml.SequenceNode:
+		return len(node.Content) == 0
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if !isEmptyNode(node.Content[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// moveFootComment moves the comment after a node to the end of another.
+// The parser attaches such a comment to the innermost node that has one,
+// e.g. the last key of a mapping in a list.
+func moveFootComment(from, to *yaml.Node) {
+	for node := from; node != nil; {
+		if node.FootComment != "" {
+			target := to
+			for len(target.Content) > 0 && target.Kind == yaml.MappingNode {
+				target = target.Content[len(target.Content)-2]
+			}
+			target.FootComment, node.FootComment = node.FootComment, ""
+			return
+		}
+		switch {
+		case node.Kind == yaml.MappingNode && len(node.Content) >= 2:
+			node = node.Content[len(node.Content)-2]
+		case node.Kind == yaml.SequenceNode && len(node.Content) > 0:
+			node = node.Content[len(node.Content)-1]
+		default:
+			node = nil
+		}
+	}
+}
+
+// joinComments joins two comments, skipping empty ones.
+func joinComments(first, second string) string {
+	switch {
+	case first == "":
+		return second
+	case second == "":
+		return first
+	}
+	return first + "\n" + second
+}
+
+// keyList formats keys for a message: "key" or "{a, b}".
+func keyList(keys []string) string {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = strings.SplitN(key, ":", 2)[0]
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return "{" + strings.Join(names, ", ") + "}"
+}
+
+// =============================================================================
+// LINE DIFFERENCES
+// =============================================================================
+
+// lineEdit is one step of turning a document into another: an unchanged
+// line (' '), a removed line ('-'), or an added line ('+'), with the line
+// numbers (0-based) in both documents where it occurs.
+type lineEdit struct {
+	op     byte
+	line   string
+	before int
+	after  int
+}
+
+// diffLines returns the edits that turn one list of lines into another,
+// keeping their longest common subsequence. Configuration files are small,
+// so the subsequence is computed directly.
+func diffLines(before, after []string) []lineEdit {
+	// common[i][j] is the length of the longest common subsequence of
+	// before[i:] and after[j:].
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var edits []lineEdit
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			edits = append(edits, lineEdit{' ', before[i], i, j})
+			i++
+			j++
+		case j < len(after) && (i == len(before) || common[i][j+1] >= common[i+1][j]):
+			edits = append(edits, lineEdit{'+', after[j], i, j})
+			j++
+		default:
+			edits = append(edits, lineEdit{'-', before[i], i, j})
+			i++
+		}
+	}
+	return edits
+}
+
+// restoreBlankLines puts the blank lines of the original document back into
+// the migrated one: a blank line is kept where the line before or after it
+// was kept.
+func restoreBlankLines(original, migrated []byte) []byte {
+	before := splitLines(original)
+	after := splitLines(migrated)
+
+	// kept[i] is the line of the migrated document that line i of the
+	// original became, or -1.
+	kept := make([]int, len(before))
+	for i := range kept {
+		kept[i] = -1
+	}
+	for _, edit := range diffLines(before, after) {
+		if edit.op == ' ' {
+			kept[edit.before] = edit.after
+		}
+	}
+
+	// Blank lines go before the migrated line at the same index. Blank
+	// lines at the end of the document are dropped.
+	blanks := make([][]string, len(after)+1)
+	for i, line := range before {
+		if strings.TrimSpace(line) != "" || kept[i] >= 0 {
+			continue
+		}
+		previous := i - 1
+		for previous >= 0 && strings.TrimSpace(before[previous]) == "" {
+			previous--
+		}
+		next := i + 1
+		for next < len(before) && strings.TrimSpace(before[next]) == "" {
+			next++
+		}
+		switch {
+		case next < len(before) && kept[next] >= 0:
+			blanks[kept[next]] = append(blanks[kept[next]], line)
+		case previous >= 0 && kept[previous] >= 0:
+			blanks[kept[previous]+1] = append(blanks[kept[previous]+1], line)
+		}
+	}
+
+	var out bytes.Buffer
+	lastBlank := true
+	blanks[len(after)] = nil
+	for j := 0; j <= len(after); j++ {
+		for _, blank := range blanks[j] {
+			if !lastBlank {
+				out.WriteString(blank + "\n")
+			}
+			lastBlank = true
+		}
+		if j < len(after) {
+			out.WriteString(after[j] + "\n")
+			lastBlank = strings.TrimSpace(after[j]) == ""
+		}
+	}
+	return out.Bytes()
+}
+
+// diffContext is the number of unchanged lines shown around a change.
+const diffContext = 3
+
+// Diff returns the changes of the migration in the unified diff format.
+//
+// PARAMETERS:
+//   - name: The file name shown in the diff header.
+func (m *Migration) Diff(name string) string {
+	edits := diffLines(splitLines(m.original), splitLines(m.Data))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s (migrated)\n", name, name)
+	for start := 0; start < len(edits); {
+		// Find the next change; a hunk runs until more than twice the
+		// context of unchanged lines follows.
+		for start < len(edits) && edits[start].op == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		end, unchanged := start, 0
+		for ; end < len(edits) && unchanged <= 2*diffContext; end++ {
+			if edits[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > start && edits[end-1].op == ' ' {
+			end--
+		}
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+		last := end + diffContext
+		if last > len(edits) {
+			last = len(edits)
+		}
+
+		beforeCount, afterCount := 0, 0
+		for _, edit := range edits[first:last] {
+			if edit.op != '+' {
+				beforeCount++
+			}
+			if edit.op != '-' {
+				afterCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", edits[first].before+1, beforeCount, edits[first].after+1, afterCount)
+		for _, edit := range edits[first:last] {
+			fmt.Fprintf(&out, "%c%s\n", edit.op, edit.line)
+		}
+		start = last
+	}
+	return out.String()
+}
+
+// splitLines splits a document into lines without their line endings.
+func splitLines(data []byte) []string {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
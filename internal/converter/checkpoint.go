@@ -0,0 +1,249 @@
+// =============================================================================
+// CSV to XML Converter - Output Checkpoints
+// =============================================================================
+//
+// Writing a very large output file to network storage can take long enough
+// for an outage to interrupt it, and the next run would have to write the
+// whole file again. With output checkpoints, the file is written in steps:
+//
+//   output_checkpoints:
+//     every: 10000    # transactions per checkpoint
+//
+//   1. The document is written to "<output>.partial" in the output directory.
+//   2. After every N transactions, the file is flushed and synced to storage,
+//      and the checkpoint (the output name, the number of durable
+//      transactions, their byte offset, and the SHA-256 checksum of the bytes
+//      up to it) is recorded in state/checkpoints/<DEPT>/<input>.json.
+//   3. When the document is complete, it is synced, renamed to its output
+//      name, and the checkpoint is removed.
+//
+// If a run is interrupted, the input file stays in the input directory and
+// the partial file and checkpoint stay behind. The next run converts the
+// file again with the recorded output name; if the regenerated document
+// starts with exactly the durable bytes, the partial file is truncated to
+// the checkpoint and writing resumes after the last durable transaction.
+// Otherwise, e.g., when the input or a {today} or {sequence} value in the
+// document changed, the file is written again from the start.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+)
+
+// PartialFileSuffix is appended to the output file name while the file is
+// written with checkpoints.
+const PartialFileSuffix = ".partial"
+
+// outputCheckpoint is the last durable state of an output file written
+// with checkpoints.
+type outputCheckpoint struct {
+	// Input is the name of the input file.
+	Input string `json:"input"`
+
+	// Output is the name of the output file.
+	Output string `json:"output"`
+
+	// Transactions is the number of transactions written durably, and
+	// Offset is the byte offset of their end.
+	Transactions int   `json:"transactions"`
+	Offset       int64 `json:"offset"`
+
+	// SHA256 is the checksum of the document up to Offset.
+	SHA256 string `json:"sha256"`
+
+	// Updated is when the checkpoint was recorded.
+	Updated time.Time `json:"updated"`
+}
+
+// checkpointPath returns the checkpoint file of the input file (and
+// document), e.g. "state/checkpoints/CLAIMS/claims_20240131.json".
+func (c *Converter) checkpointPath() string {
+	name := filepath.Base(c.csvPath)
+	if c.documentKey != "" {
+		name += "_" + c.documentKey
+	}
+	return filepath.Join(c.mainConfig.StateDir, "checkpoints", c.deptConfig.DepartmentCode, name+".json")
+}
+
+// readCheckpoint reads the input file's checkpoint, or returns nil if
+// there is none or it cannot be read.
+func (c *Converter) readCheckpoint() *outputCheckpoint {
+	if !c.mainConfig.OutputCheckpoints.Enabled() {
+		return nil
+	}
+	data, err := os.ReadFile(c.checkpointPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.logger.Warn("Failed to read output checkpoint: %v", err)
+		}
+		return nil
+	}
+
+	var checkpoint outputCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		c.logger.Warn("Ignoring unreadable output checkpoint %s: %v", c.checkpointPath(), err)
+		return nil
+	}
+	return &checkpoint
+}
+
+// checkpointedFileName returns the output file name of an interrupted
+// write of the input file, or false if there is none.
+func (c *Converter) checkpointedFileName() (string, bool) {
+	checkpoint := c.readCheckpoint()
+	if checkpoint == nil || checkpoint.Output == "" {
+		return "", false
+	}
+	return checkpoint.Output, true
+}
+
+// writeCheckpointed writes the document to the output path in durable
+// steps, resuming an interrupted write if possible.
+//
+// PARAMETERS:
+//   - outputPath: The output file.
+//   - xmlDoc: The XML document.
+//   - offsets: The byte offset of the end of each transaction in xmlDoc.
+//
+// RETURNS:
+//   - An error if the file cannot be written. The partial file and the
+//     checkpoint are kept, for the next run to resume.
+func (c *Converter) writeCheckpointed(outputPath string, xmlDoc []byte, offsets []int64) error {
+	partialPath := utils.LongPath(outputPath + PartialFileSuffix)
+	every := c.mainConfig.OutputCheckpoints.Every
+
+	checkpoint := outputCheckpoint{Input: filepath.Base(c.csvPath), Output: filepath.Base(outputPath)}
+	checksum := sha256.New()
+
+	file, resumed, err := c.resumeCheckpoint(partialPath, xmlDoc, &checkpoint, checksum)
+	if err != nil {
+		return err
+	}
+	if resumed {
+		c.logger.Info("Resuming %s after transaction %d of %d", checkpoint.Output, checkpoint.Transactions, len(offsets))
+	}
+
+	written := checkpoint.Offset
+	write := func(end int64) error {
+		chunk := xmlDoc[written:end]
+		if _, err := c.faults.outputWriter(file).Write(chunk); err != nil {
+			return err
+		}
+		checksum.Write(chunk)
+		written = end
+		return file.Sync()
+	}
+
+	for next := checkpoint.Transactions + every; next < len(offsets); next += every {
+		if err := write(offsets[next-1]); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write file after transaction %d: %w", checkpoint.Transactions, err)
+		}
+		checkpoint.Transactions = next
+		checkpoint.Offset = written
+		checkpoint.SHA256 = hex.EncodeToString(checksum.Sum(nil))
+		checkpoint.Updated = time.Now()
+		if err := c.recordCheckpoint(checkpoint); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to record output checkpoint: %w", err)
+		}
+	}
+
+	if err := write(int64(len(xmlDoc))); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write file after transaction %d: %w", checkpoint.Transactions, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file after transaction %d: %w", checkpoint.Transactions, err)
+	}
+	if err := os.Rename(partialPath, utils.LongPath(outputPath)); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", filepath.Base(partialPath), err)
+	}
+
+	if err := os.Remove(c.checkpointPath()); err != nil && !os.IsNotExist(err) {
+		c.logger.Warn("Failed to remove output checkpoint: %v", err)
+	}
+	return nil
+}
+
+// resumeCheckpoint opens the partial file at the input file's checkpoint,
+// if the document starts with the durable bytes, or creates it.
+//
+// PARAMETERS:
+//   - partialPath: The partial file.
+//   - xmlDoc: The XML document.
+//   - checkpoint: Set to the checkpoint that is resumed.
+//   - checksum: Fed the durable bytes of a resumed file.
+//
+// RETURNS:
+//   - The partial file, positioned at the checkpoint.
+//   - true if the write is resumed.
+//   - An error if the partial file cannot be opened or created.
+func (c *Converter) resumeCheckpoint(partialPath string, xmlDoc []byte, checkpoint *outputCheckpoint, checksum hash.Hash) (*os.File, bool, error) {
+	previous := c.readCheckpoint()
+	if previous != nil && previous.Output == checkpoint.Output && previous.Offset <= int64(len(xmlDoc)) {
+		durable := xmlDoc[:previous.Offset]
+		sum := sha256.Sum256(durable)
+		file, err := os.OpenFile(partialPath, os.O_RDWR, 0644)
+		if err == nil {
+			info, statErr := file.Stat()
+			if statErr == nil && info.Size() >= previous.Offset && hex.EncodeToString(sum[:]) == previous.SHA256 &&
+				prefixMatches(file, durable) {
+				if err := file.Truncate(previous.Offset); err == nil {
+					if _, err := file.Seek(previous.Offset, io.SeekStart); err == nil {
+						checksum.Write(durable)
+						*checkpoint = *previous
+						return file, true, nil
+					}
+				}
+			}
+			file.Close()
+		}
+		c.logger.Warn("Cannot resume %s after transaction %d; writing it again", previous.Output, previous.Transactions)
+	}
+
+	file, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create file: %w", err)
+	}
+	return file, false, nil
+}
+
+// prefixMatches reports whether the file starts with the bytes. Only the
+// last block is compared: the checksum covers the document, and this
+// catches a partial file that was replaced or written by another run.
+func prefixMatches(file *os.File, prefix []byte) bool {
+	const block = 64 * 1024
+	start := int64(len(prefix)) - block
+	if start < 0 {
+		start = 0
+	}
+	tail := make([]byte, int64(len(prefix))-start)
+	if _, err := file.ReadAt(tail, start); err != nil {
+		return false
+	}
+	return bytes.Equal(tail, prefix[start:])
+}
+
+// recordCheckpoint records the checkpoint in the state directory.
+func (c *Converter) recordCheckpoint(checkpoint outputCheckpoint) error {
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStateFile(c.checkpointPath(), append(data, '\n'))
+}
@@ -13,7 +13,10 @@
 //   5. Validate the transformed data
 //   6. Generate the XML document
 //   7. Write the output file
-//   8. Archive the processed files
+//   8. Encrypt and sign the output file with PGP (optional)
+//   9. Deliver the output file to the target system (optional)
+//   10. Publish conversion events to Kafka or RabbitMQ (optional)
+//   11. Archive the processed files
 //
 // CONCURRENCY:
 //   Each file is processed in its own goroutine. The converter is designed
@@ -24,16 +27,31 @@
 package converter
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/big"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/archivecrypt"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/audit"
 	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
 	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/csvparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/delivery"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/events"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/masking"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/outputformat"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/pgp"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/schedule"
 	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
 	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
 	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
 	"github.com/google/uuid"
 )
 
@@ -50,6 +68,13 @@ type Result struct {
 	// This is empty if processing failed.
 	OutputFile string
 
+	// OutputFiles are the paths to all generated XML files: OutputFile, or
+	// one file per template with a "separate" template selector (see
+	// selector.go), followed by the department's additional outputs (see
+	// targets.go). Delivery is the receipt of the first. A main output
+	// replaced by the SQL sink is listed by its load ID (see sqlsink.go).
+	OutputFiles []string
+
 	// Success indicates whether the processing was successful.
 	Success bool
 
@@ -59,6 +84,55 @@ type Result struct {
 
 	// Stats contains processing statistics.
 	Stats ProcessingStats
+
+	// Validation contains the detailed validation result, including
+	// suppressed errors. This is nil if processing failed before validation.
+	Validation *validation.ValidationResult
+
+	// FixupFile is the path to the fix-up CSV exported for the failing rows.
+	// This is empty unless validation failed and the fix-up export is enabled.
+	FixupFile string
+
+	// RejectedFiles are the files the transactions that failed validation
+	// were written to, when the department rejects single transactions
+	// (see reject.go). The file succeeds with the valid transactions.
+	RejectedFiles []string
+
+	// ReviewFile is the path to the annotated review XML (see review.go).
+	// This is empty unless the file has validation errors and the
+	// department enables review output.
+	ReviewFile string
+
+	// Skipped indicates that the file was not processed because another run
+	// is processing it (or already has). Error describes why.
+	Skipped bool
+
+	// AbortRun indicates that the file failed at a stage whose failure
+	// policy is abort-run (see config.FailurePolicy): the run should not
+	// start any more files.
+	AbortRun bool
+
+	// Department is the code of the department configuration used.
+	Department string
+
+	// Template and TemplateVersion are the file name and version of the
+	// template used. TemplateVersion is empty if the template has none.
+	Template        string
+	TemplateVersion string
+
+	// SchemaDrift describes how the CSV headers differ from those of the
+	// department's last successful run with the template (see
+	// schemadrift.go). This is nil if they are the same.
+	SchemaDrift *SchemaDrift
+
+	// Delivery is the receipt of the delivery to the target system.
+	// This is nil if delivery is not configured or failed.
+	Delivery *delivery.Receipt
+
+	// TransactionKeys are the group keys of the transactions in the
+	// output, for the audit trail's key index (see history.go). This is
+	// nil unless the department sets duplicate_history_days.
+	TransactionKeys []string
 }
 
 // ProcessingStats contains statistics about the processing.
@@ -76,28 +150,192 @@ type ProcessingStats struct {
 	// If ContinueOnError is true, processing continues despite these errors.
 	ValidationErrors int
 
+	// SuppressedErrors is the number of validation errors suppressed by the
+	// department configuration. These do not count as ValidationErrors.
+	SuppressedErrors int
+
+	// DuplicatesDropped is the number of duplicate rows removed before
+	// grouping. These are included in RowsProcessed.
+	DuplicatesDropped int
+
+	// TransactionsRejected and RowsRejected count the transactions (and
+	// their rows) that failed validation and were written to the rejected
+	// directory instead of the XML. They are not included in
+	// TransactionsCreated and LineItemsCreated.
+	TransactionsRejected int
+	RowsRejected         int
+
 	// ProcessingTime is the time taken to process the file.
 	ProcessingTime time.Duration
+
+	// Stages contains the time taken by each stage of the pipeline.
+	Stages StageTimings
+
+	// BytesIn is the size of the input CSV file.
+	BytesIn int64
+
+	// BytesOut is the size of the output file, after PGP protection.
+	BytesOut int64
+}
+
+// StageTimings contains the time taken by each pipeline stage. Stages that
+// did not run (or were not reached) are zero.
+type StageTimings struct {
+	TemplateParse time.Duration
+	CSVParse      time.Duration
+	Transform     time.Duration // de-duplication, grouping, and transformation rules
+	Validate      time.Duration
+	Generate      time.Duration
+	Write         time.Duration
+	Protect       time.Duration
+	Load          time.Duration // SQL sink insert and commit
+	Deliver       time.Duration
+	Publish       time.Duration
+	Archive       time.Duration
+}
+
+// Stage is the time taken by a named pipeline stage.
+type Stage struct {
+	Name     string
+	Duration time.Duration
+}
+
+// List returns the stages that ran, in pipeline order. The names are used
+// in verbose output and in the audit trail.
+func (t StageTimings) List() []Stage {
+	all := []Stage{
+		{"template_parse", t.TemplateParse},
+		{"csv_parse", t.CSVParse},
+		{"transform", t.Transform},
+		{"validate", t.Validate},
+		{"generate", t.Generate},
+		{"write", t.Write},
+		{"protect", t.Protect},
+		{"load", t.Load},
+		{"deliver", t.Deliver},
+		{"publish", t.Publish},
+		{"archive", t.Archive},
+	}
+
+	stages := make([]Stage, 0, len(all))
+	for _, stage := range all {
+		if stage.Duration > 0 {
+			stages = append(stages, stage)
+		}
+	}
+	return stages
+}
+
+// lap returns the time since *start and resets *start to now, for timing
+// consecutive stages.
+func lap(start *time.Time) time.Duration {
+	now := time.Now()
+	elapsed := now.Sub(*start)
+	*start = now
+	return elapsed
 }
 
 // =============================================================================
 // CONVERTER STRUCTURE
 // =============================================================================
 
+// ErrValidationFailed is wrapped by Result.Error when a file fails because
+// of validation errors (as opposed to unreadable input, a bad template, or a
+// failed write or delivery).
+var ErrValidationFailed = errors.New("validation failed")
+
+// Version is the converter version used for the {version} placeholder.
+// The command line sets it from its build-time version.
+var Version = "dev"
+
 // Converter handles the conversion of a single CSV file to XML.
 type Converter struct {
 	// csvPath is the path to the input CSV file.
 	csvPath string
 
+	// stage is the failure stage the pipeline has reached (see
+	// config.FailurePolicy), or "" before the template is determined.
+	stage string
+
+	// transformFailures records the field transformations that failed and
+	// were skipped under the "continue" policy, so each is logged once.
+	transformFailures map[string]bool
+
 	// deptConfig is the department-specific configuration.
 	deptConfig *config.DepartmentConfig
 
-	// mainConfig is the main application configuration.
+	// mainConfig is the main application configuration, with the
+	// department's overrides applied (see MainConfig.ForDepartment).
 	mainConfig *config.MainConfig
 
 	// schema is the parsed XLSX template schema.
 	schema *xlsxparser.Schema
 
+	// signaturePath is the detached PGP signature of the output file.
+	// It is archived together with the output file.
+	signaturePath string
+
+	// fixupPath is the path to a fix-up file merged into the input.
+	// It is archived together with the input file.
+	fixupPath string
+
+	// publisher publishes conversion events, or is nil.
+	publisher events.Publisher
+
+	// templates holds templates parsed in advance, by path, or is nil.
+	// See SetTemplates.
+	templates map[string]*xlsxparser.Schema
+
+	// checksum identifies the input file, and previous is the record of its
+	// previous conversion, if any. Both are only set when the department
+	// has a reprocess policy. See reprocess.go.
+	checksum string
+	previous *conversionRecord
+
+	// placeholders holds the placeholder values of this file, so the file
+	// name and the document header agree. See placeholderValues.
+	placeholders map[string]string
+
+	// selected holds the templates parsed for the template selector, by
+	// path. See selector.go.
+	selected map[string]*xlsxparser.Schema
+
+	// documentKey is appended to the output file name of a separate
+	// document of the template selector, or is empty.
+	documentKey string
+
+	// masker masks the values of the department's sensitive fields, or is
+	// nil. See mask.go.
+	masker *masking.Masker
+
+	// formatter writes the documents of a department whose output_format
+	// is not XML, once loaded. See outputFormatter.
+	formatter outputformat.Formatter
+
+	// target is the additional output this converter writes, or nil for
+	// the main output. See targets.go.
+	target *config.OutputTarget
+
+	// preview is true while generating a preview (see preview.go): the
+	// sequence number is shown but not allocated.
+	preview bool
+
+	// faults are the failures injected for resilience testing (see
+	// faults.go).
+	faults Faults
+
+	// rowsRead is the number of data rows read from the input file, for
+	// the metadata comment (see metadatacomment.go).
+	rowsRead int
+
+	// runKeys holds the transaction keys of the other files of the run, or
+	// is nil outside a Processor run. See runkeys.go.
+	runKeys *runKeys
+
+	// trail is the audit trail whose key index holds the transaction keys
+	// uploaded before, or nil. See history.go.
+	trail *audit.Trail
+
 	// logger is used for logging (can be replaced with a proper logger).
 	// CUSTOMIZATION: Replace with your preferred logging library.
 	logger Logger
@@ -121,7 +359,8 @@ type Logger interface {
 // PARAMETERS:
 //   - csvPath: The path to the input CSV file.
 //   - deptConfig: The department-specific configuration.
-//   - mainConfig: The main application configuration.
+//   - mainConfig: The main application configuration. The department's
+//     output locations and file name format override it.
 //
 // RETURNS:
 //   - A new Converter instance.
@@ -129,11 +368,39 @@ func New(csvPath string, deptConfig *config.DepartmentConfig, mainConfig *config
 	return &Converter{
 		csvPath:    csvPath,
 		deptConfig: deptConfig,
-		mainConfig: mainConfig,
+		mainConfig: mainConfig.ForDepartment(deptConfig),
+		masker:     masking.New(deptConfig.SensitiveFields),
 		logger:     &defaultLogger{}, // Use default logger
 	}
 }
 
+// SetLogger replaces the default stdout logger.
+//
+// PARAMETERS:
+//   - logger: The logger to use (e.g., a *logging.Logger).
+func (c *Converter) SetLogger(logger Logger) {
+	c.logger = logger
+}
+
+// SetPublisher sets the publisher for conversion events. Without one, no
+// events are published.
+func (c *Converter) SetPublisher(publisher events.Publisher) {
+	c.publisher = publisher
+}
+
+// SetTemplates makes the converter use templates that were parsed in
+// advance instead of reading them from the templates directory. The watch
+// command uses it so every file sees the validated version of a template,
+// even while the template file is being replaced.
+//
+// PARAMETERS:
+//   - templates: The parsed templates by path (the templates directory
+//     joined with the use_template file name). Templates not in the map are
+//     read from disk. The schemas are not modified.
+func (c *Converter) SetTemplates(templates map[string]*xlsxparser.Schema) {
+	c.templates = templates
+}
+
 // =============================================================================
 // MAIN PROCESSING FUNCTION
 // =============================================================================
@@ -152,12 +419,33 @@ func New(csvPath string, deptConfig *config.DepartmentConfig, mainConfig *config
 //   6. Validate the data
 //   7. Generate the XML document
 //   8. Write the output file
-//   9. Archive the processed files
+//   9. Encrypt and sign the output file (if the department configures PGP)
+//   10. Deliver the output file (if the department configures delivery)
+//   11. Publish conversion events (if configured)
+//   12. Archive the processed files
+//
+// A failed file is marked AbortRun if the department's failure policy of
+// the failed stage is abort-run.
 func (c *Converter) Run() Result {
+	result := c.run()
+	if result.Error != nil && !result.Skipped && c.stage != "" {
+		result.AbortRun = c.failurePolicy(c.stage) == config.FailAbortRun
+	}
+	return result
+}
+
+// failurePolicy returns the department's failure policy of a stage.
+func (c *Converter) failurePolicy(stage string) string {
+	return c.deptConfig.FailurePolicy.For(stage, c.mainConfig.ContinueOnError)
+}
+
+// run executes the conversion pipeline for the file (see Run).
+func (c *Converter) run() Result {
 	startTime := time.Now()
 	result := Result{
-		FilePath: c.csvPath,
-		Success:  false,
+		FilePath:   c.csvPath,
+		Success:    false,
+		Department: c.deptConfig.DepartmentCode,
 	}
 
 	// =========================================================================
@@ -167,6 +455,34 @@ func (c *Converter) Run() Result {
 
 	c.logger.Info("Processing file: %s", c.csvPath)
 
+	// Lock the input file so that an overlapping run does not process it too.
+	if !c.mainConfig.DisableLocking {
+		lock, err := utils.AcquireLock(c.csvPath+utils.LockSuffix, c.mainConfig.LockStaleAfter)
+		if err != nil {
+			result.Error = err
+			result.Skipped = errors.Is(err, utils.ErrLocked)
+			return result
+		}
+		defer lock.Release()
+
+		// Another run may have archived the file after it was discovered.
+		if !utils.FileExists(c.csvPath) {
+			result.Error = fmt.Errorf("file was already processed by another run")
+			result.Skipped = true
+			return result
+		}
+	}
+
+	// Apply the reprocess policy if the same file was converted before.
+	release, done := c.checkReprocess(&result)
+	defer release()
+	if done {
+		return result
+	}
+
+	stageStart := time.Now()
+	c.stage = config.StageParse
+
 	templatePath, err := c.determineTemplate()
 	if err != nil {
 		result.Error = fmt.Errorf("failed to determine template: %w", err)
@@ -184,39 +500,71 @@ func (c *Converter) Run() Result {
 	//   - Validation rules (char limits, formats, required/optional)
 	//   - XML nesting structure
 
-	schema, err := xlsxparser.Parse(templatePath)
+	schema, err := c.parseTemplate(templatePath)
 	if err != nil {
 		result.Error = fmt.Errorf("failed to parse template: %w", err)
 		return result
 	}
 
 	c.schema = schema
+	result.Template = c.templateName()
+	result.TemplateVersion = c.templateVersion()
+	result.Stats.Stages.TemplateParse = lap(&stageStart)
 	c.logger.Debug("Parsed schema with %d field mappings", len(schema.FieldMappings))
 
+	// Warn if the template changed since the department's last successful run.
+	c.checkTemplateVersion()
+
+	// Convert the file in stages connected by bounded buffers, if the main
+	// configuration enables it and the department's features allow it
+	// (see pipeline.go).
+	if c.mainConfig.Pipeline.Enabled() {
+		unsupported := c.pipelineUnsupported()
+		if unsupported == "" {
+			return c.runPipeline(result, startTime, stageStart)
+		}
+		c.logger.Debug("Converting without the pipeline, which does not support %s", unsupported)
+	}
+
 	// =========================================================================
 	// STEP 3: PARSE INPUT CSV
 	// =========================================================================
 	// Parse the CSV file using the department-specific settings.
 
-	csvData, err := csvparser.Parse(c.csvPath, c.deptConfig.CSVSettings)
+	csvData, err := csvparser.Parse(c.csvPath, c.csvSettings())
+	if err == nil {
+		err = c.faults.checkRows(len(csvData.Rows))
+	}
 	if err != nil {
 		result.Error = fmt.Errorf("failed to parse CSV: %w", err)
 		return result
 	}
+	if err := c.prepareColumns(csvData); err != nil {
+		result.Error = err
+		return result
+	}
+
+	// Merge a corrected fix-up file, or clean up a re-dropped one.
+	if err := c.prepareFixupInput(csvData); err != nil {
+		result.Error = fmt.Errorf("failed to merge fix-up file: %w", err)
+		return result
+	}
 
-	result.Stats.RowsProcessed = len(csvData.Rows)
+	if info, err := os.Stat(c.csvPath); err == nil {
+		result.Stats.BytesIn = info.Size()
+	}
+	result.Stats.Stages.CSVParse = lap(&stageStart)
 	c.logger.Debug("Parsed %d rows from CSV", len(csvData.Rows))
 
+	// Warn if the columns changed since the department's last successful run.
+	result.SchemaDrift = c.checkSchemaDrift(csvData.Headers)
+
 	// =========================================================================
 	// STEP 4: GROUP ROWS INTO TRANSACTIONS
 	// =========================================================================
 	// Group CSV rows based on the transaction grouping configuration.
 	// Each group becomes a <transaction> element in the XML.
-
-	transactions := c.groupTransactions(csvData)
-	result.Stats.TransactionsCreated = len(transactions)
-	c.logger.Debug("Grouped into %d transactions", len(transactions))
-
+	//
 	// =========================================================================
 	// STEP 5: APPLY TRANSFORMATION RULES
 	// =========================================================================
@@ -227,14 +575,13 @@ func (c *Converter) Run() Result {
 	//   - Format conversions
 	//   - Lookup table replacements
 
-	for i := range transactions {
-		if err := c.applyTransformations(&transactions[i]); err != nil {
-			result.Error = fmt.Errorf("failed to apply transformations: %w", err)
-			return result
-		}
+	c.stage = config.StageTransform
+	transactions, duplicates, err := c.buildTransactions(csvData, &result.Stats)
+	if err != nil {
+		result.Error = err
+		return result
 	}
-
-	c.logger.Debug("Applied transformation rules")
+	result.Stats.Stages.Transform = lap(&stageStart)
 
 	// =========================================================================
 	// STEP 6: VALIDATE DATA
@@ -246,64 +593,298 @@ func (c *Converter) Run() Result {
 	//   - Required field checks
 	//   - Conditional validation rules
 
-	// Convert transactions to validation types.
-	validationTransactions := convertToValidationTransactions(transactions)
-	validationErrors := validation.Validate(validationTransactions, c.schema)
-	result.Stats.ValidationErrors = len(validationErrors)
+	c.stage = config.StageValidation
+	validationErrors := c.validate(transactions, duplicates, &result)
+	result.Stats.Stages.Validate = lap(&stageStart)
+
+	// Write the annotated review variant, with every transaction.
+	if len(validationErrors) > 0 && c.deptConfig.ReviewOutput.Enabled {
+		reviewFile, err := c.writeReview(transactions, validationErrors)
+		if err != nil {
+			c.logger.Warn("Failed to write review file: %v", err)
+		} else {
+			result.ReviewFile = reviewFile
+			c.logger.Info("Wrote annotated review file: %s", reviewFile)
+		}
+	}
 
-	if len(validationErrors) > 0 {
-		// Log validation errors.
-		for _, ve := range validationErrors {
-			c.logger.Warn("Validation error: %s", ve.Error())
+	// Convert the valid transactions and set the failing ones aside, if the
+	// department rejects single transactions.
+	if len(validationErrors) > 0 && c.deptConfig.RejectedTransactions.Enabled {
+		if accepted, ok := c.rejectTransactions(csvData, transactions, validationErrors, &result); ok {
+			transactions = accepted
+			validationErrors = nil
 		}
+	}
+
+	if len(validationErrors) > 0 {
+		// Unless the failure policy continues, fail the processing.
+		if c.failurePolicy(config.StageValidation) != config.FailContinue {
+			// Export the failing rows so they can be corrected and re-dropped.
+			if c.deptConfig.FixupExport.Enabled {
+				fixupFile, err := c.exportFixup(csvData, validationErrors)
+				if err != nil {
+					c.logger.Warn("Failed to export fix-up file: %v", err)
+				} else if fixupFile != "" {
+					result.FixupFile = fixupFile
+					c.logger.Info("Exported failing rows to: %s", fixupFile)
+				}
+			}
 
-		// If we're not continuing on error, fail the processing.
-		if !c.mainConfig.ContinueOnError {
-			result.Error = fmt.Errorf("validation failed with %d errors", len(validationErrors))
+			result.Error = validationFailed(result.Validation)
 			return result
 		}
 	}
 
 	c.logger.Debug("Validation complete with %d errors", len(validationErrors))
+	result.TransactionKeys = c.transactionKeys(transactions)
 
 	// =========================================================================
 	// STEP 7: GENERATE XML DOCUMENT
 	// =========================================================================
-	// Generate the XML document based on the schema and transformed data.
-
-	// Convert transactions to xmlwriter types.
-	xmlTransactions := convertToXMLWriterTransactions(transactions)
-	xmlDoc, err := xmlwriter.Generate(xmlTransactions, c.schema, c.deptConfig)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to generate XML: %w", err)
-		return result
+	// Generate the XML document based on the schema and transformed data:
+	// one document, or one per template with a "separate" template selector
+	// (see selector.go).
+
+	c.stage = config.StageWrite
+	documents := c.documents(transactions)
+	outputs := make([]*documentOutput, len(documents))
+	for i, doc := range documents {
+		conv := c.forDocument(doc)
+		xmlTransactions, options, xmlDoc, err := conv.generate(doc.transactions)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		outputs[i] = &documentOutput{conv: conv, transactions: doc.transactions,
+			xmlTransactions: xmlTransactions, options: options, xmlDoc: xmlDoc}
 	}
 
-	c.logger.Debug("Generated XML document")
+	// The department's additional outputs, from the same transactions (see
+	// targets.go).
+	for _, out := range outputs[:len(documents)] {
+		targets, err := out.conv.targetOutputs(out)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		outputs = append(outputs, targets...)
+	}
+	result.Stats.Stages.Generate = lap(&stageStart)
 
 	// =========================================================================
 	// STEP 8: WRITE OUTPUT FILE
 	// =========================================================================
 	// Write the XML document to the output directory.
 
-	outputPath, err := c.writeOutput(xmlDoc)
+	for _, out := range outputs {
+		// The SQL sink takes the place of the file; only its name is needed.
+		if out.conv.replacesOutput(out) {
+			fileName, err := out.conv.generateOutputFileName()
+			if err != nil {
+				removeOutputs(outputs)
+				result.Error = fmt.Errorf("failed to write output: %w", err)
+				return result
+			}
+			out.name = fileName
+			continue
+		}
+
+		var outputPath string
+		var err error
+		if out.main != nil {
+			outputPath, err = out.conv.writeTarget(out)
+		} else {
+			outputPath, err = out.conv.writeOutput(out)
+		}
+		if err != nil {
+			removeOutputs(outputs)
+			result.Error = fmt.Errorf("failed to write output: %w", err)
+			return result
+		}
+
+		out.path = outputPath
+		out.name = filepath.Base(outputPath)
+		result.Stats.BytesOut += int64(len(out.xmlDoc))
+		c.logger.Info("Wrote output to: %s", out.writtenPath())
+	}
+	result.Stats.Stages.Write = lap(&stageStart)
+
+	return c.completeOutputs(result, outputs, csvData.Headers, startTime, stageStart)
+}
+
+// completeOutputs protects, delivers, publishes, and archives the written
+// output documents, and records the successful run (steps 9 to 12).
+//
+// PARAMETERS:
+//   - result: The result so far.
+//   - outputs: The written documents.
+//   - headers: The headers of the input file.
+//   - startTime: When the conversion started.
+//   - stageStart: When the current stage started.
+//
+// RETURNS:
+//   - The completed result.
+func (c *Converter) completeOutputs(result Result, outputs []*documentOutput, headers []string, startTime, stageStart time.Time) Result {
+	// =========================================================================
+	// STEP 9: ENCRYPT AND SIGN OUTPUT FILE
+	// =========================================================================
+	// Protect the XML with PGP, if the department configures it.
+
+	if c.deptConfig.PGP.Enabled {
+		result.Stats.BytesOut = 0
+		for _, out := range outputs {
+			if out.path == "" {
+				continue
+			}
+			protectedPath, signaturePath, err := pgp.Protect(out.writtenPath(), out.path, c.deptConfig.PGP)
+			out.removePlaintext()
+			if err != nil {
+				// Never leave an unprotected file for pickup.
+				if protectedPath != "" {
+					os.Remove(protectedPath)
+				}
+				removeOutputs(outputs)
+				result.Error = fmt.Errorf("failed to protect output with PGP: %w", err)
+				return result
+			}
+
+			out.path = protectedPath
+			out.conv.signaturePath = signaturePath
+			if info, err := os.Stat(out.path); err == nil {
+				result.Stats.BytesOut += info.Size()
+			}
+			c.logger.Info("Protected output with PGP: %s", out.path)
+		}
+		result.Stats.Stages.Protect = lap(&stageStart)
+	}
+
+	for _, out := range outputs {
+		if out.path == "" {
+			result.OutputFiles = append(result.OutputFiles, loadID(out))
+			continue
+		}
+		result.OutputFiles = append(result.OutputFiles, out.path)
+	}
+	result.OutputFile = result.OutputFiles[0]
+
+	// Insert the rows into the staging tables; they are committed once the
+	// output is delivered (see sqlsink.go).
+	pending, err := c.insertSQLSink(outputs)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to write output: %w", err)
+		removeOutputs(outputs)
+		result.OutputFile = ""
+		result.OutputFiles = nil
+		result.Error = fmt.Errorf("SQL sink: %w", err)
 		return result
 	}
+	if pending != nil {
+		result.Stats.Stages.Load = lap(&stageStart)
+	}
+
+	// =========================================================================
+	// STEP 10: DELIVER OUTPUT FILE
+	// =========================================================================
+	// Send the XML to the target system, if the department configures it.
+
+	receipts := make([]*delivery.Receipt, len(outputs))
+	for i, out := range outputs {
+		receipt, err := out.conv.deliverOutput(out.path)
+		if receipt != nil || err != nil {
+			result.Stats.Stages.Deliver += lap(&stageStart)
+		}
+		if err != nil {
+			// Remove the undelivered output; the next run converts the input again.
+			removeOutputs(outputs[i:])
+			if pending != nil {
+				if err := pending.Rollback(); err != nil {
+					c.logger.Warn("%v", err)
+				}
+			}
+			if i > 0 {
+				c.logger.Warn("%d of %d documents were delivered before the failure", i, len(outputs))
+			}
+			result.OutputFile = ""
+			result.OutputFiles = nil
+			result.Delivery = nil
+			result.Error = err
+			return result
+		}
+		if receipt != nil {
+			receipts[i] = receipt
+			if result.Delivery == nil {
+				result.Delivery = receipt
+			}
+			c.logger.Info("Delivered to %s (batch ID: %s, %d attempt(s))", receipt.Target, receipt.BatchID, receipt.Attempts)
+		}
+	}
+
+	if pending != nil {
+		if err := pending.Commit(); err != nil {
+			// As for a failed delivery, the next run converts the input again.
+			removeOutputs(outputs)
+			if result.Delivery != nil {
+				c.logger.Warn("The output was delivered before the SQL sink failed")
+			}
+			result.OutputFile = ""
+			result.OutputFiles = nil
+			result.Delivery = nil
+			result.Error = fmt.Errorf("SQL sink: %w", err)
+			return result
+		}
+		result.Stats.Stages.Load += lap(&stageStart)
+		c.logger.Info("Committed %d transaction(s) to %s", pending.Transactions, c.deptConfig.SQLSink.TransactionsTable)
+	}
 
-	result.OutputFile = outputPath
-	c.logger.Info("Wrote output to: %s", outputPath)
+	// Trace the delivered documents back to the input, for audit requests.
+	if c.deptConfig.Provenance.Enabled {
+		for _, out := range outputs {
+			if out.main != nil {
+				continue
+			}
+			provenancePath, err := out.conv.writeProvenance(out)
+			if err != nil {
+				c.logger.Warn("Failed to write provenance file: %v", err)
+				continue
+			}
+			c.logger.Info("Wrote provenance file: %s", provenancePath)
+		}
+	}
+
+	// Export the delivered rows for analytics (see datalake.go).
+	c.exportDataLake(outputs, headers)
+
+	// =========================================================================
+	// STEP 11: PUBLISH EVENTS
+	// =========================================================================
+	// Notify downstream services. The output is already delivered, so a
+	// failure is logged but does not fail the file.
+
+	for i, out := range outputs {
+		if out.main != nil {
+			continue
+		}
+		published := result
+		published.OutputFile = result.OutputFiles[i]
+		published.Delivery = receipts[i]
+		if err := out.conv.publishEvents(published, out.transactions, out.xmlTransactions, out.options, out.xmlDoc); err != nil {
+			c.logger.Warn("Failed to publish conversion events: %v", err)
+		}
+	}
+	if c.publisher != nil {
+		result.Stats.Stages.Publish = lap(&stageStart)
+	}
 
 	// =========================================================================
-	// STEP 9: ARCHIVE FILES
+	// STEP 12: ARCHIVE FILES
 	// =========================================================================
 	// Move the processed files to the archive directories.
 
-	if err := c.archiveFiles(outputPath); err != nil {
+	if err := c.archiveFiles(outputs); err != nil {
 		// Log the error but don't fail the processing.
 		c.logger.Warn("Failed to archive files: %v", err)
 	}
+	result.Stats.Stages.Archive = lap(&stageStart)
 
 	// =========================================================================
 	// COMPLETE
@@ -312,130 +893,700 @@ func (c *Converter) Run() Result {
 	result.Success = true
 	result.Stats.ProcessingTime = time.Since(startTime)
 
+	c.recordTemplateVersion()
+	c.recordHeaders(headers)
+	c.recordConversion(outputs[0].conv.recordedFileName(outputs[0].name))
+
 	return result
 }
 
 // =============================================================================
-// HELPER FUNCTIONS
+// PIPELINE STAGES
 // =============================================================================
+// The stages shared by Run, Precheck, and the stream conversion (see
+// stream.go). Each records its statistics in the result.
 
-// determineTemplate finds the appropriate XLSX template for the input file.
+// prepareColumns applies the department's header aliases to the parsed
+// data and drops its ignored columns, before the headers are compared with
+// the last run or mapped to the template.
 //
 // RETURNS:
-//   - The path to the XLSX template file.
-//   - An error if no matching template is found.
-//
-// MATCHING LOGIC:
-//   This function iterates through the template mapping rules in the department
-//   configuration and returns the first matching template.
-//
-// CUSTOMIZATION:
-//   - Modify the matching logic if your file naming conventions are different.
-//   - Add support for default templates.
-func (c *Converter) determineTemplate() (string, error) {
-	fileName := filepath.Base(c.csvPath)
-
-	// Iterate through template mapping rules.
-	for _, rule := range c.deptConfig.TemplateMapping {
-		// Check if the file name contains the specified substring.
-		if containsIgnoreCase(fileName, rule.IfFilenameContains) {
-			// Construct the full path to the template.
-			templatePath := filepath.Join(c.mainConfig.TemplatesDir, rule.UseTemplate)
-
-			// Verify the template exists.
-			if _, err := os.Stat(templatePath); os.IsNotExist(err) {
-				return "", fmt.Errorf("template file not found: %s", templatePath)
-			}
-
-			return templatePath, nil
-		}
+//   - An error if a renamed column would have the header of another column.
+func (c *Converter) prepareColumns(csvData *csvparser.CSVData) error {
+	renamed, err := csvparser.RenameHeaders(csvData, c.deptConfig.HeaderAliases)
+	if err != nil {
+		return fmt.Errorf("failed to apply header_aliases: %w", err)
+	}
+	if len(renamed) > 0 {
+		c.logger.Debug("Renamed headers: %s", strings.Join(renamed, ", "))
 	}
 
-	return "", fmt.Errorf("no matching template found for file: %s", fileName)
+	if dropped := csvparser.DropColumns(csvData, c.deptConfig.IgnoredColumns); len(dropped) > 0 {
+		c.logger.Debug("Ignored columns: %s", strings.Join(dropped, ", "))
+	}
+	return nil
 }
 
-// groupTransactions groups CSV rows into transactions based on the grouping configuration.
+// checkUnmappedColumns fails the file, with strict_columns, if it has a
+// column that no template maps, so a renamed column does not silently
+// vanish from the XML.
 //
 // PARAMETERS:
-//   - csvData: The parsed CSV data.
+//   - headers: The headers of the file.
+//   - schemas: The template selected by each row, or nil.
 //
 // RETURNS:
-//   - A slice of Transaction structs, each containing its line items.
-//
-// GROUPING LOGIC:
-//   Rows are grouped by the value of the field specified in TransactionGrouping.GroupByField.
-//   All rows with the same value in this field belong to the same transaction.
-//
-// CUSTOMIZATION:
-//   - Modify this function if your grouping logic is more complex.
-//   - Add support for multiple grouping fields.
-//
-// QUESTION FOR USER:
-//   What field in your CSV identifies which rows belong to the same transaction?
-//   This could be a check number, batch ID, transaction ID, or any other unique identifier.
-//   Please update the GroupByField in your department configuration.
-func (c *Converter) groupTransactions(csvData *csvparser.CSVData) []Transaction {
-	groupByField := c.deptConfig.TransactionGrouping.GroupByField
-
-	// If no grouping field is specified, treat each row as a separate transaction.
-	if groupByField == "" {
-		transactions := make([]Transaction, len(csvData.Rows))
-		for i, row := range csvData.Rows {
-			transactions[i] = Transaction{
-				ID:        i + 1,
-				LineItems: []LineItem{{ID: i + 1, Fields: row}},
-			}
-		}
-		return transactions
+//   - An error naming the unmapped columns.
+func (c *Converter) checkUnmappedColumns(headers []string, schemas []*xlsxparser.Schema) error {
+	if !c.deptConfig.StrictColumns {
+		return nil
 	}
 
-	// Group rows by the grouping field.
-	groups := make(map[string][]map[string]string)
-	groupOrder := []string{} // Maintain order of first occurrence
-
-	for _, row := range csvData.Rows {
-		key := row[groupByField]
-		if _, exists := groups[key]; !exists {
-			groupOrder = append(groupOrder, key)
+	used := map[string]bool{
+		c.deptConfig.TransactionGrouping.GroupByField: true,
+		c.deptConfig.BatchGrouping.GroupByField:       true,
+		c.deptConfig.TemplateSelector.Field:           true,
+	}
+	templates := []*xlsxparser.Schema{c.schema}
+	for _, schema := range schemas {
+		if schema != templates[len(templates)-1] {
+			templates = append(templates, schema)
 		}
-		groups[key] = append(groups[key], row)
 	}
 
-	// Convert groups to transactions.
-	transactions := make([]Transaction, len(groupOrder))
-	lineItemCounter := 1 // Global line item counter
-
-	for i, key := range groupOrder {
-		rows := groups[key]
-		lineItems := make([]LineItem, len(rows))
+	// Fields the template rule turned off are mapped, just not for this
+	// file.
+	for _, field := range c.schema.InactiveFields {
+		used[field] = true
+	}
 
-		for j, row := range rows {
-			lineItems[j] = LineItem{
-				ID:     lineItemCounter,
-				Fields: row,
+	var unmapped []string
+	for _, header := range headers {
+		if used[header] {
+			continue
+		}
+		mapped := false
+		for _, schema := range templates {
+			if schema.GetFieldMapping(header) != nil {
+				mapped = true
+				break
 			}
-			lineItemCounter++
 		}
-
-		transactions[i] = Transaction{
-			ID:        i + 1,
-			GroupKey:  key,
-			LineItems: lineItems,
+		if !mapped {
+			unmapped = append(unmapped, header)
 		}
 	}
-
-	return transactions
+	if len(unmapped) > 0 {
+		return fmt.Errorf("unmapped columns with strict_columns: %s (map them in the template, rename them with header_aliases, or list them in ignored_columns)",
+			strings.Join(unmapped, ", "))
+	}
+	return nil
 }
 
-// applyTransformations applies transformation rules to a transaction.
+// buildTransactions de-duplicates and sorts the rows, groups them into
+// transactions, and applies the transformation rules (steps 4 and 5).
 //
 // PARAMETERS:
-//   - transaction: A pointer to the transaction to transform.
+//   - csvData: The parsed CSV data. Duplicate rows are removed from it.
+//   - stats: The statistics to record row, duplicate, and transaction
+//     counts in.
 //
 // RETURNS:
-//   - An error if any transformation fails.
-//
-// TRANSFORMATION TYPES:
+//   - The transformed transactions.
+//   - The duplicate rows, to be reported with the validation result.
+//   - An error if a transformation fails.
+func (c *Converter) buildTransactions(csvData *csvparser.CSVData, stats *ProcessingStats) ([]Transaction, []*validation.ValidationError, error) {
+	stats.RowsProcessed = len(csvData.Rows)
+	c.rowsRead = stats.RowsProcessed
+
+	// Remove duplicate rows, if the department configures de-duplication.
+	duplicates := c.removeDuplicates(csvData)
+	stats.DuplicatesDropped = stats.RowsProcessed - len(csvData.Rows)
+	for _, duplicate := range duplicates {
+		if duplicate.Severity != "error" {
+			c.logger.Info("Dropped duplicate row: %s", duplicate.Error())
+		}
+	}
+
+	c.sortRows(csvData)
+	schemas, err := c.selectTemplates(csvData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to select templates: %w", err)
+	}
+	if err := c.checkUnmappedColumns(csvData.Headers, schemas); err != nil {
+		return nil, nil, err
+	}
+	transactions := c.groupTransactions(csvData, schemas)
+	transactions = c.splitTransactions(transactions)
+	transactions = c.batchTransactions(transactions)
+	c.logger.Debug("Grouped into %d transactions", len(transactions))
+
+	for i := range transactions {
+		if err := c.applyTransformations(&transactions[i]); err != nil {
+			return nil, nil, fmt.Errorf("failed to apply transformations: %w", err)
+		}
+	}
+	c.logger.Debug("Applied transformation rules")
+
+	// Blank line items are known once the values are transformed.
+	transactions, err = c.removeBlankLineItems(transactions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stats.TransactionsCreated = len(transactions)
+	for _, transaction := range transactions {
+		stats.LineItemsCreated += len(transaction.LineItems)
+	}
+	return transactions, duplicates, nil
+}
+
+// validate validates the transactions against the schema (step 6) and
+// logs the errors. Whether errors fail the file is up to the caller.
+//
+// PARAMETERS:
+//   - transactions: The transformed transactions.
+//   - duplicates: The duplicate rows found by buildTransactions.
+//   - result: The result to record the validation result and counts in.
+//
+// RETURNS:
+//   - The validation errors (excluding suppressed errors and warnings).
+func (c *Converter) validate(transactions []Transaction, duplicates []*validation.ValidationError, result *Result) []*validation.ValidationError {
+	validationResult := c.validateTransactions(transactions)
+	c.checkRunKeys(transactions, validationResult)
+	c.checkKeyHistory(transactions, validationResult)
+	return c.reportValidation(validationResult, duplicates, result)
+}
+
+// reportValidation masks and logs the errors of a validation result, and
+// records it in the file's result (see validate).
+//
+// RETURNS:
+//   - The validation errors (excluding suppressed errors and warnings).
+func (c *Converter) reportValidation(validationResult *validation.ValidationResult, duplicates []*validation.ValidationError, result *Result) []*validation.ValidationError {
+	c.maskErrors(validationResult.Errors)
+	c.maskErrors(validationResult.Suppressed)
+	reportDuplicates(validationResult, duplicates)
+	result.Validation = validationResult
+	result.Stats.ValidationErrors = validationResult.ErrorCount + validationResult.WarningCount
+	result.Stats.SuppressedErrors = len(validationResult.Suppressed)
+
+	// Report suppressed errors with their documented justification.
+	for _, ve := range validationResult.Suppressed {
+		c.logger.Info("Suppressed validation error: %s (justification: %s)", ve.Error(), ve.Justification)
+	}
+
+	// Warnings (e.g., from custom validations) are logged and reported,
+	// but do not fail the file.
+	var fatal []*validation.ValidationError
+	for _, ve := range validationResult.Errors {
+		c.logger.Warn("Validation error: %s", ve.Error())
+		if ve.Severity == "error" {
+			fatal = append(fatal, ve)
+		}
+	}
+
+	for _, coalesced := range validationResult.Coalesced {
+		c.logger.Warn("Validation error: %s on field '%s': ...and %d more like this", coalesced.Code, coalesced.Field, coalesced.Count)
+	}
+	if validationResult.Truncated {
+		c.logger.Warn("Validation stopped after %d errors (error_limits: max_errors); later rows were not validated",
+			validationResult.ErrorCount+validationResult.WarningCount)
+	}
+
+	return fatal
+}
+
+// validationFailed returns the error of a file that failed validation.
+func validationFailed(validationResult *validation.ValidationResult) error {
+	if validationResult.Truncated {
+		return fmt.Errorf("%w with %d errors (stopped early; see error_limits)", ErrValidationFailed, validationResult.ErrorCount)
+	}
+	return fmt.Errorf("%w with %d errors", ErrValidationFailed, validationResult.ErrorCount)
+}
+
+// generate generates the XML document (step 7).
+//
+// PARAMETERS:
+//   - transactions: The transformed transactions.
+//
+// RETURNS:
+//   - The transactions as passed to the XML writer.
+//   - The options the document was generated with.
+//   - The XML document.
+//   - An error if the options or the document cannot be built.
+func (c *Converter) generate(transactions []Transaction) ([]xmlwriter.Transaction, xmlwriter.GenerateOptions, []byte, error) {
+	// Convert transactions to xmlwriter types.
+	xmlTransactions := convertToXMLWriterTransactions(transactions)
+	options, err := c.generateOptions(transactions)
+	if err != nil {
+		return nil, options, nil, err
+	}
+
+	// Only the template's XML is traced and checkpointed.
+	formatter, err := c.outputFormatter()
+	if err != nil {
+		return nil, options, nil, err
+	}
+	if formatter == nil {
+		if c.deptConfig.Provenance.Enabled {
+			options.Provenance = &xmlwriter.Provenance{SourceFile: filepath.Base(c.csvPath)}
+		}
+		// An encrypted document is written locally and encrypted into the
+		// output directory, so there is no slow write to checkpoint.
+		if c.mainConfig.OutputCheckpoints.Enabled() && !c.deptConfig.PGP.Encrypts() {
+			options.TransactionOffsets = new([]int64)
+		}
+	}
+
+	doc, err := c.render(xmlTransactions, options)
+	if err != nil {
+		return nil, options, nil, err
+	}
+	return xmlTransactions, options, doc, nil
+}
+
+// render writes the document of the transactions in the department's
+// output format: the template's XML, or that of its formatter.
+//
+// PARAMETERS:
+//   - xmlTransactions: The transactions as passed to the XML writer.
+//   - options: The options to generate XML with.
+//
+// RETURNS:
+//   - The document.
+//   - An error if the document cannot be written.
+func (c *Converter) render(xmlTransactions []xmlwriter.Transaction, options xmlwriter.GenerateOptions) ([]byte, error) {
+	// Other formats than XML are written by their formatter.
+	formatter, err := c.outputFormatter()
+	if err != nil {
+		return nil, err
+	}
+	if formatter != nil {
+		doc, err := formatter.Format(outputformat.Document{
+			Transactions: xmlTransactions,
+			Department:   c.deptConfig,
+			Expand:       c.expandPlaceholders,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate %s document: %w", c.deptConfig.OutputFormat.Type, err)
+		}
+		c.logger.Debug("Generated %s document", c.deptConfig.OutputFormat.Type)
+		return doc, nil
+	}
+
+	xmlDoc, err := xmlwriter.GenerateWithOptions(xmlTransactions, c.schema, c.deptConfig, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate XML: %w", err)
+	}
+
+	c.logger.Debug("Generated XML document")
+	return xmlDoc, nil
+}
+
+// =============================================================================
+// HELPER FUNCTIONS
+// =============================================================================
+
+// determineTemplate finds the appropriate XLSX template for the input file.
+//
+// RETURNS:
+//   - The path to the XLSX template file.
+//   - An error if no matching template is found.
+//
+// MATCHING LOGIC:
+//   This function iterates through the template mapping rules in the department
+//   configuration and returns the first matching template.
+//
+// CUSTOMIZATION:
+//   - Modify the matching logic if your file naming conventions are different.
+//   - Add support for default templates.
+func (c *Converter) determineTemplate() (string, error) {
+	rule, ok := c.MatchTemplateRule()
+	if !ok {
+		return "", fmt.Errorf("no matching template found for file: %s", filepath.Base(c.csvPath))
+	}
+
+	// Construct the full path to the template.
+	templatePath := filepath.Join(c.mainConfig.TemplatesDir, rule.UseTemplate)
+
+	// Verify the template exists.
+	if _, ok := c.templates[templatePath]; ok {
+		return templatePath, nil
+	}
+	if _, err := os.Stat(templatePath); os.IsNotExist(err) {
+		return "", fmt.Errorf("template file not found: %s", templatePath)
+	}
+
+	return templatePath, nil
+}
+
+// parseTemplate returns the schema of the template at templatePath: the
+// template parsed in advance (see SetTemplates), or the parsed file, with
+// the fields of the file's template rule (see xlsxparser.Schema.Subset).
+func (c *Converter) parseTemplate(templatePath string) (*xlsxparser.Schema, error) {
+	schema, ok := c.templates[templatePath]
+	if !ok {
+		var err error
+		if schema, err = xlsxparser.Parse(templatePath); err != nil {
+			return nil, err
+		}
+	}
+
+	// An emit condition that cannot be evaluated would drop the element
+	// from every row, and a conditional tag would never apply.
+	for header, mapping := range schema.FieldMappings {
+		if mapping.EmitCondition != "" && !validation.IsSupportedCondition(mapping.EmitCondition) {
+			return nil, fmt.Errorf("unsupported emit condition %q for field %s", mapping.EmitCondition, header)
+		}
+		for _, tag := range mapping.ConditionalTags {
+			if !validation.IsSupportedCondition(tag.Condition) {
+				return nil, fmt.Errorf("unsupported condition %q of tag <%s> for field %s", tag.Condition, tag.XMLTag, header)
+			}
+		}
+	}
+
+	// The file's template rule may turn some of the template's fields off.
+	rule, ok := c.MatchTemplateRule()
+	if !ok || filepath.Join(c.mainConfig.TemplatesDir, rule.UseTemplate) != templatePath {
+		return schema, nil
+	}
+	subset, err := schema.Subset(rule.Fields, rule.ExcludeFields)
+	if err != nil {
+		return nil, fmt.Errorf("template_mapping rule %q: %w", rule.IfFilenameContains, err)
+	}
+	return subset, nil
+}
+
+// MatchTemplateRule finds the template mapping rule for the input file: the
+// first rule whose substring the file name contains (ignoring case).
+//
+// RETURNS:
+//   - The matching rule.
+//   - false if no rule matches.
+func (c *Converter) MatchTemplateRule() (config.TemplateRule, bool) {
+	fileName := filepath.Base(c.csvPath)
+
+	// Iterate through template mapping rules.
+	for _, rule := range c.deptConfig.TemplateMapping {
+		// Check if the file name contains the specified substring.
+		if containsIgnoreCase(fileName, rule.IfFilenameContains) {
+			return rule, true
+		}
+	}
+
+	return config.TemplateRule{}, false
+}
+
+// validationOptions builds the validation options for this department.
+//
+// RETURNS:
+//   - The default validation options plus the department's suppressions,
+//     custom validations, and error limits.
+func (c *Converter) validationOptions() validation.ValidationOptions {
+	options := validation.DefaultValidationOptions()
+
+	for _, suppression := range c.deptConfig.ValidationSuppressions {
+		options.Suppressions = append(options.Suppressions, validation.Suppression{
+			Code:          suppression.Code,
+			Field:         suppression.Field,
+			Justification: suppression.Justification,
+		})
+	}
+
+	options.MaxErrors, options.MaxSameRuleErrors = c.deptConfig.ErrorLimits.Caps()
+	options.MinLineItems = c.deptConfig.TransactionGrouping.MinLineItems
+	options.EmitConditions = c.deptConfig.XMLOutput.EmitConditions
+
+	// The holiday file is read for each file, so edits apply without a
+	// restart of the watch command.
+	var calendar *validation.BusinessCalendar
+	if c.deptConfig.NeedsBusinessCalendar() {
+		var err error
+		if calendar, err = c.deptConfig.BusinessCalendar.Load(); err != nil {
+			c.logger.Warn("Business dates cannot be checked: %v", err)
+		}
+	}
+
+	for _, custom := range c.deptConfig.CustomValidations {
+		compiled, err := custom.Compile(calendar)
+		if err != nil {
+			// Loaded configurations are checked; this is one built in code.
+			c.logger.Warn("Ignoring custom validation of %s: %v", custom.Field, err)
+			continue
+		}
+		options.CustomValidations = append(options.CustomValidations, compiled)
+	}
+
+	return options
+}
+
+// groupTransactions groups CSV rows into transactions based on the grouping configuration.
+//
+// PARAMETERS:
+//   - csvData: The parsed CSV data.
+//   - schemas: The template selected by each row (see selector.go), or nil.
+//     Rows that select different templates never share a transaction.
+//
+// RETURNS:
+//   - A slice of Transaction structs, each containing its line items.
+//
+// GROUPING LOGIC:
+//   Rows are grouped by the value of the field specified in TransactionGrouping.GroupByField.
+//   All rows with the same value in this field belong to the same transaction.
+//   Line items get their own copy of each row, so transformations never modify
+//   csvData and the original values remain available (e.g., for fix-up exports).
+//
+// CUSTOMIZATION:
+//   - Modify this function if your grouping logic is more complex.
+//   - Add support for multiple grouping fields.
+//
+// QUESTION FOR USER:
+//   What field in your CSV identifies which rows belong to the same transaction?
+//   This could be a check number, batch ID, transaction ID, or any other unique identifier.
+//   Please update the GroupByField in your department configuration.
+func (c *Converter) groupTransactions(csvData *csvparser.CSVData, schemas []*xlsxparser.Schema) []Transaction {
+	groupByField := c.deptConfig.TransactionGrouping.GroupByField
+	schemaAt := func(i int) *xlsxparser.Schema {
+		if schemas == nil {
+			return nil
+		}
+		return schemas[i]
+	}
+
+	// If no grouping field is specified, treat each row as a separate transaction.
+	if groupByField == "" {
+		transactions := make([]Transaction, len(csvData.Rows))
+		for i, row := range csvData.Rows {
+			transactions[i] = Transaction{
+				ID:        i + 1,
+				LineItems: []LineItem{{ID: i + 1, Fields: copyFields(row), OriginalRowNumber: rowNumberAt(csvData, i)}},
+				Schema:    schemaAt(i),
+			}
+		}
+		return transactions
+	}
+
+	// Group rows by the grouping field (and selected template).
+	// Groups hold indices into csvData.Rows so original row numbers are kept.
+	type groupID struct {
+		key    string
+		schema *xlsxparser.Schema
+	}
+	groups := make(map[groupID][]int)
+	groupOrder := []groupID{} // Maintain order of first occurrence
+
+	for rowIndex, row := range csvData.Rows {
+		key := groupID{key: row[groupByField], schema: schemaAt(rowIndex)}
+		if _, exists := groups[key]; !exists {
+			groupOrder = append(groupOrder, key)
+		}
+		groups[key] = append(groups[key], rowIndex)
+	}
+
+	// Convert groups to transactions.
+	transactions := make([]Transaction, len(groupOrder))
+	lineItemCounter := 1 // Global line item counter
+
+	for i, key := range groupOrder {
+		rowIndices := groups[key]
+		lineItems := make([]LineItem, len(rowIndices))
+
+		for j, rowIndex := range rowIndices {
+			lineItems[j] = LineItem{
+				ID:                lineItemCounter,
+				Fields:            copyFields(csvData.Rows[rowIndex]),
+				OriginalRowNumber: rowNumberAt(csvData, rowIndex),
+			}
+			lineItemCounter++
+		}
+
+		transactions[i] = Transaction{
+			ID:        i + 1,
+			GroupKey:  key.key,
+			LineItems: lineItems,
+			Schema:    key.schema,
+		}
+	}
+
+	return transactions
+}
+
+// splitTransactions enforces the department's line item cap by moving
+// excess line items into continuation transactions.
+//
+// PARAMETERS:
+//   - transactions: The grouped transactions.
+//
+// RETURNS:
+//   - The transactions, renumbered from 1. A continuation directly follows
+//     the transaction it continues and has the same group key. Its first
+//     line item carries the transaction-level fields of the original first
+//     line item, so all parts have the same transaction-level fields. Line
+//     item numbers are unchanged.
+func (c *Converter) splitTransactions(transactions []Transaction) []Transaction {
+	limit := c.deptConfig.TransactionGrouping.MaxLineItems
+	if limit <= 0 {
+		return transactions
+	}
+
+	split := make([]Transaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		for start := 0; start < len(transaction.LineItems) || start == 0; start += limit {
+			end := start + limit
+			if end > len(transaction.LineItems) {
+				end = len(transaction.LineItems)
+			}
+
+			part := Transaction{
+				ID:        len(split) + 1,
+				GroupKey:  transaction.GroupKey,
+				LineItems: transaction.LineItems[start:end],
+				Schema:    transaction.Schema,
+			}
+
+			if start > 0 {
+				c.copyTransactionFields(c.transactionSchema(transaction), transaction.LineItems[0], &part.LineItems[0])
+			}
+			split = append(split, part)
+		}
+	}
+
+	if len(split) > len(transactions) {
+		c.logger.Info("Split %d transaction(s) into %d to keep at most %d line items each",
+			len(transactions), len(split), limit)
+	}
+	return split
+}
+
+// batchTransactions assigns each transaction to a batch by the department's
+// batch grouping field.
+//
+// PARAMETERS:
+//   - transactions: The grouped transactions.
+//
+// RETURNS:
+//   - The transactions ordered by batch (batches in order of first
+//     occurrence, transactions in their original order within a batch) and
+//     renumbered, so transaction and line item numbers follow the output.
+func (c *Converter) batchTransactions(transactions []Transaction) []Transaction {
+	field := c.deptConfig.BatchGrouping.GroupByField
+	if field == "" {
+		return transactions
+	}
+
+	batches := make(map[string][]Transaction)
+	batchOrder := []string{}
+	for _, transaction := range transactions {
+		key := ""
+		if len(transaction.LineItems) > 0 {
+			key = transaction.LineItems[0].Fields[field]
+		}
+		transaction.BatchKey = key
+
+		if _, exists := batches[key]; !exists {
+			batchOrder = append(batchOrder, key)
+		}
+		batches[key] = append(batches[key], transaction)
+	}
+
+	ordered := make([]Transaction, 0, len(transactions))
+	lineItemCounter := 1
+	for _, key := range batchOrder {
+		for _, transaction := range batches[key] {
+			transaction.ID = len(ordered) + 1
+			for i := range transaction.LineItems {
+				transaction.LineItems[i].ID = lineItemCounter
+				lineItemCounter++
+			}
+			ordered = append(ordered, transaction)
+		}
+	}
+
+	c.logger.Debug("Grouped transactions into %d batches", len(batchOrder))
+	return ordered
+}
+
+// batchSummaries computes the summary elements of each batch.
+//
+// PARAMETERS:
+//   - transactions: The transformed transactions, ordered by batch.
+//
+// RETURNS:
+//   - One summary per batch, in order, or nil without batch grouping.
+//   - An error if a total cannot be computed.
+func (c *Converter) batchSummaries(transactions []Transaction) ([]xmlwriter.Batch, error) {
+	settings := c.deptConfig.BatchGrouping
+	if settings.GroupByField == "" {
+		return nil, nil
+	}
+
+	var summaries []xmlwriter.Batch
+	for start := 0; start < len(transactions); {
+		end := start
+		for end < len(transactions) && transactions[end].BatchKey == transactions[start].BatchKey {
+			end++
+		}
+		batch := transactions[start:end]
+
+		summary := xmlwriter.Batch{Key: batch[0].BatchKey}
+		if settings.KeyElement != "" {
+			summary.Fields = append(summary.Fields, config.HeaderField{Name: settings.KeyElement, Value: summary.Key})
+		}
+		if settings.CountElement != "" {
+			summary.Fields = append(summary.Fields, config.HeaderField{Name: settings.CountElement, Value: strconv.Itoa(len(batch))})
+		}
+		if settings.LineItemCountElement != "" {
+			count := 0
+			for _, transaction := range batch {
+				count += len(transaction.LineItems)
+			}
+			summary.Fields = append(summary.Fields, config.HeaderField{Name: settings.LineItemCountElement, Value: strconv.Itoa(count)})
+		}
+
+		for _, total := range settings.Totals {
+			rows := batch
+			if total.Scope == "transactions" {
+				// Only the first row of each transaction.
+				rows = make([]Transaction, len(batch))
+				for i, transaction := range batch {
+					rows[i] = Transaction{LineItems: transaction.LineItems[:1]}
+				}
+			}
+
+			sum, err := sumColumn(rows, total.Field)
+			if err != nil {
+				return nil, fmt.Errorf("batch total %s: %w", total.XMLTag, err)
+			}
+			summary.Fields = append(summary.Fields, config.HeaderField{Name: total.XMLTag, Value: sum})
+		}
+
+		summaries = append(summaries, summary)
+		start = end
+	}
+
+	return summaries, nil
+}
+
+// copyTransactionFields copies the transaction-level fields of the schema
+// from one line item to another.
+func (c *Converter) copyTransactionFields(schema *xlsxparser.Schema, from LineItem, to *LineItem) {
+	for _, field := range schema.TransactionFields {
+		if value, ok := from.Fields[field]; ok {
+			to.Fields[field] = value
+		}
+	}
+}
+
+// applyTransformations applies transformation rules to a transaction.
+//
+// PARAMETERS:
+//   - transaction: A pointer to the transaction to transform.
+//
+// RETURNS:
+//   - An error if any transformation fails.
+//
+// TRANSFORMATION TYPES:
 //   - prepend_string: Add a string to the beginning of the value
 //   - append_string: Add a string to the end of the value
 //   - pad_zeros_to_length: Pad with leading zeros to a specific length
@@ -449,6 +1600,8 @@ func (c *Converter) groupTransactions(csvData *csvparser.CSVData) []Transaction
 //   - format_number: Format a number
 //   - lookup: Replace value using a lookup table
 //   - conditional: Apply transformation based on a condition
+//   - normalize_sign, apply_sign_indicator, sign_indicator,
+//     unsigned_amount: Debit/credit sign conventions (see sign.go)
 //
 // CUSTOMIZATION:
 //   - Add new transformation types as needed.
@@ -465,14 +1618,24 @@ func (c *Converter) applyTransformations(transaction *Transaction) error {
 
 			// Apply each action in sequence.
 			for _, action := range rule.Actions {
-				var err error
-				value, err = applyAction(value, action)
+				transformed, err := applyAction(value, action, transaction.LineItems[i].Fields)
 				if err != nil {
-					return fmt.Errorf("failed to apply %s to field %s: %w", action.Type, rule.Field, err)
+					err = fmt.Errorf("failed to apply %s to field %s: %w", action.Type, rule.Field, err)
+					if c.failurePolicy(config.StageTransform) != config.FailContinue {
+						return err
+					}
+					// Keep the value and go on with the next action.
+					c.skipTransformFailure(rule.Field+"/"+action.Type, err)
+					continue
+				}
+				if transformed != value {
+					c.traceTransformation(&transaction.LineItems[i], rule.Field, action.Type, value, transformed)
 				}
+				value = transformed
 			}
 
-			// Update the field with the transformed value.
+			// Update the field with the transformed value. Later rules see
+			// it (see sign.go).
 			transaction.LineItems[i].Fields[rule.Field] = value
 		}
 	}
@@ -480,11 +1643,24 @@ func (c *Converter) applyTransformations(transaction *Transaction) error {
 	return nil
 }
 
+// skipTransformFailure logs a transformation failure skipped under the
+// "continue" failure policy, once per field and action.
+func (c *Converter) skipTransformFailure(key string, err error) {
+	if c.transformFailures == nil {
+		c.transformFailures = make(map[string]bool)
+	}
+	if !c.transformFailures[key] {
+		c.transformFailures[key] = true
+		c.logger.Warn("%v; keeping the values unchanged (failure_policy on_transform_error: continue)", err)
+	}
+}
+
 // applyAction applies a single transformation action to a value.
 //
 // PARAMETERS:
 //   - value: The current value of the field.
 //   - action: The transformation action to apply.
+//   - fields: All fields of the row, for actions that read other columns.
 //
 // RETURNS:
 //   - The transformed value.
@@ -492,7 +1668,11 @@ func (c *Converter) applyTransformations(transaction *Transaction) error {
 //
 // CUSTOMIZATION:
 //   Add new cases to this switch statement for new transformation types.
-func applyAction(value string, action config.TransformationAction) (string, error) {
+func applyAction(value string, action config.TransformationAction, fields map[string]string) (string, error) {
+	if isSignAction(action.Type) {
+		return applySignAction(value, action, fields)
+	}
+
 	switch action.Type {
 	case "prepend_string":
 		// Add a string to the beginning of the value.
@@ -521,8 +1701,8 @@ func applyAction(value string, action config.TransformationAction) (string, erro
 		if targetLength <= 0 {
 			return value, nil
 		}
-		if len(value) > targetLength {
-			return value[:targetLength], nil
+		if utf8.RuneCountInString(value) > targetLength {
+			return value[:runeOffset(value, targetLength)], nil
 		}
 		return padLeft(value, targetLength, '0'), nil
 
@@ -551,6 +1731,15 @@ func applyAction(value string, action config.TransformationAction) (string, erro
 		}
 		return value, nil
 
+	case "lookup_with_default":
+		// Replace value using a lookup table, with action.Value for values
+		// not in the table.
+		// Example: "03" with lookup {"01": "January"} and value "Other" becomes "Other"
+		if replacement, exists := action.LookupTable[value]; exists {
+			return replacement, nil
+		}
+		return action.Value, nil
+
 	case "conditional":
 		// Apply transformation based on a condition.
 		// CUSTOMIZATION: Implement your conditional logic here.
@@ -567,110 +1756,652 @@ func applyAction(value string, action config.TransformationAction) (string, erro
 	}
 }
 
-// writeOutput writes the XML document to the output directory.
+// writeOutput writes the XML document to the output directory, or, if the
+// department encrypts its output, to a temporary plaintext file that PGP
+// encrypts into the output directory (see plaintextPath).
 //
 // PARAMETERS:
-//   - xmlDoc: The XML document to write.
+//   - out: The generated document. Its offsets (options.TransactionOffsets)
+//     write the file with checkpoints (see checkpoint.go), if not nil. Its
+//     plaintext path is set if it is encrypted.
 //
 // RETURNS:
 //   - The path to the output file.
 //   - An error if the file cannot be written.
 //
 // FILE NAMING:
-//   The output file is named according to the UUIDFormat in the main configuration.
+//   The output file is named according to the UUIDFormat in the department
+//   configuration, or in the main configuration.
 //   Placeholders are replaced with actual values:
 //   - {uuid}: A random UUID
 //   - {timestamp}: Current timestamp
 //   - {dept}: Department code
-//   - {type}: Transaction type
+//   - {sequence}: The department's file sequence number
+//   See placeholderValues for the full list.
 //
 // CUSTOMIZATION:
 //   Modify the generateOutputFileName function to match your naming conventions.
-func (c *Converter) writeOutput(xmlDoc []byte) (string, error) {
-	// Generate the output file name.
-	fileName := c.generateOutputFileName()
-	outputPath := filepath.Join(c.mainConfig.OutputDir, fileName)
+func (c *Converter) writeOutput(out *documentOutput) (string, error) {
+	outputPath, err := c.outputPath()
+	if err != nil {
+		return "", err
+	}
+
+	if offsets := out.options.TransactionOffsets; offsets != nil {
+		if err := c.writeCheckpointed(outputPath, out.xmlDoc, *offsets); err != nil {
+			return "", err
+		}
+		return outputPath, nil
+	}
 
-	// Write the XML document to the file.
-	if err := os.WriteFile(outputPath, xmlDoc, 0644); err != nil {
+	writePath := outputPath
+	if out.plaintext, err = c.plaintextPath(outputPath); err != nil {
+		return "", err
+	}
+	if out.plaintext != "" {
+		writePath = out.plaintext
+	}
+
+	// Write the XML document to the file. A write that fails part way, for
+	// example on a full volume, must not leave a truncated document behind.
+	if err := c.writeFile(utils.LongPath(writePath), out.xmlDoc); err != nil {
+		os.Remove(utils.LongPath(writePath))
 		return "", fmt.Errorf("failed to write file: %w", err)
 	}
 
 	return outputPath, nil
 }
 
+// writeFile writes data to a file, like os.WriteFile, with the injected
+// write error, if any (see faults.go).
+func (c *Converter) writeFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = c.faults.outputWriter(file).Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// outputPath names the output file (see writeOutput) and creates its
+// directory.
+//
+// RETURNS:
+//   - The path to write the output file to.
+//   - An error if the name cannot be generated or the directory created.
+func (c *Converter) outputPath() (string, error) {
+	// Generate the output file name.
+	fileName, err := c.generateOutputFileName()
+	if err != nil {
+		return "", err
+	}
+	outputDir := c.mainConfig.OutputDir
+
+	// With a delivery schedule, the file waits in the hold directory until
+	// it is released to the output directory (see internal/schedule).
+	if c.mainConfig.DeliverySchedule.Enabled() {
+		outputDir = schedule.HoldDir(c.mainConfig.DeliverySchedule.HoldDir, c.deptConfig.DepartmentCode)
+	}
+
+	// Placeholders may expand to characters or lengths that Windows does
+	// not accept. The name must fit where the file is finally delivered.
+	fileName = utils.SafeFileName(c.mainConfig.OutputDir, fileName)
+	outputPath := filepath.Join(outputDir, fileName)
+
+	// A department's own output directory may not exist yet.
+	if err := os.MkdirAll(utils.LongPath(outputDir), 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	return outputPath, nil
+}
+
 // generateOutputFileName generates the output file name based on the UUID format.
 //
 // RETURNS:
 //   - The generated file name.
+//   - An error if a sequence number is needed and cannot be allocated.
 //
 // CUSTOMIZATION:
 //   Modify this function to match your file naming conventions.
-//   Add support for additional placeholders as needed.
-func (c *Converter) generateOutputFileName() string {
-	format := c.mainConfig.UUIDFormat
+//   Add support for additional placeholders in placeholderValues.
+func (c *Converter) generateOutputFileName() (string, error) {
+	// An interrupted write is resumed under its name (see checkpoint.go).
+	if fileName, ok := c.checkpointedFileName(); ok {
+		return fileName, nil
+	}
 
-	// Generate a UUID.
-	// CUSTOMIZATION: Modify the UUID generation if you need a specific format.
-	id := uuid.New().String()
+	// A file converted before may keep its name (see reprocess.go).
+	if fileName, ok := c.reprocessedFileName(); ok {
+		return documentFileName(fileName, c.documentKey), nil
+	}
+
+	fileName, err := c.expandPlaceholders(c.mainConfig.UUIDFormat)
+	if err != nil {
+		return "", err
+	}
 
-	// Generate a timestamp.
-	timestamp := time.Now().Format("20060102_150405")
+	// Ensure the file has the extension of the output format, e.g. .xml.
+	if extension := c.OutputExtension(); filepath.Ext(fileName) != extension {
+		fileName = strings.TrimSuffix(fileName, ".xml") + extension
+	}
 
-	// Replace placeholders.
-	fileName := format
-	fileName = replaceString(fileName, "{uuid}", id)
-	fileName = replaceString(fileName, "{timestamp}", timestamp)
-	fileName = replaceString(fileName, "{dept}", c.deptConfig.DepartmentCode)
+	return documentFileName(fileName, c.documentKey), nil
+}
 
-	// Ensure the file has an .xml extension.
-	if filepath.Ext(fileName) != ".xml" {
-		fileName += ".xml"
+// outputFormatter returns the formatter of the department's output format
+// (see the outputformat package), or nil for the template's XML. The
+// profile is loaded once per file.
+func (c *Converter) outputFormatter() (outputformat.Formatter, error) {
+	if c.formatter == nil && !c.deptConfig.OutputFormat.IsXML() {
+		formatter, err := outputformat.New(c.deptConfig.OutputFormat)
+		if err != nil {
+			return nil, err
+		}
+		c.formatter = formatter
 	}
+	return c.formatter, nil
+}
 
-	return fileName
+// OutputExtension returns the file extension of the output documents:
+// ".xml", or the extension of the department's output format. It is
+// ".xml" if the format's profile cannot be loaded.
+func (c *Converter) OutputExtension() string {
+	formatter, err := c.outputFormatter()
+	if err != nil || formatter == nil {
+		return ".xml"
+	}
+	return formatter.Extension()
 }
 
-// archiveFiles moves the processed files to the archive directories.
+// generateOptions returns the XML generation options for this file, with
+// the placeholder values for static fields, the document header, and the
+// cashbook field values.
+func (c *Converter) generateOptions(transactions []Transaction) (xmlwriter.GenerateOptions, error) {
+	options := xmlwriter.DepartmentOptions(c.deptConfig.XMLOutput)
+
+	withSequence := false
+	for _, field := range c.deptConfig.StaticFields {
+		if strings.Contains(field.Value, "{sequence}") {
+			withSequence = true
+		}
+	}
+	for _, field := range c.deptConfig.CashbookFields {
+		if field.Source == "value" && strings.Contains(field.Value, "{sequence}") {
+			withSequence = true
+		}
+	}
+
+	values, err := c.placeholderValues(withSequence)
+	if err != nil {
+		return options, err
+	}
+	options.Placeholders = values
+	options.Comment = c.documentComment(transactions)
+
+	if c.deptConfig.DocumentHeader.Enabled {
+		options.DocumentHeader, err = c.documentHeader()
+		if err != nil {
+			return options, fmt.Errorf("failed to build document header: %w", err)
+		}
+	}
+
+	options.CashbookValues, err = c.cashbookValues(transactions)
+	if err != nil {
+		return options, err
+	}
+
+	options.Batches, err = c.batchSummaries(transactions)
+	if err != nil {
+		return options, err
+	}
+
+	if c.deptConfig.TransactionGrouping.ContinueLineItemNumbering {
+		options.LineItemStart, err = c.reserveLineItemNumbers(transactions, values["date"])
+		if err != nil {
+			return options, err
+		}
+	}
+
+	return options, nil
+}
+
+// reserveLineItemNumbers allocates the global line item numbers of this
+// file from the department's counter of the day, so numbering continues
+// across the files of a batch. Concurrent conversions get separate blocks.
+//
+// PARAMETERS:
+//   - transactions: The transactions of the document.
+//   - date: The day of the counter ({date}, e.g., "20240412").
+//
+// RETURNS:
+//   - The number of the first line item.
+//   - An error if the counter cannot be updated.
+func (c *Converter) reserveLineItemNumbers(transactions []Transaction, date string) (int, error) {
+	count := 0
+	for _, transaction := range transactions {
+		count += len(transaction.LineItems)
+	}
+	if count == 0 {
+		return 1, nil
+	}
+
+	path := filepath.Join(c.mainConfig.StateDir, c.deptConfig.DepartmentCode+"-"+date+".lineitems")
+	if c.preview {
+		return utils.PeekSequence(path)
+	}
+	first, err := utils.ReserveSequence(path, count, c.mainConfig.LockStaleAfter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate line item numbers: %w", err)
+	}
+	return first, nil
+}
+
+// cashbookValues computes the values of the template's cashbook-level
+// fields, as configured in the department's cashbook_fields.
+//
+// PARAMETERS:
+//   - transactions: The transformed transactions of the file.
+//
+// RETURNS:
+//   - The values by field (Old Header).
+//   - An error if a column cannot be summed.
+//
+// CUSTOMIZATION:
+//   Add a case here (and to the config validation) for a new source.
+func (c *Converter) cashbookValues(transactions []Transaction) (map[string]string, error) {
+	values := make(map[string]string)
+
+	for _, field := range c.schema.CashbookFields {
+		rule := config.CashbookField{Field: field, Source: "first", Column: field}
+		for _, configured := range c.deptConfig.CashbookFields {
+			if configured.Field == field {
+				rule = configured
+				break
+			}
+		}
+
+		switch rule.Source {
+		case "first":
+			if len(transactions) > 0 && len(transactions[0].LineItems) > 0 {
+				values[field] = transactions[0].LineItems[0].Fields[rule.Column]
+			}
+
+		case "sum":
+			sum, err := sumColumn(transactions, rule.Column)
+			if err != nil {
+				return nil, fmt.Errorf("cashbook field %s: %w", field, err)
+			}
+			values[field] = sum
+
+		case "count":
+			count := 0
+			for _, transaction := range transactions {
+				count += len(transaction.LineItems)
+			}
+			values[field] = strconv.Itoa(count)
+
+		case "transactions":
+			values[field] = strconv.Itoa(len(transactions))
+
+		case "value":
+			value, err := c.expandPlaceholders(rule.Value)
+			if err != nil {
+				return nil, err
+			}
+			values[field] = value
+		}
+	}
+
+	return values, nil
+}
+
+// sumColumn adds up a numeric column over all line items. The sum is exact
+// and has as many decimal places as the most precise value. Empty values
+// are skipped.
+func sumColumn(transactions []Transaction, column string) (string, error) {
+	sum := new(big.Rat)
+	decimals := 0
+
+	for _, transaction := range transactions {
+		for _, lineItem := range transaction.LineItems {
+			value := strings.TrimSpace(lineItem.Fields[column])
+			if value == "" {
+				continue
+			}
+
+			number, ok := new(big.Rat).SetString(value)
+			if !ok {
+				return "", fmt.Errorf("cannot sum %q in column %s (row %d)", value, column, lineItem.OriginalRowNumber)
+			}
+			sum.Add(sum, number)
+
+			if dot := strings.IndexByte(value, '.'); dot >= 0 && len(value)-dot-1 > decimals {
+				decimals = len(value) - dot - 1
+			}
+		}
+	}
+
+	return sum.FloatString(decimals), nil
+}
+
+// documentHeader returns the department's document header fields with
+// their placeholders expanded.
+func (c *Converter) documentHeader() ([]config.HeaderField, error) {
+	fields := make([]config.HeaderField, len(c.deptConfig.DocumentHeader.Fields))
+	for i, field := range c.deptConfig.DocumentHeader.Fields {
+		value, err := c.expandPlaceholders(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = config.HeaderField{Name: field.Name, Value: value}
+	}
+	return fields, nil
+}
+
+// expandPlaceholders replaces the placeholders in format with this file's
+// values (see placeholderValues).
+func (c *Converter) expandPlaceholders(format string) (string, error) {
+	values, err := c.placeholderValues(strings.Contains(format, "{sequence}"))
+	if err != nil {
+		return "", err
+	}
+
+	pairs := make([]string, 0, len(values)*2)
+	for name, value := range values {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(format), nil
+}
+
+// placeholderValues returns the placeholder values of this file. They are
+// computed once, so every use within a file sees the same UUID, time, and
+// sequence number.
+//
+// PARAMETERS:
+//   - withSequence: Whether {sequence} is needed. The sequence number is
+//     only allocated when it is used, so unused numbers are not consumed.
+//
+// RETURNS:
+//   - The values by placeholder name (without braces).
+//   - An error if the sequence number cannot be allocated.
+//
+// CUSTOMIZATION:
+//   Add entries here to support additional placeholders.
+func (c *Converter) placeholderValues(withSequence bool) (map[string]string, error) {
+	if c.placeholders == nil {
+		now := time.Now()
+		fileName := filepath.Base(c.csvPath)
+
+		c.placeholders = map[string]string{
+			"uuid":          uuid.New().String(),
+			"timestamp":     now.Format("20060102_150405"),
+			"datetime":      now.Format(time.RFC3339),
+			"date":          now.Format("20060102"),
+			"time":          now.Format("150405"),
+			"today":         now.Format("2006-01-02"),
+			"dept":          c.deptConfig.DepartmentCode,
+			"filename":      fileName,
+			"original":      strings.TrimSuffix(fileName, filepath.Ext(fileName)),
+			"source_system": c.deptConfig.DocumentHeader.SourceSystem,
+			"version":       Version,
+		}
+		c.placeholders["template"] = c.templateName()
+		c.placeholders["template_version"] = c.templateVersion()
+	}
+
+	if _, ok := c.placeholders["sequence"]; withSequence && !ok {
+		path := filepath.Join(c.mainConfig.StateDir, c.deptConfig.DepartmentCode+".sequence")
+		var sequence int
+		var err error
+		if c.preview {
+			sequence, err = utils.PeekSequence(path)
+		} else {
+			sequence, err = utils.NextSequence(path, c.mainConfig.LockStaleAfter)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate file sequence number: %w", err)
+		}
+		c.placeholders["sequence"] = fmt.Sprintf("%0*d", c.deptConfig.DocumentHeader.SequenceWidth, sequence)
+	}
+
+	return c.placeholders, nil
+}
+
+// publishEvents publishes the conversion events for the file.
+//
+// PARAMETERS:
+//   - result: The result so far (output file, statistics, delivery).
+//   - transactions: The converted transactions.
+//   - xmlTransactions: The same transactions as passed to the XML writer.
+//   - options: The options the XML document was generated with.
+//   - xmlDoc: The generated XML document.
+//
+// RETURNS:
+//   - An error if the broker did not accept the events.
+func (c *Converter) publishEvents(result Result, transactions []Transaction, xmlTransactions []xmlwriter.Transaction, options xmlwriter.GenerateOptions, xmlDoc []byte) error {
+	if c.publisher == nil {
+		return nil
+	}
+	settings := c.mainConfig.Events
+
+	base := events.Event{
+		Type:         events.TypeFileConverted,
+		Time:         time.Now(),
+		File:         filepath.Base(c.csvPath),
+		Department:   c.deptConfig.DepartmentCode,
+		OutputFile:   result.OutputFile,
+		Rows:         result.Stats.RowsProcessed,
+		Transactions: len(transactions),
+	}
+	if result.Delivery != nil {
+		base.DeliveryTarget = result.Delivery.Target
+		base.BatchID = result.Delivery.BatchID
+	}
+
+	var batch []events.Event
+	if settings.Granularity == "transaction" {
+		var fragments [][]byte
+		// Transaction payloads are XML fragments, only for XML documents.
+		if settings.IncludePayload && c.deptConfig.OutputFormat.IsXML() {
+			fragments = xmlwriter.GenerateTransactions(xmlTransactions, c.schema, c.deptConfig, options)
+		}
+		for i, transaction := range transactions {
+			event := base
+			event.Type = events.TypeTransactionConverted
+			event.Transaction = &events.TransactionInfo{
+				ID:        transaction.ID,
+				GroupKey:  transaction.GroupKey,
+				LineItems: len(transaction.LineItems),
+			}
+			if fragments != nil {
+				event.Payload = string(fragments[i])
+			}
+			batch = append(batch, event)
+		}
+	} else {
+		if settings.IncludePayload {
+			base.Payload = string(xmlDoc)
+		}
+		batch = append(batch, base)
+	}
+
+	if err := c.publisher.Publish(context.Background(), batch); err != nil {
+		return err
+	}
+
+	c.logger.Debug("Published %d event(s)", len(batch))
+	return nil
+}
+
+// deliverOutput delivers the output file with the department's delivery plugin.
 //
 // PARAMETERS:
 //   - outputPath: The path to the generated XML file.
 //
 // RETURNS:
+//   - The delivery receipt, or nil if delivery is not configured.
+//   - An error if the delivery failed.
+func (c *Converter) deliverOutput(outputPath string) (*delivery.Receipt, error) {
+	deliverer, err := delivery.New(c.deptConfig.Delivery)
+	if err != nil || deliverer == nil {
+		return nil, err
+	}
+
+	receipt, err := deliverer.Deliver(context.Background(), outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deliver output: %w", err)
+	}
+	return &receipt, nil
+}
+
+// archiveFiles moves the processed files to the archive directories.
+//
+// PARAMETERS:
+//   - outputs: The generated XML files.
+//
+// RETURNS:
 //   - An error if the files cannot be moved.
 //
 // ARCHIVAL LOGIC:
 //   - The input CSV is moved to the input archive directory.
-//   - The output XML is copied to the output archive directory.
+//   - The output XMLs are copied to the output archive directory.
+//   - All file operations go through utils.FileManager, which handles
+//     archives on a different device or network share (copy + verify +
+//     delete) and retries transient network errors.
 //
 // CUSTOMIZATION:
 //   - Modify this function if you need different archival behavior.
 //   - Add support for date-based subdirectories.
-func (c *Converter) archiveFiles(outputPath string) error {
-	// Archive the input file.
-	inputFileName := filepath.Base(c.csvPath)
-	archivePath := filepath.Join(c.mainConfig.InputArchiveDir, inputFileName)
+func (c *Converter) archiveFiles(outputs []*documentOutput) error {
+	if err := c.archiveInputs(); err != nil {
+		return err
+	}
 
-	if err := os.Rename(c.csvPath, archivePath); err != nil {
+	fm := c.fileManager()
+
+	for _, out := range outputs {
+		if out.path == "" {
+			continue
+		}
+
+		// Archive the output file (copy, not move), masked if the department
+		// has sensitive fields and the file is not protected.
+		if c.masker != nil && !c.deptConfig.PGP.Enabled {
+			if err := c.archiveMaskedOutput(fm, out); err != nil {
+				return fmt.Errorf("failed to archive output file: %w", err)
+			}
+		} else if _, err := fm.ArchiveOutputFile(out.path); err != nil {
+			return fmt.Errorf("failed to archive output file: %w", err)
+		}
+
+		// Archive the detached signature with its output file.
+		if out.conv.signaturePath != "" {
+			if _, err := fm.ArchiveOutputFile(out.conv.signaturePath); err != nil {
+				return fmt.Errorf("failed to archive signature file: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// archiveInputs moves the input file, a merged fix-up file, and the done
+// marker to the input archive directory.
+func (c *Converter) archiveInputs() error {
+	fm := c.fileManager()
+
+	// Archive the input file.
+	if err := c.archiveInput(fm, c.csvPath, c.csvSettings()); err != nil {
 		return fmt.Errorf("failed to archive input file: %w", err)
 	}
 
-	// Archive the output file (copy, not move).
-	outputFileName := filepath.Base(outputPath)
-	outputArchivePath := filepath.Join(c.mainConfig.OutputArchiveDir, outputFileName)
+	// Archive a merged fix-up file together with its input file.
+	if c.fixupPath != "" {
+		if err := c.archiveInput(fm, c.fixupPath, fixupCSVSettings); err != nil {
+			return fmt.Errorf("failed to archive fix-up file: %w", err)
+		}
+	}
+
+	// Archive the done marker, so the file name can be reused.
+	if c.mainConfig.FileReadiness.DoneMarker {
+		markerPath := utils.DoneMarkerPath(c.csvPath, c.mainConfig.FileReadiness.DoneMarkerSuffix)
+		if utils.FileExists(markerPath) {
+			if _, err := fm.ArchiveInputFile(markerPath); err != nil {
+				return fmt.Errorf("failed to archive done marker: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// archiveInput moves an input file to the input archive directory. The
+// archived copy is masked if the department has sensitive fields (see
+// mask.go), and encrypted if archive encryption is configured (see
+// internal/archivecrypt).
+//
+// PARAMETERS:
+//   - fm: The file manager.
+//   - path: The input file.
+//   - settings: The CSV settings to read the file with for masking.
+//
+// RETURNS:
+//   - An error if the file cannot be masked, encrypted, or archived. The
+//     input file is only removed once its copy is archived.
+func (c *Converter) archiveInput(fm *utils.FileManager, path string, settings config.CSVSettings) error {
+	encryption := c.mainConfig.ArchiveEncryption
+	if c.masker == nil && !encryption.Enabled() {
+		_, err := fm.ArchiveInputFile(path)
+		return err
+	}
+	if !fm.ArchiveOnSuccess {
+		return nil
+	}
 
-	// Read the output file.
-	data, err := os.ReadFile(outputPath)
+	tempDir, err := os.MkdirTemp("", "archive-")
 	if err != nil {
-		return fmt.Errorf("failed to read output file for archival: %w", err)
+		return fmt.Errorf("failed to create temporary directory: %w", err)
 	}
+	defer os.RemoveAll(tempDir)
 
-	// Write to the archive.
-	if err := os.WriteFile(outputArchivePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write output archive: %w", err)
+	archived := path
+	if c.masker != nil {
+		masked := filepath.Join(tempDir, filepath.Base(path))
+		if err := csvparser.RewriteFile(path, masked, settings, c.masker.Value); err != nil {
+			return fmt.Errorf("failed to mask %s: %w", filepath.Base(path), err)
+		}
+		archived = masked
+	}
+	if encryption.Enabled() {
+		encrypted := filepath.Join(tempDir, filepath.Base(path)+archivecrypt.Suffix)
+		if err := archivecrypt.EncryptFile(context.Background(), encryption, archived, encrypted); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", filepath.Base(path), err)
+		}
+		archived = encrypted
 	}
 
-	return nil
+	if _, err := fm.ArchiveInputFile(archived); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// fileManager returns a FileManager for the configured directories.
+func (c *Converter) fileManager() *utils.FileManager {
+	fm := utils.NewFileManager(
+		c.mainConfig.InputDir,
+		c.mainConfig.OutputDir,
+		c.mainConfig.InputArchiveDir,
+		c.mainConfig.OutputArchiveDir,
+	)
+	fm.RetryAttempts = c.mainConfig.FileRetryAttempts
+	fm.RetryDelay = c.mainConfig.FileRetryDelay
+
+	return fm
 }
 
 // =============================================================================
@@ -685,8 +2416,23 @@ type Transaction struct {
 	// GroupKey is the value of the grouping field for this transaction.
 	GroupKey string
 
+	// BatchKey is the value of the batch grouping field, or empty without
+	// batch grouping.
+	BatchKey string
+
 	// LineItems contains the line items for this transaction.
 	LineItems []LineItem
+
+	// Fields and Row are the transaction-level values and the CSV row of a
+	// transaction that has no line items left (see lineitems.go).
+	// Otherwise the values come from its first line item, Fields is nil,
+	// and Row is 0.
+	Fields map[string]string
+	Row    int
+
+	// Schema is the template selected by the transaction's rows, or nil
+	// without a template selector. See selector.go.
+	Schema *xlsxparser.Schema
 }
 
 // LineItem represents a single line item within a transaction.
@@ -697,25 +2443,50 @@ type LineItem struct {
 	// Fields contains the field values for this line item.
 	// Keys are the original CSV column headers.
 	Fields map[string]string
+
+	// OriginalRowNumber is the row number in the original CSV file.
+	// Useful for error reporting.
+	OriginalRowNumber int
+
+	// Transformations are the transformations that changed a field's
+	// value, by field. Only recorded with provenance enabled.
+	Transformations map[string][]xmlwriter.Transformation
 }
 
 // =============================================================================
 // UTILITY FUNCTIONS
 // =============================================================================
 
+// rowNumberAt returns the original CSV row number of the row at index i,
+// or 0 if the parser did not record row numbers.
+func rowNumberAt(csvData *csvparser.CSVData, i int) int {
+	if i < len(csvData.RowNumbers) {
+		return csvData.RowNumbers[i]
+	}
+	return 0
+}
+
+// copyFields returns a copy of a row's field map.
+func copyFields(fields map[string]string) map[string]string {
+	copied := make(map[string]string, len(fields))
+	for key, value := range fields {
+		copied[key] = value
+	}
+	return copied
+}
+
 // containsIgnoreCase checks if a string contains a substring (case-insensitive).
 func containsIgnoreCase(s, substr string) bool {
-	// IMPLEMENTATION: Use strings.Contains with lowercase conversion.
-	// This is a placeholder - implement with proper string handling.
-	return true // Placeholder
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
 }
 
 // padLeft pads a string with a character on the left to reach the target length.
 func padLeft(s string, length int, padChar rune) string {
-	if len(s) >= length {
+	count := utf8.RuneCountInString(s)
+	if count >= length {
 		return s
 	}
-	padding := make([]rune, length-len(s))
+	padding := make([]rune, length-count)
 	for i := range padding {
 		padding[i] = padChar
 	}
@@ -764,14 +2535,17 @@ func convertToValidationTransactions(transactions []Transaction) []validation.Tr
 		lineItems := make([]validation.LineItem, len(t.LineItems))
 		for j, li := range t.LineItems {
 			lineItems[j] = validation.LineItem{
-				ID:     li.ID,
-				Fields: li.Fields,
+				ID:        li.ID,
+				Fields:    li.Fields,
+				RowNumber: li.OriginalRowNumber,
 			}
 		}
 		result[i] = validation.Transaction{
 			ID:        t.ID,
 			GroupKey:  t.GroupKey,
 			LineItems: lineItems,
+			Fields:    t.Fields,
+			Row:       t.Row,
 		}
 	}
 	return result
@@ -784,14 +2558,19 @@ func convertToXMLWriterTransactions(transactions []Transaction) []xmlwriter.Tran
 		lineItems := make([]xmlwriter.LineItem, len(t.LineItems))
 		for j, li := range t.LineItems {
 			lineItems[j] = xmlwriter.LineItem{
-				ID:     li.ID,
-				Fields: li.Fields,
+				ID:              li.ID,
+				Fields:          li.Fields,
+				Row:             li.OriginalRowNumber,
+				Transformations: li.Transformations,
 			}
 		}
 		result[i] = xmlwriter.Transaction{
 			ID:        t.ID,
 			GroupKey:  t.GroupKey,
+			BatchKey:  t.BatchKey,
 			LineItems: lineItems,
+			Fields:    t.Fields,
+			Schema:    t.Schema,
 		}
 	}
 	return result
@@ -0,0 +1,92 @@
+// =============================================================================
+// CSV to XML Converter - Data Lake Export
+// =============================================================================
+//
+// After a file's output is delivered, its rows are exported to the data lake
+// (see internal/datalake), if the main configuration enables it for the
+// department. The rows are those of the delivered documents: transformed,
+// validated, and without rejected transactions. Sensitive fields are masked,
+// as everywhere but the output itself (see mask.go).
+//
+// The output is already delivered, so a failed export is logged but does
+// not fail the file.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/datalake"
+)
+
+// exportDataLake exports the rows of the main output documents, one data
+// lake file per document.
+//
+// PARAMETERS:
+//   - outputs: The delivered documents.
+//   - headers: The headers of the input file, the order of the columns.
+func (c *Converter) exportDataLake(outputs []*documentOutput, headers []string) {
+	settings := c.mainConfig.DataLake
+	if !settings.Exports(c.deptConfig.DepartmentCode) {
+		return
+	}
+
+	convertedAt := time.Now()
+	for _, out := range outputs {
+		if out.main != nil {
+			continue
+		}
+
+		export := datalake.Export{
+			Department:  c.deptConfig.DepartmentCode,
+			SourceFile:  filepath.Base(c.csvPath),
+			OutputFile:  out.name,
+			ConvertedAt: convertedAt,
+		}
+		for _, transaction := range c.maskTransactions(out.transactions) {
+			if transaction.Fields != nil {
+				export.Rows = append(export.Rows, datalake.Row{Transaction: transaction.ID,
+					SourceRow: transaction.Row, Fields: transaction.Fields})
+				continue
+			}
+			for _, lineItem := range transaction.LineItems {
+				export.Rows = append(export.Rows, datalake.Row{Transaction: transaction.ID,
+					LineItem: lineItem.ID, SourceRow: lineItem.OriginalRowNumber, Fields: lineItem.Fields})
+			}
+		}
+		export.Columns = exportColumns(headers, export.Rows)
+
+		path, err := datalake.Write(settings, export)
+		if err != nil {
+			c.logger.Warn("Failed to export rows to the data lake: %v", err)
+			continue
+		}
+		c.logger.Info("Exported %d row(s) to the data lake: %s", len(export.Rows), path)
+	}
+}
+
+// exportColumns returns the columns of the exported rows: the input file's
+// headers, then any other fields of the rows, sorted.
+func exportColumns(headers []string, rows []datalake.Row) []string {
+	columns := append([]string{}, headers...)
+	known := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		known[header] = true
+	}
+
+	var extra []string
+	for _, row := range rows {
+		for field := range row.Fields {
+			if !known[field] {
+				known[field] = true
+				extra = append(extra, field)
+			}
+		}
+	}
+	sort.Strings(extra)
+	return append(columns, extra...)
+}
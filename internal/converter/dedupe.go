@@ -0,0 +1,118 @@
+// =============================================================================
+// CSV to XML Converter - Row De-duplication
+// =============================================================================
+//
+// Legacy exports occasionally repeat rows, either exactly or with the same
+// business key (e.g., check number and invoice number). With de-duplication
+// enabled, duplicates are removed before the rows are grouped into
+// transactions, so they never produce duplicate line items.
+//
+// Every duplicate is listed in the validation report with code VAL-DUP-001,
+// together with the row it duplicates. With the "error" policy, duplicates
+// are validation errors and fail the file instead.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/csvparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+)
+
+// removeDuplicates applies the department's de-duplication to the rows.
+//
+// PARAMETERS:
+//   - csvData: The parsed CSV data. Dropped rows are removed from Rows and
+//     RowNumbers.
+//
+// RETURNS:
+//   - One validation error per duplicate row: a warning for a dropped row,
+//     or an error (and nothing dropped) with the "error" policy.
+func (c *Converter) removeDuplicates(csvData *csvparser.CSVData) []*validation.ValidationError {
+	settings := c.deptConfig.Deduplication
+	if !settings.Enabled {
+		return nil
+	}
+
+	keys := settings.Keys
+	if len(keys) == 0 {
+		keys = csvData.Headers
+	}
+	field := strings.Join(settings.Keys, "+")
+	if field == "" {
+		field = "(all columns)"
+	}
+
+	// Find the row to keep for every key.
+	rowKeys := make([]string, len(csvData.Rows))
+	shownKeys := make([]string, len(csvData.Rows)) // with sensitive values masked
+	kept := make(map[string]int)
+	for i, row := range csvData.Rows {
+		values := make([]string, len(keys))
+		for j, key := range keys {
+			values[j] = row[key]
+		}
+		rowKeys[i] = strings.Join(values, "|")
+		for j, key := range keys {
+			values[j] = c.masker.Value(key, values[j])
+		}
+		shownKeys[i] = strings.Join(values, "|")
+
+		if _, exists := kept[rowKeys[i]]; !exists || settings.Policy == "keep_last" {
+			kept[rowKeys[i]] = i
+		}
+	}
+
+	var duplicates []*validation.ValidationError
+	rows := make([]map[string]string, 0, len(kept))
+	rowNumbers := make([]int, 0, len(kept))
+
+	for i, row := range csvData.Rows {
+		keptIndex := kept[rowKeys[i]]
+		if keptIndex == i {
+			rows = append(rows, row)
+			rowNumbers = append(rowNumbers, rowNumberAt(csvData, i))
+			continue
+		}
+
+		duplicate := &validation.ValidationError{
+			Severity:  "warning",
+			Field:     field,
+			Value:     shownKeys[i],
+			Rule:      "duplicate",
+			Code:      validation.CodeDuplicate,
+			Message:   fmt.Sprintf("Duplicate of row %d; row dropped", rowNumberAt(csvData, keptIndex)),
+			RowNumber: rowNumberAt(csvData, i),
+		}
+
+		// With the error policy, every row stays and the file fails.
+		if settings.Policy == "error" {
+			duplicate.Severity = "error"
+			duplicate.Message = fmt.Sprintf("Duplicate of row %d", rowNumberAt(csvData, keptIndex))
+			rows = append(rows, row)
+			rowNumbers = append(rowNumbers, rowNumberAt(csvData, i))
+		}
+
+		duplicates = append(duplicates, duplicate)
+	}
+
+	csvData.Rows = rows
+	csvData.RowNumbers = rowNumbers
+	return duplicates
+}
+
+// reportDuplicates adds the duplicates to the validation result.
+func reportDuplicates(result *validation.ValidationResult, duplicates []*validation.ValidationError) {
+	for _, duplicate := range duplicates {
+		if duplicate.Severity != "error" {
+			result.Duplicates = append(result.Duplicates, duplicate)
+			continue
+		}
+
+		result.Record(duplicate)
+	}
+}
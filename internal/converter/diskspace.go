@@ -0,0 +1,95 @@
+// =============================================================================
+// CSV to XML Converter - Disk Space Check
+// =============================================================================
+//
+// At month-end, the output and archive shares can fill up. With
+// disk_space.min_free_mb set, the converter pauses instead of failing
+// halfway through writing a file:
+//
+//   - A process run checks the output, hold, and archive directories before
+//     it starts, and exits with an error if one is low on space.
+//   - The watch command checks them before every scan. A scan on a full
+//     volume is skipped, logged as an error, and /readyz reports it, until
+//     space is freed.
+//   - Every file is checked again before it is started, so a run that fills
+//     the volume leaves its remaining files in the input directory.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/storage"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+)
+
+// ErrLowDiskSpace is the error of a directory with less free space than
+// disk_space.min_free_mb.
+var ErrLowDiskSpace = errors.New("low disk space")
+
+// DiskSpaceDirs returns the local directories that output and archive files
+// are written to.
+func DiskSpaceDirs(mainConfig *config.MainConfig, deptConfigs map[string]*config.DepartmentConfig) []string {
+	dirs := []string{mainConfig.OutputDir, mainConfig.InputArchiveDir, mainConfig.OutputArchiveDir}
+	if mainConfig.DeliverySchedule.Enabled() {
+		dirs = append(dirs, mainConfig.DeliverySchedule.HoldDir)
+	}
+	if mainConfig.DataLake.Enabled() {
+		dirs = append(dirs, mainConfig.DataLake.Dir)
+	}
+	for _, code := range DepartmentCodes(deptConfigs) {
+		deptConfig := deptConfigs[code]
+		dirs = append(dirs, deptConfig.OutputDir, deptConfig.InputArchiveDir, deptConfig.OutputArchiveDir)
+		for _, target := range deptConfig.Outputs {
+			dirs = append(dirs, target.OutputDir)
+		}
+	}
+
+	seen := make(map[string]bool)
+	local := dirs[:0]
+	for _, dir := range dirs {
+		if dir == "" || storage.IsRemote(dir) || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		local = append(local, dir)
+	}
+	return local
+}
+
+// CheckDiskSpace checks the free space of the directories.
+//
+// PARAMETERS:
+//   - dirs: The directories (see DiskSpaceDirs). A missing directory is
+//     checked on its nearest existing parent.
+//   - settings: The disk space settings.
+//
+// RETURNS:
+//   - An error wrapping ErrLowDiskSpace for the first directory with less
+//     free space than required, or another error if the free space cannot
+//     be determined. nil if the check is disabled.
+func CheckDiskSpace(dirs []string, settings config.DiskSpaceSettings) error {
+	if !settings.Enabled() {
+		return nil
+	}
+
+	for _, dir := range dirs {
+		existing, err := utils.ExistingDir(dir)
+		if err != nil {
+			return err
+		}
+		free, err := utils.FreeSpace(existing)
+		if err != nil {
+			return fmt.Errorf("failed to get free disk space of %s: %w", dir, err)
+		}
+		if free < settings.MinFreeMB<<20 {
+			return fmt.Errorf("%w: %s has %s free, disk_space.min_free_mb requires %d MB",
+				ErrLowDiskSpace, dir, utils.FormatSize(free), settings.MinFreeMB)
+		}
+	}
+	return nil
+}
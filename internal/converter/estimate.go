@@ -0,0 +1,159 @@
+// =============================================================================
+// CSV to XML Converter - Completion Estimates
+// =============================================================================
+//
+// How long a run will take follows from the size of its files and the
+// throughput of their departments in earlier runs (see
+// audit.ReadThroughput): a 40 MB claims file takes about as long as the
+// recent claims files took per byte.
+//
+// Estimate plays the run through the same scheduler the run uses, with
+// each file taking its estimated time: files start as slots become free,
+// in the order of their priorities, departments, and file_order. The
+// result is each file's estimated start and finish, and the finish of the
+// last file is the estimated completion of the run. Files of a department
+// without history are estimated from the throughput of all departments;
+// without any history, they take no time and are reported as unknown.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/audit"
+)
+
+// FileEstimate is the estimated conversion of a file of a run.
+type FileEstimate struct {
+	File       string
+	Department string
+	Priority   int
+
+	// Size is the file size in bytes.
+	Size int64
+
+	// Rows and RowsPerSecond are estimated from the department's history.
+	Rows          int64
+	RowsPerSecond float64
+
+	// Duration is the estimated processing time; Start and Finish are when
+	// the file is estimated to start and finish.
+	Duration time.Duration
+	Start    time.Time
+	Finish   time.Time
+
+	// Known is false if there is no history to estimate the file from.
+	Known bool
+}
+
+// Estimate estimates when each file of a run starts and finishes.
+//
+// PARAMETERS:
+//   - files: The files of the run.
+//   - throughput: The throughput by department (see audit.ReadThroughput).
+//   - now: The time the run starts.
+//
+// RETURNS:
+//   - The estimate of each file, in the order the files start.
+func (p *Processor) Estimate(files []string, throughput map[string]audit.Throughput, now time.Time) []FileEstimate {
+	scheduler, entries := p.queueFiles(files, now)
+
+	pending := make(map[string]*FileEstimate, len(entries))
+	for _, entry := range entries {
+		history, ok := throughput[entry.department]
+		if !ok {
+			history = throughput[""]
+		}
+		estimate := &FileEstimate{
+			File:       entry.file,
+			Department: entry.department,
+			Priority:   entry.priority,
+			Size:       entry.size,
+		}
+		estimate.Rows, estimate.Duration, estimate.Known = history.Estimate(entry.size)
+		if estimate.Known {
+			estimate.RowsPerSecond = history.RowsPerSecond()
+		}
+		pending[entry.file] = estimate
+	}
+
+	// Start every file that can start, then move the clock to the next
+	// file that finishes and free its slot.
+	var estimates []FileEstimate
+	var running []FileEstimate
+	clock := now
+	for {
+		for {
+			file, ok := scheduler.next()
+			if !ok {
+				break
+			}
+			estimate := pending[file.path]
+			estimate.Start = clock
+			estimate.Finish = clock.Add(estimate.Duration)
+			running = append(running, *estimate)
+			estimates = append(estimates, *estimate)
+		}
+		if len(running) == 0 {
+			break
+		}
+
+		first := 0
+		for i := range running {
+			if running[i].Finish.Before(running[first].Finish) {
+				first = i
+			}
+		}
+		clock = running[first].Finish
+		scheduler.done(running[first].Department)
+		running = append(running[:first], running[first+1:]...)
+	}
+	return estimates
+}
+
+// logEstimate logs the estimated completion of a run, if the audit trail
+// has a history to estimate it from, e.g.
+//
+//	Estimated completion: 12 file(s) in ~4m10s, by 06:44:10 (2 file(s) without history)
+//
+// and the estimate of each file at debug level.
+func (p *Processor) logEstimate(files []string, now time.Time) {
+	if p.logger == nil || p.trail == nil || len(files) == 0 {
+		return
+	}
+	throughput, err := p.trail.Throughput()
+	if err != nil {
+		p.logger.Warn("No completion estimate: %v", err)
+		return
+	}
+	if len(throughput) == 0 {
+		return
+	}
+
+	estimates := p.Estimate(files, throughput, now)
+	finish := now
+	unknown := 0
+	for _, estimate := range estimates {
+		if estimate.Finish.After(finish) {
+			finish = estimate.Finish
+		}
+		if !estimate.Known {
+			unknown++
+			continue
+		}
+		p.logger.Debug("Estimated %s: %d rows at %.0f rows/s, %s to %s",
+			filepath.Base(estimate.File), estimate.Rows, estimate.RowsPerSecond,
+			estimate.Start.Format("15:04:05"), estimate.Finish.Format("15:04:05"))
+	}
+
+	message := "Estimated completion: %d file(s) in ~%s, by %s"
+	args := []interface{}{len(estimates), finish.Sub(now).Round(time.Second), finish.Format("15:04:05")}
+	if unknown > 0 {
+		message += " (%d file(s) without history)"
+		args = append(args, unknown)
+	}
+	p.logger.Info(message, args...)
+}
@@ -0,0 +1,82 @@
+// =============================================================================
+// CSV to XML Converter - Failure Injection
+// =============================================================================
+//
+// Integration tests check that failed files are handled as designed: the
+// failure policy is applied, a failed file is retried when it changes (see
+// the watch command), and no partial output file is left behind, or, with
+// output checkpoints, the partial file is kept for the next run to resume.
+// Those failures are hard to cause on purpose, so the converter can inject
+// them (the hidden --fail-after-n-rows and --inject-write-error flags of the
+// process and watch commands):
+//
+//   - FailAfterRows: the parse stage fails after the given number of rows,
+//     as if the rest of the file could not be read.
+//   - WriteError: every output file write fails half way, as on a volume
+//     that fills up during the write.
+//
+// Injected errors wrap ErrInjected. Faults are for testing only and are
+// never configured in production.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrInjected is wrapped by the errors of injected failures.
+var ErrInjected = errors.New("injected failure")
+
+// Faults are the failures injected into a conversion. The zero value
+// injects none.
+type Faults struct {
+	// FailAfterRows fails the parse stage after this many rows, or never
+	// if 0.
+	FailAfterRows int
+
+	// WriteError fails each output file write after half of its bytes.
+	WriteError bool
+}
+
+// SetFaults injects failures into the conversion, for resilience testing.
+func (c *Converter) SetFaults(faults Faults) {
+	c.faults = faults
+}
+
+// checkRows returns an injected parse error once more than FailAfterRows
+// rows have been read.
+//
+// PARAMETERS:
+//   - rows: The number of rows read so far.
+func (f Faults) checkRows(rows int) error {
+	if f.FailAfterRows > 0 && rows > f.FailAfterRows {
+		return fmt.Errorf("%w: read error after %d rows", ErrInjected, f.FailAfterRows)
+	}
+	return nil
+}
+
+// outputWriter returns the writer for an output file: w itself, or a
+// writer that fails half way with WriteError.
+func (f Faults) outputWriter(w io.Writer) io.Writer {
+	if !f.WriteError {
+		return w
+	}
+	return faultWriter{w}
+}
+
+// faultWriter writes half of the first write and fails.
+type faultWriter struct {
+	w io.Writer
+}
+
+func (f faultWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p[:len(p)/2])
+	if err != nil {
+		return n, err
+	}
+	return n, fmt.Errorf("%w: write error after %d bytes", ErrInjected, n)
+}
@@ -0,0 +1,343 @@
+// =============================================================================
+// CSV to XML Converter - Fix-up Export
+// =============================================================================
+//
+// This file implements the fix-up workflow for files that fail validation.
+//
+// WORKFLOW:
+//   1. A file fails validation.
+//   2. The failing rows are exported to "<name>.fixup.csv" with their original
+//      (pre-transformation) values, their original row number (FIXUP_ROW),
+//      and one "FIXUP_ERROR_<field>" column next to each offending field.
+//   3. A user corrects the rows in Excel and drops the file into the input
+//      directory.
+//   4. With auto_merge enabled, and the original file still in the input
+//      directory, the corrected rows replace the original rows with the same
+//      row number and both files are converted and archived together.
+//      Otherwise the fix-up file is converted on its own.
+//
+// FILE FORMAT:
+//   Fix-up files are always comma-delimited with a single header row, so that
+//   they open cleanly in Excel regardless of the department's CSV settings.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/csvparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+)
+
+// =============================================================================
+// CONSTANTS
+// =============================================================================
+
+const (
+	// FixupFileSuffix is appended to the original file name (without its
+	// extension) to name the fix-up file.
+	FixupFileSuffix = ".fixup.csv"
+
+	// FixupRowColumn holds the original row number of each exported row.
+	FixupRowColumn = "FIXUP_ROW"
+
+	// FixupErrorColumnPrefix prefixes the column describing the errors of a field.
+	FixupErrorColumnPrefix = "FIXUP_ERROR_"
+
+	// fixupColumnPrefix identifies all columns added by the fix-up export.
+	fixupColumnPrefix = "FIXUP_"
+)
+
+// fixupCSVSettings are the settings used to read and write fix-up files.
+var fixupCSVSettings = config.CSVSettings{
+	Delimiter:    ",",
+	HeaderRows:   1,
+	DataStartRow: 2,
+	Encoding:     "UTF-8",
+	QuoteChar:    "\"",
+	EscapeChar:   "\"",
+}
+
+// =============================================================================
+// PUBLIC FUNCTIONS
+// =============================================================================
+
+// IsFixupFile reports whether the given path names a fix-up file.
+func IsFixupFile(filePath string) bool {
+	return strings.HasSuffix(strings.ToLower(filepath.Base(filePath)), FixupFileSuffix)
+}
+
+// FixupPathFor returns the fix-up file path for an input file in the same directory.
+//
+// EXAMPLE:
+//   input/claims_payments_1.csv -> input/claims_payments_1.fixup.csv
+//
+// A fix-up file is its own fix-up path, so re-exports keep the same name.
+func FixupPathFor(csvPath string) string {
+	if IsFixupFile(csvPath) {
+		return csvPath
+	}
+
+	base := strings.TrimSuffix(filepath.Base(csvPath), filepath.Ext(csvPath))
+	return filepath.Join(filepath.Dir(csvPath), base+FixupFileSuffix)
+}
+
+// IsPendingFixup reports whether a fix-up file will be merged into its
+// original file, and therefore must not be processed on its own.
+//
+// PARAMETERS:
+//   - filePath: The path to the input file.
+//   - deptConfig: The department configuration matching the file.
+//
+// RETURNS:
+//   - true if auto_merge is enabled and the original file is present.
+func IsPendingFixup(filePath string, deptConfig *config.DepartmentConfig) bool {
+	if !deptConfig.FixupExport.AutoMerge || !IsFixupFile(filePath) {
+		return false
+	}
+
+	_, err := os.Stat(originalPathFor(filePath))
+	return err == nil
+}
+
+// =============================================================================
+// EXPORT
+// =============================================================================
+
+// exportFixup writes the rows that failed validation to a fix-up CSV.
+//
+// PARAMETERS:
+//   - csvData: The parsed CSV data with the original (pre-transformation) values.
+//   - errors: The validation errors. Errors without a row number are ignored.
+//
+// RETURNS:
+//   - The path to the fix-up file, or "" if no row could be exported.
+//   - An error if the file cannot be written.
+func (c *Converter) exportFixup(csvData *csvparser.CSVData, errors []*validation.ValidationError) (string, error) {
+	fixupPath := filepath.Join(c.deptConfig.FixupExport.OutputDir, filepath.Base(FixupPathFor(c.csvPath)))
+	return writeFixupRows(fixupPath, csvData, errors, nil)
+}
+
+// writeFixupRows writes rows to a CSV in the fix-up format.
+//
+// PARAMETERS:
+//   - fixupPath: The path of the file to write.
+//   - csvData: The parsed CSV data with the original (pre-transformation) values.
+//   - errors: The validation errors. Errors without a row number are ignored.
+//   - rows: The row numbers to write, or nil to write the rows with errors.
+//
+// RETURNS:
+//   - fixupPath, or "" if no row could be exported.
+//   - An error if the file cannot be written.
+func writeFixupRows(fixupPath string, csvData *csvparser.CSVData, errors []*validation.ValidationError, rows map[int]bool) (string, error) {
+	// Collect the messages for each failing row and field.
+	rowErrors := make(map[int]map[string][]string)
+	failingFields := make(map[string]bool)
+	for _, ve := range errors {
+		if ve.RowNumber == 0 {
+			continue
+		}
+		if rowErrors[ve.RowNumber] == nil {
+			rowErrors[ve.RowNumber] = make(map[string][]string)
+		}
+		message := fmt.Sprintf("[%s] %s", ve.Code, ve.Message)
+		rowErrors[ve.RowNumber][ve.Field] = append(rowErrors[ve.RowNumber][ve.Field], message)
+		failingFields[ve.Field] = true
+	}
+
+	if rows == nil {
+		rows = make(map[int]bool, len(rowErrors))
+		for rowNumber := range rowErrors {
+			rows[rowNumber] = true
+		}
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+
+	// Build the header: the row number, then each original column followed
+	// by an error column when that column has errors.
+	header := []string{FixupRowColumn}
+	for _, h := range stripFixupHeaders(csvData.Headers) {
+		header = append(header, h)
+		if failingFields[h] {
+			header = append(header, FixupErrorColumnPrefix+h)
+		}
+	}
+
+	// Create the output file.
+	if err := os.MkdirAll(filepath.Dir(fixupPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create fix-up directory: %w", err)
+	}
+
+	file, err := os.Create(fixupPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create fix-up file: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(header); err != nil {
+		return "", fmt.Errorf("failed to write fix-up header: %w", err)
+	}
+
+	// Write the rows in file order.
+	for i, row := range csvData.Rows {
+		rowNumber := rowNumberAt(csvData, i)
+		if !rows[rowNumber] {
+			continue
+		}
+		fieldErrors := rowErrors[rowNumber]
+
+		record := make([]string, 0, len(header))
+		for _, h := range header {
+			switch {
+			case h == FixupRowColumn:
+				record = append(record, strconv.Itoa(rowNumber))
+			case strings.HasPrefix(h, FixupErrorColumnPrefix):
+				record = append(record, strings.Join(fieldErrors[strings.TrimPrefix(h, FixupErrorColumnPrefix)], "; "))
+			default:
+				record = append(record, row[h])
+			}
+		}
+
+		if err := writer.Write(record); err != nil {
+			return "", fmt.Errorf("failed to write fix-up row %d: %w", rowNumber, err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", fmt.Errorf("failed to write fix-up file: %w", err)
+	}
+
+	return fixupPath, nil
+}
+
+// =============================================================================
+// IMPORT AND MERGE
+// =============================================================================
+
+// prepareFixupInput applies the fix-up workflow to freshly parsed CSV data.
+//
+// PARAMETERS:
+//   - csvData: The parsed CSV data. It is modified in place.
+//
+// RETURNS:
+//   - An error if the fix-up file is invalid.
+//
+// BEHAVIOR:
+//   - If the input is itself a fix-up file, the FIXUP_ columns are removed and
+//     the original row numbers are restored for error reporting.
+//   - If auto_merge is enabled and a fix-up file exists next to the input,
+//     its rows replace the input rows with the same row number.
+func (c *Converter) prepareFixupInput(csvData *csvparser.CSVData) error {
+	if IsFixupFile(c.csvPath) {
+		restoreFixupRows(csvData)
+		return nil
+	}
+
+	if !c.deptConfig.FixupExport.AutoMerge {
+		return nil
+	}
+
+	fixupPath := FixupPathFor(c.csvPath)
+	if _, err := os.Stat(fixupPath); err != nil {
+		return nil
+	}
+
+	fixupData, err := csvparser.Parse(fixupPath, fixupCSVSettings)
+	if err != nil {
+		return fmt.Errorf("failed to parse fix-up file: %w", err)
+	}
+
+	// Index the original rows by row number.
+	indexByRow := make(map[int]int, len(csvData.Rows))
+	for i := range csvData.Rows {
+		indexByRow[rowNumberAt(csvData, i)] = i
+	}
+
+	for i, fixupRow := range fixupData.Rows {
+		rowNumber, err := strconv.Atoi(strings.TrimSpace(fixupRow[FixupRowColumn]))
+		if err != nil {
+			return fmt.Errorf("fix-up row %d: invalid %s value '%s'", rowNumberAt(fixupData, i), FixupRowColumn, fixupRow[FixupRowColumn])
+		}
+
+		index, ok := indexByRow[rowNumber]
+		if !ok {
+			return fmt.Errorf("fix-up row %d: row %d does not exist in %s", rowNumberAt(fixupData, i), rowNumber, filepath.Base(c.csvPath))
+		}
+
+		// Only columns of the original file are merged.
+		for _, h := range csvData.Headers {
+			if value, ok := fixupRow[h]; ok {
+				csvData.Rows[index][h] = value
+			}
+		}
+	}
+
+	c.fixupPath = fixupPath
+	c.logger.Info("Merged %d row(s) from fix-up file: %s", len(fixupData.Rows), fixupPath)
+
+	return nil
+}
+
+// restoreFixupRows removes the FIXUP_ columns from a fix-up file's data and
+// restores the original row numbers.
+func restoreFixupRows(csvData *csvparser.CSVData) {
+	rowNumbers := make([]int, len(csvData.Rows))
+	for i, row := range csvData.Rows {
+		rowNumbers[i] = rowNumberAt(csvData, i)
+		if rowNumber, err := strconv.Atoi(strings.TrimSpace(row[FixupRowColumn])); err == nil {
+			rowNumbers[i] = rowNumber
+		}
+
+		for key := range row {
+			if strings.HasPrefix(key, fixupColumnPrefix) {
+				delete(row, key)
+			}
+		}
+	}
+
+	csvData.RowNumbers = rowNumbers
+	csvData.Headers = stripFixupHeaders(csvData.Headers)
+	csvData.ColumnCount = len(csvData.Headers)
+}
+
+// =============================================================================
+// HELPER FUNCTIONS
+// =============================================================================
+
+// csvSettings returns the CSV settings to parse the input file with.
+// Fix-up files always use the fix-up format.
+func (c *Converter) csvSettings() config.CSVSettings {
+	if IsFixupFile(c.csvPath) {
+		return fixupCSVSettings
+	}
+	return c.deptConfig.CSVSettings
+}
+
+// stripFixupHeaders returns the headers without the columns added by the export.
+func stripFixupHeaders(headers []string) []string {
+	stripped := make([]string, 0, len(headers))
+	for _, h := range headers {
+		if !strings.HasPrefix(h, fixupColumnPrefix) {
+			stripped = append(stripped, h)
+		}
+	}
+	return stripped
+}
+
+// originalPathFor returns the path of the input file a fix-up file belongs to.
+func originalPathFor(fixupPath string) string {
+	base := filepath.Base(fixupPath)
+	return filepath.Join(filepath.Dir(fixupPath), base[:len(base)-len(FixupFileSuffix)]+".csv")
+}
@@ -0,0 +1,125 @@
+// =============================================================================
+// CSV to XML Converter - Transaction Keys Uploaded Before
+// =============================================================================
+//
+// A check exported again days later is valid on its own, but the target
+// system would post it twice. A department can flag transactions whose key
+// was already uploaded in the past days:
+//
+//   transaction_grouping:
+//     group_by_field: CHECK_NUM
+//     duplicate_history_days: 30
+//
+// The keys of each output file are recorded in the audit trail's key index
+// (see the audit package) once the file is converted. A transaction whose
+// key the index has from the last duplicate_history_days days is a
+// validation error (VAL-DUP-003) that names the earlier file, so the file
+// fails or, with rejected_transactions, the transaction is rejected.
+//
+// A file converted again under the overwrite or version reprocess policy
+// replaces its earlier output, whose keys are not counted. Keys are only
+// recorded while the setting is enabled, by runs that have an audit trail
+// (the process and watch commands).
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/audit"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+)
+
+// SetAuditTrail sets the audit trail whose key index is checked for
+// transaction keys uploaded before (see history.go).
+func (c *Converter) SetAuditTrail(trail *audit.Trail) {
+	c.trail = trail
+}
+
+// checkKeyHistory records a validation error for each transaction whose
+// key was uploaded in the department's duplicate_history_days.
+//
+// PARAMETERS:
+//   - transactions: The transactions to check.
+//   - result: The validation result to record the errors in.
+func (c *Converter) checkKeyHistory(transactions []Transaction, result *validation.ValidationResult) {
+	grouping := c.deptConfig.TransactionGrouping
+	if c.trail == nil || grouping.DuplicateHistoryDays <= 0 {
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -grouping.DuplicateHistoryDays)
+	uploaded, err := c.trail.KeysSince(c.deptConfig.DepartmentCode, since)
+	if err != nil {
+		// Without the history, the transactions cannot be cleared.
+		result.Record(&validation.ValidationError{
+			Severity: "error",
+			Field:    grouping.GroupByField,
+			Rule:     "duplicate_history_days",
+			Code:     validation.CodeHistoryDuplicate,
+			Message:  fmt.Sprintf("Transaction keys uploaded before cannot be checked: %v", err),
+		})
+		return
+	}
+
+	for _, transaction := range transactions {
+		record, ok := uploaded[transaction.GroupKey]
+		if !ok || c.replacedOutput(record.OutputFile) {
+			continue
+		}
+		ve := &validation.ValidationError{
+			Severity: "error",
+			Field:    grouping.GroupByField,
+			Value:    transaction.GroupKey,
+			Rule:     "duplicate_history_days",
+			Code:     validation.CodeHistoryDuplicate,
+			Message: fmt.Sprintf("Transaction key was already uploaded in %s (%s) on %s",
+				record.File, record.OutputFile, record.Time.Format("2006-01-02 15:04")),
+			TransactionID: transaction.ID,
+			RowNumber:     transactionRow(transaction),
+		}
+		if !result.Record(ve) {
+			return
+		}
+	}
+}
+
+// replacedOutput reports whether an output file is one this conversion
+// replaces: an earlier output of the same input file, converted again
+// under the overwrite or version reprocess policy (see reprocess.go).
+func (c *Converter) replacedOutput(outputFile string) bool {
+	if c.previous == nil {
+		return false
+	}
+	switch c.reprocessPolicy() {
+	case ReprocessOverwrite:
+		return outputFile == c.previous.Output
+	case ReprocessVersion:
+		base := strings.TrimSuffix(c.previous.Output, filepath.Ext(c.previous.Output))
+		return outputFile == c.previous.Output || strings.HasPrefix(outputFile, base+"_v")
+	}
+	return false
+}
+
+// transactionKeys returns the keys of the transactions, once each, in
+// order, for the key index, if the department checks keys uploaded before.
+func (c *Converter) transactionKeys(transactions []Transaction) []string {
+	if c.deptConfig.TransactionGrouping.DuplicateHistoryDays <= 0 {
+		return nil
+	}
+
+	var keys []string
+	seen := make(map[string]bool)
+	for _, transaction := range transactions {
+		if !seen[transaction.GroupKey] {
+			seen[transaction.GroupKey] = true
+			keys = append(keys, transaction.GroupKey)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,100 @@
+// =============================================================================
+// CSV to XML Converter - Blank Line Items and Empty Transactions
+// =============================================================================
+//
+// Some exports write a row for a transaction that has no line item detail,
+// e.g., a check that pays no invoice: the transaction-level columns are
+// filled, the line-item columns are empty. By default such a row becomes an
+// empty line item element. A department can remove these rows instead, and
+// decide what happens to a transaction that has none left:
+//
+//   transaction_grouping:
+//     blank_line_items: remove    # keep (Default) | remove
+//     empty_transactions: drop    # emit (Default) | drop | fail
+//     min_line_items: 1           # validated as VAL-CNT-001
+//
+// A line item is blank when every line-item field of its template is empty
+// after transformation. An emitted empty transaction keeps the values of
+// its first row for its transaction-level fields, which are validated as
+// usual. Transactions and line items are renumbered after a removal, so the
+// numbering in the XML has no gaps.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// removeBlankLineItems removes the blank line items of the transactions,
+// if the department removes them, and applies the department's
+// empty_transactions policy to the transactions left without line items.
+//
+// PARAMETERS:
+//   - transactions: The transformed transactions.
+//
+// RETURNS:
+//   - The transactions, renumbered if anything was removed.
+//   - An error if a transaction is left empty and the policy is "fail".
+func (c *Converter) removeBlankLineItems(transactions []Transaction) ([]Transaction, error) {
+	grouping := c.deptConfig.TransactionGrouping
+	if grouping.BlankLineItems != "remove" {
+		return transactions, nil
+	}
+
+	kept := make([]Transaction, 0, len(transactions))
+	removed, dropped := 0, 0
+	for _, transaction := range transactions {
+		lineItemFields := c.transactionSchema(transaction).LineItemFields
+
+		var lineItems []LineItem
+		for _, lineItem := range transaction.LineItems {
+			if isBlank(lineItem, lineItemFields) {
+				removed++
+				continue
+			}
+			lineItems = append(lineItems, lineItem)
+		}
+		if len(lineItems) == len(transaction.LineItems) {
+			kept = append(kept, transaction)
+			continue
+		}
+
+		if len(lineItems) == 0 {
+			switch grouping.EmptyTransactions {
+			case "fail":
+				return nil, fmt.Errorf("transaction %q (row %d) has no line items once blank line items are removed (empty_transactions: fail)",
+					transaction.GroupKey, transaction.LineItems[0].OriginalRowNumber)
+			case "drop":
+				dropped++
+				continue
+			}
+			transaction.Fields = transaction.LineItems[0].Fields
+			transaction.Row = transaction.LineItems[0].OriginalRowNumber
+		}
+		transaction.LineItems = lineItems
+		kept = append(kept, transaction)
+	}
+
+	if removed == 0 {
+		return transactions, nil
+	}
+	c.logger.Info("Removed %d blank line item(s) and %d empty transaction(s)", removed, dropped)
+	return renumberTransactions(kept), nil
+}
+
+// isBlank reports whether every line-item field of a line item is empty.
+// A template without line-item fields has no blank line items.
+func isBlank(lineItem LineItem, lineItemFields []string) bool {
+	if len(lineItemFields) == 0 {
+		return false
+	}
+	for _, field := range lineItemFields {
+		if strings.TrimSpace(lineItem.Fields[field]) != "" {
+			return false
+		}
+	}
+	return true
+}
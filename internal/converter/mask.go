@@ -0,0 +1,106 @@
+// =============================================================================
+// CSV to XML Converter - Sensitive Field Masking
+// =============================================================================
+//
+// The values of a department's sensitive fields (see internal/masking) are
+// converted unmasked, but masked everywhere else the converter puts them:
+//
+//   - validation errors, and with them the logs, the error log, the fix-up
+//     file's error columns, and the run summary
+//   - duplicate row reports
+//   - review and rejected XML files
+//   - provenance files
+//   - the data lake export (see datalake.go)
+//   - the archived copies of the input file, a merged fix-up file, and the
+//     output file
+//
+// Fix-up and rejected CSV files keep the values: they are corrected and
+// dropped back into the input directory, and are masked when archived. An
+// output file protected with PGP is archived as it is, so the archived copy
+// still matches its signature.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+)
+
+// maskErrors masks the values of sensitive fields in validation errors,
+// including where the message quotes the value.
+func (c *Converter) maskErrors(errors []*validation.ValidationError) {
+	for _, ve := range errors {
+		masked := c.masker.Value(ve.Field, ve.Value)
+		if masked == ve.Value {
+			continue
+		}
+		ve.Message = strings.ReplaceAll(ve.Message, "'"+ve.Value+"'", "'"+masked+"'")
+		ve.Value = masked
+	}
+}
+
+// maskTransactions returns copies of the transactions with the values of
+// sensitive fields masked, or the transactions themselves if no field is
+// sensitive.
+func (c *Converter) maskTransactions(transactions []Transaction) []Transaction {
+	if c.masker == nil {
+		return transactions
+	}
+
+	masked := make([]Transaction, len(transactions))
+	for i, transaction := range transactions {
+		items := make([]LineItem, len(transaction.LineItems))
+		for j, item := range transaction.LineItems {
+			item.Fields = c.masker.Fields(item.Fields)
+			items[j] = item
+		}
+		transaction.LineItems = items
+		if transaction.Fields != nil {
+			transaction.Fields = c.masker.Fields(transaction.Fields)
+		}
+		masked[i] = transaction
+	}
+	return masked
+}
+
+// archiveMaskedOutput archives a masked copy of an output document, in
+// place of FileManager.ArchiveOutputFile.
+//
+// PARAMETERS:
+//   - fm: The file manager.
+//   - out: The written document.
+//
+// RETURNS:
+//   - An error if the copy cannot be generated or archived.
+func (c *Converter) archiveMaskedOutput(fm *utils.FileManager, out *documentOutput) error {
+	if !fm.ArchiveOnSuccess {
+		return nil
+	}
+
+	options := out.options
+	options.CashbookValues = c.masker.Fields(options.CashbookValues)
+	doc, err := out.conv.render(convertToXMLWriterTransactions(c.maskTransactions(out.transactions)), options)
+	if err != nil {
+		return fmt.Errorf("failed to generate masked output: %w", err)
+	}
+
+	tempDir, err := os.MkdirTemp("", "masked-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	maskedPath := filepath.Join(tempDir, filepath.Base(out.path))
+	if err := os.WriteFile(maskedPath, doc, 0644); err != nil {
+		return fmt.Errorf("failed to write masked output: %w", err)
+	}
+	_, err = fm.ArchiveOutputFile(maskedPath)
+	return err
+}
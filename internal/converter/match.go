@@ -0,0 +1,201 @@
+// =============================================================================
+// CSV to XML Converter - Department Matching
+// =============================================================================
+//
+// Every input file is converted with the configuration of the department it
+// belongs to:
+//
+//   1. A file in a first-level subdirectory of the input directory (e.g.,
+//      input/claims/) belongs to the departments that list the
+//      subdirectory in their input_subdirectories.
+//   2. Otherwise, it belongs to the departments with a file_matching_patterns
+//      entry that matches its name.
+//   3. Of several departments, the one with the highest match_priority is
+//      used, and of those with the same priority the one whose code sorts
+//      first. With strict_department_matching, such a tie fails the file.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+)
+
+// FindDepartment finds the department configuration that matches the given file.
+//
+// PARAMETERS:
+//   - filePath: The path to the input file.
+//   - inputDir: The input directory the file was discovered in.
+//   - deptConfigs: A map of department configurations.
+//
+// RETURNS:
+//   - The matching department configuration, or nil if no match is found.
+//
+// MATCHING LOGIC:
+//   A file in a first-level subdirectory of the input directory (e.g.,
+//   input/claims/) belongs to the department that lists the subdirectory in
+//   its input_subdirectories. Otherwise, the departments with a file matching
+//   pattern that matches the file name are considered. Of several matching
+//   departments, the one with the highest match_priority is used, and of
+//   those with the same priority the one whose code sorts first (see
+//   MatchDepartments and ResolveDepartment).
+//
+// CUSTOMIZATION:
+//   - Modify the matching logic if your file naming conventions are different.
+//   - Add additional matching criteria (e.g., by file content, by header row).
+func FindDepartment(filePath, inputDir string, deptConfigs map[string]*config.DepartmentConfig) *config.DepartmentConfig {
+	matches := MatchDepartments(filePath, inputDir, deptConfigs)
+	if len(matches) == 0 {
+		// No matching department found.
+		return nil
+	}
+	return matches[0].Config
+}
+
+// ResolveDepartment finds the department configuration for a file to
+// convert, like FindDepartment, but detects ambiguous matches: files
+// matched by several departments of the same, highest priority.
+//
+// PARAMETERS:
+//   - filePath: The path to the input file.
+//   - deptConfigs: A map of department configurations.
+//   - mainConfig: The main application configuration.
+//
+// RETURNS:
+//   - The department configuration to use.
+//   - A warning naming the departments that were passed over, if the match
+//     was ambiguous.
+//   - An error if no department matches, or if the match was ambiguous and
+//     strict_department_matching is enabled.
+func ResolveDepartment(filePath string, deptConfigs map[string]*config.DepartmentConfig, mainConfig *config.MainConfig) (*config.DepartmentConfig, string, error) {
+	matches := MatchDepartments(filePath, mainConfig.InputDir, deptConfigs)
+	if len(matches) == 0 {
+		return nil, "", fmt.Errorf("no matching department configuration found")
+	}
+
+	tied := AmbiguousMatches(matches)
+	if len(tied) < 2 {
+		return matches[0].Config, "", nil
+	}
+
+	codes := make([]string, len(tied))
+	for i, match := range tied {
+		codes[i] = match.Config.DepartmentCode
+	}
+	if mainConfig.StrictDepartmentMatching {
+		return nil, "", fmt.Errorf("file matches departments %s with the same priority (strict_department_matching is enabled; set match_priority to choose one)",
+			strings.Join(codes, ", "))
+	}
+	return matches[0].Config, fmt.Sprintf("%s matches departments %s with the same priority; using %s",
+		filepath.Base(filePath), strings.Join(codes, ", "), codes[0]), nil
+}
+
+// DepartmentMatch is a department that matched a file.
+type DepartmentMatch struct {
+	// Config is the department configuration.
+	Config *config.DepartmentConfig
+
+	// Subdirectory is the input_subdirectories entry that matched the
+	// file's input subdirectory, if the department matched by folder.
+	Subdirectory string
+
+	// Pattern is the first of its patterns that matched, if the department
+	// matched by its file_matching_patterns.
+	Pattern string
+}
+
+// MatchDepartments finds every department configuration that matches the
+// given file, by descending match_priority and then by department code. The
+// first match is the one used. Departments that match by input subdirectory
+// take precedence: if any does, only those are returned.
+func MatchDepartments(filePath, inputDir string, deptConfigs map[string]*config.DepartmentConfig) []DepartmentMatch {
+	fileName := filepath.Base(filePath)
+
+	if subdir := InputSubdirectory(filePath, inputDir); subdir != "" {
+		var matches []DepartmentMatch
+		for _, code := range DepartmentCodes(deptConfigs) {
+			for _, name := range deptConfigs[code].InputSubdirectories {
+				if strings.EqualFold(name, subdir) {
+					matches = append(matches, DepartmentMatch{Config: deptConfigs[code], Subdirectory: name})
+					break
+				}
+			}
+		}
+		if len(matches) > 0 {
+			sortMatches(matches)
+			return matches
+		}
+	}
+
+	var matches []DepartmentMatch
+	for _, code := range DepartmentCodes(deptConfigs) {
+		deptConfig := deptConfigs[code]
+
+		// Check if the file name matches any of the file matching patterns.
+		for _, pattern := range deptConfig.FileMatchingPatterns {
+			// Use filepath.Match for glob-style pattern matching.
+			matched, err := filepath.Match(pattern, fileName)
+			if err != nil {
+				// Invalid pattern, skip it.
+				continue
+			}
+			if matched {
+				matches = append(matches, DepartmentMatch{Config: deptConfig, Pattern: pattern})
+				break
+			}
+		}
+	}
+
+	sortMatches(matches)
+	return matches
+}
+
+// sortMatches orders department matches by descending match_priority,
+// keeping the department code order of matches with the same priority.
+func sortMatches(matches []DepartmentMatch) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Config.MatchPriority > matches[j].Config.MatchPriority
+	})
+}
+
+// AmbiguousMatches returns the matches that share the highest priority. More
+// than one means the file could belong to any of them.
+func AmbiguousMatches(matches []DepartmentMatch) []DepartmentMatch {
+	n := 0
+	for n < len(matches) && matches[n].Config.MatchPriority == matches[0].Config.MatchPriority {
+		n++
+	}
+	return matches[:n]
+}
+
+// InputSubdirectory returns the first-level subdirectory of inputDir that
+// contains filePath (e.g., "claims" for input/claims/2024/a.csv), or "" if
+// the file is directly in inputDir or outside it.
+func InputSubdirectory(filePath, inputDir string) string {
+	rel, err := filepath.Rel(inputDir, filePath)
+	if err != nil {
+		return ""
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 2 || parts[0] == ".." {
+		return ""
+	}
+	return parts[0]
+}
+
+// DepartmentCodes returns the department codes in sort order.
+func DepartmentCodes(deptConfigs map[string]*config.DepartmentConfig) []string {
+	codes := make([]string, 0, len(deptConfigs))
+	for code := range deptConfigs {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
@@ -0,0 +1,64 @@
+// =============================================================================
+// CSV to XML Converter - Metadata Comment
+// =============================================================================
+//
+// For audits, a department can record how each XML document was generated
+// in a comment block before the root element (xml_output.metadata_comment):
+//
+//   <!-- Generated by CSV to XML Converter 1.4.0
+//     Generated at: 2024-01-15T14:30:22+01:00
+//     Source file: claims_payments_20240115.csv
+//     Template: payments.xlsx, version 3
+//     Rows read: 120, transactions: 40, line items: 118 -->
+//
+// Rows read counts every data row of the input, including duplicates that
+// were dropped and rows of rejected transactions; transactions and line
+// items count those in the document. The counts are only known once the
+// whole file is read, so the pipeline is not used (see pipeline.go).
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// documentComment returns the comment written before the root element of
+// a document: the metadata comment if the department enables it, else the
+// template version comment (see templateversion.go).
+//
+// PARAMETERS:
+//   - transactions: The transactions of the document.
+func (c *Converter) documentComment(transactions []Transaction) string {
+	if !c.deptConfig.XMLOutput.MetadataComment {
+		return c.templateComment()
+	}
+
+	lineItems := 0
+	for _, transaction := range transactions {
+		lineItems += len(transaction.LineItems)
+	}
+
+	template := c.templateName()
+	if template == "" {
+		template = "(not from a file)"
+	}
+	if version := c.templateVersion(); version != "" {
+		template += ", version " + version
+	}
+
+	// The placeholders are set by now; the time agrees with {datetime}.
+	values, _ := c.placeholderValues(false)
+
+	lines := []string{
+		"Generated by CSV to XML Converter " + Version,
+		"Generated at: " + values["datetime"],
+		"Source file: " + filepath.Base(c.csvPath),
+		"Template: " + template,
+		fmt.Sprintf("Rows read: %d, transactions: %d, line items: %d", c.rowsRead, len(transactions), lineItems),
+	}
+	return strings.Join(lines, "\n  ")
+}
@@ -0,0 +1,499 @@
+// =============================================================================
+// CSV to XML Converter - Pipelined Conversion
+// =============================================================================
+//
+// Run reads the whole input file before it groups, transforms, validates,
+// and generates it, and holds the whole document in memory before writing
+// it. For very large files, that memory grows with the file. With a
+// pipeline, the file is converted in stages connected by bounded buffers:
+//
+//   pipeline:
+//     buffer: 100    # rows or transactions held between two stages
+//
+//   parse -> group -> transform -> validate -> write
+//
+// Each stage hands its rows or transactions to the next one as soon as they
+// are ready. When a stage falls behind, e.g., because the output directory
+// is on a slow share, the buffer in front of it fills up and the stages
+// before it wait, so memory stays bounded however large the file is.
+//
+// The document is written to "<output>.partial" and renamed to its output
+// name once the whole file is converted and valid; a document encrypted
+// with PGP is written outside the output directory, as in Run. Protection,
+// delivery, and archiving then follow as in Run.
+//
+// LIMITATIONS:
+//   - Rows with the same group_by_field value must be adjacent. A file
+//     whose groups are interleaved fails with an error naming the row.
+//   - Features that need the whole file at once convert it without the
+//     pipeline, with a debug message: fix-up files, deduplication,
+//     pre_sort, template_selector, batch_grouping,
+//     continue_line_item_numbering, rejected_transactions, review_output,
+//     provenance, xml_output.metadata_comment, blank_line_items,
+//     duplicate_history_days, sensitive_fields without PGP, events,
+//     output_checkpoints, and cashbook_fields with source sum, count, or
+//     transactions.
+//   - The output file is named, and a {sequence} number allocated, when
+//     writing starts, so a file that then fails validation uses up its
+//     sequence number.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/csvparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+)
+
+// pipelineRow is a parsed row on its way to the group stage.
+type pipelineRow struct {
+	fields map[string]string
+	number int
+}
+
+// pipeline connects the stages of a file. The first stage to fail stops
+// the others.
+type pipeline struct {
+	stop  chan struct{}
+	once  sync.Once
+	stage string
+	err   error
+}
+
+// fail records the first failure, with the failure stage it counts as
+// (see FailurePolicy), and stops the stages.
+func (p *pipeline) fail(stage string, err error) {
+	p.once.Do(func() {
+		p.stage = stage
+		p.err = err
+		close(p.stop)
+	})
+}
+
+// pipelineUnsupported returns the feature that keeps the file from being
+// converted in pipelined stages, or "" if it can be. A new department
+// setting must be handled by the stages or reported here; the tests in
+// pipeline_test.go fail until it is listed as one or the other.
+func (c *Converter) pipelineUnsupported() string {
+	dept := c.deptConfig
+	switch {
+	case IsFixupFile(c.csvPath) || dept.FixupExport.Enabled || dept.FixupExport.AutoMerge:
+		return "fixup_export"
+	case dept.Deduplication.Enabled:
+		return "deduplication"
+	case len(dept.TransactionGrouping.PreSort) > 0:
+		return "pre_sort"
+	case dept.TemplateSelector.Enabled():
+		return "template_selector"
+	case dept.BatchGrouping.GroupByField != "":
+		return "batch_grouping"
+	case dept.TransactionGrouping.ContinueLineItemNumbering:
+		return "continue_line_item_numbering"
+	case dept.RejectedTransactions.Enabled:
+		return "rejected_transactions"
+	case dept.ReviewOutput.Enabled:
+		return "review_output"
+	case dept.Provenance.Enabled:
+		return "provenance"
+	case dept.XMLOutput.MetadataComment:
+		return "xml_output.metadata_comment"
+	case !dept.OutputFormat.IsXML():
+		return "output_format " + dept.OutputFormat.Type
+	case len(dept.Outputs) > 0:
+		return "outputs"
+	case c.mainConfig.DataLake.Exports(dept.DepartmentCode):
+		return "data_lake"
+	case dept.SQLSink.Enabled():
+		return "sql_sink"
+	case dept.TransactionGrouping.BlankLineItems == "remove":
+		return "blank_line_items"
+	case dept.TransactionGrouping.DuplicateHistoryDays > 0:
+		return "duplicate_history_days"
+	case c.masker != nil && !dept.PGP.Enabled:
+		return "sensitive_fields"
+	case c.publisher != nil:
+		return "events"
+	case c.mainConfig.OutputCheckpoints.Enabled():
+		return "output_checkpoints"
+	}
+	for _, field := range dept.CashbookFields {
+		switch field.Source {
+		case "sum", "count", "transactions":
+			return "cashbook_fields with source " + field.Source
+		}
+	}
+	return ""
+}
+
+// runPipeline converts the file in pipelined stages (steps 3 to 8), and
+// completes it as run does.
+//
+// PARAMETERS:
+//   - result: The result so far, with the template.
+//   - startTime: When the conversion started.
+//   - stageStart: When the current stage started.
+//
+// RETURNS:
+//   - A Result struct containing the conversion results.
+func (c *Converter) runPipeline(result Result, startTime, stageStart time.Time) Result {
+	c.logger.Debug("Converting in pipelined stages (buffer: %d)", c.mainConfig.Pipeline.Buffer)
+
+	parser, err := csvparser.NewStreamingParser(c.csvPath, c.csvSettings())
+	if err != nil {
+		result.Error = fmt.Errorf("failed to parse CSV: %w", err)
+		return result
+	}
+	defer parser.Close()
+
+	// Rename and drop columns as for a parsed file, then check the headers
+	// before any row is converted.
+	columns := &csvparser.CSVData{Headers: parser.Headers()}
+	if err := c.prepareColumns(columns); err != nil {
+		result.Error = err
+		return result
+	}
+	headers := columns.Headers
+	if info, err := os.Stat(c.csvPath); err == nil {
+		result.Stats.BytesIn = info.Size()
+	}
+	result.SchemaDrift = c.checkSchemaDrift(headers)
+	if err := c.checkUnmappedColumns(headers, nil); err != nil {
+		c.stage = config.StageTransform
+		result.Error = err
+		return result
+	}
+
+	buffer := c.mainConfig.Pipeline.Buffer
+	p := &pipeline{stop: make(chan struct{})}
+	rows := make(chan pipelineRow, buffer)
+	grouped := make(chan Transaction, buffer)
+	transformed := make(chan Transaction, buffer)
+	valid := make(chan Transaction, buffer)
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		c.parseStage(p, parser, rows)
+	}()
+	go func() {
+		defer wg.Done()
+		c.groupStage(p, rows, grouped, &result.Stats)
+	}()
+	go func() {
+		defer wg.Done()
+		c.transformStage(p, grouped, transformed)
+	}()
+	var validationResult *validation.ValidationResult
+	go func() {
+		defer wg.Done()
+		validationResult = c.validateStage(p, transformed, valid)
+	}()
+
+	out, err := c.writeStage(p, valid)
+	wg.Wait()
+	if p.err == nil && err != nil {
+		p.fail(config.StageWrite, err)
+	}
+
+	partialPath := ""
+	if out != nil {
+		partialPath = out.writtenPath() + PartialFileSuffix
+	}
+	if p.err != nil {
+		if partialPath != "" {
+			os.Remove(utils.LongPath(partialPath))
+			out.removePlaintext()
+		}
+		c.stage = p.stage
+		result.Error = p.err
+		return result
+	}
+
+	// The stages overlap, so their time is recorded as writing.
+	result.Stats.Stages.Write = lap(&stageStart)
+
+	c.stage = config.StageValidation
+	fatal := c.reportValidation(validationResult, nil, &result)
+	if len(fatal) > 0 && c.failurePolicy(config.StageValidation) != config.FailContinue {
+		os.Remove(utils.LongPath(partialPath))
+		out.removePlaintext()
+		result.Error = validationFailed(result.Validation)
+		return result
+	}
+	c.logger.Debug("Validation complete with %d errors", len(fatal))
+
+	c.stage = config.StageWrite
+	if err := os.Rename(utils.LongPath(partialPath), utils.LongPath(out.writtenPath())); err != nil {
+		os.Remove(utils.LongPath(partialPath))
+		out.removePlaintext()
+		result.Error = fmt.Errorf("failed to write output: failed to rename %s: %w", filepath.Base(partialPath), err)
+		return result
+	}
+	if info, err := os.Stat(utils.LongPath(out.writtenPath())); err == nil {
+		result.Stats.BytesOut = info.Size()
+	}
+	c.logger.Info("Wrote output to: %s", out.writtenPath())
+
+	return c.completeOutputs(result, []*documentOutput{out}, headers, startTime, stageStart)
+}
+
+// parseStage reads the rows of the file, renames and drops their columns
+// as prepareColumns does, and sends them to the group stage.
+func (c *Converter) parseStage(p *pipeline, parser *csvparser.StreamingParser, rows chan<- pipelineRow) {
+	defer close(rows)
+
+	for read := 1; parser.Next(); read++ {
+		if err := c.faults.checkRows(read); err != nil {
+			p.fail(config.StageParse, fmt.Errorf("failed to parse CSV: %w", err))
+			return
+		}
+		row := &csvparser.CSVData{Headers: parser.Headers(), Rows: []map[string]string{parser.Row()}}
+		if _, err := csvparser.RenameHeaders(row, c.deptConfig.HeaderAliases); err != nil {
+			p.fail(config.StageParse, fmt.Errorf("failed to apply header_aliases: %w", err))
+			return
+		}
+		csvparser.DropColumns(row, c.deptConfig.IgnoredColumns)
+
+		select {
+		case rows <- pipelineRow{fields: row.Rows[0], number: parser.RowNumber()}:
+		case <-p.stop:
+			return
+		}
+	}
+	if err := parser.Err(); err != nil {
+		p.fail(config.StageParse, fmt.Errorf("failed to parse CSV: %w", err))
+	}
+}
+
+// groupStage groups adjacent rows into transactions, as groupTransactions
+// and splitTransactions do for a whole file, and sends them to the
+// transform stage.
+func (c *Converter) groupStage(p *pipeline, rows <-chan pipelineRow, grouped chan<- Transaction, stats *ProcessingStats) {
+	defer close(grouped)
+
+	groupByField := c.deptConfig.TransactionGrouping.GroupByField
+	limit := c.deptConfig.TransactionGrouping.MaxLineItems
+	seen := make(map[string]bool)
+	splits := 0
+
+	var current *Transaction
+	var first LineItem
+	send := func() bool {
+		if current == nil {
+			return true
+		}
+		stats.TransactionsCreated++
+		stats.LineItemsCreated += len(current.LineItems)
+		select {
+		case grouped <- *current:
+			current = nil
+			return true
+		case <-p.stop:
+			return false
+		}
+	}
+
+	for row := range rows {
+		stats.RowsProcessed++
+		key := ""
+		if groupByField != "" {
+			key = row.fields[groupByField]
+		}
+
+		continues := current != nil && groupByField != "" && key == current.GroupKey
+		if !continues {
+			if groupByField != "" && seen[key] {
+				p.fail(config.StageTransform, fmt.Errorf("row %d continues transaction %q after other transactions; the pipeline needs the rows of a transaction to be adjacent (sort the file by %s)",
+					row.number, key, groupByField))
+				return
+			}
+			seen[key] = true
+		}
+
+		lineItem := LineItem{ID: stats.RowsProcessed, Fields: row.fields, OriginalRowNumber: row.number}
+		switch {
+		case !continues:
+			if !send() {
+				return
+			}
+			first = lineItem
+			current = &Transaction{ID: stats.TransactionsCreated + 1, GroupKey: key}
+
+		case limit > 0 && len(current.LineItems) == limit:
+			// Continue the transaction in a new one, with its
+			// transaction-level fields.
+			if !send() {
+				return
+			}
+			splits++
+			c.copyTransactionFields(c.schema, first, &lineItem)
+			current = &Transaction{ID: stats.TransactionsCreated + 1, GroupKey: key}
+		}
+		current.LineItems = append(current.LineItems, lineItem)
+	}
+	if !send() {
+		return
+	}
+
+	if splits > 0 {
+		c.logger.Info("Split %d transaction(s) into %d to keep at most %d line items each",
+			stats.TransactionsCreated-splits, stats.TransactionsCreated, limit)
+	}
+	c.logger.Debug("Grouped %d rows into %d transactions", stats.RowsProcessed, stats.TransactionsCreated)
+}
+
+// transformStage applies the transformation rules to each transaction and
+// sends it to the validate stage.
+func (c *Converter) transformStage(p *pipeline, grouped <-chan Transaction, transformed chan<- Transaction) {
+	defer close(transformed)
+
+	for transaction := range grouped {
+		if err := c.applyTransformations(&transaction); err != nil {
+			p.fail(config.StageTransform, fmt.Errorf("failed to apply transformations: %w", err))
+			return
+		}
+		select {
+		case transformed <- transaction:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// validateStage validates each transaction against the schema and sends
+// it to the write stage. After the first validation error that fails the
+// file, the remaining transactions are still validated, for the report,
+// but no longer written.
+//
+// RETURNS:
+//   - The validation result of all transactions.
+func (c *Converter) validateStage(p *pipeline, transformed <-chan Transaction, valid chan<- Transaction) *validation.ValidationResult {
+	defer close(valid)
+
+	options := c.validationOptions()
+	validator := validation.NewValidatorWithOptions(c.schema, options)
+	result := validation.NewValidationResult(options)
+	failing := c.failurePolicy(config.StageValidation) != config.FailContinue
+	validating := true
+	fatal := false
+
+	for transaction := range transformed {
+		if validating {
+			part := validator.ValidateAll(convertToValidationTransactions([]Transaction{transaction}))
+			c.checkRunKeys([]Transaction{transaction}, part)
+			for _, ve := range part.Errors {
+				if ve.Severity == "error" {
+					fatal = true
+				}
+			}
+			if !result.Merge(part) || (options.StopOnFirstError && part.ErrorCount > 0) {
+				validating = false
+			}
+		}
+		if failing && fatal {
+			continue
+		}
+
+		select {
+		case valid <- transaction:
+		case <-p.stop:
+			return result
+		}
+	}
+	return result
+}
+
+// writeStage writes the transactions to the partial output file while
+// they arrive.
+//
+// RETURNS:
+//   - The document, with the path it is renamed to once the file is
+//     converted, or nil if the partial file was not created.
+//   - An error if the file cannot be written.
+func (c *Converter) writeStage(p *pipeline, valid <-chan Transaction) (*documentOutput, error) {
+	// Drain the channel, so the stages before stop once they see the failure.
+	defer func() {
+		for range valid {
+		}
+	}()
+
+	// The first transaction is needed for cashbook-level values.
+	var first []Transaction
+	select {
+	case transaction, ok := <-valid:
+		if ok {
+			first = []Transaction{transaction}
+		}
+	case <-p.stop:
+		return nil, nil
+	}
+
+	options, err := c.generateOptions(first)
+	if err != nil {
+		return nil, err
+	}
+	outputPath, err := c.outputPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write output: %w", err)
+	}
+	out := &documentOutput{conv: c, options: options, path: outputPath, name: filepath.Base(outputPath)}
+	if out.plaintext, err = c.plaintextPath(outputPath); err != nil {
+		return nil, fmt.Errorf("failed to write output: %w", err)
+	}
+
+	file, err := os.OpenFile(utils.LongPath(out.writtenPath()+PartialFileSuffix), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write output: failed to create file: %w", err)
+	}
+
+	writer := xmlwriter.NewDocumentWriter(c.faults.outputWriter(file), c.schema, c.deptConfig, options)
+	writer.Start(convertToXMLWriterTransactions(first))
+	err = c.writeTransactions(p, writer, first, valid)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return out, fmt.Errorf("failed to write output: %w", err)
+	}
+	return out, nil
+}
+
+// writeTransactions adds the first transaction and the ones that follow it
+// to the document.
+func (c *Converter) writeTransactions(p *pipeline, writer *xmlwriter.DocumentWriter, first []Transaction, valid <-chan Transaction) error {
+	for _, transaction := range convertToXMLWriterTransactions(first) {
+		if err := writer.WriteTransaction(transaction); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case transaction, ok := <-valid:
+			if !ok {
+				return nil
+			}
+			if err := writer.WriteTransaction(convertToXMLWriterTransactions([]Transaction{transaction})[0]); err != nil {
+				return err
+			}
+		case <-p.stop:
+			return nil
+		}
+	}
+}
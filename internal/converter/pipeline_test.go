@@ -0,0 +1,161 @@
+package converter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+)
+
+// pipelineHandled are the department settings that a pipelined conversion
+// applies as Run does, or that do not change how a file is converted
+// (matching, scheduling, and delivery). A setting is named by its YAML path
+// or the path of its section.
+var pipelineHandled = []string{
+	"department_name",
+	"department_code",
+	"file_matching_patterns",
+	"input_subdirectories",
+	"match_priority",
+	"processing_priority",
+	"concurrency",
+	"output_dir",
+	"input_archive_dir",
+	"output_archive_dir",
+	"uuid_format",
+	"csv_settings",
+	"header_aliases",
+	"ignored_columns",
+	"strict_columns",
+	"template_mapping",
+	"transformation_rules",
+	"transaction_grouping.group_by_field",
+	"transaction_grouping.sort_by_field", // not applied by Run either
+	"transaction_grouping.sort_order",
+	"transaction_grouping.max_line_items",
+	"transaction_grouping.min_line_items",
+	"transaction_grouping.unique_across_run",
+	"static_fields",
+	"cashbook_fields", // sources first and value
+	"document_header",
+	"xml_output",
+	"validation_suppressions",
+	"custom_validations",
+	"business_calendar",
+	"failure_policy",
+	"error_limits",
+	"pgp",
+	"delivery",
+}
+
+// pipelineFallbacks set each department setting that pipelineUnsupported
+// reports, by its YAML path or the path of its section.
+var pipelineFallbacks = []struct {
+	setting string
+	set     func(dept *config.DepartmentConfig)
+}{
+	{"fixup_export", func(dept *config.DepartmentConfig) { dept.FixupExport.Enabled = true }},
+	{"deduplication", func(dept *config.DepartmentConfig) { dept.Deduplication.Enabled = true }},
+	{"transaction_grouping.pre_sort", func(dept *config.DepartmentConfig) {
+		dept.TransactionGrouping.PreSort = []config.SortKey{{Field: "DATE"}}
+	}},
+	{"template_selector", func(dept *config.DepartmentConfig) { dept.TemplateSelector.Field = "TYPE" }},
+	{"batch_grouping", func(dept *config.DepartmentConfig) { dept.BatchGrouping.GroupByField = "ACCOUNT" }},
+	{"transaction_grouping.continue_line_item_numbering", func(dept *config.DepartmentConfig) {
+		dept.TransactionGrouping.ContinueLineItemNumbering = true
+	}},
+	{"rejected_transactions", func(dept *config.DepartmentConfig) { dept.RejectedTransactions.Enabled = true }},
+	{"review_output", func(dept *config.DepartmentConfig) { dept.ReviewOutput.Enabled = true }},
+	{"provenance", func(dept *config.DepartmentConfig) { dept.Provenance.Enabled = true }},
+	{"xml_output.metadata_comment", func(dept *config.DepartmentConfig) { dept.XMLOutput.MetadataComment = true }},
+	{"output_format", func(dept *config.DepartmentConfig) { dept.OutputFormat.Type = config.OutputFormatJSON }},
+	{"outputs", func(dept *config.DepartmentConfig) { dept.Outputs = []config.OutputTarget{{Name: "copy"}} }},
+	{"sql_sink", func(dept *config.DepartmentConfig) { dept.SQLSink.Driver = "postgres" }},
+	{"transaction_grouping.blank_line_items", func(dept *config.DepartmentConfig) {
+		dept.TransactionGrouping.BlankLineItems = "remove"
+	}},
+	// Only applies with blank_line_items: remove.
+	{"transaction_grouping.empty_transactions", func(dept *config.DepartmentConfig) {
+		dept.TransactionGrouping.BlankLineItems = "remove"
+		dept.TransactionGrouping.EmptyTransactions = "drop"
+	}},
+	{"transaction_grouping.duplicate_history_days", func(dept *config.DepartmentConfig) {
+		dept.TransactionGrouping.DuplicateHistoryDays = 30
+	}},
+	{"sensitive_fields", func(dept *config.DepartmentConfig) {
+		dept.SensitiveFields = []config.SensitiveField{{Field: "ACCOUNT"}}
+	}},
+	{"cashbook_fields", func(dept *config.DepartmentConfig) {
+		dept.CashbookFields = []config.CashbookField{{Field: "TOTAL", Source: "sum"}}
+	}},
+}
+
+// TestPipelineCoversDepartmentSettings fails for a new department setting
+// until it is either handled by the pipeline (and listed in
+// pipelineHandled) or reported by pipelineUnsupported (and listed in
+// pipelineFallbacks).
+func TestPipelineCoversDepartmentSettings(t *testing.T) {
+	known := make(map[string]bool)
+	for _, setting := range pipelineHandled {
+		known[setting] = true
+	}
+	for _, fallback := range pipelineFallbacks {
+		known[fallback.setting] = true
+	}
+
+	for _, setting := range departmentSettings(reflect.TypeOf(config.DepartmentConfig{}), "") {
+		covered := false
+		for path := setting; path != "" && !covered; path = parentSetting(path) {
+			covered = known[path]
+		}
+		if !covered {
+			t.Errorf("department setting %s is neither handled by the pipeline (pipelineHandled) nor reported by pipelineUnsupported (pipelineFallbacks)", setting)
+		}
+	}
+}
+
+// TestPipelineUnsupported checks that pipelineUnsupported reports each
+// setting of pipelineFallbacks, and nothing for a plain department.
+func TestPipelineUnsupported(t *testing.T) {
+	if feature := New("claims.csv", &config.DepartmentConfig{}, &config.MainConfig{}).pipelineUnsupported(); feature != "" {
+		t.Errorf("pipelineUnsupported() = %q for a plain department, want \"\"", feature)
+	}
+
+	for _, fallback := range pipelineFallbacks {
+		dept := &config.DepartmentConfig{}
+		fallback.set(dept)
+		if feature := New("claims.csv", dept, &config.MainConfig{}).pipelineUnsupported(); feature == "" {
+			t.Errorf("pipelineUnsupported() = \"\" with %s set, want the feature", fallback.setting)
+		}
+	}
+}
+
+// departmentSettings returns the YAML paths of the settings of a
+// configuration struct, e.g. "transaction_grouping.pre_sort". Nested
+// sections are listed by their settings; lists and maps are one setting.
+func departmentSettings(t reflect.Type, prefix string) []string {
+	var settings []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+		if field.Type.Kind() == reflect.Struct && field.Type.PkgPath() == t.PkgPath() {
+			settings = append(settings, departmentSettings(field.Type, path+".")...)
+			continue
+		}
+		settings = append(settings, path)
+	}
+	return settings
+}
+
+// parentSetting returns the path of the section of a setting, or "".
+func parentSetting(path string) string {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+// =============================================================================
+// CSV to XML Converter - Pre-check Mode
+// =============================================================================
+//
+// This module provides a fast pre-check of an input file. Instead of running
+// the full pipeline, it parses only the first rows and a random sample of the
+// rest of the file, then transforms and validates them. No XML is generated,
+// nothing is written, and nothing is archived.
+//
+// USE CASE:
+//   Operations can find out in seconds whether a very large file is worth a
+//   full run, instead of waiting for the full conversion to fail.
+//
+// Check validates the whole file the same way, for business users who want
+// to know whether a file will pass before the nightly run.
+//
+// LIMITATIONS:
+//   - Only the selected rows are validated; errors in other rows are not found.
+//   - Transactions are built from the sampled rows only, so transaction-level
+//     results reflect the sample rather than the whole file.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/csvparser"
+)
+
+// =============================================================================
+// PRE-CHECK OPTIONS
+// =============================================================================
+
+// PrecheckOptions controls which rows are checked in pre-check mode.
+type PrecheckOptions struct {
+	// HeadRows is the number of leading data rows that are always checked.
+	// Default: 1000
+	HeadRows int
+
+	// SampleRows is the number of additional rows sampled at random from the
+	// rest of the file.
+	// Default: 1000
+	SampleRows int
+
+	// Seed is the random seed used for sampling.
+	// Use a fixed seed to reproduce a previous pre-check.
+	// Default: the current time
+	Seed int64
+}
+
+// DefaultPrecheckOptions returns the default pre-check options.
+func DefaultPrecheckOptions() PrecheckOptions {
+	return PrecheckOptions{
+		HeadRows:   1000,
+		SampleRows: 1000,
+		Seed:       time.Now().UnixNano(),
+	}
+}
+
+// =============================================================================
+// PRE-CHECK FUNCTION
+// =============================================================================
+
+// Precheck parses and validates a sample of the file without generating XML.
+//
+// PARAMETERS:
+//   - options: The pre-check options (rows to check and sampling seed).
+//
+// RETURNS:
+//   - A Result struct. Success is true if the sampled rows have no validation
+//     errors. OutputFile is always empty, and Stats.RowsProcessed is the number
+//     of rows checked.
+//
+// PROCESSING STEPS:
+//   1. Determine and parse the template (same as Run)
+//   2. Parse the head rows and a random sample of the CSV
+//   3. Group, transform, and validate the selected rows (same as Run)
+func (c *Converter) Precheck(options PrecheckOptions) Result {
+	startTime := time.Now()
+	result := Result{
+		FilePath: c.csvPath,
+		Success:  false,
+	}
+
+	c.logger.Info("Pre-checking file: %s", c.csvPath)
+
+	// Determine and parse the template.
+	stageStart := time.Now()
+	templatePath, err := c.determineTemplate()
+	if err != nil {
+		result.Error = fmt.Errorf("failed to determine template: %w", err)
+		return result
+	}
+
+	schema, err := c.parseTemplate(templatePath)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to parse template: %w", err)
+		return result
+	}
+	c.schema = schema
+	result.Stats.Stages.TemplateParse = lap(&stageStart)
+
+	// Parse the head and a random sample of the remaining rows.
+	csvData, err := csvparser.ParseSample(c.csvPath, c.csvSettings(),
+		options.HeadRows, options.SampleRows, options.Seed)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to parse CSV: %w", err)
+		return result
+	}
+	if err := c.prepareColumns(csvData); err != nil {
+		result.Error = err
+		return result
+	}
+
+	result.Stats.Stages.CSVParse = lap(&stageStart)
+	c.logger.Debug("Selected %d rows for pre-check", len(csvData.Rows))
+	result.SchemaDrift = c.checkSchemaDrift(csvData.Headers)
+
+	// De-duplicate, group, transform, and validate exactly as a full run would.
+	transactions, duplicates, err := c.buildTransactions(csvData, &result.Stats)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	result.Stats.Stages.Transform = lap(&stageStart)
+
+	validationErrors := c.validate(transactions, duplicates, &result)
+	result.Stats.Stages.Validate = lap(&stageStart)
+
+	result.Stats.ProcessingTime = time.Since(startTime)
+
+	if len(validationErrors) > 0 {
+		result.Error = fmt.Errorf("%w: pre-check found %d errors in %d sampled rows",
+			ErrValidationFailed, len(validationErrors), len(csvData.Rows))
+		return result
+	}
+
+	result.Success = true
+	return result
+}
+
+// =============================================================================
+// FULL CHECK
+// =============================================================================
+
+// Check parses, transforms, and validates the whole file without generating
+// XML. Unlike Run, nothing is locked, merged, written, or archived.
+//
+// RETURNS:
+//   - A Result struct. Success is true if the file has no validation errors
+//     (regardless of ContinueOnError). OutputFile is always empty.
+func (c *Converter) Check() Result {
+	c.logger.Info("Checking file: %s", c.csvPath)
+
+	templatePath, err := c.determineTemplate()
+	if err != nil {
+		return Result{FilePath: c.csvPath, Department: c.deptConfig.DepartmentCode,
+			Error: fmt.Errorf("failed to determine template: %w", err)}
+	}
+
+	schema, err := c.parseTemplate(templatePath)
+	if err != nil {
+		return Result{FilePath: c.csvPath, Department: c.deptConfig.DepartmentCode,
+			Error: fmt.Errorf("failed to parse template: %w", err)}
+	}
+
+	file, err := os.Open(c.csvPath)
+	if err != nil {
+		return Result{FilePath: c.csvPath, Department: c.deptConfig.DepartmentCode,
+			Error: fmt.Errorf("failed to parse CSV: %w", err)}
+	}
+	defer file.Close()
+
+	return c.ValidateStream(file, schema)
+}
@@ -0,0 +1,56 @@
+// =============================================================================
+// CSV to XML Converter - Preview
+// =============================================================================
+//
+// Before real processing is enabled for a new department, business users
+// want to see the XML it would produce. A preview runs the conversion of a
+// file exactly as Run would, up to the generated document, and writes the
+// document to the given writer instead of the output directory.
+//
+// Nothing is locked, merged, written to the output directory, protected,
+// delivered, published, archived, or recorded. A {sequence} placeholder
+// shows the next sequence number without allocating it.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Preview converts the file and writes the XML document to output.
+//
+// PARAMETERS:
+//   - output: Receives the XML document. Nothing is written if the
+//     conversion fails.
+//
+// RETURNS:
+//   - A Result struct, as for Run. OutputFile is always empty.
+func (c *Converter) Preview(output io.Writer) Result {
+	c.preview = true
+	c.logger.Info("Previewing file: %s", c.csvPath)
+
+	templatePath, err := c.determineTemplate()
+	if err != nil {
+		return Result{FilePath: c.csvPath, Department: c.deptConfig.DepartmentCode,
+			Error: fmt.Errorf("failed to determine template: %w", err)}
+	}
+
+	schema, err := c.parseTemplate(templatePath)
+	if err != nil {
+		return Result{FilePath: c.csvPath, Department: c.deptConfig.DepartmentCode,
+			Error: fmt.Errorf("failed to parse template: %w", err)}
+	}
+
+	file, err := os.Open(c.csvPath)
+	if err != nil {
+		return Result{FilePath: c.csvPath, Department: c.deptConfig.DepartmentCode,
+			Error: fmt.Errorf("failed to parse CSV: %w", err)}
+	}
+	defer file.Close()
+
+	return c.ConvertStream(file, output, schema)
+}
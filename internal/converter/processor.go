@@ -0,0 +1,631 @@
+// =============================================================================
+// CSV to XML Converter - Directory Processing
+// =============================================================================
+//
+// Run converts one file. A Processor converts the files of the input
+// directory, the way the process and watch commands do, so every front end
+// (the CLI, a server) discovers, matches, and converts files the same way:
+//
+//   processor := converter.NewProcessor(deptConfigs, mainConfig)
+//   processor.SetLogger(logger)
+//   err := processor.ProcessDirectory(ctx, converter.ProcessOptions{
+//       Summary: &summary,
+//   }, func(result converter.Result) {
+//       // Report the file...
+//   })
+//
+//   1. The CSV files of the input directory are discovered. Fix-up files
+//      waiting to be merged with their original file are left out.
+//   2. Each file is matched to its department (see match.go).
+//   3. At most max_concurrency files are converted at a time, shared
+//      between the departments of the files (see scheduler.go), and the
+//      estimated completion is logged (see estimate.go). Each file is
+//      checked for free disk space before it is started (see diskspace.go),
+//      and Run archives it once it is converted.
+//   4. Each result is added to the run summary and passed to the callback,
+//      one at a time, as the files finish.
+//
+// Results returns the same results on a channel instead, for callers that
+// report progress during long runs:
+//
+//   results, err := processor.Results(ctx, converter.ProcessOptions{})
+//   for result := range results {
+//       // Report the file...
+//   }
+//
+// =============================================================================
+
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/audit"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/events"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+)
+
+// ErrStopping is the error of a file that was not started because the
+// processing was canceled, e.g., because the watcher is stopping.
+var ErrStopping = errors.New("processing is stopping")
+
+// ErrAborted is the error of a file that was not started because a failed
+// file's failure policy aborted the run.
+var ErrAborted = errors.New("run aborted by the failure policy of a failed file")
+
+// ErrorSampleRows is the number of sample row numbers listed for a group
+// of identical validation errors.
+const ErrorSampleRows = 5
+
+// ProcessOptions defines which files ProcessDirectory converts, and how.
+type ProcessOptions struct {
+	// Files are converted as they are, instead of the files discovered in
+	// the input directory (e.g., a file named on the command line).
+	Files []string
+
+	// Ready returns the discovered files that are ready to be converted,
+	// e.g., after waiting for files that are still being copied (see
+	// file_readiness). nil converts every discovered file.
+	Ready func(files []string) []string
+
+	// Convert converts a file with its converter instead of Run, e.g., a
+	// pre-check or a preview.
+	Convert func(conv *Converter, filePath string) Result
+
+	// ReadOnly is set if the conversion does not write files: free disk
+	// space is not checked.
+	ReadOnly bool
+
+	// Summary, if not nil, receives the number of files and the result of
+	// each file (see RecordSummary).
+	Summary *utils.ProcessingSummary
+}
+
+// Processor converts the files of an input directory.
+type Processor struct {
+	deptConfigs map[string]*config.DepartmentConfig
+	mainConfig  *config.MainConfig
+	templates   map[string]*xlsxparser.Schema
+	logger      Logger
+	publisher   events.Publisher
+	trail       *audit.Trail
+	faults      Faults
+}
+
+// NewProcessor creates a processor of the input directory of the main
+// configuration.
+//
+// PARAMETERS:
+//   - deptConfigs: A map of department configurations.
+//   - mainConfig: The main application configuration.
+//
+// RETURNS:
+//   - A pointer to the new Processor.
+func NewProcessor(deptConfigs map[string]*config.DepartmentConfig, mainConfig *config.MainConfig) *Processor {
+	return &Processor{deptConfigs: deptConfigs, mainConfig: mainConfig}
+}
+
+// SetLogger sets the logger passed to each converter, and used for
+// ambiguous department matches. Without one, the converters log to
+// standard output.
+func (p *Processor) SetLogger(logger Logger) {
+	p.logger = logger
+}
+
+// SetPublisher sets the publisher for conversion events (see
+// Converter.SetPublisher).
+func (p *Processor) SetPublisher(publisher events.Publisher) {
+	p.publisher = publisher
+}
+
+// SetTemplates provides templates parsed in advance, by path (see
+// Converter.SetTemplates).
+func (p *Processor) SetTemplates(templates map[string]*xlsxparser.Schema) {
+	p.templates = templates
+}
+
+// SetAuditTrail sets the audit trail whose key index each converter checks
+// (see Converter.SetAuditTrail).
+func (p *Processor) SetAuditTrail(trail *audit.Trail) {
+	p.trail = trail
+}
+
+// SetFaults injects failures into each conversion, for resilience testing
+// (see Converter.SetFaults).
+func (p *Processor) SetFaults(faults Faults) {
+	p.faults = faults
+}
+
+// Discover returns the CSV files of the input directory, without fix-up
+// files that will be merged into their original file by the converter.
+//
+// RETURNS:
+//   - The files to convert.
+//   - An error if the input directory cannot be read.
+func (p *Processor) Discover() ([]string, error) {
+	files, err := DiscoverInputFiles(p.mainConfig.InputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []string
+	for _, file := range files {
+		deptConfig := FindDepartment(file, p.mainConfig.InputDir, p.deptConfigs)
+		if deptConfig != nil && IsPendingFixup(file, deptConfig) {
+			continue
+		}
+		filtered = append(filtered, file)
+	}
+	return filtered, nil
+}
+
+// ProcessDirectory converts the files of the input directory and waits
+// until all are done.
+//
+// PARAMETERS:
+//   - ctx: Canceled to stop starting files (see Results).
+//   - opts: The files to convert, and how.
+//   - handle: Called with the result of each file, one at a time, or nil.
+//
+// RETURNS:
+//   - An error if the input directory cannot be read. Files that fail are
+//     only reported in their results.
+func (p *Processor) ProcessDirectory(ctx context.Context, opts ProcessOptions, handle func(Result)) error {
+	results, err := p.Results(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for result := range results {
+		if handle != nil {
+			handle(result)
+		}
+	}
+	return nil
+}
+
+// Results starts converting the files of the input directory and returns
+// their results as the files finish, for callers that report progress
+// during long runs (e.g., a program embedding the converter).
+//
+// PARAMETERS:
+//   - ctx: Canceled to stop starting files. Files not started by then get
+//     a skipped result with ErrStopping; files in progress finish.
+//   - opts: The files to convert, and how.
+//
+// A file that fails with AbortRun (see config.FailurePolicy) stops the
+// run the same way: files not started get a skipped result with
+// ErrAborted.
+//
+// RETURNS:
+//   - A channel that receives one result per file, in the order the files
+//     finish, and is closed when all files are done. Each result is added
+//     to opts.Summary before it is received. The channel holds every
+//     result, so a caller that stops receiving does not block the
+//     conversion.
+//   - An error if the input directory cannot be read. Files that fail are
+//     only reported in their results.
+func (p *Processor) Results(ctx context.Context, opts ProcessOptions) (<-chan Result, error) {
+	files := opts.Files
+	if files == nil {
+		discovered, err := p.Discover()
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover input files: %w", err)
+		}
+		files = discovered
+		if opts.Ready != nil {
+			files = opts.Ready(files)
+		}
+	}
+
+	if opts.Summary != nil {
+		opts.Summary.TotalFiles += len(files)
+	}
+
+	// The summary is updated by one goroutine, in the order of the results.
+	results := make(chan Result, len(files))
+	go func() {
+		defer close(results)
+		for result := range p.convertFiles(ctx, files, opts) {
+			if opts.Summary != nil {
+				RecordSummary(opts.Summary, result)
+			}
+			results <- result
+		}
+	}()
+	return results, nil
+}
+
+// convertFiles converts the given files concurrently.
+//
+// PARAMETERS:
+//   - ctx: Canceled to stop starting files (see Results).
+//   - inputFiles: The files to convert.
+//   - opts: How to convert them.
+//
+// RETURNS:
+//   - A channel that receives one result per file and is closed when all
+//     files are done.
+//
+// At most max_concurrency files are converted at a time, shared between
+// the departments of the files (see scheduler.go).
+func (p *Processor) convertFiles(ctx context.Context, inputFiles []string, opts ProcessOptions) <-chan Result {
+	// Create a WaitGroup to wait for all goroutines to complete.
+	var wg sync.WaitGroup
+
+	// Create a channel to collect processing results.
+	// The channel is buffered to prevent blocking.
+	results := make(chan Result, len(inputFiles))
+
+	// Each file waits in its department's queue for a slot.
+	now := time.Now()
+	scheduler, order := p.queueFiles(inputFiles, now)
+	p.logPriorities(order)
+	if !opts.ReadOnly {
+		p.logEstimate(inputFiles, now)
+	}
+
+	// Receives the department of each file that finished.
+	finished := make(chan string, len(inputFiles))
+
+	// Closed when a file's failure policy aborts the run.
+	abort := make(chan struct{})
+	var abortOnce sync.Once
+
+	// The transaction keys of the run (see runkeys.go).
+	keys := newRunKeys()
+
+	// Files are not started while the output or archive volumes are low on
+	// space.
+	var spaceDirs []string
+	if !opts.ReadOnly {
+		spaceDirs = DiskSpaceDirs(p.mainConfig, p.deptConfigs)
+	}
+
+	// Start the files as slots become free, until all are started or the
+	// run is stopping.
+	go func() {
+		var stopped error
+		for started := 0; started < len(inputFiles); {
+			select {
+			case <-ctx.Done():
+				stopped = ErrStopping
+			case <-abort:
+				stopped = ErrAborted
+			default:
+			}
+			if stopped != nil {
+				break
+			}
+
+			file, ok := scheduler.next()
+			if !ok {
+				// Wait for a file to finish, unless the run is stopping.
+				select {
+				case department := <-finished:
+					scheduler.done(department)
+				case <-ctx.Done():
+				case <-abort:
+				}
+				continue
+			}
+
+			started++
+			wg.Add(1)
+			go func(file scheduledFile) {
+				defer wg.Done()
+				defer func() { finished <- file.department }()
+
+				if err := CheckDiskSpace(spaceDirs, p.mainConfig.DiskSpace); err != nil {
+					results <- Result{FilePath: file.path, Skipped: true, Error: err}
+					return
+				}
+
+				result := p.convertFile(file.path, opts, keys)
+				if !result.Success {
+					keys.release(file.path)
+				}
+				if result.AbortRun {
+					abortOnce.Do(func() { close(abort) })
+				}
+				results <- result
+			}(file)
+		}
+
+		// Files not started by then are skipped.
+		if stopped != nil {
+			for _, file := range scheduler.waiting() {
+				results <- Result{FilePath: file, Skipped: true, Error: stopped}
+			}
+		}
+
+		// Close the results channel when all files are done.
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// priorityEntry is a file of a run with its processing priority.
+type priorityEntry struct {
+	file       string
+	department string
+	priority   int
+	rule       string
+	size       int64
+}
+
+// queueFiles creates the scheduler of a run and queues its files in their
+// departments, by priority and then by size if file_order is set.
+//
+// PARAMETERS:
+//   - files: The files of the run.
+//   - now: The time the priorities are evaluated at.
+//
+// RETURNS:
+//   - The scheduler with all files queued.
+//   - The files with their department, priority, and size, in queue order.
+func (p *Processor) queueFiles(files []string, now time.Time) (*fileScheduler, []priorityEntry) {
+	entries := make([]priorityEntry, len(files))
+	concurrency := make(map[string]config.ConcurrencySettings)
+	for i, file := range files {
+		entry := priorityEntry{file: file}
+		if deptConfig, _, err := ResolveDepartment(file, p.deptConfigs, p.mainConfig); err == nil {
+			entry.department = deptConfig.DepartmentCode
+			entry.priority, entry.rule = deptConfig.ProcessingPriority.For(filepath.Base(file), now)
+			concurrency[entry.department] = deptConfig.Concurrency
+		}
+		if info, err := os.Stat(file); err == nil {
+			entry.size = info.Size()
+		}
+		entries[i] = entry
+	}
+
+	// The scheduler keeps the order of files with the same priority.
+	switch p.mainConfig.FileOrder {
+	case config.FileOrderLargestFirst:
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].size > entries[j].size })
+	case config.FileOrderSmallestFirst:
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].size < entries[j].size })
+	}
+
+	scheduler := newFileScheduler(p.mainConfig.MaxConcurrency)
+	for _, entry := range entries {
+		settings := concurrency[entry.department]
+		scheduler.add(entry.file, entry.department, entry.priority, settings.MaxFiles, settings.Weight)
+	}
+	return scheduler, entries
+}
+
+// logPriorities logs the order in which the files of a run get free slots,
+// if any file has a priority: one line per priority and department, e.g.
+//
+//	Processing order: priority 20, PAYROLL by rule "payroll_*.csv" (06:00-10:00): 2 file(s): payroll_1.csv, payroll_2.csv
+//
+// Files that match no department share the department "".
+func (p *Processor) logPriorities(order []priorityEntry) {
+	if p.logger == nil {
+		return
+	}
+	prioritized := false
+	for _, entry := range order {
+		if entry.priority != 0 {
+			prioritized = true
+		}
+	}
+	if !prioritized {
+		return
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i].priority != order[j].priority {
+			return order[i].priority > order[j].priority
+		}
+		return order[i].department < order[j].department
+	})
+	for start := 0; start < len(order); {
+		end := start
+		var names []string
+		for end < len(order) && order[end].priority == order[start].priority &&
+			order[end].department == order[start].department && order[end].rule == order[start].rule {
+			if len(names) < priorityLogFiles {
+				names = append(names, filepath.Base(order[end].file))
+			}
+			end++
+		}
+		if end-start > priorityLogFiles {
+			names = append(names, "...")
+		}
+
+		group := order[start].department
+		if order[start].rule != "" {
+			group += " by " + order[start].rule
+		}
+		p.logger.Info("Processing order: priority %d, %s: %d file(s): %s",
+			order[start].priority, group, end-start, strings.Join(names, ", "))
+		start = end
+	}
+}
+
+// priorityLogFiles is the number of file names logged per priority group.
+const priorityLogFiles = 5
+
+// convertFile matches a file to its department and converts it, with the
+// transaction keys of the run.
+func (p *Processor) convertFile(filePath string, opts ProcessOptions, keys *runKeys) Result {
+	deptConfig, warning, err := ResolveDepartment(filePath, p.deptConfigs, p.mainConfig)
+	if err != nil {
+		return Result{FilePath: filePath, Success: false, Error: err}
+	}
+	if warning != "" && p.logger != nil {
+		p.logger.Warn("%s", warning)
+	}
+
+	// Create a new converter instance for this file.
+	conv := New(filePath, deptConfig, p.mainConfig)
+	if p.logger != nil {
+		conv.SetLogger(p.logger)
+	}
+	if p.publisher != nil {
+		conv.SetPublisher(p.publisher)
+	}
+	if p.templates != nil {
+		conv.SetTemplates(p.templates)
+	}
+	if p.trail != nil {
+		conv.SetAuditTrail(p.trail)
+	}
+	conv.SetFaults(p.faults)
+	conv.runKeys = keys
+
+	if opts.Convert != nil {
+		return opts.Convert(conv, filePath)
+	}
+	return conv.Run()
+}
+
+// DiscoverInputFiles scans a directory, and its subdirectories, for CSV
+// files.
+//
+// PARAMETERS:
+//   - inputDir: The path to the input directory.
+//
+// RETURNS:
+//   - A slice of file paths to CSV files.
+//   - An error if the directory cannot be read.
+//
+// CUSTOMIZATION:
+//   - Modify the file extension filter if your input files have a different extension.
+//   - Add additional filtering logic if needed (e.g., by date, by size).
+func DiscoverInputFiles(inputDir string) ([]string, error) {
+	var files []string
+
+	// Walk the input directory and find all CSV files.
+	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip directories.
+		if info.IsDir() {
+			return nil
+		}
+
+		// Check if the file has a .csv extension.
+		// CUSTOMIZATION: Modify this if your files have a different extension.
+		if filepath.Ext(path) == ".csv" {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// =============================================================================
+// RUN SUMMARY
+// =============================================================================
+
+// RecordSummary adds a file's result to the run summary.
+func RecordSummary(summary *utils.ProcessingSummary, result Result) {
+	summary.TotalRows += result.Stats.RowsProcessed
+	summary.TotalTransactions += result.Stats.TransactionsCreated
+	summary.TotalLineItems += result.Stats.LineItemsCreated
+	summary.ValidationErrors += result.Stats.ValidationErrors
+	summary.RejectedTransactions += result.Stats.TransactionsRejected
+
+	if drift := result.SchemaDrift; drift != nil {
+		summary.SchemaDrifts = append(summary.SchemaDrifts, utils.SchemaDriftInfo{
+			InputFile:       result.FilePath,
+			Department:      result.Department,
+			Template:        result.Template,
+			Changes:         drift.Changes(),
+			PreviousHeaders: drift.Previous,
+			CurrentHeaders:  drift.Current,
+		})
+	}
+
+	var breakdown validation.Breakdown
+	if result.Validation != nil {
+		breakdown = result.Validation.Breakdown()
+		if len(breakdown.ByRule) > 0 && summary.ValidationErrorsByRule == nil {
+			summary.ValidationErrorsByRule = make(map[string]int)
+			summary.ValidationErrorsByField = make(map[string]int)
+		}
+		for _, count := range breakdown.ByRule {
+			summary.ValidationErrorsByRule[count.Key] += count.Count
+		}
+		for _, count := range breakdown.ByField {
+			summary.ValidationErrorsByField[count.Key] += count.Count
+		}
+	}
+
+	switch {
+	case result.Skipped:
+		summary.SkippedFiles++
+
+	case result.Success:
+		summary.SuccessfulFiles++
+		summary.ProcessedFiles = append(summary.ProcessedFiles, utils.ProcessedFileInfo{
+			InputFile:    result.FilePath,
+			OutputFile:   result.OutputFile,
+			Rows:         result.Stats.RowsProcessed,
+			Transactions: result.Stats.TransactionsCreated,
+			LineItems:    result.Stats.LineItemsCreated,
+			ProcessTime:  result.Stats.ProcessingTime,
+
+			RejectedTransactions: result.Stats.TransactionsRejected,
+			RejectedFiles:        result.RejectedFiles,
+			SuppressedErrors:     suppressedErrors(result),
+		})
+
+	default:
+		summary.FailedFiles++
+		errorType := "processing"
+		if errors.Is(result.Error, ErrValidationFailed) {
+			errorType = "validation"
+		}
+		failed := utils.FailedFileInfo{
+			InputFile:    result.FilePath,
+			ErrorMessage: result.Error.Error(),
+			ErrorType:    errorType,
+		}
+		for _, count := range breakdown.ByTransactionRange {
+			failed.ErrorsByTransaction = append(failed.ErrorsByTransaction, utils.ErrorCount{Key: count.Key, Count: count.Count})
+		}
+		if result.Validation != nil {
+			for _, group := range validation.GroupErrors(result.Validation.Errors, ErrorSampleRows) {
+				failed.ErrorGroups = append(failed.ErrorGroups, utils.ErrorGroupInfo{
+					Code:       group.First.Code,
+					Field:      group.First.Field,
+					Message:    group.First.Message,
+					Severity:   group.First.Severity,
+					Count:      group.Count,
+					SampleRows: group.SampleRows,
+				})
+			}
+		}
+		summary.FailedFilesList = append(summary.FailedFilesList, failed)
+	}
+}
+
+// suppressedErrors returns the suppressed validation errors of a file, with
+// their justifications, for the run summary.
+func suppressedErrors(result Result) string {
+	if result.Validation == nil {
+		return ""
+	}
+	return validation.FormatSuppressed(result.Validation.Suppressed)
+}
@@ -0,0 +1,111 @@
+// =============================================================================
+// CSV to XML Converter - Provenance Output
+// =============================================================================
+//
+// Audit requests ask where a value in a delivered XML file came from. With
+// provenance enabled, each delivered output file gets a provenance file
+// that traces every XML element back to its source (see
+// xmlwriter.Provenance):
+//
+//   provenance:
+//     enabled: true
+//     output_dir: ./provenance
+//
+//   element,value,kind,source_file,row,column,transformations
+//   /cashbook/transaction[1]/lineItem[2]/PolicyNumber,A000123,csv,claims.csv,3,POLICY_NO,"pad_left: ""123"" -> ""000123""; prepend_string: ""000123"" -> ""A000123"""
+//   /cashbook/transaction[1]/SourceSystem,LEGACY,static,,,,
+//
+// Only transformations that changed the value are listed. The values of
+// sensitive fields are masked. The file is written once the output is
+// delivered, and is never delivered itself.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+)
+
+// ProvenanceFileSuffix is appended to the output file name (without its
+// extension) to name the provenance file.
+const ProvenanceFileSuffix = ".provenance.csv"
+
+// traceTransformation records a transformation that changed a field of a
+// line item, if provenance is enabled.
+func (c *Converter) traceTransformation(lineItem *LineItem, field, action, before, after string) {
+	if !c.deptConfig.Provenance.Enabled {
+		return
+	}
+	if lineItem.Transformations == nil {
+		lineItem.Transformations = make(map[string][]xmlwriter.Transformation)
+	}
+	lineItem.Transformations[field] = append(lineItem.Transformations[field],
+		xmlwriter.Transformation{Action: action, Before: before, After: after})
+}
+
+// writeProvenance writes the provenance file of an output document.
+//
+// PARAMETERS:
+//   - out: The written document, generated with provenance.
+//
+// RETURNS:
+//   - The path to the provenance file.
+//   - An error if the file cannot be written.
+func (c *Converter) writeProvenance(out *documentOutput) (string, error) {
+	provenance := out.options.Provenance
+	if provenance == nil {
+		return "", fmt.Errorf("%s was generated without provenance", out.name)
+	}
+	c.maskProvenance(provenance)
+
+	outputDir := c.deptConfig.Provenance.OutputDir
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create provenance directory: %w", err)
+	}
+
+	base := strings.TrimSuffix(out.name, filepath.Ext(out.name))
+	provenancePath := filepath.Join(outputDir, base+ProvenanceFileSuffix)
+	file, err := os.Create(provenancePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create provenance file: %w", err)
+	}
+	if err := provenance.WriteCSV(file); err != nil {
+		file.Close()
+		os.Remove(provenancePath)
+		return "", fmt.Errorf("failed to write provenance file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(provenancePath)
+		return "", fmt.Errorf("failed to write provenance file: %w", err)
+	}
+
+	return provenancePath, nil
+}
+
+// maskProvenance masks the values of sensitive fields in the provenance
+// entries, including the values before and after each transformation.
+func (c *Converter) maskProvenance(provenance *xmlwriter.Provenance) {
+	if c.masker == nil {
+		return
+	}
+	for i := range provenance.Entries {
+		entry := &provenance.Entries[i]
+		if entry.Column == "" {
+			continue
+		}
+		entry.Value = c.masker.Value(entry.Column, entry.Value)
+		steps := make([]xmlwriter.Transformation, len(entry.Transformations))
+		for j, step := range entry.Transformations {
+			step.Before = c.masker.Value(entry.Column, step.Before)
+			step.After = c.masker.Value(entry.Column, step.After)
+			steps[j] = step
+		}
+		entry.Transformations = steps
+	}
+}
@@ -0,0 +1,193 @@
+// =============================================================================
+// CSV to XML Converter - Rejected Transactions
+// =============================================================================
+//
+// By default, a single invalid transaction fails the whole file (or, with
+// continue_on_error, is converted along with the valid ones). When a
+// department enables rejected_transactions, the failing transactions are
+// isolated instead:
+//
+//   rejected_transactions:
+//     enabled: true
+//     output_dir: ./rejected
+//     format: csv   # csv | xml | both
+//
+//   1. Every validation error is attributed to its transaction.
+//   2. The failing transactions are written to the rejected directory: every
+//      row of them in the fix-up format (see fixup.go), and/or the
+//      transactions as XML.
+//   3. The valid transactions are converted as usual, and the file succeeds
+//      with the counts of accepted and rejected transactions.
+//
+// The file fails as before if every transaction fails, if an error does not
+// belong to a transaction (e.g., a duplicate row under the "error" policy),
+// if there were more errors than error_limits lists, or if the rejected file
+// cannot be written.
+//
+// A rejected CSV is named like a fix-up file. Once corrected, it can be
+// dropped into the input directory and is converted on its own.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/csvparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+)
+
+// RejectedFileSuffix is appended to the input file name (without its
+// extension) to name the rejected XML file.
+const RejectedFileSuffix = ".rejected.xml"
+
+// rejectTransactions isolates the transactions with validation errors and
+// writes them to the rejected directory.
+//
+// PARAMETERS:
+//   - csvData: The parsed CSV data with the original (pre-transformation) values.
+//   - transactions: The transformed transactions.
+//   - errors: The validation errors.
+//   - result: The result to record the rejected files and counts in.
+//
+// RETURNS:
+//   - The valid transactions.
+//   - false if the errors cannot be isolated and the file must fail.
+func (c *Converter) rejectTransactions(csvData *csvparser.CSVData, transactions []Transaction, errors []*validation.ValidationError, result *Result) ([]Transaction, bool) {
+	if result.Validation.Truncated || len(result.Validation.Coalesced) > 0 {
+		c.logger.Info("Cannot reject single transactions: not every validation error was listed (see error_limits)")
+		return nil, false
+	}
+
+	accepted, rejected, err := splitRejected(transactions, errors)
+	if err != nil {
+		c.logger.Info("Cannot reject single transactions: %v", err)
+		return nil, false
+	}
+	if len(accepted) == 0 {
+		c.logger.Info("Every transaction failed validation; nothing to convert")
+		return nil, false
+	}
+
+	files, err := c.writeRejected(csvData, rejected, errors)
+	if err != nil {
+		c.logger.Warn("Failed to write rejected transactions: %v", err)
+		return nil, false
+	}
+
+	result.RejectedFiles = files
+	result.Stats.TransactionsRejected = len(rejected)
+	result.Stats.TransactionsCreated = len(accepted)
+	result.Stats.LineItemsCreated = 0
+	for _, transaction := range accepted {
+		result.Stats.LineItemsCreated += len(transaction.LineItems)
+	}
+	for _, transaction := range rejected {
+		result.Stats.RowsRejected += len(transaction.LineItems)
+		if transaction.Row > 0 {
+			result.Stats.RowsRejected++
+		}
+	}
+
+	c.logger.Info("Rejected %d of %d transactions (%d rows) to: %s",
+		len(rejected), len(transactions), result.Stats.RowsRejected, strings.Join(files, ", "))
+	return accepted, true
+}
+
+// splitRejected separates the transactions with validation errors from the
+// valid ones. Errors without a transaction ID are attributed by row number.
+//
+// RETURNS:
+//   - The valid and the failing transactions, in file order.
+//   - An error if a validation error does not belong to a transaction.
+func splitRejected(transactions []Transaction, errors []*validation.ValidationError) ([]Transaction, []Transaction, error) {
+	byRow := make(map[int]int)
+	for _, transaction := range transactions {
+		for _, item := range transaction.LineItems {
+			byRow[item.OriginalRowNumber] = transaction.ID
+		}
+	}
+
+	failing := make(map[int]bool)
+	for _, ve := range errors {
+		id := ve.TransactionID
+		if id == 0 && ve.RowNumber > 0 {
+			id = byRow[ve.RowNumber]
+		}
+		if id == 0 {
+			return nil, nil, fmt.Errorf("error is not tied to a transaction: %s", ve.Error())
+		}
+		failing[id] = true
+	}
+
+	var accepted, rejected []Transaction
+	for _, transaction := range transactions {
+		if failing[transaction.ID] {
+			rejected = append(rejected, transaction)
+		} else {
+			accepted = append(accepted, transaction)
+		}
+	}
+	return accepted, rejected, nil
+}
+
+// writeRejected writes the rejected transactions in the configured formats.
+//
+// RETURNS:
+//   - The paths of the files written.
+//   - An error if a file cannot be written.
+func (c *Converter) writeRejected(csvData *csvparser.CSVData, rejected []Transaction, errors []*validation.ValidationError) ([]string, error) {
+	settings := c.deptConfig.RejectedTransactions
+	base := strings.TrimSuffix(filepath.Base(c.csvPath), filepath.Ext(c.csvPath))
+	var files []string
+
+	if settings.Format == "csv" || settings.Format == "both" {
+		rows := make(map[int]bool)
+		for _, transaction := range rejected {
+			for _, item := range transaction.LineItems {
+				rows[item.OriginalRowNumber] = true
+			}
+			if transaction.Row > 0 {
+				rows[transaction.Row] = true
+			}
+		}
+
+		path := filepath.Join(settings.OutputDir, filepath.Base(FixupPathFor(c.csvPath)))
+		written, err := writeFixupRows(path, csvData, errors, rows)
+		if err != nil {
+			return files, err
+		}
+		if written != "" {
+			files = append(files, written)
+		}
+	}
+
+	if settings.Format == "xml" || settings.Format == "both" {
+		comment := fmt.Sprintf("Rejected transactions of %s: %d validation error(s)", filepath.Base(c.csvPath), len(errors))
+		options, err := c.reviewOptions(comment)
+		if err != nil {
+			return files, err
+		}
+
+		xmlDoc, err := xmlwriter.GenerateWithOptions(convertToXMLWriterTransactions(c.maskTransactions(rejected)), c.schema, c.deptConfig, options)
+		if err != nil {
+			return files, fmt.Errorf("failed to generate rejected XML: %w", err)
+		}
+
+		if err := os.MkdirAll(settings.OutputDir, 0755); err != nil {
+			return files, fmt.Errorf("failed to create rejected directory: %w", err)
+		}
+		path := filepath.Join(settings.OutputDir, base+RejectedFileSuffix)
+		if err := os.WriteFile(path, xmlDoc, 0644); err != nil {
+			return files, fmt.Errorf("failed to write rejected XML: %w", err)
+		}
+		files = append(files, path)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,261 @@
+// =============================================================================
+// CSV to XML Converter - Reprocessed Input Files
+// =============================================================================
+//
+// An input file that is dropped again (a re-sent export, a copy restored
+// from the archive) would normally be converted to a second output file with
+// a new name, and the target system would post it twice. The department's
+// de-duplication settings decide what happens instead:
+//
+//   deduplication:
+//     reprocess: skip   # new | skip | overwrite | version
+//
+// Input files are identified by the SHA-256 checksum of their content, so a
+// renamed copy is recognized too. Every converted file is recorded in the
+// state directory (state/converted/<DEPT>/<checksum>.json) with the name of
+// its output file:
+//
+//   - "skip" archives the repeated file without converting it.
+//   - "overwrite" converts it to the output file name it had before, so the
+//     new output replaces the previous one.
+//   - "version" converts it to the previous name with a version suffix
+//     (e.g., CLM_20240131_0001_v2.xml).
+//   - "new" (the default) converts it like any other file and records
+//     nothing.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+)
+
+// Reprocess policies (DeduplicationSettings.Reprocess).
+const (
+	ReprocessNew       = "new"
+	ReprocessSkip      = "skip"
+	ReprocessOverwrite = "overwrite"
+	ReprocessVersion   = "version"
+)
+
+// conversionRecord is the record of a converted input file.
+type conversionRecord struct {
+	// Input is the name of the input file when it was first converted.
+	Input string `json:"input"`
+
+	// SHA256 is the checksum of the input file.
+	SHA256 string `json:"sha256"`
+
+	// Output is the output file name of the first conversion.
+	Output string `json:"output"`
+
+	// Versions is the number of times the file was converted.
+	Versions int `json:"versions"`
+
+	// LastOutput and LastConverted describe the latest conversion.
+	LastOutput    string    `json:"last_output"`
+	LastConverted time.Time `json:"last_converted"`
+}
+
+// reprocessPolicy returns the department's reprocess policy.
+func (c *Converter) reprocessPolicy() string {
+	if c.deptConfig.Deduplication.Reprocess == "" {
+		return ReprocessNew
+	}
+	return c.deptConfig.Deduplication.Reprocess
+}
+
+// conversionRecordPath returns the record file of an input checksum.
+func (c *Converter) conversionRecordPath(checksum string) string {
+	return filepath.Join(c.mainConfig.StateDir, "converted", c.deptConfig.DepartmentCode, checksum+".json")
+}
+
+// checkReprocess looks up the input file's record and applies the reprocess
+// policy. Under the "new" policy, it does nothing.
+//
+// PARAMETERS:
+//   - result: The result, completed if the file is not to be converted.
+//
+// RETURNS:
+//   - A function that releases the lock held on the input's record; it
+//     must be called when the conversion is complete.
+//   - true if the file is not to be converted: it was skipped, or its
+//     record cannot be read.
+func (c *Converter) checkReprocess(result *Result) (func(), bool) {
+	release := func() {}
+	if c.reprocessPolicy() == ReprocessNew {
+		return release, false
+	}
+
+	checksum, err := fileChecksum(c.csvPath)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to identify input file: %w", err)
+		return release, true
+	}
+	c.checksum = checksum
+
+	// Identical copies of a file may be converted at the same time; the
+	// second waits for the next run, when the first one is recorded.
+	path := c.conversionRecordPath(checksum)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		result.Error = fmt.Errorf("failed to create state directory: %w", err)
+		return release, true
+	}
+	lock, err := utils.AcquireLock(path+utils.LockSuffix, c.mainConfig.LockStaleAfter)
+	if err != nil {
+		result.Error = fmt.Errorf("an identical file is being converted: %w", err)
+		result.Skipped = errors.Is(err, utils.ErrLocked)
+		return release, true
+	}
+	release = func() { lock.Release() }
+
+	record, err := readConversionRecord(path)
+	if err != nil {
+		result.Error = err
+		return release, true
+	}
+	if record == nil {
+		return release, false
+	}
+	c.previous = record
+
+	switch c.reprocessPolicy() {
+	case ReprocessSkip:
+		result.Skipped = true
+		result.Error = fmt.Errorf("already converted to %s on %s; archived without converting",
+			record.LastOutput, record.LastConverted.Format("2006-01-02 15:04"))
+		if err := c.archiveInputs(); err != nil {
+			c.logger.Warn("Failed to archive files: %v", err)
+		}
+		c.logger.Info("Skipped %s: identical to %s, already converted to %s",
+			filepath.Base(c.csvPath), record.Input, record.LastOutput)
+		return release, true
+
+	case ReprocessOverwrite:
+		c.logger.Info("%s was converted before; replacing %s", filepath.Base(c.csvPath), record.Output)
+
+	case ReprocessVersion:
+		c.logger.Info("%s was converted before (to %s); writing version %d",
+			filepath.Base(c.csvPath), record.LastOutput, record.Versions+1)
+	}
+	return release, false
+}
+
+// reprocessedFileName returns the output file name of a file that was
+// converted before, or false if the file gets a new name.
+func (c *Converter) reprocessedFileName() (string, bool) {
+	if c.previous == nil {
+		return "", false
+	}
+
+	switch c.reprocessPolicy() {
+	case ReprocessOverwrite:
+		return c.previous.Output, true
+	case ReprocessVersion:
+		ext := filepath.Ext(c.previous.Output)
+		base := strings.TrimSuffix(c.previous.Output, ext)
+		return fmt.Sprintf("%s_v%d%s", base, c.previous.Versions+1, ext), true
+	}
+	return "", false
+}
+
+// recordConversion records the conversion of the input file after a
+// successful run. A failure is logged: it only affects the next time the
+// same file is dropped.
+//
+// PARAMETERS:
+//   - outputName: The name of the XML file written.
+func (c *Converter) recordConversion(outputName string) {
+	if c.checksum == "" {
+		return
+	}
+
+	record := conversionRecord{
+		Input:  filepath.Base(c.csvPath),
+		SHA256: c.checksum,
+		Output: outputName,
+	}
+	if c.previous != nil {
+		record = *c.previous
+	}
+	record.Versions++
+	record.LastOutput = outputName
+	record.LastConverted = time.Now()
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err == nil {
+		err = writeStateFile(c.conversionRecordPath(c.checksum), append(data, '\n'))
+	}
+	if err != nil {
+		c.logger.Warn("Failed to record conversion of %s: %v", filepath.Base(c.csvPath), err)
+	}
+}
+
+// readConversionRecord reads a record, or returns nil if there is none.
+func readConversionRecord(path string) (*conversionRecord, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversion record: %w", err)
+	}
+
+	var record conversionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to read conversion record %s: %w", path, err)
+	}
+	return &record, nil
+}
+
+// fileChecksum returns the hex SHA-256 checksum of a file.
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeStateFile replaces a file in the state directory atomically. Files
+// may be written at the same time by converters of one department, so each
+// writes its own temporary file.
+func writeStateFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
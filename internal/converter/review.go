@@ -0,0 +1,130 @@
+// =============================================================================
+// CSV to XML Converter - Review Output
+// =============================================================================
+//
+// Validation errors name a row and a field, which reviewers then look up in
+// the CSV. With review output enabled, a file with validation errors also
+// gets a review variant of its XML, with each error as a comment before the
+// offending element:
+//
+//   review_output:
+//     enabled: true
+//     output_dir: ./review
+//
+//   <lineItem n="3">
+//     <PolicyNumber>P3</PolicyNumber>
+//     <!-- VAL: [VAL-LEN-001] Value exceeds maximum length of 10 characters (actual: 16) (row 4) -->
+//     <PayeeName>Bob Bobberson Jr</PayeeName>
+//   </lineItem>
+//
+// The review file contains every transaction, including rejected ones, and
+// is written whether the file fails or not. It is never delivered, and the
+// output file itself stays free of comments.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+)
+
+// ReviewFileSuffix is appended to the input file name (without its
+// extension) to name the review file.
+const ReviewFileSuffix = ".review.xml"
+
+// writeReview writes the review variant of the XML.
+//
+// PARAMETERS:
+//   - transactions: The transformed transactions.
+//   - errors: The validation errors to annotate.
+//
+// RETURNS:
+//   - The path to the review file.
+//   - An error if the file cannot be generated or written.
+func (c *Converter) writeReview(transactions []Transaction, errors []*validation.ValidationError) (string, error) {
+	annotations, unplaced := reviewAnnotations(errors)
+
+	comment := fmt.Sprintf("Review of %s: %d validation error(s)", filepath.Base(c.csvPath), len(errors))
+	options, err := c.reviewOptions(comment)
+	if err != nil {
+		return "", err
+	}
+	options.Annotations = annotations
+
+	// Errors that belong to no element are listed at the top.
+	for _, message := range unplaced {
+		options.Comment += "\n  " + message
+	}
+
+	xmlDoc, err := xmlwriter.GenerateWithOptions(convertToXMLWriterTransactions(c.maskTransactions(transactions)), c.schema, c.deptConfig, options)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate review XML: %w", err)
+	}
+
+	outputDir := c.deptConfig.ReviewOutput.OutputDir
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create review directory: %w", err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(c.csvPath), filepath.Ext(c.csvPath))
+	reviewPath := filepath.Join(outputDir, base+ReviewFileSuffix)
+	if err := os.WriteFile(reviewPath, xmlDoc, 0644); err != nil {
+		return "", fmt.Errorf("failed to write review file: %w", err)
+	}
+
+	return reviewPath, nil
+}
+
+// reviewOptions returns the generation options of XML documents that are
+// for review only (review and rejected files). They have the file's
+// placeholder values but no sequence number, document header, or cashbook
+// values: those may not be computable from invalid values, and a review
+// must not use up a sequence number.
+func (c *Converter) reviewOptions(comment string) (xmlwriter.GenerateOptions, error) {
+	options := xmlwriter.DepartmentOptions(c.deptConfig.XMLOutput)
+	options.Comment = comment
+
+	values, err := c.placeholderValues(false)
+	if err != nil {
+		return options, err
+	}
+	options.Placeholders = values
+	return options, nil
+}
+
+// reviewAnnotations turns validation errors into review comments.
+//
+// RETURNS:
+//   - The comments by field location.
+//   - The comments of errors that belong to no transaction.
+func reviewAnnotations(errors []*validation.ValidationError) (xmlwriter.Annotations, []string) {
+	annotations := make(xmlwriter.Annotations)
+	var unplaced []string
+
+	for _, ve := range errors {
+		prefix := "VAL"
+		if ve.Severity == "warning" {
+			prefix = "VAL warning"
+		}
+		message := fmt.Sprintf("%s: [%s] %s", prefix, ve.Code, ve.Message)
+		if ve.RowNumber > 0 {
+			message += fmt.Sprintf(" (row %d)", ve.RowNumber)
+		}
+
+		if ve.TransactionID == 0 {
+			unplaced = append(unplaced, message)
+			continue
+		}
+		location := xmlwriter.FieldLocation{TransactionID: ve.TransactionID, LineItemID: ve.LineItemID, Field: ve.Field}
+		annotations[location] = append(annotations[location], message)
+	}
+
+	return annotations, unplaced
+}
@@ -0,0 +1,120 @@
+// =============================================================================
+// CSV to XML Converter - Row Pre-sort
+// =============================================================================
+//
+// Rows are grouped into transactions in file order. Some exports interleave
+// the rows of different checks; sorting them first keeps every transaction
+// contiguous, which streaming conversion will rely on.
+//
+// The sort is stable: rows with equal keys keep their order in the file.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/csvparser"
+)
+
+// sortRows sorts the rows by the department's pre_sort keys.
+//
+// PARAMETERS:
+//   - csvData: The parsed CSV data. Rows and RowNumbers are reordered.
+func (c *Converter) sortRows(csvData *csvparser.CSVData) {
+	keys := c.deptConfig.TransactionGrouping.PreSort
+	if len(keys) == 0 {
+		return
+	}
+
+	// Parse each row's key values once.
+	parsed := make([][]sortValue, len(csvData.Rows))
+	for i, row := range csvData.Rows {
+		parsed[i] = make([]sortValue, len(keys))
+		for k, key := range keys {
+			parsed[i][k] = parseSortValue(row[key.Field], key)
+		}
+	}
+
+	order := make([]int, len(csvData.Rows))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		for k, key := range keys {
+			cmp := compareSortValues(parsed[order[a]][k], parsed[order[b]][k])
+			if cmp == 0 {
+				continue
+			}
+			// Unparseable values stay last in both directions.
+			if key.Order == "desc" && parsed[order[a]][k].valid && parsed[order[b]][k].valid {
+				cmp = -cmp
+			}
+			return cmp < 0
+		}
+		return false
+	})
+
+	rows := make([]map[string]string, len(order))
+	rowNumbers := make([]int, len(order))
+	for i, index := range order {
+		rows[i] = csvData.Rows[index]
+		rowNumbers[i] = rowNumberAt(csvData, index)
+	}
+	csvData.Rows = rows
+	csvData.RowNumbers = rowNumbers
+}
+
+// sortValue is a parsed sort key value.
+type sortValue struct {
+	text    string
+	number  float64
+	numeric bool // compare number instead of text
+	valid   bool
+}
+
+// parseSortValue parses a value for comparison by the key's type. String
+// values are always valid; numbers and dates are valid if they parse.
+func parseSortValue(value string, key config.SortKey) sortValue {
+	value = strings.TrimSpace(value)
+	parsedValue := sortValue{text: value}
+
+	switch key.Type {
+	case "numeric":
+		number, err := strconv.ParseFloat(value, 64)
+		parsedValue.number, parsedValue.valid = number, err == nil
+		parsedValue.numeric = true
+	case "date":
+		t, err := time.Parse(key.Format, value)
+		parsedValue.number, parsedValue.valid = float64(t.Unix()), err == nil
+		parsedValue.numeric = true
+	default:
+		parsedValue.valid = true
+	}
+	return parsedValue
+}
+
+// compareSortValues returns -1, 0, or 1. Invalid values sort after valid
+// values and are compared as text among themselves.
+func compareSortValues(a, b sortValue) int {
+	switch {
+	case a.valid && !b.valid:
+		return -1
+	case !a.valid && b.valid:
+		return 1
+	case !a.valid || !a.numeric:
+		return strings.Compare(a.text, b.text)
+	case a.number == b.number:
+		return 0
+	case a.number < b.number:
+		return -1
+	default:
+		return 1
+	}
+}
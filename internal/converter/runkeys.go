@@ -0,0 +1,142 @@
+// =============================================================================
+// CSV to XML Converter - Transaction Keys Across the Files of a Run
+// =============================================================================
+//
+// A day's batch may span several CSV files. A transaction that appears in
+// two of them (e.g., a check exported twice) would be paid twice, although
+// each file is valid on its own. A department can require its transaction
+// keys to be unique across the files of a run:
+//
+//   transaction_grouping:
+//     group_by_field: CHECK_NUM
+//     unique_across_run: true
+//
+// Each file claims the group keys of its transactions when it is validated.
+// A key that another file of the run has claimed is a validation error
+// (VAL-DUP-002) that names both files, so the file fails or, with
+// rejected_transactions, the colliding transaction is rejected. Keys are
+// kept per department, and a file that fails gives its keys back.
+//
+// The run is a Processor run: one process command, or one scan of the
+// watch command. Files converted on their own are not checked. With
+// max_concurrency above 1, which of two colliding files fails depends on
+// which is validated first.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+)
+
+// runKeys holds the transaction keys claimed by the files of a run.
+type runKeys struct {
+	mu     sync.Mutex
+	claims map[string]keyClaim // by department code and group key
+}
+
+// keyClaim is the file, and its row, that claimed a transaction key.
+type keyClaim struct {
+	file string
+	row  int
+}
+
+// newRunKeys creates the key registry of a run.
+func newRunKeys() *runKeys {
+	return &runKeys{claims: make(map[string]keyClaim)}
+}
+
+// claim claims the keys of a file's transactions.
+//
+// PARAMETERS:
+//   - dept: The department code of the file.
+//   - file: The path to the file.
+//   - transactions: The transactions of the file.
+//
+// RETURNS:
+//   - For each transaction whose key another file has claimed, the claim,
+//     by transaction ID.
+func (r *runKeys) claim(dept, file string, transactions []Transaction) map[int]keyClaim {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	collisions := make(map[int]keyClaim)
+	for _, transaction := range transactions {
+		key := dept + "\x00" + transaction.GroupKey
+		claim, ok := r.claims[key]
+		if !ok {
+			r.claims[key] = keyClaim{file: file, row: transactionRow(transaction)}
+			continue
+		}
+		if claim.file != file {
+			collisions[transaction.ID] = claim
+		}
+	}
+	return collisions
+}
+
+// release gives back the keys a file has claimed.
+func (r *runKeys) release(file string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, claim := range r.claims {
+		if claim.file == file {
+			delete(r.claims, key)
+		}
+	}
+}
+
+// transactionRow returns the CSV row of a transaction's first line item,
+// or of the transaction itself if it has no line items.
+func transactionRow(transaction Transaction) int {
+	if len(transaction.LineItems) > 0 {
+		return transaction.LineItems[0].OriginalRowNumber
+	}
+	return transaction.Row
+}
+
+// checkRunKeys claims the keys of the transactions for the run, if the
+// department requires unique keys across the files of a run, and records
+// a validation error for each key another file has claimed.
+//
+// PARAMETERS:
+//   - transactions: The transactions to claim.
+//   - result: The validation result to record the collisions in.
+//
+// RETURNS:
+//   - false once the result is truncated (see ValidationResult.Record).
+func (c *Converter) checkRunKeys(transactions []Transaction, result *validation.ValidationResult) bool {
+	grouping := c.deptConfig.TransactionGrouping
+	if c.runKeys == nil || !grouping.UniqueAcrossRun {
+		return true
+	}
+
+	collisions := c.runKeys.claim(c.deptConfig.DepartmentCode, c.csvPath, transactions)
+	for _, transaction := range transactions {
+		claim, ok := collisions[transaction.ID]
+		if !ok {
+			continue
+		}
+		ve := &validation.ValidationError{
+			Severity: "error",
+			Field:    grouping.GroupByField,
+			Value:    transaction.GroupKey,
+			Rule:     "unique_across_run",
+			Code:     validation.CodeRunDuplicate,
+			Message: fmt.Sprintf("Transaction key is also used by %s (row %d) in this run",
+				filepath.Base(claim.file), claim.row),
+			TransactionID: transaction.ID,
+			RowNumber:     transactionRow(transaction),
+		}
+		if !result.Record(ve) {
+			return false
+		}
+	}
+	return true
+}
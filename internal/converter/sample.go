@@ -0,0 +1,526 @@
+// =============================================================================
+// CSV to XML Converter - Sample Data Generation
+// =============================================================================
+//
+// Generates a CSV file of synthetic rows from a template, for load testing
+// and training. Every value is generated for its field's rules - data type,
+// max length, requiredness, pattern, fixed value - and, with a department,
+// from the keys of the field's lookup table. Each value is checked the way
+// a conversion would check it: transformed with the department's
+// transformation rules and validated against the template. A field for
+// which no valid value is found within a few attempts is reported.
+//
+// Rows are grouped into transactions of one to MaxLineItems rows when the
+// department groups rows: the rows of a transaction share the group key and
+// the transaction fields, and all rows share the cashbook fields.
+//
+// A share of the rows can be made invalid on purpose: one field of each is
+// corrupted (emptied, made too long, given a value of the wrong type or not
+// matching the pattern) so that it fails validation, and the row and rule
+// code are reported.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+)
+
+// sampleAttempts is the number of values tried for a field before giving up.
+const sampleAttempts = 50
+
+// sampleWords are used for "string" fields.
+var sampleWords = []string{
+	"Payment", "Refund", "Claim", "Premium", "Invoice", "Adjustment", "Office",
+	"North", "River", "Services", "Medical", "Supply", "Central", "Group",
+}
+
+// SampleOptions controls the sample generation. Zero values use the
+// defaults.
+type SampleOptions struct {
+	// Rows is the number of rows.
+	// Default: 100
+	Rows int
+
+	// InvalidPercent is the share of rows, in percent, made invalid on
+	// purpose.
+	// Default: 0
+	InvalidPercent float64
+
+	// MaxLineItems is the largest number of rows of a transaction.
+	// Default: 5
+	MaxLineItems int
+
+	// Seed makes the generation repeatable: the same seed, template, and
+	// department give the same rows.
+	// Default: 0, a seed from the clock
+	Seed int64
+
+	// Department supplies the lookup tables, transformation rules,
+	// transaction grouping, and delimiter. Nil for the template alone.
+	Department *config.DepartmentConfig
+}
+
+// SampleResult describes a generated sample.
+type SampleResult struct {
+	Rows         int
+	Transactions int
+
+	// InvalidRows are the rows made invalid, in order.
+	InvalidRows []InvalidSampleRow
+
+	// Unsatisfied are the fields for which no valid value was found; their
+	// values may fail validation.
+	Unsatisfied []string
+}
+
+// InvalidSampleRow is a row made invalid on purpose.
+type InvalidSampleRow struct {
+	// Line is the line of the row in the file; the header is line 1.
+	Line int
+
+	// Field is the corrupted column, and Code the rule it fails.
+	Field string
+	Code  string
+}
+
+// sampleGenerator holds the state of a sample generation.
+type sampleGenerator struct {
+	schema      *xlsxparser.Schema
+	options     SampleOptions
+	rng         *rand.Rand
+	validator   *validation.Validator
+	transformer *Transformer
+	lookups     map[string][]string
+	patterns    map[string]*syntax.Regexp
+	unsatisfied map[string]bool
+}
+
+// GenerateSample writes a CSV file of synthetic rows for a template.
+//
+// PARAMETERS:
+//   - w: The output.
+//   - schema: The parsed template.
+//   - options: The generation options.
+//
+// RETURNS:
+//   - What was generated.
+//   - An error if the CSV cannot be written.
+func GenerateSample(w io.Writer, schema *xlsxparser.Schema, options SampleOptions) (*SampleResult, error) {
+	if options.Rows <= 0 {
+		options.Rows = 100
+	}
+	if options.MaxLineItems <= 0 {
+		options.MaxLineItems = 5
+	}
+	if options.Seed == 0 {
+		options.Seed = time.Now().UnixNano()
+	}
+
+	g := &sampleGenerator{
+		schema:      schema,
+		options:     options,
+		rng:         rand.New(rand.NewSource(options.Seed)),
+		validator:   validation.NewValidator(schema),
+		transformer: NewTransformer(nil),
+		lookups:     make(map[string][]string),
+		patterns:    make(map[string]*syntax.Regexp),
+		unsatisfied: make(map[string]bool),
+	}
+
+	writer := csv.NewWriter(w)
+	groupBy := ""
+	if dept := options.Department; dept != nil {
+		g.transformer = NewTransformer(dept.TransformationRules)
+		for _, rule := range dept.TransformationRules {
+			for _, action := range rule.Actions {
+				if (action.Type == "lookup" || action.Type == "lookup_with_default") && len(action.LookupTable) > 0 {
+					keys := make([]string, 0, len(action.LookupTable))
+					for key := range action.LookupTable {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					g.lookups[rule.Field] = keys
+				}
+			}
+		}
+		if delimiter := []rune(dept.CSVSettings.Delimiter); len(delimiter) == 1 {
+			writer.Comma = delimiter[0]
+		}
+		groupBy = dept.TransactionGrouping.GroupByField
+	}
+	for header, mapping := range schema.FieldMappings {
+		if mapping.Pattern == "" {
+			continue
+		}
+		if re, err := syntax.Parse(mapping.Pattern, syntax.Perl); err == nil {
+			g.patterns[header] = re
+		}
+	}
+
+	// The columns, in output order. A grouping column the template does not
+	// map is added.
+	var headers []string
+	headers = append(headers, schema.CashbookFields...)
+	headers = append(headers, schema.TransactionFields...)
+	headers = append(headers, schema.LineItemFields...)
+	if groupBy != "" && schema.FieldMappings[groupBy] == nil {
+		headers = append([]string{groupBy}, headers...)
+	}
+	if err := writer.Write(headers); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	result := &SampleResult{}
+	cashbook := make(map[string]string)
+	g.fill(cashbook, schema.CashbookFields)
+	usedKeys := make(map[string]bool)
+
+	for result.Rows < options.Rows {
+		// A transaction: its group key and fields, then its rows.
+		transaction := make(map[string]string)
+		g.fill(transaction, schema.TransactionFields)
+		if groupBy != "" {
+			key := transaction[groupBy]
+			for attempt := 0; (key == "" || usedKeys[key]) && attempt < sampleAttempts; attempt++ {
+				if mapping := schema.FieldMappings[groupBy]; mapping != nil {
+					key = g.validValue(groupBy, mapping, transaction)
+				} else {
+					key = strconv.Itoa(100000 + g.rng.Intn(900000))
+				}
+			}
+			usedKeys[key] = true
+			transaction[groupBy] = key
+		}
+		result.Transactions++
+
+		lines := 1
+		if groupBy != "" {
+			lines = 1 + g.rng.Intn(options.MaxLineItems)
+		}
+		for i := 0; i < lines && result.Rows < options.Rows; i++ {
+			row := make(map[string]string, len(headers))
+			for header, value := range cashbook {
+				row[header] = value
+			}
+			for header, value := range transaction {
+				row[header] = value
+			}
+			g.fill(row, schema.LineItemFields)
+			result.Rows++
+
+			if g.rng.Float64()*100 < options.InvalidPercent {
+				if field, code, ok := g.corrupt(row, groupBy); ok {
+					result.InvalidRows = append(result.InvalidRows, InvalidSampleRow{Line: result.Rows + 1, Field: field, Code: code})
+				}
+			}
+
+			record := make([]string, len(headers))
+			for i, header := range headers {
+				record[i] = row[header]
+			}
+			if err := writer.Write(record); err != nil {
+				return nil, fmt.Errorf("failed to write CSV: %w", err)
+			}
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	for field := range g.unsatisfied {
+		result.Unsatisfied = append(result.Unsatisfied, field)
+	}
+	sort.Strings(result.Unsatisfied)
+	return result, nil
+}
+
+// fill generates valid values for the fields of a row that it does not
+// have yet (e.g., the group key of a line item field).
+func (g *sampleGenerator) fill(row map[string]string, fields []string) {
+	for _, header := range fields {
+		if _, ok := row[header]; ok {
+			continue
+		}
+		mapping := g.schema.FieldMappings[header]
+
+		// Leave some optional fields empty.
+		if mapping.RequiredType == "optional" && mapping.FixedValue == "" && g.rng.Intn(5) == 0 {
+			row[header] = ""
+			continue
+		}
+		row[header] = g.validValue(header, mapping, row)
+	}
+}
+
+// validValue generates a value of a field that passes validation after the
+// transformation rules, or records the field as unsatisfied.
+func (g *sampleGenerator) validValue(header string, mapping *xlsxparser.FieldMapping, row map[string]string) string {
+	var value string
+	for attempt := 0; attempt < sampleAttempts; attempt++ {
+		value = g.value(header, mapping)
+		if g.errorCode(header, mapping, value, row) == "" {
+			return value
+		}
+	}
+	g.unsatisfied[header] = true
+	return value
+}
+
+// value generates a candidate value of a field.
+func (g *sampleGenerator) value(header string, mapping *xlsxparser.FieldMapping) string {
+	if mapping.FixedValue != "" {
+		return mapping.FixedValue
+	}
+	if keys := g.lookups[header]; len(keys) > 0 {
+		return keys[g.rng.Intn(len(keys))]
+	}
+	if re := g.patterns[header]; re != nil {
+		var b strings.Builder
+		g.writeRegexp(&b, re)
+		return b.String()
+	}
+
+	limit := mapping.MaxLength
+	if limit <= 0 {
+		limit = 20
+	}
+	dataType := strings.ToLower(mapping.DataType)
+
+	switch {
+	case dataType == "numeric":
+		digits := 1 + g.rng.Intn(min(limit, 9))
+		return strconv.Itoa(g.rng.Intn(intPow10(digits)))
+
+	case strings.HasPrefix(dataType, "decimal"):
+		decimals := 2
+		if open := strings.Index(mapping.DataType, "("); open >= 0 {
+			if n, err := strconv.Atoi(strings.Trim(mapping.DataType[open:], "()")); err == nil {
+				decimals = n
+			}
+		}
+		amount := g.rng.Float64() * 10000
+		value := strconv.FormatFloat(amount, 'f', decimals, 64)
+		for len(value) > limit && amount >= 1 {
+			amount /= 10
+			value = strconv.FormatFloat(amount, 'f', decimals, 64)
+		}
+		return value
+
+	case strings.HasPrefix(dataType, "date"):
+		layout := "2006-01-02"
+		if open := strings.Index(mapping.DataType, "("); open >= 0 {
+			layout = strings.TrimSuffix(mapping.DataType[open+1:], ")")
+		}
+		day := time.Now().AddDate(0, 0, -g.rng.Intn(730))
+		return day.Format(layout)
+
+	case dataType == "boolean":
+		return []string{"Y", "N"}[g.rng.Intn(2)]
+
+	case dataType == "currency_code" || strings.HasPrefix(dataType, "country_code"):
+		codes := validation.CodeTableValues(dataType)
+		return codes[g.rng.Intn(len(codes))]
+
+	case dataType == "alpha":
+		return g.characters(1+g.rng.Intn(min(limit, 12)), "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+
+	case dataType == "alphanumeric":
+		return g.characters(1+g.rng.Intn(min(limit, 12)), "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+
+	default:
+		value := sampleWords[g.rng.Intn(len(sampleWords))]
+		if g.rng.Intn(2) == 0 {
+			value += " " + sampleWords[g.rng.Intn(len(sampleWords))]
+		}
+		if len(value) > limit {
+			value = value[:limit]
+		}
+		return value
+	}
+}
+
+// corrupt makes one field of a row fail validation.
+//
+// RETURNS:
+//   - The field and the rule code it fails, and true; or false if no field
+//     could be made invalid.
+func (g *sampleGenerator) corrupt(row map[string]string, groupBy string) (string, string, bool) {
+	// Only line item fields: the others are shared by several rows.
+	candidates := g.schema.LineItemFields
+	if len(candidates) == 0 {
+		return "", "", false
+	}
+
+	for attempt := 0; attempt < sampleAttempts; attempt++ {
+		header := candidates[g.rng.Intn(len(candidates))]
+		if header == groupBy {
+			continue
+		}
+		mapping := g.schema.FieldMappings[header]
+
+		var options []string
+		if mapping.RequiredType == "required" && mapping.DefaultValue == "" && !mapping.Nillable {
+			options = append(options, "")
+		}
+		if mapping.MaxLength > 0 {
+			options = append(options, strings.Repeat("9", mapping.MaxLength+1+g.rng.Intn(5)))
+		}
+		if mapping.FixedValue != "" {
+			options = append(options, mapping.FixedValue+"X")
+		}
+		dataType := strings.ToLower(mapping.DataType)
+		switch {
+		case dataType == "numeric":
+			options = append(options, "12A4")
+		case strings.HasPrefix(dataType, "decimal"):
+			options = append(options, "1.2.3", "12.34567")
+		case strings.HasPrefix(dataType, "date"):
+			options = append(options, "2024-13-45", "31/31/2024")
+		case dataType == "alpha":
+			options = append(options, "AB12")
+		case dataType == "alphanumeric":
+			options = append(options, "AB-12!")
+		case dataType == "boolean":
+			options = append(options, "maybe")
+		case dataType == "currency_code" || strings.HasPrefix(dataType, "country_code"):
+			options = append(options, "US Dollar", "ZZZ")
+		}
+		if mapping.Pattern != "" {
+			options = append(options, "!!!")
+		}
+		if len(options) == 0 {
+			continue
+		}
+
+		value := options[g.rng.Intn(len(options))]
+		if code := g.errorCode(header, mapping, value, row); code != "" {
+			row[header] = value
+			return header, code, true
+		}
+	}
+	return "", "", false
+}
+
+// errorCode transforms and validates a value as a conversion would.
+//
+// RETURNS:
+//   - The code of the first error, or "" if the value is valid. A failed
+//     transformation is reported as "TRANSFORM".
+func (g *sampleGenerator) errorCode(header string, mapping *xlsxparser.FieldMapping, value string, row map[string]string) string {
+	fields := make(map[string]string, len(row)+1)
+	for key, v := range row {
+		fields[key] = v
+	}
+	fields[header] = value
+
+	transformed, err := g.transformer.Transform(header, value, fields)
+	if err != nil {
+		return "TRANSFORM"
+	}
+	for _, verr := range g.validator.ValidateField(transformed, mapping, &validation.Transaction{}, &validation.LineItem{Fields: fields}) {
+		if verr.Severity == "error" {
+			return verr.Code
+		}
+	}
+	return ""
+}
+
+// characters returns n random characters of a set.
+func (g *sampleGenerator) characters(n int, set string) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = set[g.rng.Intn(len(set))]
+	}
+	return string(b)
+}
+
+// writeRegexp writes a random string matching a parsed regular expression.
+// Unbounded repetitions are kept short.
+func (g *sampleGenerator) writeRegexp(b *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+
+	case syntax.OpCharClass:
+		b.WriteRune(g.classRune(re.Rune))
+
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte(byte('A' + g.rng.Intn(26)))
+
+	case syntax.OpCapture:
+		g.writeRegexp(b, re.Sub[0])
+
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			g.writeRegexp(b, sub)
+		}
+
+	case syntax.OpAlternate:
+		g.writeRegexp(b, re.Sub[g.rng.Intn(len(re.Sub))])
+
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		low, high := 0, 3
+		switch re.Op {
+		case syntax.OpPlus:
+			low = 1
+		case syntax.OpQuest:
+			high = 1
+		case syntax.OpRepeat:
+			low, high = re.Min, re.Max
+			if high < 0 {
+				high = low + 3
+			}
+		}
+		for i := low + g.rng.Intn(high-low+1); i > 0; i-- {
+			g.writeRegexp(b, re.Sub[0])
+		}
+	}
+	// Anchors, word boundaries, and empty matches write nothing.
+}
+
+// classRune returns a random rune of a character class, given as ranges
+// (lo, hi, lo, hi, ...), preferring printable ASCII.
+func (g *sampleGenerator) classRune(ranges []rune) rune {
+	var printable []rune
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := max(ranges[i], ' '+1), min(ranges[i+1], '~')
+		if lo <= hi {
+			printable = append(printable, lo, hi)
+		}
+	}
+	if len(printable) == 0 {
+		if len(ranges) == 0 {
+			return 'X'
+		}
+		return ranges[0]
+	}
+
+	pair := g.rng.Intn(len(printable)/2) * 2
+	lo, hi := printable[pair], printable[pair+1]
+	return lo + rune(g.rng.Intn(int(hi-lo)+1))
+}
+
+// intPow10 returns 10 to the power of n.
+func intPow10(n int) int {
+	result := 1
+	for ; n > 0; n-- {
+		result *= 10
+	}
+	return result
+}
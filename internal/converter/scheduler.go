@@ -0,0 +1,145 @@
+// =============================================================================
+// CSV to XML Converter - Fair File Scheduling
+// =============================================================================
+//
+// A run converts at most max_concurrency files at a time. The scheduler
+// decides which waiting file gets a free slot, so the departments of a run
+// share the slots instead of the first department's files taking all of
+// them:
+//
+//   - Each department's files wait in their own queue, by priority (see
+//     processing_priority) and then in the order the run lists them.
+//   - A free slot goes to the file with the highest priority that may
+//     start. Between departments with files of that priority, it goes to
+//     the department with the fewest running files relative to its
+//     concurrency.weight; ties go to the departments in turn.
+//   - A department never runs more than its concurrency.max_files files at
+//     a time, even if slots are free.
+//
+// A department with 500 small files therefore gets its share of the slots,
+// and another department's few large files start right away instead of
+// after the 500. A department alone in a run gets every slot (up to its
+// max_files). Priorities come first: payroll files with priority 10 start
+// before any expense report with priority 0, and lower-priority files only
+// take slots the higher-priority files cannot use.
+//
+// =============================================================================
+
+package converter
+
+// scheduledFile is a file waiting for a slot.
+type scheduledFile struct {
+	path       string
+	department string
+	priority   int
+}
+
+// departmentQueue holds the waiting files of one department, by
+// descending priority.
+type departmentQueue struct {
+	files   []scheduledFile
+	running int
+	limit   int
+	weight  int
+}
+
+// fileScheduler hands out the slots of a run. It is used by one goroutine.
+type fileScheduler struct {
+	free   int
+	queues map[string]*departmentQueue
+	order  []string
+	turn   int
+}
+
+// newFileScheduler creates a scheduler with a number of slots.
+func newFileScheduler(slots int) *fileScheduler {
+	if slots < 1 {
+		slots = 1
+	}
+	return &fileScheduler{free: slots, queues: make(map[string]*departmentQueue)}
+}
+
+// add queues a file of a department, after the department's files with
+// the same or a higher priority. limit and weight are the department's
+// concurrency settings (0 for no limit, and weight 1).
+func (s *fileScheduler) add(path, department string, priority, limit, weight int) {
+	queue := s.queues[department]
+	if queue == nil {
+		if weight < 1 {
+			weight = 1
+		}
+		queue = &departmentQueue{limit: limit, weight: weight}
+		s.queues[department] = queue
+		s.order = append(s.order, department)
+	}
+	i := len(queue.files)
+	for i > 0 && queue.files[i-1].priority < priority {
+		i--
+	}
+	file := scheduledFile{path: path, department: department, priority: priority}
+	queue.files = append(queue.files[:i], append([]scheduledFile{file}, queue.files[i:]...)...)
+}
+
+// next takes a free slot for the next file, if there is a free slot and a
+// file whose department may start another.
+//
+// RETURNS:
+//   - The file and true, or false if no file can be started now.
+func (s *fileScheduler) next() (scheduledFile, bool) {
+	if s.free == 0 {
+		return scheduledFile{}, false
+	}
+
+	// Of the departments whose next file has the highest priority, the one
+	// with the fewest running files per weight; departments are tried from
+	// the one after the last chosen, so ties take turns.
+	chosen := -1
+	for offset := 0; offset < len(s.order); offset++ {
+		i := (s.turn + offset) % len(s.order)
+		queue := s.queues[s.order[i]]
+		if len(queue.files) == 0 || (queue.limit > 0 && queue.running >= queue.limit) {
+			continue
+		}
+		if chosen < 0 {
+			chosen = i
+			continue
+		}
+		best := s.queues[s.order[chosen]]
+		switch {
+		case queue.files[0].priority != best.files[0].priority:
+			if queue.files[0].priority > best.files[0].priority {
+				chosen = i
+			}
+		case queue.running*best.weight < best.running*queue.weight:
+			chosen = i
+		}
+	}
+	if chosen < 0 {
+		return scheduledFile{}, false
+	}
+
+	queue := s.queues[s.order[chosen]]
+	file := queue.files[0]
+	queue.files = queue.files[1:]
+	queue.running++
+	s.free--
+	s.turn = (chosen + 1) % len(s.order)
+	return file, true
+}
+
+// done returns the slot of a finished file of a department.
+func (s *fileScheduler) done(department string) {
+	s.queues[department].running--
+	s.free++
+}
+
+// waiting returns the files that were not started, in queue order.
+func (s *fileScheduler) waiting() []string {
+	var files []string
+	for _, department := range s.order {
+		for _, file := range s.queues[department].files {
+			files = append(files, file.path)
+		}
+	}
+	return files
+}
@@ -0,0 +1,187 @@
+// =============================================================================
+// CSV to XML Converter - Input Schema Drift
+// =============================================================================
+//
+// The CSV headers of the last successful run of each department and template
+// are kept in the state directory. When a file's headers differ - a column
+// added, removed, renamed, or moved - a warning is logged and the change is
+// returned in the result for the run summary. Template mappings match
+// columns by name, so an unannounced upstream change otherwise shows up only
+// as empty or missing values in the XML.
+//
+// A column is taken as renamed when a removed header and an added header
+// were at the same position.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SchemaDrift describes how the headers of an input file differ from those
+// of the department's last successful run with the same template.
+type SchemaDrift struct {
+	// Previous and Current are the headers of the last successful run and of
+	// this file.
+	Previous []string
+	Current  []string
+
+	// Added and Removed are the headers only in Current and only in
+	// Previous, without the renamed ones.
+	Added   []string
+	Removed []string
+
+	// Renamed are the headers replaced by another at the same position.
+	Renamed []HeaderRename
+
+	// Reordered indicates that the common headers are in a different order.
+	Reordered bool
+}
+
+// HeaderRename is a header replaced by another at the same position.
+type HeaderRename struct {
+	From string
+	To   string
+}
+
+// Changes describes each change on one line, e.g. "added REF_NO",
+// "renamed POLICY_NO -> POLICY_NUMBER", or "columns reordered".
+func (d *SchemaDrift) Changes() []string {
+	var changes []string
+	for _, header := range d.Added {
+		changes = append(changes, "added "+header)
+	}
+	for _, header := range d.Removed {
+		changes = append(changes, "removed "+header)
+	}
+	for _, rename := range d.Renamed {
+		changes = append(changes, fmt.Sprintf("renamed %s -> %s", rename.From, rename.To))
+	}
+	if d.Reordered {
+		changes = append(changes, "columns reordered")
+	}
+	return changes
+}
+
+// compareHeaders compares the headers of the last successful run with the
+// headers of a file.
+//
+// RETURNS:
+//   - The drift, or nil if the headers are the same.
+func compareHeaders(previous, current []string) *SchemaDrift {
+	if strings.Join(previous, "\x00") == strings.Join(current, "\x00") {
+		return nil
+	}
+
+	inPrevious := make(map[string]bool, len(previous))
+	for _, header := range previous {
+		inPrevious[header] = true
+	}
+	inCurrent := make(map[string]bool, len(current))
+	for _, header := range current {
+		inCurrent[header] = true
+	}
+
+	drift := &SchemaDrift{Previous: previous, Current: current}
+
+	// A removed header whose position holds an added header was renamed.
+	renamedTo := make(map[string]bool)
+	for i, header := range previous {
+		if inCurrent[header] {
+			continue
+		}
+		if i < len(current) && !inPrevious[current[i]] {
+			drift.Renamed = append(drift.Renamed, HeaderRename{From: header, To: current[i]})
+			renamedTo[current[i]] = true
+			continue
+		}
+		drift.Removed = append(drift.Removed, header)
+	}
+	for _, header := range current {
+		if !inPrevious[header] && !renamedTo[header] {
+			drift.Added = append(drift.Added, header)
+		}
+	}
+
+	// The headers both have, in the order of each.
+	var commonPrevious, commonCurrent []string
+	for _, header := range previous {
+		if inCurrent[header] {
+			commonPrevious = append(commonPrevious, header)
+		}
+	}
+	for _, header := range current {
+		if inPrevious[header] {
+			commonCurrent = append(commonCurrent, header)
+		}
+	}
+	drift.Reordered = strings.Join(commonPrevious, "\x00") != strings.Join(commonCurrent, "\x00")
+
+	// Duplicate headers can differ only in their count.
+	if len(drift.Changes()) == 0 {
+		drift.Reordered = true
+	}
+	return drift
+}
+
+// headersPath returns the state file holding the CSV headers of the
+// department's last successful run with the template,
+// e.g. "state/CLAIMS.payments.headers".
+func (c *Converter) headersPath() string {
+	name := c.templateName()
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return filepath.Join(c.mainConfig.StateDir, c.deptConfig.DepartmentCode+"."+name+".headers")
+}
+
+// checkSchemaDrift compares the headers of the file with those of the
+// department's last successful run with the template, and warns if they
+// differ.
+//
+// RETURNS:
+//   - The drift, or nil if the headers are the same or there was no
+//     successful run yet.
+func (c *Converter) checkSchemaDrift(headers []string) *SchemaDrift {
+	if c.templateName() == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.headersPath())
+	if err != nil {
+		// No successful run yet.
+		return nil
+	}
+	var previous []string
+	if err := json.Unmarshal(data, &previous); err != nil {
+		c.logger.Warn("Ignoring unreadable input headers of the last run (%s): %v", c.headersPath(), err)
+		return nil
+	}
+
+	drift := compareHeaders(previous, headers)
+	if drift != nil {
+		c.logger.Warn("SCHEMA DRIFT: the headers of %s differ from the last successful %s run with %s: %s",
+			filepath.Base(c.csvPath), c.deptConfig.DepartmentCode, c.templateName(), strings.Join(drift.Changes(), "; "))
+	}
+	return drift
+}
+
+// recordHeaders records the headers of the file after a successful run. A
+// failure is logged: it only affects the next run's drift check.
+func (c *Converter) recordHeaders(headers []string) {
+	if c.templateName() == "" {
+		return
+	}
+
+	data, err := json.Marshal(headers)
+	if err == nil {
+		err = writeStateFile(c.headersPath(), append(data, '\n'))
+	}
+	if err != nil {
+		c.logger.Warn("Failed to record input headers: %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+// =============================================================================
+// CSV to XML Converter - Template Selection
+// =============================================================================
+//
+// Some files mix transaction types, e.g., payment and receipt rows
+// distinguished by a TYPE column, and each type has its own template. With
+// a template selector, each row selects its template by the value of the
+// column:
+//
+//   template_selector:
+//     field: TYPE
+//     map: {P: payments.xlsx, R: receipts.xlsx}
+//     output: combined   # combined | separate
+//
+//   1. Rows are grouped into transactions as usual, but rows that select
+//      different templates never share a transaction.
+//   2. Each transaction is validated against its template, and its element
+//      is generated from its template.
+//   3. The transactions are written either to one document ("combined"),
+//      whose root element, cashbook fields, and header come from the file's
+//      template (template_mapping), or to one document per template
+//      ("separate"), named "<name>_<template>.xml".
+//
+// A row whose value is not in the map fails the file.
+//
+// Separate documents are generated, written, and protected before the
+// first is delivered, so a failure up to then leaves no output. If the
+// delivery of a later document fails, the earlier documents have been
+// delivered; the others are removed and the file fails.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/csvparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+)
+
+// selectTemplates returns the template selected by each row of the file.
+//
+// PARAMETERS:
+//   - csvData: The parsed CSV data.
+//
+// RETURNS:
+//   - The template of each row, parallel to csvData.Rows, or nil without a
+//     template selector.
+//   - An error if a row selects no template or a template cannot be parsed.
+func (c *Converter) selectTemplates(csvData *csvparser.CSVData) ([]*xlsxparser.Schema, error) {
+	selector := c.deptConfig.TemplateSelector
+	if !selector.Enabled() {
+		return nil, nil
+	}
+
+	schemas := make([]*xlsxparser.Schema, len(csvData.Rows))
+	for i, row := range csvData.Rows {
+		value := strings.TrimSpace(row[selector.Field])
+		template, ok := selector.Map[value]
+		if !ok {
+			return nil, fmt.Errorf("row %d: %s value %q selects no template", rowNumberAt(csvData, i), selector.Field, value)
+		}
+
+		schema, err := c.selectedTemplate(template)
+		if err != nil {
+			return nil, err
+		}
+		schemas[i] = schema
+	}
+	return schemas, nil
+}
+
+// selectedTemplate returns the schema of a template of the selector. Each
+// template is parsed once; the file's own template is not parsed again.
+func (c *Converter) selectedTemplate(template string) (*xlsxparser.Schema, error) {
+	templatePath := filepath.Join(c.mainConfig.TemplatesDir, template)
+	if c.schema != nil && c.schema.TemplateFile == templatePath {
+		return c.schema, nil
+	}
+	if schema, ok := c.selected[templatePath]; ok {
+		return schema, nil
+	}
+
+	schema, err := c.parseTemplate(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse selected template %s: %w", template, err)
+	}
+	if c.selected == nil {
+		c.selected = make(map[string]*xlsxparser.Schema)
+	}
+	c.selected[templatePath] = schema
+	return schema, nil
+}
+
+// transactionSchema returns the template of a transaction: the one its rows
+// selected, or the file's.
+func (c *Converter) transactionSchema(transaction Transaction) *xlsxparser.Schema {
+	if transaction.Schema != nil {
+		return transaction.Schema
+	}
+	return c.schema
+}
+
+// validateTransactions validates each transaction against its template.
+//
+// RETURNS:
+//   - The combined validation result.
+func (c *Converter) validateTransactions(transactions []Transaction) *validation.ValidationResult {
+	options := c.validationOptions()
+	if !c.deptConfig.TemplateSelector.Enabled() {
+		validator := validation.NewValidatorWithOptions(c.schema, options)
+		return validator.ValidateAll(convertToValidationTransactions(transactions))
+	}
+
+	result := validation.NewValidationResult(options)
+	validators := make(map[*xlsxparser.Schema]*validation.Validator)
+	for _, transaction := range transactions {
+		schema := c.transactionSchema(transaction)
+		validator, ok := validators[schema]
+		if !ok {
+			validator = validation.NewValidatorWithOptions(schema, options)
+			validators[schema] = validator
+		}
+
+		part := validator.ValidateAll(convertToValidationTransactions([]Transaction{transaction}))
+		if !result.Merge(part) {
+			break
+		}
+		if options.StopOnFirstError && part.ErrorCount > 0 {
+			break
+		}
+	}
+	return result
+}
+
+// =============================================================================
+// OUTPUT DOCUMENTS
+// =============================================================================
+
+// document is an XML document to write for the file.
+type document struct {
+	// key is appended to the output file name ("<name>_<key>.xml"), or is
+	// empty for the file's only document.
+	key string
+
+	// schema is the template of the document.
+	schema *xlsxparser.Schema
+
+	// transactions are the document's transactions, numbered from 1.
+	transactions []Transaction
+}
+
+// documents splits the transactions into the documents to write: one, or
+// one per template with a "separate" template selector.
+func (c *Converter) documents(transactions []Transaction) []document {
+	if !c.deptConfig.TemplateSelector.Enabled() || c.deptConfig.TemplateSelector.Output != "separate" {
+		return []document{{schema: c.schema, transactions: transactions}}
+	}
+
+	var documents []document
+	index := make(map[*xlsxparser.Schema]int)
+	for _, transaction := range transactions {
+		schema := c.transactionSchema(transaction)
+		i, ok := index[schema]
+		if !ok {
+			i = len(documents)
+			index[schema] = i
+			documents = append(documents, document{key: documentKey(schema), schema: schema})
+		}
+		documents[i].transactions = append(documents[i].transactions, transaction)
+	}
+
+	// A file without rows still gets its (empty) document.
+	if len(documents) == 0 {
+		documents = append(documents, document{key: documentKey(c.schema), schema: c.schema})
+	}
+
+	for i := range documents {
+		documents[i].transactions = renumberTransactions(documents[i].transactions)
+	}
+	return documents
+}
+
+// documentKey returns the key of a separate document: its template's file
+// name without the extension.
+func documentKey(schema *xlsxparser.Schema) string {
+	name := filepath.Base(schema.TemplateFile)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// renumberTransactions returns copies of the transactions with transaction
+// and line item numbers from 1, as in a file of their own.
+func renumberTransactions(transactions []Transaction) []Transaction {
+	renumbered := make([]Transaction, len(transactions))
+	lineItemCounter := 1
+	for i, transaction := range transactions {
+		transaction.ID = i + 1
+		transaction.LineItems = append([]LineItem(nil), transaction.LineItems...)
+		for j := range transaction.LineItems {
+			transaction.LineItems[j].ID = lineItemCounter
+			lineItemCounter++
+		}
+		renumbered[i] = transaction
+	}
+	return renumbered
+}
+
+// forDocument returns the converter that generates and writes a document.
+// A separate document gets a copy of the converter with the document's
+// template. It shares the file's placeholder values, except that it
+// allocates its own sequence number.
+func (c *Converter) forDocument(doc document) *Converter {
+	if doc.key == "" {
+		return c
+	}
+
+	values, _ := c.placeholderValues(false)
+	dc := *c
+	dc.schema = doc.schema
+	dc.documentKey = doc.key
+	dc.signaturePath = ""
+	dc.placeholders = make(map[string]string, len(values))
+	for name, value := range values {
+		if name != "sequence" {
+			dc.placeholders[name] = value
+		}
+	}
+	dc.placeholders["template"] = dc.templateName()
+	dc.placeholders["template_version"] = dc.templateVersion()
+	return &dc
+}
+
+// documentFileName appends a separate document's key to an output file
+// name.
+func documentFileName(fileName, key string) string {
+	if key == "" {
+		return fileName
+	}
+	ext := filepath.Ext(fileName)
+	return strings.TrimSuffix(fileName, ext) + "_" + key + ext
+}
+
+// recordedFileName returns the output file name recorded for reprocessing
+// (see reprocess.go): the name without the document key, which
+// generateOutputFileName appends again.
+func (c *Converter) recordedFileName(fileName string) string {
+	if c.documentKey == "" {
+		return fileName
+	}
+	ext := filepath.Ext(fileName)
+	return strings.TrimSuffix(strings.TrimSuffix(fileName, ext), "_"+c.documentKey) + ext
+}
+
+// documentOutput is a document on its way to the output directory.
+type documentOutput struct {
+	// conv is the document's converter (see forDocument).
+	conv *Converter
+
+	// transactions, xmlTransactions, options, and xmlDoc are the document
+	// as generated (see generate).
+	transactions    []Transaction
+	xmlTransactions []xmlwriter.Transaction
+	options         xmlwriter.GenerateOptions
+	xmlDoc          []byte
+
+	// path is the output file, once written (and protected), and name is
+	// its name as written.
+	path string
+	name string
+
+	// plaintext is where a document that is encrypted with PGP is written
+	// until it is encrypted to path (see plaintextPath), or "".
+	plaintext string
+
+	// main is the main document of an additional output (see targets.go),
+	// or nil for a main document.
+	main *documentOutput
+}
+
+// plaintextPath returns where a document is written before PGP encrypts it
+// to its output path: a file in a new private temporary directory, so the
+// unencrypted document is never in the output directory, where the target
+// system could pick it up. Without encryption, it returns "".
+//
+// PARAMETERS:
+//   - outputPath: The document's output path.
+//
+// RETURNS:
+//   - The path to write the plaintext to, or "".
+//   - An error if the directory cannot be created.
+func (c *Converter) plaintextPath(outputPath string) (string, error) {
+	if !c.deptConfig.PGP.Encrypts() {
+		return "", nil
+	}
+	dir, err := os.MkdirTemp("", "csv2xml-pgp-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create plaintext directory: %w", err)
+	}
+	return filepath.Join(dir, filepath.Base(outputPath)), nil
+}
+
+// writtenPath returns the file a document was written to: its plaintext,
+// if it is encrypted, or its output file.
+func (out *documentOutput) writtenPath() string {
+	if out.plaintext != "" {
+		return out.plaintext
+	}
+	return out.path
+}
+
+// removePlaintext removes the plaintext of an encrypted document and its
+// temporary directory.
+func (out *documentOutput) removePlaintext() {
+	if out.plaintext != "" {
+		os.RemoveAll(filepath.Dir(out.plaintext))
+		out.plaintext = ""
+	}
+}
+
+// removeOutputs removes the written output files and signatures of
+// documents that were not delivered.
+func removeOutputs(outputs []*documentOutput) {
+	for _, out := range outputs {
+		out.removePlaintext()
+		if out.path != "" {
+			os.Remove(out.path)
+		}
+		if out.conv.signaturePath != "" {
+			os.Remove(out.conv.signaturePath)
+		}
+	}
+}
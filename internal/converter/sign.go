@@ -0,0 +1,140 @@
+// =============================================================================
+// CSV to XML Converter - Sign Transformations
+// =============================================================================
+//
+// Departments encode credits differently (see the validation package's
+// amountsign.go). Four transformations bring amounts to the convention of
+// the target system:
+//
+//   - normalize_sign       : "100.00-", "(100.00)", "100.00 CR" -> "-100.00"
+//   - apply_sign_indicator : an unsigned amount and its indicator column
+//                            ("100.00" and "CR") -> "-100.00"
+//   - sign_indicator       : the indicator of a signed amount column
+//                            ("-100.00" -> "CR")
+//   - unsigned_amount      : "-100.00" -> "100.00"
+//
+// For example, a department whose export has an indicator column but whose
+// target wants signed amounts, and one whose target wants it the other way
+// round:
+//
+//   transformation_rules:
+//     - field: "CHECK_AMT"
+//       actions:
+//         - type: apply_sign_indicator
+//           value: "DR_CR"               # the indicator column
+//           lookup_table: {DR: "+", CR: "-"}
+//
+//   transformation_rules:
+//     - field: "DR_CR"                   # before the amount is unsigned
+//       actions:
+//         - type: sign_indicator
+//           value: "CHECK_AMT"           # the signed amount column
+//           lookup_table: {"+": "DR", "-": "CR"}
+//     - field: "CHECK_AMT"
+//       actions:
+//         - type: unsigned_amount
+//
+// The lookup tables default to DR/D as debits (+) and CR/C as credits (-).
+// Rules run in order and see the values of the earlier rules. Values that
+// are not amounts are kept, for the data type check to report.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+)
+
+// isSignAction reports whether an action type is a sign transformation.
+func isSignAction(actionType string) bool {
+	switch actionType {
+	case "normalize_sign", "apply_sign_indicator", "sign_indicator", "unsigned_amount":
+		return true
+	}
+	return false
+}
+
+// applySignAction applies a sign transformation to a value.
+//
+// PARAMETERS:
+//   - value: The current value of the field.
+//   - action: The sign transformation.
+//   - allFields: All fields of the row, for the indicator or amount column.
+//
+// RETURNS:
+//   - The transformed value.
+//   - An error if an indicator is not in the lookup table, or an amount
+//     that gets its sign from an indicator is already signed.
+func applySignAction(value string, action config.TransformationAction, allFields map[string]string) (string, error) {
+	if strings.TrimSpace(value) == "" && action.Type != "sign_indicator" {
+		return value, nil
+	}
+
+	switch action.Type {
+	case "normalize_sign":
+		sign, amount, ok := validation.SplitSign(value, action.LookupTable)
+		if !ok {
+			return value, nil
+		}
+		return signed(sign, amount), nil
+
+	case "unsigned_amount":
+		_, amount, ok := validation.SplitSign(value, action.LookupTable)
+		if !ok {
+			return value, nil
+		}
+		return amount, nil
+
+	case "apply_sign_indicator":
+		sign, amount, ok := validation.SplitSign(value, nil)
+		if !ok {
+			return value, nil
+		}
+		if sign != "" {
+			return value, fmt.Errorf("amount %q is already signed", value)
+		}
+		indicator := allFields[action.Value]
+		indicatorSign, known := validation.IndicatorSign(indicator, action.LookupTable)
+		if !known {
+			return value, fmt.Errorf("indicator %q in %s is not in the lookup table", strings.TrimSpace(indicator), action.Value)
+		}
+		return signed(indicatorSign, amount), nil
+
+	case "sign_indicator":
+		amountValue := allFields[action.Value]
+		if strings.TrimSpace(amountValue) == "" {
+			return value, nil
+		}
+		sign, _, ok := validation.SplitSign(amountValue, nil)
+		if !ok {
+			return value, nil
+		}
+		if sign != "-" {
+			sign = "+"
+		}
+		indicators := action.LookupTable
+		if len(indicators) == 0 {
+			indicators = map[string]string{"+": "DR", "-": "CR"}
+		}
+		indicator, known := indicators[sign]
+		if !known {
+			return value, fmt.Errorf("lookup table has no indicator for %q", sign)
+		}
+		return indicator, nil
+	}
+	return value, fmt.Errorf("unknown sign transformation: %s", action.Type)
+}
+
+// signed writes an unsigned amount with a sign: "-" for credits, none for
+// debits.
+func signed(sign, amount string) string {
+	if sign == "-" {
+		return "-" + amount
+	}
+	return amount
+}
@@ -0,0 +1,89 @@
+// =============================================================================
+// CSV to XML Converter - SQL Sink
+// =============================================================================
+//
+// A department with a SQL sink (see internal/sqlsink) has the transactions
+// of its main output documents inserted into staging tables, in one database
+// transaction per file. The rows are inserted after the output is written
+// and protected, and committed once it is delivered; a failed delivery rolls
+// them back, and a failed insert or commit fails the file like a failed
+// delivery, so the staging tables and the delivered files stay in step.
+//
+// With replace_output, the main output is not written: its name is still
+// generated, as the load ID, but the rows only go to the staging tables.
+// Additional outputs are written as usual.
+//
+// Like the output, the inserted values are not masked.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/sqlsink"
+)
+
+// replacesOutput reports whether the SQL sink takes the place of a
+// document's output file.
+func (c *Converter) replacesOutput(out *documentOutput) bool {
+	return out.main == nil && c.deptConfig.SQLSink.Enabled() && c.deptConfig.SQLSink.ReplaceOutput
+}
+
+// loadID returns the load ID of a main document: its output file name
+// without the extension.
+func loadID(out *documentOutput) string {
+	return strings.TrimSuffix(out.name, filepath.Ext(out.name))
+}
+
+// insertSQLSink inserts the transactions of the main output documents into
+// the department's staging tables.
+//
+// PARAMETERS:
+//   - outputs: The written documents.
+//
+// RETURNS:
+//   - The inserted rows, to be committed after delivery, or nil without a
+//     SQL sink.
+//   - An error if the rows cannot be inserted.
+func (c *Converter) insertSQLSink(outputs []*documentOutput) (*sqlsink.Pending, error) {
+	settings := c.deptConfig.SQLSink
+	if !settings.Enabled() {
+		return nil, nil
+	}
+
+	var loads []sqlsink.Load
+	for _, out := range outputs {
+		if out.main != nil {
+			continue
+		}
+
+		load := sqlsink.Load{
+			ID:         loadID(out),
+			Department: c.deptConfig.DepartmentCode,
+			SourceFile: filepath.Base(c.csvPath),
+		}
+		for _, transaction := range out.transactions {
+			inserted := sqlsink.Transaction{Number: transaction.ID, Key: transaction.GroupKey, Fields: transaction.Fields}
+			for _, lineItem := range transaction.LineItems {
+				inserted.LineItems = append(inserted.LineItems, sqlsink.LineItem{Number: lineItem.ID,
+					SourceRow: lineItem.OriginalRowNumber, Fields: lineItem.Fields})
+			}
+			if inserted.Fields == nil && len(transaction.LineItems) > 0 {
+				inserted.Fields = transaction.LineItems[0].Fields
+			}
+			load.Transactions = append(load.Transactions, inserted)
+		}
+		loads = append(loads, load)
+	}
+
+	pending, err := sqlsink.Insert(settings, loads)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Info("Inserted %d transaction(s) and %d line item(s) into %s (not yet committed)",
+		pending.Transactions, pending.LineItems, settings.TransactionsTable)
+	return pending, nil
+}
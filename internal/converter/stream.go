@@ -0,0 +1,221 @@
+// =============================================================================
+// CSV to XML Converter - Stream Conversion
+// =============================================================================
+//
+// Run works on files: it locks the input, writes the output file, and then
+// protects, delivers, and archives it. Programs that embed the converter
+// (see pkg/convert) already have the data in hand and only need the
+// conversion itself, so these functions run the same pipeline stages on
+// streams instead:
+//
+//   - ConvertStream: parse, group, transform, validate, and generate XML
+//   - ValidateStream: parse, group, transform, and validate
+//
+// Nothing is locked, written to the output directory, protected, delivered,
+// published, or archived. The file name passed to New is only used for the
+// {filename} and {original} placeholders and in messages.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/csvparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+)
+
+// Template returns the schema of the template Run would use for the file
+// name passed to New, for ConvertStream and ValidateStream.
+//
+// RETURNS:
+//   - The parsed template, with the fields of the file's template rule.
+//   - An error if no template rule matches or the template cannot be parsed.
+func (c *Converter) Template() (*xlsxparser.Schema, error) {
+	templatePath, err := c.determineTemplate()
+	if err != nil {
+		return nil, err
+	}
+	return c.parseTemplate(templatePath)
+}
+
+// ConvertStream converts CSV data to an XML document.
+//
+// PARAMETERS:
+//   - input: The CSV data, in the department's CSV format.
+//   - output: Receives the XML document while it is generated. Nothing is
+//     written if the data fails to convert; a failing output may be left
+//     with part of the document.
+//   - schema: The parsed template.
+//
+// RETURNS:
+//   - A Result struct. OutputFile is always empty.
+func (c *Converter) ConvertStream(input io.Reader, output io.Writer, schema *xlsxparser.Schema) Result {
+	startTime := time.Now()
+	result := Result{
+		FilePath:   c.csvPath,
+		Success:    false,
+		Department: c.deptConfig.DepartmentCode,
+	}
+	c.schema = schema
+	result.Template = c.templateName()
+	result.TemplateVersion = c.templateVersion()
+
+	transactions, validationErrors, ok := c.parseAndValidate(input, &result)
+	if !ok {
+		return result
+	}
+	if len(validationErrors) > 0 && c.failurePolicy(config.StageValidation) != config.FailContinue {
+		result.Error = validationFailed(result.Validation)
+		return result
+	}
+
+	// A stream holds one document (see selector.go).
+	documents := c.documents(transactions)
+	if len(documents) > 1 {
+		result.Error = fmt.Errorf("the data has %d separate documents (template_selector); only one can be written", len(documents))
+		return result
+	}
+
+	stageStart := time.Now()
+	conv := c.forDocument(documents[0])
+	options, err := conv.generateOptions(documents[0].transactions)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	// Other formats than XML are generated as a whole (see generate).
+	counter := &countingWriter{writer: output}
+	if !conv.deptConfig.OutputFormat.IsXML() {
+		_, _, doc, err := conv.generate(documents[0].transactions)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		if _, err := counter.Write(doc); err != nil {
+			result.Error = fmt.Errorf("failed to write output: %w", err)
+			return result
+		}
+		result.Stats.BytesOut = counter.count
+		result.Stats.Stages.Generate = lap(&stageStart)
+		result.Success = true
+		result.Stats.ProcessingTime = time.Since(startTime)
+		return result
+	}
+
+	// The document is written while it is generated, so it is never held
+	// in memory as a whole. Both stages are timed as generate.
+	xmlTransactions := convertToXMLWriterTransactions(documents[0].transactions)
+	if err := xmlwriter.GenerateTo(counter, xmlTransactions, conv.schema, conv.deptConfig, options); err != nil {
+		result.Error = fmt.Errorf("failed to write output: %w", err)
+		return result
+	}
+	result.Stats.BytesOut = counter.count
+	result.Stats.Stages.Generate = lap(&stageStart)
+
+	result.Success = true
+	result.Stats.ProcessingTime = time.Since(startTime)
+	return result
+}
+
+// ValidateStream transforms and validates CSV data without generating XML.
+//
+// PARAMETERS:
+//   - input: The CSV data, in the department's CSV format.
+//   - schema: The parsed template.
+//
+// RETURNS:
+//   - A Result struct. Success is true if the data has no validation errors
+//     (regardless of ContinueOnError). OutputFile is always empty.
+func (c *Converter) ValidateStream(input io.Reader, schema *xlsxparser.Schema) Result {
+	startTime := time.Now()
+	result := Result{
+		FilePath:   c.csvPath,
+		Success:    false,
+		Department: c.deptConfig.DepartmentCode,
+	}
+	c.schema = schema
+	result.Template = c.templateName()
+	result.TemplateVersion = c.templateVersion()
+
+	_, validationErrors, ok := c.parseAndValidate(input, &result)
+	if !ok {
+		return result
+	}
+	result.Stats.ProcessingTime = time.Since(startTime)
+
+	if len(validationErrors) > 0 {
+		result.Error = validationFailed(result.Validation)
+		return result
+	}
+
+	result.Success = true
+	return result
+}
+
+// parseAndValidate parses, groups, transforms, and validates the CSV data.
+//
+// RETURNS:
+//   - The transformed transactions.
+//   - The validation errors.
+//   - false if the data could not be parsed or transformed (result.Error
+//     is set).
+func (c *Converter) parseAndValidate(input io.Reader, result *Result) ([]Transaction, []*validation.ValidationError, bool) {
+	stageStart := time.Now()
+	counter := &countingReader{reader: input}
+
+	csvData, err := csvparser.ParseReader(counter, c.csvPath, c.csvSettings())
+	if err != nil {
+		result.Error = fmt.Errorf("failed to parse CSV: %w", err)
+		return nil, nil, false
+	}
+	if err := c.prepareColumns(csvData); err != nil {
+		result.Error = err
+		return nil, nil, false
+	}
+	result.Stats.BytesIn = counter.count
+	result.Stats.Stages.CSVParse = lap(&stageStart)
+
+	transactions, duplicates, err := c.buildTransactions(csvData, &result.Stats)
+	if err != nil {
+		result.Error = err
+		return nil, nil, false
+	}
+	result.Stats.Stages.Transform = lap(&stageStart)
+
+	validationErrors := c.validate(transactions, duplicates, result)
+	result.Stats.Stages.Validate = lap(&stageStart)
+
+	return transactions, validationErrors, true
+}
+
+// countingReader counts the bytes read through it, for Stats.BytesIn.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written through it, for Stats.BytesOut.
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
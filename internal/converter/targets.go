@@ -0,0 +1,121 @@
+// =============================================================================
+// CSV to XML Converter - Additional Outputs
+// =============================================================================
+//
+// A department can write more than one document from a file: besides the
+// main output, each of its outputs (see config.OutputTarget) gets a document
+// in its own format, e.g. JSON for the data lake or a summary flat file for
+// finance. The file is parsed, transformed, and validated once; every
+// document is rendered from the same transactions.
+//
+// An additional document is named after the main one, with the target's
+// name appended ("<uuid>_datalake.json"), and written to the target's
+// directory. It is protected, delivered (with the target's delivery), and
+// archived like the main output, and like it, a failure fails the file.
+// Events and provenance are only written for the main output.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+)
+
+// forTarget returns a copy of a document's converter that writes an
+// additional output: with the target's format and delivery, and the
+// document's placeholder values, so both documents share their UUID and
+// time.
+func (c *Converter) forTarget(target *config.OutputTarget) *Converter {
+	dept := *c.deptConfig
+	dept.OutputFormat = target.OutputFormat
+	dept.Delivery = target.Delivery
+	dept.Provenance.Enabled = false
+
+	tc := *c
+	tc.deptConfig = &dept
+	tc.target = target
+	tc.formatter = nil
+	tc.signaturePath = ""
+	return &tc
+}
+
+// targetOutputs renders the additional outputs of a generated document.
+// The main document's options are reused: generating them again would
+// reserve line item numbers again.
+//
+// PARAMETERS:
+//   - out: The generated main document.
+//
+// RETURNS:
+//   - A document per target of the department.
+//   - An error if a document cannot be rendered.
+func (c *Converter) targetOutputs(out *documentOutput) ([]*documentOutput, error) {
+	var outputs []*documentOutput
+	for i := range c.deptConfig.Outputs {
+		target := &c.deptConfig.Outputs[i]
+		conv := out.conv.forTarget(target)
+
+		options := out.options
+		options.Provenance = nil
+		options.TransactionOffsets = nil
+		doc, err := conv.render(out.xmlTransactions, options)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", target.Name, err)
+		}
+		outputs = append(outputs, &documentOutput{conv: conv, transactions: out.transactions,
+			xmlTransactions: out.xmlTransactions, options: options, xmlDoc: doc, main: out})
+	}
+	return outputs, nil
+}
+
+// writeTarget writes an additional document next to its main document, or
+// to the target's directory, like writeOutput.
+//
+// PARAMETERS:
+//   - out: The additional document. Its main document is written. Its
+//     plaintext path is set if it is encrypted.
+//
+// RETURNS:
+//   - The path of the written file.
+//   - An error if the file cannot be written.
+func (c *Converter) writeTarget(out *documentOutput) (string, error) {
+	outputDir := c.target.OutputDir
+	if outputDir == "" {
+		outputDir = filepath.Dir(out.main.path)
+		// A main output replaced by the SQL sink has no file (see sqlsink.go).
+		if out.main.path == "" {
+			outputDir = c.mainConfig.OutputDir
+		}
+	}
+	if err := os.MkdirAll(utils.LongPath(outputDir), 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	fileName := strings.TrimSuffix(out.main.name, filepath.Ext(out.main.name)) + "_" + c.target.Name + c.OutputExtension()
+	outputPath := filepath.Join(outputDir, fileName)
+
+	// An encrypted document is written outside the output directory (see
+	// plaintextPath).
+	writePath := outputPath
+	plaintext, err := c.plaintextPath(outputPath)
+	if err != nil {
+		return "", err
+	}
+	if plaintext != "" {
+		out.plaintext = plaintext
+		writePath = plaintext
+	}
+
+	if err := c.writeFile(utils.LongPath(writePath), out.xmlDoc); err != nil {
+		os.Remove(utils.LongPath(writePath))
+		return "", fmt.Errorf("failed to write output %s: %w", c.target.Name, err)
+	}
+	return outputPath, nil
+}
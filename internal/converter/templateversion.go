@@ -0,0 +1,99 @@
+// =============================================================================
+// CSV to XML Converter - Template Versions
+// =============================================================================
+//
+// A template can carry a version, on its _meta sheet or in the department's
+// template_mapping rule. The version is recorded in the XML (as a comment
+// and in the {template_version} placeholder) and in the audit trail.
+//
+// The version used by the last successful run of each department and
+// template is kept in the state directory. A run with a different version
+// logs a warning, so an unannounced template change is noticed before the
+// target system rejects its files.
+//
+// =============================================================================
+
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// templateVersion returns the version of the parsed template: its own
+// version, or the version of the matching template_mapping rule.
+func (c *Converter) templateVersion() string {
+	if c.schema != nil && c.schema.Version != "" {
+		return c.schema.Version
+	}
+	if rule, ok := c.MatchTemplateRule(); ok {
+		return rule.Version
+	}
+	return ""
+}
+
+// templateName returns the file name of the parsed template, or "" if the
+// template was not read from a file.
+func (c *Converter) templateName() string {
+	if c.schema == nil || c.schema.TemplateFile == "" {
+		return ""
+	}
+	return filepath.Base(c.schema.TemplateFile)
+}
+
+// templateComment returns the XML comment that records the template
+// version, or "" if the template has no version.
+func (c *Converter) templateComment() string {
+	version := c.templateVersion()
+	if version == "" {
+		return ""
+	}
+	if name := c.templateName(); name != "" {
+		return fmt.Sprintf("Template: %s, version %s", name, version)
+	}
+	return fmt.Sprintf("Template version %s", version)
+}
+
+// templateVersionPath returns the state file holding the template version
+// of the department's last successful run,
+// e.g. "state/CLAIMS.payments.template_version".
+func (c *Converter) templateVersionPath() string {
+	name := c.templateName()
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return filepath.Join(c.mainConfig.StateDir, c.deptConfig.DepartmentCode+"."+name+".template_version")
+}
+
+// checkTemplateVersion warns if the template version differs from the one
+// used by the department's last successful run with this template.
+func (c *Converter) checkTemplateVersion() {
+	version := c.templateVersion()
+	if version == "" || c.templateName() == "" {
+		return
+	}
+
+	data, err := os.ReadFile(c.templateVersionPath())
+	if err != nil {
+		// No successful run yet.
+		return
+	}
+
+	if previous := strings.TrimSpace(string(data)); previous != version {
+		c.logger.Warn("Template %s is version %s, but the last successful %s run used version %s",
+			c.templateName(), version, c.deptConfig.DepartmentCode, previous)
+	}
+}
+
+// recordTemplateVersion records the template version after a successful
+// run. A failure is logged: it only affects the next run's warning.
+func (c *Converter) recordTemplateVersion() {
+	version := c.templateVersion()
+	if version == "" || c.templateName() == "" {
+		return
+	}
+
+	if err := writeStateFile(c.templateVersionPath(), []byte(version+"\n")); err != nil {
+		c.logger.Warn("Failed to record template version: %v", err)
+	}
+}
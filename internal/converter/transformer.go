@@ -37,6 +37,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
 )
@@ -203,7 +204,7 @@ func ApplyTransformation(value string, action config.TransformationAction, allFi
 	case "substring":
 		// Extract a substring.
 		//
-		// VALUE FORMAT: "start,end" (0-indexed, end is exclusive)
+		// VALUE FORMAT: "start,end" (0-indexed characters, end is exclusive)
 		// EXAMPLE:
 		//   Input: "ABCDEFGH"
 		//   Action: substring with value "2,5"
@@ -218,14 +219,11 @@ func ApplyTransformation(value string, action config.TransformationAction, allFi
 		if start < 0 {
 			start = 0
 		}
-		if end > len(value) {
-			end = len(value)
-		}
-		if start >= end || start >= len(value) {
+		if start >= end {
 			return "", nil
 		}
 
-		return value[start:end], nil
+		return value[runeOffset(value, start):runeOffset(value, end)], nil
 
 	// =========================================================================
 	// NUMERIC FORMATTING
@@ -270,10 +268,10 @@ func ApplyTransformation(value string, action config.TransformationAction, allFi
 			return value, nil
 		}
 
-		if len(value) > targetLength {
+		if utf8.RuneCountInString(value) > targetLength {
 			// Truncate from the right.
 			// CUSTOMIZATION: Change to truncate from left if needed.
-			return value[:targetLength], nil
+			return value[:runeOffset(value, targetLength)], nil
 		}
 
 		// Pad with leading zeros.
@@ -492,6 +490,15 @@ func ApplyTransformation(value string, action config.TransformationAction, allFi
 		// CUSTOMIZATION: Implement your account code formatting logic.
 		return value, nil // Placeholder
 
+	case "normalize_sign", "apply_sign_indicator", "sign_indicator", "unsigned_amount":
+		// Convert between the debit/credit sign conventions (see sign.go).
+		//
+		// EXAMPLE:
+		//   Input: "100.00" with DR_CR "CR"
+		//   Action: apply_sign_indicator with value "DR_CR"
+		//   Output: "-100.00"
+		return applySignAction(value, action, allFields)
+
 	case "format_currency":
 		// Format a currency value.
 		//
@@ -514,30 +521,47 @@ func ApplyTransformation(value string, action config.TransformationAction, allFi
 // HELPER FUNCTIONS
 // =============================================================================
 
-// PadLeft pads a string with a character on the left to reach the target length.
+// PadLeft pads a string with a character on the left to reach the target
+// length in characters.
 func PadLeft(s string, length int, padChar rune) string {
-	if len(s) >= length {
+	count := utf8.RuneCountInString(s)
+	if count >= length {
 		return s
 	}
-	padding := make([]rune, length-len(s))
+	padding := make([]rune, length-count)
 	for i := range padding {
 		padding[i] = padChar
 	}
 	return string(padding) + s
 }
 
-// PadRight pads a string with a character on the right to reach the target length.
+// PadRight pads a string with a character on the right to reach the target
+// length in characters.
 func PadRight(s string, length int, padChar rune) string {
-	if len(s) >= length {
+	count := utf8.RuneCountInString(s)
+	if count >= length {
 		return s
 	}
-	padding := make([]rune, length-len(s))
+	padding := make([]rune, length-count)
 	for i := range padding {
 		padding[i] = padChar
 	}
 	return s + string(padding)
 }
 
+// runeOffset returns the byte offset of the nth character of a string, or
+// its length if it has no more than n characters, so that slicing at it
+// never splits a UTF-8 sequence.
+func runeOffset(s string, n int) int {
+	for offset := range s {
+		if n == 0 {
+			return offset
+		}
+		n--
+	}
+	return len(s)
+}
+
 // =============================================================================
 // BATCH TRANSFORMATION
 // =============================================================================
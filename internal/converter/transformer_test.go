@@ -0,0 +1,274 @@
+package converter
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// transformationCase is a test case of testdata/transformations.yaml.
+type transformationCase struct {
+	Name   string                      `yaml:"name"`
+	Value  string                      `yaml:"value"`
+	Fields map[string]string           `yaml:"fields"`
+	Action config.TransformationAction `yaml:"action"`
+	Want   string                      `yaml:"want"`
+	Error  string                      `yaml:"error"`
+}
+
+// actionTypes are the action types of ApplyTransformation. Each needs a
+// case in testdata/transformations.yaml.
+var actionTypes = []string{
+	"prepend_string", "append_string", "trim", "trim_left", "trim_right",
+	"uppercase", "lowercase", "title_case", "replace", "regex_replace",
+	"substring", "pad_zeros_to_length", "pad_spaces_to_length",
+	"ensure_length", "format_number", "remove_leading_zeros", "format_date",
+	"lookup", "lookup_with_default", "conditional", "if_empty_use_default",
+	"if_empty_use_field", "extract_digits", "extract_letters",
+	"remove_special_chars", "normalize_whitespace", "format_policy_number",
+	"format_account_code", "format_currency", "normalize_sign",
+	"apply_sign_indicator", "sign_indicator", "unsigned_amount",
+}
+
+// loadTransformationCases reads testdata/transformations.yaml.
+func loadTransformationCases(t *testing.T) []transformationCase {
+	t.Helper()
+	data, err := os.ReadFile("testdata/transformations.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []transformationCase
+	if err := yaml.Unmarshal(data, &cases); err != nil {
+		t.Fatalf("failed to parse testdata/transformations.yaml: %v", err)
+	}
+	return cases
+}
+
+func TestApplyTransformation(t *testing.T) {
+	cases := loadTransformationCases(t)
+
+	names := make(map[string]bool)
+	for _, tc := range cases {
+		name := tc.Action.Type + "/" + tc.Name
+		if names[name] {
+			t.Errorf("duplicate case %q", name)
+		}
+		names[name] = true
+
+		t.Run(name, func(t *testing.T) {
+			got, err := ApplyTransformation(tc.Value, tc.Action, tc.Fields)
+			if tc.Error != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.Error) {
+					t.Fatalf("ApplyTransformation(%q) error = %v, want %q", tc.Value, err, tc.Error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyTransformation(%q) error = %v", tc.Value, err)
+			}
+			if got != tc.Want {
+				t.Errorf("ApplyTransformation(%q) = %q, want %q", tc.Value, got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestApplyTransformationCoversEveryType(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, tc := range loadTransformationCases(t) {
+		covered[tc.Action.Type] = true
+	}
+	for _, actionType := range actionTypes {
+		if !covered[actionType] {
+			t.Errorf("no case for %s in testdata/transformations.yaml", actionType)
+		}
+		// A type missing from the switch would be an unknown type.
+		if _, err := ApplyTransformation("", config.TransformationAction{Type: actionType}, nil); err != nil {
+			t.Errorf("%s: %v", actionType, err)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	transformer := NewTransformer([]config.TransformationRule{
+		{Field: "POLICY", Actions: []config.TransformationAction{
+			{Type: "trim"},
+			{Type: "pad_zeros_to_length", Value: "6"},
+			{Type: "prepend_string", Value: "P"},
+		}},
+		{Field: "CODE", Actions: []config.TransformationAction{
+			{Type: "regex_replace", Find: "("},
+		}},
+	})
+
+	tests := []struct {
+		field   string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{field: "POLICY", value: " 123 ", want: "P000123"},
+		{field: "POLICY", value: "", want: "P000000"},
+		{field: "OTHER", value: " 123 ", want: " 123 "},
+		{field: "CODE", value: "x", wantErr: "transformation 'regex_replace' failed"},
+	}
+	for _, tt := range tests {
+		got, err := transformer.Transform(tt.field, tt.value, nil)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Transform(%s, %q) error = %v, want %q", tt.field, tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Transform(%s, %q) = %q, %v, want %q", tt.field, tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestTransformLineItem(t *testing.T) {
+	transformer := NewTransformer([]config.TransformationRule{
+		{Field: "NAME", Actions: []config.TransformationAction{{Type: "uppercase"}}},
+		{Field: "ID", Actions: []config.TransformationAction{{Type: "if_empty_use_field", Value: "ALT_ID"}}},
+	})
+
+	transaction := Transaction{LineItems: []LineItem{
+		{ID: 1, Fields: map[string]string{"NAME": "anna", "ID": "", "ALT_ID": "A7"}},
+		{ID: 2, Fields: map[string]string{"NAME": "björn", "ID": "9", "ALT_ID": "B8"}},
+	}}
+	if err := transformer.TransformTransaction(&transaction); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []map[string]string{
+		{"NAME": "ANNA", "ID": "A7", "ALT_ID": "A7"},
+		{"NAME": "BJÖRN", "ID": "9", "ALT_ID": "B8"},
+	}
+	for i, item := range transaction.LineItems {
+		for field, value := range want[i] {
+			if item.Fields[field] != value {
+				t.Errorf("line item %d: %s = %q, want %q", item.ID, field, item.Fields[field], value)
+			}
+		}
+	}
+
+	failing := NewTransformer([]config.TransformationRule{
+		{Field: "NAME", Actions: []config.TransformationAction{{Type: "reverse"}}},
+	})
+	err := failing.TransformTransaction(&transaction)
+	if err == nil || !strings.Contains(err.Error(), "line item 1") || !strings.Contains(err.Error(), "field 'NAME'") {
+		t.Errorf("TransformTransaction error = %v, want the line item and field", err)
+	}
+}
+
+func TestTransformationChain(t *testing.T) {
+	chain := NewTransformationChain().
+		Add(NewTransformer([]config.TransformationRule{
+			{Field: "ACCOUNT", Actions: []config.TransformationAction{{Type: "extract_digits"}}},
+		})).
+		Add(NewTransformer([]config.TransformationRule{
+			{Field: "ACCOUNT", Actions: []config.TransformationAction{{Type: "ensure_length", Value: "8"}}},
+		}))
+
+	got, err := chain.Transform("ACCOUNT", "AC-12-34", nil)
+	if err != nil || got != "00001234" {
+		t.Errorf("Transform = %q, %v, want %q", got, err, "00001234")
+	}
+
+	got, err = NewTransformationChain().Transform("ACCOUNT", "AC-12", nil)
+	if err != nil || got != "AC-12" {
+		t.Errorf("empty chain Transform = %q, %v, want the value", got, err)
+	}
+}
+
+func TestPad(t *testing.T) {
+	tests := []struct {
+		s      string
+		length int
+		left   string
+		right  string
+	}{
+		{s: "7", length: 3, left: "007", right: "700"},
+		{s: "", length: 2, left: "00", right: "00"},
+		{s: "1234", length: 3, left: "1234", right: "1234"},
+		{s: "1", length: 0, left: "1", right: "1"},
+		{s: "1", length: -1, left: "1", right: "1"},
+	}
+	for _, tt := range tests {
+		if got := PadLeft(tt.s, tt.length, '0'); got != tt.left {
+			t.Errorf("PadLeft(%q, %d) = %q, want %q", tt.s, tt.length, got, tt.left)
+		}
+		if got := PadRight(tt.s, tt.length, '0'); got != tt.right {
+			t.Errorf("PadRight(%q, %d) = %q, want %q", tt.s, tt.length, got, tt.right)
+		}
+	}
+}
+
+// FuzzRegexReplace checks that regex_replace never panics, and that it
+// matches strings.ReplaceAll for a literal pattern.
+func FuzzRegexReplace(f *testing.F) {
+	f.Add("ABC-123-DEF", "[A-Z]+", "X")
+	f.Add("2024-01-15", `(\d+)-(\d+)`, "$2/$1")
+	f.Add("a.b.c", ".", "")
+	f.Add("Zoë", "ë", "e")
+	f.Add("", "(", "x")
+	f.Add("aaa", "a*", "-")
+
+	f.Fuzz(func(t *testing.T, value, find, replacement string) {
+		action := config.TransformationAction{Type: "regex_replace", Find: find, Value: replacement}
+		got, err := ApplyTransformation(value, action, nil)
+		if err != nil {
+			if _, compileErr := regexp.Compile(find); compileErr == nil {
+				t.Fatalf("valid pattern %q failed: %v", find, err)
+			}
+			return
+		}
+		if find == "" && got != value {
+			t.Fatalf("empty pattern changed %q to %q", value, got)
+		}
+
+		// A literal pattern replaces like strings.ReplaceAll, for text
+		// without invalid UTF-8 and a replacement without $ references.
+		if find == "" || !utf8.ValidString(value) || !utf8.ValidString(find) || strings.Contains(replacement, "$") {
+			return
+		}
+		action.Find = regexp.QuoteMeta(find)
+		got, err = ApplyTransformation(value, action, nil)
+		if err != nil {
+			t.Fatalf("literal pattern %q failed: %v", action.Find, err)
+		}
+		if want := strings.ReplaceAll(value, find, replacement); got != want {
+			t.Fatalf("regex_replace(%q, %q, %q) = %q, want %q", value, find, replacement, got, want)
+		}
+	})
+}
+
+// FuzzSubstring checks that substring never panics and returns a part of
+// the value, for any range, without splitting a UTF-8 character.
+func FuzzSubstring(f *testing.F) {
+	f.Add("ABCDEFGH", "2,5")
+	f.Add("ABC", "-5,99")
+	f.Add("ABC", "5,1")
+	f.Add("éa", "1,2")
+	f.Add("", "0,0")
+	f.Add("ABC", "x,y")
+	f.Add("ABC", "1")
+
+	f.Fuzz(func(t *testing.T, value, spec string) {
+		got, err := ApplyTransformation(value, config.TransformationAction{Type: "substring", Value: spec}, nil)
+		if err != nil {
+			t.Fatalf("substring(%q, %q) failed: %v", value, spec, err)
+		}
+		if len(got) > len(value) || !strings.Contains(value, got) {
+			t.Fatalf("substring(%q, %q) = %q, not a part of the value", value, spec, got)
+		}
+		if utf8.ValidString(value) && !utf8.ValidString(got) {
+			t.Fatalf("substring(%q, %q) = %q, not valid UTF-8", value, spec, got)
+		}
+	})
+}
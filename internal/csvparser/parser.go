@@ -31,7 +31,9 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
@@ -51,6 +53,11 @@ type CSVData struct {
 	// Using maps allows for easy field access by name.
 	Rows []map[string]string
 
+	// RowNumbers contains the original 1-indexed record number of each entry
+	// in Rows. It is parallel to Rows and accounts for skipped empty rows.
+	// Useful for error reporting.
+	RowNumbers []int
+
 	// RawRows contains the raw row data as string slices.
 	// This is useful for debugging and error reporting.
 	RawRows [][]string
@@ -98,8 +105,22 @@ func Parse(filePath string, settings config.CSVSettings) (*CSVData, error) {
 	}
 	defer file.Close()
 
+	return ParseReader(file, filePath, settings)
+}
+
+// ParseReader reads CSV data from a stream and returns the parsed data.
+//
+// PARAMETERS:
+//   - r: The CSV data.
+//   - name: The name reported as the data's SourceFile.
+//   - settings: The CSV parsing settings from the department configuration.
+//
+// RETURNS:
+//   - A pointer to the CSVData struct containing the parsed data.
+//   - An error if the data cannot be read or parsed.
+func ParseReader(r io.Reader, name string, settings config.CSVSettings) (*CSVData, error) {
 	// Create a buffered reader for better performance.
-	reader := bufio.NewReader(file)
+	reader := bufio.NewReader(r)
 
 	// Handle encoding if not UTF-8.
 	// CUSTOMIZATION: Add support for additional encodings.
@@ -134,7 +155,7 @@ func Parse(filePath string, settings config.CSVSettings) (*CSVData, error) {
 	}
 
 	// Extract data rows.
-	dataRows, err := extractDataRows(allRows, headers, settings)
+	dataRows, rowNumbers, err := extractDataRows(allRows, headers, settings)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract data rows: %w", err)
 	}
@@ -143,8 +164,9 @@ func Parse(filePath string, settings config.CSVSettings) (*CSVData, error) {
 	csvData := &CSVData{
 		Headers:     headers,
 		Rows:        dataRows,
+		RowNumbers:  rowNumbers,
 		RawRows:     allRows[settings.DataStartRow-1:], // Keep raw rows for debugging
-		SourceFile:  filePath,
+		SourceFile:  name,
 		RowCount:    len(dataRows),
 		ColumnCount: len(headers),
 	}
@@ -319,11 +341,12 @@ func cleanHeaders(headers []string) []string {
 //
 // RETURNS:
 //   - A slice of maps, where each map represents a row with header -> value pairs.
+//   - The original 1-indexed record number of each returned row.
 //   - An error if data extraction fails.
 //
 // CUSTOMIZATION:
 //   Add preprocessing or validation logic for specific data formats.
-func extractDataRows(allRows [][]string, headers []string, settings config.CSVSettings) ([]map[string]string, error) {
+func extractDataRows(allRows [][]string, headers []string, settings config.CSVSettings) ([]map[string]string, []int, error) {
 	// Calculate the starting index for data rows.
 	// DataStartRow is 1-indexed, so subtract 1 for 0-indexed array.
 	startIndex := settings.DataStartRow - 1
@@ -334,11 +357,12 @@ func extractDataRows(allRows [][]string, headers []string, settings config.CSVSe
 
 	if startIndex >= len(allRows) {
 		// No data rows.
-		return []map[string]string{}, nil
+		return []map[string]string{}, []int{}, nil
 	}
 
 	// Extract data rows.
 	dataRows := make([]map[string]string, 0, len(allRows)-startIndex)
+	rowNumbers := make([]int, 0, len(allRows)-startIndex)
 
 	for rowIndex := startIndex; rowIndex < len(allRows); rowIndex++ {
 		row := allRows[rowIndex]
@@ -363,9 +387,10 @@ func extractDataRows(allRows [][]string, headers []string, settings config.CSVSe
 		}
 
 		dataRows = append(dataRows, rowMap)
+		rowNumbers = append(rowNumbers, rowIndex+1)
 	}
 
-	return dataRows, nil
+	return dataRows, rowNumbers, nil
 }
 
 // isRowEmpty checks if a row contains only empty values.
@@ -556,10 +581,252 @@ func (p *StreamingParser) Close() error {
 	return p.file.Close()
 }
 
+// =============================================================================
+// SAMPLING PARSER FOR PRE-CHECKS
+// =============================================================================
+
+// ParseSample reads the first rows of a CSV file plus a random sample of the
+// remaining rows, without holding the whole file in memory.
+//
+// PARAMETERS:
+//   - filePath: The path to the CSV file.
+//   - settings: The CSV parsing settings from the department configuration.
+//   - headRows: The number of leading data rows to always include.
+//   - sampleRows: The number of rows to sample at random from the rest of the file.
+//   - seed: The random seed (use a fixed seed for reproducible samples).
+//
+// RETURNS:
+//   - A pointer to the CSVData struct containing only the selected rows,
+//     in file order. RowCount is the number of selected rows.
+//   - An error if the file cannot be read or parsed.
+//
+// SAMPLING:
+//   Rows after the head are sampled with reservoir sampling, so every row has
+//   an equal chance of being selected in a single pass over the file.
+func ParseSample(filePath string, settings config.CSVSettings, headRows, sampleRows int, seed int64) (*CSVData, error) {
+	parser, err := NewStreamingParser(filePath, settings)
+	if err != nil {
+		return nil, err
+	}
+	defer parser.Close()
+
+	type sampledRow struct {
+		row       map[string]string
+		rowNumber int
+	}
+
+	var head []sampledRow
+	reservoir := make([]sampledRow, 0, sampleRows)
+	rng := rand.New(rand.NewSource(seed))
+	seen := 0 // Rows seen after the head
+
+	for parser.Next() {
+		current := sampledRow{row: parser.Row(), rowNumber: parser.RowNumber()}
+
+		if len(head) < headRows {
+			head = append(head, current)
+			continue
+		}
+
+		seen++
+		if len(reservoir) < sampleRows {
+			reservoir = append(reservoir, current)
+		} else if j := rng.Intn(seen); j < sampleRows {
+			reservoir[j] = current
+		}
+	}
+
+	if err := parser.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+
+	// Restore file order so grouping behaves as it would on the full file.
+	sort.Slice(reservoir, func(i, j int) bool {
+		return reservoir[i].rowNumber < reservoir[j].rowNumber
+	})
+
+	selected := append(head, reservoir...)
+	csvData := &CSVData{
+		Headers:     parser.Headers(),
+		Rows:        make([]map[string]string, len(selected)),
+		RowNumbers:  make([]int, len(selected)),
+		SourceFile:  filePath,
+		RowCount:    len(selected),
+		ColumnCount: len(parser.Headers()),
+	}
+
+	for i, s := range selected {
+		csvData.Rows[i] = s.row
+		csvData.RowNumbers[i] = s.rowNumber
+	}
+
+	return csvData, nil
+}
+
+// =============================================================================
+// REWRITING
+// =============================================================================
+
+// RewriteFile writes a copy of a CSV file with the data values replaced,
+// e.g., to mask sensitive columns. Header rows and rows before the data
+// start row are copied unchanged. The copy has the file's delimiter, but
+// fields are quoted as needed rather than as in the original.
+//
+// PARAMETERS:
+//   - src: The CSV file.
+//   - dst: The path of the copy.
+//   - settings: The CSV parsing settings from the department configuration.
+//   - rewrite: Returns the value to write for a value in a column.
+//
+// RETURNS:
+//   - An error if the file cannot be read or the copy cannot be written.
+func RewriteFile(src, dst string, settings config.CSVSettings, rewrite func(header, value string) string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	csvReader := csv.NewReader(bufio.NewReader(file))
+	configureReader(csvReader, settings)
+	allRows, err := csvReader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to read CSV: %w", err)
+	}
+	if len(allRows) == 0 {
+		return fmt.Errorf("CSV file is empty")
+	}
+
+	headers, err := extractHeaders(allRows, settings)
+	if err != nil {
+		return fmt.Errorf("failed to extract headers: %w", err)
+	}
+
+	startIndex := settings.DataStartRow - 1
+	if startIndex < 0 {
+		startIndex = settings.HeaderRows
+	}
+	for rowIndex := startIndex; rowIndex < len(allRows); rowIndex++ {
+		row := allRows[rowIndex]
+		for colIndex := 0; colIndex < len(row) && colIndex < len(headers); colIndex++ {
+			row[colIndex] = rewrite(headers[colIndex], row[colIndex])
+		}
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	writer := csv.NewWriter(out)
+	writer.Comma = csvReader.Comma
+	writer.WriteAll(allRows)
+	if err := writer.Error(); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
+
 // =============================================================================
 // UTILITY FUNCTIONS
 // =============================================================================
 
+// RenameHeaders renames columns, e.g., to map a cosmetic upstream rename
+// ("Chk #") back to the header the template expects ("CHK_NUM"). Headers
+// are matched after trimming surrounding whitespace. RawRows are left as
+// they are.
+//
+// PARAMETERS:
+//   - data: The parsed CSV data.
+//   - aliases: The new header for each header to rename.
+//
+// RETURNS:
+//   - The renamed headers, as "old -> new".
+//   - An error if a renamed column would have the header of another
+//     column; the data is then left unchanged.
+func RenameHeaders(data *CSVData, aliases map[string]string) ([]string, error) {
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+
+	renamed := make([]string, len(data.Headers))
+	var changes []string
+	seen := make(map[string]string, len(data.Headers))
+	for i, header := range data.Headers {
+		renamed[i] = header
+		if alias, ok := aliases[strings.TrimSpace(header)]; ok && alias != header {
+			renamed[i] = alias
+			changes = append(changes, header+" -> "+alias)
+		}
+		if previous, ok := seen[renamed[i]]; ok {
+			return nil, fmt.Errorf("columns %q and %q would both be named %q", previous, header, renamed[i])
+		}
+		seen[renamed[i]] = header
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	for _, row := range data.Rows {
+		for i, header := range data.Headers {
+			if renamed[i] == header {
+				continue
+			}
+			if value, ok := row[header]; ok {
+				delete(row, header)
+				row[renamed[i]] = value
+			}
+		}
+	}
+	data.Headers = renamed
+	return changes, nil
+}
+
+// DropColumns removes columns from the data, e.g., internal notes that are
+// not part of any mapping. Headers are matched after trimming surrounding
+// whitespace. RawRows are left as they are.
+//
+// PARAMETERS:
+//   - data: The parsed CSV data.
+//   - columns: The headers of the columns to remove.
+//
+// RETURNS:
+//   - The headers of the removed columns the file had.
+func DropColumns(data *CSVData, columns []string) []string {
+	if len(columns) == 0 {
+		return nil
+	}
+	drop := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		drop[strings.TrimSpace(column)] = true
+	}
+
+	kept := make([]string, 0, len(data.Headers))
+	var dropped []string
+	for _, header := range data.Headers {
+		if drop[strings.TrimSpace(header)] {
+			dropped = append(dropped, header)
+		} else {
+			kept = append(kept, header)
+		}
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+
+	for _, row := range data.Rows {
+		for _, header := range dropped {
+			delete(row, header)
+		}
+	}
+	data.Headers = kept
+	data.ColumnCount = len(kept)
+	return dropped
+}
+
 // GetColumnByHeader returns all values for a specific column.
 //
 // PARAMETERS:
@@ -0,0 +1,294 @@
+// =============================================================================
+// CSV to XML Converter - CSV Data Profiling
+// =============================================================================
+//
+// Profiles the columns of a parsed CSV file: how often each is empty, how
+// many distinct values and which value shapes it has, its value lengths,
+// and which date formats fit it. The profile is used when onboarding a new
+// department, to build its template from the data rather than from
+// guesses: the suggested data type and the maximum length map directly to
+// the template's Data Type and Char Limit columns.
+//
+// Value shapes ("patterns") replace each letter with "A" and each digit with
+// "9", keeping other characters: "POL-00123" becomes "AAA-99999".
+//
+// =============================================================================
+
+package csvparser
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ProfileOptions controls the profiling. Zero values use the defaults.
+type ProfileOptions struct {
+	// TopValues is the number of most frequent values and patterns listed
+	// per column.
+	// Default: 10
+	TopValues int
+
+	// MaxDistinct is the number of distinct values (and patterns) tracked
+	// per column. Beyond it, new values are no longer counted, and the
+	// distinct count is a lower bound.
+	// Default: 100000
+	MaxDistinct int
+}
+
+// Profile is the profile of a CSV file.
+type Profile struct {
+	Rows    int             `json:"rows"`
+	Columns []ColumnProfile `json:"columns"`
+}
+
+// ColumnProfile is the profile of one column.
+type ColumnProfile struct {
+	Name string `json:"name"`
+
+	// Values and Empty count the rows with a value and the rows where the
+	// column is empty (or only whitespace). NullRate is Empty as a share of
+	// all rows.
+	Values   int     `json:"values"`
+	Empty    int     `json:"empty"`
+	NullRate float64 `json:"null_rate"`
+
+	// Distinct is the number of distinct values. DistinctCapped indicates
+	// that it reached MaxDistinct, so there may be more.
+	Distinct       int  `json:"distinct"`
+	DistinctCapped bool `json:"distinct_capped,omitempty"`
+
+	// MinLength and MaxLength are the shortest and longest values, in
+	// characters.
+	MinLength int `json:"min_length"`
+	MaxLength int `json:"max_length"`
+
+	// TopValues and Patterns are the most frequent values and value shapes.
+	TopValues []ValueCount `json:"top_values"`
+	Patterns  []ValueCount `json:"patterns"`
+
+	// DateFormats are the date layouts (Go reference-time layouts, as in the
+	// template's "date(2006-01-02)") that every value parses with.
+	DateFormats []string `json:"date_formats,omitempty"`
+
+	// SuggestedType is the most specific template data type every value
+	// passes: "date(...)", "numeric", "decimal(n)", "boolean", "alpha",
+	// "alphanumeric", or "string".
+	SuggestedType string `json:"suggested_type"`
+}
+
+// ValueCount is a value (or pattern) and the number of rows that have it.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// profileDateLayouts are the date layouts tried for each column.
+var profileDateLayouts = []string{
+	"2006-01-02",
+	"01/02/2006",
+	"02/01/2006",
+	"1/2/2006",
+	"2/1/2006",
+	"2006/01/02",
+	"01-02-2006",
+	"02-01-2006",
+	"01/02/06",
+	"02/01/06",
+	"20060102",
+	"02-Jan-2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+	"01/02/2006 15:04:05",
+}
+
+// profileBooleans are the values accepted by the "boolean" data type,
+// except "0" and "1", which suggest a number.
+var profileBooleans = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true,
+	"y": true, "n": true, "t": true, "f": true,
+}
+
+// columnProfiler accumulates the profile of a column.
+type columnProfiler struct {
+	profile  ColumnProfile
+	options  ProfileOptions
+	values   map[string]int
+	patterns map[string]int
+	layouts  []string
+
+	// The data types every value seen so far passes.
+	numeric, decimal, boolean, alpha, alphanumeric bool
+	decimals                                       int
+}
+
+// ProfileData profiles the columns of parsed CSV data.
+//
+// PARAMETERS:
+//   - data: The parsed CSV data.
+//   - options: The profiling options.
+//
+// RETURNS:
+//   - The profile, with the columns in header order.
+func ProfileData(data *CSVData, options ProfileOptions) *Profile {
+	if options.TopValues <= 0 {
+		options.TopValues = 10
+	}
+	if options.MaxDistinct <= 0 {
+		options.MaxDistinct = 100000
+	}
+
+	profile := &Profile{Rows: len(data.Rows)}
+	for _, header := range data.Headers {
+		column := &columnProfiler{
+			profile:  ColumnProfile{Name: header},
+			options:  options,
+			values:   make(map[string]int),
+			patterns: make(map[string]int),
+			layouts:  append([]string(nil), profileDateLayouts...),
+			numeric:  true, decimal: true, boolean: true, alpha: true, alphanumeric: true,
+		}
+		for _, row := range data.Rows {
+			column.add(row[header])
+		}
+		profile.Columns = append(profile.Columns, column.finish(len(data.Rows)))
+	}
+	return profile
+}
+
+// add adds a value of the column.
+func (c *columnProfiler) add(value string) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		c.profile.Empty++
+		return
+	}
+	c.profile.Values++
+
+	length := utf8.RuneCountInString(value)
+	if c.profile.Values == 1 || length < c.profile.MinLength {
+		c.profile.MinLength = length
+	}
+	if length > c.profile.MaxLength {
+		c.profile.MaxLength = length
+	}
+
+	countCapped(c.values, value, c.options.MaxDistinct, &c.profile.DistinctCapped)
+	countCapped(c.patterns, valuePattern(value), c.options.MaxDistinct, nil)
+
+	// Keep the date layouts the value parses with.
+	layouts := c.layouts[:0]
+	for _, layout := range c.layouts {
+		if _, err := time.Parse(layout, trimmed); err == nil {
+			layouts = append(layouts, layout)
+		}
+	}
+	c.layouts = layouts
+
+	if c.numeric {
+		_, err := strconv.ParseInt(trimmed, 10, 64)
+		c.numeric = err == nil
+	}
+	if c.decimal {
+		if _, err := strconv.ParseFloat(trimmed, 64); err != nil {
+			c.decimal = false
+		} else if dot := strings.Index(trimmed, "."); dot >= 0 && len(trimmed)-dot-1 > c.decimals {
+			c.decimals = len(trimmed) - dot - 1
+		}
+	}
+	c.boolean = c.boolean && profileBooleans[strings.ToLower(trimmed)]
+	for _, r := range trimmed {
+		if !unicode.IsLetter(r) && !unicode.IsSpace(r) {
+			c.alpha = false
+			if !unicode.IsDigit(r) {
+				c.alphanumeric = false
+			}
+		}
+	}
+}
+
+// finish completes the profile of the column.
+func (c *columnProfiler) finish(rows int) ColumnProfile {
+	profile := c.profile
+	if rows > 0 {
+		profile.NullRate = float64(profile.Empty) / float64(rows)
+	}
+	profile.Distinct = len(c.values)
+	profile.TopValues = topCounts(c.values, c.options.TopValues)
+	profile.Patterns = topCounts(c.patterns, c.options.TopValues)
+
+	if profile.Values == 0 {
+		profile.SuggestedType = "string"
+		return profile
+	}
+	profile.DateFormats = c.layouts
+
+	switch {
+	case len(c.layouts) > 0:
+		profile.SuggestedType = "date(" + c.layouts[0] + ")"
+	case c.numeric:
+		profile.SuggestedType = "numeric"
+	case c.decimal:
+		profile.SuggestedType = "decimal(" + strconv.Itoa(c.decimals) + ")"
+	case c.boolean:
+		profile.SuggestedType = "boolean"
+	case c.alpha:
+		profile.SuggestedType = "alpha"
+	case c.alphanumeric:
+		profile.SuggestedType = "alphanumeric"
+	default:
+		profile.SuggestedType = "string"
+	}
+	return profile
+}
+
+// countCapped counts a key, unless the count holds max keys and not this
+// one; capped is then set, if given.
+func countCapped(counts map[string]int, key string, max int, capped *bool) {
+	if _, ok := counts[key]; !ok && len(counts) >= max {
+		if capped != nil {
+			*capped = true
+		}
+		return
+	}
+	counts[key]++
+}
+
+// valuePattern returns the shape of a value: letters become "A" and digits
+// "9"; other characters are kept.
+func valuePattern(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r):
+			return 'A'
+		case unicode.IsDigit(r):
+			return '9'
+		default:
+			return r
+		}
+	}, value)
+}
+
+// topCounts returns the n most frequent keys, most frequent first (and in
+// key order for the same count).
+func topCounts(counts map[string]int, n int) []ValueCount {
+	sorted := make([]ValueCount, 0, len(counts))
+	for key, count := range counts {
+		sorted = append(sorted, ValueCount{Value: key, Count: count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Value < sorted[j].Value
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
@@ -0,0 +1,236 @@
+// =============================================================================
+// CSV to XML Converter - Data Lake Export
+// =============================================================================
+//
+// This package exports the rows of converted files for analytics: the
+// values as they were transformed, validated, and delivered, not as they
+// arrived. The export is configured once for all departments:
+//
+//   data_lake:
+//     dir: s3://analytics/cashbook
+//     format: parquet          # or csv
+//
+// Each converted file becomes one file in a Hive-style partition of its
+// department and conversion date:
+//
+//   <dir>/department=CLAIMS/date=2024-01-15/<output name>.parquet
+//
+// Besides the CSV columns, every row has the columns _department,
+// _source_file, _output_file, _converted_at, _transaction, _line_item, and
+// _row (the CSV row number), so a row can be traced to its input and output.
+// In Parquet, the CSV columns are optional strings (empty values are null);
+// in CSV, every value is written as it is.
+//
+// =============================================================================
+
+package datalake
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/pkg/utils"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+// Export is the rows of one converted file (or of one document of a
+// template selector).
+type Export struct {
+	// Department is the department code.
+	Department string
+
+	// SourceFile and OutputFile are the names of the input file and of the
+	// output file the rows were delivered in.
+	SourceFile string
+	OutputFile string
+
+	// ConvertedAt is when the file was converted. Its date selects the
+	// partition.
+	ConvertedAt time.Time
+
+	// Columns are the CSV columns, in the order they are written.
+	Columns []string
+
+	// Rows are the rows, in output order.
+	Rows []Row
+}
+
+// Row is an exported row: a line item, or a transaction without line items.
+type Row struct {
+	// Transaction and LineItem are the numbers of the transaction and
+	// line item in the output. LineItem is 0 for a transaction without
+	// line items.
+	Transaction int
+	LineItem    int
+
+	// SourceRow is the row number in the input file.
+	SourceRow int
+
+	// Fields are the values by CSV column.
+	Fields map[string]string
+}
+
+// metadataColumns are the columns written before the CSV columns.
+var metadataColumns = []string{"_department", "_source_file", "_output_file", "_converted_at", "_transaction", "_line_item", "_row"}
+
+// Write writes an export to its partition. The file is written under a
+// temporary name and renamed, so readers never see a partial file.
+//
+// PARAMETERS:
+//   - settings: The data lake settings.
+//   - export: The rows of the file.
+//
+// RETURNS:
+//   - The path of the written file.
+//   - An error if a CSV column has the name of a metadata column, or the
+//     file cannot be written.
+func Write(settings config.DataLakeSettings, export Export) (string, error) {
+	for _, column := range export.Columns {
+		for _, reserved := range metadataColumns {
+			if column == reserved {
+				return "", fmt.Errorf("column %s has the name of a data lake metadata column", column)
+			}
+		}
+	}
+
+	dir := filepath.Join(settings.Dir,
+		"department="+export.Department,
+		"date="+export.ConvertedAt.Format("2006-01-02"))
+	if err := os.MkdirAll(utils.LongPath(dir), 0755); err != nil {
+		return "", fmt.Errorf("failed to create data lake partition: %w", err)
+	}
+
+	name := strings.TrimSuffix(export.OutputFile, filepath.Ext(export.OutputFile)) + "." + settings.Format
+	path := filepath.Join(dir, name)
+	tempPath := path + ".tmp"
+
+	file, err := os.Create(utils.LongPath(tempPath))
+	if err != nil {
+		return "", fmt.Errorf("failed to create data lake file: %w", err)
+	}
+	if settings.Format == config.DataLakeCSV {
+		err = writeCSV(file, export)
+	} else {
+		err = writeParquet(file, export, settings.Compression)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(utils.LongPath(tempPath), utils.LongPath(path))
+	}
+	if err != nil {
+		os.Remove(utils.LongPath(tempPath))
+		return "", fmt.Errorf("failed to write data lake file: %w", err)
+	}
+	return path, nil
+}
+
+// writeCSV writes the rows as normalized CSV: UTF-8, comma-separated, with
+// a header line, the metadata columns first.
+func writeCSV(file *os.File, export Export) error {
+	writer := csv.NewWriter(file)
+	if err := writer.Write(append(append([]string{}, metadataColumns...), export.Columns...)); err != nil {
+		return err
+	}
+
+	convertedAt := export.ConvertedAt.UTC().Format(time.RFC3339)
+	record := make([]string, len(metadataColumns)+len(export.Columns))
+	for _, row := range export.Rows {
+		lineItem := ""
+		if row.LineItem > 0 {
+			lineItem = strconv.Itoa(row.LineItem)
+		}
+		copy(record, []string{export.Department, export.SourceFile, export.OutputFile, convertedAt,
+			strconv.Itoa(row.Transaction), lineItem, strconv.Itoa(row.SourceRow)})
+		for i, column := range export.Columns {
+			record[len(metadataColumns)+i] = row.Fields[column]
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeParquet writes the rows as a Parquet file with one row group.
+func writeParquet(file *os.File, export Export, compression string) error {
+	group := parquet.Group{
+		"_department":   parquet.String(),
+		"_source_file":  parquet.String(),
+		"_output_file":  parquet.String(),
+		"_converted_at": parquet.Timestamp(parquet.Millisecond),
+		"_transaction":  parquet.Int(64),
+		"_line_item":    parquet.Optional(parquet.Int(64)),
+		"_row":          parquet.Int(64),
+	}
+	for _, column := range export.Columns {
+		group[column] = parquet.Optional(parquet.String())
+	}
+	schema := parquet.NewSchema("row", group)
+
+	var codec compress.Codec
+	switch compression {
+	case "gzip":
+		codec = &parquet.Gzip
+	case "zstd":
+		codec = &parquet.Zstd
+	case "none":
+		codec = &parquet.Uncompressed
+	default:
+		codec = &parquet.Snappy
+	}
+	writer := parquet.NewWriter(file, schema, parquet.Compression(codec))
+
+	// The columns of a group are ordered by name; each row has a value per
+	// column, in that order.
+	fields := schema.Fields()
+	convertedAt := export.ConvertedAt.UnixMilli()
+	rows := make([]parquet.Row, len(export.Rows))
+	for r, row := range export.Rows {
+		values := make(parquet.Row, len(fields))
+		for i, field := range fields {
+			switch field.Name() {
+			case "_department":
+				values[i] = parquet.ByteArrayValue([]byte(export.Department)).Level(0, 0, i)
+			case "_source_file":
+				values[i] = parquet.ByteArrayValue([]byte(export.SourceFile)).Level(0, 0, i)
+			case "_output_file":
+				values[i] = parquet.ByteArrayValue([]byte(export.OutputFile)).Level(0, 0, i)
+			case "_converted_at":
+				values[i] = parquet.Int64Value(convertedAt).Level(0, 0, i)
+			case "_transaction":
+				values[i] = parquet.Int64Value(int64(row.Transaction)).Level(0, 0, i)
+			case "_line_item":
+				if row.LineItem > 0 {
+					values[i] = parquet.Int64Value(int64(row.LineItem)).Level(0, 1, i)
+				} else {
+					values[i] = parquet.NullValue().Level(0, 0, i)
+				}
+			case "_row":
+				values[i] = parquet.Int64Value(int64(row.SourceRow)).Level(0, 0, i)
+			default:
+				if value := row.Fields[field.Name()]; value != "" {
+					values[i] = parquet.ByteArrayValue([]byte(value)).Level(0, 1, i)
+				} else {
+					values[i] = parquet.NullValue().Level(0, 0, i)
+				}
+			}
+		}
+		rows[r] = values
+	}
+
+	if _, err := writer.WriteRows(rows); err != nil {
+		return err
+	}
+	return writer.Close()
+}
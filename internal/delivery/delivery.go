@@ -0,0 +1,70 @@
+// =============================================================================
+// CSV to XML Converter - Output Delivery
+// =============================================================================
+//
+// This package delivers generated XML files to the target system. Each
+// department selects a delivery plugin in its configuration:
+//
+//   delivery:
+//     type: http
+//     url: https://erp.example.com/api/v1/cashbook/import
+//
+// A file counts as converted only after it has been delivered. If delivery
+// fails, the input file stays in the input directory and is converted and
+// delivered again by the next run.
+//
+// CUSTOMIZATION:
+//   To add a plugin, implement the Deliverer interface and register its type
+//   in New.
+//
+// =============================================================================
+
+package delivery
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+)
+
+// Receipt describes a successful delivery.
+type Receipt struct {
+	// Target is where the file was delivered (e.g., the endpoint URL).
+	Target string
+
+	// BatchID is the identifier assigned by the target system, if it
+	// returned one.
+	BatchID string
+
+	// StatusCode is the HTTP status code of the accepted request.
+	StatusCode int
+
+	// Attempts is the number of attempts it took.
+	Attempts int
+}
+
+// Deliverer delivers generated files to a target system.
+type Deliverer interface {
+	// Deliver sends the file at path and returns the receipt.
+	Deliver(ctx context.Context, path string) (Receipt, error)
+}
+
+// New creates the deliverer configured for a department.
+//
+// PARAMETERS:
+//   - settings: The department's delivery settings.
+//
+// RETURNS:
+//   - The deliverer, or nil if delivery is not configured.
+//   - An error if the delivery type is unknown.
+func New(settings config.DeliverySettings) (Deliverer, error) {
+	switch settings.Type {
+	case "":
+		return nil, nil
+	case "http":
+		return NewHTTPDeliverer(settings), nil
+	default:
+		return nil, fmt.Errorf("unsupported delivery type: %s", settings.Type)
+	}
+}
@@ -0,0 +1,271 @@
+package delivery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+)
+
+// =============================================================================
+// HTTP DELIVERY
+// =============================================================================
+
+// maxRetryAfter caps the wait requested by a Retry-After header.
+const maxRetryAfter = 5 * time.Minute
+
+// HTTPDeliverer sends files to a REST endpoint.
+//
+// BEHAVIOR:
+//   - The file is streamed as the request body.
+//   - With OAuth2 configured, a bearer token from the client-credentials
+//     grant is sent. A 401 response renews the token once.
+//   - Network errors, timeouts, HTTP 408, 429, and 5xx are retried with
+//     exponential backoff (or the server's Retry-After). Other responses
+//     fail immediately.
+//   - The SHA-256 of the file content is sent as the Idempotency-Key
+//     header, so a target that supports it ignores a retried request that
+//     did arrive. Outputs with the same name on different days have
+//     different keys.
+//   - Any 2xx response means the file was delivered, even if its body
+//     cannot be read (the batch ID is then taken from what was read).
+type HTTPDeliverer struct {
+	settings config.DeliverySettings
+	client   *http.Client
+	tokens   *tokenSource
+}
+
+// NewHTTPDeliverer creates an HTTP deliverer.
+func NewHTTPDeliverer(settings config.DeliverySettings) *HTTPDeliverer {
+	client := &http.Client{Timeout: settings.Timeout}
+
+	d := &HTTPDeliverer{settings: settings, client: client}
+	if settings.OAuth2.TokenURL != "" {
+		d.tokens = &tokenSource{settings: settings.OAuth2, client: client}
+	}
+	return d
+}
+
+// Deliver sends the file and extracts the batch ID from the response.
+//
+// PARAMETERS:
+//   - ctx: Cancels the delivery, including retry waits.
+//   - path: The file to send.
+//
+// RETURNS:
+//   - The receipt of the accepted request.
+//   - An error if the file was not accepted after all attempts.
+func (d *HTTPDeliverer) Deliver(ctx context.Context, path string) (Receipt, error) {
+	receipt := Receipt{Target: d.settings.URL}
+	delay := d.settings.RetryDelay
+	renewedToken := false
+
+	// Every attempt sends the same key.
+	key, err := idempotencyKey(path)
+	if err != nil {
+		return receipt, fmt.Errorf("delivery to %s failed: %w", d.settings.URL, err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		receipt.Attempts = attempt
+
+		resp, err := d.send(ctx, path, key)
+		if err == nil {
+			body, readErr := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+			resp.Body.Close()
+
+			switch {
+			case resp.StatusCode >= 200 && resp.StatusCode < 300:
+				// The file arrived; retrying it would deliver it twice.
+				receipt.StatusCode = resp.StatusCode
+				receipt.BatchID = d.batchID(resp.Header, body)
+				return receipt, nil
+
+			case resp.StatusCode == http.StatusUnauthorized && d.tokens != nil && !renewedToken:
+				// The token may have been revoked; renew it once.
+				d.tokens.Invalidate()
+				renewedToken = true
+				attempt--
+				continue
+			}
+
+			err = &statusError{status: resp.Status, code: resp.StatusCode, body: strings.TrimSpace(string(body))}
+			if readErr != nil {
+				err = fmt.Errorf("failed to read response: %w", readErr)
+			}
+			if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > 0 {
+				delay = retryAfter
+			}
+		}
+
+		if attempt >= d.settings.RetryAttempts || !retryable(err) {
+			return receipt, fmt.Errorf("delivery to %s failed after %d attempt(s): %w", d.settings.URL, attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return receipt, fmt.Errorf("delivery to %s cancelled: %w", d.settings.URL, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// send performs a single request, with key as the Idempotency-Key header.
+func (d *HTTPDeliverer) send(ctx context.Context, path, key string) (*http.Response, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, &permanentError{fmt.Errorf("failed to open %s: %w", path, err)}
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, &permanentError{fmt.Errorf("failed to read %s: %w", path, err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, d.settings.Method, d.settings.URL, file)
+	if err != nil {
+		return nil, &permanentError{fmt.Errorf("failed to create request: %w", err)}
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", d.settings.ContentType)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	for name, value := range d.settings.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if d.tokens != nil {
+		accessToken, err := d.tokens.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	return d.client.Do(req)
+}
+
+// idempotencyKey returns the hex SHA-256 of a file's content.
+func idempotencyKey(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// batchID extracts the batch ID from the response header or JSON body.
+func (d *HTTPDeliverer) batchID(header http.Header, body []byte) string {
+	if d.settings.BatchIDHeader != "" {
+		if value := header.Get(d.settings.BatchIDHeader); value != "" {
+			return value
+		}
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+
+	// Follow the dotted field path through nested objects.
+	for _, key := range strings.Split(d.settings.BatchIDField, ".") {
+		object, ok := payload.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		payload = object[key]
+	}
+
+	switch value := payload.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// =============================================================================
+// ERRORS
+// =============================================================================
+
+// statusError is an unsuccessful HTTP response.
+type statusError struct {
+	status string
+	code   int
+	body   string
+}
+
+func (e *statusError) Error() string {
+	if e.body == "" {
+		return "server returned " + e.status
+	}
+	if len(e.body) > 500 {
+		return fmt.Sprintf("server returned %s: %s...", e.status, e.body[:500])
+	}
+	return fmt.Sprintf("server returned %s: %s", e.status, e.body)
+}
+
+// permanentError is an error that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// retryable reports whether a failed attempt should be retried.
+func retryable(err error) bool {
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code == http.StatusRequestTimeout ||
+			status.code == http.StatusTooManyRequests ||
+			status.code >= 500
+	}
+
+	// Network errors, timeouts, and token endpoint failures.
+	return true
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = time.Until(date)
+	}
+
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	return wait
+}
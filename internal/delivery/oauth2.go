@@ -0,0 +1,125 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+)
+
+// =============================================================================
+// OAUTH2 CLIENT CREDENTIALS
+// =============================================================================
+
+// tokenExpiryMargin renews tokens this long before they expire.
+const tokenExpiryMargin = 30 * time.Second
+
+// token is a cached access token.
+type token struct {
+	value   string
+	expires time.Time
+}
+
+// tokenCache shares access tokens between the converters of a run, keyed
+// by token URL and client ID.
+var tokenCache = struct {
+	sync.Mutex
+	tokens map[string]token
+}{tokens: make(map[string]token)}
+
+// tokenSource fetches access tokens with the client-credentials grant.
+type tokenSource struct {
+	settings config.OAuth2Settings
+	client   *http.Client
+}
+
+// cacheKey identifies the token of this client.
+func (s *tokenSource) cacheKey() string {
+	return s.settings.TokenURL + "|" + s.settings.ClientID
+}
+
+// Token returns a cached token, or fetches a new one when there is none or
+// it is about to expire.
+func (s *tokenSource) Token(ctx context.Context) (string, error) {
+	tokenCache.Lock()
+	defer tokenCache.Unlock()
+
+	if cached, ok := tokenCache.tokens[s.cacheKey()]; ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	fetched, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	tokenCache.tokens[s.cacheKey()] = fetched
+	return fetched.value, nil
+}
+
+// Invalidate drops the cached token, e.g., after the API rejected it.
+func (s *tokenSource) Invalidate() {
+	tokenCache.Lock()
+	defer tokenCache.Unlock()
+	delete(tokenCache.tokens, s.cacheKey())
+}
+
+// fetch requests a new token from the token endpoint.
+func (s *tokenSource) fetch(ctx context.Context) (token, error) {
+	secret := s.settings.ClientSecret
+	if secret == "" && s.settings.ClientSecretEnv != "" {
+		secret = os.Getenv(s.settings.ClientSecretEnv)
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.settings.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.settings.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.settings.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return token{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(s.settings.ClientID), url.QueryEscape(secret))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return token{}, fmt.Errorf("failed to request access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		// Rejected credentials do not get better by retrying.
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return token{}, &permanentError{err}
+		}
+		return token{}, err
+	}
+
+	var payload struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.AccessToken == "" {
+		return token{}, fmt.Errorf("token endpoint returned no access token")
+	}
+
+	// Tokens without an expiry are renewed hourly.
+	lifetime := time.Hour
+	if payload.ExpiresIn > 0 {
+		lifetime = time.Duration(payload.ExpiresIn) * time.Second
+	}
+
+	return token{value: payload.AccessToken, expires: time.Now().Add(lifetime - tokenExpiryMargin)}, nil
+}
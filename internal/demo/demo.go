@@ -0,0 +1,85 @@
+// =============================================================================
+// CSV to XML Converter - Demo Workspace
+// =============================================================================
+//
+// The binary carries a small working setup (see assets/): a main
+// configuration, one department, and an example template. 'converter demo'
+// writes it to a directory, generates sample input for the template, and
+// converts it, so new operators can see a full conversion without preparing
+// anything:
+//
+//   config.yaml                    directories relative to the workspace
+//   configs/demo.yaml              the DEMO department (demo_*.csv)
+//   templates/demo_payments.xlsx   the example template
+//
+// =============================================================================
+
+package demo
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+//go:embed assets
+var assets embed.FS
+
+const (
+	// ConfigFile is the main configuration of a workspace.
+	ConfigFile = "config.yaml"
+
+	// Template is the name of the example template.
+	Template = "demo_payments.xlsx"
+
+	// Department is the code of the demo department.
+	Department = "DEMO"
+)
+
+// Files returns the paths of the files Install writes, relative to the
+// workspace, in order.
+func Files() []string {
+	var files []string
+	fs.WalkDir(assets, "assets", func(name string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			relative := name[len("assets/"):]
+			files = append(files, filepath.FromSlash(relative))
+		}
+		return err
+	})
+	return files
+}
+
+// Install writes the demo configuration and template to a workspace
+// directory. Existing files are not overwritten.
+//
+// PARAMETERS:
+//   - dir: The workspace. It is created if necessary.
+//
+// RETURNS:
+//   - An error if one of the files exists or cannot be written.
+func Install(dir string) error {
+	for _, file := range Files() {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			return fmt.Errorf("%s already exists; choose an empty directory", filepath.Join(dir, file))
+		}
+	}
+
+	for _, file := range Files() {
+		data, err := assets.ReadFile(path.Join("assets", filepath.ToSlash(file)))
+		if err != nil {
+			return fmt.Errorf("failed to read embedded %s: %w", file, err)
+		}
+		target := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", file, err)
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+	}
+	return nil
+}
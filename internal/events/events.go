@@ -0,0 +1,110 @@
+// =============================================================================
+// CSV to XML Converter - Conversion Events
+// =============================================================================
+//
+// This package publishes a message to Kafka or RabbitMQ for every converted
+// file (or every transaction in it), so downstream services can react to new
+// output without polling directories.
+//
+// Messages are JSON:
+//
+//   {
+//     "type": "file.converted",
+//     "time": "2024-01-15T10:30:00Z",
+//     "file": "claims_payments_20240115.csv",
+//     "department": "CLAIMS",
+//     "output_file": "output/CLAIMS_20240115_103000.xml",
+//     "rows": 120,
+//     "transactions": 42,
+//     "batch_id": "B-1001",
+//     "payload": "<cashbook>...</cashbook>"       (include_payload only)
+//   }
+//
+// Transaction messages ("transaction.converted") also carry a "transaction"
+// object with the transaction number, group key, and line item count.
+//
+// =============================================================================
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+)
+
+// Event types.
+const (
+	TypeFileConverted        = "file.converted"
+	TypeTransactionConverted = "transaction.converted"
+)
+
+// Event is a single published message.
+type Event struct {
+	Type           string           `json:"type"`
+	Time           time.Time        `json:"time"`
+	File           string           `json:"file"`
+	Department     string           `json:"department"`
+	OutputFile     string           `json:"output_file"`
+	Rows           int              `json:"rows"`
+	Transactions   int              `json:"transactions"`
+	DeliveryTarget string           `json:"delivery_target,omitempty"`
+	BatchID        string           `json:"batch_id,omitempty"`
+	Transaction    *TransactionInfo `json:"transaction,omitempty"`
+	Payload        string           `json:"payload,omitempty"`
+}
+
+// TransactionInfo identifies the transaction of a transaction event.
+type TransactionInfo struct {
+	ID        int    `json:"id"`
+	GroupKey  string `json:"group_key"`
+	LineItems int    `json:"line_items"`
+}
+
+// Key returns the message key. Events with the same key keep their order in
+// Kafka: transactions are keyed by group key, files by department.
+func (e Event) Key() string {
+	if e.Transaction != nil {
+		return e.Department + "/" + e.Transaction.GroupKey
+	}
+	return e.Department
+}
+
+// Publisher publishes events. Implementations are safe for concurrent use.
+type Publisher interface {
+	// Publish sends the events and waits until the broker has accepted them.
+	Publish(ctx context.Context, events []Event) error
+
+	// Close flushes and closes the connection.
+	Close() error
+}
+
+// New creates the publisher configured in the main configuration.
+//
+// PARAMETERS:
+//   - settings: The event settings.
+//
+// RETURNS:
+//   - The publisher, or nil if publishing is not configured.
+//   - An error if the broker connection cannot be set up.
+func New(settings config.EventSettings) (Publisher, error) {
+	switch settings.Type {
+	case "":
+		return nil, nil
+	case "kafka":
+		return newKafkaPublisher(settings)
+	case "rabbitmq":
+		return newRabbitMQPublisher(settings)
+	default:
+		return nil, fmt.Errorf("unsupported event publisher: %s", settings.Type)
+	}
+}
+
+// expandRoutingKey replaces the {dept} and {event} placeholders.
+func expandRoutingKey(format string, event Event) string {
+	key := strings.ReplaceAll(format, "{dept}", event.Department)
+	return strings.ReplaceAll(key, "{event}", event.Type)
+}
@@ -0,0 +1,94 @@
+package events
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// kafkaPublisher publishes events to a Kafka topic.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// newKafkaPublisher creates a Kafka publisher. The connection is opened on
+// the first publish.
+func newKafkaPublisher(settings config.EventSettings) (Publisher, error) {
+	transport := &kafka.Transport{}
+	if settings.TLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if settings.SASLMechanism != "" {
+		mechanism, err := saslMechanism(settings)
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = mechanism
+	}
+
+	writer := &kafka.Writer{
+		Addr:  kafka.TCP(settings.Brokers...),
+		Topic: settings.Topic,
+		// Messages with the same key go to the same partition, in order.
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
+		Transport:    transport,
+	}
+
+	return &kafkaPublisher{writer: writer}, nil
+}
+
+// Publish writes the events and waits for all in-sync replicas.
+func (p *kafkaPublisher) Publish(ctx context.Context, events []Event) error {
+	messages := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		messages = append(messages, kafka.Message{
+			Key:   []byte(event.Key()),
+			Value: value,
+			Headers: []kafka.Header{
+				{Key: "type", Value: []byte(event.Type)},
+			},
+		})
+	}
+
+	if err := p.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("failed to publish to Kafka topic %s: %w", p.writer.Topic, err)
+	}
+	return nil
+}
+
+// Close flushes pending messages and closes the connections.
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// saslMechanism creates the configured SASL mechanism.
+func saslMechanism(settings config.EventSettings) (sasl.Mechanism, error) {
+	password := os.Getenv(settings.SASLPasswordEnv)
+
+	switch settings.SASLMechanism {
+	case "plain":
+		return plain.Mechanism{Username: settings.SASLUsername, Password: password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, settings.SASLUsername, password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, settings.SASLUsername, password)
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism: %s", settings.SASLMechanism)
+	}
+}
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// rabbitMQPublisher publishes events to a RabbitMQ topic exchange.
+//
+// Messages are persistent and published with publisher confirms, so Publish
+// returns only after the broker has taken responsibility for them. A lost
+// connection is re-established on the next publish.
+type rabbitMQPublisher struct {
+	settings config.EventSettings
+	url      string
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+// newRabbitMQPublisher creates a RabbitMQ publisher. The connection is opened
+// on the first publish, so a broker outage does not stop the converter.
+func newRabbitMQPublisher(settings config.EventSettings) (Publisher, error) {
+	url := settings.URL
+	if url == "" {
+		url = os.Getenv(settings.URLEnv)
+	}
+	if url == "" {
+		return nil, fmt.Errorf("RabbitMQ URL is not set (environment variable %s is empty)", settings.URLEnv)
+	}
+
+	return &rabbitMQPublisher{settings: settings, url: url}, nil
+}
+
+// connect opens the connection, declares the exchange, and opens a
+// confirming channel. The caller must hold p.mu.
+func (p *rabbitMQPublisher) connect() error {
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+
+	if err := channel.ExchangeDeclare(p.settings.Exchange, "topic", true, false, false, false, nil); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to declare exchange %s: %w", p.settings.Exchange, err)
+	}
+
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	p.conn = conn
+	p.channel = channel
+	return nil
+}
+
+// Publish sends the events and waits for the broker's confirmations.
+func (p *rabbitMQPublisher) Publish(ctx context.Context, events []Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil || p.conn.IsClosed() {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	confirms := make([]*amqp.DeferredConfirmation, 0, len(events))
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+
+		confirm, err := p.channel.PublishWithDeferredConfirmWithContext(ctx,
+			p.settings.Exchange,
+			expandRoutingKey(p.settings.RoutingKey, event),
+			false, false,
+			amqp.Publishing{
+				ContentType:  "application/json",
+				DeliveryMode: amqp.Persistent,
+				Timestamp:    event.Time,
+				Type:         event.Type,
+				Body:         body,
+			})
+		if err != nil {
+			return fmt.Errorf("failed to publish to RabbitMQ exchange %s: %w", p.settings.Exchange, err)
+		}
+		confirms = append(confirms, confirm)
+	}
+
+	for _, confirm := range confirms {
+		acked, err := confirm.WaitContext(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to confirm RabbitMQ publish: %w", err)
+		}
+		if !acked {
+			return fmt.Errorf("RabbitMQ rejected an event on exchange %s", p.settings.Exchange)
+		}
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (p *rabbitMQPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil || p.conn.IsClosed() {
+		return nil
+	}
+	return p.conn.Close()
+}
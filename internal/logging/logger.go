@@ -0,0 +1,230 @@
+// =============================================================================
+// CSV to XML Converter - Logging Module
+// =============================================================================
+//
+// This module provides the application logger. It implements the Logger
+// interface used by the converter and adds:
+//   - Level filtering ("debug", "info", "warn", "error")
+//   - Text ("[INFO] message") or JSON Lines output, for log shippers
+//   - Optional forwarding to the operating system log:
+//       * syslog on Linux/Unix (journald picks this up under systemd)
+//       * the Windows Event Log when running as a Windows service
+//
+// USAGE:
+//   logger, err := logging.New(logging.Options{Level: "info", SystemLog: true})
+//   defer logger.Close()
+//   logger.Info("Processed %d files", count)
+//
+// =============================================================================
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// LEVELS
+// =============================================================================
+
+// Level is the severity of a log message.
+type Level int
+
+const (
+	// LevelDebug is for detailed diagnostic messages.
+	LevelDebug Level = iota
+
+	// LevelInfo is for normal operational messages.
+	LevelInfo
+
+	// LevelWarn is for recoverable problems.
+	LevelWarn
+
+	// LevelError is for failures.
+	LevelError
+)
+
+// String returns the label printed in front of messages of this level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// ParseLevel converts a configuration value to a Level.
+//
+// PARAMETERS:
+//   - value: "debug", "info", "warn"/"warning", or "error" (case-insensitive).
+//
+// RETURNS:
+//   - The matching Level. Empty values default to LevelInfo.
+//   - An error if the value is not recognized.
+func ParseLevel(value string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level: %s", value)
+	}
+}
+
+// =============================================================================
+// OPTIONS
+// =============================================================================
+
+// Options configures a Logger.
+type Options struct {
+	// Level is the minimum level that is logged (e.g., "info").
+	Level string
+
+	// Output receives the formatted messages. Default: os.Stdout
+	Output io.Writer
+
+	// Format is the message format: "text" ("[INFO] message") or "json"
+	// (one {"time", "level", "msg"} object per line).
+	// Default: "text"
+	Format string
+
+	// SystemLog forwards messages to syslog (Unix) or the Event Log (Windows).
+	SystemLog bool
+
+	// Source is the syslog tag / Event Log source name.
+	// Default: "csv2xml"
+	Source string
+}
+
+// =============================================================================
+// LOGGER
+// =============================================================================
+
+// Logger writes leveled messages to an output and, optionally, the system log.
+// It is safe for concurrent use.
+type Logger struct {
+	level  Level
+	output io.Writer
+	json   bool
+	system systemLog
+	mu     sync.Mutex
+}
+
+// systemLog is implemented by the platform-specific system log backends.
+type systemLog interface {
+	Write(level Level, msg string) error
+	Close() error
+}
+
+// New creates a new Logger.
+//
+// PARAMETERS:
+//   - options: The logger options.
+//
+// RETURNS:
+//   - A new Logger.
+//   - An error if the level is invalid or the system log cannot be opened.
+func New(options Options) (*Logger, error) {
+	level, err := ParseLevel(options.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Output == nil {
+		options.Output = os.Stdout
+	}
+	if options.Source == "" {
+		options.Source = "csv2xml"
+	}
+	if options.Format != "" && options.Format != "text" && options.Format != "json" {
+		return nil, fmt.Errorf("unknown log format: %s", options.Format)
+	}
+
+	logger := &Logger{
+		level:  level,
+		output: options.Output,
+		json:   options.Format == "json",
+	}
+
+	if options.SystemLog {
+		system, err := openSystemLog(options.Source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open system log: %w", err)
+		}
+		logger.system = system
+	}
+
+	return logger, nil
+}
+
+// Debug logs a debug message.
+func (l *Logger) Debug(msg string, args ...interface{}) {
+	l.log(LevelDebug, msg, args...)
+}
+
+// Info logs an informational message.
+func (l *Logger) Info(msg string, args ...interface{}) {
+	l.log(LevelInfo, msg, args...)
+}
+
+// Warn logs a warning.
+func (l *Logger) Warn(msg string, args ...interface{}) {
+	l.log(LevelWarn, msg, args...)
+}
+
+// Error logs an error.
+func (l *Logger) Error(msg string, args ...interface{}) {
+	l.log(LevelError, msg, args...)
+}
+
+// Close releases the system log, if any.
+func (l *Logger) Close() error {
+	if l.system != nil {
+		return l.system.Close()
+	}
+	return nil
+}
+
+// log formats and writes a message if its level is enabled.
+func (l *Logger) log(level Level, msg string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+
+	text := fmt.Sprintf(msg, args...)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.json {
+		line, _ := json.Marshal(struct {
+			Time  time.Time `json:"time"`
+			Level string    `json:"level"`
+			Msg   string    `json:"msg"`
+		}{time.Now(), strings.ToLower(level.String()), text})
+		fmt.Fprintf(l.output, "%s\n", line)
+	} else {
+		fmt.Fprintf(l.output, "[%s] %s\n", level, text)
+	}
+
+	if l.system != nil {
+		// The system log is best effort; the message was already written above.
+		_ = l.system.Write(level, text)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+
+// =============================================================================
+// CSV to XML Converter - Syslog Backend
+// =============================================================================
+//
+// Forwards log messages to the local syslog daemon. Under systemd, syslog
+// messages end up in the journal (journalctl -t csv2xml).
+//
+// =============================================================================
+
+package logging
+
+import (
+	"log/syslog"
+)
+
+// syslogBackend writes messages to syslog.
+type syslogBackend struct {
+	writer *syslog.Writer
+}
+
+// openSystemLog connects to the local syslog daemon.
+func openSystemLog(source string) (systemLog, error) {
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, source)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogBackend{writer: writer}, nil
+}
+
+// Write sends a message with the matching syslog priority.
+func (b *syslogBackend) Write(level Level, msg string) error {
+	switch level {
+	case LevelDebug:
+		return b.writer.Debug(msg)
+	case LevelInfo:
+		return b.writer.Info(msg)
+	case LevelWarn:
+		return b.writer.Warning(msg)
+	default:
+		return b.writer.Err(msg)
+	}
+}
+
+// Close closes the syslog connection.
+func (b *syslogBackend) Close() error {
+	return b.writer.Close()
+}
@@ -0,0 +1,58 @@
+//go:build windows
+
+// =============================================================================
+// CSV to XML Converter - Windows Event Log Backend
+// =============================================================================
+//
+// Forwards log messages to the Windows Event Log (Application log). The
+// event source is registered by "converter service install".
+//
+// =============================================================================
+
+package logging
+
+import (
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Event IDs used for each level. The generic EventCreate message file
+// accepts IDs between 1 and 1000.
+const (
+	eventIDInfo  = 1
+	eventIDWarn  = 2
+	eventIDError = 3
+)
+
+// eventLogBackend writes messages to the Windows Event Log.
+type eventLogBackend struct {
+	log *eventlog.Log
+}
+
+// openSystemLog opens the Event Log source.
+func openSystemLog(source string) (systemLog, error) {
+	log, err := eventlog.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogBackend{log: log}, nil
+}
+
+// Write sends a message with the matching event type.
+// Debug messages are not sent to the Event Log.
+func (b *eventLogBackend) Write(level Level, msg string) error {
+	switch level {
+	case LevelDebug:
+		return nil
+	case LevelInfo:
+		return b.log.Info(eventIDInfo, msg)
+	case LevelWarn:
+		return b.log.Warning(eventIDWarn, msg)
+	default:
+		return b.log.Error(eventIDError, msg)
+	}
+}
+
+// Close closes the Event Log handle.
+func (b *eventLogBackend) Close() error {
+	return b.log.Close()
+}
@@ -0,0 +1,85 @@
+// =============================================================================
+// CSV to XML Converter - Sensitive Field Masking
+// =============================================================================
+//
+// Some CSVs carry SSNs or bank account numbers. They must flow unmasked into
+// the XML, but must not end up in logs, error reports, or archives. A
+// department marks such fields as sensitive:
+//
+//   sensitive_fields:
+//     - field: SSN              # last 4 characters stay visible
+//     - field: BANK_ACCOUNT
+//       mask: full             # nothing stays visible
+//
+// "123-45-6789" is masked as "*******6789" ("last4") or "***********"
+// ("full"). A value of 4 characters or less is always masked fully.
+//
+// =============================================================================
+
+package masking
+
+import (
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+)
+
+// maskChar replaces the masked characters.
+const maskChar = "*"
+
+// Masker masks the values of a department's sensitive fields. A nil Masker
+// masks nothing.
+type Masker struct {
+	// policies holds the masking policy of each sensitive field (CSV column).
+	policies map[string]string
+}
+
+// New creates a Masker for the sensitive fields.
+//
+// RETURNS:
+//   - The Masker, or nil if no field is sensitive.
+func New(fields []config.SensitiveField) *Masker {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	m := &Masker{policies: make(map[string]string, len(fields))}
+	for _, field := range fields {
+		m.policies[field.Field] = field.Mask
+	}
+	return m
+}
+
+// Sensitive reports whether the field is sensitive.
+func (m *Masker) Sensitive(field string) bool {
+	if m == nil {
+		return false
+	}
+	_, ok := m.policies[field]
+	return ok
+}
+
+// Value returns the value of a field as it may be shown: masked if the field
+// is sensitive, as is otherwise.
+func (m *Masker) Value(field, value string) string {
+	if !m.Sensitive(field) || value == "" {
+		return value
+	}
+
+	runes := []rune(value)
+	visible := 0
+	if m.policies[field] == "last4" && len(runes) > 4 {
+		visible = 4
+	}
+	return strings.Repeat(maskChar, len(runes)-visible) + string(runes[len(runes)-visible:])
+}
+
+// Fields returns a copy of a row with the values of the sensitive fields
+// masked.
+func (m *Masker) Fields(fields map[string]string) map[string]string {
+	masked := make(map[string]string, len(fields))
+	for field, value := range fields {
+		masked[field] = m.Value(field, value)
+	}
+	return masked
+}
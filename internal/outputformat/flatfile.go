@@ -0,0 +1,304 @@
+// =============================================================================
+// CSV to XML Converter - Flat File Format
+// =============================================================================
+//
+// A flat file has one detail record per line item (or per transaction),
+// optionally between a header and a trailer record. Records are fixed-width
+// or delimited, as the receiving system expects:
+//
+//   delimiter: ""            # fixed-width; "|" or "," for delimited
+//   line_ending: crlf        # lf (default) or crlf
+//   extension: ".dat"        # Default: ".txt"
+//   record: line_item        # line_item (default) or transaction
+//   header:
+//     - {value: "H"}
+//     - {value: "{date}", width: 8}
+//   detail:
+//     - {value: "D"}
+//     - {field: POLICY_NO, width: 10}
+//     - {field: CHECK_AMT, width: 12, align: right, pad: "0", decimals: 2}
+//   trailer:
+//     - {value: "T"}
+//     - {value: "{records}", width: 6, align: right, pad: "0"}
+//     - {sum: CHECK_AMT, width: 15, align: right, pad: "0", decimals: 2}
+//
+// Header and trailer values are taken over the whole document, and their
+// literals may use {records} (the number of detail records) and
+// {transactions}. With decimals, a number is written with that many
+// implied decimal places and no decimal point (12.5 with decimals 2 is
+// "1250"). A value longer than its width fails the file instead of being
+// cut off.
+//
+// =============================================================================
+
+package outputformat
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+)
+
+// FlatFileProfile is the mapping profile of a flat file.
+type FlatFileProfile struct {
+	// Delimiter separates the values of a record, or is empty for
+	// fixed-width records.
+	// Default: "" (fixed-width)
+	Delimiter string `yaml:"delimiter"`
+
+	// LineEnding is "lf" or "crlf".
+	// Default: "lf"
+	LineEnding string `yaml:"line_ending"`
+
+	// Extension is the file extension of the documents.
+	// Default: ".txt"
+	Extension string `yaml:"extension"`
+
+	// Record is "line_item" for a detail record per line item, or
+	// "transaction" for one per transaction.
+	// Default: "line_item"
+	Record string `yaml:"record"`
+
+	// Header, Detail, and Trailer are the columns of the records. Detail
+	// is required; without Header or Trailer, that record is left out.
+	Header  []Column `yaml:"header"`
+	Detail  []Column `yaml:"detail"`
+	Trailer []Column `yaml:"trailer"`
+}
+
+// Column is a value of a flat file record.
+type Column struct {
+	Value `yaml:",inline"`
+
+	// Width is the width of a fixed-width column. In a delimited record,
+	// a width pads the value.
+	Width int `yaml:"width"`
+
+	// Align is "left" or "right".
+	// Default: "left"
+	Align string `yaml:"align"`
+
+	// Pad is the character that fills the width.
+	// Default: " "
+	Pad string `yaml:"pad"`
+
+	// Decimals writes a number with that many implied decimal places and
+	// no decimal point.
+	// Default: 0 (the value as it is)
+	Decimals int `yaml:"decimals"`
+}
+
+// flatFile writes flat files.
+type flatFile struct {
+	profile FlatFileProfile
+}
+
+// NewFlatFile creates a flat file formatter from its profile.
+//
+// PARAMETERS:
+//   - path: The mapping profile file.
+//
+// RETURNS:
+//   - The formatter.
+//   - An error if the profile cannot be read or is invalid.
+func NewFlatFile(path string) (Formatter, error) {
+	var profile FlatFileProfile
+	if err := loadProfile(path, &profile); err != nil {
+		return nil, err
+	}
+	if err := profile.validate(); err != nil {
+		return nil, fmt.Errorf("output profile %s: %w", path, err)
+	}
+	return &flatFile{profile: profile}, nil
+}
+
+// validate checks the profile and applies its defaults.
+func (p *FlatFileProfile) validate() error {
+	if p.LineEnding == "" {
+		p.LineEnding = "lf"
+	}
+	if p.LineEnding != "lf" && p.LineEnding != "crlf" {
+		return fmt.Errorf("line_ending must be lf or crlf, got %q", p.LineEnding)
+	}
+	if p.Extension == "" {
+		p.Extension = ".txt"
+	}
+	if !strings.HasPrefix(p.Extension, ".") {
+		p.Extension = "." + p.Extension
+	}
+	if p.Record == "" {
+		p.Record = "line_item"
+	}
+	if p.Record != "line_item" && p.Record != "transaction" {
+		return fmt.Errorf("record must be line_item or transaction, got %q", p.Record)
+	}
+	if len(p.Detail) == 0 {
+		return fmt.Errorf("detail needs at least one column")
+	}
+
+	records := []struct {
+		name    string
+		columns []Column
+	}{{"header", p.Header}, {"detail", p.Detail}, {"trailer", p.Trailer}}
+	for _, record := range records {
+		for i := range record.columns {
+			column := &record.columns[i]
+			where := fmt.Sprintf("%s[%d]", record.name, i)
+			if err := column.Value.validate(where); err != nil {
+				return err
+			}
+			if p.Delimiter == "" && column.Width <= 0 {
+				return fmt.Errorf("%s: fixed-width records need a width", where)
+			}
+			if column.Width < 0 || column.Decimals < 0 {
+				return fmt.Errorf("%s: width and decimals must not be negative", where)
+			}
+			if column.Align == "" {
+				column.Align = "left"
+			}
+			if column.Align != "left" && column.Align != "right" {
+				return fmt.Errorf("%s: align must be left or right, got %q", where, column.Align)
+			}
+			if column.Pad == "" {
+				column.Pad = " "
+			}
+			if utf8.RuneCountInString(column.Pad) != 1 {
+				return fmt.Errorf("%s: pad must be one character, got %q", where, column.Pad)
+			}
+		}
+	}
+	return nil
+}
+
+// Extension returns the configured extension.
+func (f *flatFile) Extension() string {
+	return f.profile.Extension
+}
+
+// Format writes the header, a detail record per line item or transaction,
+// and the trailer.
+func (f *flatFile) Format(doc Document) ([]byte, error) {
+	// The detail records, each with the transactions its values come from.
+	var records [][]xmlwriter.Transaction
+	for _, transaction := range doc.Transactions {
+		if f.profile.Record == "transaction" || transaction.Fields != nil {
+			records = append(records, []xmlwriter.Transaction{transaction})
+			continue
+		}
+		for _, lineItem := range transaction.LineItems {
+			single := transaction
+			single.LineItems = []xmlwriter.LineItem{lineItem}
+			records = append(records, []xmlwriter.Transaction{single})
+		}
+	}
+
+	// Header and trailer literals also know the document's counts.
+	counts := strings.NewReplacer(
+		"{records}", strconv.Itoa(len(records)),
+		"{transactions}", strconv.Itoa(len(doc.Transactions)),
+	)
+	expandTotals := func(format string) (string, error) {
+		return doc.Expand(counts.Replace(format))
+	}
+
+	newline := "\n"
+	if f.profile.LineEnding == "crlf" {
+		newline = "\r\n"
+	}
+
+	var buffer bytes.Buffer
+	write := func(name string, columns []Column, transactions []xmlwriter.Transaction, expand func(string) (string, error)) error {
+		line, err := f.record(columns, transactions, expand)
+		if err != nil {
+			return fmt.Errorf("%s record: %w", name, err)
+		}
+		buffer.WriteString(line)
+		buffer.WriteString(newline)
+		return nil
+	}
+
+	if len(f.profile.Header) > 0 {
+		if err := write("header", f.profile.Header, doc.Transactions, expandTotals); err != nil {
+			return nil, err
+		}
+	}
+	for _, transactions := range records {
+		if err := write("detail", f.profile.Detail, transactions, doc.Expand); err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", transactions[0].ID, err)
+		}
+	}
+	if len(f.profile.Trailer) > 0 {
+		if err := write("trailer", f.profile.Trailer, doc.Transactions, expandTotals); err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// record formats the columns of one record.
+func (f *flatFile) record(columns []Column, transactions []xmlwriter.Transaction, expand func(string) (string, error)) (string, error) {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		value, err := column.resolve(transactions, expand)
+		if err != nil {
+			return "", err
+		}
+		if column.Decimals > 0 && strings.TrimSpace(value) != "" {
+			value, err = impliedDecimals(value, column.Decimals)
+			if err != nil {
+				return "", fmt.Errorf("column %d: %w", i+1, err)
+			}
+		}
+		if f.profile.Delimiter != "" && strings.Contains(value, f.profile.Delimiter) {
+			return "", fmt.Errorf("column %d: value %q contains the delimiter %q", i+1, value, f.profile.Delimiter)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("column %d: value %q contains a line break", i+1, value)
+		}
+		if column.Width > 0 {
+			value, err = pad(value, column)
+			if err != nil {
+				return "", fmt.Errorf("column %d: %w", i+1, err)
+			}
+		}
+		values[i] = value
+	}
+	return strings.Join(values, f.profile.Delimiter), nil
+}
+
+// pad fills a value to the column's width.
+func pad(value string, column Column) (string, error) {
+	length := utf8.RuneCountInString(value)
+	if length > column.Width {
+		return "", fmt.Errorf("value %q is longer than the width %d", value, column.Width)
+	}
+	fill := strings.Repeat(column.Pad, column.Width-length)
+	if column.Align == "right" {
+		// A zero-padded negative number keeps its sign in front.
+		if column.Pad == "0" && strings.HasPrefix(value, "-") {
+			return "-" + fill + value[1:], nil
+		}
+		return fill + value, nil
+	}
+	return value + fill, nil
+}
+
+// impliedDecimals writes a number with a number of implied decimal places,
+// e.g. "12.5" with 2 as "1250". More decimal places than that are an
+// error, not rounded.
+func impliedDecimals(value string, decimals int) (string, error) {
+	number, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return "", fmt.Errorf("%q is not a number", value)
+	}
+	scaled := new(big.Rat).Mul(number, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)))
+	if !scaled.IsInt() {
+		return "", fmt.Errorf("%q has more than %d decimal places", value, decimals)
+	}
+	return scaled.Num().String(), nil
+}
@@ -0,0 +1,101 @@
+// =============================================================================
+// CSV to XML Converter - JSON Format
+// =============================================================================
+//
+// The JSON format writes the transactions with all their transformed
+// fields, for consumers such as a data lake that read the data rather than
+// a document layout. It needs no profile:
+//
+//   {
+//     "department": "CLAIMS",
+//     "generated": "2024-01-15T10:30:00Z",
+//     "transactions": [
+//       {"id": 1, "key": "CHK001", "fields": {...},
+//        "line_items": [{"id": 1, "row": 2, "fields": {...}}]}
+//     ]
+//   }
+//
+// A transaction's fields are those of its first row; a transaction without
+// line items has no "line_items".
+//
+// =============================================================================
+
+package outputformat
+
+import (
+	"encoding/json"
+)
+
+// jsonDocument is the JSON document of a file.
+type jsonDocument struct {
+	Department   string            `json:"department"`
+	Generated    string            `json:"generated"`
+	Transactions []jsonTransaction `json:"transactions"`
+}
+
+// jsonTransaction is a transaction of a JSON document.
+type jsonTransaction struct {
+	ID        int               `json:"id"`
+	Key       string            `json:"key,omitempty"`
+	Batch     string            `json:"batch,omitempty"`
+	Fields    map[string]string `json:"fields"`
+	LineItems []jsonLineItem    `json:"line_items,omitempty"`
+}
+
+// jsonLineItem is a line item of a JSON transaction.
+type jsonLineItem struct {
+	ID     int               `json:"id"`
+	Row    int               `json:"row"`
+	Fields map[string]string `json:"fields"`
+}
+
+// jsonFormat writes JSON documents.
+type jsonFormat struct{}
+
+// NewJSON creates the JSON formatter.
+func NewJSON() Formatter {
+	return jsonFormat{}
+}
+
+// Extension returns ".json".
+func (jsonFormat) Extension() string {
+	return ".json"
+}
+
+// Format writes the transactions, with their line items, as indented JSON.
+func (jsonFormat) Format(doc Document) ([]byte, error) {
+	generated, err := doc.Expand("{datetime}")
+	if err != nil {
+		return nil, err
+	}
+
+	out := jsonDocument{
+		Department:   doc.Department.DepartmentCode,
+		Generated:    generated,
+		Transactions: make([]jsonTransaction, len(doc.Transactions)),
+	}
+	for i, transaction := range doc.Transactions {
+		fields := transaction.Fields
+		if fields == nil && len(transaction.LineItems) > 0 {
+			fields = transaction.LineItems[0].Fields
+		}
+		item := jsonTransaction{
+			ID:     transaction.ID,
+			Key:    transaction.GroupKey,
+			Batch:  transaction.BatchKey,
+			Fields: fields,
+		}
+		if transaction.Fields == nil {
+			for _, lineItem := range transaction.LineItems {
+				item.LineItems = append(item.LineItems, jsonLineItem{ID: lineItem.ID, Row: lineItem.Row, Fields: lineItem.Fields})
+			}
+		}
+		out.Transactions[i] = item
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
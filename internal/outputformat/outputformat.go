@@ -0,0 +1,219 @@
+// =============================================================================
+// CSV to XML Converter - Output Formats
+// =============================================================================
+//
+// This package writes the transactions of a converted file in a format
+// other than the template's XML. Each department selects a format and its
+// mapping profile in its configuration:
+//
+//   output_format:
+//     type: pain.001
+//     profile: ./department_mappings/claims/pain001_profile.yaml
+//
+// The file is parsed, grouped, transformed, and validated as for XML; only
+// the document is written differently. A profile says which transaction
+// fields go where in the document. Each value of a profile is one of:
+//
+//   {field: CHECK_AMT}   the field of the transaction (its first row)
+//   {sum: INVOICE_AMT}   the sum of the field over the transaction's rows
+//   {value: "{dept}"}    a literal, with the file's placeholders expanded
+//
+// Fields are named by CSV column header, after the transformations.
+//
+// CUSTOMIZATION:
+//   To add a format, implement the Formatter interface and register its type
+//   in New (and in config.OutputFormatSettings).
+//
+// =============================================================================
+
+package outputformat
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+	"gopkg.in/yaml.v3"
+)
+
+// Document is an output document to write: the transactions of a file (or
+// of one document of a template selector).
+type Document struct {
+	// Transactions are the transformed and validated transactions.
+	Transactions []xmlwriter.Transaction
+
+	// Department is the department configuration of the file.
+	Department *config.DepartmentConfig
+
+	// Expand replaces the placeholders ({dept}, {date}, {sequence}, ...)
+	// in a profile value with the file's values.
+	Expand func(format string) (string, error)
+}
+
+// Formatter writes output documents in one format.
+type Formatter interface {
+	// Extension is the file extension of the documents, e.g. ".xml".
+	Extension() string
+
+	// Format returns the document of the transactions.
+	Format(doc Document) ([]byte, error)
+}
+
+// New creates the formatter configured for a department.
+//
+// PARAMETERS:
+//   - settings: The department's output format settings.
+//
+// RETURNS:
+//   - The formatter, or nil for the template's XML, which the converter
+//     writes itself (see xmlwriter).
+//   - An error if the format is unknown or its profile is invalid.
+func New(settings config.OutputFormatSettings) (Formatter, error) {
+	switch settings.Type {
+	case "", config.OutputFormatXML:
+		return nil, nil
+	case config.OutputFormatFlatFile:
+		return NewFlatFile(settings.Profile)
+	case config.OutputFormatPain001:
+		return NewPain001(settings.Profile)
+	case config.OutputFormatX12820:
+		return NewX12(settings.Profile)
+	case config.OutputFormatJSON:
+		return NewJSON(), nil
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", settings.Type)
+	}
+}
+
+// =============================================================================
+// PROFILE VALUES
+// =============================================================================
+
+// Value is a value of a mapping profile. Exactly one of its fields is set.
+type Value struct {
+	// Field is the CSV column whose value is taken from the transaction's
+	// first row.
+	Field string `yaml:"field"`
+
+	// Sum is the CSV column whose values are added up over the
+	// transaction's rows (over all rows in a document header or trailer).
+	Sum string `yaml:"sum"`
+
+	// Value is a literal. Placeholders are expanded.
+	Value string `yaml:"value"`
+}
+
+// IsSet reports whether the value is configured.
+func (v Value) IsSet() bool {
+	return v.Field != "" || v.Sum != "" || v.Value != ""
+}
+
+// validate checks that exactly one source is set, if any.
+func (v Value) validate(name string) error {
+	set := 0
+	for _, source := range []string{v.Field, v.Sum, v.Value} {
+		if source != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("%s: set only one of field, sum, and value", name)
+	}
+	return nil
+}
+
+// resolve returns the value for the transactions: the field of the first
+// one, the sum over all of them, or the expanded literal.
+//
+// PARAMETERS:
+//   - transactions: The transaction the value belongs to, or all
+//     transactions of the document for a header or trailer.
+//   - expand: Expands the placeholders of a literal.
+//
+// RETURNS:
+//   - The value.
+//   - An error if a sum has a value that is not a number, or a
+//     placeholder cannot be expanded.
+func (v Value) resolve(transactions []xmlwriter.Transaction, expand func(string) (string, error)) (string, error) {
+	switch {
+	case v.Field != "":
+		if len(transactions) == 0 {
+			return "", nil
+		}
+		return transactionField(transactions[0], v.Field), nil
+	case v.Sum != "":
+		return sumField(transactions, v.Sum)
+	case v.Value != "":
+		return expand(v.Value)
+	}
+	return "", nil
+}
+
+// transactionField returns a transaction-level field: from the transaction
+// itself if it has no line items, otherwise from its first line item.
+func transactionField(transaction xmlwriter.Transaction, field string) string {
+	if transaction.Fields != nil {
+		return transaction.Fields[field]
+	}
+	if len(transaction.LineItems) == 0 {
+		return ""
+	}
+	return transaction.LineItems[0].Fields[field]
+}
+
+// sumField adds up a numeric field over the line items of the
+// transactions. The sum is exact and has as many decimal places as the
+// most precise value. Empty values are skipped.
+func sumField(transactions []xmlwriter.Transaction, field string) (string, error) {
+	sum := new(big.Rat)
+	decimals := 0
+	add := func(value string) error {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil
+		}
+		number, ok := new(big.Rat).SetString(value)
+		if !ok {
+			return fmt.Errorf("cannot sum %q in column %s", value, field)
+		}
+		sum.Add(sum, number)
+		if dot := strings.IndexByte(value, '.'); dot >= 0 && len(value)-dot-1 > decimals {
+			decimals = len(value) - dot - 1
+		}
+		return nil
+	}
+
+	for _, transaction := range transactions {
+		if transaction.Fields != nil {
+			if err := add(transaction.Fields[field]); err != nil {
+				return "", err
+			}
+			continue
+		}
+		for _, lineItem := range transaction.LineItems {
+			if err := add(lineItem.Fields[field]); err != nil {
+				return "", fmt.Errorf("%w (row %d)", err, lineItem.Row)
+			}
+		}
+	}
+	return sum.FloatString(decimals), nil
+}
+
+// loadProfile reads a mapping profile file into profile. Unknown keys are
+// rejected, so a misspelled key does not silently leave a value out.
+func loadProfile(path string, profile interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read output profile: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(profile); err != nil {
+		return fmt.Errorf("failed to parse output profile %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,593 @@
+// =============================================================================
+// CSV to XML Converter - ISO 20022 pain.001 Format
+// =============================================================================
+//
+// A pain.001 document (customer credit transfer initiation) asks the bank
+// to pay each transaction of the file from the debtor account:
+//
+//   <Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">
+//     <CstmrCdtTrfInitn>
+//       <GrpHdr>                 message ID, creation time, count, total
+//       <PmtInf>                 per requested execution date: the debtor
+//         <CdtTrfTxInf>          per transaction: amount and creditor
+//
+// The profile maps the transaction fields to the elements:
+//
+//   version: pain.001.001.03         # or pain.001.001.09
+//   message_id: {value: "{dept}-{timestamp}"}
+//   initiating_party: {value: "ACME Insurance"}
+//   payment_information_id: {value: "{dept}-{date}-{sequence}"}
+//   requested_execution_date: {value: "{today}"}
+//   service_level: SEPA
+//   charge_bearer: SLEV
+//   debtor:
+//     name: {value: "ACME Insurance"}
+//     iban: {value: "DE89370400440532013000"}
+//     bic: {value: "COBADEFFXXX"}
+//   payment:
+//     end_to_end_id: {field: CHECK_NUM}
+//     amount: {field: CHECK_AMT}       # or {sum: INVOICE_AMT}
+//     currency: {value: EUR}
+//     creditor:
+//       name: {field: PAYEE_NAME}
+//       iban: {field: PAYEE_IBAN}
+//       bic: {field: PAYEE_BIC}
+//     remittance_information: {field: INVOICE_NO}
+//
+// One transaction of the file is one payment. Payments are grouped in a
+// payment information block per requested execution date, in the order of
+// the file. Identifiers, amounts, dates, IBANs, and BICs are checked against
+// the schema's patterns and lengths, so a file the bank would reject fails
+// here instead.
+//
+// =============================================================================
+
+package outputformat
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+)
+
+// pain.001 message versions.
+const (
+	Pain001V03 = "pain.001.001.03"
+	Pain001V09 = "pain.001.001.09"
+)
+
+// Pain001Profile is the mapping profile of a pain.001 document.
+type Pain001Profile struct {
+	// Version is the message version.
+	// Default: "pain.001.001.03"
+	Version string `yaml:"version"`
+
+	// MessageID identifies the document (MsgId, at most 35 characters).
+	MessageID Value `yaml:"message_id"`
+
+	// CreationTime is the creation time of the document (CreDtTm).
+	// Default: {value: "{datetime}"}
+	CreationTime Value `yaml:"creation_time"`
+
+	// InitiatingParty is the name of the party sending the document.
+	InitiatingParty Value `yaml:"initiating_party"`
+
+	// PaymentInformationID identifies the payment information block
+	// (PmtInfId). With several execution dates, "-1", "-2", ... are
+	// appended.
+	// Default: the message ID
+	PaymentInformationID Value `yaml:"payment_information_id"`
+
+	// RequestedExecutionDate is the date (YYYY-MM-DD) the bank executes
+	// the payments. A field gives each payment its own date.
+	// Default: {value: "{today}"}
+	RequestedExecutionDate Value `yaml:"requested_execution_date"`
+
+	// ServiceLevel is the service level code, e.g. "SEPA".
+	// Default: none
+	ServiceLevel string `yaml:"service_level"`
+
+	// ChargeBearer is the charge bearer code, e.g. "SLEV".
+	// Default: none
+	ChargeBearer string `yaml:"charge_bearer"`
+
+	// Debtor is the paying party and account.
+	Debtor Party `yaml:"debtor"`
+
+	// Payment maps a transaction to a credit transfer.
+	Payment Pain001Payment `yaml:"payment"`
+}
+
+// Party is a debtor or creditor: its name, and its account as an IBAN or
+// another account number, at a bank identified by BIC.
+type Party struct {
+	Name    Value `yaml:"name"`
+	IBAN    Value `yaml:"iban"`
+	Account Value `yaml:"account"`
+	BIC     Value `yaml:"bic"`
+}
+
+// Pain001Payment maps a transaction to a credit transfer.
+type Pain001Payment struct {
+	// InstructionID is the optional instruction ID (InstrId).
+	InstructionID Value `yaml:"instruction_id"`
+
+	// EndToEndID is passed on to the creditor (EndToEndId).
+	// Default: "NOTPROVIDED"
+	EndToEndID Value `yaml:"end_to_end_id"`
+
+	// Amount is the amount to pay, greater than zero.
+	Amount Value `yaml:"amount"`
+
+	// Currency is the ISO 4217 currency code of the amount.
+	Currency Value `yaml:"currency"`
+
+	// Creditor is the paid party and account.
+	Creditor Party `yaml:"creditor"`
+
+	// RemittanceInformation is the unstructured remittance text (Ustrd, at
+	// most 140 characters).
+	RemittanceInformation Value `yaml:"remittance_information"`
+}
+
+// Patterns and lengths of the pain.001 schema.
+var (
+	ibanPattern     = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[a-zA-Z0-9]{1,30}$`)
+	bicPattern      = regexp.MustCompile(`^[A-Z]{6}[A-Z2-9][A-NP-Z0-9]([A-Z0-9]{3})?$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+const (
+	max35Text  = 35
+	max140Text = 140
+)
+
+// pain001 writes pain.001 documents.
+type pain001 struct {
+	profile Pain001Profile
+}
+
+// NewPain001 creates a pain.001 formatter from its profile.
+//
+// PARAMETERS:
+//   - path: The mapping profile file.
+//
+// RETURNS:
+//   - The formatter.
+//   - An error if the profile cannot be read or is invalid.
+func NewPain001(path string) (Formatter, error) {
+	var profile Pain001Profile
+	if err := loadProfile(path, &profile); err != nil {
+		return nil, err
+	}
+	if err := profile.validate(); err != nil {
+		return nil, fmt.Errorf("output profile %s: %w", path, err)
+	}
+	return &pain001{profile: profile}, nil
+}
+
+// validate checks the profile and applies its defaults.
+func (p *Pain001Profile) validate() error {
+	if p.Version == "" {
+		p.Version = Pain001V03
+	}
+	if p.Version != Pain001V03 && p.Version != Pain001V09 {
+		return fmt.Errorf("version must be %s or %s, got %q", Pain001V03, Pain001V09, p.Version)
+	}
+	if !p.CreationTime.IsSet() {
+		p.CreationTime = Value{Value: "{datetime}"}
+	}
+	if !p.PaymentInformationID.IsSet() {
+		p.PaymentInformationID = p.MessageID
+	}
+	if !p.RequestedExecutionDate.IsSet() {
+		p.RequestedExecutionDate = Value{Value: "{today}"}
+	}
+	if !p.Payment.EndToEndID.IsSet() {
+		p.Payment.EndToEndID = Value{Value: "NOTPROVIDED"}
+	}
+
+	required := []struct {
+		name  string
+		value Value
+	}{
+		{"message_id", p.MessageID},
+		{"initiating_party", p.InitiatingParty},
+		{"debtor.name", p.Debtor.Name},
+		{"payment.amount", p.Payment.Amount},
+		{"payment.currency", p.Payment.Currency},
+		{"payment.creditor.name", p.Payment.Creditor.Name},
+	}
+	for _, value := range required {
+		if !value.value.IsSet() {
+			return fmt.Errorf("%s is required", value.name)
+		}
+	}
+	for name, party := range map[string]Party{"debtor": p.Debtor, "payment.creditor": p.Payment.Creditor} {
+		if party.IBAN.IsSet() == party.Account.IsSet() {
+			return fmt.Errorf("%s needs either an iban or an account", name)
+		}
+	}
+
+	values := map[string]Value{
+		"message_id": p.MessageID, "creation_time": p.CreationTime, "initiating_party": p.InitiatingParty,
+		"payment_information_id": p.PaymentInformationID, "requested_execution_date": p.RequestedExecutionDate,
+		"debtor.name": p.Debtor.Name, "debtor.iban": p.Debtor.IBAN, "debtor.account": p.Debtor.Account, "debtor.bic": p.Debtor.BIC,
+		"payment.instruction_id": p.Payment.InstructionID, "payment.end_to_end_id": p.Payment.EndToEndID,
+		"payment.amount": p.Payment.Amount, "payment.currency": p.Payment.Currency,
+		"payment.creditor.name": p.Payment.Creditor.Name, "payment.creditor.iban": p.Payment.Creditor.IBAN,
+		"payment.creditor.account": p.Payment.Creditor.Account, "payment.creditor.bic": p.Payment.Creditor.BIC,
+		"payment.remittance_information": p.Payment.RemittanceInformation,
+	}
+	for name, value := range values {
+		if err := value.validate(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extension returns ".xml".
+func (f *pain001) Extension() string {
+	return ".xml"
+}
+
+// creditTransfer is a payment of the document, resolved from a transaction.
+type creditTransfer struct {
+	instructionID string
+	endToEndID    string
+	amount        *big.Rat
+	amountText    string
+	currency      string
+	creditor      resolvedParty
+	remittance    string
+}
+
+// resolvedParty is a party with its values.
+type resolvedParty struct {
+	name, iban, account, bic string
+}
+
+// paymentBlock holds the payments of one requested execution date.
+type paymentBlock struct {
+	date      string
+	transfers []creditTransfer
+}
+
+// Format writes the pain.001 document of the transactions.
+func (f *pain001) Format(doc Document) ([]byte, error) {
+	p := f.profile
+	all := doc.Transactions
+
+	// Document-level values.
+	header := make(map[string]string)
+	for name, value := range map[string]Value{
+		"message_id": p.MessageID, "creation_time": p.CreationTime, "initiating_party": p.InitiatingParty,
+		"payment_information_id": p.PaymentInformationID,
+	} {
+		resolved, err := value.resolve(all, doc.Expand)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		header[name] = strings.TrimSpace(resolved)
+	}
+	if err := checkText("message_id", header["message_id"], max35Text); err != nil {
+		return nil, err
+	}
+	if err := checkText("initiating_party", header["initiating_party"], max140Text); err != nil {
+		return nil, err
+	}
+	debtor, err := resolveParty("debtor", p.Debtor, all, doc.Expand)
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("a pain.001 document needs at least one payment")
+	}
+
+	// The payments, by requested execution date.
+	var blocks []*paymentBlock
+	byDate := make(map[string]*paymentBlock)
+	total := new(big.Rat)
+	totalDecimals := 0
+	for _, transaction := range all {
+		single := []xmlwriter.Transaction{transaction}
+		transfer, date, err := f.creditTransfer(single, doc.Expand)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", transaction.ID, err)
+		}
+		block := byDate[date]
+		if block == nil {
+			block = &paymentBlock{date: date}
+			byDate[date] = block
+			blocks = append(blocks, block)
+		}
+		block.transfers = append(block.transfers, transfer)
+		total.Add(total, transfer.amount)
+		totalDecimals = max(totalDecimals, decimalPlaces(transfer.amountText))
+	}
+
+	root := &element{name: "CstmrCdtTrfInitn"}
+	root.add(&element{name: "GrpHdr", children: []*element{
+		text("MsgId", header["message_id"]),
+		text("CreDtTm", header["creation_time"]),
+		text("NbOfTxs", strconv.Itoa(len(all))),
+		text("CtrlSum", total.FloatString(totalDecimals)),
+		{name: "InitgPty", children: []*element{text("Nm", header["initiating_party"])}},
+	}})
+
+	for i, block := range blocks {
+		id := header["payment_information_id"]
+		if len(blocks) > 1 {
+			id = fmt.Sprintf("%s-%d", id, i+1)
+		}
+		if err := checkText("payment_information_id", id, max35Text); err != nil {
+			return nil, err
+		}
+		root.add(f.paymentInformation(id, block, debtor))
+	}
+
+	document := &element{
+		name:     "Document",
+		attrs:    []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: "urn:iso:std:iso:20022:tech:xsd:" + p.Version}},
+		children: []*element{root},
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(xml.Header)
+	document.write(&buffer, 0)
+	return buffer.Bytes(), nil
+}
+
+// creditTransfer resolves the payment of a transaction and its requested
+// execution date.
+func (f *pain001) creditTransfer(transactions []xmlwriter.Transaction, expand func(string) (string, error)) (creditTransfer, string, error) {
+	payment := f.profile.Payment
+	var transfer creditTransfer
+	values := []struct {
+		name   string
+		value  Value
+		target *string
+		max    int
+	}{
+		{"instruction_id", payment.InstructionID, &transfer.instructionID, max35Text},
+		{"end_to_end_id", payment.EndToEndID, &transfer.endToEndID, max35Text},
+		{"currency", payment.Currency, &transfer.currency, 3},
+		{"remittance_information", payment.RemittanceInformation, &transfer.remittance, max140Text},
+	}
+	for _, v := range values {
+		resolved, err := v.value.resolve(transactions, expand)
+		if err != nil {
+			return transfer, "", fmt.Errorf("%s: %w", v.name, err)
+		}
+		*v.target = strings.TrimSpace(resolved)
+		if err := checkText(v.name, *v.target, v.max); err != nil {
+			return transfer, "", err
+		}
+	}
+	if transfer.endToEndID == "" {
+		return transfer, "", fmt.Errorf("end_to_end_id is empty")
+	}
+	if !currencyPattern.MatchString(transfer.currency) {
+		return transfer, "", fmt.Errorf("currency %q is not an ISO 4217 code", transfer.currency)
+	}
+
+	amount, err := payment.Amount.resolve(transactions, expand)
+	if err != nil {
+		return transfer, "", fmt.Errorf("amount: %w", err)
+	}
+	transfer.amountText = strings.TrimSpace(amount)
+	number, ok := new(big.Rat).SetString(transfer.amountText)
+	if !ok || number.Sign() <= 0 || strings.ContainsAny(transfer.amountText, "eE+") {
+		return transfer, "", fmt.Errorf("amount %q is not a positive decimal number", amount)
+	}
+	if decimalPlaces(transfer.amountText) > 5 {
+		return transfer, "", fmt.Errorf("amount %q has more than 5 decimal places", amount)
+	}
+	transfer.amount = number
+	transfer.amountText = number.FloatString(decimalPlaces(transfer.amountText))
+
+	transfer.creditor, err = resolveParty("creditor", payment.Creditor, transactions, expand)
+	if err != nil {
+		return transfer, "", err
+	}
+
+	date, err := f.profile.RequestedExecutionDate.resolve(transactions, expand)
+	if err != nil {
+		return transfer, "", fmt.Errorf("requested_execution_date: %w", err)
+	}
+	date = strings.TrimSpace(date)
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return transfer, "", fmt.Errorf("requested_execution_date %q is not a YYYY-MM-DD date", date)
+	}
+	return transfer, date, nil
+}
+
+// paymentInformation builds the PmtInf block of an execution date.
+func (f *pain001) paymentInformation(id string, block *paymentBlock, debtor resolvedParty) *element {
+	p := f.profile
+	sum := new(big.Rat)
+	decimals := 0
+	for _, transfer := range block.transfers {
+		sum.Add(sum, transfer.amount)
+		decimals = max(decimals, decimalPlaces(transfer.amountText))
+	}
+
+	info := &element{name: "PmtInf"}
+	info.add(text("PmtInfId", id), text("PmtMtd", "TRF"),
+		text("NbOfTxs", strconv.Itoa(len(block.transfers))), text("CtrlSum", sum.FloatString(decimals)))
+	if p.ServiceLevel != "" {
+		info.add(&element{name: "PmtTpInf", children: []*element{
+			{name: "SvcLvl", children: []*element{text("Cd", p.ServiceLevel)}},
+		}})
+	}
+	if p.Version == Pain001V03 {
+		info.add(text("ReqdExctnDt", block.date))
+	} else {
+		info.add(&element{name: "ReqdExctnDt", children: []*element{text("Dt", block.date)}})
+	}
+	info.add(&element{name: "Dbtr", children: []*element{text("Nm", debtor.name)}})
+	info.add(f.account("DbtrAcct", debtor))
+	// The debtor agent is mandatory; without a BIC, it is "not provided".
+	if debtor.bic != "" {
+		info.add(f.agent("DbtrAgt", debtor.bic))
+	} else {
+		info.add(&element{name: "DbtrAgt", children: []*element{{name: "FinInstnId", children: []*element{
+			{name: "Othr", children: []*element{text("Id", "NOTPROVIDED")}},
+		}}}})
+	}
+	if p.ChargeBearer != "" {
+		info.add(text("ChrgBr", p.ChargeBearer))
+	}
+
+	for _, transfer := range block.transfers {
+		tx := &element{name: "CdtTrfTxInf"}
+		paymentID := &element{name: "PmtId"}
+		if transfer.instructionID != "" {
+			paymentID.add(text("InstrId", transfer.instructionID))
+		}
+		paymentID.add(text("EndToEndId", transfer.endToEndID))
+		tx.add(paymentID)
+		tx.add(&element{name: "Amt", children: []*element{{
+			name:  "InstdAmt",
+			attrs: []xml.Attr{{Name: xml.Name{Local: "Ccy"}, Value: transfer.currency}},
+			text:  transfer.amountText,
+		}}})
+		if transfer.creditor.bic != "" {
+			tx.add(f.agent("CdtrAgt", transfer.creditor.bic))
+		}
+		tx.add(&element{name: "Cdtr", children: []*element{text("Nm", transfer.creditor.name)}})
+		tx.add(f.account("CdtrAcct", transfer.creditor))
+		if transfer.remittance != "" {
+			tx.add(&element{name: "RmtInf", children: []*element{text("Ustrd", transfer.remittance)}})
+		}
+		info.add(tx)
+	}
+	return info
+}
+
+// account builds the account element of a party.
+func (f *pain001) account(name string, party resolvedParty) *element {
+	id := &element{name: "Id"}
+	if party.iban != "" {
+		id.add(text("IBAN", party.iban))
+	} else {
+		id.add(&element{name: "Othr", children: []*element{text("Id", party.account)}})
+	}
+	return &element{name: name, children: []*element{id}}
+}
+
+// agent builds the agent element of a BIC; version 09 calls it BICFI.
+func (f *pain001) agent(name, bic string) *element {
+	tag := "BIC"
+	if f.profile.Version != Pain001V03 {
+		tag = "BICFI"
+	}
+	return &element{name: name, children: []*element{{name: "FinInstnId", children: []*element{text(tag, bic)}}}}
+}
+
+// resolveParty resolves and checks the values of a party.
+func resolveParty(name string, party Party, transactions []xmlwriter.Transaction, expand func(string) (string, error)) (resolvedParty, error) {
+	var resolved resolvedParty
+	values := []struct {
+		key    string
+		value  Value
+		target *string
+	}{
+		{"name", party.Name, &resolved.name},
+		{"iban", party.IBAN, &resolved.iban},
+		{"account", party.Account, &resolved.account},
+		{"bic", party.BIC, &resolved.bic},
+	}
+	for _, v := range values {
+		value, err := v.value.resolve(transactions, expand)
+		if err != nil {
+			return resolved, fmt.Errorf("%s.%s: %w", name, v.key, err)
+		}
+		*v.target = strings.TrimSpace(value)
+	}
+
+	// IBANs are often exported with spaces every four characters.
+	resolved.iban = strings.ToUpper(strings.ReplaceAll(resolved.iban, " ", ""))
+	switch {
+	case resolved.name == "":
+		return resolved, fmt.Errorf("%s.name is empty", name)
+	case party.IBAN.IsSet() && !ibanPattern.MatchString(resolved.iban):
+		return resolved, fmt.Errorf("%s.iban %q is not an IBAN", name, resolved.iban)
+	case party.Account.IsSet() && resolved.account == "":
+		return resolved, fmt.Errorf("%s.account is empty", name)
+	case resolved.bic != "" && !bicPattern.MatchString(resolved.bic):
+		return resolved, fmt.Errorf("%s.bic %q is not a BIC", name, resolved.bic)
+	}
+	if err := checkText(name+".name", resolved.name, max140Text); err != nil {
+		return resolved, err
+	}
+	return resolved, checkText(name+".account", resolved.account, 34)
+}
+
+// checkText checks the length of a text value.
+func checkText(name, value string, maxLength int) error {
+	if utf8.RuneCountInString(value) > maxLength {
+		return fmt.Errorf("%s %q is longer than %d characters", name, value, maxLength)
+	}
+	return nil
+}
+
+// decimalPlaces returns the number of decimal places of a decimal number.
+func decimalPlaces(value string) int {
+	if dot := strings.IndexByte(value, '.'); dot >= 0 {
+		return len(value) - dot - 1
+	}
+	return 0
+}
+
+// =============================================================================
+// DOCUMENT TREE
+// =============================================================================
+
+// element is an element of the document: text, or child elements.
+type element struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []*element
+}
+
+// text creates an element with text.
+func text(name, value string) *element {
+	return &element{name: name, text: value}
+}
+
+// add appends child elements.
+func (e *element) add(children ...*element) {
+	e.children = append(e.children, children...)
+}
+
+// write writes the element, indented by two spaces per level.
+func (e *element) write(buffer *bytes.Buffer, level int) {
+	indent := strings.Repeat("  ", level)
+	buffer.WriteString(indent + "<" + e.name)
+	for _, attr := range e.attrs {
+		buffer.WriteString(" " + attr.Name.Local + `="`)
+		xml.EscapeText(buffer, []byte(attr.Value))
+		buffer.WriteString(`"`)
+	}
+	buffer.WriteString(">")
+	if len(e.children) == 0 {
+		xml.EscapeText(buffer, []byte(e.text))
+		buffer.WriteString("</" + e.name + ">\n")
+		return
+	}
+	buffer.WriteString("\n")
+	for _, child := range e.children {
+		child.write(buffer, level+1)
+	}
+	buffer.WriteString(indent + "</" + e.name + ">\n")
+}
@@ -0,0 +1,359 @@
+// =============================================================================
+// CSV to XML Converter - EDI X12 820 Format
+// =============================================================================
+//
+// An X12 820 (payment order/remittance advice) is a list of segments inside
+// the interchange (ISA/IEA), functional group (GS/GE), and transaction set
+// (ST/SE) envelope. The writer builds the envelope and its control numbers
+// and counts; the profile defines the segments in between:
+//
+//   version: "004010"                  # or "005010"
+//   sender_id: ACMEINS                 # ISA06 and GS02
+//   receiver_id: BANKUS                # ISA08 and GS03
+//   control_number: {value: "{sequence}"}
+//   header:                            # once, after ST
+//     - [BPR, C, {sum: LINE_AMT}, C, ACH, CCP, "01", "011000015", DA, "1234567", "1512345678", "", "01", "021000021", DA, "7654321", "{date}"]
+//     - [TRN, "1", "{dept}{sequence}", "1512345678"]
+//     - [N1, PR, ACME Insurance]
+//   transaction:                       # per transaction
+//     - [ENT, "{transaction}"]
+//     - [N1, PE, {field: PAYEE_NAME}]
+//   line_item:                         # per line item of the transaction
+//     - [RMR, IV, {field: INVOICE_NO}, "", {field: LINE_AMT}]
+//   trailer: []                        # once, before SE
+//
+// A segment is its ID followed by its elements. An element is a literal
+// (with placeholders) or a profile value ({field: ...}, {sum: ...}). In
+// transaction and line item segments, {transaction} and {line_item} are
+// their numbers, from 1. Trailing empty elements are left out, as is a
+// segment whose elements are all empty, and a value that contains a
+// delimiter fails the file.
+//
+// =============================================================================
+
+package outputformat
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xmlwriter"
+	"gopkg.in/yaml.v3"
+)
+
+// X12 versions.
+const (
+	X12V4010 = "004010"
+	X12V5010 = "005010"
+)
+
+// X12Profile is the mapping profile of an X12 820 document.
+type X12Profile struct {
+	// Version is the X12 version of the functional group (GS08).
+	// Default: "004010"
+	Version string `yaml:"version"`
+
+	// SenderQualifier and SenderID identify the sender (ISA05/06, GS02).
+	// Default qualifier: "ZZ"
+	SenderQualifier string `yaml:"sender_qualifier"`
+	SenderID        string `yaml:"sender_id"`
+
+	// ReceiverQualifier and ReceiverID identify the receiver (ISA07/08,
+	// GS03).
+	// Default qualifier: "ZZ"
+	ReceiverQualifier string `yaml:"receiver_qualifier"`
+	ReceiverID        string `yaml:"receiver_id"`
+
+	// Usage is "P" for production or "T" for test (ISA15).
+	// Default: "P"
+	Usage string `yaml:"usage"`
+
+	// ControlNumber is the interchange, group, and transaction set control
+	// number: at most 9 digits.
+	// Default: {value: "{sequence}"}
+	ControlNumber Value `yaml:"control_number"`
+
+	// ElementSeparator, SegmentTerminator, and SubelementSeparator are the
+	// delimiters.
+	// Defaults: "*", "~", ">"
+	ElementSeparator    string `yaml:"element_separator"`
+	SegmentTerminator   string `yaml:"segment_terminator"`
+	SubelementSeparator string `yaml:"subelement_separator"`
+
+	// LineBreaks writes a line break after each segment terminator.
+	// Default: false
+	LineBreaks bool `yaml:"line_breaks"`
+
+	// Extension is the file extension of the documents.
+	// Default: ".edi"
+	Extension string `yaml:"extension"`
+
+	// Header, Transaction, LineItem, and Trailer are the segments of the
+	// transaction set.
+	Header      []Segment `yaml:"header"`
+	Transaction []Segment `yaml:"transaction"`
+	LineItem    []Segment `yaml:"line_item"`
+	Trailer     []Segment `yaml:"trailer"`
+}
+
+// Segment is an X12 segment of a profile: its ID and its elements.
+type Segment struct {
+	ID       string
+	Elements []Value
+}
+
+// segmentID matches X12 segment IDs.
+var segmentID = regexp.MustCompile(`^[A-Z][A-Z0-9]{1,2}$`)
+
+// UnmarshalYAML reads a segment written as a list: the ID, then the
+// elements, each a literal or a profile value.
+func (s *Segment) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode || len(node.Content) == 0 {
+		return fmt.Errorf("line %d: a segment is a list of its ID and elements", node.Line)
+	}
+	if node.Content[0].Kind != yaml.ScalarNode || !segmentID.MatchString(node.Content[0].Value) {
+		return fmt.Errorf("line %d: invalid segment ID %q", node.Line, node.Content[0].Value)
+	}
+	s.ID = node.Content[0].Value
+	switch s.ID {
+	case "ISA", "IEA", "GS", "GE", "ST", "SE":
+		return fmt.Errorf("line %d: the %s segment is written by the converter", node.Line, s.ID)
+	}
+
+	for _, element := range node.Content[1:] {
+		switch element.Kind {
+		case yaml.ScalarNode:
+			s.Elements = append(s.Elements, Value{Value: element.Value})
+		case yaml.MappingNode:
+			var value Value
+			for i := 0; i < len(element.Content); i += 2 {
+				switch key := element.Content[i].Value; key {
+				case "field", "sum", "value":
+				default:
+					return fmt.Errorf("line %d: unknown element key %q in segment %s", element.Line, key, s.ID)
+				}
+			}
+			if err := element.Decode(&value); err != nil {
+				return err
+			}
+			if err := value.validate(fmt.Sprintf("segment %s, line %d", s.ID, element.Line)); err != nil {
+				return err
+			}
+			s.Elements = append(s.Elements, value)
+		default:
+			return fmt.Errorf("line %d: an element of segment %s is a literal or a field, sum, or value", element.Line, s.ID)
+		}
+	}
+	return nil
+}
+
+// x12 writes X12 820 documents.
+type x12 struct {
+	profile X12Profile
+}
+
+// NewX12 creates an X12 820 formatter from its profile.
+//
+// PARAMETERS:
+//   - path: The mapping profile file.
+//
+// RETURNS:
+//   - The formatter.
+//   - An error if the profile cannot be read or is invalid.
+func NewX12(path string) (Formatter, error) {
+	var profile X12Profile
+	if err := loadProfile(path, &profile); err != nil {
+		return nil, err
+	}
+	if err := profile.validate(); err != nil {
+		return nil, fmt.Errorf("output profile %s: %w", path, err)
+	}
+	return &x12{profile: profile}, nil
+}
+
+// validate checks the profile and applies its defaults.
+func (p *X12Profile) validate() error {
+	if p.Version == "" {
+		p.Version = X12V4010
+	}
+	if p.Version != X12V4010 && p.Version != X12V5010 {
+		return fmt.Errorf("version must be %s or %s, got %q", X12V4010, X12V5010, p.Version)
+	}
+	if p.SenderQualifier == "" {
+		p.SenderQualifier = "ZZ"
+	}
+	if p.ReceiverQualifier == "" {
+		p.ReceiverQualifier = "ZZ"
+	}
+	if p.Usage == "" {
+		p.Usage = "P"
+	}
+	if p.Usage != "P" && p.Usage != "T" {
+		return fmt.Errorf("usage must be P or T, got %q", p.Usage)
+	}
+	if !p.ControlNumber.IsSet() {
+		p.ControlNumber = Value{Value: "{sequence}"}
+	}
+	if err := p.ControlNumber.validate("control_number"); err != nil {
+		return err
+	}
+	if p.ElementSeparator == "" {
+		p.ElementSeparator = "*"
+	}
+	if p.SegmentTerminator == "" {
+		p.SegmentTerminator = "~"
+	}
+	if p.SubelementSeparator == "" {
+		p.SubelementSeparator = ">"
+	}
+	if p.Extension == "" {
+		p.Extension = ".edi"
+	}
+	if !strings.HasPrefix(p.Extension, ".") {
+		p.Extension = "." + p.Extension
+	}
+
+	delimiters := []string{p.ElementSeparator, p.SegmentTerminator, p.SubelementSeparator}
+	for i, delimiter := range delimiters {
+		if len(delimiter) != 1 {
+			return fmt.Errorf("the element separator, segment terminator, and subelement separator must be one character each")
+		}
+		for _, other := range delimiters[i+1:] {
+			if delimiter == other {
+				return fmt.Errorf("the delimiters must differ, %q is used twice", delimiter)
+			}
+		}
+	}
+	if p.Version == X12V5010 && strings.Contains(p.ElementSeparator+p.SegmentTerminator+p.SubelementSeparator, "^") {
+		return fmt.Errorf("version %s uses ^ as the repetition separator, it cannot be a delimiter", X12V5010)
+	}
+	if len(p.SenderQualifier) != 2 || len(p.ReceiverQualifier) != 2 {
+		return fmt.Errorf("sender_qualifier and receiver_qualifier must be 2 characters, got %q and %q", p.SenderQualifier, p.ReceiverQualifier)
+	}
+	if p.SenderID == "" || len(p.SenderID) > 15 {
+		return fmt.Errorf("sender_id must be 1 to 15 characters, got %q", p.SenderID)
+	}
+	if p.ReceiverID == "" || len(p.ReceiverID) > 15 {
+		return fmt.Errorf("receiver_id must be 1 to 15 characters, got %q", p.ReceiverID)
+	}
+	if len(p.Header)+len(p.Transaction)+len(p.LineItem)+len(p.Trailer) == 0 {
+		return fmt.Errorf("the profile defines no segments")
+	}
+	return nil
+}
+
+// Extension returns the configured extension.
+func (f *x12) Extension() string {
+	return f.profile.Extension
+}
+
+// Format writes the interchange with one transaction set holding the
+// header segments, the segments of each transaction and line item, and the
+// trailer segments.
+func (f *x12) Format(doc Document) ([]byte, error) {
+	p := f.profile
+
+	control, err := p.ControlNumber.resolve(doc.Transactions, doc.Expand)
+	if err != nil {
+		return nil, fmt.Errorf("control_number: %w", err)
+	}
+	number, err := strconv.Atoi(strings.TrimSpace(control))
+	if err != nil || number < 0 || number > 999999999 {
+		return nil, fmt.Errorf("control_number %q must be a number of at most 9 digits", control)
+	}
+	date, err := doc.Expand("{date}")
+	if err != nil {
+		return nil, err
+	}
+	clock, err := doc.Expand("{time}")
+	if err != nil {
+		return nil, err
+	}
+
+	var segments [][]string
+	write := func(name string, templates []Segment, transactions []xmlwriter.Transaction, expand func(string) (string, error)) error {
+		for _, template := range templates {
+			segment := []string{template.ID}
+			for i, element := range template.Elements {
+				value, err := element.resolve(transactions, expand)
+				if err != nil {
+					return fmt.Errorf("%s segment %s, element %d: %w", name, template.ID, i+1, err)
+				}
+				value = strings.TrimSpace(value)
+				if strings.ContainsAny(value, p.ElementSeparator+p.SegmentTerminator+p.SubelementSeparator+"\r\n") {
+					return fmt.Errorf("%s segment %s, element %d: value %q contains a delimiter", name, template.ID, i+1, value)
+				}
+				segment = append(segment, value)
+			}
+			// Trailing empty elements are left out.
+			for len(segment) > 1 && segment[len(segment)-1] == "" {
+				segment = segment[:len(segment)-1]
+			}
+			// A segment without any values is optional and left out.
+			if len(segment) == 1 && len(template.Elements) > 0 {
+				continue
+			}
+			segments = append(segments, segment)
+		}
+		return nil
+	}
+
+	if err := write("header", p.Header, doc.Transactions, doc.Expand); err != nil {
+		return nil, err
+	}
+	lineItemNumber := 0
+	for i, transaction := range doc.Transactions {
+		numbers := strings.NewReplacer("{transaction}", strconv.Itoa(i+1))
+		expand := func(format string) (string, error) {
+			return doc.Expand(numbers.Replace(format))
+		}
+		single := []xmlwriter.Transaction{transaction}
+		if err := write("transaction", p.Transaction, single, expand); err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", transaction.ID, err)
+		}
+		for _, lineItem := range transaction.LineItems {
+			lineItemNumber++
+			itemNumbers := strings.NewReplacer("{transaction}", strconv.Itoa(i+1), "{line_item}", strconv.Itoa(lineItemNumber))
+			itemExpand := func(format string) (string, error) {
+				return doc.Expand(itemNumbers.Replace(format))
+			}
+			item := transaction
+			item.LineItems = []xmlwriter.LineItem{lineItem}
+			if err := write("line_item", p.LineItem, []xmlwriter.Transaction{item}, itemExpand); err != nil {
+				return nil, fmt.Errorf("transaction %d, row %d: %w", transaction.ID, lineItem.Row, err)
+			}
+		}
+	}
+	if err := write("trailer", p.Trailer, doc.Transactions, doc.Expand); err != nil {
+		return nil, err
+	}
+
+	// The envelope.
+	interchange := fmt.Sprintf("%09d", number)
+	setControl := fmt.Sprintf("%04d", number)
+	repetition := "U"
+	if p.Version == X12V5010 {
+		repetition = "^"
+	}
+	isa := []string{"ISA", "00", strings.Repeat(" ", 10), "00", strings.Repeat(" ", 10),
+		p.SenderQualifier, fmt.Sprintf("%-15s", p.SenderID), p.ReceiverQualifier, fmt.Sprintf("%-15s", p.ReceiverID),
+		date[2:], clock[:4], repetition, p.Version[:5], interchange, "0", p.Usage, p.SubelementSeparator}
+	gs := []string{"GS", "RA", p.SenderID, p.ReceiverID, date, clock[:4], strconv.Itoa(number), "X", p.Version}
+	st := []string{"ST", "820", setControl}
+	se := []string{"SE", strconv.Itoa(len(segments) + 2), setControl}
+
+	var buffer bytes.Buffer
+	all := append([][]string{isa, gs, st}, segments...)
+	all = append(all, se, []string{"GE", "1", strconv.Itoa(number)}, []string{"IEA", "1", interchange})
+	for _, segment := range all {
+		buffer.WriteString(strings.Join(segment, p.ElementSeparator))
+		buffer.WriteString(p.SegmentTerminator)
+		if p.LineBreaks {
+			buffer.WriteString("\n")
+		}
+	}
+	return buffer.Bytes(), nil
+}
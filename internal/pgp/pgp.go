@@ -0,0 +1,337 @@
+// =============================================================================
+// CSV to XML Converter - PGP Output Protection
+// =============================================================================
+//
+// This package encrypts and signs output files with OpenPGP, for targets
+// (such as banks) that only accept protected files. It is configured per
+// department in the "pgp" section:
+//
+//   pgp:
+//     enabled: true
+//     recipient_keyring: ./keys/bank_public.asc
+//     signing_key: ./keys/our_private.asc
+//     signing_key_passphrase_env: PGP_PASSPHRASE
+//     armor: true
+//     detached_signature: true
+//
+// Files are streamed, so large outputs are not held in memory. An output
+// that is encrypted is written in plaintext outside the output directory,
+// where the target system could pick it up, and only the finished
+// encrypted file is renamed into the output directory. The plaintext is
+// removed once the encrypted file has been written.
+//
+// =============================================================================
+
+package pgp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+)
+
+// SignatureSuffix is appended to a file name to form its detached signature.
+const SignatureSuffix = ".sig"
+
+// Protect encrypts and/or signs an output file.
+//
+// PARAMETERS:
+//   - path: The plaintext output file. With encryption, it should be
+//     outside the output directory.
+//   - outputPath: The output file's path in the output directory. The
+//     encrypted file is written next to it as "<outputPath>.pgp" (or
+//     ".asc"). Without encryption, the plaintext must be at outputPath.
+//   - settings: The department's PGP settings.
+//
+// RETURNS:
+//   - The path of the protected output file (outputPath if it was not
+//     encrypted).
+//   - The path of the detached signature, or "" if none was written.
+//   - An error if a key cannot be loaded or a file cannot be written. If
+//     the error occurs after encryption, the encrypted path is returned with
+//     it so the caller can remove it.
+func Protect(path, outputPath string, settings config.PGPSettings) (string, string, error) {
+	var recipients openpgp.EntityList
+	if settings.RecipientKeyring != "" {
+		keyring, err := readKeyRing(settings.RecipientKeyring)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read recipient keyring: %w", err)
+		}
+		recipients, err = selectRecipients(keyring, settings.Recipients)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	var signer *openpgp.Entity
+	if settings.SigningKey != "" {
+		var err error
+		signer, err = readSigningKey(settings.SigningKey, os.Getenv(settings.SigningKeyPassphraseEnv))
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if len(recipients) > 0 {
+		// Sign inside the encrypted message unless a detached signature is wanted.
+		inlineSigner := signer
+		if settings.DetachedSignature {
+			inlineSigner = nil
+		}
+
+		encryptedPath := outputPath + ".pgp"
+		if settings.Armor {
+			encryptedPath = outputPath + ".asc"
+		}
+		if err := encryptFile(path, encryptedPath, filepath.Base(outputPath), recipients, inlineSigner, settings.Armor); err != nil {
+			return "", "", err
+		}
+		os.Remove(path)
+		outputPath = encryptedPath
+	}
+
+	signaturePath := ""
+	if settings.DetachedSignature {
+		signaturePath = outputPath + SignatureSuffix
+		if err := signFile(outputPath, signaturePath, signer, settings.Armor); err != nil {
+			return outputPath, "", err
+		}
+	}
+
+	return outputPath, signaturePath, nil
+}
+
+// =============================================================================
+// ENCRYPTION AND SIGNING
+// =============================================================================
+
+// encryptFile encrypts src to dst for the recipients, optionally signing it.
+// fileName is the name recorded in the message.
+func encryptFile(src, dst, fileName string, recipients openpgp.EntityList, signer *openpgp.Entity, useArmor bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	return writeFile(dst, useArmor, "PGP MESSAGE", func(w io.Writer) error {
+		hints := &openpgp.FileHints{FileName: fileName}
+		plaintext, err := openpgp.Encrypt(w, recipients, signer, hints, nil)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt: %w", err)
+		}
+		if _, err := io.Copy(plaintext, in); err != nil {
+			plaintext.Close()
+			return fmt.Errorf("failed to encrypt: %w", err)
+		}
+		return plaintext.Close()
+	})
+}
+
+// signFile writes a detached signature of src to dst.
+func signFile(src, dst string, signer *openpgp.Entity, useArmor bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	return writeFile(dst, useArmor, "PGP SIGNATURE", func(w io.Writer) error {
+		if err := openpgp.DetachSign(w, signer, in, nil); err != nil {
+			return fmt.Errorf("failed to sign: %w", err)
+		}
+		return nil
+	})
+}
+
+// writeFile writes a file through an optional armor encoder. The file is
+// written under a temporary name and renamed when complete, so a delivery
+// or pickup never sees a partial file.
+func writeFile(path string, useArmor bool, blockType string, write func(io.Writer) error) error {
+	partial := path + ".partial"
+	file, err := os.Create(partial)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	buffered := bufio.NewWriter(file)
+
+	err = func() error {
+		if !useArmor {
+			return write(buffered)
+		}
+		armored, err := armor.Encode(buffered, blockType, nil)
+		if err != nil {
+			return err
+		}
+		if err := write(armored); err != nil {
+			return err
+		}
+		return armored.Close()
+	}()
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partial, path)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// =============================================================================
+// KEYS
+// =============================================================================
+
+// readKeyRing reads an armored or binary keyring file.
+func readKeyRing(path string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+// selectRecipients returns the keys matching the recipient filters, or all
+// keys when there are no filters.
+func selectRecipients(keyring openpgp.EntityList, filters []string) (openpgp.EntityList, error) {
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("recipient keyring contains no keys")
+	}
+	if len(filters) == 0 {
+		return keyring, nil
+	}
+
+	var selected openpgp.EntityList
+	for _, filter := range filters {
+		entity := findEntity(keyring, filter)
+		if entity == nil {
+			return nil, fmt.Errorf("no key for recipient %q in the recipient keyring", filter)
+		}
+		selected = append(selected, entity)
+	}
+	return selected, nil
+}
+
+// findEntity finds a key by key ID (long or short hex) or user ID text.
+func findEntity(keyring openpgp.EntityList, filter string) *openpgp.Entity {
+	filter = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(filter), "0x"))
+
+	for _, entity := range keyring {
+		keyID := strings.ToLower(entity.PrimaryKey.KeyIdString())
+		if keyID == filter || (len(filter) >= 8 && strings.HasSuffix(keyID, filter)) {
+			return entity
+		}
+		for name := range entity.Identities {
+			if strings.Contains(strings.ToLower(name), filter) {
+				return entity
+			}
+		}
+	}
+	return nil
+}
+
+// readSigningKey reads the first private key of a keyring file and
+// decrypts it with the passphrase.
+func readSigningKey(path, passphrase string) (*openpgp.Entity, error) {
+	keyring, err := readKeyRing(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	for _, entity := range keyring {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if entity.PrivateKey.Encrypted {
+			if passphrase == "" {
+				return nil, fmt.Errorf("signing key %s is protected by a passphrase, but none is set", entity.PrimaryKey.KeyIdString())
+			}
+			if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+				return nil, fmt.Errorf("failed to unlock signing key: %w", err)
+			}
+		}
+		return entity, nil
+	}
+
+	return nil, fmt.Errorf("%s contains no private key", path)
+}
+
+// =============================================================================
+// DETACHED SIGNATURES OF DATA
+// =============================================================================
+
+// SignData returns an armored detached signature of data, e.g. the manifest
+// of a configuration bundle.
+//
+// PARAMETERS:
+//   - data: The data to sign.
+//   - keyPath: A file with the private key (armored or binary).
+//   - passphrase: The passphrase of the key, or "" if it has none.
+//
+// RETURNS:
+//   - The signature.
+//   - An error if the key cannot be loaded.
+func SignData(data []byte, keyPath, passphrase string) ([]byte, error) {
+	signer, err := readSigningKey(keyPath, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, signer, bytes.NewReader(data), nil); err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return signature.Bytes(), nil
+}
+
+// VerifyData checks a detached signature (armored or binary) of data
+// against the keys of a keyring.
+//
+// PARAMETERS:
+//   - data: The signed data.
+//   - signature: The signature.
+//   - keyringPath: A file with the public keys of the trusted signers.
+//
+// RETURNS:
+//   - The key ID and primary user ID of the signer.
+//   - An error if the keyring cannot be read, or the signature is not by
+//     one of its keys or does not match the data.
+func VerifyData(data, signature []byte, keyringPath string) (string, error) {
+	keyring, err := readKeyRing(keyringPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	check := openpgp.CheckDetachedSignature
+	if bytes.Contains(signature, []byte("-----BEGIN PGP")) {
+		check = openpgp.CheckArmoredDetachedSignature
+	}
+	signer, err := check(keyring, bytes.NewReader(data), bytes.NewReader(signature), nil)
+	if err != nil {
+		return "", fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	description := signer.PrimaryKey.KeyIdString()
+	if identity := signer.PrimaryIdentity(); identity != nil {
+		description += " (" + identity.Name + ")"
+	}
+	return description, nil
+}
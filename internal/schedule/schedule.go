@@ -0,0 +1,366 @@
+// =============================================================================
+// CSV to XML Converter - Delivery Scheduling
+// =============================================================================
+//
+// The target system may not accept files at any time: an ERP upload folder
+// must stay untouched during the nightly batch window, and an import job may
+// be overwhelmed by hundreds of files at once. When a delivery schedule is
+// configured, output files are written to a hold directory instead of the
+// output directory, and released from there:
+//
+//   - never inside a hold window (e.g., "23:00-01:00", in local time)
+//   - at most max_files_per_minute files per minute, oldest first
+//
+//   delivery_schedule:
+//     hold_windows: ["23:00-01:00"]
+//     max_files_per_minute: 10
+//
+// Files are converted, validated, and archived as usual; only their arrival
+// in the output directory is delayed. Each run (and each watch scan)
+// releases what the schedule allows.
+//
+// =============================================================================
+
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// signatureSuffix is the suffix of detached signatures, pgp.SignatureSuffix.
+// (The pgp package cannot be imported here: it imports the configuration,
+// which validates hold windows with this package.)
+const signatureSuffix = ".sig"
+
+// =============================================================================
+// HOLD WINDOWS
+// =============================================================================
+
+// Window is a daily period, in local time, e.g. one in which no files are
+// released.
+type Window struct {
+	// start and end are offsets from midnight. A window with end <= start
+	// crosses midnight.
+	start, end time.Duration
+}
+
+// ParseWindow parses a window written as "HH:MM-HH:MM", e.g. "23:00-01:00".
+//
+// PARAMETERS:
+//   - s: The window.
+//
+// RETURNS:
+//   - The window.
+//   - An error if s is not a valid window.
+func ParseWindow(s string) (Window, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid window %q: expected HH:MM-HH:MM", s)
+	}
+
+	start, err := parseClock(strings.TrimSpace(from))
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %w", s, err)
+	}
+	end, err := parseClock(strings.TrimSpace(to))
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %w", s, err)
+	}
+	if start == end {
+		return Window{}, fmt.Errorf("invalid window %q: start and end are equal", s)
+	}
+
+	return Window{start: start, end: end}, nil
+}
+
+// parseClock parses a time of day written as "HH:MM".
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day (HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t is inside the window.
+func (w Window) Contains(t time.Time) bool {
+	offset := sinceMidnight(t)
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// End returns the end of the window that contains t.
+func (w Window) End(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	end := midnight.Add(w.end)
+	if !end.After(t) {
+		end = midnight.AddDate(0, 0, 1).Add(w.end)
+	}
+	return end
+}
+
+// String formats the window as "HH:MM-HH:MM".
+func (w Window) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return clock(w.start) + "-" + clock(w.end)
+}
+
+// sinceMidnight returns the time of day of t.
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
+
+// =============================================================================
+// SCHEDULE
+// =============================================================================
+
+// Schedule decides when held output files are released. A Schedule keeps
+// the times of its recent releases, so a long-running watcher keeps one for
+// its lifetime. It is not safe for concurrent use.
+type Schedule struct {
+	windows      []Window
+	maxPerMinute int
+
+	// released are the release times within the last minute.
+	released []time.Time
+}
+
+// New creates a schedule.
+//
+// PARAMETERS:
+//   - windows: The hold windows (see ParseWindow).
+//   - maxPerMinute: The maximum number of files released per minute, or 0
+//     for no limit.
+//
+// RETURNS:
+//   - The schedule, or nil if it has no windows and no limit.
+//   - An error if a window is invalid.
+func New(windows []string, maxPerMinute int) (*Schedule, error) {
+	if len(windows) == 0 && maxPerMinute <= 0 {
+		return nil, nil
+	}
+
+	s := &Schedule{maxPerMinute: maxPerMinute}
+	for _, window := range windows {
+		w, err := ParseWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		s.windows = append(s.windows, w)
+	}
+	return s, nil
+}
+
+// HeldUntil returns the end of the hold window t is in, or the zero time if
+// t is not in a hold window. Overlapping and adjacent windows are treated
+// as one.
+func (s *Schedule) HeldUntil(t time.Time) time.Time {
+	var until time.Time
+	for held := true; held; {
+		held = false
+		for _, w := range s.windows {
+			if w.Contains(t) {
+				t = w.End(t)
+				until = t
+				held = true
+			}
+		}
+	}
+	return until
+}
+
+// rateWait returns how long to wait at t before the rate limit allows
+// another release, or 0.
+func (s *Schedule) rateWait(t time.Time) time.Duration {
+	if s.maxPerMinute <= 0 {
+		return 0
+	}
+
+	// Forget releases older than a minute.
+	recent := s.released[:0]
+	for _, r := range s.released {
+		if t.Sub(r) < time.Minute {
+			recent = append(recent, r)
+		}
+	}
+	s.released = recent
+
+	if len(s.released) < s.maxPerMinute {
+		return 0
+	}
+	return s.released[0].Add(time.Minute).Sub(t)
+}
+
+// =============================================================================
+// RELEASE
+// =============================================================================
+
+// Released is a file moved from the hold directory to its destination.
+type Released struct {
+	From string
+	To   string
+}
+
+// Report describes a release.
+type Report struct {
+	// Released are the files released, oldest first.
+	Released []Released
+
+	// Remaining is the number of files still held.
+	Remaining int
+
+	// HeldUntil is the end of the hold window that stopped the release, or
+	// the zero time.
+	HeldUntil time.Time
+
+	// Errors are the files that could not be released. They stay held.
+	Errors []error
+}
+
+// HoldDir returns the directory a department's output files are held in.
+func HoldDir(holdDir, department string) string {
+	return filepath.Join(holdDir, department)
+}
+
+// Release moves held files to their destination directories, oldest first,
+// as far as the hold windows and the rate limit allow. Detached signatures
+// (see signatureSuffix) are moved just before their file and are not
+// counted.
+//
+// PARAMETERS:
+//   - holdDir: The hold directory, with a subdirectory per department.
+//   - destination: Returns the output directory of a department code.
+//   - move: Moves a file (e.g., utils.FileManager.MoveFile).
+//   - wait: Wait for the rate limit to allow the remaining files, instead of
+//     leaving them for the next release. Never waits for a hold window.
+//
+// RETURNS:
+//   - What was released and what is still held.
+func (s *Schedule) Release(holdDir string, destination func(department string) (string, error), move func(src, dst string) error, wait bool) Report {
+	var report Report
+
+	held, err := heldFiles(holdDir)
+	if err != nil {
+		report.Errors = append(report.Errors, err)
+		return report
+	}
+
+	for i, file := range held {
+		now := time.Now()
+		if until := s.HeldUntil(now); !until.IsZero() {
+			report.HeldUntil = until
+			report.Remaining += len(held) - i
+			return report
+		}
+
+		if delay := s.rateWait(now); delay > 0 {
+			if !wait {
+				report.Remaining += len(held) - i
+				return report
+			}
+			time.Sleep(delay)
+			if until := s.HeldUntil(time.Now()); !until.IsZero() {
+				report.HeldUntil = until
+				report.Remaining += len(held) - i
+				return report
+			}
+		}
+
+		dir, err := destination(file.department)
+		if err == nil {
+			err = os.MkdirAll(dir, 0755)
+		}
+		to := filepath.Join(dir, filepath.Base(file.path))
+		if err == nil && file.signature {
+			err = move(file.path+signatureSuffix, to+signatureSuffix)
+		}
+		if err == nil {
+			err = move(file.path, to)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("failed to release %s: %w", file.path, err))
+			report.Remaining++
+			continue
+		}
+
+		s.released = append(s.released, time.Now())
+		report.Released = append(report.Released, Released{From: file.path, To: to})
+	}
+
+	return report
+}
+
+// heldFile is a file in the hold directory.
+type heldFile struct {
+	path       string
+	department string
+	modTime    time.Time
+
+	// signature is true if the file has a detached signature.
+	signature bool
+}
+
+// heldFiles lists the held files, oldest first.
+func heldFiles(holdDir string) ([]heldFile, error) {
+	departments, err := os.ReadDir(holdDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list held files: %w", err)
+	}
+
+	var files []heldFile
+	for _, dept := range departments {
+		if !dept.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(holdDir, dept.Name())
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list held files: %w", err)
+		}
+
+		names := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			names[entry.Name()] = true
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.HasSuffix(name, signatureSuffix) || strings.HasSuffix(name, ".partial") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				// Removed since it was listed.
+				continue
+			}
+			files = append(files, heldFile{
+				path:       filepath.Join(dir, name),
+				department: dept.Name(),
+				modTime:    info.ModTime(),
+				signature:  names[name+signatureSuffix],
+			})
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.Before(files[j].modTime)
+		}
+		return files[i].path < files[j].path
+	})
+	return files, nil
+}
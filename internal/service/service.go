@@ -0,0 +1,89 @@
+// =============================================================================
+// CSV to XML Converter - Service Module
+// =============================================================================
+//
+// This module runs the watch mode as an operating system service:
+//   - Windows: a Windows service managed by the Service Control Manager
+//   - Linux:   a systemd unit
+//
+// The platform-specific parts live in service_windows.go, service_linux.go,
+// and service_other.go. This file contains the shared types.
+//
+// USAGE:
+//   service.Install(service.Config{Name: "csv2xml", Executable: exe, Args: args})
+//   service.Uninstall("csv2xml")
+//   service.Run("csv2xml", func(stop <-chan struct{}) error { ... })
+//
+// =============================================================================
+
+package service
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// =============================================================================
+// CONSTANTS
+// =============================================================================
+
+// DefaultName is the default service (and systemd unit) name.
+const DefaultName = "csv2xml"
+
+// =============================================================================
+// CONFIGURATION
+// =============================================================================
+
+// Config describes the service to install.
+type Config struct {
+	// Name is the service name (Windows) or unit name without ".service" (systemd).
+	Name string
+
+	// DisplayName is the human-readable name shown in the service manager.
+	DisplayName string
+
+	// Description describes the service.
+	Description string
+
+	// Executable is the absolute path to the converter executable.
+	Executable string
+
+	// Args are the command-line arguments passed to the executable
+	// (e.g., "watch", "--workdir", "C:\\csv2xml"). Services do not start in
+	// the installation directory, so paths must be absolute.
+	Args []string
+
+	// User is the account the service runs as (systemd only). Empty means root.
+	User string
+
+	// StopTimeout is how long the service manager waits for the service to
+	// stop before killing it (systemd only; a Windows service reports its
+	// progress while stopping). Zero keeps the service manager's default.
+	StopTimeout time.Duration
+}
+
+// =============================================================================
+// RUNNING
+// =============================================================================
+
+// RunFunc is the long-running function executed by the service.
+// It must return soon after the stop channel is closed.
+type RunFunc func(stop <-chan struct{}) error
+
+// runUntilSignal runs the function in the foreground and closes the stop
+// channel on Ctrl+C or SIGTERM (which systemd sends on "systemctl stop").
+func runUntilSignal(run RunFunc) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	return run(stop)
+}
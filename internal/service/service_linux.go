@@ -0,0 +1,140 @@
+//go:build linux
+
+// =============================================================================
+// CSV to XML Converter - systemd Integration
+// =============================================================================
+//
+// Installs the watch mode as a systemd unit in /etc/systemd/system. The unit
+// restarts the converter on failure and starts it at boot.
+//
+// =============================================================================
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// unitDir is the directory where unit files are installed.
+const unitDir = "/etc/systemd/system"
+
+// Install writes the systemd unit file, then enables and starts the unit.
+//
+// PARAMETERS:
+//   - cfg: The service configuration.
+//
+// RETURNS:
+//   - An error if the unit cannot be written or systemctl fails.
+func Install(cfg Config) error {
+	unitPath := unitPath(cfg.Name)
+	if _, err := os.Stat(unitPath); err == nil {
+		return fmt.Errorf("service %s is already installed (%s)", cfg.Name, unitPath)
+	}
+
+	if err := os.WriteFile(unitPath, []byte(unitFile(cfg)), 0644); err != nil {
+		return fmt.Errorf("failed to write unit file: %w", err)
+	}
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", "--now", cfg.Name+".service")
+}
+
+// Uninstall stops and disables the unit, then removes the unit file.
+//
+// PARAMETERS:
+//   - name: The service name.
+//
+// RETURNS:
+//   - An error if the unit is not installed or systemctl fails.
+func Uninstall(name string) error {
+	unitPath := unitPath(name)
+	if _, err := os.Stat(unitPath); err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+
+	if err := systemctl("disable", "--now", name+".service"); err != nil {
+		return err
+	}
+
+	if err := os.Remove(unitPath); err != nil {
+		return fmt.Errorf("failed to remove unit file: %w", err)
+	}
+
+	return systemctl("daemon-reload")
+}
+
+// Run runs the function until systemd (or Ctrl+C) stops the process.
+func Run(name string, run RunFunc) error {
+	return runUntilSignal(run)
+}
+
+// IsService reports whether the process was started by the service manager.
+// systemd units log through stdout/syslog like interactive runs, so this is
+// only true on Windows.
+func IsService() bool {
+	return false
+}
+
+// =============================================================================
+// HELPER FUNCTIONS
+// =============================================================================
+
+// unitPath returns the path of the unit file for a service.
+func unitPath(name string) string {
+	return filepath.Join(unitDir, name+".service")
+}
+
+// unitFile renders the systemd unit file.
+func unitFile(cfg Config) string {
+	var b strings.Builder
+
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", cfg.Description)
+	b.WriteString("After=network-online.target remote-fs.target\n")
+	b.WriteString("Wants=network-online.target\n\n")
+
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=simple\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", quoteCommand(cfg.Executable, cfg.Args))
+	if cfg.User != "" {
+		fmt.Fprintf(&b, "User=%s\n", cfg.User)
+	}
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=10\n")
+	if cfg.StopTimeout > 0 {
+		fmt.Fprintf(&b, "TimeoutStopSec=%d\n", int(cfg.StopTimeout.Seconds()))
+	}
+	fmt.Fprintf(&b, "SyslogIdentifier=%s\n\n", cfg.Name)
+
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+
+	return b.String()
+}
+
+// quoteCommand joins an executable and its arguments for ExecStart,
+// quoting words that contain spaces.
+func quoteCommand(executable string, args []string) string {
+	words := append([]string{executable}, args...)
+	for i, word := range words {
+		if strings.ContainsAny(word, " \t\"") {
+			words[i] = `"` + strings.ReplaceAll(word, `"`, `\"`) + `"`
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// systemctl runs a systemctl command and includes its output in errors.
+func systemctl(args ...string) error {
+	output, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
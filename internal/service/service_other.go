@@ -0,0 +1,27 @@
+//go:build !linux && !windows
+
+package service
+
+import (
+	"fmt"
+)
+
+// Install is not supported on this platform.
+func Install(cfg Config) error {
+	return fmt.Errorf("service install is only supported on Windows and Linux (systemd)")
+}
+
+// Uninstall is not supported on this platform.
+func Uninstall(name string) error {
+	return fmt.Errorf("service uninstall is only supported on Windows and Linux (systemd)")
+}
+
+// Run runs the function in the foreground until Ctrl+C or SIGTERM.
+func Run(name string, run RunFunc) error {
+	return runUntilSignal(run)
+}
+
+// IsService always returns false on this platform.
+func IsService() bool {
+	return false
+}
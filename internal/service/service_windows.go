@@ -0,0 +1,194 @@
+//go:build windows
+
+// =============================================================================
+// CSV to XML Converter - Windows Service Integration
+// =============================================================================
+//
+// Installs the watch mode as an automatically started Windows service and
+// registers the Event Log source used by the logging module. When started by
+// the Service Control Manager, Run reports the service status and translates
+// stop/shutdown requests into closing the stop channel.
+//
+// =============================================================================
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Install creates the Windows service and its Event Log source.
+//
+// PARAMETERS:
+//   - cfg: The service configuration.
+//
+// RETURNS:
+//   - An error if the service already exists or cannot be created.
+func Install(cfg Config) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(cfg.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", cfg.Name)
+	}
+
+	s, err := m.CreateService(cfg.Name, cfg.Executable, mgr.Config{
+		DisplayName: cfg.DisplayName,
+		Description: cfg.Description,
+		StartType:   mgr.StartAutomatic,
+	}, cfg.Args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	// Restart the service after a failure.
+	recovery := []mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 10 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 60 * time.Second},
+	}
+	if err := s.SetRecoveryActions(recovery, 24*60*60); err != nil {
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+
+	if err := eventlog.InstallAsEventCreate(cfg.Name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to register event log source: %w", err)
+	}
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("service installed but failed to start: %w", err)
+	}
+
+	return nil
+}
+
+// Uninstall stops and deletes the Windows service and its Event Log source.
+//
+// PARAMETERS:
+//   - name: The service name.
+//
+// RETURNS:
+//   - An error if the service is not installed or cannot be deleted.
+func Uninstall(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+
+	// Stop the service if it is running; ignore the error if it is not.
+	s.Control(svc.Stop)
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+
+	if err := eventlog.Remove(name); err != nil {
+		return fmt.Errorf("failed to remove event log source: %w", err)
+	}
+
+	return nil
+}
+
+// Run runs the function as a Windows service when started by the Service
+// Control Manager, and in the foreground (stopped by Ctrl+C) otherwise.
+func Run(name string, run RunFunc) error {
+	if !IsService() {
+		return runUntilSignal(run)
+	}
+	return svc.Run(name, &handler{run: run})
+}
+
+// IsService reports whether the process was started by the Service Control Manager.
+func IsService() bool {
+	isService, err := svc.IsWindowsService()
+	return err == nil && isService
+}
+
+// =============================================================================
+// SERVICE HANDLER
+// =============================================================================
+
+// handler adapts a RunFunc to the svc.Handler interface.
+type handler struct {
+	run RunFunc
+}
+
+// Execute is called by the Service Control Manager.
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+
+	status <- svc.Status{State: svc.StartPending}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- h.run(stop)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case err := <-done:
+			// The run function exited on its own; report a failure exit code
+			// so the recovery actions restart the service.
+			if err != nil {
+				return true, 1
+			}
+			return false, 0
+
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				close(stop)
+				return h.drain(done, status)
+			}
+		}
+	}
+}
+
+// drain waits for the run function to return after a stop request. The
+// stop pending status is repeated with a new checkpoint every few seconds,
+// so the Service Control Manager keeps waiting while files in progress
+// finish.
+func (h *handler) drain(done <-chan error, status chan<- svc.Status) (bool, uint32) {
+	const interval = 5 * time.Second
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	checkpoint := uint32(1)
+	for {
+		status <- svc.Status{State: svc.StopPending, CheckPoint: checkpoint, WaitHint: uint32(2 * interval / time.Millisecond)}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				return true, 1
+			}
+			return false, 0
+		case <-ticker.C:
+			checkpoint++
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// =============================================================================
+// CSV to XML Converter - SQL Sink
+// =============================================================================
+//
+// This package inserts the transactions and line items of a converted file
+// into staging tables, for departments moving off file-based uploads. The
+// sink is configured per department (see config.SQLSinkSettings):
+//
+//   sql_sink:
+//     driver: postgres         # or sqlserver
+//     dsn_env: CLAIMS_STAGING_DSN
+//     transactions_table: staging.claim_transactions
+//     line_items_table: staging.claim_lines
+//     transaction_columns: {vendor_id: VENDOR_ID}
+//     line_item_columns: {account: ACCOUNT, amount: AMOUNT}
+//
+// All rows of a file are inserted in one database transaction, which the
+// converter commits once the file's outputs are delivered, or rolls back,
+// so a file is never half loaded. Besides the mapped columns, the sink fills
+// these columns:
+//
+//   transactions: load_id, department, source_file, transaction_no,
+//                 transaction_key
+//   line items:   load_id, transaction_no, line_item_no, row_no
+//
+// load_id is the output file name without its extension, so the rows can be
+// matched with the XML, the audit trail, and the data lake. The sink only
+// inserts; the tables are created by the target system's team.
+//
+// =============================================================================
+
+package sqlsink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+
+	// Database drivers, registered as "pgx" and "sqlserver".
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/microsoft/go-mssqldb"
+)
+
+// Load is the rows of one output document of a file.
+type Load struct {
+	// ID is the load ID: the output file name without its extension.
+	ID string
+
+	// Department is the department code, and SourceFile the name of the
+	// input file.
+	Department string
+	SourceFile string
+
+	// Transactions are the transactions, in output order.
+	Transactions []Transaction
+}
+
+// Transaction is an inserted transaction.
+type Transaction struct {
+	// Number is the transaction number in the output, and Key the value of
+	// its grouping field.
+	Number int
+	Key    string
+
+	// Fields are the transaction-level values by CSV column.
+	Fields map[string]string
+
+	// LineItems are the transaction's line items.
+	LineItems []LineItem
+}
+
+// LineItem is an inserted line item.
+type LineItem struct {
+	// Number is the line item number in the output, and SourceRow its row
+	// number in the input file.
+	Number    int
+	SourceRow int
+
+	// Fields are the values by CSV column.
+	Fields map[string]string
+}
+
+// Pending is a file's inserted rows, not yet committed.
+type Pending struct {
+	db *sql.DB
+	tx *sql.Tx
+
+	// Transactions and LineItems are the numbers of inserted rows.
+	Transactions int
+	LineItems    int
+}
+
+// Insert opens a database transaction and inserts the rows of a file's
+// loads into the staging tables.
+//
+// PARAMETERS:
+//   - settings: The department's SQL sink.
+//   - loads: The output documents of the file.
+//
+// RETURNS:
+//   - The inserted rows, to be committed or rolled back.
+//   - An error if the database cannot be reached or a row is refused.
+//     Nothing is inserted then.
+func Insert(settings config.SQLSinkSettings, loads []Load) (*Pending, error) {
+	db, err := open(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), settings.Timeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %s database: %w", settings.Driver, err)
+	}
+
+	// The transaction outlives the timeout: it is committed after delivery.
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to begin database transaction: %w", err)
+	}
+	pending := &Pending{db: db, tx: tx}
+
+	if err := pending.insert(ctx, settings, loads); err != nil {
+		pending.Rollback()
+		return nil, err
+	}
+	return pending, nil
+}
+
+// Commit commits the inserted rows and closes the connection.
+func (p *Pending) Commit() error {
+	defer p.db.Close()
+	if err := p.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit database transaction: %w", err)
+	}
+	return nil
+}
+
+// Rollback discards the inserted rows and closes the connection.
+func (p *Pending) Rollback() error {
+	defer p.db.Close()
+	if err := p.tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		return fmt.Errorf("failed to roll back database transaction: %w", err)
+	}
+	return nil
+}
+
+// Ping checks that the database of a SQL sink can be reached, for the
+// doctor command.
+func Ping(ctx context.Context, settings config.SQLSinkSettings) error {
+	db, err := open(settings)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.PingContext(ctx)
+}
+
+// open opens the sink's database. The connection is made by the first
+// statement.
+func open(settings config.SQLSinkSettings) (*sql.DB, error) {
+	dsn := settings.DSN
+	if dsn == "" {
+		dsn = os.Getenv(settings.DSNEnv)
+		if dsn == "" {
+			return nil, fmt.Errorf("SQL sink DSN is not set (environment variable %s is empty)", settings.DSNEnv)
+		}
+	}
+
+	driver := "pgx"
+	if settings.Driver == config.SQLDriverSQLServer {
+		driver = "sqlserver"
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", settings.Driver, err)
+	}
+	return db, nil
+}
+
+// insert inserts the rows with a prepared statement per table.
+func (p *Pending) insert(ctx context.Context, settings config.SQLSinkSettings, loads []Load) error {
+	transactionColumns := sortedColumns(settings.TransactionColumns)
+	transactionStmt, err := p.tx.PrepareContext(ctx, insertStatement(settings.Driver, settings.TransactionsTable,
+		append(append([]string{}, config.SQLTransactionMetadataColumns...), transactionColumns...)))
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert into %s: %w", settings.TransactionsTable, err)
+	}
+	defer transactionStmt.Close()
+
+	var lineItemColumns []string
+	var lineItemStmt *sql.Stmt
+	if settings.LineItemsTable != "" {
+		lineItemColumns = sortedColumns(settings.LineItemColumns)
+		lineItemStmt, err = p.tx.PrepareContext(ctx, insertStatement(settings.Driver, settings.LineItemsTable,
+			append(append([]string{}, config.SQLLineItemMetadataColumns...), lineItemColumns...)))
+		if err != nil {
+			return fmt.Errorf("failed to prepare insert into %s: %w", settings.LineItemsTable, err)
+		}
+		defer lineItemStmt.Close()
+	}
+
+	for _, load := range loads {
+		for _, transaction := range load.Transactions {
+			args := []any{load.ID, load.Department, load.SourceFile, int64(transaction.Number), nullable(transaction.Key)}
+			args = append(args, values(transaction.Fields, transactionColumns, settings.TransactionColumns)...)
+			if _, err := transactionStmt.ExecContext(ctx, args...); err != nil {
+				return fmt.Errorf("failed to insert transaction %d of %s into %s: %w",
+					transaction.Number, load.ID, settings.TransactionsTable, err)
+			}
+			p.Transactions++
+
+			if lineItemStmt == nil {
+				continue
+			}
+			for _, lineItem := range transaction.LineItems {
+				args := []any{load.ID, int64(transaction.Number), int64(lineItem.Number), int64(lineItem.SourceRow)}
+				args = append(args, values(lineItem.Fields, lineItemColumns, settings.LineItemColumns)...)
+				if _, err := lineItemStmt.ExecContext(ctx, args...); err != nil {
+					return fmt.Errorf("failed to insert line item %d (row %d) of %s into %s: %w",
+						lineItem.Number, lineItem.SourceRow, load.ID, settings.LineItemsTable, err)
+				}
+				p.LineItems++
+			}
+		}
+	}
+	return nil
+}
+
+// insertStatement returns the INSERT statement of a table, with the
+// driver's placeholders: $1 for Postgres, @p1 for SQL Server. The names
+// are validated by the configuration.
+func insertStatement(driver, table string, columns []string) string {
+	placeholders := make([]string, len(columns))
+	for i := range columns {
+		if driver == config.SQLDriverSQLServer {
+			placeholders[i] = "@p" + strconv.Itoa(i+1)
+		} else {
+			placeholders[i] = "$" + strconv.Itoa(i+1)
+		}
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		table, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+}
+
+// sortedColumns returns the mapped table columns, sorted, so the statement
+// is the same for every file.
+func sortedColumns(mapping map[string]string) []string {
+	columns := make([]string, 0, len(mapping))
+	for column := range mapping {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// values returns the values of the mapped columns of a row.
+func values(fields map[string]string, columns []string, mapping map[string]string) []any {
+	args := make([]any, len(columns))
+	for i, column := range columns {
+		args[i] = nullable(fields[mapping[column]])
+	}
+	return args
+}
+
+// nullable returns nil (NULL) for an empty value.
+func nullable(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// azureStore is a prefix in an Azure Blob Storage container.
+type azureStore struct {
+	client    *azblob.Client
+	account   string
+	container string
+	prefix    string
+}
+
+// openAzure creates a store for an "az://account/container/prefix" URI.
+func openAzure(location string) (Store, error) {
+	account, rest := splitLocation(strings.TrimPrefix(location, "az://"))
+	containerName, prefix := splitLocation(rest)
+	if account == "" || containerName == "" {
+		return nil, fmt.Errorf("invalid Azure URI %q: expected az://account/container/prefix", location)
+	}
+
+	var client *azblob.Client
+	var err error
+	if connectionString := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); connectionString != "" {
+		client, err = azblob.NewClientFromConnectionString(connectionString, nil)
+	} else {
+		credential, credErr := azidentity.NewDefaultAzureCredential(nil)
+		if credErr != nil {
+			return nil, fmt.Errorf("failed to load Azure credentials: %w", credErr)
+		}
+		client, err = azblob.NewClient(fmt.Sprintf("https://%s.blob.core.windows.net/", account), credential, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure Blob client: %w", err)
+	}
+
+	return &azureStore{client: client, account: account, container: containerName, prefix: prefix}, nil
+}
+
+// URI returns the az:// URI of the store.
+func (s *azureStore) URI() string {
+	return "az://" + s.account + "/" + objectKey(s.container, s.prefix)
+}
+
+// List returns all blobs under the prefix.
+func (s *azureStore) List(ctx context.Context) ([]Object, error) {
+	listPrefix := ""
+	if s.prefix != "" {
+		listPrefix = s.prefix + "/"
+	}
+
+	pager := s.client.NewListBlobsFlatPager(s.container, &container.ListBlobsFlatOptions{
+		Prefix: to.Ptr(listPrefix),
+	})
+
+	var objects []Object
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", s.URI(), err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil || item.Properties == nil {
+				continue
+			}
+			object := Object{Name: strings.TrimPrefix(*item.Name, listPrefix)}
+			if item.Properties.ContentLength != nil {
+				object.Size = *item.Properties.ContentLength
+			}
+			if item.Properties.LastModified != nil {
+				object.ModTime = *item.Properties.LastModified
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+// Download streams a blob into a local file.
+func (s *azureStore) Download(ctx context.Context, name, localPath string) error {
+	file, err := createLocalFile(localPath)
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.DownloadFile(ctx, s.container, objectKey(s.prefix, name), file, nil); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	return file.Close()
+}
+
+// Upload streams a local file into a block blob.
+func (s *azureStore) Upload(ctx context.Context, localPath, name string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer file.Close()
+
+	if _, err := s.client.UploadFile(ctx, s.container, objectKey(s.prefix, name), file, nil); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	return nil
+}
+
+// Delete removes a blob.
+func (s *azureStore) Delete(ctx context.Context, name string) error {
+	_, err := s.client.DeleteBlob(ctx, s.container, objectKey(s.prefix, name), nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore is a directory on the local filesystem or a mounted share.
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore creates a store for a local directory.
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{dir: dir}
+}
+
+// URI returns the directory path.
+func (s *LocalStore) URI() string {
+	return s.dir
+}
+
+// path returns the local path of a file in the store.
+func (s *LocalStore) path(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(name))
+}
+
+// List returns the files in the directory and its subdirectories.
+func (s *LocalStore) List(ctx context.Context) ([]Object, error) {
+	var objects []Object
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Name: filepath.ToSlash(name), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", s.dir, err)
+	}
+	return objects, nil
+}
+
+// Download copies a file from the directory.
+func (s *LocalStore) Download(ctx context.Context, name, localPath string) error {
+	return copyLocalFile(s.path(name), localPath)
+}
+
+// Upload copies a file into the directory.
+func (s *LocalStore) Upload(ctx context.Context, localPath, name string) error {
+	return copyLocalFile(localPath, s.path(name))
+}
+
+// Delete removes a file from the directory.
+func (s *LocalStore) Delete(ctx context.Context, name string) error {
+	if err := os.Remove(s.path(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
+
+// copyLocalFile copies src to dst, keeping the modification time.
+func copyLocalFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := createLocalFile(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+
+	if info, err := in.Stat(); err == nil {
+		os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// s3Store is a prefix in an S3 bucket.
+type s3Store struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// openS3 creates a store for an "s3://bucket/prefix" URI.
+func openS3(ctx context.Context, location string) (Store, error) {
+	bucket, prefix := splitLocation(strings.TrimPrefix(location, "s3://"))
+	if bucket == "" {
+		return nil, fmt.Errorf("invalid S3 URI %q: missing bucket", location)
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		// S3-compatible services (e.g., MinIO) usually need path-style URLs.
+		o.UsePathStyle = os.Getenv("AWS_ENDPOINT_URL") != "" || os.Getenv("AWS_ENDPOINT_URL_S3") != ""
+	})
+
+	return &s3Store{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+// URI returns the s3:// URI of the store.
+func (s *s3Store) URI() string {
+	return "s3://" + objectKey(s.bucket, s.prefix)
+}
+
+// List returns all objects under the prefix.
+func (s *s3Store) List(ctx context.Context) ([]Object, error) {
+	listPrefix := ""
+	if s.prefix != "" {
+		listPrefix = s.prefix + "/"
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(listPrefix),
+	})
+
+	var objects []Object
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", s.URI(), err)
+		}
+		for _, item := range page.Contents {
+			name := strings.TrimPrefix(aws.ToString(item.Key), listPrefix)
+			if name == "" {
+				continue
+			}
+			objects = append(objects, Object{
+				Name:    name,
+				Size:    aws.ToInt64(item.Size),
+				ModTime: aws.ToTime(item.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// Download streams an object into a local file.
+func (s *s3Store) Download(ctx context.Context, name, localPath string) error {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey(s.prefix, name)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	defer output.Body.Close()
+
+	file, err := createLocalFile(localPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, output.Body); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	return file.Close()
+}
+
+// Upload streams a local file into an object.
+func (s *s3Store) Upload(ctx context.Context, localPath, name string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", localPath, err)
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(objectKey(s.prefix, name)),
+		Body:          file,
+		ContentLength: aws.Int64(info.Size()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	return nil
+}
+
+// Delete removes an object.
+func (s *s3Store) Delete(ctx context.Context, name string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey(s.prefix, name)),
+	})
+	var notFound *types.NoSuchKey
+	if err != nil && !errors.As(err, &notFound) {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// =============================================================================
+// CSV to XML Converter - Storage Backends
+// =============================================================================
+//
+// This package lets the input, output, and archive directories live in an
+// object store instead of the local filesystem. A location is given as a URI:
+//
+//   ./input                          - a local directory (any path without a scheme)
+//   s3://bucket/prefix               - an Amazon S3 (or S3-compatible) prefix
+//   az://account/container/prefix    - an Azure Blob Storage container prefix
+//
+// A Store is a directory-like view of one location: List returns all objects
+// under the prefix (like walking a directory), and files are transferred by
+// streaming between the store and a local file, so large files are never
+// held in memory.
+//
+// CREDENTIALS:
+//   - S3 uses the standard AWS credential chain (environment variables, shared
+//     config/profile, or the instance/task role). Set AWS_REGION, and
+//     AWS_ENDPOINT_URL for S3-compatible services.
+//   - Azure uses AZURE_STORAGE_CONNECTION_STRING when set, otherwise
+//     DefaultAzureCredential (environment, managed identity, or Azure CLI).
+//
+// =============================================================================
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// STORE INTERFACE
+// =============================================================================
+
+// Object describes a file in a store.
+type Object struct {
+	// Name is the file path relative to the store location, with "/"
+	// separators (e.g., "2024/01/15/payments.csv").
+	Name string
+
+	// Size is the file size in bytes.
+	Size int64
+
+	// ModTime is the last modification time.
+	ModTime time.Time
+}
+
+// Store is a directory-like storage location.
+//
+// CUSTOMIZATION:
+//   - To add a backend, implement this interface and register its URI
+//     scheme in Open.
+type Store interface {
+	// URI returns the location URI of the store.
+	URI() string
+
+	// List returns all files under the location, including subdirectories.
+	List(ctx context.Context) ([]Object, error)
+
+	// Download streams the named file into a local file.
+	Download(ctx context.Context, name, localPath string) error
+
+	// Upload streams a local file into the store under the given name.
+	Upload(ctx context.Context, localPath, name string) error
+
+	// Delete removes the named file. Deleting a missing file is not an error.
+	Delete(ctx context.Context, name string) error
+}
+
+// =============================================================================
+// OPENING STORES
+// =============================================================================
+
+// IsRemote reports whether a location is an object-store URI rather than a
+// local path.
+func IsRemote(location string) bool {
+	return strings.HasPrefix(location, "s3://") || strings.HasPrefix(location, "az://")
+}
+
+// Open returns the store for a location.
+//
+// PARAMETERS:
+//   - ctx: The context for loading credentials.
+//   - location: A local path or an s3:// or az:// URI.
+//
+// RETURNS:
+//   - The store.
+//   - An error if the URI is malformed or the client cannot be created.
+func Open(ctx context.Context, location string) (Store, error) {
+	switch {
+	case strings.HasPrefix(location, "s3://"):
+		return openS3(ctx, location)
+	case strings.HasPrefix(location, "az://"):
+		return openAzure(location)
+	case strings.Contains(location, "://"):
+		return nil, fmt.Errorf("unsupported storage URI: %s", location)
+	default:
+		return NewLocalStore(location), nil
+	}
+}
+
+// splitLocation splits "bucket/some/prefix" into "bucket" and "some/prefix".
+func splitLocation(rest string) (string, string) {
+	rest = strings.Trim(rest, "/")
+	head, prefix, _ := strings.Cut(rest, "/")
+	return head, strings.Trim(prefix, "/")
+}
+
+// objectKey joins a prefix and a file name into an object key.
+func objectKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
+
+// =============================================================================
+// RETENTION
+// =============================================================================
+
+// CleanOld removes files older than maxAge from a store. It is the object
+// store counterpart of utils.CleanOldArchives.
+//
+// RETURNS:
+//   - The number of files removed.
+//   - An error if listing or deleting fails.
+func CleanOld(ctx context.Context, store Store, maxAge time.Duration) (int, error) {
+	objects, err := store.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clean archives: %w", err)
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, object := range objects {
+		if object.ModTime.Before(cutoff) {
+			if err := store.Delete(ctx, object.Name); err != nil {
+				return removed, fmt.Errorf("failed to clean archives: %w", err)
+			}
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// createLocalFile creates a local file for a download, including its directory.
+func createLocalFile(localPath string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	file, err := os.Create(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local file: %w", err)
+	}
+	return file, nil
+}
@@ -0,0 +1,181 @@
+// =============================================================================
+// CSV to XML Converter - Amount Signs
+// =============================================================================
+//
+// Departments write credits in different ways: a signed amount ("-100.00"),
+// a trailing sign or suffix ("100.00-", "100.00 CR"), parentheses
+// ("(100.00)"), or an unsigned amount next to a debit/credit indicator
+// column ("100.00" and "CR"). The sign transformations (see the converter's
+// transformer.go) convert between these forms, and the "amount_sign" custom
+// validation checks that an amount agrees with its indicator column.
+//
+// A sign table maps indicator values to the sign of the amount:
+//
+//   signs:
+//     DR: "+"
+//     CR: "-"
+//
+// Indicators are matched without regard to case and surrounding spaces.
+// Default: DR and D are debits (+), CR and C are credits (-).
+//
+// =============================================================================
+
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultSigns is the sign table of departments that configure none.
+var DefaultSigns = map[string]string{"DR": "+", "D": "+", "CR": "-", "C": "-"}
+
+// unsignedAmount matches an amount without a sign, with optional thousands
+// separators.
+var unsignedAmount = regexp.MustCompile(`^(?:\d[\d,]*(?:\.\d*)?|\.\d+)$`)
+
+// IndicatorSign returns the sign of a debit/credit indicator.
+//
+// PARAMETERS:
+//   - indicator: The indicator value, e.g. "cr".
+//   - signs: The sign table, or nil for DefaultSigns.
+//
+// RETURNS:
+//   - "+" or "-", and true; or false if the table has no such indicator.
+func IndicatorSign(indicator string, signs map[string]string) (string, bool) {
+	if len(signs) == 0 {
+		signs = DefaultSigns
+	}
+	indicator = strings.TrimSpace(indicator)
+	for key, sign := range signs {
+		if strings.EqualFold(key, indicator) {
+			return sign, true
+		}
+	}
+	return "", false
+}
+
+// SplitSign splits an amount into its sign and its unsigned amount. It
+// understands leading and trailing signs, parentheses, and indicator
+// suffixes of the sign table ("100.00 CR").
+//
+// PARAMETERS:
+//   - value: The amount.
+//   - signs: The sign table for suffixes, or nil for DefaultSigns.
+//
+// RETURNS:
+//   - The sign ("-", "+", or "" if the amount has none), the unsigned
+//     amount, and true; or false if the value is not an amount.
+func SplitSign(value string, signs map[string]string) (string, string, bool) {
+	amount := strings.TrimSpace(value)
+	sign := ""
+
+	switch {
+	case strings.HasPrefix(amount, "(") && strings.HasSuffix(amount, ")"):
+		sign, amount = "-", amount[1:len(amount)-1]
+	case strings.HasPrefix(amount, "-") || strings.HasPrefix(amount, "+"):
+		sign, amount = amount[:1], amount[1:]
+	case strings.HasSuffix(amount, "-") || strings.HasSuffix(amount, "+"):
+		sign, amount = amount[len(amount)-1:], amount[:len(amount)-1]
+	default:
+		// An indicator suffix: the letters at the end.
+		end := strings.TrimRightFunc(amount, func(r rune) bool {
+			return (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z')
+		})
+		if suffix := amount[len(end):]; suffix != "" {
+			indicatorSign, ok := IndicatorSign(suffix, signs)
+			if !ok {
+				return "", "", false
+			}
+			sign, amount = indicatorSign, end
+		}
+	}
+
+	amount = strings.TrimSpace(amount)
+	if !unsignedAmount.MatchString(amount) {
+		return "", "", false
+	}
+	return sign, amount, true
+}
+
+// isZeroAmount reports whether an unsigned amount is zero.
+func isZeroAmount(amount string) bool {
+	return strings.Trim(amount, "0.,") == ""
+}
+
+// CompileAmountSignValidation compiles an amount sign validation of a
+// department configuration into a validator.
+//
+// PARAMETERS:
+//   - field: The amount field (CSV column header) the rule applies to.
+//   - indicatorField: The debit/credit indicator field of the row.
+//   - signs: The sign table, or nil for DefaultSigns.
+//   - unsigned: Whether the amount must be unsigned, with the sign only in
+//     the indicator. Otherwise its sign must agree with the indicator.
+//   - message: The error message. Default: a message naming the reason.
+//   - severity: "error" or "warning". Default: "error".
+//
+// RETURNS:
+//   - The validator. Empty amounts and values that are not amounts (see
+//     the data type check) are not checked.
+//   - An error if the field or indicator field is missing, a sign is not
+//     "+" or "-", or the severity is unknown.
+func CompileAmountSignValidation(field, indicatorField string, signs map[string]string, unsigned bool, message, severity string) (CustomValidation, error) {
+	custom := CustomValidation{Field: field, Rule: "amount_sign", Code: CodeAmountSign}
+	if field == "" {
+		return custom, fmt.Errorf("field is required")
+	}
+	if indicatorField == "" {
+		return custom, fmt.Errorf("indicator_field is required for field %s", field)
+	}
+	for indicator, sign := range signs {
+		if sign != "+" && sign != "-" {
+			return custom, fmt.Errorf("sign of indicator %q must be \"+\" or \"-\" for field %s", indicator, field)
+		}
+	}
+	if len(signs) == 0 {
+		signs = DefaultSigns
+	}
+
+	var err error
+	if custom.Severity, err = customSeverity(field, severity); err != nil {
+		return custom, err
+	}
+
+	indicators := make([]string, 0, len(signs))
+	for indicator := range signs {
+		indicators = append(indicators, indicator)
+	}
+	sort.Strings(indicators)
+
+	custom.Validate = func(value string, context ValidationContext) string {
+		if strings.TrimSpace(value) == "" {
+			return ""
+		}
+		amountSign, amount, ok := SplitSign(value, signs)
+		if !ok {
+			return ""
+		}
+
+		indicator := context.AllFields[indicatorField]
+		sign, known := IndicatorSign(indicator, signs)
+		reason := ""
+		switch {
+		case !known:
+			reason = fmt.Sprintf("Indicator '%s' in %s is not one of %s", strings.TrimSpace(indicator),
+				indicatorField, strings.Join(indicators, ", "))
+		case unsigned && amountSign != "":
+			reason = fmt.Sprintf("Amount '%s' is signed; its sign belongs in %s", value, indicatorField)
+		case !unsigned && !isZeroAmount(amount) && (amountSign == "-") != (sign == "-"):
+			reason = fmt.Sprintf("Amount '%s' does not have the sign (%s) of %s '%s'", value, sign,
+				indicatorField, strings.TrimSpace(indicator))
+		}
+		if reason == "" || message == "" {
+			return reason
+		}
+		return message
+	}
+	return custom, nil
+}
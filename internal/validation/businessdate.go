@@ -0,0 +1,213 @@
+// =============================================================================
+// CSV to XML Converter - Business Date Validation
+// =============================================================================
+//
+// A payment dated on a weekend or a bank holiday, or far in the past, is
+// rejected by the target system or posted late. The "business_date" custom
+// validation checks that a date falls on a business day of the department's
+// calendar and within an allowed window around the day of the conversion.
+//
+// The calendar's holidays come from a text file with one date (YYYY-MM-DD)
+// per line, optionally followed by the name of the holiday. Blank lines and
+// lines starting with "#" are ignored:
+//
+//   # Bank holidays 2024
+//   2024-01-01 New Year's Day
+//   2024-12-25 Christmas Day
+//
+// Dates are parsed with the format of the field's template data type (e.g.,
+// "date(01/02/2006)"), or the common date formats if it has none. Values
+// that are not dates are left to the data type check (VAL-TYP-001).
+//
+// =============================================================================
+
+package validation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// BusinessCalendar holds the days a department does business on.
+type BusinessCalendar struct {
+	// Weekend are the days of the week without business.
+	Weekend map[time.Weekday]bool
+
+	// Holidays are the names of the holidays by date (YYYY-MM-DD).
+	Holidays map[string]string
+}
+
+// weekdays are the days of the week by name.
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// LoadBusinessCalendar loads a business calendar.
+//
+// PARAMETERS:
+//   - weekend: The names of the weekend days (e.g., "saturday"), or "none"
+//     for a calendar without weekend days.
+//   - holidaysFile: The path to the holiday file, or "" for none.
+//
+// RETURNS:
+//   - The calendar.
+//   - An error if a day is unknown, or the holiday file cannot be read or
+//     has a line that is not a date.
+func LoadBusinessCalendar(weekend []string, holidaysFile string) (*BusinessCalendar, error) {
+	calendar := &BusinessCalendar{
+		Weekend:  make(map[time.Weekday]bool),
+		Holidays: make(map[string]string),
+	}
+
+	for _, name := range weekend {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "none" {
+			continue
+		}
+		day, ok := weekdays[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekend day %q", name)
+		}
+		calendar.Weekend[day] = true
+	}
+
+	if holidaysFile == "" {
+		return calendar, nil
+	}
+
+	file, err := os.Open(holidaysFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open holiday file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		date, name, _ := strings.Cut(line, " ")
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("%s line %d: %q is not a date (YYYY-MM-DD)", holidaysFile, lineNumber, date)
+		}
+		calendar.Holidays[date] = strings.TrimSpace(name)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read holiday file: %w", err)
+	}
+
+	return calendar, nil
+}
+
+// CompileBusinessDateValidation compiles a business date validation of a
+// department configuration into a validator.
+//
+// PARAMETERS:
+//   - field: The field (CSV column header) the rule applies to.
+//   - calendar: The department's business calendar.
+//   - maxDaysPast: The most days a date may be before the day of the
+//     conversion, or 0 for no limit.
+//   - maxDaysFuture: The most days a date may be after the day of the
+//     conversion. 0 allows no future dates.
+//   - message: The error message. Default: a message naming the reason.
+//   - severity: "error" or "warning". Default: "error".
+//
+// RETURNS:
+//   - The validator. Empty values are not checked (see the Required
+//     column).
+//   - An error if the field or calendar is missing, a limit is negative,
+//     or the severity is unknown.
+func CompileBusinessDateValidation(field string, calendar *BusinessCalendar, maxDaysPast, maxDaysFuture int, message, severity string) (CustomValidation, error) {
+	custom := CustomValidation{Field: field, Rule: "business_date", Code: CodeBusinessDate}
+	if field == "" {
+		return custom, fmt.Errorf("field is required")
+	}
+	if calendar == nil {
+		return custom, fmt.Errorf("a business calendar is required for field %s", field)
+	}
+	if maxDaysPast < 0 || maxDaysFuture < 0 {
+		return custom, fmt.Errorf("max_days_past and max_days_future cannot be negative for field %s", field)
+	}
+
+	var err error
+	if custom.Severity, err = customSeverity(field, severity); err != nil {
+		return custom, err
+	}
+
+	custom.Validate = func(value string, context ValidationContext) string {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return ""
+		}
+		dataType := ""
+		if context.FieldMapping != nil {
+			dataType = context.FieldMapping.DataType
+		}
+		date, ok := parseDate(value, dataType)
+		if !ok {
+			return ""
+		}
+
+		reason := calendar.check(date, time.Now(), maxDaysPast, maxDaysFuture)
+		if reason == "" || message == "" {
+			return reason
+		}
+		return message
+	}
+	return custom, nil
+}
+
+// check returns why a date is not a business day within the allowed window
+// around today, or "" if it is.
+func (c *BusinessCalendar) check(date, today time.Time, maxDaysPast, maxDaysFuture int) string {
+	day := date.Format("2006-01-02")
+	if c.Weekend[date.Weekday()] {
+		return fmt.Sprintf("Date %s is a %s, not a business day", day, date.Weekday())
+	}
+	if name, ok := c.Holidays[day]; ok {
+		if name == "" {
+			name = "a holiday"
+		}
+		return fmt.Sprintf("Date %s is %s, not a business day", day, name)
+	}
+
+	// Compare calendar days, whatever the time of day.
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(date.Sub(today).Hours() / 24)
+	if maxDaysPast > 0 && days < -maxDaysPast {
+		return fmt.Sprintf("Date %s is more than %d days in the past", day, maxDaysPast)
+	}
+	if days > maxDaysFuture {
+		if maxDaysFuture == 0 {
+			return fmt.Sprintf("Date %s is in the future", day)
+		}
+		return fmt.Sprintf("Date %s is more than %d days in the future", day, maxDaysFuture)
+	}
+	return ""
+}
+
+// parseDate parses a date with the format of a date data type, e.g.
+// "date(01/02/2006)", or with the common date formats (see validateDate).
+func parseDate(value, dataType string) (time.Time, bool) {
+	formats := []string{extractParenthesesContent(dataType)}
+	if formats[0] == "" {
+		formats = commonDateFormats
+	}
+	for _, format := range formats {
+		if date, err := time.Parse(format, value); err == nil {
+			return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC), true
+		}
+	}
+	return time.Time{}, false
+}
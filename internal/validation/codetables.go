@@ -0,0 +1,207 @@
+// =============================================================================
+// CSV to XML Converter - ISO Code Tables
+// =============================================================================
+//
+// Free text such as "US Dollar" in a currency column passes a string or
+// alpha check, but not the target system. Two data types check values
+// against the ISO tables instead:
+//
+//   - "currency_code"         : An ISO 4217 currency code (e.g., "USD")
+//   - "country_code"          : An ISO 3166-1 alpha-2 country code ("US")
+//   - "country_code(alpha3)"  : An ISO 3166-1 alpha-3 country code ("USA")
+//
+// The tables are embedded (see codetables/), so no file has to be deployed.
+// When the ISO tables change before the converter is updated, the main
+// configuration can name files that replace them (code_tables), in the same
+// CSV format as the embedded ones:
+//
+//   code,name                  alpha2,alpha3,name
+//   USD,US Dollar              US,USA,United States of America
+//
+// Codes are upper case; "usd" fails with a hint to the upper case code.
+//
+// =============================================================================
+
+package validation
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed codetables/*.csv
+var embeddedCodeTables embed.FS
+
+// codeTables are the tables in use: the embedded ones unless
+// LoadCodeTables replaced them.
+var codeTables struct {
+	sync.RWMutex
+	currencies map[string]bool
+	countries  map[string]bool // alpha-2
+	countries3 map[string]bool // alpha-3
+}
+
+// init loads the embedded tables. They are part of the binary, so a
+// malformed embedded table stops the program at startup (and fails every
+// test of the package) instead of a validation.
+func init() {
+	if err := LoadCodeTables("", ""); err != nil {
+		panic(fmt.Sprintf("embedded code tables: %v", err))
+	}
+}
+
+// LoadCodeTables loads the ISO code tables, replacing the embedded tables
+// with override files.
+//
+// PARAMETERS:
+//   - currenciesFile: A CSV file of currency codes (code,name), or "" for
+//     the embedded table.
+//   - countriesFile: A CSV file of country codes (alpha2,alpha3,name), or
+//     "" for the embedded table.
+//
+// RETURNS:
+//   - An error if a file cannot be read or has a malformed code. The
+//     tables in use are then unchanged.
+func LoadCodeTables(currenciesFile, countriesFile string) error {
+	currencies, err := readCodeTable(currenciesFile, "codetables/currencies.csv", 1)
+	if err != nil {
+		return err
+	}
+	countries, err := readCodeTable(countriesFile, "codetables/countries.csv", 2)
+	if err != nil {
+		return err
+	}
+
+	codeTables.Lock()
+	defer codeTables.Unlock()
+	codeTables.currencies = currencies[0]
+	codeTables.countries = countries[0]
+	codeTables.countries3 = countries[1]
+	return nil
+}
+
+// readCodeTable reads the code columns of a code table.
+//
+// PARAMETERS:
+//   - path: The override file, or "" for the embedded table.
+//   - embedded: The name of the embedded table.
+//   - columns: The number of code columns, before the name.
+//
+// RETURNS:
+//   - The codes of each code column.
+//   - An error if the table cannot be read or a code is not upper case
+//     letters of the length of its column (3, or 2 then 3).
+func readCodeTable(path, embedded string, columns int) ([]map[string]bool, error) {
+	var reader io.Reader
+	name := path
+	if path == "" {
+		file, err := embeddedCodeTables.Open(embedded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open embedded code table: %w", err)
+		}
+		defer file.Close()
+		reader, name = file, embedded
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open code table: %w", err)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read code table %s: %w", name, err)
+	}
+
+	codes := make([]map[string]bool, columns)
+	for i := range codes {
+		codes[i] = make(map[string]bool)
+	}
+	for line, record := range records {
+		// The first line is the header.
+		if line == 0 {
+			continue
+		}
+		if len(record) < columns {
+			return nil, fmt.Errorf("%s line %d: %d code column(s) expected", name, line+1, columns)
+		}
+		for i := 0; i < columns; i++ {
+			length := 3
+			if columns == 2 && i == 0 {
+				length = 2
+			}
+			code := strings.TrimSpace(record[i])
+			if len(code) != length || strings.ToUpper(code) != code || !isAlphaCode(code) {
+				return nil, fmt.Errorf("%s line %d: %q is not a %d-letter upper case code", name, line+1, code, length)
+			}
+			codes[i][code] = true
+		}
+	}
+	return codes, nil
+}
+
+// isAlphaCode reports whether a code has only the letters A to Z.
+func isAlphaCode(code string) bool {
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// codeTable returns the table of a code data type (see init for the
+// embedded tables).
+func codeTable(dataType string) (map[string]bool, string) {
+	codeTables.RLock()
+	defer codeTables.RUnlock()
+	switch {
+	case dataType == "currency_code":
+		return codeTables.currencies, "an ISO 4217 currency code"
+	case extractParenthesesContent(dataType) == "alpha3":
+		return codeTables.countries3, "an ISO 3166 alpha-3 country code"
+	default:
+		return codeTables.countries, "an ISO 3166 alpha-2 country code"
+	}
+}
+
+// validateCode validates that a value is a code of the table of a code
+// data type ("currency_code", "country_code", or "country_code(alpha3)").
+func validateCode(value, dataType string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	codes, description := codeTable(dataType)
+	if codes[value] {
+		return ""
+	}
+	if upper := strings.ToUpper(value); codes[upper] {
+		return fmt.Sprintf("Value '%s' is not %s (did you mean '%s'?)", value, description, upper)
+	}
+	return fmt.Sprintf("Value '%s' is not %s", value, description)
+}
+
+// CodeTableValues returns the codes of a code data type in order, e.g. for
+// sample data.
+//
+// PARAMETERS:
+//   - dataType: "currency_code", "country_code", or "country_code(alpha3)".
+func CodeTableValues(dataType string) []string {
+	codes, _ := codeTable(dataType)
+	values := make([]string, 0, len(codes))
+	for code := range codes {
+		values = append(values, code)
+	}
+	sort.Strings(values)
+	return values
+}
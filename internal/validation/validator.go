@@ -36,6 +36,7 @@ package validation
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -53,14 +54,75 @@ type Transaction struct {
 	ID        int
 	GroupKey  string
 	LineItems []LineItem
+
+	// Fields and Row are the transaction-level values and the CSV row of a
+	// transaction without line items, or nil and 0.
+	Fields map[string]string
+	Row    int
 }
 
 // LineItem represents a single line item within a transaction.
 type LineItem struct {
-	ID     int
-	Fields map[string]string
+	ID        int
+	Fields    map[string]string
+	RowNumber int
 }
 
+// =============================================================================
+// VALIDATION RULE CODES
+// =============================================================================
+// Every validation rule has a stable code. Codes appear in error messages and
+// reports, and department configurations refer to them when suppressing a rule
+// for a specific field. Never renumber an existing code; add a new one instead.
+
+const (
+	// CodeRequired is raised when a required field is empty.
+	CodeRequired = "VAL-REQ-001"
+
+	// CodeConditionalRequired is raised when a conditional field is required
+	// by its rule but is empty.
+	CodeConditionalRequired = "VAL-REQ-002"
+
+	// CodeMaxLength is raised when a value exceeds the template's max length.
+	CodeMaxLength = "VAL-LEN-001"
+
+	// CodeDataType is raised when a value does not match the template's data type.
+	CodeDataType = "VAL-TYP-001"
+
+	// CodeCustom is raised by custom validators registered in ValidationOptions.
+	CodeCustom = "VAL-CUS-001"
+
+	// CodeDuplicate is raised for a row that duplicates an earlier (or, when
+	// keeping the last, a later) row of the file.
+	CodeDuplicate = "VAL-DUP-001"
+
+	// CodeRunDuplicate is raised for a transaction whose key another file
+	// of the same run already has (see unique_across_run).
+	CodeRunDuplicate = "VAL-DUP-002"
+
+	// CodeHistoryDuplicate is raised for a transaction whose key was
+	// uploaded in the department's duplicate_history_days.
+	CodeHistoryDuplicate = "VAL-DUP-003"
+
+	// CodeFixed is raised when a value differs from the template's fixed value.
+	CodeFixed = "VAL-FIX-001"
+
+	// CodePattern is raised when a value does not match the template's pattern.
+	CodePattern = "VAL-PAT-001"
+
+	// CodeMinLineItems is raised for a transaction with fewer line items
+	// than the department's min_line_items.
+	CodeMinLineItems = "VAL-CNT-001"
+
+	// CodeBusinessDate is raised when a date is not a business day of the
+	// department's calendar or is outside its allowed window.
+	CodeBusinessDate = "VAL-BUS-001"
+
+	// CodeAmountSign is raised when an amount does not agree with its
+	// debit/credit indicator column (see amountsign.go).
+	CodeAmountSign = "VAL-SGN-001"
+)
+
 // =============================================================================
 // VALIDATION ERROR TYPES
 // =============================================================================
@@ -81,6 +143,9 @@ type ValidationError struct {
 	// Rule is the validation rule that was violated.
 	Rule string
 
+	// Code is the stable identifier of the violated rule (e.g., "VAL-REQ-001").
+	Code string
+
 	// Message is a human-readable error message.
 	Message string
 
@@ -92,15 +157,34 @@ type ValidationError struct {
 
 	// RowNumber is the original CSV row number (for error reporting).
 	RowNumber int
+
+	// Justification is the documented reason this error was suppressed.
+	// This is empty unless the error matched a Suppression.
+	Justification string
 }
 
 // Error implements the error interface.
 func (e *ValidationError) Error() string {
-	return fmt.Sprintf("[%s] Transaction %d, LineItem %d, Field '%s': %s (value: '%s')",
+	location := ""
+	if e.RowNumber > 0 {
+		location = fmt.Sprintf("Row %d, ", e.RowNumber)
+	}
+	// Row-level errors (e.g., duplicates) are raised before grouping.
+	if e.TransactionID > 0 {
+		location += fmt.Sprintf("Transaction %d, ", e.TransactionID)
+		// Transaction-level errors (e.g., min_line_items) have no line item.
+		if e.LineItemID > 0 {
+			location += fmt.Sprintf("LineItem %d, ", e.LineItemID)
+		}
+	}
+	if e.Field != "" {
+		location += fmt.Sprintf("Field '%s': ", e.Field)
+	}
+
+	return fmt.Sprintf("[%s] %s %s%s (value: '%s')",
 		strings.ToUpper(e.Severity),
-		e.TransactionID,
-		e.LineItemID,
-		e.Field,
+		e.Code,
+		location,
 		e.Message,
 		e.Value,
 	)
@@ -129,6 +213,290 @@ type ValidationResult struct {
 
 	// TransactionsValidated is the total number of transactions validated.
 	TransactionsValidated int
+
+	// Suppressed contains errors that matched a suppression.
+	// They do not count towards ErrorCount or WarningCount and do not affect
+	// IsValid, but are kept so reports can list them with their justification.
+	Suppressed []*ValidationError
+
+	// Duplicates contains the rows dropped by de-duplication. They do not
+	// affect IsValid. Duplicates that fail the file are listed in Errors.
+	Duplicates []*ValidationError
+
+	// Coalesced counts the errors left out of Errors by MaxSameRuleErrors,
+	// by rule and field, in the order they were first left out. They count
+	// towards ErrorCount and WarningCount.
+	Coalesced []*CoalescedErrors
+
+	// Truncated is true if validation stopped at MaxErrors. The counts are
+	// then those found before it stopped.
+	Truncated bool
+
+	// limits are the caps of the options the result was created with.
+	maxErrors, maxSameRuleErrors int
+
+	// sameRule counts the errors of each rule and field, and coalesced
+	// indexes their entry in Coalesced.
+	sameRule  map[string]int
+	coalesced map[string]*CoalescedErrors
+}
+
+// CoalescedErrors counts the errors of a rule and field left out of a
+// result, so a report can say "...and 54,311 more like this".
+type CoalescedErrors struct {
+	Code     string
+	Field    string
+	Severity string
+	Count    int
+}
+
+// NewValidationResult creates an empty, valid result with the caps of the
+// options (MaxErrors and MaxSameRuleErrors).
+func NewValidationResult(options ValidationOptions) *ValidationResult {
+	return &ValidationResult{
+		IsValid:           true,
+		Errors:            make([]*ValidationError, 0),
+		maxErrors:         options.MaxErrors,
+		maxSameRuleErrors: options.MaxSameRuleErrors,
+	}
+}
+
+// Record adds an error that is not suppressed to the result: it is counted,
+// and listed in Errors unless MaxSameRuleErrors errors of its rule and
+// field already are.
+//
+// RETURNS:
+//   - false once MaxErrors errors have been found: the result is
+//     truncated, and validation should stop.
+func (r *ValidationResult) Record(err *ValidationError) bool {
+	if r.Truncated {
+		return false
+	}
+
+	if err.Severity == "error" {
+		r.ErrorCount++
+		r.IsValid = false
+	} else {
+		r.WarningCount++
+	}
+
+	key := err.Code + "\x00" + err.Field
+	if r.sameRule == nil {
+		r.sameRule = make(map[string]int)
+	}
+	r.sameRule[key]++
+	if r.maxSameRuleErrors > 0 && r.sameRule[key] > r.maxSameRuleErrors {
+		r.coalesce(key, err.Code, err.Field, err.Severity, 1)
+	} else {
+		r.Errors = append(r.Errors, err)
+	}
+
+	return r.checkTruncated()
+}
+
+// coalesce counts errors of a rule and field that are left out of Errors.
+func (r *ValidationResult) coalesce(key, code, field, severity string, count int) {
+	if r.coalesced == nil {
+		r.coalesced = make(map[string]*CoalescedErrors)
+	}
+	coalesced := r.coalesced[key]
+	if coalesced == nil {
+		coalesced = &CoalescedErrors{Code: code, Field: field, Severity: severity}
+		r.coalesced[key] = coalesced
+		r.Coalesced = append(r.Coalesced, coalesced)
+	}
+	coalesced.Count += count
+}
+
+// checkTruncated marks the result truncated once MaxErrors errors have
+// been found, and returns false if it is.
+func (r *ValidationResult) checkTruncated() bool {
+	if r.maxErrors > 0 && r.ErrorCount+r.WarningCount >= r.maxErrors {
+		r.Truncated = true
+	}
+	return !r.Truncated
+}
+
+// Merge adds the errors of a part of the transactions, validated on its
+// own (e.g., with another template), to the result.
+//
+// RETURNS:
+//   - false once the result is truncated (see Record).
+func (r *ValidationResult) Merge(part *ValidationResult) bool {
+	r.Suppressed = append(r.Suppressed, part.Suppressed...)
+	r.FieldsValidated += part.FieldsValidated
+	r.TransactionsValidated += part.TransactionsValidated
+	if !part.IsValid {
+		// Warnings treated as errors leave ErrorCount unchanged.
+		r.IsValid = false
+	}
+
+	for _, err := range part.Errors {
+		if !r.Record(err) {
+			return false
+		}
+	}
+	// The part listed MaxSameRuleErrors errors of each rule and field it
+	// coalesced, so the result has as many and coalesces the rest too.
+	for _, coalesced := range part.Coalesced {
+		if coalesced.Severity == "error" {
+			r.ErrorCount += coalesced.Count
+		} else {
+			r.WarningCount += coalesced.Count
+		}
+		key := coalesced.Code + "\x00" + coalesced.Field
+		if r.sameRule == nil {
+			r.sameRule = make(map[string]int)
+		}
+		r.sameRule[key] += coalesced.Count
+		r.coalesce(key, coalesced.Code, coalesced.Field, coalesced.Severity, coalesced.Count)
+	}
+	if part.Truncated {
+		r.Truncated = true
+	}
+	return r.checkTruncated()
+}
+
+// Omitted returns the number of errors left out of Errors by
+// MaxSameRuleErrors.
+func (r *ValidationResult) Omitted() int {
+	omitted := 0
+	for _, coalesced := range r.Coalesced {
+		omitted += coalesced.Count
+	}
+	return omitted
+}
+
+// =============================================================================
+// VALIDATION BREAKDOWN
+// =============================================================================
+
+// Count is the number of validation errors for a key: a rule code, a field,
+// or a range of transactions.
+type Count struct {
+	Key   string
+	Count int
+}
+
+// Breakdown groups the validation errors of a result, so a report can show
+// at a glance where they come from (e.g., that most errors are one date
+// column). Warnings are counted with the errors; suppressed errors are not.
+type Breakdown struct {
+	// ByRule counts the errors by rule code, most frequent first.
+	ByRule []Count
+
+	// ByField counts the errors by field, most frequent first.
+	ByField []Count
+
+	// ByTransactionRange counts the errors by range of transaction IDs
+	// (e.g., "1-100"), in order. Ranges without errors are left out, and
+	// so are row-level errors such as duplicates and coalesced errors. The range size is a power
+	// of ten giving at most about ten ranges.
+	ByTransactionRange []Count
+}
+
+// Breakdown counts the result's errors by rule, field, and transaction range.
+func (r *ValidationResult) Breakdown() Breakdown {
+	var breakdown Breakdown
+	byRule := make(map[string]int)
+	byField := make(map[string]int)
+
+	maxID := r.TransactionsValidated
+	for _, err := range r.Errors {
+		byRule[err.Code]++
+		byField[err.Field]++
+		if err.TransactionID > maxID {
+			maxID = err.TransactionID
+		}
+	}
+	for _, coalesced := range r.Coalesced {
+		byRule[coalesced.Code] += coalesced.Count
+		byField[coalesced.Field] += coalesced.Count
+	}
+	breakdown.ByRule = sortCounts(byRule)
+	breakdown.ByField = sortCounts(byField)
+
+	size := 1
+	for size*10 < maxID {
+		size *= 10
+	}
+	byRange := make(map[int]int)
+	for _, err := range r.Errors {
+		if err.TransactionID > 0 {
+			byRange[(err.TransactionID-1)/size]++
+		}
+	}
+	ranges := make([]int, 0, len(byRange))
+	for index := range byRange {
+		ranges = append(ranges, index)
+	}
+	sort.Ints(ranges)
+	for _, index := range ranges {
+		key := strconv.Itoa(index*size + 1)
+		if size > 1 {
+			key += "-" + strconv.Itoa((index+1)*size)
+		}
+		breakdown.ByTransactionRange = append(breakdown.ByTransactionRange, Count{Key: key, Count: byRange[index]})
+	}
+
+	return breakdown
+}
+
+// ErrorGroup is a set of errors with the same rule, field, and message,
+// reported once with a count instead of line by line.
+type ErrorGroup struct {
+	// First is the first error of the group, in result order.
+	First *ValidationError
+
+	// Count is the number of errors in the group.
+	Count int
+
+	// SampleRows are the row numbers of the first errors of the group, at
+	// most the number asked for.
+	SampleRows []int
+}
+
+// GroupErrors groups identical errors: those with the same rule code,
+// field, and message.
+//
+// PARAMETERS:
+//   - errors: The errors, e.g. a result's Errors.
+//   - samples: The maximum number of sample row numbers per group.
+//
+// RETURNS:
+//   - The groups, in the order of their first error.
+func GroupErrors(errors []*ValidationError, samples int) []*ErrorGroup {
+	var groups []*ErrorGroup
+	byKey := make(map[string]*ErrorGroup)
+	for _, err := range errors {
+		key := err.Code + "\x00" + err.Field + "\x00" + err.Message
+		group := byKey[key]
+		if group == nil {
+			group = &ErrorGroup{First: err}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.Count++
+		if err.RowNumber > 0 && len(group.SampleRows) < samples {
+			group.SampleRows = append(group.SampleRows, err.RowNumber)
+		}
+	}
+	return groups
+}
+
+// sortCounts returns the counts of a map, most frequent first (ties by key).
+func sortCounts(counts map[string]int) []Count {
+	sorted := make([]Count, 0, len(counts))
+	for key, count := range counts {
+		sorted = append(sorted, Count{Key: key, Count: count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
 }
 
 // =============================================================================
@@ -158,6 +526,48 @@ type ValidationOptions struct {
 	// CustomValidators is a map of custom validation functions.
 	// Key is the field name, value is the validation function.
 	CustomValidators map[string]CustomValidatorFunc
+
+	// CustomValidations are custom validators with their own severity,
+	// usually compiled from a department's custom_validations (see
+	// CompileCustomValidation). A field may have several.
+	CustomValidations []CustomValidation
+
+	// EmitConditions are the department's emit conditions by CSV header
+	// (see FieldEmitted).
+	// Default: none
+	EmitConditions map[string]string
+
+	// Suppressions lists rule codes to ignore for specific fields.
+	// Default: none
+	Suppressions []Suppression
+
+	// MaxErrors stops validation once this many errors (including
+	// warnings) have been found, and marks the result Truncated.
+	// Default: 0 (no cap)
+	MaxErrors int
+
+	// MaxSameRuleErrors lists at most this many errors of each rule and
+	// field; the others are only counted (see ValidationResult.Coalesced).
+	// Default: 0 (no cap)
+	MaxSameRuleErrors int
+
+	// MinLineItems is the minimum number of line items per transaction
+	// (VAL-CNT-001).
+	// Default: 0 (no minimum)
+	MinLineItems int
+}
+
+// Suppression silences a single validation rule for a single field.
+type Suppression struct {
+	// Code is the rule code to suppress (e.g., "VAL-LEN-001").
+	Code string
+
+	// Field is the old system header (CSV column name) the suppression applies to.
+	Field string
+
+	// Justification documents why the rule is suppressed.
+	// It is copied onto every suppressed error so it appears in reports.
+	Justification string
 }
 
 // CustomValidatorFunc is a function type for custom validators.
@@ -173,6 +583,24 @@ type ValidationContext struct {
 	AllFields     map[string]string
 }
 
+// CustomValidation is a custom validator of a single field.
+type CustomValidation struct {
+	// Field is the name of the field the validator applies to.
+	Field string
+
+	// Severity is the severity of the errors it raises: "error" or
+	// "warning".
+	Severity string
+
+	// Rule and Code name the rule in the errors it raises.
+	// Default: "custom" and CodeCustom
+	Rule string
+	Code string
+
+	// Validate returns the error message, or "" if the value is valid.
+	Validate CustomValidatorFunc
+}
+
 // DefaultValidationOptions returns the default validation options.
 func DefaultValidationOptions() ValidationOptions {
 	return ValidationOptions{
@@ -220,31 +648,33 @@ func Validate(transactions []Transaction, schema *xlsxparser.Schema) []*Validati
 
 // ValidateAll validates all transactions and returns a detailed result.
 func (v *Validator) ValidateAll(transactions []Transaction) *ValidationResult {
-	result := &ValidationResult{
-		IsValid:               true,
-		Errors:                make([]*ValidationError, 0),
-		TransactionsValidated: len(transactions),
-	}
+	result := NewValidationResult(v.options)
+	result.TransactionsValidated = len(transactions)
 
 	for i := range transactions {
 		transactionErrors := v.ValidateTransaction(&transactions[i])
 
 		for _, err := range transactionErrors {
-			result.Errors = append(result.Errors, err)
+			// Suppressed errors are reported separately and never fail validation.
+			if suppression := v.findSuppression(err); suppression != nil {
+				err.Justification = suppression.Justification
+				result.Suppressed = append(result.Suppressed, err)
+				continue
+			}
 
-			if err.Severity == "error" {
-				result.ErrorCount++
+			if err.Severity != "error" && v.options.TreatWarningsAsErrors {
 				result.IsValid = false
+			}
 
-				if v.options.StopOnFirstError {
-					return result
-				}
-			} else {
-				result.WarningCount++
+			// Stop early once the cap is reached, so a badly exported file
+			// does not produce millions of errors.
+			if !result.Record(err) {
+				result.TransactionsValidated = i + 1
+				return result
+			}
 
-				if v.options.TreatWarningsAsErrors {
-					result.IsValid = false
-				}
+			if err.Severity == "error" && v.options.StopOnFirstError {
+				return result
 			}
 		}
 	}
@@ -252,6 +682,18 @@ func (v *Validator) ValidateAll(transactions []Transaction) *ValidationResult {
 	return result
 }
 
+// findSuppression returns the suppression matching the error's code and field,
+// or nil if the error is not suppressed.
+func (v *Validator) findSuppression(err *ValidationError) *Suppression {
+	for i := range v.options.Suppressions {
+		suppression := &v.options.Suppressions[i]
+		if strings.EqualFold(suppression.Code, err.Code) && suppression.Field == err.Field {
+			return suppression
+		}
+	}
+	return nil
+}
+
 // ValidateTransaction validates a single transaction.
 func (v *Validator) ValidateTransaction(transaction *Transaction) []*ValidationError {
 	var errors []*ValidationError
@@ -262,12 +704,30 @@ func (v *Validator) ValidateTransaction(transaction *Transaction) []*ValidationE
 		errors = append(errors, lineItemErrors...)
 	}
 
+	// A transaction without line items has its transaction-level values
+	// validated on their own.
+	if len(transaction.LineItems) == 0 && transaction.Fields != nil {
+		header := LineItem{Fields: make(map[string]string), RowNumber: transaction.Row}
+		for _, field := range v.schema.TransactionFields {
+			if value, ok := transaction.Fields[field]; ok {
+				header.Fields[field] = value
+			}
+		}
+		errors = append(errors, v.ValidateLineItem(transaction, &header)...)
+	}
+
 	// Perform transaction-level validations.
 	// CUSTOMIZATION: Add cross-line-item validations here.
-	//
-	// PSEUDOCODE:
-	// transactionErrors := v.validateTransactionLevel(transaction)
-	// errors = append(errors, transactionErrors...)
+	if min := v.options.MinLineItems; len(transaction.LineItems) < min {
+		errors = append(errors, &ValidationError{
+			Severity:      "error",
+			Rule:          "min_line_items",
+			Code:          CodeMinLineItems,
+			Value:         fmt.Sprintf("%d", len(transaction.LineItems)),
+			Message:       fmt.Sprintf("Transaction has %d line item(s), fewer than the minimum of %d", len(transaction.LineItems), min),
+			TransactionID: transaction.ID,
+		})
+	}
 
 	return errors
 }
@@ -289,6 +749,11 @@ func (v *Validator) ValidateLineItem(transaction *Transaction, lineItem *LineIte
 			continue
 		}
 
+		// A field whose element is not written has nothing to validate.
+		if !FieldEmitted(mapping, v.options.EmitConditions, lineItem.Fields) {
+			continue
+		}
+
 		// Validate the field.
 		fieldErrors := v.ValidateField(value, mapping, transaction, lineItem)
 		errors = append(errors, fieldErrors...)
@@ -309,9 +774,43 @@ func (v *Validator) ValidateLineItem(transaction *Transaction, lineItem *LineIte
 					Field:         fieldName,
 					Value:         value,
 					Rule:          "custom",
+					Code:          CodeCustom,
 					Message:       errMsg,
 					TransactionID: transaction.ID,
 					LineItemID:    lineItem.ID,
+					RowNumber:     lineItem.RowNumber,
+				})
+			}
+		}
+
+		// Run the configured custom validations of the field.
+		for _, custom := range v.options.CustomValidations {
+			if custom.Field != fieldName {
+				continue
+			}
+			context := ValidationContext{
+				FieldName:    fieldName,
+				FieldMapping: mapping,
+				Transaction:  transaction,
+				LineItem:     lineItem,
+				AllFields:    lineItem.Fields,
+			}
+
+			if errMsg := custom.Validate(value, context); errMsg != "" {
+				rule, code := custom.Rule, custom.Code
+				if rule == "" {
+					rule, code = "custom", CodeCustom
+				}
+				errors = append(errors, &ValidationError{
+					Severity:      custom.Severity,
+					Field:         fieldName,
+					Value:         value,
+					Rule:          rule,
+					Code:          code,
+					Message:       errMsg,
+					TransactionID: transaction.ID,
+					LineItemID:    lineItem.ID,
+					RowNumber:     lineItem.RowNumber,
 				})
 			}
 		}
@@ -322,6 +821,18 @@ func (v *Validator) ValidateLineItem(transaction *Transaction, lineItem *LineIte
 
 // ValidateField validates a single field value against its schema definition.
 func (v *Validator) ValidateField(value string, mapping *xlsxparser.FieldMapping, transaction *Transaction, lineItem *LineItem) []*ValidationError {
+	errors := v.validateField(value, mapping, transaction, lineItem)
+
+	// The template's Severity column can make rules warnings.
+	for _, err := range errors {
+		err.Severity = mapping.RuleSeverity(err.Code)
+	}
+	return errors
+}
+
+// validateField runs the template's rules on a field value (see
+// ValidateField).
+func (v *Validator) validateField(value string, mapping *xlsxparser.FieldMapping, transaction *Transaction, lineItem *LineItem) []*ValidationError {
 	var errors []*ValidationError
 
 	// =========================================================================
@@ -329,22 +840,53 @@ func (v *Validator) ValidateField(value string, mapping *xlsxparser.FieldMapping
 	// =========================================================================
 	// Check if a required field is empty.
 
-	if mapping.RequiredType == "required" && value == "" {
+	// =========================================================================
+	// FIXED VALUE VALIDATION
+	// =========================================================================
+	// A field with a fixed value is written with it; a different input value
+	// is a mistake.
+
+	if mapping.FixedValue != "" && value != "" && value != mapping.FixedValue {
+		errors = append(errors, &ValidationError{
+			Severity:      "error",
+			Field:         mapping.OldHeader,
+			Value:         value,
+			Rule:          "fixed",
+			Code:          CodeFixed,
+			Message:       fmt.Sprintf("Value must be '%s' (fixed by the template)", mapping.FixedValue),
+			TransactionID: transaction.ID,
+			LineItemID:    lineItem.ID,
+			RowNumber:     lineItem.RowNumber,
+		})
+		return errors
+	}
+
+	// The written value is checked: the fixed or default value if there is
+	// one. A repeatable field is checked value by value; one without values
+	// (e.g., ";;") is empty, which a nillable field may be.
+	values := mapping.Values(mapping.OutputValue(value))
+	if len(values) == 0 && mapping.Nillable {
+		return errors
+	}
+
+	if mapping.RequiredType == "required" && len(values) == 0 {
 		errors = append(errors, &ValidationError{
 			Severity:      "error",
 			Field:         mapping.OldHeader,
 			Value:         value,
 			Rule:          "required",
+			Code:          CodeRequired,
 			Message:       fmt.Sprintf("Required field '%s' is empty", mapping.XMLTag),
 			TransactionID: transaction.ID,
 			LineItemID:    lineItem.ID,
+			RowNumber:     lineItem.RowNumber,
 		})
 		// Don't continue validation if required field is empty.
 		return errors
 	}
 
 	// Skip further validation if value is empty (for optional fields).
-	if value == "" {
+	if len(values) == 0 {
 		return errors
 	}
 
@@ -361,13 +903,27 @@ func (v *Validator) ValidateField(value string, mapping *xlsxparser.FieldMapping
 				Field:         mapping.OldHeader,
 				Value:         value,
 				Rule:          "conditional_required",
+				Code:          CodeConditionalRequired,
 				Message:       fmt.Sprintf("Field '%s' is required when: %s", mapping.XMLTag, mapping.ConditionalRule),
 				TransactionID: transaction.ID,
 				LineItemID:    lineItem.ID,
+				RowNumber:     lineItem.RowNumber,
 			})
 		}
 	}
 
+	for _, value := range values {
+		errors = append(errors, v.validateValue(value, mapping, transaction, lineItem)...)
+	}
+
+	return errors
+}
+
+// validateValue checks a single value of a field against its maximum
+// length, data type, and pattern.
+func (v *Validator) validateValue(value string, mapping *xlsxparser.FieldMapping, transaction *Transaction, lineItem *LineItem) []*ValidationError {
+	var errors []*ValidationError
+
 	// =========================================================================
 	// MAX LENGTH VALIDATION
 	// =========================================================================
@@ -379,9 +935,11 @@ func (v *Validator) ValidateField(value string, mapping *xlsxparser.FieldMapping
 			Field:         mapping.OldHeader,
 			Value:         value,
 			Rule:          "max_length",
+			Code:          CodeMaxLength,
 			Message:       fmt.Sprintf("Value exceeds maximum length of %d characters (actual: %d)", mapping.MaxLength, len(value)),
 			TransactionID: transaction.ID,
 			LineItemID:    lineItem.ID,
+			RowNumber:     lineItem.RowNumber,
 		})
 	}
 
@@ -397,9 +955,30 @@ func (v *Validator) ValidateField(value string, mapping *xlsxparser.FieldMapping
 			Field:         mapping.OldHeader,
 			Value:         value,
 			Rule:          "data_type",
+			Code:          CodeDataType,
 			Message:       typeError,
 			TransactionID: transaction.ID,
 			LineItemID:    lineItem.ID,
+			RowNumber:     lineItem.RowNumber,
+		})
+	}
+
+	// =========================================================================
+	// PATTERN VALIDATION
+	// =========================================================================
+	// Check the value against the template's regular expression, if any.
+
+	if !mapping.MatchesPattern(value) {
+		errors = append(errors, &ValidationError{
+			Severity:      "error",
+			Field:         mapping.OldHeader,
+			Value:         value,
+			Rule:          "pattern",
+			Code:          CodePattern,
+			Message:       fmt.Sprintf("Value does not match the pattern '%s'", mapping.Pattern),
+			TransactionID: transaction.ID,
+			LineItemID:    lineItem.ID,
+			RowNumber:     lineItem.RowNumber,
 		})
 	}
 
@@ -454,6 +1033,9 @@ func validateDataType(value, dataType string) string {
 	case dataType == "boolean":
 		return validateBoolean(value)
 
+	case dataType == "currency_code" || strings.HasPrefix(dataType, "country_code"):
+		return validateCode(value, dataType)
+
 	default:
 		// Unknown type, treat as string.
 		return ""
@@ -539,6 +1121,17 @@ func validateAlpha(value string) string {
 	return ""
 }
 
+// commonDateFormats are the formats of a date whose data type names none.
+var commonDateFormats = []string{
+	"2006-01-02",
+	"01/02/2006",
+	"02/01/2006",
+	"2006/01/02",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"20060102",
+}
+
 // validateDate validates that a value is a valid date.
 //
 // PARAMETERS:
@@ -558,17 +1151,7 @@ func validateDate(value, dataType string) string {
 	format := extractParenthesesContent(dataType)
 	if format == "" {
 		// Try common date formats.
-		formats := []string{
-			"2006-01-02",
-			"01/02/2006",
-			"02/01/2006",
-			"2006/01/02",
-			"Jan 2, 2006",
-			"January 2, 2006",
-			"20060102",
-		}
-
-		for _, f := range formats {
+		for _, f := range commonDateFormats {
 			if _, err := time.Parse(f, value); err == nil {
 				return ""
 			}
@@ -600,10 +1183,148 @@ func validateBoolean(value string) string {
 	return fmt.Sprintf("Value '%s' is not a valid boolean", value)
 }
 
+// =============================================================================
+// CUSTOM VALIDATIONS
+// =============================================================================
+
+// CompileCustomValidation compiles a custom validation rule of a department
+// configuration into a validator.
+//
+// PARAMETERS:
+//   - field: The field (CSV column header) the rule applies to.
+//   - pattern: A regular expression the whole value must match. Empty
+//     values are not checked (see the Required column).
+//   - expression: A condition in the conditional rule syntax (see
+//     evaluateCondition) the row must meet, e.g. "AMOUNT > 0".
+//   - message: The error message. Default: a message naming the pattern or
+//     expression.
+//   - severity: "error" or "warning". Default: "error".
+//
+// RETURNS:
+//   - The validator. A rule with both a pattern and an expression fails
+//     when either check fails.
+//   - An error if the field is empty, neither a pattern nor an expression
+//     is given, the pattern does not compile, the expression is not in a
+//     supported form, or the severity is unknown.
+func CompileCustomValidation(field, pattern, expression, message, severity string) (CustomValidation, error) {
+	custom := CustomValidation{Field: field, Severity: severity}
+	if field == "" {
+		return custom, fmt.Errorf("field is required")
+	}
+	if pattern == "" && expression == "" {
+		return custom, fmt.Errorf("a pattern or an expression is required for field %s", field)
+	}
+
+	var err error
+	if custom.Severity, err = customSeverity(field, severity); err != nil {
+		return custom, err
+	}
+
+	var re *regexp.Regexp
+	if pattern != "" {
+		re, err = regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return custom, fmt.Errorf("invalid pattern for field %s: %w", field, err)
+		}
+	}
+	if expression != "" && !IsSupportedCondition(expression) {
+		return custom, fmt.Errorf("unsupported expression %q for field %s", expression, field)
+	}
+
+	custom.Validate = func(value string, context ValidationContext) string {
+		if re != nil && value != "" && !re.MatchString(value) {
+			if message != "" {
+				return message
+			}
+			return fmt.Sprintf("Value does not match the pattern '%s'", pattern)
+		}
+		if expression != "" && !evaluateCondition(expression, context.AllFields) {
+			if message != "" {
+				return message
+			}
+			return fmt.Sprintf("Row does not meet: %s", expression)
+		}
+		return ""
+	}
+	return custom, nil
+}
+
+// customSeverity returns the severity of a custom validation: "error"
+// unless given.
+func customSeverity(field, severity string) (string, error) {
+	switch severity {
+	case "":
+		return "error", nil
+	case "error", "warning":
+		return severity, nil
+	}
+	return "", fmt.Errorf("unknown severity %q for field %s (use error or warning)", severity, field)
+}
+
+// supportedConditions are the forms evaluateCondition understands. Keep
+// them in step with its patterns. They are anchored, so that a rule with
+// anything around a supported form (e.g., a second condition joined with
+// "and") is not accepted and then evaluated on its first part only.
+var supportedConditions = []*regexp.Regexp{
+	regexp.MustCompile(`^(\w+)\s*==\s*'([^']*)'$`),
+	regexp.MustCompile(`^(\w+)\s*!=\s*'([^']*)'$`),
+	regexp.MustCompile(`^(\w+)\s*>\s*(\d+(?:\.\d+)?)$`),
+	regexp.MustCompile(`^(\w+)\s*<\s*(\d+(?:\.\d+)?)$`),
+	regexp.MustCompile(`^(\w+)\s+starts_with\s+'([^']*)'$`),
+	regexp.MustCompile(`^(\w+)\s+is_empty$`),
+	regexp.MustCompile(`^(\w+)\s+is_not_empty$`),
+}
+
+// IsSupportedCondition reports whether evaluateCondition understands a
+// rule. It evaluates any other rule to false, which for a custom
+// validation would fail every row, for an emit condition would drop the
+// element from every row, and for a conditional tag would never apply.
+func IsSupportedCondition(rule string) bool {
+	rule = strings.TrimSpace(strings.TrimPrefix(rule, "if "))
+	for _, pattern := range supportedConditions {
+		if pattern.MatchString(rule) {
+			return true
+		}
+	}
+	return false
+}
+
 // =============================================================================
 // CONDITIONAL RULE EVALUATION
 // =============================================================================
 
+// FieldEmitted reports whether a field's element is written for a row: the
+// field has no emit condition, or its condition holds for the row. A field
+// that is not written is not validated either.
+//
+// PARAMETERS:
+//   - mapping: The field.
+//   - emitConditions: The department's emit conditions by CSV header,
+//     which take precedence over the template's Emit If column.
+//   - fields: The values of the row.
+func FieldEmitted(mapping *xlsxparser.FieldMapping, emitConditions map[string]string, fields map[string]string) bool {
+	condition, ok := emitConditions[mapping.OldHeader]
+	if !ok {
+		condition = mapping.EmitCondition
+	}
+	return condition == "" || evaluateCondition(condition, fields)
+}
+
+// FieldTag returns the element name of a field for a row: the first of its
+// conditional tags whose condition holds for the row, or its XML tag.
+//
+// PARAMETERS:
+//   - mapping: The field.
+//   - fields: The values of the row.
+func FieldTag(mapping *xlsxparser.FieldMapping, fields map[string]string) string {
+	for _, tag := range mapping.ConditionalTags {
+		if evaluateCondition(tag.Condition, fields) {
+			return tag.XMLTag
+		}
+	}
+	return mapping.XMLTag
+}
+
 // evaluateCondition evaluates a conditional rule against field values.
 //
 // PARAMETERS:
@@ -752,6 +1473,29 @@ func FormatErrors(errors []*ValidationError) string {
 	return builder.String()
 }
 
+// FormatSuppressed formats suppressed validation errors with their justification.
+//
+// PARAMETERS:
+//   - suppressed: The suppressed validation errors (ValidationResult.Suppressed).
+//
+// RETURNS:
+//   - A formatted string listing each suppressed error, or an empty string if none.
+func FormatSuppressed(suppressed []*ValidationError) string {
+	if len(suppressed) == 0 {
+		return ""
+	}
+
+	var builder strings.Builder
+
+	builder.WriteString(fmt.Sprintf("%d validation error(s) suppressed by department configuration:\n\n", len(suppressed)))
+
+	for i, err := range suppressed {
+		builder.WriteString(fmt.Sprintf("%d. %s\n   Justification: %s\n", i+1, err.Error(), err.Justification))
+	}
+
+	return builder.String()
+}
+
 // WriteErrorLog writes validation errors to a log file.
 //
 // PARAMETERS:
@@ -0,0 +1,32 @@
+package validation
+
+import "testing"
+
+func TestIsSupportedCondition(t *testing.T) {
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{"STATUS == 'A'", true},
+		{"if STATUS != 'A'", true},
+		{"  AMOUNT > 5  ", true},
+		{"AMOUNT < 10.5", true},
+		{"POLICY_NO starts_with 'P'", true},
+		{"if PAYEE_NAME is_empty", true},
+		{"PAYEE_NAME is_not_empty", true},
+
+		// Only whole rules are supported: evaluateCondition would check the
+		// first part and ignore the rest.
+		{"AMOUNT > 5 and garbage", false},
+		{"x == 'a' || y", false},
+		{"garbage STATUS == 'A'", false},
+		{"PAYEE_NAME is_empty_or_zero", false},
+		{"AMOUNT >= 5", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsSupportedCondition(tt.rule); got != tt.want {
+			t.Errorf("IsSupportedCondition(%q) = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
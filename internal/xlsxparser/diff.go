@@ -0,0 +1,206 @@
+// =============================================================================
+// CSV to XML Converter - Template Comparison
+// =============================================================================
+//
+// Compares two versions of a template, so a new template can be reviewed
+// before it goes live. A change is breaking if a CSV file that passes the
+// old template can fail the new one:
+//
+//   - a required field was added without a default value
+//   - a maximum length was tightened
+//   - a field became required (or conditional, from optional)
+//   - a data type changed
+//
+// Other changes (removed fields, renamed tags, moved or reordered fields,
+// loosened rules) change the XML but not whether files pass, and are
+// reported without the breaking flag.
+//
+// =============================================================================
+
+package xlsxparser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Change is one difference between two templates.
+type Change struct {
+	// Field is the Old Header (CSV column) of the field.
+	Field string `json:"field"`
+
+	// Kind is "added", "removed", or "changed".
+	Kind string `json:"kind"`
+
+	// Description describes the change, e.g. "max length 20 -> 10".
+	Description string `json:"description"`
+
+	// Breaking is true if files that pass the old template can fail the
+	// new one.
+	Breaking bool `json:"breaking"`
+}
+
+// Diff compares two templates.
+//
+// PARAMETERS:
+//   - before: The current template.
+//   - after: The new template.
+//
+// RETURNS:
+//   - The changes, ordered by field; added and removed fields first.
+func Diff(before, after *Schema) []Change {
+	var changes []Change
+
+	for _, field := range sortedFields(after) {
+		if _, ok := before.FieldMappings[field]; ok {
+			continue
+		}
+		mapping := after.FieldMappings[field]
+		breaking := mapping.RequiredType == "required" && mapping.OutputValue("") == "" && !mapping.Nillable
+		changes = append(changes, Change{
+			Field:       field,
+			Kind:        "added",
+			Description: fmt.Sprintf("added as <%s> (%s, %s)", mapping.XMLTag, mapping.DataType, mapping.RequiredType),
+			Breaking:    breaking,
+		})
+	}
+
+	for _, field := range sortedFields(before) {
+		if _, ok := after.FieldMappings[field]; !ok {
+			changes = append(changes, Change{
+				Field:       field,
+				Kind:        "removed",
+				Description: fmt.Sprintf("removed (was <%s>)", before.FieldMappings[field].XMLTag),
+			})
+		}
+	}
+
+	for _, field := range sortedFields(before) {
+		afterMapping, ok := after.FieldMappings[field]
+		if !ok {
+			continue
+		}
+		changes = append(changes, diffField(field, before.FieldMappings[field], afterMapping)...)
+	}
+
+	return changes
+}
+
+// diffField compares the rules of a field present in both templates.
+func diffField(field string, before, after *FieldMapping) []Change {
+	var changes []Change
+	add := func(breaking bool, format string, args ...interface{}) {
+		changes = append(changes, Change{
+			Field:       field,
+			Kind:        "changed",
+			Description: fmt.Sprintf(format, args...),
+			Breaking:    breaking,
+		})
+	}
+
+	if before.MaxLength != after.MaxLength {
+		tightened := after.MaxLength != 0 && (before.MaxLength == 0 || after.MaxLength < before.MaxLength)
+		add(tightened, "max length %s -> %s", describeLength(before.MaxLength), describeLength(after.MaxLength))
+	}
+
+	if before.RequiredType != after.RequiredType {
+		stricter := requiredness(after.RequiredType) > requiredness(before.RequiredType)
+		add(stricter, "%s -> %s", before.RequiredType, after.RequiredType)
+	} else if before.ConditionalRule != after.ConditionalRule && after.RequiredType == "conditional" {
+		add(true, "condition %q -> %q", before.ConditionalRule, after.ConditionalRule)
+	}
+
+	if !strings.EqualFold(before.DataType, after.DataType) {
+		add(true, "data type %s -> %s", before.DataType, after.DataType)
+	}
+
+	if before.XMLTag != after.XMLTag {
+		add(false, "XML tag <%s> -> <%s>", before.XMLTag, after.XMLTag)
+	}
+
+	if !strings.EqualFold(before.ParentTag, after.ParentTag) {
+		add(false, "parent %s -> %s", before.ParentTag, after.ParentTag)
+	}
+
+	if before.RepeatDelimiter != after.RepeatDelimiter {
+		// Values split at the old delimiter are validated as a whole, or
+		// split differently, after the change.
+		add(before.Repeatable(), "repeat %s -> %s", describeRepeat(before.RepeatDelimiter), describeRepeat(after.RepeatDelimiter))
+	}
+
+	if before.DefaultValue != after.DefaultValue {
+		add(false, "default %q -> %q", before.DefaultValue, after.DefaultValue)
+	}
+
+	if before.FixedValue != after.FixedValue {
+		// Input values other than the new fixed value fail validation.
+		add(after.FixedValue != "", "fixed %q -> %q", before.FixedValue, after.FixedValue)
+	}
+
+	if before.Pattern != after.Pattern {
+		add(after.Pattern != "", "pattern %q -> %q", before.Pattern, after.Pattern)
+	}
+
+	if before.EmitCondition != after.EmitCondition {
+		// Rows that do not meet the new condition lose the element.
+		add(after.EmitCondition != "", "emit if %q -> %q", before.EmitCondition, after.EmitCondition)
+	}
+
+	if before.ConditionalTagCell() != after.ConditionalTagCell() {
+		add(false, "conditional tag %q -> %q", before.ConditionalTagCell(), after.ConditionalTagCell())
+	}
+
+	if before.Nillable != after.Nillable {
+		// Empty required values that were written as nil fail validation.
+		add(before.Nillable, "nillable %t -> %t", before.Nillable, after.Nillable)
+	}
+
+	if before.SeverityCell() != after.SeverityCell() {
+		// Rules that were warnings may now fail files.
+		add(before.Severity == "warning", "severity %q -> %q", before.SeverityCell(), after.SeverityCell())
+	}
+
+	if before.Order != after.Order {
+		add(false, "order %d -> %d", before.Order, after.Order)
+	}
+
+	return changes
+}
+
+// requiredness ranks required types from least to most strict.
+func requiredness(requiredType string) int {
+	switch requiredType {
+	case "required":
+		return 2
+	case "conditional":
+		return 1
+	}
+	return 0
+}
+
+// describeLength formats a maximum length; 0 means no limit.
+func describeLength(length int) string {
+	if length == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d", length)
+}
+
+// describeRepeat describes a repeat delimiter, e.g. "off" or "\";\"".
+func describeRepeat(delimiter string) string {
+	if delimiter == "" {
+		return "off"
+	}
+	return fmt.Sprintf("%q", delimiter)
+}
+
+// sortedFields returns the schema's fields (Old Headers) in sort order.
+func sortedFields(schema *Schema) []string {
+	fields := make([]string, 0, len(schema.FieldMappings))
+	for field := range schema.FieldMappings {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,512 @@
+// =============================================================================
+// CSV to XML Converter - Template from XSD
+// =============================================================================
+//
+// Builds a starter template from the XML Schema of a target system, so a new
+// interface starts from the vendor's definition instead of a blank sheet.
+// The schema's elements are mapped onto the converter's three levels:
+//
+//   - The root element's simple children are cashbook fields.
+//   - Its first complex child is the transaction; that element's simple
+//     children are transaction fields.
+//   - The transaction's first complex child is the line item; its simple
+//     children are line item fields.
+//
+// Each field gets its XML tag, data type, max length, requiredness (from
+// minOccurs), order, and the XSD facets the template supports (default,
+// fixed, nillable, pattern, repeat). Enumerations become a pattern, and the
+// element's documentation becomes its notes. The Old Header of every field
+// is its XML tag, as a placeholder: analysts replace it with the CSV header.
+//
+// What the three levels cannot express (other complex elements, attributes,
+// choices) is reported as warnings, for the analyst to resolve by hand.
+//
+// =============================================================================
+
+package xlsxparser
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// xsdNode is an element of an XML Schema document.
+type xsdNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []xsdNode  `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+// attr returns the value of an attribute, or "" if it is not set.
+func (n *xsdNode) attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return strings.TrimSpace(attr.Value)
+		}
+	}
+	return ""
+}
+
+// child returns the first child with the local name, or nil.
+func (n *xsdNode) child(name string) *xsdNode {
+	for i := range n.Children {
+		if n.Children[i].XMLName.Local == name {
+			return &n.Children[i]
+		}
+	}
+	return nil
+}
+
+// localName strips the namespace prefix of a QName, e.g. "xs:string".
+func localName(qname string) string {
+	if i := strings.LastIndex(qname, ":"); i >= 0 {
+		return qname[i+1:]
+	}
+	return qname
+}
+
+// xsdImport holds the named components of the schema being imported.
+type xsdImport struct {
+	elements     map[string]*xsdNode
+	complexTypes map[string]*xsdNode
+	simpleTypes  map[string]*xsdNode
+	schema       *Schema
+	warnings     []string
+}
+
+// xsdFacets are the restrictions of a simple type.
+type xsdFacets struct {
+	base           string
+	maxLength      int
+	totalDigits    int
+	fractionDigits int
+	fractionSet    bool
+	patterns       []string
+	enumeration    []string
+}
+
+// FromXSD builds a starter template from an XML Schema.
+//
+// PARAMETERS:
+//   - r: The XSD document.
+//   - root: The name of the root element; empty for the first top-level
+//     element that no other element refers to.
+//
+// RETURNS:
+//   - The schema of the template, with the XML tag of each field as its
+//     Old Header.
+//   - Warnings about the parts of the XSD the template cannot express.
+//   - An error if the XSD cannot be read or has no usable root element.
+func FromXSD(r io.Reader, root string) (*Schema, []string, error) {
+	var document xsdNode
+	if err := xml.NewDecoder(r).Decode(&document); err != nil {
+		return nil, nil, fmt.Errorf("failed to read XSD: %w", err)
+	}
+	if document.XMLName.Local != "schema" {
+		return nil, nil, fmt.Errorf("not an XML Schema: root element is <%s>", document.XMLName.Local)
+	}
+
+	imp := &xsdImport{
+		elements:     make(map[string]*xsdNode),
+		complexTypes: make(map[string]*xsdNode),
+		simpleTypes:  make(map[string]*xsdNode),
+		schema: &Schema{
+			FieldMappings:         make(map[string]*FieldMapping),
+			TransactionFields:     []string{},
+			LineItemFields:        []string{},
+			CashbookFields:        []string{},
+			XMLRootElement:        "cashbook",
+			XMLTransactionElement: "transaction",
+			XMLLineItemElement:    "lineItem",
+		},
+	}
+
+	var topLevel []string
+	for i := range document.Children {
+		node := &document.Children[i]
+		name := node.attr("name")
+		switch node.XMLName.Local {
+		case "element":
+			imp.elements[name] = node
+			topLevel = append(topLevel, name)
+		case "complexType":
+			imp.complexTypes[name] = node
+		case "simpleType":
+			imp.simpleTypes[name] = node
+		case "import", "include", "redefine":
+			imp.warn("<xs:%s> of %s is not followed; its types are treated as strings",
+				node.XMLName.Local, node.attr("schemaLocation"))
+		}
+	}
+
+	if root == "" {
+		root = imp.findRoot(topLevel)
+	}
+	rootNode := imp.elements[root]
+	if rootNode == nil {
+		return nil, nil, fmt.Errorf("XSD has no top-level element %q", root)
+	}
+	if imp.complexType(rootNode) == nil {
+		return nil, nil, fmt.Errorf("root element %q has no child elements", root)
+	}
+
+	imp.importLevel(rootNode, "cashbook")
+	return imp.schema, imp.warnings, nil
+}
+
+// warn records a warning.
+func (imp *xsdImport) warn(format string, args ...interface{}) {
+	imp.warnings = append(imp.warnings, fmt.Sprintf(format, args...))
+}
+
+// findRoot returns the first top-level element with complex content that
+// no other element refers to.
+func (imp *xsdImport) findRoot(topLevel []string) string {
+	referenced := make(map[string]bool)
+	var collect func(node *xsdNode)
+	collect = func(node *xsdNode) {
+		if node.XMLName.Local == "element" && node.attr("ref") != "" {
+			referenced[localName(node.attr("ref"))] = true
+		}
+		for i := range node.Children {
+			collect(&node.Children[i])
+		}
+	}
+	for _, node := range imp.elements {
+		collect(node)
+	}
+	for _, node := range imp.complexTypes {
+		collect(node)
+	}
+
+	for _, name := range topLevel {
+		if !referenced[name] && imp.complexType(imp.elements[name]) != nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// complexType returns the complex type of an element, inline or named, or
+// nil if the element has simple content.
+func (imp *xsdImport) complexType(element *xsdNode) *xsdNode {
+	complexType := element.child("complexType")
+	if complexType == nil && element.attr("type") != "" {
+		complexType = imp.complexTypes[localName(element.attr("type"))]
+	}
+	if complexType == nil || complexType.child("simpleContent") != nil {
+		return nil
+	}
+	return complexType
+}
+
+// simpleContent returns the extension or restriction of an element whose
+// complex type has a value and attributes, or nil.
+func (imp *xsdImport) simpleContent(element *xsdNode) *xsdNode {
+	complexType := element.child("complexType")
+	if complexType == nil && element.attr("type") != "" {
+		complexType = imp.complexTypes[localName(element.attr("type"))]
+	}
+	if complexType == nil {
+		return nil
+	}
+	content := complexType.child("simpleContent")
+	if content == nil {
+		return nil
+	}
+	if derivation := content.child("extension"); derivation != nil {
+		return derivation
+	}
+	return content.child("restriction")
+}
+
+// resolve returns the element a reference points to, or the element itself.
+func (imp *xsdImport) resolve(element *xsdNode) *xsdNode {
+	ref := element.attr("ref")
+	if ref == "" {
+		return element
+	}
+	if target := imp.elements[localName(ref)]; target != nil {
+		return target
+	}
+	imp.warn("element reference %s is not defined in this XSD and was skipped", ref)
+	return nil
+}
+
+// particle is a child element of a complex type with its occurrence.
+type particle struct {
+	element   *xsdNode
+	minOccurs string
+	maxOccurs string
+}
+
+// particles returns the child elements of a complex type in order. The
+// elements of a choice are all optional.
+func (imp *xsdImport) particles(complexType *xsdNode, elementName string) []particle {
+	var result []particle
+	var walk func(node *xsdNode, inChoice bool)
+	walk = func(node *xsdNode, inChoice bool) {
+		for i := range node.Children {
+			child := &node.Children[i]
+			switch child.XMLName.Local {
+			case "element":
+				p := particle{element: child, minOccurs: child.attr("minOccurs"), maxOccurs: child.attr("maxOccurs")}
+				if inChoice {
+					p.minOccurs = "0"
+				}
+				result = append(result, p)
+			case "sequence", "all":
+				walk(child, inChoice)
+			case "choice":
+				imp.warn("<%s> has a choice; its elements were made optional", elementName)
+				walk(child, true)
+			case "complexContent":
+				if extension := child.child("extension"); extension != nil {
+					if base := imp.complexTypes[localName(extension.attr("base"))]; base != nil {
+						walk(base, inChoice)
+					}
+					walk(extension, inChoice)
+				} else if restriction := child.child("restriction"); restriction != nil {
+					walk(restriction, inChoice)
+				}
+			case "attribute", "attributeGroup":
+				imp.warn("attribute %s of <%s> is not supported and was skipped",
+					child.attr("name")+child.attr("ref"), elementName)
+			case "any":
+				imp.warn("<%s> allows any element; this was skipped", elementName)
+			}
+		}
+	}
+	walk(complexType, false)
+	return result
+}
+
+// importLevel imports the children of an element as the fields of a level,
+// and descends into the first complex child as the next level.
+func (imp *xsdImport) importLevel(element *xsdNode, parent string) {
+	name := element.attr("name")
+	levels := map[string]string{"cashbook": "transaction", "transaction": "lineItem"}
+	if name != parent {
+		imp.warn("<%s> is the %s element; the converter writes it as <%s>", name, parent, parent)
+	}
+
+	order := 0
+	descended := false
+	for _, p := range imp.particles(imp.complexType(element), name) {
+		child := imp.resolve(p.element)
+		if child == nil {
+			continue
+		}
+		if imp.complexType(child) != nil {
+			next, ok := levels[parent]
+			if !ok || descended {
+				imp.warn("nested element <%s> in <%s> is not supported and was skipped; flatten its fields into the template",
+					child.attr("name"), name)
+				continue
+			}
+			descended = true
+			imp.importLevel(child, next)
+			continue
+		}
+
+		order++
+		imp.addField(child, p, parent, order)
+	}
+}
+
+// addField adds a simple element as a field of the template.
+func (imp *xsdImport) addField(element *xsdNode, p particle, parent string, order int) {
+	tag := element.attr("name")
+	mapping := &FieldMapping{
+		OldHeader:    tag,
+		XMLTag:       tag,
+		ParentTag:    parent,
+		RequiredType: "required",
+		Order:        order,
+		DefaultValue: element.attr("default"),
+		FixedValue:   element.attr("fixed"),
+		Nillable:     element.attr("nillable") == "true",
+	}
+	if p.minOccurs == "0" {
+		mapping.RequiredType = "optional"
+	}
+	if p.maxOccurs == "unbounded" {
+		mapping.RepeatDelimiter = ";"
+	} else if max, err := strconv.Atoi(p.maxOccurs); err == nil && max > 1 {
+		mapping.RepeatDelimiter = ";"
+	}
+	if doc := element.child("annotation"); doc != nil {
+		if text := doc.child("documentation"); text != nil {
+			mapping.Notes = strings.Join(strings.Fields(text.Text), " ")
+		}
+	}
+
+	facets := imp.facets(element)
+	imp.applyFacets(mapping, facets)
+
+	// The XML tag is a placeholder Old Header; keep it unique.
+	if _, exists := imp.schema.FieldMappings[mapping.OldHeader]; exists {
+		mapping.OldHeader = parent + "_" + tag
+	}
+	imp.schema.FieldMappings[mapping.OldHeader] = mapping
+	switch parent {
+	case "cashbook":
+		imp.schema.CashbookFields = append(imp.schema.CashbookFields, mapping.OldHeader)
+	case "transaction":
+		imp.schema.TransactionFields = append(imp.schema.TransactionFields, mapping.OldHeader)
+	default:
+		imp.schema.LineItemFields = append(imp.schema.LineItemFields, mapping.OldHeader)
+	}
+}
+
+// facets returns the restrictions of a simple element's type, following
+// named simple types to their built-in base. Facets of a derived type take
+// precedence over those of its base.
+func (imp *xsdImport) facets(element *xsdNode) xsdFacets {
+	var facets xsdFacets
+	seen := make(map[string]bool)
+
+	simpleType := element.child("simpleType")
+	typeName := element.attr("type")
+	if derivation := imp.simpleContent(element); derivation != nil {
+		imp.warn("the attributes of %s are not supported and were skipped", element.attr("name"))
+		imp.addFacets(&facets, derivation)
+		simpleType = derivation.child("simpleType")
+		typeName = derivation.attr("base")
+	}
+	for {
+		if simpleType == nil {
+			name := localName(typeName)
+			named := imp.simpleTypes[name]
+			if named == nil || seen[name] {
+				if facets.base == "" {
+					facets.base = name
+				}
+				return facets
+			}
+			seen[name] = true
+			simpleType = named
+		}
+
+		restriction := simpleType.child("restriction")
+		if restriction == nil {
+			// Lists and unions are kept as strings.
+			facets.base = "string"
+			return facets
+		}
+		imp.addFacets(&facets, restriction)
+		typeName = restriction.attr("base")
+		simpleType = restriction.child("simpleType")
+	}
+}
+
+// addFacets adds the facets of a restriction that are not set yet.
+func (imp *xsdImport) addFacets(facets *xsdFacets, restriction *xsdNode) {
+	var patterns, enumeration []string
+	for i := range restriction.Children {
+		facet := &restriction.Children[i]
+		value := facet.attr("value")
+		number, _ := strconv.Atoi(value)
+		switch facet.XMLName.Local {
+		case "length", "maxLength":
+			if facets.maxLength == 0 {
+				facets.maxLength = number
+			}
+		case "totalDigits":
+			if facets.totalDigits == 0 {
+				facets.totalDigits = number
+			}
+		case "fractionDigits":
+			if !facets.fractionSet {
+				facets.fractionDigits = number
+				facets.fractionSet = true
+			}
+		case "pattern":
+			patterns = append(patterns, value)
+		case "enumeration":
+			enumeration = append(enumeration, value)
+		}
+	}
+	if facets.patterns == nil {
+		facets.patterns = patterns
+	}
+	if facets.enumeration == nil {
+		facets.enumeration = enumeration
+	}
+}
+
+// applyFacets sets the data type, max length, and pattern of a field from
+// the facets of its type.
+func (imp *xsdImport) applyFacets(mapping *FieldMapping, facets xsdFacets) {
+	mapping.MaxLength = facets.maxLength
+
+	switch facets.base {
+	case "string", "normalizedString", "token", "anyURI", "Name", "NCName",
+		"NMTOKEN", "ID", "IDREF", "language", "":
+		mapping.DataType = "string"
+	case "integer", "int", "long", "short", "byte", "nonNegativeInteger",
+		"positiveInteger", "nonPositiveInteger", "negativeInteger",
+		"unsignedLong", "unsignedInt", "unsignedShort", "unsignedByte":
+		mapping.DataType = "numeric"
+		if facets.totalDigits > 0 {
+			mapping.MaxLength = facets.totalDigits
+		}
+	case "decimal", "float", "double":
+		mapping.DataType = "decimal"
+		if facets.fractionSet {
+			mapping.DataType = fmt.Sprintf("decimal(%d)", facets.fractionDigits)
+		}
+		if facets.totalDigits > 0 {
+			// Digits plus the decimal point.
+			mapping.MaxLength = facets.totalDigits
+			if facets.fractionDigits > 0 {
+				mapping.MaxLength++
+			}
+		}
+	case "date":
+		mapping.DataType = "date(2006-01-02)"
+	case "dateTime":
+		mapping.DataType = "string"
+		mapping.Pattern = `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+\-]\d{2}:\d{2})?`
+	case "time":
+		mapping.DataType = "string"
+		mapping.Pattern = `\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+\-]\d{2}:\d{2})?`
+	case "boolean":
+		mapping.DataType = "boolean"
+	default:
+		mapping.DataType = "string"
+		imp.warn("%s has the type %s, which is imported as string", mapping.XMLTag, facets.base)
+	}
+
+	// Patterns of one type are alternatives; an enumeration is one too.
+	patterns := facets.patterns
+	if len(facets.enumeration) > 0 {
+		quoted := make([]string, len(facets.enumeration))
+		for i, value := range facets.enumeration {
+			quoted[i] = regexp.QuoteMeta(value)
+		}
+		patterns = []string{strings.Join(quoted, "|")}
+		if mapping.Notes == "" {
+			mapping.Notes = "One of: " + strings.Join(facets.enumeration, ", ")
+		}
+	}
+	switch len(patterns) {
+	case 0:
+	case 1:
+		mapping.Pattern = patterns[0]
+	default:
+		mapping.Pattern = "(" + strings.Join(patterns, ")|(") + ")"
+	}
+
+	if mapping.Pattern != "" {
+		if _, err := compilePattern(mapping.Pattern); err != nil {
+			imp.warn("pattern %q of %s is not supported and was dropped: %v", mapping.Pattern, mapping.XMLTag, err)
+			mapping.Pattern = ""
+		}
+	}
+}
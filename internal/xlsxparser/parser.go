@@ -32,6 +32,9 @@ package xlsxparser
 
 import (
 	"fmt"
+	"io"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -51,6 +54,13 @@ type Schema struct {
 	// TemplateFile is the path to the source template file.
 	TemplateFile string
 
+	// SheetName is the name of the sheet the fields were read from.
+	SheetName string
+
+	// Version is the template version from the _meta sheet (see
+	// readVersion). Empty if the template has none.
+	Version string
+
 	// FieldMappings contains the mapping for each field.
 	// The key is the old system header (CSV column name).
 	FieldMappings map[string]*FieldMapping
@@ -81,6 +91,10 @@ type Schema struct {
 	//
 	// CUSTOMIZATION: Change this if your XML uses a different line item element name.
 	XMLLineItemElement string
+
+	// InactiveFields are the template's fields that a template rule turned
+	// off (see Subset), in template order. They are not in FieldMappings.
+	InactiveFields []string
 }
 
 // FieldMapping represents the mapping and validation rules for a single field.
@@ -108,6 +122,9 @@ type FieldMapping struct {
 	//   - "alpha"       : Letters only
 	//   - "date"        : Date value (with optional format, e.g., "date(YYYY-MM-DD)")
 	//   - "boolean"     : True/false values
+	//   - "currency_code": ISO 4217 currency code (e.g., "USD")
+	//   - "country_code": ISO 3166 alpha-2 country code (e.g., "US"), or
+	//     alpha-3 as "country_code(alpha3)"
 	//
 	// CUSTOMIZATION: Add additional data types as needed.
 	DataType string
@@ -133,13 +150,183 @@ type FieldMapping struct {
 	// Please provide examples so we can implement the parser correctly.
 	ConditionalRule string
 
-	// DefaultValue is the value to use if the field is empty.
-	// Leave empty if there is no default.
+	// EmitCondition writes the field's element only for rows that meet it,
+	// from the optional Emit If column, in the syntax of ConditionalRule
+	// (e.g., "PAY_METHOD == 'WIRE'"). Empty if the element is always
+	// written.
+	EmitCondition string
+
+	// ConditionalTags are other element names of the field for rows that
+	// meet their conditions, from the optional Conditional Tag column
+	// (e.g., "TraceNumber if PAY_METHOD == 'ACH'"). The first tag whose
+	// condition holds names the element; XMLTag names it on other rows.
+	ConditionalTags []ConditionalTag
+
+	// DefaultValue is the value to use if the field is empty, from the
+	// optional Default column. The generated XSD declares it as the
+	// element's default. Leave empty if there is no default.
 	DefaultValue string
 
+	// FixedValue is the only value the field may have, from the optional
+	// Fixed column. It is written whatever the input holds, and an input
+	// value that differs is a validation error. The generated XSD declares
+	// it as the element's fixed value.
+	FixedValue string
+
+	// Nillable writes an empty field as an element with xsi:nil="true"
+	// instead of an empty element, from the optional Nillable column. An
+	// empty required field is then valid.
+	Nillable bool
+
 	// Order is the position of this field in the output XML.
-	// Fields are sorted by this value when generating XML.
+	// Fields are sorted by this value when generating XML. It is the value
+	// of the Order column, or the template row number (as numbered in
+	// Excel) when that cell is empty.
 	Order int
+
+	// RepeatDelimiter makes the field repeatable: a value such as
+	// "INV1;INV2" is split at the delimiter into one element per value,
+	// and each value is validated on its own. Empty if the field is not
+	// repeatable. See parseRepeat.
+	RepeatDelimiter string
+
+	// Pattern is a regular expression every value must match as a whole,
+	// from the optional Pattern column (e.g., "[A-Z]{2}[0-9]{6}"). The
+	// generated XSD declares it as a pattern facet, so it should only use
+	// syntax that Go and XML Schema share.
+	Pattern string
+
+	// pattern is Pattern, compiled and anchored.
+	pattern *regexp.Regexp
+
+	// Severity is "warning" when violations of the field's rules are
+	// reported as warnings instead of errors, from the optional Severity
+	// column (see parseSeverity); empty otherwise. Warnings are reported
+	// but do not fail the file.
+	Severity string
+
+	// WarningCodes limits Severity to the listed rule codes (e.g.,
+	// "VAL-LEN-001"). Empty means all of the field's rules.
+	WarningCodes []string
+
+	// Notes are the analyst's comments on the field, from the Notes column.
+	// They are not used for conversion.
+	Notes string
+}
+
+// ConditionalTag is an element name of a field for the rows that meet a
+// condition (see FieldMapping.ConditionalTags).
+type ConditionalTag struct {
+	// XMLTag is the element name, e.g. "TraceNumber".
+	XMLTag string
+
+	// Condition is the condition, in the syntax of ConditionalRule (e.g.,
+	// "PAY_METHOD == 'ACH'").
+	Condition string
+}
+
+// MatchesPattern reports whether a value matches the field's Pattern as a
+// whole. It is true if the field has no pattern.
+func (m *FieldMapping) MatchesPattern(value string) bool {
+	if m.Pattern == "" {
+		return true
+	}
+	pattern := m.pattern
+	if pattern == nil {
+		var err error
+		if pattern, err = compilePattern(m.Pattern); err != nil {
+			return false
+		}
+	}
+	return pattern.MatchString(value)
+}
+
+// compilePattern compiles a Pattern cell. XML Schema patterns always match
+// the whole value, so the expression is anchored.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// RuleSeverity returns the severity of a violation of one of the field's
+// rules: "warning" if the Severity column makes it one, else "error".
+func (m *FieldMapping) RuleSeverity(code string) string {
+	if m.Severity != "warning" {
+		return "error"
+	}
+	if len(m.WarningCodes) == 0 {
+		return "warning"
+	}
+	for _, warning := range m.WarningCodes {
+		if strings.EqualFold(warning, code) {
+			return "warning"
+		}
+	}
+	return "error"
+}
+
+// SeverityCell returns the Severity cell of the field (see parseSeverity).
+func (m *FieldMapping) SeverityCell() string {
+	if m.Severity == "" || len(m.WarningCodes) == 0 {
+		return m.Severity
+	}
+	return m.Severity + ": " + strings.Join(m.WarningCodes, ", ")
+}
+
+// ConditionalTagCell returns the Conditional Tag cell of the field (see
+// parseConditionalTags), or "" if it has no conditional tags.
+func (m *FieldMapping) ConditionalTagCell() string {
+	entries := make([]string, len(m.ConditionalTags))
+	for i, tag := range m.ConditionalTags {
+		entries[i] = tag.XMLTag + " if " + tag.Condition
+	}
+	return strings.Join(entries, "; ")
+}
+
+// XMLTags returns every element name of the field: XMLTag, then the
+// conditional tags.
+func (m *FieldMapping) XMLTags() []string {
+	tags := []string{m.XMLTag}
+	for _, tag := range m.ConditionalTags {
+		tags = append(tags, tag.XMLTag)
+	}
+	return tags
+}
+
+// OutputValue returns the value written for a field value: the fixed
+// value, the default value if the value is empty, or the value itself.
+func (m *FieldMapping) OutputValue(value string) string {
+	switch {
+	case m.FixedValue != "":
+		return m.FixedValue
+	case value == "":
+		return m.DefaultValue
+	}
+	return value
+}
+
+// Repeatable reports whether the field is written as one element per value.
+func (m *FieldMapping) Repeatable() bool {
+	return m.RepeatDelimiter != ""
+}
+
+// Values returns the values of the field: the parts of a repeatable field
+// without surrounding spaces and empty parts, or the value itself. There
+// are none for an empty value.
+func (m *FieldMapping) Values(value string) []string {
+	if !m.Repeatable() {
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	}
+
+	var values []string
+	for _, part := range strings.Split(value, m.RepeatDelimiter) {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
 }
 
 // =============================================================================
@@ -195,6 +382,57 @@ type TemplateColumns struct {
 	// QUESTION FOR USER: Which column contains the conditional rule (if any)?
 	ConditionalRuleColumn int
 
+	// OrderColumn is the column containing the field order within its parent.
+	// Elements can be reordered with this column without rearranging rows.
+	// Rows with an empty cell are ordered by their row number, so number
+	// either all rows or none. Set to -1 if the template has no such column.
+	// Default: 7 (Column H)
+	OrderColumn int
+
+	// RepeatColumn is the column marking repeatable fields (see
+	// parseRepeat). Set to -1 to find it by its header ("Repeat",
+	// "Repeatable", or "Repeat Delimiter"); a template without such a
+	// header has no repeatable fields.
+	// Default: -1
+	RepeatColumn int
+
+	// DefaultColumn, FixedColumn, and NillableColumn are the columns of
+	// the XSD-style facets: the default value, the fixed value, and whether
+	// an empty field is written as nil. Set to -1 to find them by their
+	// headers ("Default" or "Default Value", "Fixed" or "Fixed Value", and
+	// "Nillable"); a template without them has no such facets.
+	// Default: -1
+	DefaultColumn  int
+	FixedColumn    int
+	NillableColumn int
+
+	// EmitIfColumn is the column with the condition for writing a field's
+	// element. Set to -1 to find it by its header ("Emit If" or "Emit
+	// Condition").
+	// Default: -1
+	EmitIfColumn int
+
+	// ConditionalTagColumn is the column with a field's conditional element
+	// names (see parseConditionalTags). Set to -1 to find it by its header
+	// ("Conditional Tag" or "Tag If").
+	// Default: -1
+	ConditionalTagColumn int
+
+	// PatternColumn is the column with the regular expression a field's
+	// values must match. Set to -1 to find it by its header ("Pattern").
+	// Default: -1
+	PatternColumn int
+
+	// SeverityColumn is the column marking rules as warnings (see
+	// parseSeverity). Set to -1 to find it by its header ("Severity").
+	// Default: -1
+	SeverityColumn int
+
+	// NotesColumn is the column with comments on the field. Set to -1 to
+	// find it by its header ("Notes").
+	// Default: -1
+	NotesColumn int
+
 	// HeaderRow is the row number containing column headers (0-based).
 	// Default: 0 (Row 1)
 	HeaderRow int
@@ -208,15 +446,25 @@ type TemplateColumns struct {
 // CUSTOMIZATION: Modify these defaults to match your template layout.
 func DefaultTemplateColumns() TemplateColumns {
 	return TemplateColumns{
-		OldHeaderColumn:       0, // Column A
-		XMLTagColumn:          1, // Column B
-		ParentTagColumn:       2, // Column C
-		DataTypeColumn:        3, // Column D
-		MaxLengthColumn:       4, // Column E
-		RequiredColumn:        5, // Column F
-		ConditionalRuleColumn: 6, // Column G
-		HeaderRow:             0, // Row 1
-		DataStartRow:          1, // Row 2
+		OldHeaderColumn:       0,  // Column A
+		XMLTagColumn:          1,  // Column B
+		ParentTagColumn:       2,  // Column C
+		DataTypeColumn:        3,  // Column D
+		MaxLengthColumn:       4,  // Column E
+		RequiredColumn:        5,  // Column F
+		ConditionalRuleColumn: 6,  // Column G
+		OrderColumn:           7,  // Column H
+		RepeatColumn:          -1, // By header
+		DefaultColumn:         -1, // By header
+		FixedColumn:           -1, // By header
+		NillableColumn:        -1, // By header
+		EmitIfColumn:          -1, // By header
+		ConditionalTagColumn:  -1, // By header
+		PatternColumn:         -1, // By header
+		SeverityColumn:        -1, // By header
+		NotesColumn:           -1, // By header
+		HeaderRow:             0,  // Row 1
+		DataStartRow:          1,  // Row 2
 	}
 }
 
@@ -257,69 +505,94 @@ func ParseWithConfig(templatePath string, columns TemplateColumns) (*Schema, err
 	}
 	defer f.Close()
 
-	// Initialize the schema.
-	schema := &Schema{
-		TemplateFile:          templatePath,
-		FieldMappings:         make(map[string]*FieldMapping),
-		TransactionFields:     []string{},
-		LineItemFields:        []string{},
-		CashbookFields:        []string{},
-		XMLRootElement:        "cashbook",     // CUSTOMIZATION: Change if different
-		XMLTransactionElement: "transaction",  // CUSTOMIZATION: Change if different
-		XMLLineItemElement:    "lineItem",     // CUSTOMIZATION: Change if different
+	return parseTemplate(f, templatePath, columns)
+}
+
+// ParseReader reads an XLSX template from a stream, using the default
+// column configuration.
+//
+// PARAMETERS:
+//   - r: The XLSX template data.
+//   - name: The name reported as the schema's TemplateFile.
+//
+// RETURNS:
+//   - A pointer to the Schema struct containing all field mappings.
+//   - An error if the data cannot be read or parsed.
+func ParseReader(r io.Reader, name string) (*Schema, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open template: %w", err)
 	}
+	defer f.Close()
+
+	return parseTemplate(f, name, DefaultTemplateColumns())
+}
 
+// parseTemplate parses the first sheet of an open XLSX template. Sheets
+// whose name starts with "_" (such as the _meta sheet) are not field sheets
+// and are skipped.
+func parseTemplate(f *excelize.File, templatePath string, columns TemplateColumns) (*Schema, error) {
 	// Get the first sheet name.
 	// CUSTOMIZATION: If your template has multiple sheets, modify this logic.
-	sheetName := f.GetSheetName(0)
+	sheetName := ""
+	for _, name := range f.GetSheetList() {
+		if !strings.HasPrefix(name, "_") {
+			sheetName = name
+			break
+		}
+	}
 	if sheetName == "" {
 		return nil, fmt.Errorf("template file has no sheets")
 	}
 
-	// Get all rows from the sheet.
-	rows, err := f.GetRows(sheetName)
+	schema, err := parseSheet(f, sheetName, columns)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read rows: %w", err)
+		return nil, err
 	}
 
-	// Parse each data row.
-	for i := columns.DataStartRow; i < len(rows); i++ {
-		row := rows[i]
+	schema.Version, err = readVersion(f)
+	if err != nil {
+		return nil, err
+	}
 
-		// Skip empty rows.
-		if len(row) == 0 || isRowEmpty(row) {
-			continue
-		}
+	schema.TemplateFile = templatePath
+	return schema, nil
+}
 
-		// Parse the field mapping from this row.
-		mapping, err := parseRow(row, columns, i)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing row %d: %w", i+1, err)
-		}
+// MetaSheet is the name of the optional sheet holding information about the
+// template itself, as label/value pairs in columns A and B:
+//
+//	| Version | 2024.2 |
+const MetaSheet = "_meta"
 
-		// Skip rows with empty old header (no mapping defined).
-		if mapping.OldHeader == "" {
-			continue
-		}
+// readVersion reads the template version: the value next to the "Version"
+// label (ignoring case and a trailing colon) on the _meta sheet.
+//
+// RETURNS:
+//   - The version, or "" if there is no _meta sheet or no Version row.
+//   - An error if the _meta sheet cannot be read.
+func readVersion(f *excelize.File) (string, error) {
+	index, err := f.GetSheetIndex(MetaSheet)
+	if err != nil || index < 0 {
+		return "", nil
+	}
 
-		// Add the mapping to the schema.
-		schema.FieldMappings[mapping.OldHeader] = mapping
+	rows, err := f.GetRows(MetaSheet)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s sheet: %w", MetaSheet, err)
+	}
 
-		// Categorize the field by parent tag.
-		switch strings.ToLower(mapping.ParentTag) {
-		case "transaction":
-			schema.TransactionFields = append(schema.TransactionFields, mapping.OldHeader)
-		case "lineitem":
-			schema.LineItemFields = append(schema.LineItemFields, mapping.OldHeader)
-		case "cashbook":
-			schema.CashbookFields = append(schema.CashbookFields, mapping.OldHeader)
-		default:
-			// Default to lineItem if parent tag is not recognized.
-			schema.LineItemFields = append(schema.LineItemFields, mapping.OldHeader)
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		label := strings.TrimSuffix(strings.TrimSpace(row[0]), ":")
+		if strings.EqualFold(label, "version") {
+			return strings.TrimSpace(row[1]), nil
 		}
 	}
 
-	return schema, nil
+	return "", nil
 }
 
 // parseRow extracts a FieldMapping from a single row.
@@ -334,12 +607,12 @@ func ParseWithConfig(templatePath string, columns TemplateColumns) (*Schema, err
 //   - An error if parsing fails.
 func parseRow(row []string, columns TemplateColumns, rowIndex int) (*FieldMapping, error) {
 	mapping := &FieldMapping{
-		Order: rowIndex,
+		Order: rowIndex + 1,
 	}
 
 	// Helper function to safely get a cell value.
 	getCell := func(index int) string {
-		if index < len(row) {
+		if index >= 0 && index < len(row) {
 			return strings.TrimSpace(row[index])
 		}
 		return ""
@@ -352,6 +625,13 @@ func parseRow(row []string, columns TemplateColumns, rowIndex int) (*FieldMappin
 	mapping.DataType = getCell(columns.DataTypeColumn)
 	mapping.RequiredType = getCell(columns.RequiredColumn)
 	mapping.ConditionalRule = getCell(columns.ConditionalRuleColumn)
+	mapping.EmitCondition = getCell(columns.EmitIfColumn)
+
+	conditionalTags, err := parseConditionalTags(getCell(columns.ConditionalTagColumn))
+	if err != nil {
+		return nil, fmt.Errorf("invalid conditional tag for %s: %w", mapping.OldHeader, err)
+	}
+	mapping.ConditionalTags = conditionalTags
 
 	// Parse max length as integer.
 	maxLengthStr := getCell(columns.MaxLengthColumn)
@@ -365,6 +645,47 @@ func parseRow(row []string, columns TemplateColumns, rowIndex int) (*FieldMappin
 		}
 	}
 
+	// Parse the explicit order, if any.
+	orderStr := getCell(columns.OrderColumn)
+	if orderStr != "" {
+		order, err := strconv.Atoi(orderStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid order %q for %s", orderStr, mapping.OldHeader)
+		}
+		mapping.Order = order
+	}
+
+	mapping.RepeatDelimiter = parseRepeat(getCell(columns.RepeatColumn))
+
+	// XSD-style facets.
+	mapping.DefaultValue = getCell(columns.DefaultColumn)
+	mapping.FixedValue = getCell(columns.FixedColumn)
+	if mapping.DefaultValue != "" && mapping.FixedValue != "" {
+		return nil, fmt.Errorf("%s has both a default and a fixed value", mapping.OldHeader)
+	}
+	switch strings.ToLower(getCell(columns.NillableColumn)) {
+	case "yes", "y", "true", "1", "nillable":
+		mapping.Nillable = true
+	}
+
+	mapping.Pattern = getCell(columns.PatternColumn)
+	if mapping.Pattern != "" {
+		pattern, err := compilePattern(mapping.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q for %s: %w", mapping.Pattern, mapping.OldHeader, err)
+		}
+		mapping.pattern = pattern
+	}
+
+	severity, codes, err := parseSeverity(getCell(columns.SeverityColumn))
+	if err != nil {
+		return nil, fmt.Errorf("invalid severity for %s: %w", mapping.OldHeader, err)
+	}
+	mapping.Severity = severity
+	mapping.WarningCodes = codes
+
+	mapping.Notes = getCell(columns.NotesColumn)
+
 	// Normalize required type.
 	mapping.RequiredType = normalizeRequiredType(mapping.RequiredType)
 
@@ -388,6 +709,102 @@ func isRowEmpty(row []string) bool {
 	return true
 }
 
+// findColumn returns the index of the first header cell matching one of
+// the names (ignoring case), or -1 if there is none.
+func findColumn(header []string, names ...string) int {
+	for i, cell := range header {
+		cell = strings.ToLower(strings.TrimSpace(cell))
+		for _, name := range names {
+			if cell == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseRepeat returns the split delimiter of a Repeat cell: ";" for yes
+// (y, true, 1, repeat), "" for an empty cell or no (n, false, 0), and any
+// other text as the delimiter itself (e.g., "|" or ",").
+func parseRepeat(value string) string {
+	switch strings.ToLower(value) {
+	case "", "no", "n", "false", "0":
+		return ""
+	case "yes", "y", "true", "1", "repeat", "repeatable":
+		return ";"
+	default:
+		return value
+	}
+}
+
+// conditionalTagPattern matches one entry of a Conditional Tag cell: an
+// element name, "if", and a condition.
+var conditionalTagPattern = regexp.MustCompile(`^([A-Za-z_][\w.-]*)\s+if\s+(.+)$`)
+
+// parseConditionalTags parses a Conditional Tag cell: entries of an element
+// name and the condition for it, separated by semicolons or line breaks:
+//
+//	TraceNumber if PAY_METHOD == 'ACH'; WireNumber if PAY_METHOD == 'WIRE'
+//
+// RETURNS:
+//   - The tags in the order of the cell, or nil for an empty cell.
+//   - An error for an entry without an element name or condition.
+func parseConditionalTags(value string) ([]ConditionalTag, error) {
+	var tags []ConditionalTag
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		match := conditionalTagPattern.FindStringSubmatch(entry)
+		if match == nil {
+			return nil, fmt.Errorf("%q is not \"<Tag> if <condition>\"", entry)
+		}
+		tags = append(tags, ConditionalTag{XMLTag: match[1], Condition: strings.TrimSpace(match[2])})
+	}
+	return tags, nil
+}
+
+// ruleCodePattern matches a validation rule code (e.g., "VAL-LEN-001").
+var ruleCodePattern = regexp.MustCompile(`^VAL-[A-Z]{3}-[0-9]{3}$`)
+
+// parseSeverity parses a Severity cell:
+//   - "" or "error": violations of the field's rules are errors.
+//   - "warning" (or "warn"): they are all warnings.
+//   - "warning: VAL-LEN-001, VAL-PAT-001": violations of the listed rules
+//     are warnings, the others errors.
+//
+// RETURNS:
+//   - "warning" or "".
+//   - The listed rule codes, upper-cased.
+//   - An error for any other cell or a malformed code.
+func parseSeverity(value string) (string, []string, error) {
+	level, list, hasList := strings.Cut(value, ":")
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "", "error":
+		if hasList {
+			return "", nil, fmt.Errorf("%q: only warnings take a list of rules", value)
+		}
+		return "", nil, nil
+	case "warning", "warn":
+	default:
+		return "", nil, fmt.Errorf("%q is not error or warning", value)
+	}
+
+	var codes []string
+	for _, code := range strings.Split(list, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		if !ruleCodePattern.MatchString(code) {
+			return "", nil, fmt.Errorf("%q is not a rule code (e.g., VAL-LEN-001)", code)
+		}
+		codes = append(codes, code)
+	}
+	return "warning", codes, nil
+}
+
 // normalizeRequiredType normalizes the required type to a standard value.
 //
 // CUSTOMIZATION: Add additional mappings for your template's terminology.
@@ -421,6 +838,9 @@ func normalizeDataType(value string) string {
 	if strings.HasPrefix(value, "date") {
 		return value // Keep the full value including format
 	}
+	if strings.HasPrefix(value, "country_code") {
+		return value // Keep the full value including alpha3
+	}
 
 	switch value {
 	case "string", "str", "text", "varchar":
@@ -435,6 +855,10 @@ func normalizeDataType(value string) string {
 		return "alpha"
 	case "boolean", "bool", "bit":
 		return "boolean"
+	case "currency_code", "currency code", "iso4217":
+		return "currency_code"
+	case "country code", "iso3166", "country":
+		return "country_code"
 	default:
 		// Default to string if not recognized.
 		return "string"
@@ -470,6 +894,57 @@ func (s *Schema) GetXMLTag(oldHeader string) string {
 	return oldHeader
 }
 
+// Subset returns a copy of the schema with only some of its fields active,
+// e.g. for the files of a template rule that never populate the template's
+// other fields. The mappings themselves are shared.
+//
+// PARAMETERS:
+//   - fields: The fields (old headers) to keep, or nil for all fields.
+//   - excluded: The fields to turn off instead, or nil for none.
+//
+// RETURNS:
+//   - The schema, or the schema itself if both lists are empty.
+//   - An error if a listed field is not in the template.
+func (s *Schema) Subset(fields, excluded []string) (*Schema, error) {
+	if len(fields) == 0 && len(excluded) == 0 {
+		return s, nil
+	}
+
+	listed := make(map[string]bool)
+	for _, field := range append(append([]string{}, fields...), excluded...) {
+		if _, exists := s.FieldMappings[field]; !exists {
+			return nil, fmt.Errorf("field %s is not in the template", field)
+		}
+		listed[field] = true
+	}
+	active := func(field string) bool {
+		if len(fields) > 0 {
+			return listed[field]
+		}
+		return !listed[field]
+	}
+
+	subset := *s
+	subset.FieldMappings = make(map[string]*FieldMapping)
+	subset.InactiveFields = append([]string{}, s.InactiveFields...)
+	keep := func(list []string) []string {
+		var kept []string
+		for _, field := range list {
+			if active(field) {
+				kept = append(kept, field)
+				subset.FieldMappings[field] = s.FieldMappings[field]
+			} else {
+				subset.InactiveFields = append(subset.InactiveFields, field)
+			}
+		}
+		return kept
+	}
+	subset.CashbookFields = keep(s.CashbookFields)
+	subset.TransactionFields = keep(s.TransactionFields)
+	subset.LineItemFields = keep(s.LineItemFields)
+	return &subset, nil
+}
+
 // IsTransactionField checks if a field belongs to the transaction element.
 func (s *Schema) IsTransactionField(oldHeader string) bool {
 	if mapping, exists := s.FieldMappings[oldHeader]; exists {
@@ -518,6 +993,11 @@ func ParseMultiSheetWithConfig(templatePath string, columns TemplateColumns) (ma
 
 	schemas := make(map[string]*Schema)
 
+	version, err := readVersion(f)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get all sheet names.
 	sheetNames := f.GetSheetList()
 
@@ -535,6 +1015,7 @@ func ParseMultiSheetWithConfig(templatePath string, columns TemplateColumns) (ma
 		}
 
 		schema.TemplateFile = templatePath
+		schema.Version = version
 		schemas[sheetName] = schema
 	}
 
@@ -545,6 +1026,7 @@ func ParseMultiSheetWithConfig(templatePath string, columns TemplateColumns) (ma
 func parseSheet(f *excelize.File, sheetName string, columns TemplateColumns) (*Schema, error) {
 	// Initialize the schema.
 	schema := &Schema{
+		SheetName:             sheetName,
 		FieldMappings:         make(map[string]*FieldMapping),
 		TransactionFields:     []string{},
 		LineItemFields:        []string{},
@@ -560,6 +1042,39 @@ func parseSheet(f *excelize.File, sheetName string, columns TemplateColumns) (*S
 		return nil, fmt.Errorf("failed to read rows: %w", err)
 	}
 
+	// Optional columns are found by their header, so they can be added
+	// after the Notes column of existing templates.
+	if columns.HeaderRow < len(rows) {
+		header := rows[columns.HeaderRow]
+		if columns.RepeatColumn < 0 {
+			columns.RepeatColumn = findColumn(header, "repeat", "repeatable", "repeat delimiter")
+		}
+		if columns.DefaultColumn < 0 {
+			columns.DefaultColumn = findColumn(header, "default", "default value")
+		}
+		if columns.FixedColumn < 0 {
+			columns.FixedColumn = findColumn(header, "fixed", "fixed value")
+		}
+		if columns.NillableColumn < 0 {
+			columns.NillableColumn = findColumn(header, "nillable")
+		}
+		if columns.EmitIfColumn < 0 {
+			columns.EmitIfColumn = findColumn(header, "emit if", "emit condition")
+		}
+		if columns.ConditionalTagColumn < 0 {
+			columns.ConditionalTagColumn = findColumn(header, "conditional tag", "tag if")
+		}
+		if columns.PatternColumn < 0 {
+			columns.PatternColumn = findColumn(header, "pattern")
+		}
+		if columns.SeverityColumn < 0 {
+			columns.SeverityColumn = findColumn(header, "severity")
+		}
+		if columns.NotesColumn < 0 {
+			columns.NotesColumn = findColumn(header, "notes")
+		}
+	}
+
 	// Parse each data row.
 	for i := columns.DataStartRow; i < len(rows); i++ {
 		row := rows[i]
@@ -591,5 +1106,12 @@ func parseSheet(f *excelize.File, sheetName string, columns TemplateColumns) (*S
 		}
 	}
 
+	// Put the fields of each parent into output order.
+	for _, fields := range [][]string{schema.TransactionFields, schema.LineItemFields, schema.CashbookFields} {
+		sort.SliceStable(fields, func(i, j int) bool {
+			return schema.FieldMappings[fields[i]].Order < schema.FieldMappings[fields[j]].Order
+		})
+	}
+
 	return schema, nil
 }
@@ -0,0 +1,130 @@
+// =============================================================================
+// CSV to XML Converter - XLSX Template Writer
+// =============================================================================
+//
+// Writes a schema back out as an XLSX template in the default column layout
+// (see DefaultTemplateColumns), so a generated template (see FromXSD) can be
+// reviewed and completed in Excel like any other. The optional columns
+// (Default, Fixed, Nillable, Pattern, Repeat, Severity) are only added when
+// a field uses them.
+//
+// =============================================================================
+
+package xlsxparser
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// templateSheet is the name of the field sheet of a written template.
+const templateSheet = "Fields"
+
+// Write writes a schema as an XLSX template.
+//
+// PARAMETERS:
+//   - w: Receives the XLSX data.
+//   - schema: The schema to write. Its fields are written cashbook fields
+//     first, then transaction and line item fields, each in order.
+//
+// RETURNS:
+//   - An error if the workbook cannot be built or written.
+func Write(w io.Writer, schema *Schema) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	if err := f.SetSheetName(f.GetSheetName(0), templateSheet); err != nil {
+		return fmt.Errorf("failed to name sheet: %w", err)
+	}
+
+	var fields []*FieldMapping
+	for _, list := range [][]string{schema.CashbookFields, schema.TransactionFields, schema.LineItemFields} {
+		for _, field := range list {
+			fields = append(fields, schema.FieldMappings[field])
+		}
+	}
+
+	header := []interface{}{"Old Header", "XML Tag", "Parent", "Data Type", "Max Length", "Required", "Conditional Rule", "Order", "Notes"}
+	optional := []struct {
+		name  string
+		value func(m *FieldMapping) string
+	}{
+		{"Default", func(m *FieldMapping) string { return m.DefaultValue }},
+		{"Fixed", func(m *FieldMapping) string { return m.FixedValue }},
+		{"Nillable", func(m *FieldMapping) string { return yesOrEmpty(m.Nillable) }},
+		{"Emit If", func(m *FieldMapping) string { return m.EmitCondition }},
+		{"Conditional Tag", func(m *FieldMapping) string { return m.ConditionalTagCell() }},
+		{"Pattern", func(m *FieldMapping) string { return m.Pattern }},
+		{"Repeat", func(m *FieldMapping) string { return repeatCell(m.RepeatDelimiter) }},
+		{"Severity", func(m *FieldMapping) string { return m.SeverityCell() }},
+	}
+	var used []func(m *FieldMapping) string
+	for _, column := range optional {
+		for _, m := range fields {
+			if column.value(m) != "" {
+				header = append(header, column.name)
+				used = append(used, column.value)
+				break
+			}
+		}
+	}
+
+	if err := f.SetSheetRow(templateSheet, "A1", &header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err == nil {
+		lastCell, _ := excelize.CoordinatesToCellName(len(header), 1)
+		f.SetCellStyle(templateSheet, "A1", lastCell, bold)
+	}
+
+	for i, m := range fields {
+		maxLength := ""
+		if m.MaxLength > 0 {
+			maxLength = strconv.Itoa(m.MaxLength)
+		}
+		row := []interface{}{m.OldHeader, m.XMLTag, m.ParentTag, m.DataType, maxLength,
+			m.RequiredType, m.ConditionalRule, strconv.Itoa(m.Order), m.Notes}
+		for _, value := range used {
+			row = append(row, value(m))
+		}
+
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := f.SetSheetRow(templateSheet, cell, &row); err != nil {
+			return fmt.Errorf("failed to write %s: %w", m.XMLTag, err)
+		}
+	}
+	f.SetColWidth(templateSheet, "A", "B", 24)
+	f.SetColWidth(templateSheet, "I", "I", 40)
+
+	if schema.Version != "" {
+		if _, err := f.NewSheet(MetaSheet); err != nil {
+			return fmt.Errorf("failed to add %s sheet: %w", MetaSheet, err)
+		}
+		f.SetSheetRow(MetaSheet, "A1", &[]interface{}{"Version", schema.Version})
+	}
+
+	if _, err := f.WriteTo(w); err != nil {
+		return fmt.Errorf("failed to write template: %w", err)
+	}
+	return nil
+}
+
+// yesOrEmpty returns "yes" for true.
+func yesOrEmpty(b bool) string {
+	if b {
+		return "yes"
+	}
+	return ""
+}
+
+// repeatCell returns the Repeat cell of a delimiter (see parseRepeat).
+func repeatCell(delimiter string) string {
+	if delimiter == ";" {
+		return "yes"
+	}
+	return delimiter
+}
@@ -0,0 +1,291 @@
+// =============================================================================
+// CSV to XML Converter - Semantic XML Comparison
+// =============================================================================
+//
+// Compares two XML documents by their content rather than their text, so the
+// output of a candidate configuration can be checked against the current
+// one before it goes live:
+//
+//   - Whitespace around values, comments, processing instructions, and the
+//     order of attributes are ignored; namespaces are matched by local name.
+//   - Elements are matched by name and position among their siblings of the
+//     same name, so an added line item shows as one added element rather
+//     than every later element changing.
+//   - Differences are reported by path, e.g.
+//     "/cashbook/transaction[3]/lineItem[1]/PolicyNumber", and grouped by the
+//     path without positions (see Difference.Pattern) for a summary.
+//
+// =============================================================================
+
+package xmlwriter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of differences.
+const (
+	DiffChanged   = "changed"
+	DiffAdded     = "added"
+	DiffRemoved   = "removed"
+	DiffReordered = "reordered"
+)
+
+// Difference is a single difference between two documents.
+type Difference struct {
+	// Kind is one of the Diff constants.
+	Kind string
+
+	// Path is the element (or "element/@attribute") that differs.
+	Path string
+
+	// Before and After are the values in the first and the second document:
+	// the text of an element, the value of an attribute, or the order of
+	// the child elements. Empty for an element that is added or removed.
+	Before string
+	After  string
+}
+
+// String describes the difference on one line.
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("+ %s %s", d.Path, quoteValue(d.After))
+	case DiffRemoved:
+		return fmt.Sprintf("- %s %s", d.Path, quoteValue(d.Before))
+	case DiffReordered:
+		return fmt.Sprintf("~ %s children reordered: %s -> %s", d.Path, d.Before, d.After)
+	default:
+		return fmt.Sprintf("~ %s: %q -> %q", d.Path, d.Before, d.After)
+	}
+}
+
+// quoteValue quotes a value for String, or returns "" for none.
+func quoteValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	return fmt.Sprintf("%q", value)
+}
+
+// positionPattern matches the positions in a path.
+var positionPattern = regexp.MustCompile(`\[\d+\]`)
+
+// Pattern returns the kind and path of the difference without positions
+// (e.g., "changed /cashbook/transaction/lineItem/PolicyNumber"), which is
+// the same for a change repeated on every transaction.
+func (d Difference) Pattern() string {
+	return d.Kind + " " + positionPattern.ReplaceAllString(d.Path, "")
+}
+
+// compareNode is an element of a compared document.
+type compareNode struct {
+	name     string
+	attrs    map[string]string
+	text     string
+	children []*compareNode
+}
+
+// Compare compares two XML documents.
+//
+// PARAMETERS:
+//   - before: The first (e.g., current) document.
+//   - after: The second (e.g., candidate) document.
+//   - ignore: Element and attribute names (local names) to leave out of the
+//     comparison, such as a creation timestamp in the document header.
+//
+// RETURNS:
+//   - The differences, in document order. None if the documents are
+//     equivalent.
+//   - An error if a document is not well-formed XML.
+func Compare(before, after io.Reader, ignore []string) ([]Difference, error) {
+	ignored := make(map[string]bool)
+	for _, name := range ignore {
+		ignored[name] = true
+	}
+
+	beforeRoot, err := readCompareTree(before, ignored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the first document: %w", err)
+	}
+	afterRoot, err := readCompareTree(after, ignored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the second document: %w", err)
+	}
+
+	var differences []Difference
+	if beforeRoot.name != afterRoot.name {
+		return append(differences,
+			Difference{Kind: DiffRemoved, Path: "/" + beforeRoot.name},
+			Difference{Kind: DiffAdded, Path: "/" + afterRoot.name}), nil
+	}
+	compareNodes("/"+beforeRoot.name, beforeRoot, afterRoot, &differences)
+	return differences, nil
+}
+
+// readCompareTree reads a document into a tree of its elements.
+func readCompareTree(r io.Reader, ignored map[string]bool) (*compareNode, error) {
+	decoder := xml.NewDecoder(r)
+	var stack []*compareNode
+	var root *compareNode
+	skip := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skip > 0 || ignored[t.Name.Local] {
+				skip++
+				continue
+			}
+			node := &compareNode{name: t.Name.Local, attrs: make(map[string]string)}
+			for _, attr := range t.Attr {
+				// Namespace declarations are not content.
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" || ignored[attr.Name.Local] {
+					continue
+				}
+				node.attrs[attr.Name.Local] = attr.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(stack) > 0 {
+				node := stack[len(stack)-1]
+				node.text = strings.TrimSpace(node.text)
+				stack = stack[:len(stack)-1]
+			}
+
+		case xml.CharData:
+			if skip == 0 && len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("no root element")
+	}
+	return root, nil
+}
+
+// compareNodes compares two elements with the same name and adds their
+// differences.
+func compareNodes(path string, before, after *compareNode, differences *[]Difference) {
+	if before.text != after.text {
+		*differences = append(*differences, Difference{Kind: DiffChanged, Path: path, Before: before.text, After: after.text})
+	}
+
+	names := make([]string, 0, len(before.attrs)+len(after.attrs))
+	for name := range before.attrs {
+		names = append(names, name)
+	}
+	for name := range after.attrs {
+		if _, ok := before.attrs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attrPath := path + "/@" + name
+		beforeValue, inBefore := before.attrs[name]
+		afterValue, inAfter := after.attrs[name]
+		switch {
+		case !inAfter:
+			*differences = append(*differences, Difference{Kind: DiffRemoved, Path: attrPath, Before: beforeValue})
+		case !inBefore:
+			*differences = append(*differences, Difference{Kind: DiffAdded, Path: attrPath, After: afterValue})
+		case beforeValue != afterValue:
+			*differences = append(*differences, Difference{Kind: DiffChanged, Path: attrPath, Before: beforeValue, After: afterValue})
+		}
+	}
+
+	// Children are matched by name and position among those of that name.
+	beforeByName, beforeOrder := groupChildren(before.children)
+	afterByName, afterOrder := groupChildren(after.children)
+	beforeSequence, afterSequence := strings.Join(beforeOrder, ","), strings.Join(afterOrder, ",")
+	if beforeSequence != afterSequence && sameNames(beforeOrder, afterOrder) {
+		*differences = append(*differences, Difference{Kind: DiffReordered, Path: path,
+			Before: beforeSequence, After: afterSequence})
+	}
+
+	order := beforeOrder
+	for _, name := range afterOrder {
+		if _, ok := beforeByName[name]; !ok {
+			order = append(order, name)
+		}
+	}
+	for _, name := range order {
+		beforeChildren, afterChildren := beforeByName[name], afterByName[name]
+		for i := 0; i < len(beforeChildren) || i < len(afterChildren); i++ {
+			childPath := path + "/" + name
+			if len(beforeChildren) > 1 || len(afterChildren) > 1 {
+				childPath += fmt.Sprintf("[%d]", i+1)
+			}
+			switch {
+			case i >= len(afterChildren):
+				*differences = append(*differences, Difference{Kind: DiffRemoved, Path: childPath, Before: beforeChildren[i].text})
+			case i >= len(beforeChildren):
+				*differences = append(*differences, Difference{Kind: DiffAdded, Path: childPath, After: afterChildren[i].text})
+			default:
+				compareNodes(childPath, beforeChildren[i], afterChildren[i], differences)
+			}
+		}
+	}
+}
+
+// groupChildren groups elements by name.
+//
+// RETURNS:
+//   - The elements of each name, in order.
+//   - The names, in the order of their first element.
+func groupChildren(children []*compareNode) (map[string][]*compareNode, []string) {
+	byName := make(map[string][]*compareNode)
+	var order []string
+	for _, child := range children {
+		if _, ok := byName[child.name]; !ok {
+			order = append(order, child.name)
+		}
+		byName[child.name] = append(byName[child.name], child)
+	}
+	return byName, order
+}
+
+// sameNames reports whether two lists of distinct names hold the same names,
+// in any order.
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
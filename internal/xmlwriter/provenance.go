@@ -0,0 +1,194 @@
+// =============================================================================
+// CSV to XML Converter - Value Provenance
+// =============================================================================
+//
+// For audit requests, a document can be generated in traceable mode: each
+// element with a value is traced back to where the value came from.
+//
+//   - csv:      a CSV column of a row, with the transformations applied to
+//               it (transaction-level fields come from the transaction's
+//               first line item)
+//   - static:   a static field of the department configuration
+//   - computed: a cashbook field, a document header field, or a batch
+//               summary, computed for the whole file or batch
+//
+// Elements are identified by path, as in Compare, e.g.
+// "/cashbook/transaction[3]/lineItem[1]/PolicyNumber"; a position is only
+// given among siblings of the same name.
+//
+// =============================================================================
+
+package xmlwriter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Provenance kinds.
+const (
+	ProvenanceCSV      = "csv"
+	ProvenanceStatic   = "static"
+	ProvenanceComputed = "computed"
+)
+
+// Transformation is a transformation applied to a value.
+type Transformation struct {
+	// Action is the transformation, e.g., "prepend_string", or "output"
+	// for the template's output formatting.
+	Action string
+
+	// Before and After are the value before and after the transformation.
+	Before string
+	After  string
+}
+
+// String returns the transformation as `action: "before" -> "after"`.
+func (t Transformation) String() string {
+	return fmt.Sprintf("%s: %q -> %q", t.Action, t.Before, t.After)
+}
+
+// Source is where the value of an element came from.
+type Source struct {
+	// Row is the CSV row number, or 0 if the value is not from a row.
+	Row int
+
+	// Column is the CSV column (Old Header) of a mapped field.
+	Column string
+
+	// Transformations are applied to the value, in order.
+	Transformations []Transformation
+
+	// Static is true for a static field.
+	Static bool
+}
+
+// ProvenanceEntry is the origin of the value of one element.
+type ProvenanceEntry struct {
+	// Path identifies the element.
+	Path string
+
+	// Value is the element's value.
+	Value string
+
+	// Kind is ProvenanceCSV, ProvenanceStatic, or ProvenanceComputed.
+	Kind string
+
+	// Row, Column, and Transformations are as in Source.
+	Row             int
+	Column          string
+	Transformations []Transformation
+}
+
+// Provenance collects the origin of each element of a generated document
+// (see GenerateOptions.Provenance).
+type Provenance struct {
+	// SourceFile is the input file, as written to the CSV.
+	SourceFile string
+
+	// Entries are the elements with a value, in document order.
+	Entries []ProvenanceEntry
+}
+
+// WriteCSV writes the entries as CSV, with the columns element, value,
+// kind, source_file, row, column, and transformations (separated by "; ").
+//
+// RETURNS:
+//   - An error if w fails.
+func (p *Provenance) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"element", "value", "kind", "source_file", "row", "column", "transformations"})
+	for _, entry := range p.Entries {
+		var row, sourceFile string
+		if entry.Row > 0 {
+			row = strconv.Itoa(entry.Row)
+			sourceFile = p.SourceFile
+		}
+		steps := make([]string, len(entry.Transformations))
+		for i, step := range entry.Transformations {
+			steps[i] = step.String()
+		}
+		writer.Write([]string{entry.Path, entry.Value, entry.Kind, sourceFile, row, entry.Column, strings.Join(steps, "; ")})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// record adds the entries of an element and its descendants.
+//
+// PARAMETERS:
+//   - path: The path of the element.
+//   - element: The element.
+func (p *Provenance) record(path string, element XMLElement) {
+	if element.Value != "" || element.Source != nil {
+		entry := ProvenanceEntry{Path: path, Value: element.Value, Kind: ProvenanceComputed}
+		if source := element.Source; source != nil {
+			entry.Row = source.Row
+			entry.Column = source.Column
+			entry.Transformations = source.Transformations
+			switch {
+			case source.Static:
+				entry.Kind = ProvenanceStatic
+			case source.Row > 0:
+				entry.Kind = ProvenanceCSV
+			}
+		}
+		p.Entries = append(p.Entries, entry)
+	}
+
+	count := make(map[string]int, len(element.Children))
+	for _, child := range element.Children {
+		count[child.XMLName.Local]++
+	}
+	position := make(map[string]int, len(count))
+	for _, child := range element.Children {
+		name := child.XMLName.Local
+		childPath := path + "/" + name
+		if count[name] > 1 {
+			position[name]++
+			childPath += fmt.Sprintf("[%d]", position[name])
+		}
+		p.record(childPath, child)
+	}
+}
+
+// fieldSource returns the source of a mapped field's value, or nil if the
+// document is not traced.
+//
+// PARAMETERS:
+//   - options: The generation options.
+//   - lineItem: The line item the value is from, or nil for a computed
+//     value.
+//   - column: The field (Old Header).
+//   - value: The value to be output.
+func fieldSource(options GenerateOptions, lineItem *LineItem, column, value string) *Source {
+	if options.Provenance == nil {
+		return nil
+	}
+
+	source := &Source{Column: column}
+	fieldValue := ""
+	if lineItem != nil {
+		source.Row = lineItem.Row
+		source.Transformations = append(source.Transformations, lineItem.Transformations[column]...)
+		fieldValue = lineItem.Fields[column]
+	} else {
+		fieldValue = options.CashbookValues[column]
+	}
+	if value != fieldValue {
+		source.Transformations = append(source.Transformations, Transformation{Action: "output", Before: fieldValue, After: value})
+	}
+	return source
+}
+
+// staticSource returns the source of a static field's value, or nil if the
+// document is not traced.
+func staticSource(options GenerateOptions) *Source {
+	if options.Provenance == nil {
+		return nil
+	}
+	return &Source{Static: true}
+}
@@ -0,0 +1,228 @@
+// =============================================================================
+// CSV to XML Converter - XML to CSV
+// =============================================================================
+//
+// Flattens an XML document back into CSV with the template it was generated
+// with, so finance can reconcile an uploaded file against the original
+// export in Excel. The document is read as a stream, so large files do not
+// have to fit in memory:
+//
+//   - Every line item becomes a row, with the fields of its transaction and
+//     of the root element repeated on each row. A transaction without line
+//     items becomes one row.
+//   - The columns are the template's Old Headers: root fields first, then
+//     transaction and line item fields, each in template order.
+//   - Fields are matched by XML tag within their parent element, ignoring
+//     namespaces, so vendor-provided documents of the same shape can be read
+//     too. Transactions are found at any depth (e.g., inside batches).
+//   - A repeated element is joined with the field's repeat delimiter, and a
+//     nil element is empty.
+//
+// The values are those of the XML, after transformations: they are not
+// mapped back to the values of the original export.
+//
+// =============================================================================
+
+package xmlwriter
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+)
+
+// FlattenResult describes a flattened document.
+type FlattenResult struct {
+	// Rows is the number of CSV rows written, without the header.
+	Rows int
+
+	// Transactions is the number of transactions read.
+	Transactions int
+
+	// Skipped are the names of elements that are not template fields
+	// (document header, static fields, batch elements), sorted.
+	Skipped []string
+}
+
+// flattenLevel is the field lookup of one level of the document.
+type flattenLevel struct {
+	// element is the name of the level's element.
+	element string
+
+	// fields maps the XML tags of the level's fields, including their
+	// conditional tags, to their mappings.
+	fields map[string]*xlsxparser.FieldMapping
+
+	// values holds the values read for the current element, by Old Header.
+	values map[string][]string
+}
+
+// newFlattenLevel creates the lookup of a level.
+func newFlattenLevel(element string, fields []string, schema *xlsxparser.Schema) *flattenLevel {
+	level := &flattenLevel{
+		element: element,
+		fields:  make(map[string]*xlsxparser.FieldMapping),
+		values:  make(map[string][]string),
+	}
+	for _, field := range fields {
+		if mapping := schema.GetFieldMapping(field); mapping != nil {
+			for _, tag := range mapping.XMLTags() {
+				level.fields[tag] = mapping
+			}
+		}
+	}
+	return level
+}
+
+// Flatten writes an XML document as CSV.
+//
+// PARAMETERS:
+//   - r: The XML document.
+//   - schema: The template the document was generated with.
+//   - w: Receives the CSV, with a header row of the template's Old Headers.
+//
+// RETURNS:
+//   - What was read and written.
+//   - An error if the document is not well-formed XML or the CSV cannot be
+//     written.
+func Flatten(r io.Reader, schema *xlsxparser.Schema, w io.Writer) (FlattenResult, error) {
+	var result FlattenResult
+
+	root := newFlattenLevel(schema.XMLRootElement, schema.CashbookFields, schema)
+	transaction := newFlattenLevel(schema.XMLTransactionElement, schema.TransactionFields, schema)
+	lineItem := newFlattenLevel(schema.XMLLineItemElement, schema.LineItemFields, schema)
+
+	var columns []string
+	for _, fields := range [][]string{schema.CashbookFields, schema.TransactionFields, schema.LineItemFields} {
+		columns = append(columns, getOrderedFields(fields, schema)...)
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(columns); err != nil {
+		return result, fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	writeRow := func() error {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			values := lineItem.values[column]
+			if values == nil {
+				values = transaction.values[column]
+			}
+			if values == nil {
+				values = root.values[column]
+			}
+			delimiter := ";"
+			if mapping := schema.GetFieldMapping(column); mapping != nil && mapping.Repeatable() {
+				delimiter = mapping.RepeatDelimiter
+			}
+			row[i] = strings.Join(values, delimiter)
+		}
+		result.Rows++
+		return out.Write(row)
+	}
+
+	skipped := make(map[string]bool)
+	var stack []string
+	inTransaction, inLineItem := false, false
+	lineItems := 0
+
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read XML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			parent := ""
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+
+			switch {
+			case len(stack) == 0:
+				// The root element.
+			case name == transaction.element && !inTransaction:
+				inTransaction = true
+				transaction.values = make(map[string][]string)
+				lineItems = 0
+				result.Transactions++
+			case name == lineItem.element && inTransaction && !inLineItem:
+				inLineItem = true
+				lineItem.values = make(map[string][]string)
+			default:
+				level := root
+				if inLineItem {
+					level = lineItem
+				} else if inTransaction {
+					level = transaction
+				}
+
+				mapping := level.fields[name]
+				if mapping == nil || parent != level.element {
+					skipped[name] = true
+					break
+				}
+
+				var field struct {
+					Value string `xml:",chardata"`
+				}
+				if err := decoder.DecodeElement(&field, &t); err != nil {
+					return result, fmt.Errorf("failed to read %s: %w", name, err)
+				}
+				if value := strings.TrimSpace(field.Value); value != "" {
+					level.values[mapping.OldHeader] = append(level.values[mapping.OldHeader], value)
+				}
+				// DecodeElement consumed the end tag.
+				continue
+			}
+			stack = append(stack, name)
+
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			name := t.Name.Local
+
+			switch {
+			case inLineItem && name == lineItem.element:
+				inLineItem = false
+				lineItems++
+				if err := writeRow(); err != nil {
+					return result, fmt.Errorf("failed to write CSV: %w", err)
+				}
+				lineItem.values = make(map[string][]string)
+			case inTransaction && !inLineItem && name == transaction.element:
+				inTransaction = false
+				if lineItems == 0 {
+					if err := writeRow(); err != nil {
+						return result, fmt.Errorf("failed to write CSV: %w", err)
+					}
+				}
+				transaction.values = make(map[string][]string)
+			}
+		}
+	}
+
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return result, fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	for name := range skipped {
+		result.Skipped = append(result.Skipped, name)
+	}
+	sort.Strings(result.Skipped)
+	return result, nil
+}
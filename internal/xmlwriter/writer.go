@@ -44,10 +44,15 @@ import (
 	"bytes"
 	"encoding/xml"
 	"fmt"
+	"io"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
 	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
 )
 
@@ -59,15 +64,53 @@ import (
 type Transaction struct {
 	ID        int
 	GroupKey  string
+	BatchKey  string
 	LineItems []LineItem
+
+	// Fields are the transaction-level values of a transaction without
+	// line items, or nil. Otherwise they come from the first line item.
+	Fields map[string]string
+
+	// Schema is the template of this transaction, if it differs from the
+	// document's (see the department's template_selector), or nil.
+	Schema *xlsxparser.Schema
 }
 
 // LineItem represents a single line item within a transaction.
 type LineItem struct {
 	ID     int
 	Fields map[string]string
+
+	// Row is the CSV row number of the line item, and Transformations are
+	// the transformations applied to its fields, by field. They are only
+	// used in traceable mode (see GenerateOptions.Provenance).
+	Row             int
+	Transformations map[string][]Transformation
+}
+
+// Batch holds the summary elements of a batch of transactions.
+type Batch struct {
+	// Key is the batch key shared by the batch's transactions.
+	Key string
+
+	// Fields are the summary elements (key, counts, totals), in order.
+	Fields []config.HeaderField
+}
+
+// FieldLocation identifies a field value of a transaction. A zero
+// LineItemID stands for the transaction element itself (with a Field) or
+// for the whole transaction (without one); an empty Field stands for the
+// line item element.
+type FieldLocation struct {
+	TransactionID int
+	LineItemID    int
+	Field         string
 }
 
+// Annotations are the review comments of field values, by location. Field
+// is the Old Header of a mapped field.
+type Annotations map[FieldLocation][]string
+
 // =============================================================================
 // XML GENERATION OPTIONS
 // =============================================================================
@@ -90,6 +133,11 @@ type GenerateOptions struct {
 	// Default: "UTF-8"
 	Encoding string
 
+	// Comment is written as an XML comment before the root element, e.g.
+	// to record the template version the document was generated with.
+	// Default: none
+	Comment string
+
 	// RootAttributes are additional attributes for the root element.
 	// Example: {"xmlns": "http://example.com/schema"}
 	RootAttributes map[string]string
@@ -100,6 +148,11 @@ type GenerateOptions struct {
 	// Default: true (as per your specification)
 	LineItemNumberingGlobal bool
 
+	// LineItemStart is the number of the first line item with global
+	// numbering, for numbering that continues from a previous file.
+	// Default: 1
+	LineItemStart int
+
 	// TransactionIndexAttribute is the attribute name for transaction index.
 	// Default: "n"
 	TransactionIndexAttribute string
@@ -107,6 +160,52 @@ type GenerateOptions struct {
 	// LineItemIndexAttribute is the attribute name for line item index.
 	// Default: "n"
 	LineItemIndexAttribute string
+
+	// EmitConditions are the department's emit conditions by field (Old
+	// Header), which take precedence over the template's (see
+	// validation.FieldEmitted). A field whose condition the row does not
+	// meet has no element.
+	// Default: none
+	EmitConditions map[string]string
+
+	// Batches are the batches of the document, in order, when the department
+	// groups transactions into batches.
+	// Default: none
+	Batches []Batch
+
+	// CashbookValues are the values of the schema's cashbook-level fields,
+	// by field (Old Header).
+	// Default: none
+	CashbookValues map[string]string
+
+	// Placeholders are the file-level placeholder values for static fields,
+	// by name without braces (e.g., "dept"). See expandStaticValue.
+	// Default: none
+	Placeholders map[string]string
+
+	// DocumentHeader are the document header fields with their placeholders
+	// already expanded. They are placed as the department's document_header
+	// section specifies.
+	// Default: none
+	DocumentHeader []config.HeaderField
+
+	// Annotations are written as XML comments before the elements they
+	// belong to, e.g. <!-- VAL: ... --> for a validation error. A mapped
+	// field with an annotation is included even if it is empty. Only review
+	// documents are annotated; see the converter's review output.
+	// Default: none
+	Annotations Annotations
+
+	// Provenance, if set, collects where the value of each element came
+	// from while the document is generated (see provenance.go).
+	// Default: none
+	Provenance *Provenance
+
+	// TransactionOffsets, if set, receives the byte offset of the end of
+	// each transaction element, e.g., to write the document in durable
+	// steps (see the converter's output checkpoints).
+	// Default: none
+	TransactionOffsets *[]int64
 }
 
 // DefaultGenerateOptions returns the default generation options.
@@ -123,6 +222,57 @@ func DefaultGenerateOptions() GenerateOptions {
 	}
 }
 
+// DepartmentOptions returns the default generation options with a
+// department's xml_output settings applied.
+//
+// PARAMETERS:
+//   - settings: The department's xml_output settings. Unset settings keep
+//     the defaults of DefaultGenerateOptions.
+//
+// RETURNS:
+//   - The generation options. The per-file options (placeholders, document
+//     header, cashbook values, batches) are left for the caller to set.
+func DepartmentOptions(settings config.XMLOutputSettings) GenerateOptions {
+	options := DefaultGenerateOptions()
+
+	switch settings.Indent {
+	case "":
+	case config.IndentNone:
+		options.Indent = ""
+	default:
+		options.Indent = settings.Indent
+	}
+	options.IncludeXMLDeclaration = !settings.OmitDeclaration
+	if settings.XMLVersion != "" {
+		options.XMLVersion = settings.XMLVersion
+	}
+	if settings.Encoding != "" {
+		options.Encoding = settings.Encoding
+	}
+	for name, value := range settings.RootAttributes {
+		options.RootAttributes[name] = value
+	}
+	options.LineItemNumberingGlobal = settings.LineItemNumbering != "per_transaction"
+	if settings.TransactionIndexAttribute != "" {
+		options.TransactionIndexAttribute = settings.TransactionIndexAttribute
+	}
+	if settings.LineItemIndexAttribute != "" {
+		options.LineItemIndexAttribute = settings.LineItemIndexAttribute
+	}
+	options.EmitConditions = settings.EmitConditions
+
+	return options
+}
+
+// firstLineItem returns the number of the first line item with global
+// numbering.
+func (o GenerateOptions) firstLineItem() int {
+	if o.LineItemStart > 0 {
+		return o.LineItemStart
+	}
+	return 1
+}
+
 // =============================================================================
 // XML GENERATION FUNCTIONS
 // =============================================================================
@@ -147,7 +297,7 @@ func DefaultGenerateOptions() GenerateOptions {
 //      c. For each line item:
 //         i. Create the line item element with global index attribute
 //         ii. Add line item-level fields
-//   4. Marshal the XML with proper indentation
+//   4. Write the XML with proper indentation (see GenerateTo)
 func Generate(transactions []Transaction, schema *xlsxparser.Schema, deptConfig *config.DepartmentConfig) ([]byte, error) {
 	return GenerateWithOptions(transactions, schema, deptConfig, DefaultGenerateOptions())
 }
@@ -155,25 +305,248 @@ func Generate(transactions []Transaction, schema *xlsxparser.Schema, deptConfig
 // GenerateWithOptions creates an XML document with custom options.
 func GenerateWithOptions(transactions []Transaction, schema *xlsxparser.Schema, deptConfig *config.DepartmentConfig, options GenerateOptions) ([]byte, error) {
 	var buffer bytes.Buffer
+	if err := GenerateTo(&buffer, transactions, schema, deptConfig, options); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// flushSize is how much GenerateTo buffers before writing to its writer.
+const flushSize = 64 * 1024
+
+// GenerateTo writes an XML document to w while it is built, one transaction
+// at a time, instead of holding the whole document in memory. The output
+// is the same as GenerateWithOptions'.
+//
+// PARAMETERS:
+//   - w: Receives the document, in chunks of about 64 KB (e.g., a file, an
+//     SFTP file, or an HTTP request body).
+//   - transactions: The grouped and transformed transactions.
+//   - schema: The parsed XLSX template schema.
+//   - deptConfig: The department configuration (for static fields).
+//   - options: The generation options.
+//
+// RETURNS:
+//   - An error if w fails. Part of the document may have been written.
+func GenerateTo(w io.Writer, transactions []Transaction, schema *xlsxparser.Schema, deptConfig *config.DepartmentConfig, options GenerateOptions) error {
+	writer := NewDocumentWriter(w, schema, deptConfig, options)
+	writer.Start(transactions)
+	for _, transaction := range transactions {
+		if err := writer.WriteTransaction(transaction); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// DocumentWriter writes an XML document one transaction at a time, for
+// callers that do not have all transactions at once (see the converter's
+// pipeline). GenerateTo is a DocumentWriter given all transactions.
+//
+// USAGE:
+//   writer := NewDocumentWriter(w, schema, deptConfig, options)
+//   writer.Start(first)
+//   for each transaction: writer.WriteTransaction(transaction)
+//   writer.Close()
+type DocumentWriter struct {
+	w          io.Writer
+	schema     *xlsxparser.Schema
+	deptConfig *config.DepartmentConfig
+	options    GenerateOptions
+
+	// buffer holds what is not yet written to w, and written counts the
+	// bytes that are.
+	buffer  bytes.Buffer
+	written int64
+
+	doc                 *XMLDocument
+	globalLineItemIndex int
+
+	// With batch grouping, consecutive transactions with the same batch
+	// key are wrapped in a batch element.
+	batching   bool
+	batch      *XMLElement
+	batchKey   string
+	batchCount int
+
+	// In traceable mode, the written elements are also kept as a tree, to
+	// number siblings of the same name once all are known.
+	trace *XMLElement
+}
+
+// NewDocumentWriter creates a writer of a document to w.
+//
+// PARAMETERS:
+//   - w: Receives the document, in chunks of about 64 KB.
+//   - schema: The parsed XLSX template schema.
+//   - deptConfig: The department configuration (for static fields).
+//   - options: The generation options.
+func NewDocumentWriter(w io.Writer, schema *xlsxparser.Schema, deptConfig *config.DepartmentConfig, options GenerateOptions) *DocumentWriter {
+	return &DocumentWriter{
+		w:                   w,
+		schema:              schema,
+		deptConfig:          deptConfig,
+		options:             options,
+		globalLineItemIndex: options.firstLineItem(),
+		batching:            deptConfig.BatchGrouping.GroupByField != "",
+	}
+}
+
+// Start buffers the XML declaration, the comment, and the root element with
+// the document header and cashbook fields.
+//
+// PARAMETERS:
+//   - transactions: The transactions known when the document starts: all
+//     of them, or at least the first. Cashbook-level static fields take
+//     line item values from the first line item, and the namespace of nil
+//     elements is declared if a transaction's template has a nillable
+//     field.
+func (d *DocumentWriter) Start(transactions []Transaction) {
+	options := d.options
 
 	// Write XML declaration if requested.
 	if options.IncludeXMLDeclaration {
-		buffer.WriteString(fmt.Sprintf("<?xml version=\"%s\" encoding=\"%s\"?>\n",
+		d.buffer.WriteString(fmt.Sprintf("<?xml version=\"%s\" encoding=\"%s\"?>\n",
 			options.XMLVersion, options.Encoding))
 	}
 
-	// Build the XML document.
-	doc := buildDocument(transactions, schema, deptConfig, options)
+	// Write the comment.
+	if options.Comment != "" {
+		writeComment(&d.buffer, options.Comment, options.Indent, 0)
+	}
 
-	// Marshal the document.
-	xmlBytes, err := marshalWithIndent(doc, options.Indent)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal XML: %w", err)
+	// Write the root element with the document header and cashbook fields.
+	d.doc = buildDocument(transactions, d.schema, d.deptConfig, options)
+	writeStartTag(&d.buffer, d.doc.XMLName.Local, d.doc.Attributes, options.Indent, 0)
+	for _, child := range d.doc.Children {
+		switch c := child.(type) {
+		case XMLElement:
+			writeElement(&d.buffer, c, options.Indent, 1)
+		}
 	}
 
-	buffer.Write(xmlBytes)
+	if options.Provenance != nil {
+		d.trace = &XMLElement{XMLName: d.doc.XMLName}
+		for _, child := range d.doc.Children {
+			if c, ok := child.(XMLElement); ok {
+				d.trace.Children = append(d.trace.Children, c)
+			}
+		}
+	}
+}
 
-	return buffer.Bytes(), nil
+// WriteTransaction adds a transaction to the document, and writes the
+// buffered document to w once about 64 KB are buffered.
+//
+// RETURNS:
+//   - An error if w fails. Part of the document may have been written.
+func (d *DocumentWriter) WriteTransaction(transaction Transaction) error {
+	options := d.options
+	level := 1
+	if d.batching {
+		level = 2
+	}
+
+	if d.batching && (d.batch == nil || transaction.BatchKey != d.batchKey) {
+		if d.batch != nil {
+			writeEndTag(&d.buffer, d.batch.XMLName.Local, options.Indent, 1)
+		}
+		d.batchCount++
+		d.batchKey = transaction.BatchKey
+		d.batch = buildBatchElement(d.deptConfig.BatchGrouping, options.Batches, d.batchCount)
+		writeStartTag(&d.buffer, d.batch.XMLName.Local, d.batch.Attributes, options.Indent, 1)
+		for _, child := range d.batch.Children {
+			writeElement(&d.buffer, child, options.Indent, 2)
+		}
+		if d.trace != nil {
+			d.trace.Children = append(d.trace.Children, *d.batch)
+		}
+	}
+
+	transactionElement := buildTransactionElement(
+		transaction,
+		transactionSchema(transaction, d.schema),
+		d.deptConfig,
+		options,
+		&d.globalLineItemIndex,
+	)
+	writeElement(&d.buffer, transactionElement, options.Indent, level)
+	if options.TransactionOffsets != nil {
+		*options.TransactionOffsets = append(*options.TransactionOffsets, d.written+int64(d.buffer.Len()))
+	}
+	if d.trace != nil {
+		parent := d.trace
+		if d.batching {
+			parent = &d.trace.Children[len(d.trace.Children)-1]
+		}
+		parent.Children = append(parent.Children, transactionElement)
+	}
+
+	if d.buffer.Len() >= flushSize {
+		return d.flush()
+	}
+	return nil
+}
+
+// Close ends the document and writes the rest of it to w. It does not
+// close w.
+//
+// RETURNS:
+//   - An error if w fails.
+func (d *DocumentWriter) Close() error {
+	if d.batch != nil {
+		writeEndTag(&d.buffer, d.batch.XMLName.Local, d.options.Indent, 1)
+	}
+	writeEndTag(&d.buffer, d.doc.XMLName.Local, d.options.Indent, 0)
+
+	if d.trace != nil {
+		d.options.Provenance.record("/"+d.trace.XMLName.Local, *d.trace)
+	}
+	return d.flush()
+}
+
+// flush writes the buffered document to w.
+func (d *DocumentWriter) flush() error {
+	if _, err := d.w.Write(d.buffer.Bytes()); err != nil {
+		return fmt.Errorf("failed to write XML: %w", err)
+	}
+	d.written += int64(d.buffer.Len())
+	d.buffer.Reset()
+	return nil
+}
+
+// GenerateTransactions renders each transaction as a standalone XML
+// fragment, numbered exactly as in the document produced by Generate.
+//
+// PARAMETERS:
+//   - transactions: The transactions to render.
+//   - schema: The parsed XLSX schema.
+//   - deptConfig: The department configuration.
+//   - options: The generation options (as used for the whole document).
+//
+// RETURNS:
+//   - One XML fragment per transaction (e.g., "<transaction n="1">...</transaction>").
+//
+// USAGE: Event messages that carry a single transaction.
+func GenerateTransactions(transactions []Transaction, schema *xlsxparser.Schema, deptConfig *config.DepartmentConfig, options GenerateOptions) [][]byte {
+	globalLineItemIndex := options.firstLineItem()
+
+	// A standalone fragment declares the namespace of its nil elements.
+	nillable := hasNillable(schema, transactions)
+
+	fragments := make([][]byte, 0, len(transactions))
+	for _, transaction := range transactions {
+		element := buildTransactionElement(transaction, transactionSchema(transaction, schema), deptConfig, options, &globalLineItemIndex)
+		if nillable {
+			element.Attributes = append(element.Attributes, xml.Attr{Name: xml.Name{Local: xsiAttribute}, Value: xsiNamespace})
+		}
+
+		var buffer bytes.Buffer
+		writeElement(&buffer, element, options.Indent, 0)
+		fragments = append(fragments, buffer.Bytes())
+	}
+
+	return fragments
 }
 
 // =============================================================================
@@ -193,49 +566,183 @@ type XMLElement struct {
 	Attributes []xml.Attr   `xml:",attr"`
 	Value      string       `xml:",chardata"`
 	Children   []XMLElement `xml:",any"`
+
+	// Comments are written before the element (see GenerateOptions.Annotations).
+	Comments []string `xml:"-"`
+
+	// Source is where the element's value came from, in traceable mode
+	// (see GenerateOptions.Provenance).
+	Source *Source `xml:"-"`
 }
 
-// buildDocument constructs the XML document structure.
+// buildDocument constructs the root element with the document header and
+// the cashbook-level fields. GenerateTo writes the transactions after them.
 func buildDocument(transactions []Transaction, schema *xlsxparser.Schema, deptConfig *config.DepartmentConfig, options GenerateOptions) *XMLDocument {
 	doc := &XMLDocument{
 		XMLName: xml.Name{Local: schema.XMLRootElement},
 	}
 
-	// Add root attributes.
-	for key, value := range options.RootAttributes {
+	// Add root attributes, sorted so every document has the same order.
+	names := make([]string, 0, len(options.RootAttributes))
+	for name := range options.RootAttributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
 		doc.Attributes = append(doc.Attributes, xml.Attr{
-			Name:  xml.Name{Local: key},
-			Value: value,
+			Name:  xml.Name{Local: name},
+			Value: options.RootAttributes[name],
 		})
 	}
 
-	// Add cashbook-level static fields.
+	// Nil elements (see mappedOrderedFields) need the XML Schema instance
+	// namespace.
+	if _, ok := options.RootAttributes[xsiAttribute]; !ok && hasNillable(schema, transactions) {
+		doc.Attributes = append(doc.Attributes, xml.Attr{
+			Name:  xml.Name{Local: xsiAttribute},
+			Value: xsiNamespace,
+		})
+	}
+
+	// Add the document header.
+	addDocumentHeader(doc, deptConfig.DocumentHeader, options.DocumentHeader)
+
+	// Add cashbook-level static fields. Line item values come from the
+	// first line item of the file.
+	var firstLineItem *LineItem
+	if len(transactions) > 0 && len(transactions[0].LineItems) > 0 {
+		firstLineItem = &transactions[0].LineItems[0]
+	}
+	var cashbookFields []orderedField
 	for _, staticField := range deptConfig.StaticFields {
 		if strings.ToLower(staticField.ParentTag) == "cashbook" {
-			doc.Children = append(doc.Children, createSimpleElement(staticField.XMLTag, staticField.Value))
+			value := expandStaticValue(staticField.Value, options, nil, firstLineItem)
+			cashbookFields = append(cashbookFields, staticOrderedField(staticField, value, staticSource(options)))
 		}
 	}
 
 	// Add cashbook-level fields from schema.
-	// CUSTOMIZATION: Add any fields that should appear at the cashbook level.
+	for _, oldHeader := range getOrderedFields(schema.CashbookFields, schema) {
+		mapping := schema.GetFieldMapping(oldHeader)
+		if mapping == nil {
+			continue
+		}
 
-	// Add transactions.
-	globalLineItemIndex := 1 // Global counter for line items
+		value := mapping.OutputValue(options.CashbookValues[oldHeader])
+		if value != "" || mapping.RequiredType == "required" {
+			source := fieldSource(options, nil, oldHeader, value)
+			cashbookFields = append(cashbookFields, mappedOrderedFields(mapping, validation.FieldTag(mapping, options.CashbookValues), value, nil, source)...)
+		}
+	}
 
-	for _, transaction := range transactions {
-		transactionElement := buildTransactionElement(
-			transaction,
-			schema,
-			deptConfig,
-			options,
-			&globalLineItemIndex,
-		)
-		doc.Children = append(doc.Children, transactionElement)
+	// Static and mapped fields share the template order.
+	for _, field := range sortFields(cashbookFields) {
+		doc.Children = append(doc.Children, field)
 	}
 
 	return doc
 }
 
+// xsiAttribute declares the XML Schema instance namespace, xsiNamespace,
+// for xsi:nil.
+const (
+	xsiAttribute = "xmlns:xsi"
+	xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// hasNillable reports whether the document's template, or the template of
+// one of its transactions, has a nillable field.
+func hasNillable(schema *xlsxparser.Schema, transactions []Transaction) bool {
+	schemas := []*xlsxparser.Schema{schema}
+	for _, transaction := range transactions {
+		if transaction.Schema != nil && !slices.Contains(schemas, transaction.Schema) {
+			schemas = append(schemas, transaction.Schema)
+		}
+	}
+	for _, schema := range schemas {
+		for _, mapping := range schema.FieldMappings {
+			if mapping.Nillable {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// transactionSchema returns the template of a transaction: its own, or the
+// document's.
+func transactionSchema(transaction Transaction, schema *xlsxparser.Schema) *xlsxparser.Schema {
+	if transaction.Schema != nil {
+		return transaction.Schema
+	}
+	return schema
+}
+
+// buildBatchElement creates an (empty) batch element with its summary
+// elements.
+//
+// PARAMETERS:
+//   - settings: The department's batch grouping settings.
+//   - batches: The batch summaries from the generation options.
+//   - index: The batch number (1-indexed).
+//
+// RETURNS:
+//   - The batch element. Transactions are appended by the caller.
+func buildBatchElement(settings config.BatchGrouping, batches []Batch, index int) *XMLElement {
+	element := &XMLElement{
+		XMLName: xml.Name{Local: settings.Element},
+		Attributes: []xml.Attr{
+			{
+				Name:  xml.Name{Local: settings.IndexAttribute},
+				Value: strconv.Itoa(index),
+			},
+		},
+	}
+
+	if index <= len(batches) {
+		for _, field := range batches[index-1].Fields {
+			element.Children = append(element.Children, createSimpleElement(field.Name, field.Value))
+		}
+	}
+
+	return element
+}
+
+// addDocumentHeader adds the header fields to the cashbook element, as
+// attributes, as child elements, or wrapped in a single header element.
+func addDocumentHeader(doc *XMLDocument, settings config.DocumentHeaderSettings, fields []config.HeaderField) {
+	if len(fields) == 0 {
+		return
+	}
+
+	if settings.RenderAs == "attributes" {
+		for _, field := range fields {
+			doc.Attributes = append(doc.Attributes, xml.Attr{
+				Name:  xml.Name{Local: field.Name},
+				Value: field.Value,
+			})
+		}
+		return
+	}
+
+	elements := make([]XMLElement, len(fields))
+	for i, field := range fields {
+		elements[i] = createSimpleElement(field.Name, field.Value)
+	}
+
+	if settings.Element == "" {
+		for _, element := range elements {
+			doc.Children = append(doc.Children, element)
+		}
+		return
+	}
+
+	doc.Children = append(doc.Children, XMLElement{
+		XMLName:  xml.Name{Local: settings.Element},
+		Children: elements,
+	})
+}
+
 // buildTransactionElement constructs a transaction XML element.
 //
 // PARAMETERS:
@@ -264,53 +771,72 @@ func buildTransactionElement(transaction Transaction, schema *xlsxparser.Schema,
 				Value: fmt.Sprintf("%d", transaction.ID),
 			},
 		},
+		Comments: options.Annotations[FieldLocation{TransactionID: transaction.ID}],
 	}
 
-	// Add transaction-level static fields.
+	// Add transaction-level static fields. Line item values come from the
+	// first line item of the transaction.
+	var firstLineItem *LineItem
+	if len(transaction.LineItems) > 0 {
+		firstLineItem = &transaction.LineItems[0]
+	} else if transaction.Fields != nil {
+		firstLineItem = &LineItem{Fields: transaction.Fields}
+	}
+	var fields []orderedField
 	for _, staticField := range deptConfig.StaticFields {
 		if strings.ToLower(staticField.ParentTag) == "transaction" {
-			element.Children = append(element.Children,
-				createSimpleElement(staticField.XMLTag, staticField.Value))
+			value := expandStaticValue(staticField.Value, options, &transaction, firstLineItem)
+			fields = append(fields, staticOrderedField(staticField, value, staticSource(options)))
 		}
 	}
 
 	// Add transaction-level fields from the first line item.
 	// Transaction-level fields are typically the same across all line items in a transaction.
-	if len(transaction.LineItems) > 0 {
-		firstLineItem := transaction.LineItems[0]
-
+	if firstLineItem != nil {
 		// Get transaction fields in order.
 		transactionFields := getOrderedFields(schema.TransactionFields, schema)
 
 		for _, oldHeader := range transactionFields {
 			mapping := schema.GetFieldMapping(oldHeader)
-			if mapping == nil {
+			if mapping == nil || !validation.FieldEmitted(mapping, options.EmitConditions, firstLineItem.Fields) {
 				continue
 			}
 
-			value := firstLineItem.Fields[oldHeader]
-			if value != "" || mapping.RequiredType == "required" {
-				element.Children = append(element.Children,
-					createSimpleElement(mapping.XMLTag, value))
+			// Transaction-level fields are validated on every line item.
+			value := mapping.OutputValue(firstLineItem.Fields[oldHeader])
+			var comments []string
+			for _, lineItem := range transaction.LineItems {
+				comments = appendUnique(comments, options.Annotations[FieldLocation{transaction.ID, lineItem.ID, oldHeader}]...)
+			}
+			if value != "" || mapping.RequiredType == "required" || len(comments) > 0 {
+				source := fieldSource(options, firstLineItem, oldHeader, value)
+				tag := validation.FieldTag(mapping, firstLineItem.Fields)
+				fields = append(fields, mappedOrderedFields(mapping, tag, value, comments, source)...)
 			}
 		}
 	}
 
-	// Add line items.
+	// Static and mapped fields share the template order.
+	element.Children = append(element.Children, sortFields(fields)...)
+
+	// Add line items. Without global numbering, the line items of each
+	// transaction are numbered from 1.
+	lineItemIndex := globalLineItemIndex
+	if !options.LineItemNumberingGlobal {
+		first := 1
+		lineItemIndex = &first
+	}
 	for _, lineItem := range transaction.LineItems {
 		lineItemElement := buildLineItemElement(
 			lineItem,
+			transaction,
 			schema,
 			deptConfig,
 			options,
-			globalLineItemIndex,
+			*lineItemIndex,
 		)
 		element.Children = append(element.Children, lineItemElement)
-
-		// Increment global counter.
-		if options.LineItemNumberingGlobal {
-			(*globalLineItemIndex)++
-		}
+		(*lineItemIndex)++
 	}
 
 	return element
@@ -320,10 +846,11 @@ func buildTransactionElement(transaction Transaction, schema *xlsxparser.Schema,
 //
 // PARAMETERS:
 //   - lineItem: The line item data.
+//   - transaction: The transaction the line item belongs to.
 //   - schema: The parsed schema.
 //   - deptConfig: The department configuration.
 //   - options: The generation options.
-//   - globalLineItemIndex: Pointer to the global line item counter.
+//   - index: The number of the line item (see LineItemNumberingGlobal).
 //
 // RETURNS:
 //   - The line item element.
@@ -333,12 +860,7 @@ func buildTransactionElement(transaction Transaction, schema *xlsxparser.Schema,
 //     <PolicyNumber>A000123456</PolicyNumber>
 //     <InvoiceNumber>INV-001</InvoiceNumber>
 //   </lineItem>
-func buildLineItemElement(lineItem LineItem, schema *xlsxparser.Schema, deptConfig *config.DepartmentConfig, options GenerateOptions, globalLineItemIndex *int) XMLElement {
-	// Determine the index to use.
-	index := lineItem.ID
-	if options.LineItemNumberingGlobal {
-		index = *globalLineItemIndex
-	}
+func buildLineItemElement(lineItem LineItem, transaction Transaction, schema *xlsxparser.Schema, deptConfig *config.DepartmentConfig, options GenerateOptions, index int) XMLElement {
 
 	element := XMLElement{
 		XMLName: xml.Name{Local: schema.XMLLineItemElement},
@@ -348,13 +870,15 @@ func buildLineItemElement(lineItem LineItem, schema *xlsxparser.Schema, deptConf
 				Value: fmt.Sprintf("%d", index),
 			},
 		},
+		Comments: options.Annotations[FieldLocation{transaction.ID, lineItem.ID, ""}],
 	}
 
 	// Add line item-level static fields.
+	var fields []orderedField
 	for _, staticField := range deptConfig.StaticFields {
 		if strings.ToLower(staticField.ParentTag) == "lineitem" {
-			element.Children = append(element.Children,
-				createSimpleElement(staticField.XMLTag, staticField.Value))
+			value := expandStaticValue(staticField.Value, options, &transaction, &lineItem)
+			fields = append(fields, staticOrderedField(staticField, value, staticSource(options)))
 		}
 	}
 
@@ -363,24 +887,30 @@ func buildLineItemElement(lineItem LineItem, schema *xlsxparser.Schema, deptConf
 
 	for _, oldHeader := range lineItemFields {
 		mapping := schema.GetFieldMapping(oldHeader)
-		if mapping == nil {
+		if mapping == nil || !validation.FieldEmitted(mapping, options.EmitConditions, lineItem.Fields) {
 			continue
 		}
 
-		value := lineItem.Fields[oldHeader]
+		value := mapping.OutputValue(lineItem.Fields[oldHeader])
+		comments := options.Annotations[FieldLocation{transaction.ID, lineItem.ID, oldHeader}]
 
 		// Include the field if:
 		// - It has a value, OR
 		// - It's required (include empty to show validation error), OR
+		// - It is annotated (to show the annotation in place), OR
 		// - We want to include all fields
 		//
 		// CUSTOMIZATION: Modify this logic based on your requirements.
-		if value != "" || mapping.RequiredType == "required" {
-			element.Children = append(element.Children,
-				createSimpleElement(mapping.XMLTag, value))
+		if value != "" || mapping.RequiredType == "required" || len(comments) > 0 {
+			source := fieldSource(options, &lineItem, oldHeader, value)
+			tag := validation.FieldTag(mapping, lineItem.Fields)
+			fields = append(fields, mappedOrderedFields(mapping, tag, value, comments, source)...)
 		}
 	}
 
+	// Static and mapped fields share the template order.
+	element.Children = append(element.Children, sortFields(fields)...)
+
 	return element
 }
 
@@ -388,6 +918,120 @@ func buildLineItemElement(lineItem LineItem, schema *xlsxparser.Schema, deptConf
 // HELPER FUNCTIONS
 // =============================================================================
 
+// orderedField is a static or mapped field element with its position.
+type orderedField struct {
+	// order is the Order of a mapped field (see xlsxparser.FieldMapping),
+	// or the order of a static field.
+	order   int
+	static  bool
+	element XMLElement
+}
+
+// mappedOrderedFields creates the elements of a mapped field: one per value
+// of a repeatable field, or one with the value. A field without values gets
+// one empty element, or a nil element if it is nillable. The comments are
+// written before the first. Each element has the source, which may be nil,
+// and the tag the field has on its row (see validation.FieldTag).
+func mappedOrderedFields(mapping *xlsxparser.FieldMapping, tag, value string, comments []string, source *Source) []orderedField {
+	values := mapping.Values(value)
+	if len(values) == 0 {
+		element := createSimpleElement(tag, "")
+		if mapping.Nillable {
+			element.Attributes = []xml.Attr{{Name: xml.Name{Local: "xsi:nil"}, Value: "true"}}
+		}
+		element.Comments = comments
+		element.Source = source
+		return []orderedField{{order: mapping.Order, element: element}}
+	}
+
+	fields := make([]orderedField, len(values))
+	for i, value := range values {
+		fields[i] = orderedField{order: mapping.Order, element: createSimpleElement(tag, value)}
+		fields[i].element.Source = source
+	}
+	if len(fields) > 0 {
+		fields[0].element.Comments = comments
+	}
+	return fields
+}
+
+// staticOrderedField creates the element of a static field, with the
+// source, which may be nil.
+func staticOrderedField(staticField config.StaticField, value string, source *Source) orderedField {
+	element := createSimpleElement(staticField.XMLTag, value)
+	element.Source = source
+	return orderedField{order: staticField.Order, static: true, element: element}
+}
+
+// sortFields puts static and mapped fields into one sequence by order. A
+// static field follows the mapped field with the same order, so order 0
+// places it before all mapped fields. Fields on the same position keep
+// their configured order.
+func sortFields(fields []orderedField) []XMLElement {
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].order != fields[j].order {
+			return fields[i].order < fields[j].order
+		}
+		return !fields[i].static && fields[j].static
+	})
+
+	elements := make([]XMLElement, len(fields))
+	for i, field := range fields {
+		elements[i] = field.element
+	}
+	return elements
+}
+
+// staticPlaceholder matches "{name}" and "{field:COLUMN}" placeholders.
+var staticPlaceholder = regexp.MustCompile(`\{([a-z_]+)(?::([^{}]+))?\}`)
+
+// expandStaticValue expands the placeholders in a static field value.
+//
+// PARAMETERS:
+//   - value: The configured static field value.
+//   - options: The generation options (file-level placeholder values).
+//   - transaction: The transaction, or nil at the cashbook level.
+//   - lineItem: The line item for {field:COLUMN} values, or nil.
+//
+// RETURNS:
+//   - The expanded value. Unknown placeholders are left unchanged, and a
+//     {field:COLUMN} without a line item or column is empty.
+//
+// PLACEHOLDERS:
+//   - The file-level placeholders in options.Placeholders ({today}, {dept},
+//     {filename}, ...)
+//   - {group_key}, {transaction_index}: The transaction's group key and number
+//   - {field:COLUMN}: The (transformed) value of an input column
+func expandStaticValue(value string, options GenerateOptions, transaction *Transaction, lineItem *LineItem) string {
+	if !strings.Contains(value, "{") {
+		return value
+	}
+
+	return staticPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+		match := staticPlaceholder.FindStringSubmatch(placeholder)
+		name, argument := match[1], match[2]
+
+		switch {
+		case name == "field" && argument != "":
+			if lineItem == nil {
+				return ""
+			}
+			return lineItem.Fields[argument]
+		case argument != "":
+			return placeholder
+		case name == "group_key" && transaction != nil:
+			return transaction.GroupKey
+		case name == "transaction_index" && transaction != nil:
+			return strconv.Itoa(transaction.ID)
+		}
+
+		if replacement, ok := options.Placeholders[name]; ok {
+			return replacement
+		}
+		return placeholder
+	})
+}
+
 // createSimpleElement creates a simple XML element with a text value.
 func createSimpleElement(name, value string) XMLElement {
 	return XMLElement{
@@ -417,40 +1061,37 @@ func getOrderedFields(fields []string, schema *xlsxparser.Schema) []string {
 	return ordered
 }
 
-// marshalWithIndent marshals the document with indentation.
-func marshalWithIndent(doc *XMLDocument, indent string) ([]byte, error) {
-	// Use a custom marshaling approach for better control.
-	var buffer bytes.Buffer
-
-	// Write the root element opening tag.
+// writeStartTag writes the opening tag of an element whose children are
+// written separately, on its own line.
+func writeStartTag(buffer *bytes.Buffer, name string, attributes []xml.Attr, indent string, level int) {
+	for i := 0; i < level; i++ {
+		buffer.WriteString(indent)
+	}
 	buffer.WriteString("<")
-	buffer.WriteString(doc.XMLName.Local)
-
-	// Write root attributes.
-	for _, attr := range doc.Attributes {
+	buffer.WriteString(name)
+	for _, attr := range attributes {
 		buffer.WriteString(fmt.Sprintf(" %s=\"%s\"", attr.Name.Local, escapeXML(attr.Value)))
 	}
-
 	buffer.WriteString(">\n")
+}
 
-	// Write children.
-	for _, child := range doc.Children {
-		switch c := child.(type) {
-		case XMLElement:
-			writeElement(&buffer, c, indent, 1)
-		}
+// writeEndTag writes the closing tag of an element opened with
+// writeStartTag.
+func writeEndTag(buffer *bytes.Buffer, name string, indent string, level int) {
+	for i := 0; i < level; i++ {
+		buffer.WriteString(indent)
 	}
-
-	// Write the root element closing tag.
 	buffer.WriteString("</")
-	buffer.WriteString(doc.XMLName.Local)
+	buffer.WriteString(name)
 	buffer.WriteString(">\n")
-
-	return buffer.Bytes(), nil
 }
 
 // writeElement writes an XML element to the buffer with indentation.
 func writeElement(buffer *bytes.Buffer, element XMLElement, indent string, level int) {
+	for _, comment := range element.Comments {
+		writeComment(buffer, comment, indent, level)
+	}
+
 	// Write indentation.
 	for i := 0; i < level; i++ {
 		buffer.WriteString(indent)
@@ -498,6 +1139,29 @@ func writeElement(buffer *bytes.Buffer, element XMLElement, indent string, level
 	buffer.WriteString(">\n")
 }
 
+// writeComment writes an XML comment on its own line. "--" may not appear
+// inside a comment.
+func writeComment(buffer *bytes.Buffer, comment string, indent string, level int) {
+	for i := 0; i < level; i++ {
+		buffer.WriteString(indent)
+	}
+	comment = strings.ReplaceAll(comment, "--", "- -")
+	if strings.HasSuffix(comment, "-") {
+		comment += " "
+	}
+	buffer.WriteString("<!-- " + comment + " -->\n")
+}
+
+// appendUnique appends the values that are not in list yet.
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
 // escapeXML escapes special characters for XML.
 func escapeXML(s string) string {
 	var buffer bytes.Buffer
@@ -521,141 +1185,3 @@ func escapeXML(s string) string {
 
 	return buffer.String()
 }
-
-// =============================================================================
-// XSD GENERATION (AUTO-GENERATE FROM TEMPLATE)
-// =============================================================================
-
-// GenerateXSD creates an XSD schema from the parsed template.
-//
-// PARAMETERS:
-//   - schema: The parsed XLSX template schema.
-//
-// RETURNS:
-//   - The XSD document as a byte slice.
-//   - An error if generation fails.
-//
-// CUSTOMIZATION:
-//   This function generates a basic XSD. Modify it to add:
-//   - Custom data type restrictions
-//   - Pattern matching for specific formats
-//   - Enumeration values
-//   - Complex type definitions
-func GenerateXSD(schema *xlsxparser.Schema) ([]byte, error) {
-	var buffer bytes.Buffer
-
-	// Write XSD header.
-	buffer.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
-<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
-`)
-
-	// Write root element definition.
-	buffer.WriteString(fmt.Sprintf(`  <xs:element name="%s">
-    <xs:complexType>
-      <xs:sequence>
-        <xs:element ref="%s" minOccurs="0" maxOccurs="unbounded"/>
-      </xs:sequence>
-    </xs:complexType>
-  </xs:element>
-
-`, schema.XMLRootElement, schema.XMLTransactionElement))
-
-	// Write transaction element definition.
-	buffer.WriteString(fmt.Sprintf(`  <xs:element name="%s">
-    <xs:complexType>
-      <xs:sequence>
-`, schema.XMLTransactionElement))
-
-	// Add transaction fields.
-	for _, oldHeader := range schema.TransactionFields {
-		mapping := schema.GetFieldMapping(oldHeader)
-		if mapping != nil {
-			writeXSDElement(&buffer, mapping, 4)
-		}
-	}
-
-	// Add line item reference.
-	buffer.WriteString(fmt.Sprintf(`        <xs:element ref="%s" minOccurs="0" maxOccurs="unbounded"/>
-`, schema.XMLLineItemElement))
-
-	buffer.WriteString(`      </xs:sequence>
-      <xs:attribute name="n" type="xs:positiveInteger" use="required"/>
-    </xs:complexType>
-  </xs:element>
-
-`)
-
-	// Write line item element definition.
-	buffer.WriteString(fmt.Sprintf(`  <xs:element name="%s">
-    <xs:complexType>
-      <xs:sequence>
-`, schema.XMLLineItemElement))
-
-	// Add line item fields.
-	for _, oldHeader := range schema.LineItemFields {
-		mapping := schema.GetFieldMapping(oldHeader)
-		if mapping != nil {
-			writeXSDElement(&buffer, mapping, 4)
-		}
-	}
-
-	buffer.WriteString(`      </xs:sequence>
-      <xs:attribute name="n" type="xs:positiveInteger" use="required"/>
-    </xs:complexType>
-  </xs:element>
-
-</xs:schema>
-`)
-
-	return buffer.Bytes(), nil
-}
-
-// writeXSDElement writes an XSD element definition.
-func writeXSDElement(buffer *bytes.Buffer, mapping *xlsxparser.FieldMapping, indentLevel int) {
-	indent := strings.Repeat("  ", indentLevel)
-
-	// Determine XSD type based on data type.
-	xsdType := getXSDType(mapping.DataType)
-
-	// Determine minOccurs based on required type.
-	minOccurs := "0"
-	if mapping.RequiredType == "required" {
-		minOccurs = "1"
-	}
-
-	// Write element with restrictions if needed.
-	if mapping.MaxLength > 0 && (mapping.DataType == "string" || mapping.DataType == "alphanumeric") {
-		// Element with length restriction.
-		buffer.WriteString(fmt.Sprintf(`%s<xs:element name="%s" minOccurs="%s">
-%s  <xs:simpleType>
-%s    <xs:restriction base="%s">
-%s      <xs:maxLength value="%d"/>
-%s    </xs:restriction>
-%s  </xs:simpleType>
-%s</xs:element>
-`, indent, mapping.XMLTag, minOccurs,
-			indent, indent, xsdType,
-			indent, mapping.MaxLength,
-			indent, indent, indent))
-	} else {
-		// Simple element.
-		buffer.WriteString(fmt.Sprintf(`%s<xs:element name="%s" type="%s" minOccurs="%s"/>
-`, indent, mapping.XMLTag, xsdType, minOccurs))
-	}
-}
-
-// getXSDType maps internal data types to XSD types.
-func getXSDType(dataType string) string {
-	switch dataType {
-	case "numeric":
-		return "xs:integer"
-	case "decimal":
-		return "xs:decimal"
-	case "boolean":
-		return "xs:boolean"
-	case "date":
-		return "xs:date"
-	default:
-		return "xs:string"
-	}
-}
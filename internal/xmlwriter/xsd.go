@@ -0,0 +1,537 @@
+// =============================================================================
+// CSV to XML Converter - XSD Generation
+// =============================================================================
+//
+// GenerateXSD describes the documents a template produces as an XML Schema,
+// for the target system's team or for validating output with standard
+// tools. The structure is the department's layout of the template: the
+// template's fields with the static fields among them, the document header,
+// and the batch elements. Each field element carries the facets the
+// converter itself checks or guarantees:
+//
+//   | Template                   | XSD                                   |
+//   |----------------------------|---------------------------------------|
+//   | Required Type, Emit If     | minOccurs                             |
+//   | Repeat                     | maxOccurs="unbounded"                 |
+//   | Default / Fixed / Nillable | default / fixed / nillable            |
+//   | Max Length (text)          | maxLength                             |
+//   | Max Length (numbers)       | totalDigits                           |
+//   | decimal(2)                 | xs:decimal with fractionDigits        |
+//   | date(01/02/2006)           | xs:string with a pattern (xs:date for |
+//   |                            | 2006-01-02)                           |
+//   | Pattern                    | pattern                               |
+//   | lookup_with_default rule   | enumeration of the lookup's values    |
+//
+// =============================================================================
+
+package xmlwriter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+)
+
+// GenerateXSD creates an XSD schema from the parsed template.
+//
+// PARAMETERS:
+//   - schema: The parsed XLSX template schema.
+//   - deptConfigs: The departments using the template, for enumerations
+//     (see xsdEnumeration). Optional. The first lays out the document: its
+//     static fields, document header, batches, root attributes, and index
+//     attribute names (see config.XMLOutputSettings).
+//
+// RETURNS:
+//   - The XSD document as a byte slice.
+//   - An error if generation fails.
+//
+// CUSTOMIZATION:
+//   - Add facets for additional data types in xsdRestriction.
+//   - Add complex type definitions here.
+func GenerateXSD(schema *xlsxparser.Schema, deptConfigs ...*config.DepartmentConfig) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	// The first department lays out the document.
+	options := DefaultGenerateOptions()
+	deptConfig := &config.DepartmentConfig{}
+	if len(deptConfigs) > 0 && deptConfigs[0] != nil {
+		deptConfig = deptConfigs[0]
+		options = DepartmentOptions(deptConfig.XMLOutput)
+	}
+	header := deptConfig.DocumentHeader
+	if !header.Enabled {
+		header.Fields = nil
+	}
+	batching := deptConfig.BatchGrouping.GroupByField != ""
+
+	// Write XSD header. A default namespace of the root element is the
+	// namespace of all elements.
+	buffer.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+`)
+	if namespace := options.RootAttributes["xmlns"]; namespace != "" {
+		buffer.WriteString(fmt.Sprintf(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns="%s" targetNamespace="%s" elementFormDefault="qualified">
+`, escapeXML(namespace), escapeXML(namespace)))
+	} else {
+		buffer.WriteString(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+`)
+	}
+
+	// Write root element definition.
+	buffer.WriteString(fmt.Sprintf(`  <xs:element name="%s">
+    <xs:complexType>
+      <xs:sequence>
+`, schema.XMLRootElement))
+
+	// Add the document header and the cashbook fields.
+	if header.RenderAs != "attributes" {
+		writeXSDDocumentHeader(&buffer, header, 4)
+	}
+	writeXSDFields(&buffer, schema, schema.CashbookFields, deptConfig.StaticFields, "cashbook", options, deptConfigs, 4)
+
+	// Transactions are wrapped in batches with batch grouping.
+	child := schema.XMLTransactionElement
+	if batching {
+		child = deptConfig.BatchGrouping.Element
+	}
+	buffer.WriteString(fmt.Sprintf(`        <xs:element ref="%s" minOccurs="0" maxOccurs="unbounded"/>
+      </xs:sequence>
+`, child))
+
+	// Add the root attributes and header attributes. Namespace declarations
+	// and attributes of other namespaces (e.g., xsi:schemaLocation) are not
+	// declared in the schema.
+	var attributes []string
+	for name := range options.RootAttributes {
+		if name != "xmlns" && !strings.Contains(name, ":") {
+			attributes = append(attributes, name)
+		}
+	}
+	sort.Strings(attributes)
+	if header.RenderAs == "attributes" {
+		for _, field := range header.Fields {
+			attributes = append(attributes, field.Name)
+		}
+	}
+	for _, name := range attributes {
+		buffer.WriteString(fmt.Sprintf(`      <xs:attribute name="%s" type="xs:string" use="required"/>
+`, name))
+	}
+
+	buffer.WriteString(`    </xs:complexType>
+  </xs:element>
+
+`)
+
+	// Write batch element definition.
+	if batching {
+		writeXSDBatch(&buffer, deptConfig.BatchGrouping, schema.XMLTransactionElement)
+	}
+
+	// Write transaction element definition.
+	buffer.WriteString(fmt.Sprintf(`  <xs:element name="%s">
+    <xs:complexType>
+      <xs:sequence>
+`, schema.XMLTransactionElement))
+
+	// Add transaction fields.
+	writeXSDFields(&buffer, schema, schema.TransactionFields, deptConfig.StaticFields, "transaction", options, deptConfigs, 4)
+
+	// Add line item reference.
+	buffer.WriteString(fmt.Sprintf(`        <xs:element ref="%s" minOccurs="0" maxOccurs="unbounded"/>
+`, schema.XMLLineItemElement))
+
+	buffer.WriteString(fmt.Sprintf(`      </xs:sequence>
+      <xs:attribute name="%s" type="xs:positiveInteger" use="required"/>
+    </xs:complexType>
+  </xs:element>
+
+`, options.TransactionIndexAttribute))
+
+	// Write line item element definition.
+	buffer.WriteString(fmt.Sprintf(`  <xs:element name="%s">
+    <xs:complexType>
+      <xs:sequence>
+`, schema.XMLLineItemElement))
+
+	// Add line item fields.
+	writeXSDFields(&buffer, schema, schema.LineItemFields, deptConfig.StaticFields, "lineitem", options, deptConfigs, 4)
+
+	buffer.WriteString(fmt.Sprintf(`      </xs:sequence>
+      <xs:attribute name="%s" type="xs:positiveInteger" use="required"/>
+    </xs:complexType>
+  </xs:element>
+
+</xs:schema>
+`, options.LineItemIndexAttribute))
+
+	return buffer.Bytes(), nil
+}
+
+// xsdOrderedField is the definition of a static or mapped field element
+// with its position (see orderedField).
+type xsdOrderedField struct {
+	order      int
+	static     bool
+	definition string
+}
+
+// writeXSDFields writes the field elements of a parent element: its mapped
+// fields and the department's static fields, in the order the writer puts
+// them (see sortFields).
+//
+// PARAMETERS:
+//   - buffer: Receives the definitions.
+//   - schema: The parsed XLSX template schema.
+//   - fields: The parent's mapped fields (Old Headers).
+//   - staticFields: The department's static fields.
+//   - parent: The parent of the fields, as in a static field's parent_tag,
+//     lowercased ("cashbook", "transaction", or "lineitem").
+//   - options: The department's generation options (emit conditions).
+//   - deptConfigs: The departments using the template, for enumerations.
+//   - indentLevel: The indentation level of the elements.
+func writeXSDFields(buffer *bytes.Buffer, schema *xlsxparser.Schema, fields []string, staticFields []config.StaticField, parent string, options GenerateOptions, deptConfigs []*config.DepartmentConfig, indentLevel int) {
+	var definitions []xsdOrderedField
+
+	for _, oldHeader := range getOrderedFields(fields, schema) {
+		mapping := schema.GetFieldMapping(oldHeader)
+		if mapping == nil {
+			continue
+		}
+		var definition bytes.Buffer
+		writeXSDElement(&definition, withEmitCondition(mapping, options), xsdEnumeration(deptConfigs, oldHeader), indentLevel)
+		definitions = append(definitions, xsdOrderedField{order: mapping.Order, definition: definition.String()})
+	}
+
+	// A static field is always written. A value without placeholders is
+	// the only value it can have.
+	indent := strings.Repeat("  ", indentLevel)
+	for _, staticField := range staticFields {
+		if strings.ToLower(staticField.ParentTag) != parent {
+			continue
+		}
+		fixed := ""
+		if !strings.Contains(staticField.Value, "{") {
+			fixed = fmt.Sprintf(` fixed="%s"`, escapeXML(staticField.Value))
+		}
+		definition := fmt.Sprintf("%s<xs:element name=\"%s\" type=\"xs:string\"%s/>\n", indent, staticField.XMLTag, fixed)
+		definitions = append(definitions, xsdOrderedField{order: staticField.Order, static: true, definition: definition})
+	}
+
+	sort.SliceStable(definitions, func(i, j int) bool {
+		if definitions[i].order != definitions[j].order {
+			return definitions[i].order < definitions[j].order
+		}
+		return !definitions[i].static && definitions[j].static
+	})
+	for _, definition := range definitions {
+		buffer.WriteString(definition.definition)
+	}
+}
+
+// writeXSDDocumentHeader writes the elements of a document header rendered
+// as elements: the fields, or the element wrapping them (see
+// addDocumentHeader). A header without fields writes nothing.
+func writeXSDDocumentHeader(buffer *bytes.Buffer, header config.DocumentHeaderSettings, indentLevel int) {
+	if len(header.Fields) == 0 {
+		return
+	}
+
+	indent := strings.Repeat("  ", indentLevel)
+	if header.Element != "" {
+		buffer.WriteString(fmt.Sprintf("%s<xs:element name=\"%s\">\n", indent, header.Element))
+		buffer.WriteString(indent + "  <xs:complexType>\n")
+		buffer.WriteString(indent + "    <xs:sequence>\n")
+		indent += "      "
+	}
+	for _, field := range header.Fields {
+		buffer.WriteString(fmt.Sprintf("%s<xs:element name=\"%s\" type=\"xs:string\"/>\n", indent, field.Name))
+	}
+	if header.Element != "" {
+		indent = strings.TrimSuffix(indent, "      ")
+		buffer.WriteString(indent + "    </xs:sequence>\n")
+		buffer.WriteString(indent + "  </xs:complexType>\n")
+		buffer.WriteString(indent + "</xs:element>\n")
+	}
+}
+
+// writeXSDBatch writes the definition of the batch element: its summary
+// elements, in the order of the converter's batch summaries, and its
+// transactions.
+func writeXSDBatch(buffer *bytes.Buffer, settings config.BatchGrouping, transactionElement string) {
+	buffer.WriteString(fmt.Sprintf(`  <xs:element name="%s">
+    <xs:complexType>
+      <xs:sequence>
+`, settings.Element))
+
+	summary := []struct{ name, xsdType string }{
+		{settings.KeyElement, "xs:string"},
+		{settings.CountElement, "xs:positiveInteger"},
+		{settings.LineItemCountElement, "xs:nonNegativeInteger"},
+	}
+	for _, total := range settings.Totals {
+		summary = append(summary, struct{ name, xsdType string }{total.XMLTag, "xs:decimal"})
+	}
+	for _, element := range summary {
+		if element.name != "" {
+			buffer.WriteString(fmt.Sprintf("        <xs:element name=\"%s\" type=\"%s\"/>\n", element.name, element.xsdType))
+		}
+	}
+
+	buffer.WriteString(fmt.Sprintf(`        <xs:element ref="%s" maxOccurs="unbounded"/>
+      </xs:sequence>
+      <xs:attribute name="%s" type="xs:positiveInteger" use="required"/>
+    </xs:complexType>
+  </xs:element>
+
+`, transactionElement, settings.IndexAttribute))
+}
+
+// withEmitCondition returns the field with the department's emit condition,
+// if it has one (see GenerateOptions.EmitConditions).
+func withEmitCondition(mapping *xlsxparser.FieldMapping, options GenerateOptions) *xlsxparser.FieldMapping {
+	condition, ok := options.EmitConditions[mapping.OldHeader]
+	if !ok {
+		return mapping
+	}
+	copied := *mapping
+	copied.EmitCondition = condition
+	return &copied
+}
+
+// writeXSDElement writes an XSD element definition.
+//
+// PARAMETERS:
+//   - buffer: Receives the definition.
+//   - mapping: The field.
+//   - enumeration: The only values the field can have, or nil.
+//   - indentLevel: The indentation level of the element.
+func writeXSDElement(buffer *bytes.Buffer, mapping *xlsxparser.FieldMapping, enumeration []string, indentLevel int) {
+	indent := strings.Repeat("  ", indentLevel)
+
+	// Determine minOccurs based on required type. An element with an emit
+	// condition is missing from the rows that do not meet it.
+	minOccurs := "0"
+	if mapping.RequiredType == "required" && mapping.EmitCondition == "" {
+		minOccurs = "1"
+	}
+	occurs := fmt.Sprintf(` minOccurs="%s"`, minOccurs)
+	if mapping.Repeatable() {
+		occurs += ` maxOccurs="unbounded"`
+	}
+	attributes := ""
+	if mapping.Nillable {
+		attributes += ` nillable="true"`
+	}
+	if mapping.FixedValue != "" {
+		attributes += fmt.Sprintf(` fixed="%s"`, escapeXML(mapping.FixedValue))
+	} else if mapping.DefaultValue != "" {
+		attributes += fmt.Sprintf(` default="%s"`, escapeXML(mapping.DefaultValue))
+	}
+
+	xsdType, facets := xsdRestriction(mapping, enumeration)
+
+	if len(mapping.ConditionalTags) == 0 {
+		writeXSDSimpleElement(buffer, mapping.XMLTag, xsdType, facets, occurs+attributes, indent)
+		return
+	}
+
+	// A field with conditional tags is one of its elements; the choice
+	// takes the occurrences.
+	buffer.WriteString(fmt.Sprintf("%s<xs:choice%s>\n", indent, occurs))
+	for _, tag := range mapping.XMLTags() {
+		writeXSDSimpleElement(buffer, tag, xsdType, facets, attributes, indent+"  ")
+	}
+	buffer.WriteString(indent + "</xs:choice>\n")
+}
+
+// writeXSDSimpleElement writes an element of a simple type: the base type,
+// restricted by the facets if there are any.
+func writeXSDSimpleElement(buffer *bytes.Buffer, name, xsdType string, facets []string, attributes, indent string) {
+	if len(facets) == 0 {
+		buffer.WriteString(fmt.Sprintf("%s<xs:element name=\"%s\" type=\"%s\"%s/>\n",
+			indent, name, xsdType, attributes))
+		return
+	}
+
+	// Element with restrictions.
+	buffer.WriteString(fmt.Sprintf("%s<xs:element name=\"%s\"%s>\n", indent, name, attributes))
+	buffer.WriteString(indent + "  <xs:simpleType>\n")
+	buffer.WriteString(fmt.Sprintf("%s    <xs:restriction base=\"%s\">\n", indent, xsdType))
+	for _, facet := range facets {
+		buffer.WriteString(fmt.Sprintf("%s      %s\n", indent, facet))
+	}
+	buffer.WriteString(indent + "    </xs:restriction>\n")
+	buffer.WriteString(indent + "  </xs:simpleType>\n")
+	buffer.WriteString(indent + "</xs:element>\n")
+}
+
+// xsdRestriction returns the XSD base type of a field and the facets that
+// restrict it (e.g., `<xs:maxLength value="10"/>`).
+func xsdRestriction(mapping *xlsxparser.FieldMapping, enumeration []string) (string, []string) {
+	xsdType := getXSDType(mapping.DataType)
+	var facets []string
+	pattern := mapping.Pattern
+
+	switch {
+	case strings.HasPrefix(mapping.DataType, "decimal"):
+		// The max length counts the decimal point.
+		fractionDigits, hasFraction := dataTypeParameter(mapping.DataType)
+		totalDigits := mapping.MaxLength
+		if hasFraction && fractionDigits > 0 && totalDigits > 0 {
+			totalDigits--
+		}
+		if totalDigits > 0 {
+			facets = append(facets, fmt.Sprintf(`<xs:totalDigits value="%d"/>`, totalDigits))
+		}
+		if hasFraction {
+			facets = append(facets, fmt.Sprintf(`<xs:fractionDigits value="%d"/>`, fractionDigits))
+		}
+
+	case mapping.DataType == "numeric":
+		if mapping.MaxLength > 0 {
+			facets = append(facets, fmt.Sprintf(`<xs:totalDigits value="%d"/>`, mapping.MaxLength))
+		}
+
+	case strings.HasPrefix(mapping.DataType, "date"):
+		// A date in a layout other than xs:date's is a string of that shape.
+		if layout := extractParentheses(mapping.DataType); layout != "" && layout != "2006-01-02" {
+			xsdType = "xs:string"
+			if pattern == "" {
+				pattern = datePattern(layout)
+			}
+		}
+
+	case mapping.DataType == "currency_code" || strings.HasPrefix(mapping.DataType, "country_code"):
+		if pattern == "" {
+			pattern = codePattern(mapping.DataType)
+		}
+
+	case mapping.DataType != "boolean" && mapping.MaxLength > 0:
+		facets = append(facets, fmt.Sprintf(`<xs:maxLength value="%d"/>`, mapping.MaxLength))
+	}
+
+	// Only one pattern: several pattern facets would match either one.
+	if pattern != "" {
+		facets = append(facets, fmt.Sprintf(`<xs:pattern value="%s"/>`, escapeXML(pattern)))
+	}
+	for _, value := range enumeration {
+		facets = append(facets, fmt.Sprintf(`<xs:enumeration value="%s"/>`, escapeXML(value)))
+	}
+
+	return xsdType, facets
+}
+
+// codePattern returns the shape of the codes of an ISO code data type. The
+// XSD does not list the codes; the converter checks them.
+func codePattern(dataType string) string {
+	if dataType == "country_code" || extractParentheses(dataType) == "alpha2" {
+		return "[A-Z]{2}"
+	}
+	return "[A-Z]{3}"
+}
+
+// getXSDType maps internal data types to XSD types.
+func getXSDType(dataType string) string {
+	switch {
+	case dataType == "numeric":
+		return "xs:integer"
+	case strings.HasPrefix(dataType, "decimal"):
+		return "xs:decimal"
+	case dataType == "boolean":
+		return "xs:boolean"
+	case strings.HasPrefix(dataType, "date"):
+		return "xs:date"
+	default:
+		return "xs:string"
+	}
+}
+
+// dataTypeParameter returns the number in a data type such as
+// "decimal(2)", and whether there is one.
+func dataTypeParameter(dataType string) (int, bool) {
+	n, err := strconv.Atoi(extractParentheses(dataType))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// extractParentheses returns the text between the parentheses of a data
+// type such as "date(01/02/2006)", or "".
+func extractParentheses(dataType string) string {
+	start := strings.Index(dataType, "(")
+	end := strings.LastIndex(dataType, ")")
+	if start < 0 || end <= start {
+		return ""
+	}
+	return strings.TrimSpace(dataType[start+1 : end])
+}
+
+// datePattern returns an XSD pattern for dates in a Go layout of digits and
+// separators, e.g. `\d\d/\d\d/\d\d\d\d` for "01/02/2006". It returns ""
+// for layouts with month or day names.
+func datePattern(layout string) string {
+	var pattern strings.Builder
+	for _, r := range layout {
+		switch {
+		case r >= '0' && r <= '9':
+			pattern.WriteString(`\d`)
+		case strings.ContainsRune(`\|.?*+(){}-[]^`, r):
+			pattern.WriteRune('\\')
+			pattern.WriteRune(r)
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			return ""
+		default:
+			pattern.WriteRune(r)
+		}
+	}
+	return pattern.String()
+}
+
+// xsdEnumeration returns the values a field can only have after the
+// transformation rules of the departments: the values of its
+// lookup_with_default table and the default, when that is the field's last
+// transformation in every department.
+//
+// RETURNS:
+//   - The values, sorted, or nil if a department can produce other values
+//     (or there are no departments).
+func xsdEnumeration(deptConfigs []*config.DepartmentConfig, field string) []string {
+	if len(deptConfigs) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for _, deptConfig := range deptConfigs {
+		var last *config.TransformationAction
+		for i := range deptConfig.TransformationRules {
+			rule := &deptConfig.TransformationRules[i]
+			if rule.Field == field && len(rule.Actions) > 0 {
+				last = &rule.Actions[len(rule.Actions)-1]
+			}
+		}
+		if last == nil || last.Type != "lookup_with_default" {
+			return nil
+		}
+
+		for _, value := range last.LookupTable {
+			seen[value] = true
+		}
+		seen[last.Value] = true
+	}
+
+	values := make([]string, 0, len(seen))
+	for value := range seen {
+		// An empty value is not written.
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,277 @@
+// =============================================================================
+// CSV to XML Converter - Library API
+// =============================================================================
+//
+// This package lets other programs embed the conversion pipeline instead of
+// running the command line tool. It works on streams: the caller supplies
+// the CSV data, the template, and the department configuration, and
+// receives the XML document. The file handling of the command line tool
+// (input discovery, locking, archiving, PGP, delivery, and events) is not
+// part of it.
+//
+// USAGE:
+//
+//	schema, err := convert.LoadSchema(templateFile)
+//	department, err := convert.LoadDepartment(configFile)
+//
+//	result, err := convert.Convert(csvFile, xmlFile, schema, convert.Options{
+//	    Department: department,
+//	    FileName:   "claims_payments_20240131.csv",
+//	})
+//
+// A Processor converts the files of an input directory instead, the way
+// "csv2xml process" does, and returns each file's result as it finishes:
+//
+//	processor, err := convert.NewProcessor("config/app_config.yaml", nil)
+//	results, err := processor.Results(ctx, convert.ProcessOptions{})
+//	for result := range results {
+//	    // Report the file...
+//	}
+//
+// The API is stable: fields and functions are only added, never changed or
+// removed.
+//
+// =============================================================================
+
+package convert
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/config"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/converter"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/validation"
+	"github.com/ginjaninja78/CSV-to-XML-conversion/internal/xlsxparser"
+)
+
+// =============================================================================
+// TYPES
+// =============================================================================
+
+// Schema is a parsed XLSX template.
+type Schema = xlsxparser.Schema
+
+// Department is a department configuration, as in a department YAML file.
+type Department = config.DepartmentConfig
+
+// Result is the outcome of a conversion or validation: statistics and the
+// detailed validation result.
+type Result = converter.Result
+
+// ValidationResult is the detailed validation result, including
+// suppressed errors and duplicate rows.
+type ValidationResult = validation.ValidationResult
+
+// Logger receives the converter's progress messages.
+type Logger = converter.Logger
+
+// Processor converts the files of an input directory (see NewProcessor).
+type Processor = converter.Processor
+
+// ProcessOptions defines which files a Processor converts, and how.
+type ProcessOptions = converter.ProcessOptions
+
+// ErrStopping is the error of a file that was not started because the
+// context passed to Processor.Results was canceled.
+var ErrStopping = converter.ErrStopping
+
+// Options controls a conversion.
+type Options struct {
+	// Department is the department configuration. Required.
+	Department *Department
+
+	// FileName is the name of the input, used for the {filename} and
+	// {original} placeholders and in messages.
+	// Default: "input.csv"
+	FileName string
+
+	// ContinueOnError generates the XML despite validation errors, unless
+	// the department's failure_policy.on_validation_error says otherwise.
+	// Default: false
+	ContinueOnError bool
+
+	// StateDir is the directory for {sequence} numbers.
+	// Default: "./state"
+	StateDir string
+
+	// Logger receives progress messages.
+	// Default: none
+	Logger Logger
+}
+
+// =============================================================================
+// LOADING
+// =============================================================================
+
+// LoadSchema parses an XLSX template.
+//
+// PARAMETERS:
+//   - r: The XLSX template data.
+//
+// RETURNS:
+//   - The parsed schema.
+//   - An error if the template cannot be read or parsed.
+func LoadSchema(r io.Reader) (*Schema, error) {
+	return xlsxparser.ParseReader(r, "")
+}
+
+// LoadDepartment parses a department configuration and applies the
+// defaults.
+//
+// PARAMETERS:
+//   - r: The department configuration YAML.
+//
+// RETURNS:
+//   - The department configuration.
+//   - An error if the YAML cannot be read or the configuration is invalid.
+func LoadDepartment(r io.Reader) (*Department, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read department configuration: %w", err)
+	}
+	return config.ParseDepartmentConfig(data)
+}
+
+// =============================================================================
+// CONVERSION
+// =============================================================================
+
+// Convert converts CSV data to an XML document.
+//
+// PARAMETERS:
+//   - input: The CSV data, in the department's CSV format.
+//   - output: Receives the XML document while it is generated, so large
+//     documents are not held in memory. Nothing is written if the data
+//     fails to convert; an output that fails may be left with part of it.
+//   - schema: The parsed template (see LoadSchema).
+//   - options: The conversion options.
+//
+// RETURNS:
+//   - The result, also when the conversion fails.
+//   - An error if no XML was written. Validation errors are an error
+//     unless ContinueOnError is set; they are listed in Result.Validation.
+func Convert(input io.Reader, output io.Writer, schema *Schema, options Options) (Result, error) {
+	c, err := newConverter(options)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := c.ConvertStream(input, output, schema)
+	return result, result.Error
+}
+
+// ValidateOnly transforms and validates CSV data without generating XML.
+//
+// PARAMETERS:
+//   - input: The CSV data, in the department's CSV format.
+//   - schema: The parsed template (see LoadSchema).
+//   - options: The conversion options. ContinueOnError is ignored.
+//
+// RETURNS:
+//   - The result. Result.Validation lists the validation errors.
+//   - An error if the data is invalid or cannot be read.
+func ValidateOnly(input io.Reader, schema *Schema, options Options) (Result, error) {
+	c, err := newConverter(options)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := c.ValidateStream(input, schema)
+	return result, result.Error
+}
+
+// =============================================================================
+// DIRECTORY PROCESSING
+// =============================================================================
+
+// NewProcessor creates a processor of the input directory of a main
+// configuration file. Unlike Convert, it handles files like the command
+// line tool: input discovery, department matching, archiving, and
+// delivery.
+//
+// PARAMETERS:
+//   - configPath: The main configuration file (e.g., app_config.yaml). Its
+//     configs_dir holds the department configurations.
+//   - logger: Receives progress messages, or nil for none.
+//
+// RETURNS:
+//   - The processor. Processor.Results returns the result of each file as
+//     it finishes.
+//   - An error if a configuration cannot be loaded.
+func NewProcessor(configPath string, logger Logger) (*Processor, error) {
+	mainConfig, err := config.LoadMainConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load main config: %w", err)
+	}
+
+	deptConfigs, err := config.LoadDepartmentConfigs(mainConfig.ConfigsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load department configs: %w", err)
+	}
+
+	p := converter.NewProcessor(deptConfigs, mainConfig)
+	if logger == nil {
+		logger = discardLogger{}
+	}
+	p.SetLogger(logger)
+	return p, nil
+}
+
+// ProcessDirectory converts the files of the input directory of a main
+// configuration file and returns their results as they finish.
+//
+// PARAMETERS:
+//   - ctx: Canceled to stop starting files. Files not started by then get
+//     a skipped result with ErrStopping.
+//   - configPath: The main configuration file (see NewProcessor).
+//   - logger: Receives progress messages, or nil for none.
+//
+// RETURNS:
+//   - A channel that receives one result per file and is closed when all
+//     files are done.
+//   - An error if a configuration or the input directory cannot be read.
+func ProcessDirectory(ctx context.Context, configPath string, logger Logger) (<-chan Result, error) {
+	p, err := NewProcessor(configPath, logger)
+	if err != nil {
+		return nil, err
+	}
+	return p.Results(ctx, ProcessOptions{})
+}
+
+// newConverter creates an internal converter for the options.
+func newConverter(options Options) (*converter.Converter, error) {
+	if options.Department == nil {
+		return nil, fmt.Errorf("options.Department is required")
+	}
+
+	fileName := options.FileName
+	if fileName == "" {
+		fileName = "input.csv"
+	}
+
+	mainConfig := config.DefaultMainConfig()
+	mainConfig.ContinueOnError = options.ContinueOnError
+	if options.StateDir != "" {
+		mainConfig.StateDir = options.StateDir
+	}
+
+	c := converter.New(fileName, options.Department, mainConfig)
+	logger := options.Logger
+	if logger == nil {
+		logger = discardLogger{}
+	}
+	c.SetLogger(logger)
+
+	return c, nil
+}
+
+// discardLogger is the default logger: embedding programs do not want the
+// converter's messages on stdout.
+type discardLogger struct{}
+
+func (discardLogger) Debug(msg string, args ...interface{}) {}
+func (discardLogger) Info(msg string, args ...interface{})  {}
+func (discardLogger) Warn(msg string, args ...interface{})  {}
+func (discardLogger) Error(msg string, args ...interface{}) {}
@@ -7,11 +7,14 @@
 //   - File archival (moving processed files)
 //   - Error log generation
 //   - Directory management
-//   - File naming utilities
+//   - File naming utilities, including file names that are valid and short
+//     enough on Windows hosts
 //
 // ARCHIVAL STRATEGY:
 //   - Input files are moved to input_archive after successful processing
 //   - Output files are copied to output_archive for long-term storage
+//   - Moves across devices/shares are done as copy + verify + delete, and
+//     transient network errors are retried (see fileops.go)
 //   - Failed files remain in their original location
 //   - Error logs are created in the output directory
 //
@@ -26,12 +29,17 @@ package utils
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -60,6 +68,13 @@ type FileManager struct {
 
 	// ArchiveOnSuccess determines whether to archive files after successful processing.
 	ArchiveOnSuccess bool
+
+	// RetryAttempts is the number of times an archive operation is tried
+	// when it fails with a transient error (e.g., SMB share unavailable).
+	RetryAttempts int
+
+	// RetryDelay is the wait before the first retry. It doubles after each attempt.
+	RetryDelay time.Duration
 }
 
 // NewFileManager creates a new FileManager with the specified directories.
@@ -71,6 +86,8 @@ func NewFileManager(inputDir, outputDir, inputArchiveDir, outputArchiveDir strin
 		OutputArchiveDir:    outputArchiveDir,
 		UseTimestampSubdirs: false,
 		ArchiveOnSuccess:    true,
+		RetryAttempts:       3,
+		RetryDelay:          2 * time.Second,
 	}
 }
 
@@ -201,19 +218,14 @@ func (fm *FileManager) ArchiveInputFile(filePath string) (string, error) {
 
 	// Ensure the archive directory exists.
 	archiveDir := filepath.Dir(archivePath)
-	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+	if err := os.MkdirAll(longPath(archiveDir), 0755); err != nil {
 		return "", fmt.Errorf("failed to create archive directory: %w", err)
 	}
 
-	// Move the file.
-	if err := os.Rename(filePath, archivePath); err != nil {
-		// If rename fails (e.g., cross-device), try copy and delete.
-		if err := copyFile(filePath, archivePath); err != nil {
-			return "", fmt.Errorf("failed to copy file to archive: %w", err)
-		}
-		if err := os.Remove(filePath); err != nil {
-			return "", fmt.Errorf("failed to remove original file: %w", err)
-		}
+	// Move the file. Across devices or shares, this copies the file, verifies
+	// the copy, and deletes the original.
+	if err := fm.moveFile(filePath, archivePath); err != nil {
+		return "", fmt.Errorf("failed to move file to archive: %w", err)
 	}
 
 	return archivePath, nil
@@ -239,18 +251,31 @@ func (fm *FileManager) ArchiveOutputFile(filePath string) (string, error) {
 
 	// Ensure the archive directory exists.
 	archiveDir := filepath.Dir(archivePath)
-	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+	if err := os.MkdirAll(longPath(archiveDir), 0755); err != nil {
 		return "", fmt.Errorf("failed to create archive directory: %w", err)
 	}
 
-	// Copy the file.
-	if err := copyFile(filePath, archivePath); err != nil {
+	// Copy and verify the file.
+	if err := fm.copyFileVerified(filePath, archivePath); err != nil {
 		return "", fmt.Errorf("failed to copy file to archive: %w", err)
 	}
 
 	return archivePath, nil
 }
 
+// MoveFile moves a file. Across devices or shares, it copies the file,
+// verifies the copy, and deletes the original. Transient errors are retried.
+//
+// PARAMETERS:
+//   - src: The file to move.
+//   - dst: The destination path. Its directory must exist.
+//
+// RETURNS:
+//   - An error if the move fails after all retries.
+func (fm *FileManager) MoveFile(src, dst string) error {
+	return fm.moveFile(src, dst)
+}
+
 // getArchivePath constructs the archive path for a file.
 func (fm *FileManager) getArchivePath(archiveDir, filePath string) string {
 	fileName := filepath.Base(filePath)
@@ -325,7 +350,110 @@ func GenerateOutputFileName(format string, params map[string]string) string {
 		result += ".xml"
 	}
 
-	return result
+	return SanitizeFileName(result)
+}
+
+// MaxPath is the longest path most Windows programs can open (MAX_PATH, 260
+// characters including the terminating NUL). The converter itself uses
+// extended-length paths (see LongPath), but the systems and people that
+// pick up the output files may not.
+const MaxPath = 259
+
+// maxFileNameLength is the longest file name NTFS and most Unix file
+// systems accept.
+const maxFileNameLength = 255
+
+// minFileNameLength is the shortest a file name is shortened to. Below
+// that, the directory is too deep for MAX_PATH anyway, and the file relies
+// on long path support.
+const minFileNameLength = 32
+
+// invalidFileNameChars cannot appear in file names on Windows.
+const invalidFileNameChars = `<>:"/\|?*`
+
+// reservedFileNames are the device names Windows does not allow as file
+// names, with or without an extension.
+var reservedFileNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFileName makes a file name valid on Windows (and therefore on
+// Unix), whatever the placeholders in it expanded to.
+//
+// RETURNS:
+//   - The name with characters that are invalid on Windows (< > : " / \ |
+//     ? * and control characters) replaced by "_", trailing dots and spaces
+//     (which Windows drops) removed, and "_" prepended to a reserved device
+//     name such as "CON" or "prn.xml".
+func SanitizeFileName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 32 || strings.ContainsRune(invalidFileNameChars, r) {
+			b.WriteRune('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	name = strings.TrimRight(b.String(), ". ")
+	if name == "" {
+		return "_"
+	}
+
+	device, _, _ := strings.Cut(name, ".")
+	if reservedFileNames[strings.ToUpper(strings.TrimRight(device, " "))] {
+		name = "_" + name
+	}
+	return name
+}
+
+// SafeFileName sanitizes a file name (see SanitizeFileName) and shortens
+// it so that its path in dir fits in MaxPath, and the name itself in 255
+// bytes.
+//
+// PARAMETERS:
+//   - dir: The directory the file is written to.
+//   - name: The file name.
+//
+// RETURNS:
+//   - The file name. A shortened name keeps its extension and ends with
+//     "_" and the first 8 hex digits of the SHA-256 of the full name, so
+//     the same name is always shortened the same way and different names
+//     stay different.
+func SafeFileName(dir, name string) string {
+	name = SanitizeFileName(name)
+
+	limit := maxFileNameLength
+	if absolute, err := filepath.Abs(dir); err == nil {
+		if room := MaxPath - len(absolute) - 1; room < limit {
+			limit = room
+		}
+	}
+	if limit < minFileNameLength {
+		limit = minFileNameLength
+	}
+	if len(name) <= limit {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	ext := filepath.Ext(name)
+	if len(ext) > minFileNameLength/2 {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+
+	// Cut at a character boundary.
+	keep := limit - len(suffix) - len(ext)
+	for keep > 0 && !utf8.RuneStart(base[keep]) {
+		keep--
+	}
+	return base[:keep] + suffix + ext
 }
 
 // =============================================================================
@@ -343,6 +471,17 @@ type ErrorLogEntry struct {
 	FieldValue    string
 	TransactionID int
 	LineItemID    int
+
+	// Count is the number of identical errors (same rule, field, and
+	// message) the entry stands for; 0 or 1 for a single error. SampleRows
+	// are the row numbers of the first of them.
+	Count      int
+	SampleRows []int
+
+	// Justification is set for a validation error suppressed by the
+	// department configuration: the documented reason it does not fail the
+	// file. Suppressed errors are not counted as errors.
+	Justification string
 }
 
 // WriteErrorLog writes error entries to a log file.
@@ -374,12 +513,23 @@ func WriteErrorLog(entries []ErrorLogEntry, outputDir string) (string, error) {
 	writer := bufio.NewWriter(file)
 
 	// Write header.
+	total, suppressed := 0, 0
+	for _, entry := range entries {
+		if entry.Justification != "" {
+			suppressed++
+			continue
+		}
+		total += max(entry.Count, 1)
+	}
 	header := fmt.Sprintf("CSV to XML Converter - Error Log\n"+
 		"Generated: %s\n"+
-		"Total Errors: %d\n"+
-		"================================================================================\n\n",
+		"Total Errors: %d\n",
 		time.Now().Format("2006-01-02 15:04:05"),
-		len(entries))
+		total)
+	if suppressed > 0 {
+		header += fmt.Sprintf("Suppressed Errors: %d (not counted; see the justifications)\n", suppressed)
+	}
+	header += "================================================================================\n\n"
 	writer.WriteString(header)
 
 	// Write each entry.
@@ -410,6 +560,13 @@ func WriteErrorLog(entries []ErrorLogEntry, outputDir string) (string, error) {
 		if entry.LineItemID > 0 {
 			entryStr += fmt.Sprintf("  Line Item ID:   %d\n", entry.LineItemID)
 		}
+		if entry.Count > 1 {
+			entryStr += fmt.Sprintf("  Occurrences:    %d\n", entry.Count)
+			entryStr += fmt.Sprintf("  Sample Rows:    %s\n", JoinInts(entry.SampleRows))
+		}
+		if entry.Justification != "" {
+			entryStr += fmt.Sprintf("  Suppressed:     %s\n", entry.Justification)
+		}
 
 		entryStr += "\n"
 		writer.WriteString(entryStr)
@@ -432,38 +589,118 @@ func WriteErrorLog(entries []ErrorLogEntry, outputDir string) (string, error) {
 // =============================================================================
 
 // ProcessingSummary contains summary information about a processing run.
+// It is also printed as JSON by "process --output json".
 type ProcessingSummary struct {
-	StartTime        time.Time
-	EndTime          time.Time
-	TotalFiles       int
-	SuccessfulFiles  int
-	FailedFiles      int
-	TotalRows        int
-	TotalTransactions int
-	TotalLineItems   int
-	ValidationErrors int
-	ProcessedFiles   []ProcessedFileInfo
-	FailedFilesList  []FailedFileInfo
+	StartTime         time.Time           `json:"start_time"`
+	EndTime           time.Time           `json:"end_time"`
+	TotalFiles        int                 `json:"total_files"`
+	SuccessfulFiles   int                 `json:"successful_files"`
+	FailedFiles       int                 `json:"failed_files"`
+	SkippedFiles      int                 `json:"skipped_files"`
+	TotalRows         int                 `json:"total_rows"`
+	TotalTransactions int                 `json:"total_transactions"`
+	TotalLineItems    int                 `json:"total_line_items"`
+	ValidationErrors  int                 `json:"validation_errors"`
+
+	// RejectedTransactions is the number of transactions that failed
+	// validation and were set aside from files that were otherwise converted.
+	RejectedTransactions int `json:"rejected_transactions,omitempty"`
+
+	// ValidationErrorsByRule and ValidationErrorsByField count the
+	// validation errors of the run by rule code and by field (CSV column).
+	ValidationErrorsByRule  map[string]int `json:"validation_errors_by_rule,omitempty"`
+	ValidationErrorsByField map[string]int `json:"validation_errors_by_field,omitempty"`
+
+	ProcessedFiles    []ProcessedFileInfo `json:"processed_files"`
+	FailedFilesList   []FailedFileInfo    `json:"failed_files_list"`
+
+	// SchemaDrifts are the input files whose headers differ from those of
+	// the department's last successful run.
+	SchemaDrifts []SchemaDriftInfo `json:"schema_drifts,omitempty"`
+
+	// ExitCode is the exit code of the run, and Error the error that ended
+	// it early (e.g., an invalid configuration).
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
 }
 
 // ProcessedFileInfo contains information about a successfully processed file.
 type ProcessedFileInfo struct {
-	InputFile    string
-	OutputFile   string
-	ArchivePath  string
-	Rows         int
-	Transactions int
-	LineItems    int
-	ProcessTime  time.Duration
+	InputFile    string        `json:"input_file"`
+	OutputFile   string        `json:"output_file"`
+	ArchivePath  string        `json:"archive_path,omitempty"`
+	Rows         int           `json:"rows"`
+	Transactions int           `json:"transactions"`
+	LineItems    int           `json:"line_items"`
+	ProcessTime  time.Duration `json:"process_time_ns"`
+
+	// RejectedTransactions and RejectedFiles describe the transactions
+	// that failed validation and were set aside.
+	RejectedTransactions int      `json:"rejected_transactions,omitempty"`
+	RejectedFiles        []string `json:"rejected_files,omitempty"`
+
+	// SuppressedErrors lists the validation errors suppressed by the
+	// department configuration, with their justifications, as formatted
+	// by validation.FormatSuppressed. Empty if there were none.
+	SuppressedErrors string `json:"suppressed_errors,omitempty"`
 }
 
 // FailedFileInfo contains information about a failed file.
 type FailedFileInfo struct {
-	InputFile    string
-	ErrorMessage string
-	ErrorType    string
+	InputFile    string `json:"input_file"`
+	ErrorMessage string `json:"error_message"`
+
+	// ErrorType is "validation" for files that failed validation, and
+	// "processing" for any other failure.
+	ErrorType string `json:"error_type"`
+
+	// ErrorsByTransaction counts the validation errors of the file by
+	// range of transactions (e.g., "1-100"), in order.
+	ErrorsByTransaction []ErrorCount `json:"errors_by_transaction,omitempty"`
+
+	// ErrorGroups are the validation errors of the file, identical errors
+	// grouped, in the order of their first occurrence.
+	ErrorGroups []ErrorGroupInfo `json:"error_groups,omitempty"`
+}
+
+// ErrorGroupInfo describes identical validation errors: the same rule,
+// field, and message.
+type ErrorGroupInfo struct {
+	Code       string `json:"code"`
+	Field      string `json:"field"`
+	Message    string `json:"message"`
+	Severity   string `json:"severity"`
+	Count      int    `json:"count"`
+	SampleRows []int  `json:"sample_rows,omitempty"`
 }
 
+// SchemaDriftInfo describes how the headers of an input file differ from
+// those of the department's last successful run with the same template.
+type SchemaDriftInfo struct {
+	InputFile  string `json:"input_file"`
+	Department string `json:"department"`
+	Template   string `json:"template"`
+
+	// Changes lists each change, e.g. "added REF_NO" or
+	// "renamed POLICY_NO -> POLICY_NUMBER".
+	Changes []string `json:"changes"`
+
+	// PreviousHeaders and CurrentHeaders are the full header lists.
+	PreviousHeaders []string `json:"previous_headers"`
+	CurrentHeaders  []string `json:"current_headers"`
+}
+
+// ErrorCount is the number of validation errors for a key: a rule code, a
+// field, or a range of transactions.
+type ErrorCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// summaryTopCount is the number of rules and fields listed in the
+// validation breakdown of the summary file.
+const summaryTopCount = 5
+
 // WriteSummaryLog writes a processing summary to a log file.
 //
 // PARAMETERS:
@@ -503,7 +740,7 @@ func WriteSummaryLog(summary ProcessingSummary, outputDir string) (string, error
 		"  Total Rows:         %d\n"+
 		"  Total Transactions: %d\n"+
 		"  Total Line Items:   %d\n"+
-		"  Validation Errors:  %d\n\n",
+		"  Validation Errors:  %d\n",
 		summary.StartTime.Format("2006-01-02 15:04:05"),
 		summary.EndTime.Format("2006-01-02 15:04:05"),
 		duration.String(),
@@ -515,6 +752,33 @@ func WriteSummaryLog(summary ProcessingSummary, outputDir string) (string, error
 		summary.TotalLineItems,
 		summary.ValidationErrors)
 	writer.WriteString(header)
+	if summary.RejectedTransactions > 0 {
+		writer.WriteString(fmt.Sprintf("  Rejected:           %d transaction(s)\n", summary.RejectedTransactions))
+	}
+	writer.WriteString("\n")
+
+	// Write header changes first: they can silently break the mappings.
+	if len(summary.SchemaDrifts) > 0 {
+		writer.WriteString("!! Schema Drift: input headers changed since the last successful run !!\n")
+		writer.WriteString("--------------------------------------------------------------------------------\n")
+		for _, drift := range summary.SchemaDrifts {
+			writer.WriteString(fmt.Sprintf("  File:     %s (%s, %s)\n", drift.InputFile, drift.Department, drift.Template))
+			for _, change := range drift.Changes {
+				writer.WriteString(fmt.Sprintf("    %s\n", change))
+			}
+			writer.WriteString(fmt.Sprintf("  Before:   %s\n", strings.Join(drift.PreviousHeaders, ", ")))
+			writer.WriteString(fmt.Sprintf("  Now:      %s\n\n", strings.Join(drift.CurrentHeaders, ", ")))
+		}
+	}
+
+	// Write the validation breakdown, so the most common failures stand out.
+	if len(summary.ValidationErrorsByRule) > 0 {
+		writer.WriteString("Validation Breakdown:\n")
+		writer.WriteString("--------------------------------------------------------------------------------\n")
+		writeTopCounts(writer, "Top Rules", summary.ValidationErrorsByRule)
+		writeTopCounts(writer, "Top Fields", summary.ValidationErrorsByField)
+		writer.WriteString("\n")
+	}
 
 	// Write successful files.
 	if len(summary.ProcessedFiles) > 0 {
@@ -525,6 +789,18 @@ func WriteSummaryLog(summary ProcessingSummary, outputDir string) (string, error
 			writer.WriteString(fmt.Sprintf("  Output:       %s\n", pf.OutputFile))
 			writer.WriteString(fmt.Sprintf("  Rows:         %d\n", pf.Rows))
 			writer.WriteString(fmt.Sprintf("  Transactions: %d\n", pf.Transactions))
+			if pf.RejectedTransactions > 0 {
+				writer.WriteString(fmt.Sprintf("  Rejected:     %d transaction(s) in %s\n", pf.RejectedTransactions, strings.Join(pf.RejectedFiles, ", ")))
+			}
+			if pf.SuppressedErrors != "" {
+				writer.WriteString("  Suppressed:\n")
+				for _, line := range strings.Split(strings.TrimSuffix(pf.SuppressedErrors, "\n"), "\n") {
+					if line != "" {
+						line = "    " + line
+					}
+					writer.WriteString(line + "\n")
+				}
+			}
 			writer.WriteString(fmt.Sprintf("  Process Time: %s\n\n", pf.ProcessTime.String()))
 		}
 	}
@@ -535,7 +811,15 @@ func WriteSummaryLog(summary ProcessingSummary, outputDir string) (string, error
 		writer.WriteString("--------------------------------------------------------------------------------\n")
 		for _, ff := range summary.FailedFilesList {
 			writer.WriteString(fmt.Sprintf("  File:  %s\n", ff.InputFile))
-			writer.WriteString(fmt.Sprintf("  Error: %s\n\n", ff.ErrorMessage))
+			writer.WriteString(fmt.Sprintf("  Error: %s\n", ff.ErrorMessage))
+			if len(ff.ErrorsByTransaction) > 0 {
+				ranges := make([]string, len(ff.ErrorsByTransaction))
+				for i, count := range ff.ErrorsByTransaction {
+					ranges[i] = fmt.Sprintf("%s: %d", count.Key, count.Count)
+				}
+				writer.WriteString(fmt.Sprintf("  Errors by transaction: %s\n", strings.Join(ranges, ", ")))
+			}
+			writer.WriteString("\n")
 		}
 	}
 
@@ -551,10 +835,44 @@ func WriteSummaryLog(summary ProcessingSummary, outputDir string) (string, error
 	return summaryPath, nil
 }
 
+// writeTopCounts writes the most frequent keys of a count, with their share
+// of the total.
+func writeTopCounts(writer *bufio.Writer, title string, counts map[string]int) {
+	total := 0
+	sorted := make([]ErrorCount, 0, len(counts))
+	for key, count := range counts {
+		total += count
+		sorted = append(sorted, ErrorCount{Key: key, Count: count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	if len(sorted) > summaryTopCount {
+		sorted = sorted[:summaryTopCount]
+	}
+
+	writer.WriteString(fmt.Sprintf("  %s:\n", title))
+	for _, count := range sorted {
+		writer.WriteString(fmt.Sprintf("    %-24s %6d  (%.0f%%)\n", count.Key, count.Count, 100*float64(count.Count)/float64(total)))
+	}
+}
+
 // =============================================================================
 // UTILITY FUNCTIONS
 // =============================================================================
 
+// JoinInts joins numbers with commas (e.g., sample row numbers).
+func JoinInts(numbers []int) string {
+	parts := make([]string, len(numbers))
+	for i, number := range numbers {
+		parts[i] = strconv.Itoa(number)
+	}
+	return strings.Join(parts, ", ")
+}
+
 // copyFile copies a file from src to dst.
 func copyFile(src, dst string) error {
 	sourceFile, err := os.Open(src)
@@ -0,0 +1,204 @@
+// =============================================================================
+// CSV to XML Converter - Robust File Operations
+// =============================================================================
+//
+// Input and archive directories are often on different network shares, where
+// os.Rename fails with "invalid cross-device link" and SMB errors are common.
+// This file provides the move/copy primitives used by the FileManager:
+//   - Cross-device moves fall back to copy + verify + delete
+//   - Copies are written to a ".partial" file and renamed when verified,
+//     so an interrupted copy never looks like a complete archive
+//   - Transient errors are retried with exponential backoff
+//   - Long paths (> 260 characters) work on Windows
+//
+// The platform-specific error classification and path handling live in
+// fileops_windows.go and fileops_unix.go.
+//
+// =============================================================================
+
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// partialSuffix is appended to files while they are being copied.
+const partialSuffix = ".partial"
+
+// LongPath returns a form of path that may exceed MAX_PATH: the
+// extended-length form (\\?\...) on Windows, and path itself elsewhere.
+// The FileManager uses it for every file it moves or copies; use it to
+// write files whose path may be long.
+func LongPath(path string) string {
+	return longPath(path)
+}
+
+// FormatSize formats a number of bytes for display, e.g., "1.5 GB".
+func FormatSize(bytes uint64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	}
+	return fmt.Sprintf("%d KB", bytes>>10)
+}
+
+// ExistingDir returns dir, or its nearest existing parent if dir does not
+// exist yet (it is created when it is first used).
+func ExistingDir(dir string) (string, error) {
+	existing := dir
+	for {
+		info, err := os.Stat(existing)
+		if err == nil {
+			if !info.IsDir() {
+				return "", fmt.Errorf("%s is not a directory", existing)
+			}
+			return existing, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return "", err
+		}
+		existing = parent
+	}
+}
+
+// =============================================================================
+// MOVE AND COPY
+// =============================================================================
+
+// moveFile moves a file, falling back to copy + verify + delete when the
+// source and destination are on different devices or shares.
+//
+// PARAMETERS:
+//   - src: The file to move.
+//   - dst: The destination path.
+//
+// RETURNS:
+//   - An error if the move fails after all retries.
+func (fm *FileManager) moveFile(src, dst string) error {
+	return fm.retry(func() error {
+		err := os.Rename(longPath(src), longPath(dst))
+		if err == nil || !isCrossDevice(err) {
+			return err
+		}
+
+		if err := copyVerified(src, dst); err != nil {
+			return err
+		}
+		return os.Remove(longPath(src))
+	})
+}
+
+// copyFileVerified copies a file and verifies the copy, retrying transient errors.
+func (fm *FileManager) copyFileVerified(src, dst string) error {
+	return fm.retry(func() error {
+		return copyVerified(src, dst)
+	})
+}
+
+// copyVerified copies src to dst through a ".partial" file and only renames
+// it into place when its SHA-256 checksum matches the source.
+func copyVerified(src, dst string) error {
+	partial := dst + partialSuffix
+
+	sourceSum, err := copyWithChecksum(src, partial)
+	if err != nil {
+		os.Remove(longPath(partial))
+		return err
+	}
+
+	copySum, err := fileChecksum(partial)
+	if err != nil {
+		os.Remove(longPath(partial))
+		return err
+	}
+
+	if !bytes.Equal(sourceSum, copySum) {
+		os.Remove(longPath(partial))
+		return fmt.Errorf("verification failed: checksum of %s does not match %s", dst, src)
+	}
+
+	return os.Rename(longPath(partial), longPath(dst))
+}
+
+// copyWithChecksum copies src to dst and returns the SHA-256 of the data read.
+func copyWithChecksum(src, dst string) ([]byte, error) {
+	sourceFile, err := os.Open(longPath(src))
+	if err != nil {
+		return nil, err
+	}
+	defer sourceFile.Close()
+
+	destFile, err := os.Create(longPath(dst))
+	if err != nil {
+		return nil, err
+	}
+	defer destFile.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(destFile, hash), sourceFile); err != nil {
+		return nil, err
+	}
+
+	if err := destFile.Sync(); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), destFile.Close()
+}
+
+// fileChecksum returns the SHA-256 of a file.
+func fileChecksum(path string) ([]byte, error) {
+	file, err := os.Open(longPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// =============================================================================
+// RETRIES
+// =============================================================================
+
+// retry runs the operation until it succeeds, fails with a permanent error,
+// or the retry attempts are exhausted. The delay doubles after each attempt.
+func (fm *FileManager) retry(operation func() error) error {
+	attempts := fm.RetryAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := fm.RetryDelay
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = operation()
+		if err == nil || !isTransient(err) {
+			return err
+		}
+
+		if attempt < attempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+}
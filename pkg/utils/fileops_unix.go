@@ -0,0 +1,55 @@
+//go:build !windows
+
+package utils
+
+import (
+	"errors"
+	"syscall"
+)
+
+// transientErrors are errors that typically clear up on their own on
+// network file systems (NFS, SMB mounts).
+var transientErrors = []syscall.Errno{
+	syscall.EAGAIN,
+	syscall.EBUSY,
+	syscall.EINTR,
+	syscall.ETIMEDOUT,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+	syscall.EHOSTDOWN,
+	syscall.EHOSTUNREACH,
+	syscall.ENETDOWN,
+	syscall.ENETUNREACH,
+	syscall.ESTALE,
+}
+
+// isCrossDevice reports whether a rename failed because the source and
+// destination are on different file systems.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// isTransient reports whether a file operation may succeed if retried.
+func isTransient(err error) bool {
+	for _, errno := range transientErrors {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// longPath returns the path unchanged; only Windows limits path length.
+func longPath(path string) string {
+	return path
+}
+
+// FreeSpace returns the number of bytes available to the user on the file
+// system that holds path.
+func FreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,94 @@
+//go:build windows
+
+package utils
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows error codes not defined in the syscall package.
+const (
+	errorNotSameDevice      syscall.Errno = 17
+	errorSharingViolation   syscall.Errno = 32
+	errorLockViolation      syscall.Errno = 33
+	errorBadNetPath         syscall.Errno = 53
+	errorNetworkBusy        syscall.Errno = 54
+	errorUnexpectedNetErr   syscall.Errno = 59
+	errorNetNameDeleted     syscall.Errno = 64
+	errorSemaphoreTimeout   syscall.Errno = 121
+	errorUserMappedFile     syscall.Errno = 1224
+	errorNetworkUnreachable syscall.Errno = 1231
+)
+
+// transientErrors are errors that typically clear up on their own on SMB
+// shares: files locked by virus scanners or backup agents, and brief
+// network interruptions.
+var transientErrors = []syscall.Errno{
+	errorSharingViolation,
+	errorLockViolation,
+	errorBadNetPath,
+	errorNetworkBusy,
+	errorUnexpectedNetErr,
+	errorNetNameDeleted,
+	errorSemaphoreTimeout,
+	errorUserMappedFile,
+	errorNetworkUnreachable,
+}
+
+// isCrossDevice reports whether a rename failed because the source and
+// destination are on different volumes or shares.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
+
+// isTransient reports whether a file operation may succeed if retried.
+func isTransient(err error) bool {
+	for _, errno := range transientErrors {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// longPath converts a path to the extended-length form (\\?\C:\... or
+// \\?\UNC\server\share\...) so that paths longer than 260 characters work.
+// Extended-length paths must be absolute and use backslashes.
+func longPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	if strings.HasPrefix(absolute, `\\`) {
+		return `\\?\UNC\` + absolute[2:]
+	}
+	return `\\?\` + absolute
+}
+
+// FreeSpace returns the number of bytes available to the user on the volume
+// or share that holds path, a directory.
+func FreeSpace(path string) (uint64, error) {
+	// A UNC path must end with a backslash.
+	if !strings.HasSuffix(path, `\`) {
+		path += `\`
+	}
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
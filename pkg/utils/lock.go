@@ -0,0 +1,184 @@
+// =============================================================================
+// CSV to XML Converter - Advisory Lock Files
+// =============================================================================
+//
+// When two scheduled runs overlap (or a manual run overlaps the watcher), the
+// same CSV could be converted twice. Lock files prevent this:
+//   - A run-level lock in the input directory lets only one 'process' or
+//     'watch' instance work on the directory at a time.
+//   - A per-file lock ("<file>.lock") is held while a file is converted.
+//
+// Lock files are created atomically (O_EXCL) and contain the owner's process
+// ID, host name, and creation time. They work across hosts on a shared
+// network directory, where OS-level locks are unreliable.
+//
+// STALE LOCKS:
+//   A lock left behind by a crashed run is recovered when:
+//     - its owner ran on this host and the process no longer exists, or
+//     - it has not been refreshed for StaleAfter. Held locks are refreshed
+//       periodically, so long conversions do not become stale.
+//
+// =============================================================================
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LockSuffix is appended to a file name to form its lock file name.
+const LockSuffix = ".lock"
+
+// ErrLocked is returned when a lock is held by another process.
+var ErrLocked = errors.New("locked by another process")
+
+// =============================================================================
+// FILE LOCK
+// =============================================================================
+
+// FileLock is a held lock file.
+type FileLock struct {
+	path string
+	stop chan struct{}
+	once sync.Once
+}
+
+// AcquireLock creates the lock file at path.
+//
+// PARAMETERS:
+//   - path: The lock file path (e.g., "input/payments.csv.lock").
+//   - staleAfter: How long an unrefreshed lock is honored. Zero never
+//     expires locks by age.
+//
+// RETURNS:
+//   - The held lock. Call Release when done.
+//   - An error wrapping ErrLocked if another process holds the lock.
+func AcquireLock(path string, staleAfter time.Duration) (*FileLock, error) {
+	const attempts = 3
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err := createLockFile(path)
+		if err == nil {
+			lock := &FileLock{path: path, stop: make(chan struct{})}
+			if staleAfter > 0 {
+				go lock.refresh(staleAfter / 3)
+			}
+			return lock, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		data, err := os.ReadFile(longPath(path))
+		if os.IsNotExist(err) {
+			// Released in the meantime; try again.
+			continue
+		}
+		owner := strings.TrimSpace(string(data))
+
+		// Recover a stale lock and try again.
+		if attempt < attempts && isStale(path, owner, staleAfter) && removeStaleLock(path, owner) == nil {
+			continue
+		}
+
+		return nil, fmt.Errorf("%s %w (pid/host/since: %s)", path, ErrLocked, owner)
+	}
+
+	return nil, fmt.Errorf("%s %w", path, ErrLocked)
+}
+
+// Release stops refreshing the lock and removes the lock file.
+// It is safe to call more than once.
+func (l *FileLock) Release() error {
+	var err error
+	l.once.Do(func() {
+		close(l.stop)
+		if removeErr := os.Remove(longPath(l.path)); removeErr != nil && !os.IsNotExist(removeErr) {
+			err = fmt.Errorf("failed to remove lock file: %w", removeErr)
+		}
+	})
+	return err
+}
+
+// refresh updates the lock's modification time until the lock is released.
+func (l *FileLock) refresh(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			os.Chtimes(longPath(l.path), now, now)
+		}
+	}
+}
+
+// =============================================================================
+// HELPER FUNCTIONS
+// =============================================================================
+
+// createLockFile atomically creates a lock file describing this process.
+func createLockFile(path string) error {
+	file, err := os.OpenFile(longPath(path), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	_, err = fmt.Fprintf(file, "%d %s %s\n", os.Getpid(), hostname, time.Now().Format(time.RFC3339))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// isStale decides whether a lock with the given owner can be recovered.
+func isStale(path, owner string, staleAfter time.Duration) bool {
+	// A lock of a process that no longer exists on this host is stale.
+	fields := strings.Fields(owner)
+	hostname, _ := os.Hostname()
+	if len(fields) >= 2 && fields[1] == hostname {
+		if pid, err := strconv.Atoi(fields[0]); err == nil && !processAlive(pid) {
+			return true
+		}
+	}
+
+	// A lock that has not been refreshed in time is stale.
+	if staleAfter > 0 {
+		if info, err := os.Stat(longPath(path)); err == nil && time.Since(info.ModTime()) > staleAfter {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeStaleLock removes a stale lock. The lock is first renamed away, so
+// that two processes recovering the same lock cannot remove a fresh lock
+// created by the other; if the renamed lock is not the stale one, it is put back.
+func removeStaleLock(path, staleOwner string) error {
+	aside := fmt.Sprintf("%s.stale.%d", path, os.Getpid())
+	if err := os.Rename(longPath(path), longPath(aside)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	data, err := os.ReadFile(longPath(aside))
+	if err == nil && strings.TrimSpace(string(data)) != staleOwner {
+		os.Rename(longPath(aside), longPath(path))
+		return ErrLocked
+	}
+
+	return os.Remove(longPath(aside))
+}
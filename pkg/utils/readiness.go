@@ -0,0 +1,244 @@
+// =============================================================================
+// CSV to XML Converter - File Readiness Detection
+// =============================================================================
+//
+// Files copied into the input directory over the network can be discovered
+// while they are still being written. Converting a half-written CSV produces
+// a truncated XML file, so each discovered file is checked before processing:
+//
+//   1. Done marker (optional): the producer writes "<file><suffix>" (e.g.,
+//      "payments.csv.done") after the CSV is complete. When enabled, files
+//      without a marker are never processed, and the marker replaces the
+//      size check.
+//   2. Size stability: the file size and modification time must be unchanged
+//      for a configurable period. A single scan (a batch run) cannot watch
+//      the size that long, so it checks that the file was last modified at
+//      least that long ago, and that its size and modification time do not
+//      change over a short settle time (copies that keep the original
+//      modification time look old while they are still growing).
+//   3. Lock probing: the file must not be locked by another process (e.g.,
+//      the copy job still has it open on Windows).
+//
+// USAGE:
+//   checker := utils.NewReadinessChecker(options)
+//   ready, waiting := checker.Check(files)   // call again on the next scan
+//
+// =============================================================================
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// =============================================================================
+// OPTIONS
+// =============================================================================
+
+// ReadinessOptions configures the readiness checks.
+type ReadinessOptions struct {
+	// StableFor is how long the size and modification time must stay
+	// unchanged. Zero disables the check.
+	StableFor time.Duration
+
+	// SingleScan judges stability by the age of the modification time, so
+	// that a file can be ready on the first Check. Used by batch runs,
+	// which check once and do not wait.
+	SingleScan bool
+
+	// SettleTime is how long a single scan watches the files: their size
+	// and modification time are read before and after it, and a file that
+	// changed is not ready. Zero only checks the modification time.
+	SettleTime time.Duration
+
+	// ProbeLocks rejects files that are locked by another process.
+	ProbeLocks bool
+
+	// DoneMarkerSuffix enables the done-marker convention when not empty.
+	// Example: ".done" requires "payments.csv.done" next to "payments.csv".
+	DoneMarkerSuffix string
+}
+
+// =============================================================================
+// READINESS CHECKER
+// =============================================================================
+
+// ReadinessChecker remembers file sizes between checks, so that the size
+// stability check works across watch scans without blocking.
+// It is not safe for concurrent use.
+type ReadinessChecker struct {
+	options  ReadinessOptions
+	observed map[string]fileObservation
+	failed   map[string]failureRecord
+}
+
+// fileObservation is the last observed state of a file.
+type fileObservation struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// failureRecord holds the state of a failed file and its related files at
+// the time of the failure. Missing files are recorded as a zero observation.
+type failureRecord map[string]fileObservation
+
+// NewReadinessChecker creates a new ReadinessChecker.
+func NewReadinessChecker(options ReadinessOptions) *ReadinessChecker {
+	return &ReadinessChecker{
+		options:  options,
+		observed: make(map[string]fileObservation),
+		failed:   make(map[string]failureRecord),
+	}
+}
+
+// MarkFailed records that a file failed processing. It is not ready again
+// until it or one of the related files is created or modified, so watch
+// mode does not retry the same failing file on every scan.
+//
+// PARAMETERS:
+//   - file: The file that failed.
+//   - related: Files whose arrival may fix the failure (e.g., a fix-up file).
+func (r *ReadinessChecker) MarkFailed(file string, related ...string) {
+	record := make(failureRecord)
+	for _, path := range append([]string{file}, related...) {
+		record[path] = observeFile(path)
+	}
+	r.failed[file] = record
+}
+
+// Check returns the files that are ready for processing.
+//
+// PARAMETERS:
+//   - files: The discovered input files.
+//
+// RETURNS:
+//   - The files that are ready, in the given order.
+//   - The files that are not ready yet, with the reason.
+//
+// NOTE: Without SingleScan, a file seen for the first time is never ready
+// when StableFor is set; it becomes ready on a later Check once it has been
+// unchanged for StableFor.
+func (r *ReadinessChecker) Check(files []string) ([]string, map[string]string) {
+	var ready []string
+	waiting := make(map[string]string)
+	present := make(map[string]bool, len(files))
+
+	// A single scan reads all files once, and once more after the settle
+	// time in checkFile.
+	if r.settling() && len(files) > 0 {
+		for _, file := range files {
+			r.observed[file] = observeFile(file)
+		}
+		time.Sleep(r.options.SettleTime)
+	}
+	now := time.Now()
+
+	for _, file := range files {
+		present[file] = true
+
+		if reason := r.checkFile(file, now); reason != "" {
+			waiting[file] = reason
+			continue
+		}
+		ready = append(ready, file)
+	}
+
+	// Forget files that are gone (processed or removed).
+	for file := range r.observed {
+		if !present[file] {
+			delete(r.observed, file)
+		}
+	}
+	for file := range r.failed {
+		if !present[file] {
+			delete(r.failed, file)
+		}
+	}
+
+	return ready, waiting
+}
+
+// checkFile returns why a file is not ready, or "" if it is ready.
+func (r *ReadinessChecker) checkFile(file string, now time.Time) string {
+	if record, failed := r.failed[file]; failed {
+		if record.unchanged() {
+			return "failed previously; waiting for the file to change"
+		}
+		delete(r.failed, file)
+	}
+
+	if r.options.DoneMarkerSuffix != "" {
+		if !FileExists(DoneMarkerPath(file, r.options.DoneMarkerSuffix)) {
+			return fmt.Sprintf("waiting for %s marker", r.options.DoneMarkerSuffix)
+		}
+	} else if r.options.StableFor > 0 {
+		info, err := os.Stat(longPath(file))
+		if err != nil {
+			return fmt.Sprintf("cannot read file: %v", err)
+		}
+
+		if r.options.SingleScan {
+			if age := now.Sub(info.ModTime()); age < r.options.StableFor {
+				return fmt.Sprintf("modified %s ago, not stable for %s yet", age.Round(time.Second), r.options.StableFor)
+			}
+			if first := r.observed[file]; r.settling() && (first.size != info.Size() || !first.modTime.Equal(info.ModTime())) {
+				return fmt.Sprintf("still changing within %s", r.options.SettleTime)
+			}
+		} else {
+			last, seen := r.observed[file]
+			if !seen || last.size != info.Size() || !last.modTime.Equal(info.ModTime()) {
+				r.observed[file] = fileObservation{size: info.Size(), modTime: info.ModTime(), since: now}
+				return fmt.Sprintf("size not stable for %s yet", r.options.StableFor)
+			}
+			if now.Sub(last.since) < r.options.StableFor {
+				return fmt.Sprintf("size not stable for %s yet", r.options.StableFor)
+			}
+		}
+	}
+
+	if r.options.ProbeLocks {
+		if err := probeLock(file); err != nil {
+			return fmt.Sprintf("file is locked by another process: %v", err)
+		}
+	}
+
+	return ""
+}
+
+// settling reports whether a single scan watches the files for the
+// settle time.
+func (r *ReadinessChecker) settling() bool {
+	return r.options.SingleScan && r.options.SettleTime > 0 && r.options.StableFor > 0 && r.options.DoneMarkerSuffix == ""
+}
+
+// unchanged reports whether all files are as they were at the time of the failure.
+func (f failureRecord) unchanged() bool {
+	for path, then := range f {
+		now := observeFile(path)
+		if now.size != then.size || !now.modTime.Equal(then.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// observeFile returns the size and modification time of a file, or a zero
+// observation if the file does not exist.
+func observeFile(path string) fileObservation {
+	info, err := os.Stat(longPath(path))
+	if err != nil {
+		return fileObservation{}
+	}
+	return fileObservation{size: info.Size(), modTime: info.ModTime()}
+}
+
+// DoneMarkerPath returns the done-marker path for a file.
+//
+// EXAMPLE:
+//   DoneMarkerPath("input/payments.csv", ".done") -> "input/payments.csv.done"
+func DoneMarkerPath(file, suffix string) string {
+	return file + suffix
+}
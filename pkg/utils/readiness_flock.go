@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// probeLock tries to take a non-blocking exclusive advisory lock on the file.
+// This detects writers that hold a lock on the file; writers that do not lock
+// are caught by the size stability check instead.
+func probeLock(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return err
+	}
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
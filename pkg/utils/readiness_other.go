@@ -0,0 +1,17 @@
+//go:build !windows && !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package utils
+
+import (
+	"os"
+)
+
+// probeLock only checks that the file can be opened; file locks cannot be
+// probed portably on this platform.
+func probeLock(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package utils
+
+import (
+	"syscall"
+)
+
+// probeLock opens the file without sharing. This fails with a sharing
+// violation while another process (e.g., Explorer or robocopy still copying
+// the file) has it open.
+func probeLock(file string) error {
+	path, err := syscall.UTF16PtrFromString(longPath(file))
+	if err != nil {
+		return err
+	}
+
+	handle, err := syscall.CreateFile(
+		path,
+		syscall.GENERIC_READ,
+		0, // No sharing.
+		nil,
+		syscall.OPEN_EXISTING,
+		syscall.FILE_ATTRIBUTE_NORMAL,
+		0,
+	)
+	if err != nil {
+		return err
+	}
+
+	return syscall.CloseHandle(handle)
+}
@@ -0,0 +1,139 @@
+// =============================================================================
+// CSV to XML Converter - File Sequence Numbers
+// =============================================================================
+//
+// Some target systems require a gap-free, increasing sequence number in each
+// file so they can detect missing or repeated files. The current number is
+// kept in a small text file per department and incremented under a lock
+// file, so concurrent conversions and overlapping runs never hand out the
+// same number twice.
+//
+// A number is allocated when a file's output is generated. If that file then
+// fails (e.g., delivery is rejected), its number is not reused.
+//
+// ReserveSequence allocates a block of numbers at once, e.g. the line item
+// numbers of a file when numbering continues across files.
+//
+// =============================================================================
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sequenceLockTimeout is how long NextSequence waits for another conversion
+// to release the sequence file.
+const sequenceLockTimeout = 30 * time.Second
+
+// NextSequence increments and returns the sequence number stored at path.
+//
+// PARAMETERS:
+//   - path: The sequence file (e.g., "state/CLAIMS.sequence"). A missing
+//     file starts the sequence at 1.
+//   - staleAfter: How long an unrefreshed lock is honored (see AcquireLock).
+//
+// RETURNS:
+//   - The new sequence number.
+//   - An error if the file cannot be locked, read, or written.
+func NextSequence(path string, staleAfter time.Duration) (int, error) {
+	return ReserveSequence(path, 1, staleAfter)
+}
+
+// ReserveSequence allocates count consecutive numbers of the sequence
+// stored at path.
+//
+// PARAMETERS:
+//   - path: The sequence file. A missing file starts the sequence at 1.
+//   - count: How many numbers to allocate (at least 1).
+//   - staleAfter: How long an unrefreshed lock is honored (see AcquireLock).
+//
+// RETURNS:
+//   - The first allocated number; the block ends at first+count-1.
+//   - An error if the file cannot be locked, read, or written.
+func ReserveSequence(path string, count int, staleAfter time.Duration) (int, error) {
+	if count < 1 {
+		return 0, fmt.Errorf("invalid sequence block size %d", count)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	// The lock is only held for a moment, so wait for it instead of failing.
+	deadline := time.Now().Add(sequenceLockTimeout)
+	var lock *FileLock
+	for {
+		var err error
+		lock, err = AcquireLock(path+LockSuffix, staleAfter)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrLocked) || time.Now().After(deadline) {
+			return 0, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	defer lock.Release()
+
+	current, err := readSequence(path)
+	if err != nil {
+		return 0, err
+	}
+
+	last := current + count
+
+	// Replace the file atomically, so a crash never leaves it empty.
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, []byte(strconv.Itoa(last)+"\n"), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write sequence file: %w", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return 0, fmt.Errorf("failed to write sequence file: %w", err)
+	}
+
+	return current + 1, nil
+}
+
+// PeekSequence returns the sequence number NextSequence would return,
+// without incrementing it. It is used for previews; another conversion may
+// take the number first.
+//
+// PARAMETERS:
+//   - path: The sequence file.
+//
+// RETURNS:
+//   - The next sequence number.
+//   - An error if the file cannot be read.
+func PeekSequence(path string) (int, error) {
+	current, err := readSequence(path)
+	if err != nil {
+		return 0, err
+	}
+	return current + 1, nil
+}
+
+// readSequence returns the sequence number stored at path, or 0 if the
+// file does not exist.
+func readSequence(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read sequence file: %w", err)
+	}
+
+	text := strings.TrimSpace(string(data))
+	if text == "" {
+		return 0, nil
+	}
+	current, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("sequence file %s is corrupt: %w", path, err)
+	}
+	return current, nil
+}